@@ -16,6 +16,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -59,11 +60,34 @@ type Task struct {
 	Progress TaskProgress `json:"progress"`
 
 	SpawnTime time.Time `json:"spawn-time,omitempty"`
+	StartTime time.Time `json:"start-time,omitempty"`
 	ReadyTime time.Time `json:"ready-time,omitempty"`
 
+	// DoingTime and UndoingTime are how long the task's handlers have spent
+	// doing and undoing it, respectively.
+	DoingTime   time.Duration `json:"-"`
+	UndoingTime time.Duration `json:"-"`
+
 	Data map[string]*json.RawMessage
 }
 
+// UnmarshalJSON decodes a task, parsing the durations sent as strings.
+func (t *Task) UnmarshalJSON(data []byte) error {
+	type plainTask Task
+	var jt struct {
+		plainTask
+		DoingTime   string `json:"doing-time"`
+		UndoingTime string `json:"undoing-time"`
+	}
+	if err := json.Unmarshal(data, &jt); err != nil {
+		return err
+	}
+	*t = Task(jt.plainTask)
+	t.DoingTime, _ = time.ParseDuration(jt.DoingTime)
+	t.UndoingTime, _ = time.ParseDuration(jt.UndoingTime)
+	return nil
+}
+
 // Get unmarshals into value the kind-specific data with the provided key.
 func (t *Task) Get(key string, value interface{}) error {
 	raw := t.Data[key]
@@ -86,8 +110,39 @@ type changeAndData struct {
 
 // Change fetches information about a Change given its ID.
 func (client *Client) Change(id string) (*Change, error) {
+	return client.ChangeContext(context.Background(), id)
+}
+
+// ChangeContext is like Change, but uses ctx for the API requests so that they
+// can be cancelled.
+func (client *Client) ChangeContext(ctx context.Context, id string) (*Change, error) {
 	var chgd changeAndData
-	_, err := client.doSync("GET", "/v1/changes/"+id, nil, nil, nil, &chgd)
+	_, err := client.doSync(ctx, "GET", "/v1/changes/"+id, nil, nil, nil, &chgd)
+	if err != nil {
+		return nil, err
+	}
+
+	chgd.Change.data = chgd.Data
+	return &chgd.Change, nil
+}
+
+// PollChange fetches information about a change like Change, but if the
+// change isn't ready yet, the daemon first waits up to wait for it to become
+// ready. Either way, the change is returned as it is at that point. Older
+// daemons don't wait, returning the change straight away.
+func (client *Client) PollChange(id string, wait time.Duration) (*Change, error) {
+	return client.PollChangeContext(context.Background(), id, wait)
+}
+
+// PollChangeContext is like PollChange, but uses ctx for the API requests so
+// that they can be cancelled.
+func (client *Client) PollChangeContext(ctx context.Context, id string, wait time.Duration) (*Change, error) {
+	query := url.Values{}
+	if wait > 0 {
+		query.Set("wait", wait.String())
+	}
+	var chgd changeAndData
+	_, err := client.doSync(ctx, "GET", "/v1/changes/"+id, query, nil, nil, &chgd)
 	if err != nil {
 		return nil, err
 	}
@@ -98,6 +153,12 @@ func (client *Client) Change(id string) (*Change, error) {
 
 // Abort attempts to abort a change that is in not yet ready.
 func (client *Client) Abort(id string) (*Change, error) {
+	return client.AbortContext(context.Background(), id)
+}
+
+// AbortContext is like Abort, but uses ctx for the API requests so that they
+// can be cancelled.
+func (client *Client) AbortContext(ctx context.Context, id string) (*Change, error) {
 	var postData struct {
 		Action string `json:"action"`
 	}
@@ -109,7 +170,7 @@ func (client *Client) Abort(id string) (*Change, error) {
 	}
 
 	var chg Change
-	if _, err := client.doSync("POST", "/v1/changes/"+id, nil, nil, &body, &chg); err != nil {
+	if _, err := client.doSync(ctx, "POST", "/v1/changes/"+id, nil, nil, &body, &chg); err != nil {
 		return nil, err
 	}
 
@@ -143,6 +204,12 @@ type ChangesOptions struct {
 }
 
 func (client *Client) Changes(opts *ChangesOptions) ([]*Change, error) {
+	return client.ChangesContext(context.Background(), opts)
+}
+
+// ChangesContext is like Changes, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) ChangesContext(ctx context.Context, opts *ChangesOptions) ([]*Change, error) {
 	query := url.Values{}
 	if opts != nil {
 		if opts.Selector != 0 {
@@ -154,7 +221,7 @@ func (client *Client) Changes(opts *ChangesOptions) ([]*Change, error) {
 	}
 
 	var chgds []changeAndData
-	_, err := client.doSync("GET", "/v1/changes", query, nil, nil, &chgds)
+	_, err := client.doSync(ctx, "GET", "/v1/changes", query, nil, nil, &chgds)
 	if err != nil {
 		return nil, err
 	}
@@ -174,12 +241,36 @@ type WaitChangeOptions struct {
 	// If nonzero, wait at most this long before returning. If a timeout
 	// occurs, WaitChange will return an error.
 	Timeout time.Duration
+
+	// Progress, if set, is called with the change each time it's fetched
+	// while waiting, including the last time, once it's ready, so that the
+	// caller can show the progress of its tasks. The change is then polled
+	// (see PollChange) every PollInterval, rather than waited for in a
+	// single request.
+	Progress func(change *Change)
+
+	// PollInterval is how often the change is fetched when Progress is set.
+	// Defaults to 100 milliseconds.
+	PollInterval time.Duration
 }
 
-// WaitChange waits for the change to be finished. If the wait operation
-// succeeds, the returned Change.Err string will be non-empty if the change
-// itself had an error.
+const defaultWaitPollInterval = 100 * time.Millisecond
+
+// WaitChange waits for the change to be finished, such as one returned by
+// Start or Stop, optionally following its progress (see
+// WaitChangeOptions.Progress). If the wait operation succeeds, the returned
+// Change.Err string will be non-empty if the change itself had an error.
 func (client *Client) WaitChange(id string, opts *WaitChangeOptions) (*Change, error) {
+	return client.WaitChangeContext(context.Background(), id, opts)
+}
+
+// WaitChangeContext is like WaitChange, but uses ctx for the API requests so
+// that they can be cancelled.
+func (client *Client) WaitChangeContext(ctx context.Context, id string, opts *WaitChangeOptions) (*Change, error) {
+	if opts != nil && opts.Progress != nil {
+		return client.waitChangeProgress(ctx, id, opts)
+	}
+
 	var chgd changeAndData
 
 	query := url.Values{}
@@ -187,7 +278,7 @@ func (client *Client) WaitChange(id string, opts *WaitChangeOptions) (*Change, e
 		query.Set("timeout", opts.Timeout.String())
 	}
 
-	_, err := client.doSync("GET", "/v1/changes/"+id+"/wait", query, nil, nil, &chgd)
+	_, err := client.doSync(ctx, "GET", "/v1/changes/"+id+"/wait", query, nil, nil, &chgd)
 	if err != nil {
 		return nil, err
 	}
@@ -195,3 +286,43 @@ func (client *Client) WaitChange(id string, opts *WaitChangeOptions) (*Change, e
 	chgd.Change.data = chgd.Data
 	return &chgd.Change, nil
 }
+
+// waitChangeProgress polls the change every opts.PollInterval, calling
+// opts.Progress each time, until it's ready or opts.Timeout has elapsed.
+func (client *Client) waitChangeProgress(ctx context.Context, id string, opts *WaitChangeOptions) (*Change, error) {
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = defaultWaitPollInterval
+	}
+	var deadline time.Time
+	if opts.Timeout != 0 {
+		deadline = time.Now().Add(opts.Timeout)
+	}
+	for {
+		start := time.Now()
+		chg, err := client.PollChangeContext(ctx, id, interval)
+		if err != nil {
+			return nil, err
+		}
+		opts.Progress(chg)
+		if chg.Ready {
+			return chg, nil
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("timed out waiting for change after %s", opts.Timeout)
+		}
+		// The daemon waited for the change, unless it's an older one that
+		// returned straight away.
+		remaining := interval - time.Since(start)
+		if remaining <= 0 {
+			continue
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
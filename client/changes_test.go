@@ -15,8 +15,11 @@
 package client_test
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"time"
 
 	"gopkg.in/check.v1"
@@ -33,7 +36,7 @@ func (cs *clientSuite) TestClientChange(c *check.C) {
   "ready": false,
   "spawn-time": "2016-04-21T01:02:03Z",
   "ready-time": "2016-04-21T01:02:04Z",
-  "tasks": [{"kind": "bar", "summary": "...", "status": "Do", "progress": {"done": 0, "total": 1}, "spawn-time": "2016-04-21T01:02:03Z", "ready-time": "2016-04-21T01:02:04Z"}]
+  "tasks": [{"kind": "bar", "summary": "...", "status": "Do", "progress": {"done": 0, "total": 1}, "spawn-time": "2016-04-21T01:02:03Z", "start-time": "2016-04-21T01:02:03.5Z", "ready-time": "2016-04-21T01:02:04Z", "doing-time": "400ms", "undoing-time": "1.5s"}]
 }}`
 
 	chg, err := cs.cli.Change("uno")
@@ -49,7 +52,11 @@ func (cs *clientSuite) TestClientChange(c *check.C) {
 			Status:    "Do",
 			Progress:  client.TaskProgress{Done: 0, Total: 1},
 			SpawnTime: time.Date(2016, 04, 21, 1, 2, 3, 0, time.UTC),
+			StartTime: time.Date(2016, 04, 21, 1, 2, 3, 5e8, time.UTC),
 			ReadyTime: time.Date(2016, 04, 21, 1, 2, 4, 0, time.UTC),
+
+			DoingTime:   400 * time.Millisecond,
+			UndoingTime: 1500 * time.Millisecond,
 		}},
 
 		SpawnTime: time.Date(2016, 04, 21, 1, 2, 3, 0, time.UTC),
@@ -100,6 +107,68 @@ func (cs *clientSuite) TestClientWaitChangeTimeout(c *check.C) {
 	c.Assert(err, check.ErrorMatches, `.*timed out waiting for change.*`)
 }
 
+func (cs *clientSuite) TestClientWaitChangeProgress(c *check.C) {
+	cs.rsps = []string{
+		`{"type": "sync", "result": {"id": "uno", "status": "Doing", "ready": false,
+		  "tasks": [{"kind": "bar", "status": "Doing", "progress": {"done": 1, "total": 3}}]}}`,
+		`{"type": "sync", "result": {"id": "uno", "status": "Doing", "ready": false,
+		  "tasks": [{"kind": "bar", "status": "Doing", "progress": {"done": 2, "total": 3}}]}}`,
+		`{"type": "sync", "result": {"id": "uno", "status": "Done", "ready": true,
+		  "tasks": [{"kind": "bar", "status": "Done", "progress": {"done": 3, "total": 3}}]}}`,
+	}
+
+	var done []int
+	chg, err := cs.cli.WaitChange("uno", &client.WaitChangeOptions{
+		Progress: func(change *client.Change) {
+			done = append(done, change.Tasks[0].Progress.Done)
+		},
+		PollInterval: time.Millisecond,
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(chg.Status, check.Equals, "Done")
+	c.Check(done, check.DeepEquals, []int{1, 2, 3})
+	c.Assert(cs.reqs, check.HasLen, 3)
+	for _, req := range cs.reqs {
+		c.Check(req.URL.Path, check.Equals, "/v1/changes/uno")
+		c.Check(req.URL.Query().Get("wait"), check.Equals, "1ms")
+	}
+}
+
+func (cs *clientSuite) TestClientPollChange(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": {"id": "uno", "status": "Done", "ready": true, "data": {"n": 42}}}`
+	chg, err := cs.cli.PollChange("uno", 30*time.Second)
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.String(), check.Equals, "http://localhost/v1/changes/uno?wait=30s")
+	c.Check(chg.ID, check.Equals, "uno")
+	c.Check(chg.Ready, check.Equals, true)
+	var n int
+	c.Assert(chg.Get("n", &n), check.IsNil)
+	c.Check(n, check.Equals, 42)
+}
+
+func (cs *clientSuite) TestClientWaitChangeProgressTimeout(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": {"id": "uno", "status": "Doing", "ready": false}}`
+
+	calls := 0
+	_, err := cs.cli.WaitChange("uno", &client.WaitChangeOptions{
+		Timeout:      10 * time.Millisecond,
+		Progress:     func(change *client.Change) { calls++ },
+		PollInterval: time.Millisecond,
+	})
+	c.Assert(err, check.ErrorMatches, `timed out waiting for change after 10ms`)
+	c.Check(calls > 1, check.Equals, true)
+}
+
+func (cs *clientSuite) TestClientWaitChangeProgressCancel(c *check.C) {
+	cs.rsp = `{"type": "sync", "result": {"id": "uno", "status": "Doing", "ready": false}}`
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := cs.cli.WaitChangeContext(ctx, "uno", &client.WaitChangeOptions{
+		Progress: func(change *client.Change) { cancel() },
+	})
+	c.Assert(err, check.Equals, context.Canceled)
+}
+
 func (cs *clientSuite) TestClientChangeData(c *check.C) {
 	cs.rsp = `{"type": "sync", "result": {
   "id":   "uno",
@@ -271,3 +340,24 @@ func (cs *clientSuite) TestClientAbort(c *check.C) {
 
 	c.Assert(string(body), check.Equals, "{\"action\":\"abort\"}\n")
 }
+
+func (cs *clientSuite) TestWaitChangeContextCancel(c *check.C) {
+	requested := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v1/changes/42/wait")
+		close(requested)
+		// Block like a long wait until the client goes away.
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	cli, err := client.New(&client.Config{BaseURL: server.URL})
+	c.Assert(err, check.IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-requested
+		cancel()
+	}()
+	_, err = cli.WaitChangeContext(ctx, "42", nil)
+	c.Assert(err, check.ErrorMatches, "cannot communicate with server: .*context canceled")
+}
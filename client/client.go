@@ -17,14 +17,19 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -52,8 +57,48 @@ func unixDialer(socketPath string) func(string, string) (net.Conn, error) {
 	}
 }
 
-type doer interface {
-	Do(*http.Request) (*http.Response, error)
+// A Requester sends requests to the daemon. By default the client creates
+// one from Config's BaseURL, Socket or SSH fields, but embedders can provide
+// their own in Config.Requester, for example to use a custom dialer, to talk
+// to a daemon running in the same process, or to fake the daemon in tests.
+type Requester interface {
+	// Do sends an HTTP request and returns its response, like
+	// http.Client.Do.
+	Do(req *http.Request) (*http.Response, error)
+
+	// DialContext opens a connection to the daemon for a websocket (used by
+	// exec and the event stream), like http.Transport.DialContext. For
+	// "wss" URLs, the TLS handshake is done over the returned connection.
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// defaultRequester is the Requester used when Config.Requester isn't set.
+type defaultRequester struct {
+	client    *http.Client
+	transport *http.Transport
+}
+
+func newDefaultRequester(transport *http.Transport) *defaultRequester {
+	return &defaultRequester{
+		client:    &http.Client{Transport: transport},
+		transport: transport,
+	}
+}
+
+func (r *defaultRequester) Do(req *http.Request) (*http.Response, error) {
+	return r.client.Do(req)
+}
+
+func (r *defaultRequester) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if r.transport.Dial != nil {
+		return r.transport.Dial(network, addr)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, addr)
+}
+
+func (r *defaultRequester) CloseIdleConnections() {
+	r.client.CloseIdleConnections()
 }
 
 // Config allows the user to customize client behavior.
@@ -65,18 +110,47 @@ type Config struct {
 	// Socket is the path to the unix socket to use
 	Socket string
 
+	// TLSConfig, if set, is the TLS configuration (such as the CA
+	// certificates to trust, and a client certificate) used when BaseURL is
+	// an HTTPS URL.
+	TLSConfig *tls.Config
+
+	// SSH, if set, makes the client talk to a daemon on a remote host over
+	// SSH. BaseURL and Socket are ignored in that case.
+	SSH *SSHConfig
+
 	// DisableKeepAlive indicates whether the connections should not be kept
 	// alive for later reuse
 	DisableKeepAlive bool
 
 	// User-Agent to sent to the pebble daemon
 	UserAgent string
+
+	// RetryTimeout is how long GET requests are retried for when the daemon
+	// can't be reached, for example while it restarts (the connection is
+	// refused or dropped). Zero means the default of 5 seconds, and a
+	// negative value disables retries.
+	RetryTimeout time.Duration
+
+	// RetryDelay is the delay before the first retry. It doubles after each
+	// retry, up to RetryMaxDelay, and is randomized by up to 50% either way.
+	// Zero means the default of 250 milliseconds.
+	RetryDelay time.Duration
+
+	// RetryMaxDelay is the maximum delay between retries. Zero means the
+	// default of 2 seconds.
+	RetryMaxDelay time.Duration
+
+	// Requester, if set, is used to send requests to the daemon instead of
+	// the default HTTP client. Socket, SSH and DisableKeepAlive are ignored
+	// in that case, and BaseURL (if set) is only used to build request URLs.
+	Requester Requester
 }
 
 // A Client knows how to talk to the pebble daemon.
 type Client struct {
 	baseURL   url.URL
-	doer      doer
+	requester Requester
 	userAgent string
 
 	maintenance error
@@ -84,10 +158,14 @@ type Client struct {
 	warningCount     int
 	warningTimestamp time.Time
 
+	retryTimeout  time.Duration
+	retryDelay    time.Duration
+	retryMaxDelay time.Duration
+
 	getWebsocket getWebsocketFunc
 }
 
-type getWebsocketFunc func(url string) (clientWebsocket, error)
+type getWebsocketFunc func(ctx context.Context, url string) (clientWebsocket, error)
 
 type clientWebsocket interface {
 	wsutil.MessageReader
@@ -109,7 +187,24 @@ func New(config *Config) (*Client, error) {
 	var client *Client
 	var transport *http.Transport
 
-	if config.BaseURL == "" {
+	if config.Requester != nil {
+		// Leave the transport to the embedder's requester.
+		baseURL := url.URL{Scheme: "http", Host: "localhost"}
+		if config.BaseURL != "" {
+			u, err := url.Parse(config.BaseURL)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse base URL: %v", err)
+			}
+			baseURL = *u
+		}
+		client = &Client{baseURL: baseURL, requester: config.Requester}
+	} else if config.SSH != nil {
+		// Talk to the remote daemon's UNIX socket over SSH.
+		dialer := &sshDialer{config: config.SSH}
+		transport = &http.Transport{Dial: dialer.dial, DisableKeepAlives: config.DisableKeepAlive}
+		baseURL := url.URL{Scheme: "http", Host: "localhost"}
+		client = &Client{baseURL: baseURL}
+	} else if config.BaseURL == "" {
 		// By default talk over a UNIX socket.
 		transport = &http.Transport{Dial: unixDialer(config.Socket), DisableKeepAlives: config.DisableKeepAlive}
 		baseURL := url.URL{Scheme: "http", Host: "localhost"}
@@ -120,37 +215,48 @@ func New(config *Config) (*Client, error) {
 		if err != nil {
 			return nil, fmt.Errorf("cannot parse base URL: %v", err)
 		}
-		transport = &http.Transport{DisableKeepAlives: config.DisableKeepAlive}
+		transport = &http.Transport{DisableKeepAlives: config.DisableKeepAlive, TLSClientConfig: config.TLSConfig}
 		client = &Client{baseURL: *baseURL}
 	}
 
-	client.doer = &http.Client{Transport: transport}
+	if client.requester == nil {
+		client.requester = newDefaultRequester(transport)
+	}
 	client.userAgent = config.UserAgent
-	client.getWebsocket = func(url string) (clientWebsocket, error) {
-		return getWebsocket(transport, url)
+	client.retryTimeout = config.RetryTimeout
+	client.retryDelay = config.RetryDelay
+	client.retryMaxDelay = config.RetryMaxDelay
+	client.getWebsocket = func(ctx context.Context, url string) (clientWebsocket, error) {
+		return getWebsocket(ctx, client.requester, config.TLSConfig, url)
 	}
 
 	return client, nil
 }
 
-func (client *Client) getTaskWebsocket(taskID, websocketID string) (clientWebsocket, error) {
+func (client *Client) getTaskWebsocket(ctx context.Context, taskID, websocketID string) (clientWebsocket, error) {
 	url := fmt.Sprintf("ws://localhost/v1/tasks/%s/websocket/%s", taskID, websocketID)
-	return client.getWebsocket(url)
+	return client.getWebsocket(ctx, url)
 }
 
-func getWebsocket(transport *http.Transport, url string) (clientWebsocket, error) {
+func getWebsocket(ctx context.Context, requester Requester, tlsConfig *tls.Config, url string) (clientWebsocket, error) {
 	dialer := websocket.Dialer{
-		NetDial:          transport.Dial,
-		Proxy:            transport.Proxy,
-		TLSClientConfig:  transport.TLSClientConfig,
+		NetDialContext:   requester.DialContext,
+		TLSClientConfig:  tlsConfig,
 		HandshakeTimeout: 5 * time.Second,
 	}
-	conn, _, err := dialer.Dial(url, nil)
+	conn, _, err := dialer.DialContext(ctx, url, nil)
 	return conn, err
 }
 
+// Requester returns the Requester the client sends requests with.
+func (client *Client) Requester() Requester {
+	return client.requester
+}
+
+// CloseIdleConnections closes any connections kept alive for reuse, if the
+// client's Requester supports it (the default one does).
 func (client *Client) CloseIdleConnections() {
-	c, ok := client.doer.(*http.Client)
+	c, ok := client.requester.(interface{ CloseIdleConnections() })
 	if ok {
 		c.CloseIdleConnections()
 	}
@@ -180,6 +286,10 @@ func (e ConnectionError) Error() string {
 	return fmt.Sprintf("cannot communicate with server: %v", e.error)
 }
 
+func (e ConnectionError) Unwrap() error {
+	return e.error
+}
+
 // raw performs a request and returns the resulting http.Response and
 // error you usually only need to call this directly if you expect the
 // response to not be JSON, otherwise you'd call Do(...) instead.
@@ -200,7 +310,7 @@ func (client *Client) raw(ctx context.Context, method, urlpath string, query url
 		req.Header.Set(key, value)
 	}
 
-	rsp, err := client.doer.Do(req)
+	rsp, err := client.requester.Do(req)
 	if err != nil {
 		return nil, ConnectionError{err}
 	}
@@ -209,11 +319,12 @@ func (client *Client) raw(ctx context.Context, method, urlpath string, query url
 }
 
 var (
-	doRetry   = 250 * time.Millisecond
-	doTimeout = 5 * time.Second
+	doRetry         = 250 * time.Millisecond
+	doTimeout       = 5 * time.Second
+	doMaxRetryDelay = 2 * time.Second
 )
 
-// FakeDoRetry fakes the delays used by the do retry loop.
+// FakeDoRetry fakes the default delays used by the do retry loop.
 func FakeDoRetry(retry, timeout time.Duration) (restore func()) {
 	oldRetry := doRetry
 	oldTimeout := doTimeout
@@ -226,6 +337,7 @@ func FakeDoRetry(retry, timeout time.Duration) (restore func()) {
 }
 
 type hijacked struct {
+	Requester
 	do func(*http.Request) (*http.Response, error)
 }
 
@@ -233,31 +345,53 @@ func (h hijacked) Do(req *http.Request) (*http.Response, error) {
 	return h.do(req)
 }
 
-// Hijack lets the caller take over the raw http request
+// Hijack lets the caller take over the raw http request. Websockets are
+// still dialed with the client's Requester.
 func (client *Client) Hijack(f func(*http.Request) (*http.Response, error)) {
-	client.doer = hijacked{f}
+	client.requester = hijacked{client.requester, f}
 }
 
 // do performs a request and decodes the resulting json into the given
 // value. It's low-level, for testing/experimenting only; you should
 // usually use a higher level interface that builds on this.
-func (client *Client) do(method, path string, query url.Values, headers map[string]string, body io.Reader, v interface{}) error {
-	retry := time.NewTicker(doRetry)
-	defer retry.Stop()
-	timeout := time.After(doTimeout)
+func (client *Client) do(ctx context.Context, method, path string, query url.Values, headers map[string]string, body io.Reader, v interface{}) error {
+	timeout, delay, maxDelay := client.retryTimeout, client.retryDelay, client.retryMaxDelay
+	if timeout == 0 {
+		timeout = doTimeout
+	}
+	if delay == 0 {
+		delay = doRetry
+	}
+	if maxDelay == 0 {
+		maxDelay = doMaxRetryDelay
+	}
+	deadline := time.Now().Add(timeout)
+
 	var rsp *http.Response
 	var err error
+retry:
 	for {
-		rsp, err = client.raw(context.Background(), method, path, query, headers, body)
-		if err == nil || method != "GET" {
+		rsp, err = client.raw(ctx, method, path, query, headers, body)
+		if err == nil || method != "GET" || !isTransient(err) {
 			break
 		}
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay)+1))
+		if time.Now().Add(wait).After(deadline) {
+			break
+		}
+		// Don't reuse a connection to a daemon that may have gone away.
+		client.CloseIdleConnections()
+		timer := time.NewTimer(wait)
 		select {
-		case <-retry.C:
-			continue
-		case <-timeout:
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			break retry
+		}
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
 		}
-		break
 	}
 	if err != nil {
 		return err
@@ -273,6 +407,16 @@ func (client *Client) do(method, path string, query url.Values, headers map[stri
 	return nil
 }
 
+// isTransient reports whether err is a connection error that may go away
+// when retried, such as while the daemon restarts.
+func isTransient(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ENOENT) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
 func decodeInto(reader io.Reader, v interface{}) error {
 	dec := json.NewDecoder(reader)
 	if err := dec.Decode(v); err != nil {
@@ -290,9 +434,9 @@ func decodeInto(reader io.Reader, v interface{}) error {
 // It expects a "sync" response from the API and on success decodes the JSON
 // response payload into the given value using the "UseNumber" json decoding
 // which produces json.Numbers instead of float64 types for numbers.
-func (client *Client) doSync(method, path string, query url.Values, headers map[string]string, body io.Reader, v interface{}) (*ResultInfo, error) {
+func (client *Client) doSync(ctx context.Context, method, path string, query url.Values, headers map[string]string, body io.Reader, v interface{}) (*ResultInfo, error) {
 	var rsp response
-	if err := client.do(method, path, query, headers, body, &rsp); err != nil {
+	if err := client.do(ctx, method, path, query, headers, body, &rsp); err != nil {
 		return nil, err
 	}
 	if err := rsp.err(client); err != nil {
@@ -314,15 +458,15 @@ func (client *Client) doSync(method, path string, query url.Values, headers map[
 	return &rsp.ResultInfo, nil
 }
 
-func (client *Client) doAsync(method, path string, query url.Values, headers map[string]string, body io.Reader) (changeID string, err error) {
-	_, changeID, err = client.doAsyncFull(method, path, query, headers, body)
+func (client *Client) doAsync(ctx context.Context, method, path string, query url.Values, headers map[string]string, body io.Reader) (changeID string, err error) {
+	_, changeID, err = client.doAsyncFull(ctx, method, path, query, headers, body)
 	return
 }
 
-func (client *Client) doAsyncFull(method, path string, query url.Values, headers map[string]string, body io.Reader) (result json.RawMessage, changeID string, err error) {
+func (client *Client) doAsyncFull(ctx context.Context, method, path string, query url.Values, headers map[string]string, body io.Reader) (result json.RawMessage, changeID string, err error) {
 	var rsp response
 
-	if err := client.do(method, path, query, headers, body, &rsp); err != nil {
+	if err := client.do(ctx, method, path, query, headers, body, &rsp); err != nil {
 		return nil, "", err
 	}
 	if err := rsp.err(client); err != nil {
@@ -376,13 +520,70 @@ func (e *Error) Error() string {
 	return e.Message
 }
 
+// Error kinds returned by the daemon in Error.Kind.
 const (
 	ErrorKindLoginRequired     = "login-required"
 	ErrorKindSystemRestart     = "system-restart"
 	ErrorKindDaemonRestart     = "daemon-restart"
 	ErrorKindNoDefaultServices = "no-default-services"
+	ErrorKindNotFound          = "not-found"
+	ErrorKindPermissionDenied  = "permission-denied"
+	ErrorKindGenericFileError  = "generic-file-error"
+	ErrorKindRateLimited       = "rate-limited"
+	ErrorKindReadOnly          = "read-only"
+	ErrorKindTooManyExecs      = "too-many-execs"
 )
 
+// errorKind returns the kind of the daemon error in err's chain, or "" if
+// there is none.
+func errorKind(err error) string {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return ""
+}
+
+// IsLoginRequired reports whether err is a daemon error of kind
+// ErrorKindLoginRequired.
+func IsLoginRequired(err error) bool { return errorKind(err) == ErrorKindLoginRequired }
+
+// IsSystemRestart reports whether err is a daemon error of kind
+// ErrorKindSystemRestart.
+func IsSystemRestart(err error) bool { return errorKind(err) == ErrorKindSystemRestart }
+
+// IsDaemonRestart reports whether err is a daemon error of kind
+// ErrorKindDaemonRestart.
+func IsDaemonRestart(err error) bool { return errorKind(err) == ErrorKindDaemonRestart }
+
+// IsNoDefaultServices reports whether err is a daemon error of kind
+// ErrorKindNoDefaultServices.
+func IsNoDefaultServices(err error) bool { return errorKind(err) == ErrorKindNoDefaultServices }
+
+// IsNotFound reports whether err is a daemon error of kind
+// ErrorKindNotFound.
+func IsNotFound(err error) bool { return errorKind(err) == ErrorKindNotFound }
+
+// IsPermissionDenied reports whether err is a daemon error of kind
+// ErrorKindPermissionDenied.
+func IsPermissionDenied(err error) bool { return errorKind(err) == ErrorKindPermissionDenied }
+
+// IsGenericFileError reports whether err is a daemon error of kind
+// ErrorKindGenericFileError.
+func IsGenericFileError(err error) bool { return errorKind(err) == ErrorKindGenericFileError }
+
+// IsRateLimited reports whether err is a daemon error of kind
+// ErrorKindRateLimited.
+func IsRateLimited(err error) bool { return errorKind(err) == ErrorKindRateLimited }
+
+// IsReadOnly reports whether err is a daemon error of kind
+// ErrorKindReadOnly.
+func IsReadOnly(err error) bool { return errorKind(err) == ErrorKindReadOnly }
+
+// IsTooManyExecs reports whether err is a daemon error of kind
+// ErrorKindTooManyExecs.
+func IsTooManyExecs(err error) bool { return errorKind(err) == ErrorKindTooManyExecs }
+
 func (rsp *response) err(cli *Client) error {
 	if cli != nil {
 		maintErr := rsp.Maintenance
@@ -427,19 +628,62 @@ func parseError(r *http.Response) error {
 type SysInfo struct {
 	Version string `json:"version,omitempty"`
 	BootID  string `json:"boot-id,omitempty"`
+
+	// Features lists the optional API features the daemon supports. It is
+	// empty for daemons older than this field.
+	Features []string `json:"features,omitempty"`
 }
 
 // SysInfo gets system information from the remote API.
 func (client *Client) SysInfo() (*SysInfo, error) {
+	return client.SysInfoContext(context.Background())
+}
+
+// SysInfoContext is like SysInfo, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) SysInfoContext(ctx context.Context) (*SysInfo, error) {
 	var sysInfo SysInfo
 
-	if _, err := client.doSync("GET", "/v1/system-info", nil, nil, nil, &sysInfo); err != nil {
-		return nil, fmt.Errorf("cannot obtain system details: %v", err)
+	if _, err := client.doSync(ctx, "GET", "/v1/system-info", nil, nil, nil, &sysInfo); err != nil {
+		return nil, fmt.Errorf("cannot obtain system details: %w", err)
 	}
 
 	return &sysInfo, nil
 }
 
+// featureError returns a clearer error than err if the daemon doesn't
+// support the given API feature, for example because it's older than the
+// client. Otherwise (or if that can't be determined), err is returned.
+func (client *Client) featureError(ctx context.Context, err error, feature string) error {
+	if err == nil {
+		return nil
+	}
+	if featureErr := client.requireFeature(ctx, feature); featureErr != nil {
+		return featureErr
+	}
+	return err
+}
+
+// requireFeature returns an error if the daemon doesn't support the given
+// API feature. It's for requests that an older daemon would misinterpret
+// rather than reject; if support can't be determined, nil is returned.
+func (client *Client) requireFeature(ctx context.Context, feature string) error {
+	sysInfo, err := client.SysInfoContext(ctx)
+	if err != nil {
+		return nil
+	}
+	for _, f := range sysInfo.Features {
+		if f == feature {
+			return nil
+		}
+	}
+	version := sysInfo.Version
+	if version == "" {
+		version = "unknown"
+	}
+	return fmt.Errorf("daemon (version %s) does not support %q; it may need to be updated", version, feature)
+}
+
 type debugAction struct {
 	Action string      `json:"action"`
 	Params interface{} `json:"params,omitempty"`
@@ -447,6 +691,12 @@ type debugAction struct {
 
 // DebugPost sends a POST debug action to the server with the provided parameters.
 func (client *Client) DebugPost(action string, params interface{}, result interface{}) error {
+	return client.DebugPostContext(context.Background(), action, params, result)
+}
+
+// DebugPostContext is like DebugPost, but uses ctx for the API requests so
+// that they can be cancelled.
+func (client *Client) DebugPostContext(ctx context.Context, action string, params interface{}, result interface{}) error {
 	body, err := json.Marshal(debugAction{
 		Action: action,
 		Params: params,
@@ -455,16 +705,88 @@ func (client *Client) DebugPost(action string, params interface{}, result interf
 		return err
 	}
 
-	_, err = client.doSync("POST", "/v1/debug", nil, nil, bytes.NewReader(body), result)
-	return err
+	_, err = client.doSync(ctx, "POST", "/v1/debug", nil, nil, bytes.NewReader(body), result)
+	return client.featureError(ctx, err, "debug-"+action)
 }
 
 // DebugGet sends a GET debug action to the server with the provided parameters.
 func (client *Client) DebugGet(action string, result interface{}, params map[string]string) error {
+	return client.DebugGetContext(context.Background(), action, result, params)
+}
+
+// DebugGetContext is like DebugGet, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) DebugGetContext(ctx context.Context, action string, result interface{}, params map[string]string) error {
 	urlParams := url.Values{"action": []string{action}}
 	for k, v := range params {
 		urlParams.Set(k, v)
 	}
-	_, err := client.doSync("GET", "/v1/debug", urlParams, nil, nil, &result)
+	_, err := client.doSync(ctx, "GET", "/v1/debug", urlParams, nil, nil, &result)
 	return err
 }
+
+// DebugRequestOptions holds the options for a call to DebugRequest.
+type DebugRequestOptions struct {
+	// Method is the HTTP method of the request, such as "GET" or "POST".
+	Method string
+
+	// Path is the API path, such as "/v1/services".
+	Path string
+
+	// Query holds the query parameters of the request, if any.
+	Query url.Values
+
+	// Headers holds additional request headers, if any.
+	Headers map[string]string
+
+	// Body is the request body, or nil for none.
+	Body io.Reader
+}
+
+// DebugRequest sends an arbitrary request to the API and returns the raw
+// response, without checking its status or decoding it. It is meant for
+// diagnosing API behaviour. The caller must close the response body.
+func (client *Client) DebugRequest(opts *DebugRequestOptions) (*http.Response, error) {
+	return client.DebugRequestContext(context.Background(), opts)
+}
+
+// DebugRequestContext is like DebugRequest, but uses ctx for the API request
+// so that it can be cancelled.
+func (client *Client) DebugRequestContext(ctx context.Context, opts *DebugRequestOptions) (*http.Response, error) {
+	return client.raw(ctx, opts.Method, opts.Path, opts.Query, opts.Headers, opts.Body)
+}
+
+// PprofOptions holds the options for a call to Pprof.
+type PprofOptions struct {
+	// Profile is the name of the profile, such as "heap", "goroutine",
+	// "profile" (for a CPU profile) or "trace".
+	Profile string
+
+	// Seconds is how long to collect a CPU profile or trace for. Zero means
+	// the daemon's default.
+	Seconds int
+}
+
+// Pprof fetches a runtime profile from the daemon, which must have been
+// started with profiling enabled. The caller must close the returned reader.
+func (client *Client) Pprof(opts *PprofOptions) (io.ReadCloser, error) {
+	return client.PprofContext(context.Background(), opts)
+}
+
+// PprofContext is like Pprof, but uses ctx for the API request so that it
+// can be cancelled.
+func (client *Client) PprofContext(ctx context.Context, opts *PprofOptions) (io.ReadCloser, error) {
+	query := url.Values{}
+	if opts.Seconds > 0 {
+		query.Set("seconds", strconv.Itoa(opts.Seconds))
+	}
+	rsp, err := client.raw(ctx, "GET", "/v1/debug/pprof/"+opts.Profile, query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rsp.StatusCode != http.StatusOK {
+		defer rsp.Body.Close()
+		return nil, client.featureError(ctx, parseError(rsp), "debug-pprof")
+	}
+	return rsp.Body, nil
+}
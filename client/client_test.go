@@ -15,8 +15,12 @@
 package client_test
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -24,6 +28,7 @@ import (
 	"net/url"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -99,14 +104,57 @@ func (cs *clientSuite) TestNewBaseURLError(c *C) {
 }
 
 func (cs *clientSuite) TestClientDoReportsErrors(c *C) {
-	cs.err = errors.New("ouchie")
+	cs.err = fmt.Errorf("ouchie: %w", syscall.ECONNREFUSED)
 	err := cs.cli.Do("GET", "/", nil, nil, nil)
-	c.Check(err, ErrorMatches, "cannot communicate with server: ouchie")
+	c.Check(err, ErrorMatches, "cannot communicate with server: ouchie: connection refused")
 	if cs.doCalls < 2 {
 		c.Fatalf("do did not retry")
 	}
 }
 
+func (cs *clientSuite) TestClientDoNoRetry(c *C) {
+	// Errors that won't go away by themselves aren't retried.
+	cs.err = errors.New("ouchie")
+	err := cs.cli.Do("GET", "/", nil, nil, nil)
+	c.Check(err, ErrorMatches, "cannot communicate with server: ouchie")
+	c.Check(cs.doCalls, Equals, 1)
+
+	// Nor are requests other than GET, which may not be idempotent.
+	cs.doCalls = 0
+	cs.err = io.EOF
+	err = cs.cli.Do("POST", "/", nil, nil, nil)
+	c.Check(err, ErrorMatches, "cannot communicate with server: EOF")
+	c.Check(cs.doCalls, Equals, 1)
+}
+
+func (cs *clientSuite) TestClientRetryConfig(c *C) {
+	cli, err := client.New(&client.Config{
+		RetryTimeout:  50 * time.Millisecond,
+		RetryDelay:    time.Millisecond,
+		RetryMaxDelay: 4 * time.Millisecond,
+	})
+	c.Assert(err, IsNil)
+	cli.SetDoer(cs)
+	cs.err = io.ErrUnexpectedEOF
+
+	start := time.Now()
+	err = cli.Do("GET", "/", nil, nil, nil)
+	c.Check(err, ErrorMatches, "cannot communicate with server: unexpected EOF")
+	c.Check(time.Since(start) < time.Second, Equals, true)
+	// The delay grows from 1ms to at most 4ms (with jitter), so there are
+	// far fewer retries than 50ms/1ms.
+	c.Check(cs.doCalls > 2, Equals, true, Commentf("%d calls", cs.doCalls))
+	c.Check(cs.doCalls < 50, Equals, true, Commentf("%d calls", cs.doCalls))
+
+	cli, err = client.New(&client.Config{RetryTimeout: -1})
+	c.Assert(err, IsNil)
+	cli.SetDoer(cs)
+	cs.doCalls = 0
+	err = cli.Do("GET", "/", nil, nil, nil)
+	c.Check(err, ErrorMatches, "cannot communicate with server: unexpected EOF")
+	c.Check(cs.doCalls, Equals, 1)
+}
+
 func (cs *clientSuite) TestClientWorks(c *C) {
 	var v []int
 	cs.rsp = `[1,2]`
@@ -136,6 +184,13 @@ func (cs *clientSuite) TestClientSysInfo(c *C) {
 	c.Check(sysInfo, DeepEquals, &client.SysInfo{Version: "1"})
 }
 
+func (cs *clientSuite) TestClientSysInfoFeatures(c *C) {
+	cs.rsp = `{"type": "sync", "result": {"version": "1", "features": ["state"]}}`
+	sysInfo, err := cs.cli.SysInfo()
+	c.Check(err, IsNil)
+	c.Check(sysInfo, DeepEquals, &client.SysInfo{Version: "1", Features: []string{"state"}})
+}
+
 func (cs *clientSuite) TestClientIntegration(c *C) {
 	l, err := net.Listen("unix", cs.socketPath)
 	if err != nil {
@@ -163,6 +218,112 @@ func (cs *clientSuite) TestClientIntegration(c *C) {
 	c.Check(si.Version, Equals, "1")
 }
 
+func (cs *clientSuite) TestClientTLSConfig(c *C) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type":"sync", "result":{"version":"1"}}`)
+	}))
+	defer srv.Close()
+
+	// The server's certificate isn't trusted by default.
+	cli, err := client.New(&client.Config{BaseURL: srv.URL, RetryTimeout: -1})
+	c.Assert(err, IsNil)
+	_, err = cli.SysInfo()
+	c.Check(err, ErrorMatches, `.*certificate.*`)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	cli, err = client.New(&client.Config{
+		BaseURL:   srv.URL,
+		TLSConfig: &tls.Config{RootCAs: pool},
+	})
+	c.Assert(err, IsNil)
+	si, err := cli.SysInfo()
+	c.Assert(err, IsNil)
+	c.Check(si.Version, Equals, "1")
+}
+
+type testRequester struct {
+	do   func(req *http.Request) (*http.Response, error)
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+func (r *testRequester) Do(req *http.Request) (*http.Response, error) {
+	return r.do(req)
+}
+
+func (r *testRequester) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return r.dial(ctx, network, addr)
+}
+
+func (cs *clientSuite) TestClientRequester(c *C) {
+	var urls []string
+	requester := &testRequester{
+		do: func(req *http.Request) (*http.Response, error) {
+			urls = append(urls, req.URL.String())
+			return &http.Response{
+				Body:       ioutil.NopCloser(strings.NewReader(`{"type":"sync", "result":{"version":"1"}}`)),
+				StatusCode: 200,
+			}, nil
+		},
+		dial: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, fmt.Errorf("cannot dial %s", addr)
+		},
+	}
+	cli, err := client.New(&client.Config{Requester: requester})
+	c.Assert(err, IsNil)
+	c.Check(cli.Requester(), Equals, requester)
+
+	si, err := cli.SysInfo()
+	c.Assert(err, IsNil)
+	c.Check(si.Version, Equals, "1")
+	c.Check(urls, DeepEquals, []string{"http://localhost/v1/system-info"})
+
+	// Websockets are dialed with the requester too.
+	err = cli.Events(context.Background(), &client.EventsOptions{
+		HandleEvent: func(event client.Event) error { return nil },
+	})
+	c.Check(err, ErrorMatches, `cannot connect to event stream: cannot dial localhost:80`)
+
+	// BaseURL is still used to build the request URLs.
+	urls = nil
+	cli, err = client.New(&client.Config{Requester: requester, BaseURL: "http://example.com/base"})
+	c.Assert(err, IsNil)
+	_, err = cli.SysInfo()
+	c.Assert(err, IsNil)
+	c.Check(urls, DeepEquals, []string{"http://example.com/base/v1/system-info"})
+}
+
+func (cs *clientSuite) TestClientIntegrationDaemonRestart(c *C) {
+	// The socket only appears after a while, as when the daemon restarts.
+	srv := &httptest.Server{
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"type":"sync", "result":{"version":"1"}}`)
+		})},
+	}
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		l, err := net.Listen("unix", cs.socketPath)
+		c.Check(err, IsNil)
+		srv.Listener = l
+		srv.Start()
+	}()
+	defer func() {
+		if srv.Listener != nil {
+			srv.Close()
+		}
+	}()
+
+	cli, err := client.New(&client.Config{
+		Socket:       cs.socketPath,
+		RetryTimeout: 5 * time.Second,
+		RetryDelay:   5 * time.Millisecond,
+	})
+	c.Assert(err, IsNil)
+	si, err := cli.SysInfo()
+	c.Assert(err, IsNil)
+	c.Check(si.Version, Equals, "1")
+}
+
 func (cs *clientSuite) TestClientReportsOpError(c *C) {
 	cs.rsp = `{"type": "error", "status": "potatoes"}`
 	_, err := cs.cli.SysInfo()
@@ -267,6 +428,38 @@ func (cs *clientSuite) TestParseError(c *C) {
 	c.Check(err, ErrorMatches, `server error: "400 Bad Request"`)
 }
 
+func (cs *clientSuite) TestErrorKinds(c *C) {
+	predicates := map[string]func(error) bool{
+		client.ErrorKindLoginRequired:     client.IsLoginRequired,
+		client.ErrorKindSystemRestart:     client.IsSystemRestart,
+		client.ErrorKindDaemonRestart:     client.IsDaemonRestart,
+		client.ErrorKindNoDefaultServices: client.IsNoDefaultServices,
+		client.ErrorKindNotFound:          client.IsNotFound,
+		client.ErrorKindPermissionDenied:  client.IsPermissionDenied,
+		client.ErrorKindGenericFileError:  client.IsGenericFileError,
+		client.ErrorKindRateLimited:       client.IsRateLimited,
+		client.ErrorKindReadOnly:          client.IsReadOnly,
+		client.ErrorKindTooManyExecs:      client.IsTooManyExecs,
+	}
+	for kind := range predicates {
+		cs.rsp = fmt.Sprintf(`{
+			"type": "error",
+			"status-code": 400,
+			"result": {"kind": %q, "message": "oops"}
+		}`, kind)
+		_, err := cs.cli.SysInfo()
+		c.Assert(err, NotNil)
+		for otherKind, is := range predicates {
+			c.Check(is(err), Equals, otherKind == kind, Commentf("%s: %s", kind, otherKind))
+		}
+	}
+
+	for _, is := range predicates {
+		c.Check(is(nil), Equals, false)
+		c.Check(is(errors.New("not-found")), Equals, false)
+	}
+}
+
 func (cs *clientSuite) TestUserAgent(c *C) {
 	cli, err := client.New(&client.Config{UserAgent: "some-agent/9.87"})
 	c.Assert(err, IsNil)
@@ -311,3 +504,79 @@ func (cs *clientSuite) TestDebugGet(c *C) {
 	c.Check(cs.reqs[0].URL.Path, Equals, "/v1/debug")
 	c.Check(cs.reqs[0].URL.Query(), DeepEquals, url.Values{"action": []string{"do-something"}, "foo": []string{"bar"}})
 }
+
+func (cs *clientSuite) TestDebugRequest(c *C) {
+	cs.rsp = `{"type": "error", "status-code": 404, "result": {"message": "not found"}}`
+	cs.status = 404
+
+	rsp, err := cs.cli.DebugRequest(&client.DebugRequestOptions{
+		Method:  "POST",
+		Path:    "/v1/foo",
+		Query:   url.Values{"bar": []string{"baz"}},
+		Headers: map[string]string{"Content-Type": "application/json"},
+		Body:    strings.NewReader(`{"a": 1}`),
+	})
+	c.Assert(err, IsNil)
+	defer rsp.Body.Close()
+	c.Check(rsp.StatusCode, Equals, 404)
+	data, err := ioutil.ReadAll(rsp.Body)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, cs.rsp)
+
+	c.Assert(cs.reqs, HasLen, 1)
+	c.Check(cs.reqs[0].Method, Equals, "POST")
+	c.Check(cs.reqs[0].URL.Path, Equals, "/v1/foo")
+	c.Check(cs.reqs[0].URL.Query(), DeepEquals, url.Values{"bar": []string{"baz"}})
+	c.Check(cs.reqs[0].Header.Get("Content-Type"), Equals, "application/json")
+	data, err = ioutil.ReadAll(cs.reqs[0].Body)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `{"a": 1}`)
+}
+
+func (cs *clientSuite) TestPprof(c *C) {
+	cs.rsp = "profile data"
+
+	r, err := cs.cli.Pprof(&client.PprofOptions{Profile: "profile", Seconds: 5})
+	c.Assert(err, IsNil)
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "profile data")
+	c.Assert(cs.reqs, HasLen, 1)
+	c.Check(cs.reqs[0].Method, Equals, "GET")
+	c.Check(cs.reqs[0].URL.Path, Equals, "/v1/debug/pprof/profile")
+	c.Check(cs.reqs[0].URL.Query(), DeepEquals, url.Values{"seconds": []string{"5"}})
+}
+
+func (cs *clientSuite) TestPprofError(c *C) {
+	cs.rsp = `{"type": "error", "status-code": 404, "result": {"message": "pprof endpoints are not enabled"}}`
+	cs.status = 404
+	cs.header = http.Header{"Content-Type": []string{"application/json"}}
+
+	_, err := cs.cli.Pprof(&client.PprofOptions{Profile: "heap"})
+	c.Assert(err, ErrorMatches, "pprof endpoints are not enabled")
+	c.Check(cs.reqs[0].URL.Path, Equals, "/v1/debug/pprof/heap")
+}
+
+type ctxKey struct{}
+
+func (cs *clientSuite) TestClientContext(c *C) {
+	cs.rsp = `{"type": "sync", "result": {"version": "1"}}`
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	_, err := cs.cli.SysInfoContext(ctx)
+	c.Assert(err, IsNil)
+	c.Assert(cs.req, NotNil)
+	c.Check(cs.req.Context().Value(ctxKey{}), Equals, "value")
+}
+
+func (cs *clientSuite) TestClientContextCancelledStopsRetry(c *C) {
+	cs.restore()
+	cs.restore = client.FakeDoRetry(time.Millisecond, time.Hour)
+	cs.err = syscall.ECONNREFUSED
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := cs.cli.SysInfoContext(ctx)
+	c.Check(err, ErrorMatches, "cannot obtain system details: cannot communicate with server: connection refused")
+	c.Check(ctx.Err(), Equals, context.DeadlineExceeded)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Event types sent by the daemon's event stream.
+const (
+	EventChangeStatus = "change-status"
+	EventTaskStatus   = "task-status"
+	EventTaskProgress = "task-progress"
+	EventService      = "service"
+)
+
+// EventsOptions holds the options for a call to Events.
+type EventsOptions struct {
+	// HandleEvent is called for each event received (required). If it
+	// returns an error, Events stops and returns that error.
+	HandleEvent func(event Event) error
+
+	// Connected, if set, is called once the event stream is connected. Any
+	// state fetched from then on is followed by the events that update it.
+	// If it returns an error, Events stops and returns that error.
+	Connected func() error
+
+	// Types limits the events to these types (nil or empty slice means all
+	// types).
+	Types []string
+
+	// ChangeID limits the change and task events to this change.
+	ChangeID string
+
+	// Services limits the service events to these services (nil or empty
+	// slice means all services).
+	Services []string
+}
+
+// Event is a single event from the daemon's event stream. Which fields are
+// set depends on the type of event.
+type Event struct {
+	Type      string        `json:"type"`
+	Time      time.Time     `json:"time"`
+	ChangeID  string        `json:"change-id,omitempty"`
+	TaskID    string        `json:"task-id,omitempty"`
+	Kind      string        `json:"kind,omitempty"`
+	Summary   string        `json:"summary,omitempty"`
+	Status    string        `json:"status,omitempty"`
+	OldStatus string        `json:"old-status,omitempty"`
+	Err       string        `json:"err,omitempty"`
+	Progress  *TaskProgress `json:"progress,omitempty"`
+	Service   string        `json:"service,omitempty"`
+}
+
+// Events connects to the daemon's event stream and calls opts.HandleEvent
+// for each event until the context is cancelled, the handler returns an
+// error, or the daemon closes the stream.
+func (client *Client) Events(ctx context.Context, opts *EventsOptions) error {
+	query := url.Values{}
+	if len(opts.Types) > 0 {
+		query.Set("types", strings.Join(opts.Types, ","))
+	}
+	if opts.ChangeID != "" {
+		query.Set("change-id", opts.ChangeID)
+	}
+	if len(opts.Services) > 0 {
+		query.Set("services", strings.Join(opts.Services, ","))
+	}
+	u := client.baseURL
+	u.Scheme = "ws"
+	if client.baseURL.Scheme == "https" {
+		u.Scheme = "wss"
+	}
+	u.Path = path.Join(u.Path, "/v1/events")
+	u.RawQuery = query.Encode()
+	conn, err := client.getWebsocket(ctx, u.String())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("cannot connect to event stream: %w", err)
+	}
+	defer conn.Close()
+
+	// Closing the connection unblocks the reads below.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	if opts.Connected != nil {
+		err = opts.Connected()
+		if err != nil {
+			return err
+		}
+	}
+
+	for {
+		messageType, reader, err := conn.NextReader()
+		if ctx.Err() != nil {
+			return nil
+		}
+		var closeErr *websocket.CloseError
+		if errors.As(err, &closeErr) && closeErr.Code == websocket.CloseNormalClosure {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read event: %w", err)
+		}
+		if messageType == websocket.CloseMessage {
+			return nil
+		}
+		if messageType != websocket.TextMessage {
+			continue
+		}
+		var event Event
+		err = json.NewDecoder(reader).Decode(&event)
+		if err != nil {
+			return fmt.Errorf("cannot decode event: %w", err)
+		}
+		err = opts.HandleEvent(event)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/client"
+)
+
+func (cs *clientSuite) TestEvents(c *C) {
+	ws := &testWebsocket{reads: []read{
+		{websocket.TextMessage, `{"type": "change-status", "time": "2021-04-10T01:02:03Z", "change-id": "1", "kind": "start", "summary": "Start", "status": "Doing", "old-status": "Do"}`},
+		{websocket.TextMessage, `{"type": "task-progress", "time": "2021-04-10T01:02:04Z", "change-id": "1", "task-id": "2", "progress": {"label": "foo", "done": 1, "total": 2}}`},
+		{websocket.TextMessage, `{"type": "service", "time": "2021-04-10T01:02:05Z", "service": "svc1", "status": "started"}`},
+	}}
+	var url string
+	cs.cli.SetGetWebsocket(func(u string) (client.ClientWebsocket, error) {
+		url = u
+		return ws, nil
+	})
+
+	var events []client.Event
+	err := cs.cli.Events(context.Background(), &client.EventsOptions{
+		Types:    []string{client.EventChangeStatus, client.EventTaskProgress, client.EventService},
+		ChangeID: "1",
+		Services: []string{"svc1", "svc2"},
+		HandleEvent: func(event client.Event) error {
+			events = append(events, event)
+			return nil
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Check(url, Equals, "ws://localhost/v1/events?change-id=1&services=svc1%2Csvc2&types=change-status%2Ctask-progress%2Cservice")
+	c.Check(events, DeepEquals, []client.Event{{
+		Type:      client.EventChangeStatus,
+		Time:      time.Date(2021, 4, 10, 1, 2, 3, 0, time.UTC),
+		ChangeID:  "1",
+		Kind:      "start",
+		Summary:   "Start",
+		Status:    "Doing",
+		OldStatus: "Do",
+	}, {
+		Type:     client.EventTaskProgress,
+		Time:     time.Date(2021, 4, 10, 1, 2, 4, 0, time.UTC),
+		ChangeID: "1",
+		TaskID:   "2",
+		Progress: &client.TaskProgress{Label: "foo", Done: 1, Total: 2},
+	}, {
+		Type:    client.EventService,
+		Time:    time.Date(2021, 4, 10, 1, 2, 5, 0, time.UTC),
+		Service: "svc1",
+		Status:  "started",
+	}})
+}
+
+func (cs *clientSuite) TestEventsHandlerError(c *C) {
+	ws := &testWebsocket{reads: []read{
+		{websocket.TextMessage, `{"type": "service", "service": "svc1", "status": "started"}`},
+		{websocket.TextMessage, `{"type": "service", "service": "svc1", "status": "stopped"}`},
+	}}
+	cs.cli.SetGetWebsocket(func(u string) (client.ClientWebsocket, error) {
+		return ws, nil
+	})
+
+	n := 0
+	err := cs.cli.Events(context.Background(), &client.EventsOptions{
+		HandleEvent: func(event client.Event) error {
+			n++
+			return errors.New("stop!")
+		},
+	})
+	c.Assert(err, ErrorMatches, "stop!")
+	c.Check(n, Equals, 1)
+
+	err = cs.cli.Events(context.Background(), &client.EventsOptions{
+		Connected: func() error {
+			return errors.New("connected!")
+		},
+		HandleEvent: func(event client.Event) error {
+			c.Fatalf("unexpected event")
+			return nil
+		},
+	})
+	c.Assert(err, ErrorMatches, "connected!")
+}
+
+func (cs *clientSuite) TestEventsErrors(c *C) {
+	cs.cli.SetGetWebsocket(func(u string) (client.ClientWebsocket, error) {
+		return nil, errors.New("no dice")
+	})
+	err := cs.cli.Events(context.Background(), &client.EventsOptions{
+		HandleEvent: func(event client.Event) error { return nil },
+	})
+	c.Check(err, ErrorMatches, "cannot connect to event stream: no dice")
+
+	ws := &testWebsocket{reads: []read{{websocket.TextMessage, `{`}}}
+	cs.cli.SetGetWebsocket(func(u string) (client.ClientWebsocket, error) {
+		return ws, nil
+	})
+	err = cs.cli.Events(context.Background(), &client.EventsOptions{
+		HandleEvent: func(event client.Event) error { return nil },
+	})
+	c.Check(err, ErrorMatches, "cannot decode event: .*")
+}
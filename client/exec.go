@@ -16,6 +16,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -88,6 +89,51 @@ type execPayload struct {
 	SplitStderr bool              `json:"split-stderr,omitempty"`
 	Width       int               `json:"width,omitempty"`
 	Height      int               `json:"height,omitempty"`
+	Detach      bool              `json:"detach,omitempty"`
+}
+
+// ExecDetached starts a command in the background with the given options,
+// and returns the ID of its change without waiting for it to finish. The
+// command gets no input, and the end of its combined output is logged to
+// the change's task, which fails if the command exits with a non-zero code.
+// The Terminal, Interactive, Width, Height, Stdin, Stdout and Stderr options
+// are not used.
+func (client *Client) ExecDetached(opts *ExecOptions) (changeID string, err error) {
+	return client.ExecDetachedContext(context.Background(), opts)
+}
+
+// ExecDetachedContext is like ExecDetached, but uses ctx for the request that
+// starts the command.
+func (client *Client) ExecDetachedContext(ctx context.Context, opts *ExecOptions) (changeID string, err error) {
+	var timeoutStr string
+	if opts.Timeout != 0 {
+		timeoutStr = opts.Timeout.String()
+	}
+	payload := execPayload{
+		Command:     opts.Command,
+		Environment: opts.Environment,
+		WorkingDir:  opts.WorkingDir,
+		Timeout:     timeoutStr,
+		UserID:      opts.UserID,
+		User:        opts.User,
+		GroupID:     opts.GroupID,
+		Group:       opts.Group,
+		Detach:      true,
+	}
+	var body bytes.Buffer
+	err = json.NewEncoder(&body).Encode(&payload)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode JSON payload: %v", err)
+	}
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	// An older daemon would ignore "detach" and wait for websockets that
+	// never connect, so check for support first.
+	if err := client.requireFeature(ctx, "exec-detach"); err != nil {
+		return "", err
+	}
+	return client.doAsync(ctx, "POST", "/v1/exec", nil, headers, &body)
 }
 
 type execResult struct {
@@ -107,6 +153,13 @@ type ExecProcess struct {
 // Exec starts a command with the given options, returning a value
 // representing the process.
 func (client *Client) Exec(opts *ExecOptions) (*ExecProcess, error) {
+	return client.ExecContext(context.Background(), opts)
+}
+
+// ExecContext is like Exec, but uses ctx for the requests that start the
+// command. Use ExecProcess.WaitContext to be able to cancel waiting for it to
+// finish.
+func (client *Client) ExecContext(ctx context.Context, opts *ExecOptions) (*ExecProcess, error) {
 	// Set up stdin/stdout defaults.
 	stdin := opts.Stdin
 	if stdin == nil {
@@ -145,7 +198,7 @@ func (client *Client) Exec(opts *ExecOptions) (*ExecProcess, error) {
 	headers := map[string]string{
 		"Content-Type": "application/json",
 	}
-	resultBytes, changeID, err := client.doAsyncFull("POST", "/v1/exec", nil, headers, &body)
+	resultBytes, changeID, err := client.doAsyncFull(ctx, "POST", "/v1/exec", nil, headers, &body)
 	if err != nil {
 		return nil, err
 	}
@@ -157,13 +210,13 @@ func (client *Client) Exec(opts *ExecOptions) (*ExecProcess, error) {
 
 	// Connect to the "control" websocket.
 	taskID := result.TaskID
-	controlConn, err := client.getTaskWebsocket(taskID, "control")
+	controlConn, err := client.getTaskWebsocket(ctx, taskID, "control")
 	if err != nil {
 		return nil, fmt.Errorf(`cannot connect to "control" websocket: %v`, err)
 	}
 
 	// Forward stdin and stdout.
-	ioConn, err := client.getTaskWebsocket(taskID, "stdio")
+	ioConn, err := client.getTaskWebsocket(ctx, taskID, "stdio")
 	if err != nil {
 		return nil, fmt.Errorf(`cannot connect to "stdio" websocket: %v`, err)
 	}
@@ -174,7 +227,7 @@ func (client *Client) Exec(opts *ExecOptions) (*ExecProcess, error) {
 	var stderrConn clientWebsocket
 	var stderrDone chan bool
 	if opts.Stderr != nil {
-		stderrConn, err = client.getTaskWebsocket(taskID, "stderr")
+		stderrConn, err = client.getTaskWebsocket(ctx, taskID, "stderr")
 		if err != nil {
 			return nil, fmt.Errorf(`cannot connect to "stderr" websocket: %v`, err)
 		}
@@ -218,13 +271,19 @@ func (client *Client) Exec(opts *ExecOptions) (*ExecProcess, error) {
 // the process runs successfully and returns a zero exit code. If the command
 // fails with a nonzero exit code, the error is of type *ExitError.
 func (p *ExecProcess) Wait() error {
+	return p.WaitContext(context.Background())
+}
+
+// WaitContext is like Wait, but stops waiting and returns an error when ctx
+// is cancelled. The command itself keeps running.
+func (p *ExecProcess) WaitContext(ctx context.Context) error {
 	// Wait till the command (change) is finished.
 	waitOpts := &WaitChangeOptions{}
 	if p.timeout != 0 {
 		// A little more than the command timeout to ensure that happens first
 		waitOpts.Timeout = p.timeout + time.Second
 	}
-	change, err := p.client.WaitChange(p.changeID, waitOpts)
+	change, err := p.client.WaitChangeContext(ctx, p.changeID, waitOpts)
 	if err != nil {
 		return fmt.Errorf("cannot wait for command to finish: %v", err)
 	}
@@ -233,7 +292,11 @@ func (p *ExecProcess) Wait() error {
 	}
 
 	// Wait for any remaining I/O to be flushed to stdout/stderr.
-	<-p.writesDone
+	select {
+	case <-p.writesDone:
+	case <-ctx.Done():
+		return fmt.Errorf("cannot wait for command output: %w", ctx.Err())
+	}
 
 	var exitCode int
 	if len(change.Tasks) == 0 {
@@ -15,31 +15,39 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 )
 
 var ParseErrorInTest = parseError
 
+type doer interface {
+	Do(*http.Request) (*http.Response, error)
+}
+
 func (client *Client) SetDoer(d doer) {
-	client.doer = d
+	client.Hijack(d.Do)
 }
 
 func (client *Client) Do(method, path string, query url.Values, body io.Reader, v interface{}) error {
-	return client.do(method, path, query, nil, body, v)
+	return client.do(context.Background(), method, path, query, nil, body, v)
 }
 
 func (client *Client) FakeAsyncRequest() (changeId string, err error) {
-	changeId, err = client.doAsync("GET", "/v1/async-test", nil, nil, nil)
+	changeId, err = client.doAsync(context.Background(), "GET", "/v1/async-test", nil, nil, nil)
 	if err != nil {
 		return "", fmt.Errorf("cannot do async test: %v", err)
 	}
 	return changeId, nil
 }
 
-func (client *Client) SetGetWebsocket(f getWebsocketFunc) {
-	client.getWebsocket = f
+func (client *Client) SetGetWebsocket(f func(url string) (clientWebsocket, error)) {
+	client.getWebsocket = func(_ context.Context, url string) (clientWebsocket, error) {
+		return f(url)
+	}
 }
 
 // WaitStdinDone waits for WebsocketSendStream to be finished calling
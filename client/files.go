@@ -0,0 +1,491 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// PushOptions are the options for a Push call.
+type PushOptions struct {
+	// Source is the source of data to write (required).
+	Source io.Reader
+
+	// Path indicates the absolute path of the file in the destination
+	// machine (required).
+	Path string
+
+	// MakeDirs, if true, will create any non-existing directories in the path
+	// to the remote file. If false (the default) the call to Push will fail
+	// if any non-existing directory is found on the remote path.
+	MakeDirs bool
+
+	// Permissions indicates the mode of the file on the destination machine.
+	// If zero, 0644 is used.
+	Permissions os.FileMode
+
+	// UserID indicates the user ID of the owner for the file on the
+	// destination machine. When used, GroupID must also be specified.
+	UserID *int
+
+	// User indicates the user name of the owner for the file on the
+	// destination machine. When used, its value must match UserID if both
+	// are specified.
+	User string
+
+	// GroupID indicates the ID of the owner group for the file on the
+	// destination machine. When used, UserID must also be specified.
+	GroupID *int
+
+	// Group indicates the name of the owner group for the file on the
+	// destination machine. When used, its value must match GroupID if both
+	// are specified.
+	Group string
+}
+
+type writeFilesPayload struct {
+	Action string           `json:"action"`
+	Files  []writeFilesItem `json:"files"`
+}
+
+type writeFilesItem struct {
+	Path        string `json:"path"`
+	MakeDirs    bool   `json:"make-dirs,omitempty"`
+	Permissions string `json:"permissions,omitempty"`
+	UserID      *int   `json:"user-id,omitempty"`
+	User        string `json:"user,omitempty"`
+	GroupID     *int   `json:"group-id,omitempty"`
+	Group       string `json:"group,omitempty"`
+}
+
+type fileResult struct {
+	Path  string `json:"path"`
+	Error *Error `json:"error,omitempty"`
+}
+
+// Push writes content to a path on the remote system.
+func (client *Client) Push(opts *PushOptions) error {
+	return client.PushContext(context.Background(), opts)
+}
+
+// PushContext is like Push, but uses ctx for the API request so that it can
+// be cancelled.
+func (client *Client) PushContext(ctx context.Context, opts *PushOptions) error {
+	var permissions string
+	if opts.Permissions != 0 {
+		permissions = fmt.Sprintf("%03o", opts.Permissions.Perm())
+	}
+	payload := writeFilesPayload{
+		Action: "write",
+		Files: []writeFilesItem{{
+			Path:        opts.Path,
+			MakeDirs:    opts.MakeDirs,
+			Permissions: permissions,
+			UserID:      opts.UserID,
+			User:        opts.User,
+			GroupID:     opts.GroupID,
+			Group:       opts.Group,
+		}},
+	}
+
+	// Stream the multipart body so that large files aren't held in memory.
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writePushBody(mw, &payload, opts))
+	}()
+
+	headers := map[string]string{
+		"Content-Type": mw.FormDataContentType(),
+	}
+	var result []fileResult
+	_, err := client.doSync(ctx, "POST", "/v1/files", nil, headers, pr, &result)
+	if err != nil {
+		return err
+	}
+	if len(result) != 1 {
+		return fmt.Errorf("expected exactly one result from API, got %d", len(result))
+	}
+	if result[0].Error != nil {
+		return result[0].Error
+	}
+	return nil
+}
+
+func writePushBody(mw *multipart.Writer, payload *writeFilesPayload, opts *PushOptions) error {
+	part, err := mw.CreateFormField("request")
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(part).Encode(payload); err != nil {
+		return fmt.Errorf("cannot encode JSON payload: %v", err)
+	}
+	part, err = mw.CreateFormFile("files", opts.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, opts.Source); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// ListFilesOptions are the options for a ListFiles call.
+type ListFilesOptions struct {
+	// Path is the absolute path of the file or directory to list (required).
+	Path string
+
+	// Glob, if true, expands the wildcards of path.Match in any component of
+	// Path, and lists each match. Otherwise Path is taken literally.
+	Glob bool
+
+	// Pattern optionally filters the listed entries by name, using the
+	// wildcards of path.Match.
+	Pattern string
+
+	// Itself, if true, lists a directory itself rather than its contents.
+	Itself bool
+
+	// NoFollow, if true, reports a symlink given as Path as such, rather than
+	// following it. Entries that are symlinks are never followed.
+	NoFollow bool
+}
+
+// FileInfo holds information about a file or directory on the remote system.
+type FileInfo struct {
+	// Path is the absolute path of the entry.
+	Path string
+
+	// Name is the base name of the entry.
+	Name string
+
+	// Type is the type of the entry: "file", "directory", "symlink",
+	// "socket", "named-pipe", "device", or "unknown".
+	Type string
+
+	// Size is the size of a regular file in bytes, and zero otherwise.
+	Size int64
+
+	// LinkTarget is the target of a symlink, and empty otherwise.
+	LinkTarget string
+
+	// Permissions are the entry's permission bits.
+	Permissions os.FileMode
+
+	// LastModified is the time the entry was last modified.
+	LastModified time.Time
+
+	// UserID and GroupID are the IDs of the owner, and User and Group their
+	// names (if they could be looked up).
+	UserID  *int
+	User    string
+	GroupID *int
+	Group   string
+}
+
+type fileInfoResult struct {
+	Path         string    `json:"path"`
+	Name         string    `json:"name"`
+	Type         string    `json:"type"`
+	Size         int64     `json:"size"`
+	LinkTarget   string    `json:"link-target"`
+	Permissions  string    `json:"permissions"`
+	LastModified time.Time `json:"last-modified"`
+	UserID       *int      `json:"user-id"`
+	User         string    `json:"user"`
+	GroupID      *int      `json:"group-id"`
+	Group        string    `json:"group"`
+}
+
+// ListFiles lists the files at the given path on the remote system.
+func (client *Client) ListFiles(opts *ListFilesOptions) ([]*FileInfo, error) {
+	return client.ListFilesContext(context.Background(), opts)
+}
+
+// ListFilesContext is like ListFiles, but uses ctx for the API request so
+// that it can be cancelled.
+func (client *Client) ListFilesContext(ctx context.Context, opts *ListFilesOptions) ([]*FileInfo, error) {
+	query := url.Values{
+		"action": []string{"list"},
+		"path":   []string{opts.Path},
+	}
+	if opts.Pattern != "" {
+		query.Set("pattern", opts.Pattern)
+	}
+	if opts.Itself {
+		query.Set("itself", "true")
+	}
+	if opts.Glob {
+		query.Set("glob", "true")
+	}
+	if opts.NoFollow {
+		query.Set("follow", "false")
+	}
+
+	var results []fileInfoResult
+	_, err := client.doSync(ctx, "GET", "/v1/files", query, nil, nil, &results)
+	if err != nil {
+		if opts.Glob {
+			return nil, client.featureError(ctx, err, "files-glob")
+		}
+		return nil, err
+	}
+
+	infos := make([]*FileInfo, len(results))
+	for i, result := range results {
+		perm, err := strconv.ParseUint(result.Permissions, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid permissions %q for %q", result.Permissions, result.Path)
+		}
+		infos[i] = &FileInfo{
+			Path:         result.Path,
+			Name:         result.Name,
+			Type:         result.Type,
+			Size:         result.Size,
+			LinkTarget:   result.LinkTarget,
+			Permissions:  os.FileMode(perm),
+			LastModified: result.LastModified,
+			UserID:       result.UserID,
+			User:         result.User,
+			GroupID:      result.GroupID,
+			Group:        result.Group,
+		}
+	}
+	return infos, nil
+}
+
+// ChecksumFilesOptions are the options for a ChecksumFiles call.
+type ChecksumFilesOptions struct {
+	// Paths are the absolute paths of the regular files to checksum
+	// (required). Symlinks are followed.
+	Paths []string
+}
+
+// FileChecksum holds the checksum of a file on the remote system.
+type FileChecksum struct {
+	// Path is the path of the file, as given in ChecksumFilesOptions.
+	Path string
+
+	// SHA256 is the hex-encoded SHA256 checksum of the file's content.
+	SHA256 string
+
+	// Size is the size of the file in bytes.
+	Size int64
+
+	// LastModified is the time the file was last modified.
+	LastModified time.Time
+
+	// LinkTarget is the target of the path if it's a symlink.
+	LinkTarget string
+
+	// Error is set if the file couldn't be checksummed, in which case the
+	// other fields are empty.
+	Error error
+}
+
+type checksumResult struct {
+	Path         string    `json:"path"`
+	SHA256       string    `json:"sha256"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last-modified"`
+	LinkTarget   string    `json:"link-target"`
+	Error        *Error    `json:"error"`
+}
+
+// ChecksumFiles returns the SHA256 checksum, size and modification time of
+// files on the remote system, for example to skip transferring a file whose
+// content is unchanged. An error for an individual file is returned in its
+// FileChecksum.
+func (client *Client) ChecksumFiles(opts *ChecksumFilesOptions) ([]*FileChecksum, error) {
+	return client.ChecksumFilesContext(context.Background(), opts)
+}
+
+// ChecksumFilesContext is like ChecksumFiles, but uses ctx for the API request
+// so that it can be cancelled.
+func (client *Client) ChecksumFilesContext(ctx context.Context, opts *ChecksumFilesOptions) ([]*FileChecksum, error) {
+	query := url.Values{
+		"action": []string{"checksum"},
+		"path":   opts.Paths,
+	}
+	var results []checksumResult
+	_, err := client.doSync(ctx, "GET", "/v1/files", query, nil, nil, &results)
+	if err != nil {
+		return nil, client.featureError(ctx, err, "files-checksum")
+	}
+	checksums := make([]*FileChecksum, len(results))
+	for i, result := range results {
+		checksums[i] = &FileChecksum{
+			Path:         result.Path,
+			SHA256:       result.SHA256,
+			Size:         result.Size,
+			LastModified: result.LastModified,
+			LinkTarget:   result.LinkTarget,
+		}
+		if result.Error != nil {
+			checksums[i].Error = result.Error
+		}
+	}
+	return checksums, nil
+}
+
+// PullOptions are the options for a Pull call.
+type PullOptions struct {
+	// Path is the absolute path of the file on the remote system (required).
+	// Symlinks are followed.
+	Path string
+
+	// Target is the destination io.Writer that will receive the data
+	// (required).
+	Target io.Writer
+}
+
+// Pull retrieves a file from the remote system.
+func (client *Client) Pull(opts *PullOptions) error {
+	return client.PullContext(context.Background(), opts)
+}
+
+// PullContext is like Pull, but uses ctx for the API request so that it can
+// be cancelled.
+func (client *Client) PullContext(ctx context.Context, opts *PullOptions) error {
+	query := url.Values{
+		"action": []string{"read"},
+		"path":   []string{opts.Path},
+	}
+	headers := map[string]string{
+		"Accept": "multipart/form-data",
+	}
+	rsp, err := client.raw(ctx, "GET", "/v1/files", query, headers, nil)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return parseError(rsp)
+	}
+
+	contentType := rsp.Header.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "multipart/form-data" {
+		return fmt.Errorf("invalid Content-Type %q", contentType)
+	}
+	// The file's content comes first (unless it can't be read), then the
+	// response metadata with any error.
+	mr := multipart.NewReader(rsp.Body, params["boundary"])
+	part, err := mr.NextPart()
+	if err != nil {
+		return fmt.Errorf("cannot read response: %w", err)
+	}
+	if part.FormName() == "files" {
+		if _, err := io.Copy(opts.Target, part); err != nil {
+			return err
+		}
+		part, err = mr.NextPart()
+		if err != nil {
+			return fmt.Errorf("cannot read response metadata: %w", err)
+		}
+	}
+	if part.FormName() != "response" {
+		return fmt.Errorf(`expected "response" field, got %q`, part.FormName())
+	}
+	var r response
+	if err := decodeInto(part, &r); err != nil {
+		return err
+	}
+	if err := r.err(client); err != nil {
+		return err
+	}
+	var results []fileResult
+	if err := json.Unmarshal(r.Result, &results); err != nil {
+		return fmt.Errorf("cannot unmarshal: %v", err)
+	}
+	if len(results) != 1 {
+		return fmt.Errorf("expected exactly one result from API, got %d", len(results))
+	}
+	if results[0].Error != nil {
+		return results[0].Error
+	}
+	return nil
+}
+
+// archiveErrorTrailer is the HTTP trailer in which the daemon reports an
+// error that happened while streaming an archive.
+const archiveErrorTrailer = "Pebble-Archive-Error"
+
+// PullArchiveOptions are the options for a PullArchive call.
+type PullArchiveOptions struct {
+	// Path is the absolute path of the directory (or file) on the remote
+	// system to archive (required).
+	Path string
+
+	// Gzip, if true, compresses the archive with gzip.
+	Gzip bool
+
+	// NoFollow, if true, archives a symlink given as Path as such, rather
+	// than following it. Symlinks within the directory are never followed.
+	NoFollow bool
+
+	// Target is the destination io.Writer that will receive the archive
+	// (required).
+	Target io.Writer
+}
+
+// PullArchive retrieves a directory tree from the remote system as a tar
+// archive, streamed in a single response. Entries are named relative to
+// the parent of Path, so the archive extracts to a directory of the same
+// name.
+func (client *Client) PullArchive(opts *PullArchiveOptions) error {
+	return client.PullArchiveContext(context.Background(), opts)
+}
+
+// PullArchiveContext is like PullArchive, but uses ctx for the API request so
+// that it can be cancelled.
+func (client *Client) PullArchiveContext(ctx context.Context, opts *PullArchiveOptions) error {
+	query := url.Values{
+		"action": []string{"archive"},
+		"path":   []string{opts.Path},
+	}
+	if opts.Gzip {
+		query.Set("compression", "gzip")
+	}
+	if opts.NoFollow {
+		query.Set("follow", "false")
+	}
+	rsp, err := client.raw(ctx, "GET", "/v1/files", query, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return client.featureError(ctx, parseError(rsp), "files-archive")
+	}
+	if _, err := io.Copy(opts.Target, rsp.Body); err != nil {
+		return err
+	}
+	// The trailer is only available once the body has been read.
+	if msg := rsp.Trailer.Get(archiveErrorTrailer); msg != "" {
+		return fmt.Errorf("archive is incomplete: %s", msg)
+	}
+	return nil
+}
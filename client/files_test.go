@@ -0,0 +1,418 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/client"
+)
+
+type pushRequest struct {
+	metadata map[string]interface{}
+	path     string
+	content  string
+}
+
+func (cs *clientSuite) readPushRequest(c *C) pushRequest {
+	c.Assert(cs.req, NotNil)
+	c.Check(cs.req.Method, Equals, "POST")
+	c.Check(cs.req.URL.Path, Equals, "/v1/files")
+	mediaType, params, err := mime.ParseMediaType(cs.req.Header.Get("Content-Type"))
+	c.Assert(err, IsNil)
+	c.Check(mediaType, Equals, "multipart/form-data")
+
+	mr := multipart.NewReader(cs.req.Body, params["boundary"])
+	part, err := mr.NextPart()
+	c.Assert(err, IsNil)
+	c.Check(part.FormName(), Equals, "request")
+	var req pushRequest
+	err = json.NewDecoder(part).Decode(&req.metadata)
+	c.Assert(err, IsNil)
+
+	part, err = mr.NextPart()
+	c.Assert(err, IsNil)
+	c.Check(part.FormName(), Equals, "files")
+	_, params, err = mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	c.Assert(err, IsNil)
+	req.path = params["filename"]
+	data, err := ioutil.ReadAll(part)
+	c.Assert(err, IsNil)
+	req.content = string(data)
+	return req
+}
+
+func (cs *clientSuite) TestPush(c *C) {
+	cs.rsp = `{"type": "sync", "result": [{"path": "/tmp/file.txt"}]}`
+
+	err := cs.cli.Push(&client.PushOptions{
+		Source: bytes.NewBufferString("Hello, world!"),
+		Path:   "/tmp/file.txt",
+	})
+	c.Assert(err, IsNil)
+
+	req := cs.readPushRequest(c)
+	c.Check(req.metadata, DeepEquals, map[string]interface{}{
+		"action": "write",
+		"files": []interface{}{
+			map[string]interface{}{"path": "/tmp/file.txt"},
+		},
+	})
+	c.Check(req.path, Equals, "/tmp/file.txt")
+	c.Check(req.content, Equals, "Hello, world!")
+}
+
+func (cs *clientSuite) TestPushOptions(c *C) {
+	cs.rsp = `{"type": "sync", "result": [{"path": "/etc/app/app.conf"}]}`
+
+	uid, gid := 1000, 1001
+	err := cs.cli.Push(&client.PushOptions{
+		Source:      bytes.NewBufferString("key: value\n"),
+		Path:        "/etc/app/app.conf",
+		MakeDirs:    true,
+		Permissions: os.FileMode(0o600),
+		UserID:      &uid,
+		User:        "app",
+		GroupID:     &gid,
+		Group:       "staff",
+	})
+	c.Assert(err, IsNil)
+
+	req := cs.readPushRequest(c)
+	c.Check(req.metadata, DeepEquals, map[string]interface{}{
+		"action": "write",
+		"files": []interface{}{
+			map[string]interface{}{
+				"path":        "/etc/app/app.conf",
+				"make-dirs":   true,
+				"permissions": "600",
+				"user-id":     1000.0,
+				"user":        "app",
+				"group-id":    1001.0,
+				"group":       "staff",
+			},
+		},
+	})
+	c.Check(req.content, Equals, "key: value\n")
+}
+
+func (cs *clientSuite) TestPushFileError(c *C) {
+	cs.rsp = `{"type": "sync", "result": [{
+		"path": "/etc/app/app.conf",
+		"error": {"kind": "permission-denied", "message": "open /etc/app/app.conf: permission denied"}
+	}]}`
+
+	err := cs.cli.Push(&client.PushOptions{
+		Source: bytes.NewBufferString("x"),
+		Path:   "/etc/app/app.conf",
+	})
+	c.Assert(err, ErrorMatches, "open /etc/app/app.conf: permission denied")
+	clientErr, ok := err.(*client.Error)
+	c.Assert(ok, Equals, true)
+	c.Check(clientErr.Kind, Equals, "permission-denied")
+	cs.readPushRequest(c)
+}
+
+func (cs *clientSuite) TestPushAPIError(c *C) {
+	cs.status = 400
+	cs.rsp = `{"type": "error", "result": {"message": "must specify user, not just group"}}`
+
+	err := cs.cli.Push(&client.PushOptions{
+		Source: bytes.NewBufferString("x"),
+		Path:   "/tmp/file.txt",
+	})
+	c.Assert(err, ErrorMatches, "must specify user, not just group")
+	cs.readPushRequest(c)
+}
+
+func (cs *clientSuite) TestListFiles(c *C) {
+	cs.rsp = `{"type": "sync", "result": [{
+		"path": "/var/log/app.log",
+		"name": "app.log",
+		"type": "file",
+		"size": 1234,
+		"permissions": "640",
+		"last-modified": "2021-04-10T12:05:06Z",
+		"user-id": 1000,
+		"user": "app",
+		"group-id": 1001,
+		"group": "adm"
+	}, {
+		"path": "/var/log/current.log",
+		"name": "current.log",
+		"type": "symlink",
+		"link-target": "app.log",
+		"permissions": "777",
+		"last-modified": "2021-04-10T12:05:07Z",
+		"user-id": 0,
+		"user": "root",
+		"group-id": 0,
+		"group": "root"
+	}]}`
+
+	infos, err := cs.cli.ListFiles(&client.ListFilesOptions{
+		Path:     "/var/log/*.log",
+		Glob:     true,
+		Pattern:  "*",
+		Itself:   true,
+		NoFollow: true,
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(cs.req.Method, Equals, "GET")
+	c.Check(cs.req.URL.Path, Equals, "/v1/files")
+	c.Check(cs.req.URL.Query(), DeepEquals, url.Values{
+		"action":  {"list"},
+		"path":    {"/var/log/*.log"},
+		"pattern": {"*"},
+		"itself":  {"true"},
+		"glob":    {"true"},
+		"follow":  {"false"},
+	})
+
+	uid, gid, root := 1000, 1001, 0
+	c.Check(infos, DeepEquals, []*client.FileInfo{{
+		Path:         "/var/log/app.log",
+		Name:         "app.log",
+		Type:         "file",
+		Size:         1234,
+		Permissions:  0o640,
+		LastModified: time.Date(2021, 4, 10, 12, 5, 6, 0, time.UTC),
+		UserID:       &uid,
+		User:         "app",
+		GroupID:      &gid,
+		Group:        "adm",
+	}, {
+		Path:         "/var/log/current.log",
+		Name:         "current.log",
+		Type:         "symlink",
+		LinkTarget:   "app.log",
+		Permissions:  0o777,
+		LastModified: time.Date(2021, 4, 10, 12, 5, 7, 0, time.UTC),
+		UserID:       &root,
+		User:         "root",
+		GroupID:      &root,
+		Group:        "root",
+	}})
+}
+
+func (cs *clientSuite) TestListFilesGlobOldDaemon(c *C) {
+	cs.status = 404
+	cs.rsps = []string{`{
+		"type": "error",
+		"status-code": 404,
+		"result": {"kind": "not-found", "message": "stat /var/log/*.log: no such file or directory"}
+	}`, `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"version": "1.0"}
+	}`}
+	_, err := cs.cli.ListFiles(&client.ListFilesOptions{Path: "/var/log/*.log", Glob: true})
+	c.Assert(err, ErrorMatches, `daemon \(version 1.0\) does not support "files-glob"; it may need to be updated`)
+	c.Assert(cs.reqs, HasLen, 2)
+	c.Check(cs.reqs[1].URL.Path, Equals, "/v1/system-info")
+}
+
+func (cs *clientSuite) TestListFilesNotFound(c *C) {
+	cs.status = 404
+	cs.rsp = `{
+		"type": "error",
+		"status-code": 404,
+		"result": {"kind": "not-found", "message": "stat /nope: no such file or directory"}
+	}`
+	_, err := cs.cli.ListFiles(&client.ListFilesOptions{Path: "/nope"})
+	c.Assert(err, ErrorMatches, "stat /nope: no such file or directory")
+	c.Check(cs.reqs, HasLen, 1)
+}
+
+func (cs *clientSuite) TestChecksumFiles(c *C) {
+	cs.rsp = `{"type": "sync", "result": [{
+		"path": "/etc/app.conf",
+		"sha256": "46599c5bb5c33101f80cea8438e2228085513dbbb19b2f5ce97bd68494d3344d",
+		"size": 2,
+		"last-modified": "2021-04-10T12:05:06Z",
+		"link-target": "app/app.conf"
+	}, {
+		"path": "/etc/missing",
+		"error": {"kind": "not-found", "message": "stat /etc/missing: no such file or directory"}
+	}]}`
+
+	checksums, err := cs.cli.ChecksumFiles(&client.ChecksumFilesOptions{
+		Paths: []string{"/etc/app.conf", "/etc/missing"},
+	})
+	c.Assert(err, IsNil)
+
+	c.Check(cs.req.Method, Equals, "GET")
+	c.Check(cs.req.URL.Path, Equals, "/v1/files")
+	c.Check(cs.req.URL.Query(), DeepEquals, url.Values{
+		"action": {"checksum"},
+		"path":   {"/etc/app.conf", "/etc/missing"},
+	})
+
+	c.Assert(checksums, HasLen, 2)
+	c.Check(checksums[0], DeepEquals, &client.FileChecksum{
+		Path:         "/etc/app.conf",
+		SHA256:       "46599c5bb5c33101f80cea8438e2228085513dbbb19b2f5ce97bd68494d3344d",
+		Size:         2,
+		LastModified: time.Date(2021, 4, 10, 12, 5, 6, 0, time.UTC),
+		LinkTarget:   "app/app.conf",
+	})
+	c.Check(checksums[1].Path, Equals, "/etc/missing")
+	c.Check(checksums[1].SHA256, Equals, "")
+	c.Assert(checksums[1].Error, ErrorMatches, "stat /etc/missing: no such file or directory")
+	c.Check(checksums[1].Error.(*client.Error).Kind, Equals, "not-found")
+}
+
+func (cs *clientSuite) TestChecksumFilesOldDaemon(c *C) {
+	cs.rsps = []string{`{
+		"type": "error",
+		"status-code": 400,
+		"result": {"message": "invalid action \"checksum\""}
+	}`, `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"version": "1.0"}
+	}`}
+	_, err := cs.cli.ChecksumFiles(&client.ChecksumFilesOptions{Paths: []string{"/etc/app.conf"}})
+	c.Assert(err, ErrorMatches, `daemon \(version 1.0\) does not support "files-checksum"; it may need to be updated`)
+}
+
+// pullResponse returns a multipart read response body with the given file
+// content (if any) and result, and sets the client suite's Content-Type.
+func (cs *clientSuite) pullResponse(c *C, path, content, result string) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if content != "" {
+		fw, err := mw.CreateFormFile("files", path)
+		c.Assert(err, IsNil)
+		_, err = fw.Write([]byte(content))
+		c.Assert(err, IsNil)
+	}
+	fw, err := mw.CreateFormField("response")
+	c.Assert(err, IsNil)
+	_, err = fw.Write([]byte(`{"type": "sync", "status-code": 200, "result": ` + result + `}`))
+	c.Assert(err, IsNil)
+	c.Assert(mw.Close(), IsNil)
+	cs.rsp = body.String()
+	cs.header = http.Header{"Content-Type": {mw.FormDataContentType()}}
+}
+
+func (cs *clientSuite) TestPull(c *C) {
+	cs.pullResponse(c, "/etc/app.conf", "key: value\n", `[{"path": "/etc/app.conf"}]`)
+
+	var target bytes.Buffer
+	err := cs.cli.Pull(&client.PullOptions{
+		Path:   "/etc/app.conf",
+		Target: &target,
+	})
+	c.Assert(err, IsNil)
+	c.Check(target.String(), Equals, "key: value\n")
+
+	c.Check(cs.req.Method, Equals, "GET")
+	c.Check(cs.req.URL.Path, Equals, "/v1/files")
+	c.Check(cs.req.URL.Query(), DeepEquals, url.Values{
+		"action": {"read"},
+		"path":   {"/etc/app.conf"},
+	})
+	c.Check(cs.req.Header.Get("Accept"), Equals, "multipart/form-data")
+}
+
+func (cs *clientSuite) TestPullFileError(c *C) {
+	cs.pullResponse(c, "/etc/missing", "", `[{
+		"path": "/etc/missing",
+		"error": {"kind": "not-found", "message": "stat /etc/missing: no such file or directory"}
+	}]`)
+
+	var target bytes.Buffer
+	err := cs.cli.Pull(&client.PullOptions{
+		Path:   "/etc/missing",
+		Target: &target,
+	})
+	c.Assert(err, ErrorMatches, "stat /etc/missing: no such file or directory")
+	c.Check(err.(*client.Error).Kind, Equals, "not-found")
+	c.Check(target.Len(), Equals, 0)
+}
+
+func (cs *clientSuite) TestPullArchive(c *C) {
+	cs.rsp = "tar data"
+
+	var target bytes.Buffer
+	err := cs.cli.PullArchive(&client.PullArchiveOptions{
+		Path:     "/var/log",
+		Gzip:     true,
+		NoFollow: true,
+		Target:   &target,
+	})
+	c.Assert(err, IsNil)
+	c.Check(target.String(), Equals, "tar data")
+
+	c.Check(cs.req.Method, Equals, "GET")
+	c.Check(cs.req.URL.Path, Equals, "/v1/files")
+	c.Check(cs.req.URL.Query(), DeepEquals, url.Values{
+		"action":      {"archive"},
+		"path":        {"/var/log"},
+		"compression": {"gzip"},
+		"follow":      {"false"},
+	})
+}
+
+func (cs *clientSuite) TestPullArchiveIncomplete(c *C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Pebble-Archive-Error")
+		w.Write([]byte("partial"))
+		w.Header().Set("Pebble-Archive-Error", "open /var/log/secret: permission denied")
+	}))
+	defer srv.Close()
+
+	cli, err := client.New(&client.Config{BaseURL: srv.URL})
+	c.Assert(err, IsNil)
+	var target bytes.Buffer
+	err = cli.PullArchive(&client.PullArchiveOptions{
+		Path:   "/var/log",
+		Target: &target,
+	})
+	c.Assert(err, ErrorMatches, "archive is incomplete: open /var/log/secret: permission denied")
+	c.Check(target.String(), Equals, "partial")
+}
+
+func (cs *clientSuite) TestPullArchiveOldDaemon(c *C) {
+	cs.status = 400
+	cs.header = http.Header{"Content-Type": {"application/json"}}
+	cs.rsps = []string{`{
+		"type": "error",
+		"status-code": 400,
+		"result": {"message": "invalid action \"archive\""}
+	}`, `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"version": "1.0"}
+	}`}
+	err := cs.cli.PullArchive(&client.PullArchiveOptions{
+		Path:   "/var/log",
+		Target: &bytes.Buffer{},
+	})
+	c.Assert(err, ErrorMatches, `daemon \(version 1.0\) does not support "files-archive"; it may need to be updated`)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Health reports whether the daemon and its services are healthy: that is,
+// the daemon isn't in degraded mode and no service is failing.
+func (client *Client) Health() (healthy bool, err error) {
+	return client.HealthContext(context.Background())
+}
+
+// HealthContext is like Health, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) HealthContext(ctx context.Context) (healthy bool, err error) {
+	var result struct {
+		Healthy bool `json:"healthy"`
+	}
+	_, err = client.doSync(ctx, "GET", "/v1/health", nil, nil, nil, &result)
+	if err != nil {
+		return false, client.featureError(ctx, err, "health")
+	}
+	return result.Healthy, nil
+}
+
+// CheckLevel is the level of a health check.
+type CheckLevel string
+
+const (
+	UnsetLevel CheckLevel = ""
+	AliveLevel CheckLevel = "alive"
+	ReadyLevel CheckLevel = "ready"
+)
+
+type HealthOptions struct {
+	// Level restricts the checks to those at this level. As a service
+	// isn't ready if it isn't alive, ReadyLevel includes "alive" checks.
+	Level CheckLevel
+
+	// Names restricts the checks to those with these names.
+	Names []string
+}
+
+// CheckHealth reports whether the health checks matching opts are all up.
+// At least one of opts.Level and opts.Names must be set.
+func (client *Client) CheckHealth(opts *HealthOptions) (healthy bool, err error) {
+	return client.CheckHealthContext(context.Background(), opts)
+}
+
+// CheckHealthContext is like CheckHealth, but uses ctx for the API requests
+// so that they can be cancelled.
+func (client *Client) CheckHealthContext(ctx context.Context, opts *HealthOptions) (healthy bool, err error) {
+	query := make(url.Values)
+	if opts.Level != UnsetLevel {
+		query.Set("level", string(opts.Level))
+	}
+	if len(opts.Names) > 0 {
+		query.Set("names", strings.Join(opts.Names, ","))
+	}
+	var result struct {
+		Healthy bool `json:"healthy"`
+	}
+	_, err = client.doSync(ctx, "GET", "/v1/health", query, nil, nil, &result)
+	if err != nil {
+		return false, client.featureError(ctx, err, "health-checks")
+	}
+	return result.Healthy, nil
+}
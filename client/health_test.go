@@ -0,0 +1,57 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"net/url"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/client"
+)
+
+func (cs *clientSuite) TestHealth(c *C) {
+	cs.rsp = `{"type": "sync", "status-code": 502, "result": {"healthy": false}}`
+	healthy, err := cs.cli.Health()
+	c.Assert(err, IsNil)
+	c.Check(healthy, Equals, false)
+	c.Check(cs.req.URL.Path, Equals, "/v1/health")
+
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": {"healthy": true}}`
+	healthy, err = cs.cli.Health()
+	c.Assert(err, IsNil)
+	c.Check(healthy, Equals, true)
+}
+
+func (cs *clientSuite) TestCheckHealth(c *C) {
+	cs.rsp = `{"type": "sync", "status-code": 502, "result": {"healthy": false}}`
+	healthy, err := cs.cli.CheckHealth(&client.HealthOptions{
+		Level: client.ReadyLevel,
+		Names: []string{"chk1", "chk2"},
+	})
+	c.Assert(err, IsNil)
+	c.Check(healthy, Equals, false)
+	c.Check(cs.req.URL.Path, Equals, "/v1/health")
+	c.Check(cs.req.URL.Query(), DeepEquals, url.Values{
+		"level": {"ready"},
+		"names": {"chk1,chk2"},
+	})
+
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": {"healthy": true}}`
+	healthy, err = cs.cli.CheckHealth(&client.HealthOptions{Level: client.AliveLevel})
+	c.Assert(err, IsNil)
+	c.Check(healthy, Equals, true)
+	c.Check(cs.req.URL.Query(), DeepEquals, url.Values{"level": {"alive"}})
+}
@@ -54,7 +54,13 @@ type LogEntry struct {
 
 // Logs fetches previously-written logs from the given services.
 func (client *Client) Logs(opts *LogsOptions) error {
-	return client.logs(context.Background(), opts, false)
+	return client.LogsContext(context.Background(), opts)
+}
+
+// LogsContext is like Logs, but uses ctx for the request so that it can be
+// cancelled.
+func (client *Client) LogsContext(ctx context.Context, opts *LogsOptions) error {
+	return client.logs(ctx, opts, false)
 }
 
 // FollowLogs requests logs from the given services and follows them until the
@@ -0,0 +1,227 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type NoticeType string
+
+const (
+	// CustomNotice is a notice reported by a client. Its key must be in the
+	// form "domain.com/key".
+	CustomNotice NoticeType = "custom"
+
+	// StartLimitNotice is recorded when a service has been restarted too
+	// often and won't be restarted again until it's started explicitly. Its
+	// key is the name of the service.
+	StartLimitNotice NoticeType = "start-limit"
+)
+
+// Notice records an occurrence of an event of interest. Notices are unique
+// by type and key.
+type Notice struct {
+	ID            string            `json:"id"`
+	Type          NoticeType        `json:"type"`
+	Key           string            `json:"key"`
+	FirstOccurred time.Time         `json:"first-occurred"`
+	LastOccurred  time.Time         `json:"last-occurred"`
+	LastRepeated  time.Time         `json:"last-repeated"`
+	Occurrences   int               `json:"occurrences"`
+	LastData      map[string]string `json:"last-data,omitempty"`
+	RepeatAfter   time.Duration     `json:"-"`
+	ExpireAfter   time.Duration     `json:"-"`
+}
+
+func (n *Notice) UnmarshalJSON(data []byte) error {
+	type plainNotice Notice
+	var jn struct {
+		*plainNotice
+		RepeatAfter string `json:"repeat-after"`
+		ExpireAfter string `json:"expire-after"`
+	}
+	jn.plainNotice = (*plainNotice)(n)
+	err := json.Unmarshal(data, &jn)
+	if err != nil {
+		return err
+	}
+	if jn.RepeatAfter != "" {
+		n.RepeatAfter, err = time.ParseDuration(jn.RepeatAfter)
+		if err != nil {
+			return fmt.Errorf("invalid repeat-after %q", jn.RepeatAfter)
+		}
+	}
+	if jn.ExpireAfter != "" {
+		n.ExpireAfter, err = time.ParseDuration(jn.ExpireAfter)
+		if err != nil {
+			return fmt.Errorf("invalid expire-after %q", jn.ExpireAfter)
+		}
+	}
+	return nil
+}
+
+type NotifyOptions struct {
+	// Key is the custom notice's key, in the form "domain.com/key"
+	// (required).
+	Key string
+
+	// Data is the optional key-value data for this occurrence.
+	Data map[string]string
+
+	// RepeatAfter, if set, allows the notice to repeat only after this
+	// long since it was last repeated.
+	RepeatAfter time.Duration
+}
+
+// Notify records an occurrence of a custom notice with the given options,
+// returning the notice's ID.
+func (client *Client) Notify(opts *NotifyOptions) (string, error) {
+	return client.NotifyContext(context.Background(), opts)
+}
+
+// NotifyContext is like Notify, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) NotifyContext(ctx context.Context, opts *NotifyOptions) (string, error) {
+	payload := noticesPayload{
+		Action: "add",
+		Type:   string(CustomNotice),
+		Key:    opts.Key,
+		Data:   opts.Data,
+	}
+	if opts.RepeatAfter != 0 {
+		payload.RepeatAfter = opts.RepeatAfter.String()
+	}
+	var body bytes.Buffer
+	err := json.NewEncoder(&body).Encode(&payload)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode JSON payload: %v", err)
+	}
+	var result struct {
+		ID string `json:"id"`
+	}
+	_, err = client.doSync(ctx, "POST", "/v1/notices", nil, nil, &body, &result)
+	if err != nil {
+		return "", client.featureError(ctx, err, "notices")
+	}
+	return result.ID, nil
+}
+
+type noticesPayload struct {
+	Action      string            `json:"action"`
+	Type        string            `json:"type"`
+	Key         string            `json:"key"`
+	RepeatAfter string            `json:"repeat-after,omitempty"`
+	Data        map[string]string `json:"data,omitempty"`
+}
+
+type NoticesOptions struct {
+	// Types, if not empty, includes only notices whose type is one of these.
+	Types []NoticeType
+
+	// Keys, if not empty, includes only notices whose key is one of these.
+	Keys []string
+
+	// After, if set, includes only notices that were last repeated after
+	// this time.
+	After time.Time
+}
+
+// Notices returns the notices that match the options, sorted by the time
+// they were last repeated.
+func (client *Client) Notices(opts *NoticesOptions) ([]*Notice, error) {
+	return client.NoticesContext(context.Background(), opts)
+}
+
+// NoticesContext is like Notices, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) NoticesContext(ctx context.Context, opts *NoticesOptions) ([]*Notice, error) {
+	var notices []*Notice
+	_, err := client.doSync(ctx, "GET", "/v1/notices", noticesQuery(opts), nil, nil, &notices)
+	if err != nil {
+		return nil, client.featureError(ctx, err, "notices")
+	}
+	return notices, nil
+}
+
+// WaitNotices waits up to timeout for notices that match the options to
+// exist or occur, returning them as soon as there are any. If there are none
+// when the timeout elapses, it returns an empty list. To wait for notices
+// newer than those already seen, set opts.After to the LastRepeated time of
+// the most recent one.
+func (client *Client) WaitNotices(opts *NoticesOptions, timeout time.Duration) ([]*Notice, error) {
+	return client.WaitNoticesContext(context.Background(), opts, timeout)
+}
+
+// WaitNoticesContext is like WaitNotices, but uses ctx for the API requests
+// so that they can be cancelled.
+func (client *Client) WaitNoticesContext(ctx context.Context, opts *NoticesOptions, timeout time.Duration) ([]*Notice, error) {
+	query := noticesQuery(opts)
+	query.Set("timeout", timeout.String())
+	var notices []*Notice
+	_, err := client.doSync(ctx, "GET", "/v1/notices", query, nil, nil, &notices)
+	if err != nil {
+		return nil, client.featureError(ctx, err, "notices")
+	}
+	if len(notices) == 0 {
+		// An older daemon returns straight away rather than waiting.
+		if err := client.requireFeature(ctx, "notices-wait"); err != nil {
+			return nil, err
+		}
+	}
+	return notices, nil
+}
+
+func noticesQuery(opts *NoticesOptions) url.Values {
+	query := url.Values{}
+	if opts != nil {
+		if len(opts.Types) > 0 {
+			types := make([]string, len(opts.Types))
+			for i, t := range opts.Types {
+				types[i] = string(t)
+			}
+			query.Set("types", strings.Join(types, ","))
+		}
+		if len(opts.Keys) > 0 {
+			query.Set("keys", strings.Join(opts.Keys, ","))
+		}
+		if !opts.After.IsZero() {
+			query.Set("after", opts.After.Format(time.RFC3339Nano))
+		}
+	}
+	return query
+}
+
+// Notice returns the notice with the given ID.
+func (client *Client) Notice(id string) (*Notice, error) {
+	return client.NoticeContext(context.Background(), id)
+}
+
+// NoticeContext is like Notice, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) NoticeContext(ctx context.Context, id string) (*Notice, error) {
+	var notice *Notice
+	_, err := client.doSync(ctx, "GET", "/v1/notices/"+url.PathEscape(id), nil, nil, nil, &notice)
+	if err != nil {
+		return nil, err
+	}
+	return notice, nil
+}
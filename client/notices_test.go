@@ -0,0 +1,137 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/client"
+)
+
+func (cs *clientSuite) TestNotify(c *C) {
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": {"id": "7"}}`
+	id, err := cs.cli.Notify(&client.NotifyOptions{
+		Key:         "example.com/foo",
+		Data:        map[string]string{"a": "b"},
+		RepeatAfter: time.Hour,
+	})
+	c.Assert(err, IsNil)
+	c.Check(id, Equals, "7")
+	c.Check(cs.req.Method, Equals, "POST")
+	c.Check(cs.req.URL.Path, Equals, "/v1/notices")
+
+	var body map[string]interface{}
+	err = json.NewDecoder(cs.req.Body).Decode(&body)
+	c.Assert(err, IsNil)
+	c.Check(body, DeepEquals, map[string]interface{}{
+		"action":       "add",
+		"type":         "custom",
+		"key":          "example.com/foo",
+		"data":         map[string]interface{}{"a": "b"},
+		"repeat-after": "1h0m0s",
+	})
+}
+
+func (cs *clientSuite) TestNotices(c *C) {
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": [{
+		"id": "1",
+		"type": "custom",
+		"key": "example.com/foo",
+		"first-occurred": "2021-04-03T02:01:00Z",
+		"last-occurred": "2021-04-03T03:01:00Z",
+		"last-repeated": "2021-04-03T03:01:00Z",
+		"occurrences": 2,
+		"last-data": {"a": "b"},
+		"expire-after": "168h0m0s"
+	}]}`
+	after := time.Date(2021, 4, 3, 0, 0, 0, 0, time.UTC)
+	notices, err := cs.cli.Notices(&client.NoticesOptions{
+		Types: []client.NoticeType{client.CustomNotice},
+		Keys:  []string{"example.com/foo", "example.com/bar"},
+		After: after,
+	})
+	c.Assert(err, IsNil)
+	c.Check(cs.req.Method, Equals, "GET")
+	c.Check(cs.req.URL.Path, Equals, "/v1/notices")
+	c.Check(cs.req.URL.Query(), DeepEquals, url.Values{
+		"types": {"custom"},
+		"keys":  {"example.com/foo,example.com/bar"},
+		"after": {"2021-04-03T00:00:00Z"},
+	})
+	c.Check(notices, DeepEquals, []*client.Notice{{
+		ID:            "1",
+		Type:          client.CustomNotice,
+		Key:           "example.com/foo",
+		FirstOccurred: time.Date(2021, 4, 3, 2, 1, 0, 0, time.UTC),
+		LastOccurred:  time.Date(2021, 4, 3, 3, 1, 0, 0, time.UTC),
+		LastRepeated:  time.Date(2021, 4, 3, 3, 1, 0, 0, time.UTC),
+		Occurrences:   2,
+		LastData:      map[string]string{"a": "b"},
+		ExpireAfter:   7 * 24 * time.Hour,
+	}})
+}
+
+func (cs *clientSuite) TestWaitNotices(c *C) {
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": [{"id": "2", "type": "custom", "key": "example.com/foo"}]}`
+	after := time.Date(2021, 4, 3, 0, 0, 0, 0, time.UTC)
+	notices, err := cs.cli.WaitNotices(&client.NoticesOptions{
+		Keys:  []string{"example.com/foo"},
+		After: after,
+	}, 30*time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(cs.reqs, HasLen, 1)
+	c.Check(cs.req.URL.Path, Equals, "/v1/notices")
+	c.Check(cs.req.URL.Query(), DeepEquals, url.Values{
+		"keys":    {"example.com/foo"},
+		"after":   {"2021-04-03T00:00:00Z"},
+		"timeout": {"30s"},
+	})
+	c.Assert(notices, HasLen, 1)
+	c.Check(notices[0].ID, Equals, "2")
+}
+
+func (cs *clientSuite) TestWaitNoticesTimeout(c *C) {
+	cs.rsps = []string{
+		`{"type": "sync", "status-code": 200, "result": []}`,
+		`{"type": "sync", "status-code": 200, "result": {"version": "1.0", "features": ["notices", "notices-wait"]}}`,
+	}
+	notices, err := cs.cli.WaitNotices(nil, time.Second)
+	c.Assert(err, IsNil)
+	c.Check(notices, HasLen, 0)
+}
+
+func (cs *clientSuite) TestWaitNoticesOldDaemon(c *C) {
+	// An older daemon ignores the timeout and returns straight away.
+	cs.rsps = []string{
+		`{"type": "sync", "status-code": 200, "result": []}`,
+		`{"type": "sync", "status-code": 200, "result": {"version": "1.0", "features": ["notices"]}}`,
+	}
+	_, err := cs.cli.WaitNotices(nil, time.Second)
+	c.Assert(err, ErrorMatches, `daemon \(version 1.0\) does not support "notices-wait"; .*`)
+}
+
+func (cs *clientSuite) TestNotice(c *C) {
+	cs.rsp = `{"type": "sync", "status-code": 200, "result": {"id": "3", "type": "custom", "key": "example.com/foo", "repeat-after": "1h0m0s"}}`
+	notice, err := cs.cli.Notice("3")
+	c.Assert(err, IsNil)
+	c.Check(cs.req.URL.Path, Equals, "/v1/notices/3")
+	c.Check(notice.ID, Equals, "3")
+	c.Check(notice.Key, Equals, "example.com/foo")
+	c.Check(notice.RepeatAfter, Equals, time.Hour)
+}
@@ -16,6 +16,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/url"
 )
@@ -25,6 +26,16 @@ type AddLayerOptions struct {
 	// has the given label. False (the default) means append a new layer.
 	Combine bool
 
+	// Persist true means the new layer is saved in the daemon's state and
+	// restored when it restarts. False (the default) means it's only kept in
+	// memory. It has no effect when combining with an existing layer.
+	Persist bool
+
+	// Before, if set, is the label of an existing layer added via the API to
+	// insert the new layer before, rather than appending it. It can't be
+	// used with Combine.
+	Before string
+
 	// Label is the label for the new layer if appending, and the label of the
 	// layer to combine with if Combine is true.
 	Label string
@@ -35,36 +46,195 @@ type AddLayerOptions struct {
 
 // AddLayer adds a layer to the plan's layers according to opts.Action.
 func (client *Client) AddLayer(opts *AddLayerOptions) error {
+	return client.AddLayerContext(context.Background(), opts)
+}
+
+// AddLayerContext is like AddLayer, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) AddLayerContext(ctx context.Context, opts *AddLayerOptions) error {
 	var payload = struct {
 		Action  string `json:"action"`
 		Combine bool   `json:"combine"`
+		Persist bool   `json:"persist,omitempty"`
 		Label   string `json:"label"`
+		Before  string `json:"before,omitempty"`
 		Format  string `json:"format"`
 		Layer   string `json:"layer"`
 	}{
 		Action:  "add",
 		Combine: opts.Combine,
+		Persist: opts.Persist,
 		Label:   opts.Label,
+		Before:  opts.Before,
 		Format:  "yaml",
 		Layer:   string(opts.LayerData),
 	}
+	err := client.postLayers(ctx, &payload)
+	if opts.Persist {
+		err = client.featureError(ctx, err, "layers-persist")
+	}
+	if opts.Before != "" {
+		err = client.featureError(ctx, err, "layers-move")
+	}
+	return err
+}
+
+type ReplaceLayerOptions struct {
+	// Label is the label of the existing layer to replace.
+	Label string
+
+	// LayerData is the replacement layer in YAML format.
+	LayerData []byte
+}
+
+// ReplaceLayer replaces the contents of the existing layer with the label
+// opts.Label, keeping its position in the plan's layers.
+func (client *Client) ReplaceLayer(opts *ReplaceLayerOptions) error {
+	return client.ReplaceLayerContext(context.Background(), opts)
+}
+
+// ReplaceLayerContext is like ReplaceLayer, but uses ctx for the API requests
+// so that they can be cancelled.
+func (client *Client) ReplaceLayerContext(ctx context.Context, opts *ReplaceLayerOptions) error {
+	var payload = struct {
+		Action string `json:"action"`
+		Label  string `json:"label"`
+		Format string `json:"format"`
+		Layer  string `json:"layer"`
+	}{
+		Action: "replace",
+		Label:  opts.Label,
+		Format: "yaml",
+		Layer:  string(opts.LayerData),
+	}
+	return client.featureError(ctx, client.postLayers(ctx, &payload), "layers-replace")
+}
+
+type RemoveLayerOptions struct {
+	// Label is the label of the layer to remove.
+	Label string
+}
+
+// RemoveLayer removes the layer with the label opts.Label from the plan's
+// layers.
+func (client *Client) RemoveLayer(opts *RemoveLayerOptions) error {
+	return client.RemoveLayerContext(context.Background(), opts)
+}
+
+// RemoveLayerContext is like RemoveLayer, but uses ctx for the API requests so
+// that they can be cancelled.
+func (client *Client) RemoveLayerContext(ctx context.Context, opts *RemoveLayerOptions) error {
+	var payload = struct {
+		Action string `json:"action"`
+		Label  string `json:"label"`
+	}{
+		Action: "remove",
+		Label:  opts.Label,
+	}
+	return client.featureError(ctx, client.postLayers(ctx, &payload), "layers-remove")
+}
+
+type MoveLayerOptions struct {
+	// Label is the label of the layer to move, which must have been added
+	// via the API.
+	Label string
+
+	// Before is the label of the layer (also added via the API) to move it
+	// before, or empty to move it to the end of the plan's layers.
+	Before string
+}
+
+// MoveLayer moves the layer with the label opts.Label to another position
+// in the plan's layers.
+func (client *Client) MoveLayer(opts *MoveLayerOptions) error {
+	return client.MoveLayerContext(context.Background(), opts)
+}
+
+// MoveLayerContext is like MoveLayer, but uses ctx for the API requests so
+// that they can be cancelled.
+func (client *Client) MoveLayerContext(ctx context.Context, opts *MoveLayerOptions) error {
+	var payload = struct {
+		Action string `json:"action"`
+		Label  string `json:"label"`
+		Before string `json:"before,omitempty"`
+	}{
+		Action: "move",
+		Label:  opts.Label,
+		Before: opts.Before,
+	}
+	return client.featureError(ctx, client.postLayers(ctx, &payload), "layers-move")
+}
+
+type LayersOptions struct {
+	// Content requests the YAML of each layer, as read (with variable
+	// references unexpanded), in LayerInfo.Layer.
+	Content bool
+}
+
+// LayerInfo holds information about a layer in the plan.
+type LayerInfo struct {
+	Label   string `json:"label"`
+	Order   int    `json:"order"`
+	Summary string `json:"summary,omitempty"`
+
+	// Dynamic is true if the layer was added via the API, rather than read
+	// from the layers directory, and Persist is true if it's restored when
+	// the daemon restarts.
+	Dynamic bool `json:"dynamic,omitempty"`
+	Persist bool `json:"persist,omitempty"`
+
+	// Layer is the layer's YAML, if requested with LayersOptions.Content.
+	Layer string `json:"layer,omitempty"`
+}
+
+// Layers returns the plan's layers, in the order they're combined.
+func (client *Client) Layers(opts *LayersOptions) ([]*LayerInfo, error) {
+	return client.LayersContext(context.Background(), opts)
+}
+
+// LayersContext is like Layers, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) LayersContext(ctx context.Context, opts *LayersOptions) ([]*LayerInfo, error) {
+	var query url.Values
+	if opts != nil && opts.Content {
+		// An older daemon would silently leave the content out.
+		if err := client.requireFeature(ctx, "layers-content"); err != nil {
+			return nil, err
+		}
+		query = url.Values{"content": []string{"true"}}
+	}
+	var layers []*LayerInfo
+	_, err := client.doSync(ctx, "GET", "/v1/layers", query, nil, nil, &layers)
+	if err != nil {
+		return nil, client.featureError(ctx, err, "layers-list")
+	}
+	return layers, nil
+}
+
+func (client *Client) postLayers(ctx context.Context, payload interface{}) error {
 	var body bytes.Buffer
-	if err := json.NewEncoder(&body).Encode(&payload); err != nil {
+	if err := json.NewEncoder(&body).Encode(payload); err != nil {
 		return err
 	}
-	_, err := client.doSync("POST", "/v1/layers", nil, nil, &body, nil)
+	_, err := client.doSync(ctx, "POST", "/v1/layers", nil, nil, &body, nil)
 	return err
 }
 
 type PlanOptions struct{}
 
 // PlanBytes fetches the plan in YAML format.
-func (client *Client) PlanBytes(_ *PlanOptions) (data []byte, err error) {
+func (client *Client) PlanBytes(opts *PlanOptions) (data []byte, err error) {
+	return client.PlanBytesContext(context.Background(), opts)
+}
+
+// PlanBytesContext is like PlanBytes, but uses ctx for the API requests so
+// that they can be cancelled.
+func (client *Client) PlanBytesContext(ctx context.Context, _ *PlanOptions) (data []byte, err error) {
 	query := url.Values{
 		"format": []string{"yaml"},
 	}
 	var dataStr string
-	_, err = client.doSync("GET", "/v1/plan", query, nil, nil, &dataStr)
+	_, err = client.doSync(ctx, "GET", "/v1/plan", query, nil, nil, &dataStr)
 	if err != nil {
 		return nil, err
 	}
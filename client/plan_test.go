@@ -57,6 +57,159 @@ services:
 	}
 }
 
+func (cs *clientSuite) TestAddLayerPersist(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": true
+	}`
+	err := cs.cli.AddLayer(&client.AddLayerOptions{
+		Persist:   true,
+		Label:     "debug",
+		LayerData: []byte("services: {}\n"),
+	})
+	c.Assert(err, check.IsNil)
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Check(body["persist"], check.Equals, true)
+}
+
+func (cs *clientSuite) TestAddLayerBefore(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": true
+	}`
+	err := cs.cli.AddLayer(&client.AddLayerOptions{
+		Before:    "bar",
+		Label:     "foo",
+		LayerData: []byte("services: {}\n"),
+	})
+	c.Assert(err, check.IsNil)
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Check(body["before"], check.Equals, "bar")
+}
+
+func (cs *clientSuite) TestMoveLayer(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": true
+	}`
+	err := cs.cli.MoveLayer(&client.MoveLayerOptions{
+		Label:  "foo",
+		Before: "bar",
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/layers")
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"action": "move",
+		"label":  "foo",
+		"before": "bar",
+	})
+}
+
+func (cs *clientSuite) TestLayers(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [
+			{"label": "base", "order": 1, "summary": "Base layer"},
+			{"label": "debug", "order": 2, "dynamic": true, "persist": true}
+		]
+	}`
+	layers, err := cs.cli.Layers(&client.LayersOptions{})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "GET")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/layers")
+	c.Check(layers, check.DeepEquals, []*client.LayerInfo{
+		{Label: "base", Order: 1, Summary: "Base layer"},
+		{Label: "debug", Order: 2, Dynamic: true, Persist: true},
+	})
+}
+
+func (cs *clientSuite) TestLayersContent(c *check.C) {
+	cs.rsps = []string{`{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"features": ["layers-content"]}
+	}`, `{
+		"type": "sync",
+		"status-code": 200,
+		"result": [
+			{"label": "base", "order": 1, "layer": "summary: Base layer\n"}
+		]
+	}`}
+	layers, err := cs.cli.Layers(&client.LayersOptions{Content: true})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/layers")
+	c.Check(cs.req.URL.Query().Get("content"), check.Equals, "true")
+	c.Check(layers, check.DeepEquals, []*client.LayerInfo{
+		{Label: "base", Order: 1, Layer: "summary: Base layer\n"},
+	})
+}
+
+func (cs *clientSuite) TestLayersContentNotSupported(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"version": "1.0", "features": ["layers-list"]}
+	}`
+	_, err := cs.cli.Layers(&client.LayersOptions{Content: true})
+	c.Assert(err, check.ErrorMatches, `daemon \(version 1.0\) does not support "layers-content".*`)
+}
+
+func (cs *clientSuite) TestReplaceLayer(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": true
+	}`
+	layerYAML := `
+services:
+    foo:
+        override: replace
+        command: cmd
+`[1:]
+	err := cs.cli.ReplaceLayer(&client.ReplaceLayerOptions{
+		Label:     "foo",
+		LayerData: []byte(layerYAML),
+	})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/layers")
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"action": "replace",
+		"label":  "foo",
+		"format": "yaml",
+		"layer":  layerYAML,
+	})
+}
+
+func (cs *clientSuite) TestRemoveLayer(c *check.C) {
+	cs.rsp = `{
+		"type": "sync",
+		"status-code": 200,
+		"result": true
+	}`
+	err := cs.cli.RemoveLayer(&client.RemoveLayerOptions{Label: "foo"})
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/layers")
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"action": "remove",
+		"label":  "foo",
+	})
+}
+
 func (cs *clientSuite) TestPlanBytes(c *check.C) {
 	cs.rsp = `{
 		"type": "sync",
@@ -75,3 +228,33 @@ services:
         command: cmd
 `[1:])
 }
+
+func (cs *clientSuite) TestRemoveLayerOldDaemon(c *check.C) {
+	cs.rsps = []string{`{
+		"type": "error",
+		"status-code": 400,
+		"result": {"message": "invalid action \"remove\""}
+	}`, `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"version": "1.0"}
+	}`}
+	err := cs.cli.RemoveLayer(&client.RemoveLayerOptions{Label: "foo"})
+	c.Assert(err, check.ErrorMatches, `daemon \(version 1.0\) does not support "layers-remove"; it may need to be updated`)
+	c.Assert(cs.reqs, check.HasLen, 2)
+	c.Check(cs.reqs[1].URL.Path, check.Equals, "/v1/system-info")
+}
+
+func (cs *clientSuite) TestRemoveLayerErrorSupported(c *check.C) {
+	cs.rsps = []string{`{
+		"type": "error",
+		"status-code": 404,
+		"result": {"message": "layer \"foo\" not found"}
+	}`, `{
+		"type": "sync",
+		"status-code": 200,
+		"result": {"version": "1.1", "features": ["layers-remove"]}
+	}`}
+	err := cs.cli.RemoveLayer(&client.RemoveLayerOptions{Label: "foo"})
+	c.Assert(err, check.ErrorMatches, `layer "foo" not found`)
+}
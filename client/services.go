@@ -16,50 +16,113 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 )
 
 type ServiceOptions struct {
 	Names []string
+
+	// Args maps service names to the arguments to start them with, in
+	// place of the default arguments in the "[ ... ]" group of their
+	// commands. Only used by Start and Restart.
+	Args map[string][]string
 }
 
+// AutoStart starts the services that are marked to start by default, and
+// returns the ID of the change doing so without waiting for it to finish.
 func (client *Client) AutoStart(opts *ServiceOptions) (changeID string, err error) {
-	_, changeID, err = client.doMultiServiceAction("autostart", opts.Names)
+	return client.AutoStartContext(context.Background(), opts)
+}
+
+// AutoStartContext is like AutoStart, but uses ctx for the API requests so
+// that they can be cancelled.
+func (client *Client) AutoStartContext(ctx context.Context, opts *ServiceOptions) (changeID string, err error) {
+	_, changeID, err = client.doMultiServiceAction(ctx, "autostart", opts.Names, nil)
 	return changeID, err
 }
 
+// Start starts the services named in opts, and returns the ID of the change
+// doing so without waiting for it to finish.
 func (client *Client) Start(opts *ServiceOptions) (changeID string, err error) {
-	_, changeID, err = client.doMultiServiceAction("start", opts.Names)
+	return client.StartContext(context.Background(), opts)
+}
+
+// StartContext is like Start, but uses ctx for the API requests so that they
+// can be cancelled.
+func (client *Client) StartContext(ctx context.Context, opts *ServiceOptions) (changeID string, err error) {
+	_, changeID, err = client.doMultiServiceAction(ctx, "start", opts.Names, opts.Args)
 	return changeID, err
 }
 
+// Stop stops the services named in opts, and returns the ID of the change
+// doing so without waiting for it to finish.
 func (client *Client) Stop(opts *ServiceOptions) (changeID string, err error) {
-	_, changeID, err = client.doMultiServiceAction("stop", opts.Names)
+	return client.StopContext(context.Background(), opts)
+}
+
+// StopContext is like Stop, but uses ctx for the API requests so that they can
+// be cancelled.
+func (client *Client) StopContext(ctx context.Context, opts *ServiceOptions) (changeID string, err error) {
+	_, changeID, err = client.doMultiServiceAction(ctx, "stop", opts.Names, nil)
 	return changeID, err
 }
 
+// Restart restarts the services named in opts, and returns the ID of the
+// change doing so without waiting for it to finish.
 func (client *Client) Restart(opts *ServiceOptions) (changeID string, err error) {
-	_, changeID, err = client.doMultiServiceAction("restart", opts.Names)
+	return client.RestartContext(context.Background(), opts)
+}
+
+// RestartContext is like Restart, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) RestartContext(ctx context.Context, opts *ServiceOptions) (changeID string, err error) {
+	_, changeID, err = client.doMultiServiceAction(ctx, "restart", opts.Names, opts.Args)
 	return changeID, err
 }
 
+// Reload makes the services reload their configuration, using their
+// reload-command or reload-signal. Services that have neither are restarted
+// instead.
+func (client *Client) Reload(opts *ServiceOptions) (changeID string, err error) {
+	return client.ReloadContext(context.Background(), opts)
+}
+
+// ReloadContext is like Reload, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) ReloadContext(ctx context.Context, opts *ServiceOptions) (changeID string, err error) {
+	_, changeID, err = client.doMultiServiceAction(ctx, "reload", opts.Names, nil)
+	return changeID, client.featureError(ctx, err, "services-reload")
+}
+
+// Replan brings the running services in line with the current plan, and
+// returns the ID of the change doing so without waiting for it to finish.
 func (client *Client) Replan(opts *ServiceOptions) (changeID string, err error) {
-	_, changeID, err = client.doMultiServiceAction("replan", opts.Names)
+	return client.ReplanContext(context.Background(), opts)
+}
+
+// ReplanContext is like Replan, but uses ctx for the API requests so that they
+// can be cancelled.
+func (client *Client) ReplanContext(ctx context.Context, opts *ServiceOptions) (changeID string, err error) {
+	_, changeID, err = client.doMultiServiceAction(ctx, "replan", opts.Names, nil)
 	return changeID, err
 }
 
 type multiActionData struct {
-	Action   string   `json:"action"`
-	Services []string `json:"services"`
+	Action   string              `json:"action"`
+	Services []string            `json:"services"`
+	Args     map[string][]string `json:"args,omitempty"`
 }
 
-func (client *Client) doMultiServiceAction(actionName string, services []string) (result json.RawMessage, changeID string, err error) {
+func (client *Client) doMultiServiceAction(ctx context.Context, actionName string, services []string, args map[string][]string) (result json.RawMessage, changeID string, err error) {
 	action := multiActionData{
 		Action:   actionName,
 		Services: services,
+		Args:     args,
 	}
 	data, err := json.Marshal(&action)
 	if err != nil {
@@ -68,7 +131,7 @@ func (client *Client) doMultiServiceAction(actionName string, services []string)
 	headers := map[string]string{
 		"Content-Type": "application/json",
 	}
-	return client.doAsyncFull("POST", "/v1/services", nil, headers, bytes.NewBuffer(data))
+	return client.doAsyncFull(ctx, "POST", "/v1/services", nil, headers, bytes.NewBuffer(data))
 }
 
 // ServicesOptions are the filtering options for querying services.
@@ -76,6 +139,10 @@ type ServicesOptions struct {
 	// Names is the list of service names to query for. If slice is nil or
 	// empty, fetch information for all services.
 	Names []string
+
+	// History, if true, also fetches the recent state transitions of each
+	// service.
+	History bool
 }
 
 // ServiceInfo holds status information for a single service.
@@ -83,6 +150,67 @@ type ServiceInfo struct {
 	Name    string         `json:"name"`
 	Startup ServiceStartup `json:"startup"`
 	Current ServiceStatus  `json:"current"`
+
+	// Details of the service's process, only set while it's running. The
+	// CPU time and resident set size (in bytes) are its usage so far.
+	PID       int           `json:"pid,omitempty"`
+	StartTime time.Time     `json:"start-time,omitempty"`
+	CPUTime   time.Duration `json:"-"`
+	RSS       int64         `json:"rss,omitempty"`
+
+	// Restarts is the number of times the service has been restarted
+	// automatically since it was last started manually, and TotalRestarts
+	// the number of times since the daemon started.
+	Restarts      int `json:"restarts,omitempty"`
+	TotalRestarts int `json:"total-restarts,omitempty"`
+
+	// LastExit describes how the service's process last exited, or is nil
+	// if it hasn't exited since the daemon started.
+	LastExit *ServiceExit `json:"last-exit,omitempty"`
+
+	// History holds the service's most recent state transitions, oldest
+	// first. It's only fetched if ServicesOptions.History is true.
+	History []ServiceTransition `json:"history,omitempty"`
+}
+
+// ServiceTransition records a service changing state, and why.
+type ServiceTransition struct {
+	Time   time.Time `json:"time"`
+	State  string    `json:"state"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// ServiceExit describes how a service's process exited.
+type ServiceExit struct {
+	// Code is the exit code, or 128+signal if the process was terminated
+	// by a signal.
+	Code int `json:"code"`
+
+	// Signal is the name of the signal that terminated the process (such
+	// as "SIGKILL"), if any.
+	Signal string `json:"signal,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+func (info *ServiceInfo) UnmarshalJSON(data []byte) error {
+	type plainServiceInfo ServiceInfo
+	var ji struct {
+		*plainServiceInfo
+		CPUTime string `json:"cpu-time"`
+	}
+	ji.plainServiceInfo = (*plainServiceInfo)(info)
+	err := json.Unmarshal(data, &ji)
+	if err != nil {
+		return err
+	}
+	if ji.CPUTime != "" {
+		info.CPUTime, err = time.ParseDuration(ji.CPUTime)
+		if err != nil {
+			return fmt.Errorf("invalid cpu-time %q", ji.CPUTime)
+		}
+	}
+	return nil
 }
 
 // ServiceStartup defines the different startup modes for a service.
@@ -106,13 +234,42 @@ const (
 // Services fetches information about specific services (or all of them),
 // ordered by service name.
 func (client *Client) Services(opts *ServicesOptions) ([]*ServiceInfo, error) {
+	return client.ServicesContext(context.Background(), opts)
+}
+
+// ServicesContext is like Services, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) ServicesContext(ctx context.Context, opts *ServicesOptions) ([]*ServiceInfo, error) {
 	query := url.Values{
 		"names": []string{strings.Join(opts.Names, ",")},
 	}
+	if opts.History {
+		query.Set("history", "true")
+	}
 	var services []*ServiceInfo
-	_, err := client.doSync("GET", "/v1/services", query, nil, nil, &services)
+	_, err := client.doSync(ctx, "GET", "/v1/services", query, nil, nil, &services)
 	if err != nil {
 		return nil, err
 	}
 	return services, nil
 }
+
+// PingWatchdog tells the watchdog of the named service that the service is
+// still working, so that it isn't considered hung.
+func (client *Client) PingWatchdog(service string) error {
+	return client.PingWatchdogContext(context.Background(), service)
+}
+
+// PingWatchdogContext is like PingWatchdog, but uses ctx for the API requests
+// so that they can be cancelled.
+func (client *Client) PingWatchdogContext(ctx context.Context, service string) error {
+	data, err := json.Marshal(map[string]string{"action": "watchdog"})
+	if err != nil {
+		return fmt.Errorf("cannot marshal watchdog action: %s", err)
+	}
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+	_, err = client.doSync(ctx, "POST", "/v1/services/"+url.PathEscape(service), nil, headers, bytes.NewBuffer(data), nil)
+	return err
+}
@@ -17,6 +17,7 @@ package client_test
 import (
 	"encoding/json"
 	"net/url"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -83,6 +84,34 @@ func (cs *clientSuite) TestAutostart(c *check.C) {
 	c.Check(body["action"], check.Equals, "autostart")
 }
 
+func (cs *clientSuite) TestStartArgs(c *check.C) {
+	cs.rsp = `{
+		"result": {},
+		"status": "OK",
+		"status-code": 202,
+		"type": "async",
+		"change": "42"
+	}`
+
+	opts := client.ServiceOptions{
+		Names: []string{"one"},
+		Args:  map[string][]string{"one": {"--port", "8080"}},
+	}
+
+	changeId, err := cs.cli.Start(&opts)
+	c.Check(err, check.IsNil)
+	c.Check(changeId, check.Equals, "42")
+
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Check(body, check.HasLen, 3)
+	c.Check(body["action"], check.Equals, "start")
+	c.Check(body["services"], check.DeepEquals, []interface{}{"one"})
+	c.Check(body["args"], check.DeepEquals, map[string]interface{}{
+		"one": []interface{}{"--port", "8080"},
+	})
+}
+
 func (cs *clientSuite) TestServicesGet(c *check.C) {
 	cs.rsp = `{
 		"result": [
@@ -110,6 +139,70 @@ func (cs *clientSuite) TestServicesGet(c *check.C) {
 	})
 }
 
+func (cs *clientSuite) TestServicesGetRunning(c *check.C) {
+	cs.rsp = `{
+		"result": [
+			{"name": "svc1", "startup": "enabled", "current": "active", "pid": 42,
+			 "start-time": "2021-04-10T12:00:00Z", "cpu-time": "1.5s", "rss": 4096,
+			 "restarts": 3, "total-restarts": 5, "last-exit": {"code": 137,
+			 "signal": "SIGKILL", "time": "2021-04-10T11:59:59Z"}}
+		],
+		"status": "OK",
+		"status-code": 200,
+		"type": "sync"
+	}`
+
+	services, err := cs.cli.Services(&client.ServicesOptions{})
+	c.Assert(err, check.IsNil)
+	c.Assert(services, check.DeepEquals, []*client.ServiceInfo{{
+		Name:          "svc1",
+		Startup:       client.StartupEnabled,
+		Current:       client.StatusActive,
+		PID:           42,
+		StartTime:     time.Date(2021, 4, 10, 12, 0, 0, 0, time.UTC),
+		CPUTime:       1500 * time.Millisecond,
+		RSS:           4096,
+		Restarts:      3,
+		TotalRestarts: 5,
+		LastExit: &client.ServiceExit{
+			Code:   137,
+			Signal: "SIGKILL",
+			Time:   time.Date(2021, 4, 10, 11, 59, 59, 0, time.UTC),
+		},
+	}})
+}
+
+func (cs *clientSuite) TestServicesGetHistory(c *check.C) {
+	cs.rsp = `{
+		"result": [
+			{"name": "svc1", "startup": "enabled", "current": "inactive", "history": [
+				{"time": "2021-04-10T12:00:00Z", "state": "starting", "reason": "process started"},
+				{"time": "2021-04-10T12:00:05Z", "state": "stopped", "reason": "exited with code 1"}
+			]}
+		],
+		"status": "OK",
+		"status-code": 200,
+		"type": "sync"
+	}`
+
+	services, err := cs.cli.Services(&client.ServicesOptions{Names: []string{"svc1"}, History: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(cs.req.URL.Query(), check.DeepEquals, url.Values{
+		"names":   {"svc1"},
+		"history": {"true"},
+	})
+	c.Assert(services, check.HasLen, 1)
+	c.Check(services[0].History, check.DeepEquals, []client.ServiceTransition{{
+		Time:   time.Date(2021, 4, 10, 12, 0, 0, 0, time.UTC),
+		State:  "starting",
+		Reason: "process started",
+	}, {
+		Time:   time.Date(2021, 4, 10, 12, 0, 5, 0, time.UTC),
+		State:  "stopped",
+		Reason: "exited with code 1",
+	}})
+}
+
 func (cs *clientSuite) TestRestart(c *check.C) {
 	cs.rsp = `{
 		"result": {},
@@ -136,6 +229,32 @@ func (cs *clientSuite) TestRestart(c *check.C) {
 	c.Check(body["services"], check.DeepEquals, []interface{}{"one", "two"})
 }
 
+func (cs *clientSuite) TestReload(c *check.C) {
+	cs.rsp = `{
+		"result": {},
+		"status": "OK",
+		"status-code": 202,
+		"type": "async",
+		"change": "42"
+	}`
+
+	opts := client.ServiceOptions{
+		Names: []string{"one", "two"},
+	}
+
+	changeId, err := cs.cli.Reload(&opts)
+	c.Check(err, check.IsNil)
+	c.Check(changeId, check.Equals, "42")
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/services")
+
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Check(body, check.HasLen, 2)
+	c.Check(body["action"], check.Equals, "reload")
+	c.Check(body["services"], check.DeepEquals, []interface{}{"one", "two"})
+}
+
 func (cs *clientSuite) TestReplan(c *check.C) {
 	cs.rsp = `{
 		"result": {},
@@ -158,3 +277,21 @@ func (cs *clientSuite) TestReplan(c *check.C) {
 	c.Check(body, check.HasLen, 2)
 	c.Check(body["action"], check.Equals, "replan")
 }
+
+func (cs *clientSuite) TestPingWatchdog(c *check.C) {
+	cs.rsp = `{
+		"result": true,
+		"status": "OK",
+		"status-code": 200,
+		"type": "sync"
+	}`
+
+	err := cs.cli.PingWatchdog("svc1")
+	c.Assert(err, check.IsNil)
+	c.Check(cs.req.Method, check.Equals, "POST")
+	c.Check(cs.req.URL.Path, check.Equals, "/v1/services/svc1")
+
+	var body map[string]interface{}
+	c.Assert(json.NewDecoder(cs.req.Body).Decode(&body), check.IsNil)
+	c.Check(body, check.DeepEquals, map[string]interface{}{"action": "watchdog"})
+}
@@ -16,6 +16,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 )
@@ -27,6 +28,12 @@ type SendSignalOptions struct {
 
 // SendSignal sends a signal to each of the specified services.
 func (client *Client) SendSignal(opts *SendSignalOptions) error {
+	return client.SendSignalContext(context.Background(), opts)
+}
+
+// SendSignalContext is like SendSignal, but uses ctx for the API requests so
+// that they can be cancelled.
+func (client *Client) SendSignalContext(ctx context.Context, opts *SendSignalOptions) error {
 	var body bytes.Buffer
 	payload := signalsPayload{
 		Signal:   opts.Signal,
@@ -36,7 +43,7 @@ func (client *Client) SendSignal(opts *SendSignalOptions) error {
 	if err != nil {
 		return fmt.Errorf("cannot encode JSON payload: %v", err)
 	}
-	_, err = client.doSync("POST", "/v1/signals", nil, nil, &body, nil)
+	_, err = client.doSync(ctx, "POST", "/v1/signals", nil, nil, &body, nil)
 	return err
 }
 
@@ -0,0 +1,230 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DefaultRemoteSocket is the daemon's socket path on a remote host used
+// when an SSH URL doesn't specify one.
+const DefaultRemoteSocket = "/var/lib/pebble/default/.pebble.socket"
+
+// SSHConfig configures access to a Pebble daemon on a remote host. The API
+// requests are tunnelled over SSH to the daemon's unix socket on that host,
+// so no TCP port needs to be exposed.
+type SSHConfig struct {
+	// User is the user to log in as. Defaults to the current user.
+	User string
+
+	// Host is the remote host, optionally with a port (the default is 22).
+	Host string
+
+	// Socket is the path of the daemon's unix socket on the remote host.
+	Socket string
+
+	// ClientConfig, if set, is used to establish the SSH connection (and
+	// User is ignored). Otherwise the keys held by ssh-agent and the
+	// unencrypted keys in ~/.ssh are used to log in, and the host key is
+	// verified using ~/.ssh/known_hosts.
+	ClientConfig *ssh.ClientConfig
+}
+
+// ParseSSHURL parses a URL of the form ssh://[user@]host[:port][/socket]
+// into an SSHConfig. The socket path defaults to DefaultRemoteSocket.
+func ParseSSHURL(s string) (*SSHConfig, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SSH URL %q: %v", s, err)
+	}
+	if u.Scheme != "ssh" {
+		return nil, fmt.Errorf("invalid SSH URL %q: scheme must be ssh", s)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid SSH URL %q: no host", s)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid SSH URL %q: unexpected query or fragment", s)
+	}
+	config := &SSHConfig{
+		User:   u.User.Username(),
+		Host:   sshAddress(u.Hostname(), u.Port()),
+		Socket: u.Path,
+	}
+	if config.Socket == "" || config.Socket == "/" {
+		config.Socket = DefaultRemoteSocket
+	}
+	return config, nil
+}
+
+// sshDialer connects to the remote socket over a shared SSH connection,
+// which is (re-)established on demand.
+type sshDialer struct {
+	config *SSHConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+func (d *sshDialer) dial(_, _ string) (net.Conn, error) {
+	sshClient, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sshClient.Dial("unix", d.config.Socket)
+	if err != nil {
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) {
+			// The SSH connection is fine, but the remote socket can't be
+			// connected to, for example while the daemon restarts.
+			return nil, &remoteSocketError{err}
+		}
+		// The SSH connection has probably been dropped, so reconnect next
+		// time.
+		d.mu.Lock()
+		if d.client == sshClient {
+			d.client = nil
+			sshClient.Close()
+		}
+		d.mu.Unlock()
+		return nil, fmt.Errorf("cannot connect to %s over SSH: %w", d.config.Socket, err)
+	}
+	return conn, nil
+}
+
+func (d *sshDialer) connect() (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client != nil {
+		return d.client, nil
+	}
+	clientConfig := d.config.ClientConfig
+	if clientConfig == nil {
+		config, agentConn, err := defaultSSHClientConfig(d.config.User)
+		if err != nil {
+			return nil, err
+		}
+		if agentConn != nil {
+			// ssh-agent is only used to sign during the handshake.
+			defer agentConn.Close()
+		}
+		clientConfig = config
+	}
+	addr := d.config.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		// No port, and possibly a bracketed IPv6 address such as "[::1]".
+		addr = sshAddress(strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]"), "")
+	}
+	sshClient, err := ssh.Dial("tcp", addr, clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to %s over SSH: %w", addr, err)
+	}
+	d.client = sshClient
+	return sshClient, nil
+}
+
+// sshAddress returns the address to dial for host and port, which defaults
+// to 22. IPv6 hosts are bracketed.
+func sshAddress(host, port string) string {
+	if port == "" {
+		port = "22"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// remoteSocketError reports that the remote socket refused the connection.
+// Like a local socket's error, it's considered transient, so GET requests
+// are retried.
+type remoteSocketError struct {
+	err error
+}
+
+func (e *remoteSocketError) Error() string {
+	return e.err.Error()
+}
+
+func (e *remoteSocketError) Is(target error) bool {
+	return target == syscall.ECONNREFUSED
+}
+
+// defaultSSHClientConfig returns the configuration used when SSHConfig has
+// no ClientConfig, along with the connection to ssh-agent (if any), which
+// the caller must close once the SSH connection has been established.
+func defaultSSHClientConfig(username string) (*ssh.ClientConfig, net.Conn, error) {
+	if username == "" {
+		u, err := user.Current()
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot determine SSH user: %v", err)
+		}
+		username = u.Username
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot find SSH configuration: %v", err)
+	}
+
+	hostKeyCallback, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read SSH known hosts: %v", err)
+	}
+
+	var auth []ssh.AuthMethod
+	var agentConn net.Conn
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentConn = conn
+			auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		data, err := ioutil.ReadFile(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		// Keys protected by a passphrase need to be added to ssh-agent.
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		auth = append(auth, ssh.PublicKeys(signers...))
+	}
+
+	return &ssh.ClientConfig{
+		User:            username,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	}, agentConn, nil
+}
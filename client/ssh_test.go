@@ -0,0 +1,288 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/client"
+)
+
+// startSSHServer starts an SSH server that forwards unix socket connections
+// like OpenSSH's sshd, and returns its address and host key.
+func startSSHServer(c *C) (addr string, hostKey ssh.PublicKey, stop func()) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, IsNil)
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	c.Assert(err, IsNil)
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+	return listener.Addr().String(), signer.PublicKey(), func() { listener.Close() }
+}
+
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "direct-streamlocal@openssh.com" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		var msg struct {
+			SocketPath string
+			Reserved0  string
+			Reserved1  uint32
+		}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &msg); err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		target, err := net.Dial("unix", msg.SocketPath)
+		if err != nil {
+			newChannel.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(requests)
+		go func() {
+			io.Copy(channel, target)
+			channel.Close()
+		}()
+		go func() {
+			io.Copy(target, channel)
+			target.Close()
+		}()
+	}
+}
+
+func (cs *clientSuite) TestSSH(c *C) {
+	addr, hostKey, stop := startSSHServer(c)
+	defer stop()
+
+	l, err := net.Listen("unix", cs.socketPath)
+	c.Assert(err, IsNil)
+	srv := &httptest.Server{
+		Listener: l,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Check(r.URL.Path, Equals, "/v1/system-info")
+			fmt.Fprintln(w, `{"type":"sync", "result":{"version":"1"}}`)
+		})},
+	}
+	srv.Start()
+	defer srv.Close()
+
+	cli, err := client.New(&client.Config{
+		SSH: &client.SSHConfig{
+			Host:   addr,
+			Socket: cs.socketPath,
+			ClientConfig: &ssh.ClientConfig{
+				User:            "test",
+				HostKeyCallback: ssh.FixedHostKey(hostKey),
+			},
+		},
+	})
+	c.Assert(err, IsNil)
+	for i := 0; i < 2; i++ {
+		si, err := cli.SysInfo()
+		c.Assert(err, IsNil)
+		c.Check(si.Version, Equals, "1")
+	}
+}
+
+func (cs *clientSuite) TestSSHDefaultConfigClosesAgent(c *C) {
+	addr, hostKey, stop := startSSHServer(c)
+	defer stop()
+
+	home := c.MkDir()
+	c.Assert(os.Mkdir(filepath.Join(home, ".ssh"), 0700), IsNil)
+	knownHosts := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey) + "\n"
+	err := ioutil.WriteFile(filepath.Join(home, ".ssh", "known_hosts"), []byte(knownHosts), 0600)
+	c.Assert(err, IsNil)
+
+	agentPath := filepath.Join(c.MkDir(), "agent.socket")
+	agentListener, err := net.Listen("unix", agentPath)
+	c.Assert(err, IsNil)
+	defer agentListener.Close()
+	agentClosed := make(chan struct{})
+	go func() {
+		conn, err := agentListener.Accept()
+		if err != nil {
+			return
+		}
+		agent.ServeAgent(agent.NewKeyring(), conn)
+		close(agentClosed)
+	}()
+
+	for name, value := range map[string]string{"HOME": home, "SSH_AUTH_SOCK": agentPath} {
+		old, ok := os.LookupEnv(name)
+		os.Setenv(name, value)
+		if ok {
+			defer os.Setenv(name, old)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+
+	l, err := net.Listen("unix", cs.socketPath)
+	c.Assert(err, IsNil)
+	srv := &httptest.Server{
+		Listener: l,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"type":"sync", "result":{"version":"1"}}`)
+		})},
+	}
+	srv.Start()
+	defer srv.Close()
+
+	cli, err := client.New(&client.Config{
+		SSH: &client.SSHConfig{
+			User:   "test",
+			Host:   addr,
+			Socket: cs.socketPath,
+		},
+	})
+	c.Assert(err, IsNil)
+	si, err := cli.SysInfo()
+	c.Assert(err, IsNil)
+	c.Check(si.Version, Equals, "1")
+
+	// The connection to ssh-agent isn't kept open after the handshake.
+	select {
+	case <-agentClosed:
+	case <-time.After(5 * time.Second):
+		c.Fatalf("connection to ssh-agent not closed")
+	}
+}
+
+func (cs *clientSuite) TestSSHRemoteSocketRefused(c *C) {
+	addr, hostKey, stop := startSSHServer(c)
+	defer stop()
+
+	cli, err := client.New(&client.Config{
+		SSH: &client.SSHConfig{
+			Host:   addr,
+			Socket: cs.socketPath,
+			ClientConfig: &ssh.ClientConfig{
+				User:            "test",
+				HostKeyCallback: ssh.FixedHostKey(hostKey),
+			},
+		},
+		RetryTimeout: -1,
+	})
+	c.Assert(err, IsNil)
+	err = cli.Do("GET", "/v1/system-info", nil, nil, nil)
+	c.Assert(err, ErrorMatches, `cannot communicate with server: .*connect failed.*`)
+	// Treated like a local socket that refuses connections, so retried.
+	c.Check(errors.Is(err, syscall.ECONNREFUSED), Equals, true)
+}
+
+func (cs *clientSuite) TestSSHHostKeyMismatch(c *C) {
+	addr, _, stop := startSSHServer(c)
+	defer stop()
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	c.Assert(err, IsNil)
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	c.Assert(err, IsNil)
+
+	cli, err := client.New(&client.Config{
+		SSH: &client.SSHConfig{
+			Host:   addr,
+			Socket: cs.socketPath,
+			ClientConfig: &ssh.ClientConfig{
+				User:            "test",
+				HostKeyCallback: ssh.FixedHostKey(otherSigner.PublicKey()),
+			},
+		},
+	})
+	c.Assert(err, IsNil)
+	_, err = cli.SysInfo()
+	c.Assert(err, ErrorMatches, `cannot obtain system details: cannot communicate with server: .*cannot connect to .* over SSH: .*host key mismatch`)
+}
+
+func (cs *clientSuite) TestParseSSHURL(c *C) {
+	for _, test := range []struct {
+		url    string
+		config *client.SSHConfig
+		err    string
+	}{{
+		url:    "ssh://host",
+		config: &client.SSHConfig{Host: "host:22", Socket: client.DefaultRemoteSocket},
+	}, {
+		url:    "ssh://bob@host:2222/run/pebble.socket",
+		config: &client.SSHConfig{User: "bob", Host: "host:2222", Socket: "/run/pebble.socket"},
+	}, {
+		url:    "ssh://[::1]:22/",
+		config: &client.SSHConfig{Host: "[::1]:22", Socket: client.DefaultRemoteSocket},
+	}, {
+		url:    "ssh://[::1]",
+		config: &client.SSHConfig{Host: "[::1]:22", Socket: client.DefaultRemoteSocket},
+	}, {
+		url:    "ssh://bob@[fe80::1%25eth0]:2222/run/pebble.socket",
+		config: &client.SSHConfig{User: "bob", Host: "[fe80::1%eth0]:2222", Socket: "/run/pebble.socket"},
+	}, {
+		url: "http://host",
+		err: `invalid SSH URL "http://host": scheme must be ssh`,
+	}, {
+		url: "ssh:///socket",
+		err: `invalid SSH URL "ssh:///socket": no host`,
+	}, {
+		url: "ssh://host?x=y",
+		err: `invalid SSH URL "ssh://host\?x=y": unexpected query or fragment`,
+	}} {
+		config, err := client.ParseSSHURL(test.url)
+		if test.err != "" {
+			c.Check(err, ErrorMatches, test.err, Commentf(test.url))
+			continue
+		}
+		c.Assert(err, IsNil, Commentf(test.url))
+		c.Check(config, DeepEquals, test.config, Commentf(test.url))
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+)
+
+type ExportStateOptions struct{}
+
+// ExportState fetches the daemon's state (changes, tasks, warnings, and
+// service status) as a JSON document suitable for passing to ImportState.
+func (client *Client) ExportState(opts *ExportStateOptions) (data []byte, err error) {
+	return client.ExportStateContext(context.Background(), opts)
+}
+
+// ExportStateContext is like ExportState, but uses ctx for the API requests so
+// that they can be cancelled.
+func (client *Client) ExportStateContext(ctx context.Context, _ *ExportStateOptions) (data []byte, err error) {
+	var doc json.RawMessage
+	_, err = client.doSync(ctx, "GET", "/v1/state", nil, nil, nil, &doc)
+	if err != nil {
+		return nil, client.featureError(ctx, err, "state")
+	}
+	return doc, nil
+}
+
+type ImportStateOptions struct {
+	// Data is the JSON document previously returned by ExportState.
+	Data []byte
+}
+
+// ImportState loads the state in opts.Data into the daemon. The daemon must
+// not have any changes yet.
+func (client *Client) ImportState(opts *ImportStateOptions) error {
+	return client.ImportStateContext(context.Background(), opts)
+}
+
+// ImportStateContext is like ImportState, but uses ctx for the API requests so
+// that they can be cancelled.
+func (client *Client) ImportStateContext(ctx context.Context, opts *ImportStateOptions) error {
+	_, err := client.doSync(ctx, "POST", "/v1/state", nil, nil, bytes.NewReader(opts.Data), nil)
+	return client.featureError(ctx, err, "state")
+}
@@ -16,6 +16,7 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/url"
 	"time"
@@ -49,12 +50,18 @@ type WarningsOptions struct {
 
 // Warnings returns the list of un-okayed warnings.
 func (client *Client) Warnings(opts WarningsOptions) ([]*Warning, error) {
+	return client.WarningsContext(context.Background(), opts)
+}
+
+// WarningsContext is like Warnings, but uses ctx for the API requests so that
+// they can be cancelled.
+func (client *Client) WarningsContext(ctx context.Context, opts WarningsOptions) ([]*Warning, error) {
 	var jws []*jsonWarning
 	q := make(url.Values)
 	if opts.All {
 		q.Add("select", "all")
 	}
-	_, err := client.doSync("GET", "/v1/warnings", q, nil, nil, &jws)
+	_, err := client.doSync(ctx, "GET", "/v1/warnings", q, nil, nil, &jws)
 
 	ws := make([]*Warning, len(jws))
 	for i, jw := range jws {
@@ -74,11 +81,17 @@ type warningsAction struct {
 // Okay asks pebble to chill about the warnings that would have been returned by
 // Warnings at the given time.
 func (client *Client) Okay(t time.Time) error {
+	return client.OkayContext(context.Background(), t)
+}
+
+// OkayContext is like Okay, but uses ctx for the API requests so that they can
+// be cancelled.
+func (client *Client) OkayContext(ctx context.Context, t time.Time) error {
 	var body bytes.Buffer
 	var op = warningsAction{Action: "okay", Timestamp: t}
 	if err := json.NewEncoder(&body).Encode(op); err != nil {
 		return err
 	}
-	_, err := client.doSync("POST", "/v1/warnings", nil, nil, &body, nil)
+	_, err := client.doSync(ctx, "POST", "/v1/warnings", nil, nil, &body, nil)
 	return err
 }
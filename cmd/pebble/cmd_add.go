@@ -25,7 +25,10 @@ import (
 
 type cmdAdd struct {
 	clientMixin
-	Combine    bool `long:"combine"`
+	Combine    bool   `long:"combine"`
+	Replace    bool   `long:"replace"`
+	Persist    bool   `long:"persist"`
+	Before     string `long:"before"`
 	Positional struct {
 		Label     string `positional-arg-name:"<label>" required:"1"`
 		LayerPath string `positional-arg-name:"<layer-path>" required:"1"`
@@ -34,6 +37,9 @@ type cmdAdd struct {
 
 var addDescs = map[string]string{
 	"combine": `Combine the new layer with an existing layer that has the given label (default is to append)`,
+	"replace": `Replace the contents of an existing layer that has the given label`,
+	"persist": `Save the new layer in the daemon's state and restore it when the daemon restarts`,
+	"before":  `Insert the new layer before the added layer with this label (default is to append)`,
 }
 
 var shortAddHelp = "Dynamically add a layer to the plan's layers"
@@ -41,19 +47,55 @@ var longAddHelp = `
 The add command reads the plan's layer YAML from the path specified and
 appends a layer with the given label to the plan's layers. If --combine
 is specified, combine the layer with an existing layer that has the given
-label (or append if the label is not found).
+label (or append if the label is not found). If --replace is specified,
+replace the contents of the existing layer that has the given label, keeping
+its position in the plan's layers.
+
+The layer is added to the running plan without restarting the daemon; use
+the replan command to apply the updated plan to running services. Layers added
+this way are only kept in memory, unless --persist is specified, in which case
+the layer is saved in the daemon's state and restored when it restarts.
+(Combining with or replacing an existing layer keeps whether that layer is
+persisted.) With --before, the new layer is inserted before another
+layer added with this command, rather than appended; use the move-layer
+command to reorder such layers later. This command is also available as
+"add-layer".
 `
 
 func (cmd *cmdAdd) Execute(args []string) error {
 	if len(args) > 0 {
 		return ErrExtraArgs
 	}
+	if cmd.Combine && cmd.Replace {
+		return fmt.Errorf("cannot use --combine and --replace together")
+	}
+	if cmd.Persist && cmd.Replace {
+		return fmt.Errorf("cannot use --persist and --replace together")
+	}
+	if cmd.Before != "" && (cmd.Combine || cmd.Replace) {
+		return fmt.Errorf("cannot use --before with --combine or --replace")
+	}
 	data, err := ioutil.ReadFile(cmd.Positional.LayerPath)
 	if err != nil {
 		return err
 	}
+	if cmd.Replace {
+		opts := client.ReplaceLayerOptions{
+			Label:     cmd.Positional.Label,
+			LayerData: data,
+		}
+		err = cmd.client.ReplaceLayer(&opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(Stdout, "Layer %q replaced successfully from %q\n",
+			cmd.Positional.Label, cmd.Positional.LayerPath)
+		return nil
+	}
 	opts := client.AddLayerOptions{
 		Combine:   cmd.Combine,
+		Persist:   cmd.Persist,
+		Before:    cmd.Before,
 		Label:     cmd.Positional.Label,
 		LayerData: data,
 	}
@@ -67,5 +109,6 @@ func (cmd *cmdAdd) Execute(args []string) error {
 }
 
 func init() {
-	addCommand("add", shortAddHelp, longAddHelp, func() flags.Commander { return &cmdAdd{} }, addDescs, nil)
+	cmd := addCommand("add", shortAddHelp, longAddHelp, func() flags.Commander { return &cmdAdd{} }, addDescs, nil)
+	cmd.alias = "add-layer"
 }
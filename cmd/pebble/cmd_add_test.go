@@ -79,3 +79,115 @@ services:
 		s.ResetStdStreams()
 	}
 }
+
+func (s *PebbleSuite) TestAddLayerAlias(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/layers")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": true
+}`)
+	})
+
+	layerPath := filepath.Join(c.MkDir(), "layer.yaml")
+	err := ioutil.WriteFile(layerPath, []byte("services: {}\n"), 0644)
+	c.Assert(err, check.IsNil)
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"add-layer", "foo", layerPath})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Matches, `Layer "foo" added successfully.*\n`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestAddReplace(c *check.C) {
+	layerYAML := "services: {}\n"
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/layers")
+		assertBodyEquals(c, r.Body, map[string]interface{}{
+			"action": "replace",
+			"label":  "foo",
+			"format": "yaml",
+			"layer":  layerYAML,
+		})
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": true
+}`)
+	})
+
+	layerPath := filepath.Join(c.MkDir(), "layer.yaml")
+	err := ioutil.WriteFile(layerPath, []byte(layerYAML), 0644)
+	c.Assert(err, check.IsNil)
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"add", "--replace", "foo", layerPath})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Matches, `Layer "foo" replaced successfully.*\n`)
+	c.Check(s.Stderr(), check.Equals, "")
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"add", "--replace", "--combine", "foo", layerPath})
+	c.Assert(err, check.ErrorMatches, "cannot use --combine and --replace together")
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"add", "--replace", "--persist", "foo", layerPath})
+	c.Assert(err, check.ErrorMatches, "cannot use --persist and --replace together")
+}
+
+func (s *PebbleSuite) TestAddPersist(c *check.C) {
+	layerYAML := "services: {}\n"
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/layers")
+		assertBodyEquals(c, r.Body, map[string]interface{}{
+			"action":  "add",
+			"combine": false,
+			"persist": true,
+			"label":   "debug",
+			"format":  "yaml",
+			"layer":   layerYAML,
+		})
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": true}`)
+	})
+
+	layerPath := filepath.Join(c.MkDir(), "layer.yaml")
+	err := ioutil.WriteFile(layerPath, []byte(layerYAML), 0644)
+	c.Assert(err, check.IsNil)
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"add", "--persist", "debug", layerPath})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Matches, `Layer "debug" added successfully.*\n`)
+}
+
+func (s *PebbleSuite) TestAddBefore(c *check.C) {
+	layerYAML := "services: {}\n"
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/layers")
+		assertBodyEquals(c, r.Body, map[string]interface{}{
+			"action":  "add",
+			"combine": false,
+			"before":  "bar",
+			"label":   "foo",
+			"format":  "yaml",
+			"layer":   layerYAML,
+		})
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": true}`)
+	})
+
+	layerPath := filepath.Join(c.MkDir(), "layer.yaml")
+	err := ioutil.WriteFile(layerPath, []byte(layerYAML), 0644)
+	c.Assert(err, check.IsNil)
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"add", "--before", "bar", "foo", layerPath})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Matches, `Layer "foo" added successfully.*\n`)
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"add", "--combine", "--before", "bar", "foo", layerPath})
+	c.Assert(err, check.ErrorMatches, "cannot use --before with --combine or --replace")
+}
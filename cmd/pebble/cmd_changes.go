@@ -15,9 +15,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"regexp"
 	"sort"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 
@@ -28,32 +34,144 @@ var shortChangesHelp = "List system changes"
 var shortTasksHelp = "List a change's tasks"
 var longChangesHelp = `
 The changes command displays a summary of system changes performed recently.
+
+With --format=json or --format=yaml, a list of changes is written, each with
+the fields "id", "kind", "summary", "status", "ready", "err" (if the change
+failed), "spawn-time" and "ready-time" (if the change is ready).
+
+With --follow, the list is kept up to date as changes progress, until Ctrl-C
+is pressed.
 `
 var longTasksHelp = `
 The tasks command displays a summary of tasks associated with an individual
-change that happened recently.
+change that happened recently. This command is also available as "change".
+
+With --format=json or --format=yaml, the change is written with the same
+fields as in the changes command, plus "tasks": a list of tasks, each with the
+fields "id", "kind", "summary", "status", "log" (if not empty), "progress"
+("label", "done" and "total"), "spawn-time", "start-time" (if the task has
+started), "ready-time" (if the task is ready), and "doing-time" and
+"undoing-time" (if the task has run, as durations like "1.5s").
+
+With --timings, the tasks are listed with how long each waited before it
+started, and how long it spent doing and undoing its work, to show where a
+slow change spent its time.
+
+With --follow, the tasks are kept up to date as they progress, until the
+change is ready.
 `
 
+// changeOutput is the structured output for a change.
+type changeOutput struct {
+	ID        string       `json:"id" yaml:"id"`
+	Kind      string       `json:"kind" yaml:"kind"`
+	Summary   string       `json:"summary" yaml:"summary"`
+	Status    string       `json:"status" yaml:"status"`
+	Ready     bool         `json:"ready" yaml:"ready"`
+	Err       string       `json:"err,omitempty" yaml:"err,omitempty"`
+	SpawnTime *time.Time   `json:"spawn-time,omitempty" yaml:"spawn-time,omitempty"`
+	ReadyTime *time.Time   `json:"ready-time,omitempty" yaml:"ready-time,omitempty"`
+	Tasks     []taskOutput `json:"tasks,omitempty" yaml:"tasks,omitempty"`
+}
+
+// taskOutput is the structured output for a task of a change.
+type taskOutput struct {
+	ID        string             `json:"id" yaml:"id"`
+	Kind      string             `json:"kind" yaml:"kind"`
+	Summary   string             `json:"summary" yaml:"summary"`
+	Status    string             `json:"status" yaml:"status"`
+	Log       []string           `json:"log,omitempty" yaml:"log,omitempty"`
+	Progress  taskProgressOutput `json:"progress" yaml:"progress"`
+	SpawnTime *time.Time         `json:"spawn-time,omitempty" yaml:"spawn-time,omitempty"`
+	StartTime *time.Time         `json:"start-time,omitempty" yaml:"start-time,omitempty"`
+	ReadyTime *time.Time         `json:"ready-time,omitempty" yaml:"ready-time,omitempty"`
+
+	DoingTime   string `json:"doing-time,omitempty" yaml:"doing-time,omitempty"`
+	UndoingTime string `json:"undoing-time,omitempty" yaml:"undoing-time,omitempty"`
+}
+
+type taskProgressOutput struct {
+	Label string `json:"label" yaml:"label"`
+	Done  int    `json:"done" yaml:"done"`
+	Total int    `json:"total" yaml:"total"`
+}
+
+func newChangeOutput(chg *client.Change) changeOutput {
+	return changeOutput{
+		ID:        chg.ID,
+		Kind:      chg.Kind,
+		Summary:   chg.Summary,
+		Status:    chg.Status,
+		Ready:     chg.Ready,
+		Err:       chg.Err,
+		SpawnTime: optionalTime(chg.SpawnTime),
+		ReadyTime: optionalTime(chg.ReadyTime),
+	}
+}
+
+func newTaskOutputs(tasks []*client.Task) []taskOutput {
+	var outputs []taskOutput
+	for _, t := range tasks {
+		outputs = append(outputs, taskOutput{
+			ID:      t.ID,
+			Kind:    t.Kind,
+			Summary: t.Summary,
+			Status:  t.Status,
+			Log:     t.Log,
+			Progress: taskProgressOutput{
+				Label: t.Progress.Label,
+				Done:  t.Progress.Done,
+				Total: t.Progress.Total,
+			},
+			SpawnTime: optionalTime(t.SpawnTime),
+			StartTime: optionalTime(t.StartTime),
+			ReadyTime: optionalTime(t.ReadyTime),
+
+			DoingTime:   optionalDuration(t.DoingTime),
+			UndoingTime: optionalDuration(t.UndoingTime),
+		})
+	}
+	return outputs
+}
+
 type cmdChanges struct {
 	clientMixin
 	timeMixin
+	formatMixin
+	pagerMixin
+	Follow     bool `long:"follow"`
 	Positional struct {
-		Service string `positional-arg-name:"<service>"`
+		Service serviceName `positional-arg-name:"<service>"`
 	} `positional-args:"yes"`
 }
 
 type cmdTasks struct {
 	timeMixin
+	formatMixin
+	pagerMixin
 	changeIDMixin
+	Follow  bool `long:"follow"`
+	Timings bool `long:"timings"`
+}
+
+var changesDescs = map[string]string{
+	"follow": "Keep the list up to date as changes progress, until Ctrl-C is pressed",
+}
+
+var tasksDescs = map[string]string{
+	"follow":  "Keep the list up to date as tasks progress, until the change is ready",
+	"timings": "Show how long each task waited, and spent doing and undoing its work",
 }
 
 func init() {
 	addCommand("changes", shortChangesHelp, longChangesHelp,
-		func() flags.Commander { return &cmdChanges{} }, timeDescs, nil)
-	addCommand("tasks", shortTasksHelp, longTasksHelp,
+		func() flags.Commander { return &cmdChanges{} },
+		merge(changesDescs, timeDescs, formatDescs, pagerDescs), nil)
+	cmd := addCommand("tasks", shortTasksHelp, longTasksHelp,
 		func() flags.Commander { return &cmdTasks{} },
-		merge(changeIDMixinOptDesc, timeDescs),
+		merge(tasksDescs, changeIDMixinOptDesc, timeDescs, formatDescs, pagerDescs),
 		changeIDMixinArgDesc)
+	cmd.alias = "change"
 }
 
 type changesByTime []*client.Change
@@ -80,7 +198,7 @@ func (c *cmdChanges) Execute(args []string) error {
 		return ErrExtraArgs
 	}
 
-	if allDigits(c.Positional.Service) {
+	if allDigits(string(c.Positional.Service)) {
 		return fmt.Errorf(`'pebble changes' command expects a service name, try 'pebble tasks %s'`, c.Positional.Service)
 	}
 
@@ -90,37 +208,91 @@ func (c *cmdChanges) Execute(args []string) error {
 	}
 
 	opts := client.ChangesOptions{
-		ServiceName: c.Positional.Service,
+		ServiceName: string(c.Positional.Service),
 		Selector:    client.ChangesAll,
 	}
 
+	if c.Follow {
+		if c.structured() {
+			return fmt.Errorf("cannot use --follow with --format=%s", c.format())
+		}
+		return c.follow(&opts)
+	}
+
+	stop := c.startPager()
+	defer stop()
+
 	changes, err := queryChanges(c.client, &opts)
 	if err != nil {
 		return err
 	}
 
+	sort.Sort(changesByTime(changes))
+
+	if c.structured() {
+		output := make([]changeOutput, len(changes))
+		for i, chg := range changes {
+			output[i] = newChangeOutput(chg)
+		}
+		return c.writeStructured(output)
+	}
+
 	if len(changes) == 0 {
 		return fmt.Errorf("no changes found")
 	}
 
-	sort.Sort(changesByTime(changes))
+	c.writeChanges(Stdout, changes)
+	return nil
+}
 
-	w := tabWriter()
+func (c *cmdChanges) writeChanges(out io.Writer, changes []*client.Change) {
+	w := tabWriterTo(out)
 
-	fmt.Fprintf(w, "ID\tStatus\tSpawn\tReady\tSummary\n")
+	// The heading is padded like the colored statuses to keep them aligned.
+	esc := colorEscapes()
+	fmt.Fprintf(w, "ID\t%s\tSpawn\tReady\tSummary\n", esc.colored(esc.plain, "Status"))
 	for _, chg := range changes {
 		spawnTime := c.fmtTime(chg.SpawnTime)
 		readyTime := c.fmtTime(chg.ReadyTime)
 		if chg.ReadyTime.IsZero() {
 			readyTime = "-"
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", chg.ID, chg.Status, spawnTime, readyTime, chg.Summary)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", chg.ID, esc.changeStatus(chg.Status), spawnTime, readyTime, chg.Summary)
 	}
 
 	w.Flush()
-	fmt.Fprintln(Stdout)
+	fmt.Fprintln(out)
+}
 
-	return nil
+// follow shows the changes and redraws them whenever a change's status
+// changes, until Ctrl-C is pressed.
+func (c *cmdChanges) follow(opts *client.ChangesOptions) error {
+	view := &liveView{}
+	update := func() error {
+		changes, err := c.client.Changes(opts)
+		if err != nil {
+			return err
+		}
+		sort.Sort(changesByTime(changes))
+		var buf bytes.Buffer
+		if len(changes) == 0 {
+			fmt.Fprintln(&buf, "No changes yet, waiting for changes...")
+		} else {
+			c.writeChanges(&buf, changes)
+		}
+		view.update(buf.Bytes())
+		return nil
+	}
+
+	// Stop following when Ctrl-C pressed (SIGINT).
+	ctx := notifyContext(context.Background(), os.Interrupt)
+	return c.client.Events(ctx, &client.EventsOptions{
+		Types:     []string{client.EventChangeStatus},
+		Connected: update,
+		HandleEvent: func(client.Event) error {
+			return update()
+		},
+	})
 }
 
 func (c *cmdTasks) Execute([]string) error {
@@ -132,6 +304,19 @@ func (c *cmdTasks) Execute([]string) error {
 		return err
 	}
 
+	if c.Follow {
+		if c.structured() {
+			return fmt.Errorf("cannot use --follow with --format=%s", c.format())
+		}
+		if c.Timings {
+			return fmt.Errorf("cannot use --follow with --timings")
+		}
+		return c.follow(chid)
+	}
+
+	stop := c.startPager()
+	defer stop()
+
 	return c.showChange(chid)
 }
 
@@ -152,9 +337,54 @@ func (c *cmdTasks) showChange(chid string) error {
 		return err
 	}
 
-	w := tabWriter()
+	if c.structured() {
+		output := newChangeOutput(chg)
+		output.Tasks = newTaskOutputs(chg.Tasks)
+		return c.writeStructured(output)
+	}
+
+	if c.Timings {
+		c.writeTimings(Stdout, chg)
+		return nil
+	}
+	c.writeChange(Stdout, chg)
+	return nil
+}
+
+// writeTimings writes the change's tasks with how long each waited to start,
+// and how long its handlers ran for.
+func (c *cmdTasks) writeTimings(out io.Writer, chg *client.Change) {
+	w := tabWriterTo(out)
+
+	esc := colorEscapes()
+	fmt.Fprintf(w, "ID\t%s\tWait\tDoing\tUndoing\tSummary\n", esc.colored(esc.plain, "Status"))
+	for _, t := range chg.Tasks {
+		wait := "-"
+		if !t.StartTime.IsZero() {
+			wait = fmtTiming(t.StartTime.Sub(t.SpawnTime))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, esc.changeStatus(t.Status), wait,
+			fmtTiming(t.DoingTime), fmtTiming(t.UndoingTime), t.Summary)
+	}
+	w.Flush()
+}
+
+// fmtTiming formats a task timing, rounded to keep the columns narrow.
+func fmtTiming(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return "-"
+	case d < time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func (c *cmdTasks) writeChange(out io.Writer, chg *client.Change) {
+	w := tabWriterTo(out)
 
-	fmt.Fprintf(w, "Status\tSpawn\tReady\tSummary\n")
+	esc := colorEscapes()
+	fmt.Fprintf(w, "%s\tSpawn\tReady\tSummary\n", esc.colored(esc.plain, "Status"))
 	for _, t := range chg.Tasks {
 		spawnTime := c.fmtTime(t.SpawnTime)
 		readyTime := c.fmtTime(t.ReadyTime)
@@ -165,7 +395,7 @@ func (c *cmdTasks) showChange(chid string) error {
 		if t.Status == "Doing" && t.Progress.Total > 1 {
 			summary = fmt.Sprintf("%s (%.2f%%)", summary, float64(t.Progress.Done)/float64(t.Progress.Total)*100.0)
 		}
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Status, spawnTime, readyTime, summary)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", esc.changeStatus(t.Status), spawnTime, readyTime, summary)
 	}
 
 	w.Flush()
@@ -174,18 +404,70 @@ func (c *cmdTasks) showChange(chid string) error {
 		if len(t.Log) == 0 {
 			continue
 		}
-		fmt.Fprintln(Stdout)
-		fmt.Fprintln(Stdout, line)
-		fmt.Fprintln(Stdout, t.Summary)
-		fmt.Fprintln(Stdout)
+		fmt.Fprintln(out)
+		fmt.Fprintln(out, line)
+		fmt.Fprintln(out, t.Summary)
+		fmt.Fprintln(out)
 		for _, line := range t.Log {
-			fmt.Fprintln(Stdout, line)
+			fmt.Fprintln(out, line)
 		}
 	}
 
-	fmt.Fprintln(Stdout)
+	fmt.Fprintln(out)
+}
 
-	return nil
+// errChangeReady stops following a change once it's ready.
+var errChangeReady = errors.New("change ready")
+
+// follow shows the change's tasks and redraws them as they progress, until
+// the change is ready.
+func (c *cmdTasks) follow(chid string) error {
+	view := &liveView{}
+	update := func() error {
+		chg, err := c.client.Change(chid)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		c.writeChange(&buf, chg)
+		view.update(buf.Bytes())
+		if chg.Ready {
+			return errChangeReady
+		}
+		return nil
+	}
+
+	// Stop following when Ctrl-C pressed (SIGINT).
+	ctx := notifyContext(context.Background(), os.Interrupt)
+	err := c.client.Events(ctx, &client.EventsOptions{
+		Types:     []string{client.EventChangeStatus, client.EventTaskStatus, client.EventTaskProgress},
+		ChangeID:  chid,
+		Connected: update,
+		HandleEvent: func(client.Event) error {
+			return update()
+		},
+	})
+	if err == errChangeReady {
+		return nil
+	}
+	return err
+}
+
+// liveView writes successive versions of some output. On a terminal each
+// version replaces the previous one in place; otherwise they're written one
+// after the other.
+type liveView struct {
+	lines int
+}
+
+func (v *liveView) update(output []byte) {
+	if v.lines > 0 && isStdoutTTY {
+		// Move the cursor up to the start of the previous output and clear
+		// from there to the end of the screen.
+		fmt.Fprintf(Stdout, "\033[%dA\033[J", v.lines)
+	}
+	Stdout.Write(output)
+	v.lines = bytes.Count(output, []byte("\n"))
 }
 
 const line = "......................................................................"
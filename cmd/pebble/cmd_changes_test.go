@@ -24,6 +24,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/gorilla/websocket"
 	"gopkg.in/check.v1"
 
 	pebble "github.com/canonical/pebble/cmd/pebble"
@@ -63,6 +64,21 @@ Do +2016-04-21T01:02:03Z +2016-04-21T01:02:04Z +some summary
 	c.Check(s.Stderr(), check.Equals, "")
 }
 
+func (s *PebbleSuite) TestChangeAlias(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/changes/42")
+		fmt.Fprintln(w, fakeChangeJSON)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"change", "--abs-time", "42"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Matches, `(?ms)Status +Spawn +Ready +Summary
+Do +2016-04-21T01:02:03Z +2016-04-21T01:02:04Z +some summary
+`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
 func (s *PebbleSuite) TestChangeSimpleRebooting(c *check.C) {
 	n := 0
 	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
@@ -225,3 +241,207 @@ Doing +2016-04-21T01:02:03Z +2016-04-21T01:02:04Z +some summary \(50.00%\)
 `)
 	c.Check(s.Stderr(), check.Equals, "")
 }
+
+func (s *PebbleSuite) TestChangesFormat(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/changes")
+		fmt.Fprintln(w, `{"type": "sync", "result": [
+  {
+    "id": "two",
+    "kind": "start",
+    "summary": "Start service \"svc2\"",
+    "status": "Doing",
+    "ready": false,
+    "spawn-time": "2016-04-21T01:02:03Z"
+  },
+  {
+    "id": "one",
+    "kind": "stop",
+    "summary": "Stop service \"svc1\"",
+    "status": "Error",
+    "ready": true,
+    "err": "cannot stop",
+    "spawn-time": "2016-03-21T01:02:03Z",
+    "ready-time": "2016-03-21T01:02:04Z",
+    "tasks": [{"kind": "stop", "summary": "some summary", "status": "Error", "progress": {"done": 1, "total": 1}, "spawn-time": "2016-03-21T01:02:03Z"}]
+  }
+]}`)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"changes", "--format", "yaml"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+- id: one
+  kind: stop
+  summary: Stop service "svc1"
+  status: Error
+  ready: true
+  err: cannot stop
+  spawn-time: 2016-03-21T01:02:03Z
+  ready-time: 2016-03-21T01:02:04Z
+- id: two
+  kind: start
+  summary: Start service "svc2"
+  status: Doing
+  ready: false
+  spawn-time: 2016-04-21T01:02:03Z
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestChangesFormatNoChanges(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"changes", "--format", "json"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "[]\n")
+}
+
+func (s *PebbleSuite) TestTasksFormat(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/changes/42")
+		fmt.Fprintln(w, fakeChangeJSON)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"tasks", "--format", "json", "42"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+{
+    "id": "uno",
+    "kind": "foo",
+    "summary": "...",
+    "status": "Do",
+    "ready": false,
+    "spawn-time": "2016-04-21T01:02:03Z",
+    "ready-time": "2016-04-21T01:02:04Z",
+    "tasks": [
+        {
+            "id": "",
+            "kind": "bar",
+            "summary": "some summary",
+            "status": "Do",
+            "progress": {
+                "label": "",
+                "done": 0,
+                "total": 1
+            },
+            "spawn-time": "2016-04-21T01:02:03Z",
+            "ready-time": "2016-04-21T01:02:04Z"
+        }
+    ]
+}
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestTasksTimings(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/changes/42")
+		fmt.Fprintln(w, `{"type": "sync", "result": {
+  "id": "42",
+  "kind": "start",
+  "summary": "...",
+  "status": "Error",
+  "ready": true,
+  "spawn-time": "2016-04-21T01:02:03Z",
+  "ready-time": "2016-04-21T01:02:06Z",
+  "tasks": [
+    {"id": "1", "kind": "start", "summary": "Start service \"foo\"", "status": "Undone", "progress": {"done": 1, "total": 1}, "spawn-time": "2016-04-21T01:02:03Z", "start-time": "2016-04-21T01:02:03.0002Z", "ready-time": "2016-04-21T01:02:06Z", "doing-time": "1.2345s", "undoing-time": "350.2ms"},
+    {"id": "2", "kind": "start", "summary": "Start service \"bar\"", "status": "Error", "progress": {"done": 1, "total": 1}, "spawn-time": "2016-04-21T01:02:03Z", "start-time": "2016-04-21T01:02:04.5Z", "ready-time": "2016-04-21T01:02:06Z", "doing-time": "1.5s"},
+    {"id": "3", "kind": "start", "summary": "Start service \"baz\"", "status": "Hold", "progress": {"done": 1, "total": 1}, "spawn-time": "2016-04-21T01:02:03Z", "ready-time": "2016-04-21T01:02:06Z"}
+  ]
+}}`)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"tasks", "--timings", "42"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+ID   Status  Wait   Doing   Undoing  Summary
+1    Undone  200µs  1.235s  350ms    Start service "foo"
+2    Error   1.5s   1.5s    -        Start service "bar"
+3    Hold    -      -       -        Start service "baz"
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"tasks", "--timings", "--follow", "42"})
+	c.Assert(err, check.ErrorMatches, "cannot use --follow with --timings")
+}
+
+func (s *PebbleSuite) TestTasksFollow(c *check.C) {
+	restore := pebble.FakeIsStdoutTTY(true)
+	defer restore()
+
+	n := 0
+	upgrader := websocket.Upgrader{}
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/events":
+			c.Check(r.URL.Query().Get("change-id"), check.Equals, "42")
+			c.Check(r.URL.Query().Get("types"), check.Equals, "change-status,task-status,task-progress")
+			conn, err := upgrader.Upgrade(w, r, nil)
+			c.Assert(err, check.IsNil)
+			defer conn.Close()
+			err = conn.WriteJSON(map[string]string{"type": "change-status", "change-id": "42", "status": "Done"})
+			c.Check(err, check.IsNil)
+			// Wait for the client to hang up.
+			conn.NextReader()
+		case "/v1/changes/42":
+			n++
+			if n > 1 {
+				fmt.Fprintln(w, strings.Replace(strings.Replace(fakeChangeJSON, `"Do"`, `"Done"`, -1), `"ready": false`, `"ready": true`, 1))
+			} else {
+				fmt.Fprintln(w, fakeChangeJSON)
+			}
+		default:
+			c.Fatalf("unexpected path %q", r.URL.Path)
+		}
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"tasks", "--abs-time", "--follow", "--color=never", "42"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.DeepEquals, []string{})
+	c.Check(s.Stdout(), check.Equals, ""+
+		"Status  Spawn                 Ready                 Summary\n"+
+		"Do      2016-04-21T01:02:03Z  2016-04-21T01:02:04Z  some summary\n"+
+		"\n"+
+		"\x1b[3A\x1b[J"+
+		"Status  Spawn                 Ready                 Summary\n"+
+		"Done    2016-04-21T01:02:03Z  2016-04-21T01:02:04Z  some summary\n"+
+		"\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestChangesFollow(c *check.C) {
+	upgrader := websocket.Upgrader{}
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/events":
+			c.Check(r.URL.Query().Get("types"), check.Equals, "change-status")
+			conn, err := upgrader.Upgrade(w, r, nil)
+			c.Assert(err, check.IsNil)
+			defer conn.Close()
+			err = conn.WriteJSON(map[string]string{"type": "change-status", "change-id": "1", "status": "Done"})
+			c.Check(err, check.IsNil)
+			// Closing the stream normally stops following.
+			msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			conn.WriteMessage(websocket.CloseMessage, msg)
+		case "/v1/changes":
+			fmt.Fprintln(w, `{"type": "sync", "result": []}`)
+		default:
+			c.Fatalf("unexpected path %q", r.URL.Path)
+		}
+	})
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"changes", "--follow"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, ""+
+		"No changes yet, waiting for changes...\n"+
+		"No changes yet, waiting for changes...\n")
+
+	s.ResetStdStreams()
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"changes", "--follow", "--format", "json"})
+	c.Assert(err, check.ErrorMatches, "cannot use --follow with --format=json")
+}
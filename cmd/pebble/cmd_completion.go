@@ -0,0 +1,186 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+var shortCompletionHelp = "Generate a shell completion script"
+var longCompletionHelp = `
+The completion command prints a script that enables tab completion of pebble
+commands, options and arguments for the given shell (bash, zsh or fish).
+Service names and change IDs are completed by querying the daemon, when it is
+reachable.
+
+For example, to enable completion in the current bash session:
+
+    source <(pebble completion bash)
+`
+
+type cmdCompletion struct {
+	Positional struct {
+		Shell completionShell `positional-arg-name:"<shell>" required:"1"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommand("completion", shortCompletionHelp, longCompletionHelp, func() flags.Commander { return &cmdCompletion{} }, nil, []argDesc{{
+		name: "<shell>",
+		desc: "Shell to generate the script for (bash, zsh or fish)",
+	}})
+}
+
+// The completion scripts run pebble with GO_FLAGS_COMPLETION set, which
+// makes the go-flags parser print the candidates for the last argument
+// instead of running the command.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for pebble
+
+_pebble() {
+    local IFS=$'\n'
+    COMPREPLY=($(GO_FLAGS_COMPLETION=1 "${COMP_WORDS[0]}" "${COMP_WORDS[@]:1:$COMP_CWORD}" 2>/dev/null))
+    return 0
+}
+
+complete -o default -F _pebble pebble
+`,
+	"zsh": `#compdef pebble
+# zsh completion for pebble
+
+_pebble() {
+    local -a candidates
+    candidates=("${(@f)$(GO_FLAGS_COMPLETION=1 "${words[1]}" "${(@)words[2,$CURRENT]}" 2>/dev/null)}")
+    compadd -a candidates
+}
+
+compdef _pebble pebble
+`,
+	"fish": `# fish completion for pebble
+
+function __pebble_complete
+    set -l args (commandline -opc) (commandline -ct)
+    GO_FLAGS_COMPLETION=1 $args[1] $args[2..-1] 2>/dev/null
+end
+
+complete -c pebble -f -a '(__pebble_complete)'
+`,
+}
+
+func (cmd *cmdCompletion) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	script, ok := completionScripts[string(cmd.Positional.Shell)]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q, must be one of: %s",
+			cmd.Positional.Shell, strings.Join(completionShells(), ", "))
+	}
+	fmt.Fprint(Stdout, script)
+	return nil
+}
+
+func completionShells() []string {
+	shells := make([]string, 0, len(completionScripts))
+	for shell := range completionScripts {
+		shells = append(shells, shell)
+	}
+	sort.Strings(shells)
+	return shells
+}
+
+type completionShell string
+
+func (s *completionShell) Complete(match string) []flags.Completion {
+	var ret []flags.Completion
+	for _, shell := range completionShells() {
+		if strings.HasPrefix(shell, match) {
+			ret = append(ret, flags.Completion{Item: shell})
+		}
+	}
+	return ret
+}
+
+// completionClient returns a client for completing arguments from the
+// daemon's state, or nil if it can't be created.
+func completionClient() *client.Client {
+	cli, err := client.New(&clientConfig)
+	if err != nil {
+		return nil
+	}
+	return cli
+}
+
+// serviceName is a service name argument that is completed with the names
+// of the services in the daemon's plan.
+type serviceName string
+
+func (s *serviceName) Complete(match string) []flags.Completion {
+	cli := completionClient()
+	if cli == nil {
+		return nil
+	}
+	services, err := cli.Services(&client.ServicesOptions{})
+	if err != nil {
+		return nil
+	}
+	var ret []flags.Completion
+	for _, service := range services {
+		if strings.HasPrefix(service.Name, match) {
+			ret = append(ret, flags.Completion{Item: service.Name})
+		}
+	}
+	return ret
+}
+
+// serviceNames converts service name arguments to plain strings.
+func serviceNames(names []serviceName) []string {
+	if names == nil {
+		return nil
+	}
+	strs := make([]string, len(names))
+	for i, name := range names {
+		strs[i] = string(name)
+	}
+	return strs
+}
+
+// changeID is a change ID argument that is completed with the IDs of the
+// daemon's changes.
+type changeID string
+
+func (id *changeID) Complete(match string) []flags.Completion {
+	cli := completionClient()
+	if cli == nil {
+		return nil
+	}
+	changes, err := cli.Changes(&client.ChangesOptions{Selector: client.ChangesAll})
+	if err != nil {
+		return nil
+	}
+	var ret []flags.Completion
+	for _, change := range changes {
+		if strings.HasPrefix(change.ID, match) {
+			ret = append(ret, flags.Completion{Item: change.ID, Description: change.Summary})
+		}
+	}
+	return ret
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/jessevdk/go-flags"
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) TestCompletionScripts(c *check.C) {
+	for shell, expected := range map[string]string{
+		"bash": "complete -o default -F _pebble pebble\n",
+		"zsh":  "compdef _pebble pebble\n",
+		"fish": "complete -c pebble -f -a '(__pebble_complete)'\n",
+	} {
+		s.ResetStdStreams()
+		rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"completion", shell})
+		c.Assert(err, check.IsNil)
+		c.Assert(rest, check.HasLen, 0)
+		c.Check(s.Stdout(), check.Matches, "(?s).*GO_FLAGS_COMPLETION=1.*")
+		c.Check(s.Stdout()[len(s.Stdout())-len(expected):], check.Equals, expected)
+		c.Check(s.Stderr(), check.Equals, "")
+	}
+}
+
+func (s *PebbleSuite) TestCompletionUnknownShell(c *check.C) {
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"completion", "csh"})
+	c.Assert(err, check.ErrorMatches, `unsupported shell "csh", must be one of: bash, fish, zsh`)
+}
+
+// complete returns the completions the parser produces for args.
+func complete(c *check.C, args ...string) []flags.Completion {
+	os.Setenv("GO_FLAGS_COMPLETION", "1")
+	defer os.Unsetenv("GO_FLAGS_COMPLETION")
+
+	var items []flags.Completion
+	parser := pebble.Parser(pebble.Client())
+	parser.CompletionHandler = func(completions []flags.Completion) {
+		items = completions
+	}
+	_, err := parser.ParseArgs(args)
+	c.Assert(err, check.IsNil)
+	return items
+}
+
+func (s *PebbleSuite) TestCompleteCommands(c *check.C) {
+	items := complete(c, "compl")
+	c.Check(items, check.DeepEquals, []flags.Completion{{Item: "completion", Description: "Generate a shell completion script"}})
+
+	items = complete(c, "completion", "")
+	c.Check(items, check.DeepEquals, []flags.Completion{{Item: "bash"}, {Item: "fish"}, {Item: "zsh"}})
+}
+
+func (s *PebbleSuite) TestCompleteServiceNames(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/services")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+		{"name": "svc1", "current": "inactive", "startup": "enabled"},
+		{"name": "svc2", "current": "active", "startup": "enabled"},
+		{"name": "other", "current": "active", "startup": "enabled"}
+	]
+}`)
+	})
+	items := complete(c, "start", "sv")
+	c.Check(items, check.DeepEquals, []flags.Completion{{Item: "svc1"}, {Item: "svc2"}})
+
+	items = complete(c, "logs", "svc1", "o")
+	c.Check(items, check.DeepEquals, []flags.Completion{{Item: "other"}})
+}
+
+func (s *PebbleSuite) TestCompleteChangeIDs(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/changes")
+		c.Check(r.URL.Query().Get("select"), check.Equals, "all")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+		{"id": "1", "kind": "start", "summary": "Start service \"svc1\"", "status": "Done"},
+		{"id": "12", "kind": "stop", "summary": "Stop service \"svc1\"", "status": "Done"},
+		{"id": "2", "kind": "start", "summary": "Start service \"svc2\"", "status": "Doing"}
+	]
+}`)
+	})
+	items := complete(c, "tasks", "1")
+	c.Check(items, check.DeepEquals, []flags.Completion{
+		{Item: "1", Description: `Start service "svc1"`},
+		{Item: "12", Description: `Stop service "svc1"`},
+	})
+}
+
+func (s *PebbleSuite) TestCompleteDaemonUnreachable(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	})
+	items := complete(c, "stop", "")
+	c.Check(items, check.HasLen, 0)
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+type cmdDebugAPI struct {
+	clientMixin
+	Method     string   `short:"X" long:"method" value-name:"<method>"`
+	Data       string   `short:"d" long:"data" value-name:"<data>"`
+	Headers    []string `short:"H" long:"header" value-name:"<header>"`
+	Fail       bool     `long:"fail"`
+	Positional struct {
+		Path string `positional-arg-name:"<path>" required:"1"`
+	} `positional-args:"yes"`
+}
+
+var shortDebugAPIHelp = "Send a raw request to the API"
+var longDebugAPIHelp = `
+The api command sends a request to the given API path, such as
+"/v1/services?names=foo", and writes the response body, pretty-printing it if
+it is JSON. The method is GET, or POST if --data is given.
+
+With --data=-, the request body is read from standard input.
+`
+
+func (cmd *cmdDebugAPI) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	u, err := url.Parse(cmd.Positional.Path)
+	if err != nil || !strings.HasPrefix(u.Path, "/") || u.Scheme != "" || u.Host != "" {
+		return fmt.Errorf("API path must start with '/', not %q", cmd.Positional.Path)
+	}
+
+	opts := client.DebugRequestOptions{
+		Method:  cmd.Method,
+		Path:    u.Path,
+		Query:   u.Query(),
+		Headers: make(map[string]string),
+	}
+	for _, header := range cmd.Headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return fmt.Errorf("header must be in the form \"Name: value\", not %q", header)
+		}
+		opts.Headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	if cmd.Data != "" {
+		if cmd.Data == "-" {
+			opts.Body = Stdin
+		} else {
+			opts.Body = strings.NewReader(cmd.Data)
+		}
+		if opts.Method == "" {
+			opts.Method = "POST"
+		}
+		if _, ok := opts.Headers["Content-Type"]; !ok {
+			opts.Headers["Content-Type"] = "application/json"
+		}
+	}
+	if opts.Method == "" {
+		opts.Method = "GET"
+	}
+	opts.Method = strings.ToUpper(opts.Method)
+
+	rsp, err := cmd.client.DebugRequest(&opts)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read response: %w", err)
+	}
+
+	writeDebugResponse(Stdout, rsp.Header.Get("Content-Type"), body)
+
+	if cmd.Fail && rsp.StatusCode >= 400 {
+		return fmt.Errorf("request failed with status %d", rsp.StatusCode)
+	}
+	return nil
+}
+
+// writeDebugResponse writes the response body to w, indented if it is JSON.
+func writeDebugResponse(w io.Writer, contentType string, body []byte) {
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == "application/json" {
+		var buf bytes.Buffer
+		if json.Indent(&buf, body, "", "    ") == nil {
+			buf.WriteByte('\n')
+			w.Write(buf.Bytes())
+			return
+		}
+	}
+	w.Write(body)
+}
+
+func init() {
+	addDebugCommand("api", shortDebugAPIHelp, longDebugAPIHelp, func() flags.Commander { return &cmdDebugAPI{} }, map[string]string{
+		"method": "HTTP method to use (default: GET, or POST with --data)",
+		"data":   "Request body to send, or - to read it from standard input",
+		"header": "Additional request header, as \"Name: value\" (may be repeated)",
+		"fail":   "Exit with an error if the response status is 400 or above",
+	}, nil)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) TestDebugAPIGet(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/services")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{"names": {"foo"}})
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"type":"sync","status-code":200,"result":[{"name":"foo"}]}`)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "api", "/v1/services?names=foo"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+        {
+            "name": "foo"
+        }
+    ]
+}
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestDebugAPIPost(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/services")
+		c.Check(r.Header.Get("Content-Type"), check.Equals, "application/json")
+		c.Check(r.Header.Get("X-Foo"), check.Equals, "bar")
+		body, err := ioutil.ReadAll(r.Body)
+		c.Check(err, check.IsNil)
+		c.Check(string(body), check.Equals, `{"action":"start"}`)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "bad request\n")
+	})
+	args := []string{"debug", "api", "-d", `{"action":"start"}`, "-H", "X-Foo: bar", "/v1/services"}
+	_, err := pebble.Parser(pebble.Client()).ParseArgs(args)
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "bad request\n")
+	s.ResetStdStreams()
+
+	// With --fail, the status is reported as an error.
+	_, err = pebble.Parser(pebble.Client()).ParseArgs(append(args, "--fail"))
+	c.Assert(err, check.ErrorMatches, "request failed with status 400")
+	c.Check(s.Stdout(), check.Equals, "bad request\n")
+}
+
+func (s *PebbleSuite) TestDebugAPIErrors(c *check.C) {
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "api", "v1/services"})
+	c.Check(err, check.ErrorMatches, `API path must start with '/', not "v1/services"`)
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "api", "-H", "foo", "/v1/services"})
+	c.Check(err, check.ErrorMatches, `header must be in the form "Name: value", not "foo"`)
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+type cmdDebugPprof struct {
+	clientMixin
+	Output     string `short:"o" long:"output" value-name:"<file>"`
+	Seconds    int    `long:"seconds" value-name:"<seconds>"`
+	Positional struct {
+		Profile string `positional-arg-name:"<profile>" required:"1"`
+	} `positional-args:"yes"`
+}
+
+var shortDebugPprofHelp = "Fetch a runtime profile of the daemon"
+var longDebugPprofHelp = `
+The pprof command fetches a runtime profile of the daemon, such as "heap",
+"goroutine", "profile" (CPU) or "trace", and writes it to a file for
+analysis with "go tool pprof" or "go tool trace". The daemon must have been
+started with "pebble run --pprof".
+
+The file defaults to <profile>.prof in the current directory; use "-o -" to
+write the profile to standard output.
+`
+
+func (cmd *cmdDebugPprof) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	r, err := cmd.client.Pprof(&client.PprofOptions{
+		Profile: cmd.Positional.Profile,
+		Seconds: cmd.Seconds,
+	})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if cmd.Output == "-" {
+		_, err = io.Copy(Stdout, r)
+		return err
+	}
+	path := cmd.Output
+	if path == "" {
+		path = cmd.Positional.Profile + ".prof"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return fmt.Errorf("cannot write profile: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "Wrote %s profile to %s\n", cmd.Positional.Profile, path)
+	return nil
+}
+
+func init() {
+	addDebugCommand("pprof", shortDebugPprofHelp, longDebugPprofHelp, func() flags.Commander { return &cmdDebugPprof{} }, map[string]string{
+		"output":  "File to write the profile to, or - for standard output",
+		"seconds": "How long to collect a CPU profile or trace for",
+	}, nil)
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) TestDebugPprof(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/debug/pprof/profile")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{"seconds": {"5"}})
+		fmt.Fprint(w, "profile data")
+	})
+	path := filepath.Join(c.MkDir(), "cpu.prof")
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "pprof", "--seconds=5", "-o", path, "profile"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, fmt.Sprintf("Wrote profile profile to %s\n", path))
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "profile data")
+	s.ResetStdStreams()
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "pprof", "--seconds=5", "-o", "-", "profile"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "profile data")
+}
+
+func (s *PebbleSuite) TestDebugPprofError(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"type": "error", "status-code": 404, "result": {"message": "pprof endpoints are not enabled"}}`)
+	})
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "pprof", "-o", "-", "heap"})
+	c.Assert(err, check.ErrorMatches, "pprof endpoints are not enabled")
+	c.Check(s.Stdout(), check.Equals, "")
+}
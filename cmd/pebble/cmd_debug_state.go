@@ -0,0 +1,245 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+	"github.com/canonical/pebble/internal/overlord"
+	"github.com/canonical/pebble/internal/overlord/state"
+)
+
+type cmdExportState struct {
+	clientMixin
+}
+
+var shortExportStateHelp = "Export the daemon's state as JSON"
+var longExportStateHelp = `
+The export-state command prints the daemon's state (changes, tasks, warnings,
+and the current status of services) as a JSON document, for post-mortem
+analysis or for loading into another daemon with import-state.
+`
+
+func (cmd *cmdExportState) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	data, err := cmd.client.ExportState(&client.ExportStateOptions{})
+	if err != nil {
+		return err
+	}
+	Stdout.Write(data)
+	fmt.Fprintln(Stdout)
+	return nil
+}
+
+type cmdImportState struct {
+	clientMixin
+	Positional struct {
+		Path string `positional-arg-name:"<path>" required:"1"`
+	} `positional-args:"yes"`
+}
+
+var shortImportStateHelp = "Import state previously exported with export-state"
+var longImportStateHelp = `
+The import-state command loads the changes, tasks, and warnings from a JSON
+document created by export-state into the daemon. The daemon must be freshly
+started, without any changes of its own, and all the changes in the document
+must be ready, as they aren't run again. Service status in the document is
+informational and is not imported.
+`
+
+func (cmd *cmdImportState) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	data, err := ioutil.ReadFile(cmd.Positional.Path)
+	if err != nil {
+		return err
+	}
+	err = cmd.client.ImportState(&client.ImportStateOptions{Data: data})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "State imported successfully from %q\n", cmd.Positional.Path)
+	return nil
+}
+
+type cmdDebugState struct {
+	timeMixin
+	Changes    bool   `long:"changes"`
+	ChangeID   string `long:"change" value-name:"<change-id>"`
+	TaskID     string `long:"task" value-name:"<task-id>"`
+	Positional struct {
+		StateFile string `positional-arg-name:"<state-file>"`
+	} `positional-args:"yes"`
+}
+
+var shortDebugStateHelp = "Inspect a state file"
+var longDebugStateHelp = `
+The state command reads a state file directly, without the daemon, so that
+the changes and tasks of a stopped or crashed daemon can be analyzed. The
+state file defaults to .pebble.state in the pebble directory.
+
+By default, or with --changes, it lists the changes. With --change, it lists
+the tasks of a change with the lanes they are in and the tasks they wait for.
+With --task, it shows the details of a task, including its log.
+`
+
+func (cmd *cmdDebugState) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	n := 0
+	for _, set := range []bool{cmd.Changes, cmd.ChangeID != "", cmd.TaskID != ""} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return fmt.Errorf("cannot use more than one of --changes, --change and --task")
+	}
+
+	path := cmd.Positional.StateFile
+	if path == "" {
+		pebbleDir, _ := getEnvPaths()
+		path = filepath.Join(pebbleDir, ".pebble.state")
+	}
+	st, err := overlord.ReadStateFile(path)
+	if err != nil {
+		return err
+	}
+	st.Lock()
+	defer st.Unlock()
+
+	switch {
+	case cmd.ChangeID != "":
+		return cmd.showTasks(st)
+	case cmd.TaskID != "":
+		return cmd.showTask(st)
+	}
+	return cmd.showChanges(st)
+}
+
+func (cmd *cmdDebugState) fmtReadyTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return cmd.fmtTime(t)
+}
+
+func (cmd *cmdDebugState) showChanges(st *state.State) error {
+	changes := st.Changes()
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].SpawnTime().Before(changes[j].SpawnTime())
+	})
+
+	w := tabWriter()
+	defer w.Flush()
+	fmt.Fprintln(w, "ID\tStatus\tSpawn\tReady\tKind\tSummary")
+	for _, chg := range changes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", chg.ID(), chg.Status(),
+			cmd.fmtTime(chg.SpawnTime()), cmd.fmtReadyTime(chg.ReadyTime()), chg.Kind(), chg.Summary())
+	}
+	return nil
+}
+
+func (cmd *cmdDebugState) showTasks(st *state.State) error {
+	chg := st.Change(cmd.ChangeID)
+	if chg == nil {
+		return fmt.Errorf("no change with ID %q", cmd.ChangeID)
+	}
+	tasks := chg.Tasks()
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].Lanes()[0] < tasks[j].Lanes()[0]
+	})
+
+	w := tabWriter()
+	defer w.Flush()
+	fmt.Fprintln(w, "Lanes\tID\tStatus\tSpawn\tReady\tKind\tWaits\tSummary")
+	for _, t := range tasks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", fmtLanes(t.Lanes()), t.ID(), t.Status(),
+			cmd.fmtTime(t.SpawnTime()), cmd.fmtReadyTime(t.ReadyTime()), t.Kind(), fmtTaskIDs(t.WaitTasks()), t.Summary())
+	}
+	return nil
+}
+
+func (cmd *cmdDebugState) showTask(st *state.State) error {
+	t := st.Task(cmd.TaskID)
+	if t == nil {
+		return fmt.Errorf("no task with ID %q", cmd.TaskID)
+	}
+
+	fmt.Fprintf(Stdout, "id: %s\n", t.ID())
+	fmt.Fprintf(Stdout, "kind: %s\n", t.Kind())
+	fmt.Fprintf(Stdout, "summary: %s\n", t.Summary())
+	fmt.Fprintf(Stdout, "status: %s\n", t.Status())
+	if chg := t.Change(); chg != nil {
+		fmt.Fprintf(Stdout, "change: %s\n", chg.ID())
+	}
+	fmt.Fprintf(Stdout, "lanes: %s\n", fmtLanes(t.Lanes()))
+	fmt.Fprintf(Stdout, "waits: %s\n", fmtTaskIDs(t.WaitTasks()))
+	fmt.Fprintf(Stdout, "halts: %s\n", fmtTaskIDs(t.HaltTasks()))
+	fmt.Fprintf(Stdout, "spawn-time: %s\n", cmd.fmtTime(t.SpawnTime()))
+	fmt.Fprintf(Stdout, "ready-time: %s\n", cmd.fmtReadyTime(t.ReadyTime()))
+	if log := t.Log(); len(log) > 0 {
+		fmt.Fprintln(Stdout, "log: |")
+		for _, line := range log {
+			fmt.Fprintf(Stdout, "  %s\n", line)
+		}
+	}
+	return nil
+}
+
+func fmtLanes(lanes []int) string {
+	strs := make([]string, len(lanes))
+	for i, lane := range lanes {
+		strs[i] = strconv.Itoa(lane)
+	}
+	return strings.Join(strs, ",")
+}
+
+func fmtTaskIDs(tasks []*state.Task) string {
+	if len(tasks) == 0 {
+		return "-"
+	}
+	ids := make([]string, len(tasks))
+	for i, t := range tasks {
+		ids[i] = t.ID()
+	}
+	return strings.Join(ids, ",")
+}
+
+func init() {
+	addDebugCommand("state", shortDebugStateHelp, longDebugStateHelp, func() flags.Commander { return &cmdDebugState{} }, merge(timeDescs, map[string]string{
+		"changes": "List the changes (the default)",
+		"change":  "List the tasks of the given change",
+		"task":    "Show the details and log of the given task",
+	}), []argDesc{{
+		name: "<state-file>",
+		desc: "State file to read (defaults to $PEBBLE/.pebble.state)",
+	}})
+	addDebugCommand("export-state", shortExportStateHelp, longExportStateHelp, func() flags.Commander { return &cmdExportState{} }, nil, nil)
+	addDebugCommand("import-state", shortImportStateHelp, longImportStateHelp, func() flags.Commander { return &cmdImportState{} }, nil, nil)
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+	"github.com/canonical/pebble/internal/overlord/state"
+)
+
+func (s *PebbleSuite) TestExportState(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/state")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": {"state":{"data":{}},"services":[]}
+}`)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "export-state"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `{"state":{"data":{}},"services":[]}`+"\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestImportState(c *check.C) {
+	doc := `{"state":{"data":{}},"services":[]}`
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/state")
+		body, err := ioutil.ReadAll(r.Body)
+		c.Check(err, check.IsNil)
+		c.Check(string(body), check.Equals, doc)
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": true
+}`)
+	})
+	path := filepath.Join(c.MkDir(), "state.json")
+	err := ioutil.WriteFile(path, []byte(doc), 0644)
+	c.Assert(err, check.IsNil)
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "import-state", path})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Matches, `State imported successfully from .*\n`)
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestDebugState(c *check.C) {
+	restore := state.FakeTime(time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC))
+	defer restore()
+
+	st := state.New(nil)
+	st.Lock()
+	chg := st.NewChange("start", "Start service \"foo\"")
+	t1 := st.NewTask("start", "Start service \"foo\"")
+	t1.Logf("starting")
+	t1.SetStatus(state.DoneStatus)
+	t2 := st.NewTask("check", "Check service \"foo\"")
+	t2.WaitFor(t1)
+	t2.JoinLane(st.NewLane())
+	chg.AddTask(t1)
+	chg.AddTask(t2)
+	data, err := json.Marshal(st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	path := filepath.Join(c.MkDir(), "state.json")
+	c.Assert(ioutil.WriteFile(path, data, 0644), check.IsNil)
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "state", "--abs-time", path})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+ID   Status  Spawn                 Ready  Kind   Summary
+1    Do      2021-01-02T03:04:05Z  -      start  Start service "foo"
+`[1:])
+	s.ResetStdStreams()
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "state", "--abs-time", "--change=1", path})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, `
+Lanes  ID   Status  Spawn                 Ready                 Kind   Waits  Summary
+0      1    Done    2021-01-02T03:04:05Z  2021-01-02T03:04:05Z  start  -      Start service "foo"
+1      2    Do      2021-01-02T03:04:05Z  -                     check  1      Check service "foo"
+`[1:])
+	s.ResetStdStreams()
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "state", "--abs-time", "--task=1", path})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, `
+id: 1
+kind: start
+summary: Start service "foo"
+status: Done
+change: 1
+lanes: 0
+waits: -
+halts: 2
+spawn-time: 2021-01-02T03:04:05Z
+ready-time: 2021-01-02T03:04:05Z
+log: |
+  2021-01-02T03:04:05Z INFO starting
+`[1:])
+	s.ResetStdStreams()
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "state", "--task=42", path})
+	c.Check(err, check.ErrorMatches, `no task with ID "42"`)
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "state", "--change=1", "--task=1", path})
+	c.Check(err, check.ErrorMatches, `cannot use more than one of --changes, --change and --task`)
+}
+
+func (s *PebbleSuite) TestDebugStateCompressed(c *check.C) {
+	restore := state.FakeTime(time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC))
+	defer restore()
+
+	st := state.New(nil)
+	st.Lock()
+	chg := st.NewChange("start", "Start service \"foo\"")
+	chg.AddTask(st.NewTask("start", "Start service \"foo\""))
+	data, err := json.Marshal(st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err = zw.Write(data)
+	c.Assert(err, check.IsNil)
+	c.Assert(zw.Close(), check.IsNil)
+	path := filepath.Join(c.MkDir(), "state.json")
+	c.Assert(ioutil.WriteFile(path, buf.Bytes(), 0644), check.IsNil)
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"debug", "state", "--abs-time", path})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+ID   Status  Spawn                 Ready  Kind   Summary
+1    Do      2021-01-02T03:04:05Z  -      start  Start service "foo"
+`[1:])
+}
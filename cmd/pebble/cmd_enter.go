@@ -0,0 +1,152 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/internal/logger"
+	"github.com/canonical/pebble/internal/strutil"
+)
+
+var shortEnterHelp = "Run pebble with a subcommand"
+var longEnterHelp = `
+The enter command makes it easy to use pebble as the single entrypoint of a
+container. It starts the daemon, waits for it to be ready, runs the given
+subcommand against it, and then stops the daemon and exits with the
+subcommand's status, for example:
+
+pebble enter exec --user=app -- /app/migrate
+
+The default services are only started (and waited for) before running the
+subcommand if --run is given. After a successful start or replan subcommand,
+the daemon keeps running as with 'pebble run', so that the services started
+keep running too. Without a subcommand, enter is the same as 'pebble run',
+except that default services are only started with --run.
+
+The daemon's own messages are only logged with --verbose.
+`
+
+type cmdEnter struct {
+	clientMixin
+	Run     bool `long:"run"`
+	Verbose bool `short:"v" long:"verbose"`
+}
+
+var enterDescs = map[string]string{
+	"run":     "Start default services before running the subcommand",
+	"verbose": "Log the daemon's messages and all output from services",
+}
+
+// enterCommands are the subcommands that can be run with "pebble enter".
+var enterCommands = []string{"exec", "health", "plan", "replan", "services", "start", "version"}
+
+// enterKeepRunningCommands are the subcommands after which the daemon keeps
+// running, if they succeed.
+var enterKeepRunningCommands = []string{"replan", "start"}
+
+func init() {
+	info := addCommand("enter", shortEnterHelp, longEnterHelp, func() flags.Commander { return &cmdEnter{} }, enterDescs, nil)
+	info.extra = func(cmd *flags.Command) {
+		cmd.SubcommandsOptional = true
+	}
+}
+
+func (cmd *cmdEnter) runCommand() *cmdRun {
+	return &cmdRun{
+		clientMixin: cmd.clientMixin,
+		Hold:        !cmd.Run,
+		Verbose:     cmd.Verbose,
+	}
+}
+
+func (cmd *cmdEnter) Execute(args []string) error {
+	if len(args) > 0 {
+		// As subcommands are optional, an unsupported one ends up here.
+		return fmt.Errorf("unknown command %q, see 'pebble help enter'.", args[0])
+	}
+	return cmd.runCommand().Execute(nil)
+}
+
+func (cmd *cmdEnter) subcommands() []string {
+	return enterCommands
+}
+
+type enterResult struct {
+	status int
+	err    error
+}
+
+func (cmd *cmdEnter) runSubcommand(name string, command flags.Commander, args []string) error {
+	if !cmd.Verbose {
+		logger.SetLogger(logger.NullLogger)
+	}
+
+	results := make(chan enterResult, 1)
+	rcmd := cmd.runCommand()
+	rcmd.onReady = func(startChangeID string) <-chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			if startChangeID != "" {
+				waiter := waitMixin{clientMixin: cmd.clientMixin, skipAbort: true}
+				if _, err := waiter.wait(startChangeID); err != nil {
+					results <- enterResult{err: fmt.Errorf("cannot start default services: %w", err)}
+					close(done)
+					return
+				}
+			}
+			status, err := executeCommand(command, args)
+			results <- enterResult{status: status, err: err}
+			if status == 0 && err == nil && strutil.ListContains(enterKeepRunningCommands, name) {
+				return
+			}
+			close(done)
+		}()
+		return done
+	}
+	if err := rcmd.Execute(nil); err != nil {
+		return err
+	}
+
+	select {
+	case result := <-results:
+		if result.err != nil {
+			return result.err
+		}
+		if result.status != 0 {
+			panic(&exitStatus{result.status})
+		}
+	default:
+		// The daemon was stopped before the subcommand finished.
+	}
+	return nil
+}
+
+// executeCommand executes command, returning the status it exits with
+// (using panic(&exitStatus{code})), if any.
+func executeCommand(command flags.Commander, args []string) (status int, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			e, ok := v.(*exitStatus)
+			if !ok {
+				panic(v)
+			}
+			status = e.code
+		}
+	}()
+	return 0, command.Execute(args)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) writeLayer(c *C, layer string) {
+	err := os.MkdirAll(filepath.Join(s.pebbleDir, "layers"), 0755)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(filepath.Join(s.pebbleDir, "layers", "001-base.yaml"), []byte(layer), 0644)
+	c.Assert(err, IsNil)
+}
+
+func (s *PebbleSuite) TestEnterServices(c *C) {
+	s.writeLayer(c, `
+services:
+    svc1:
+        override: replace
+        command: sleep 10
+        startup: enabled
+`)
+	restore := fakeArgs("pebble", "enter", "services")
+	defer restore()
+
+	err := pebble.RunMain()
+	c.Assert(err, IsNil)
+	// Default services aren't started without --run.
+	c.Check(s.Stdout(), Matches, `(?s)Service +Startup +Current.*\nsvc1 +enabled +inactive\n`)
+	c.Check(s.Stderr(), Equals, "")
+}
+
+func (s *PebbleSuite) TestEnterRunServices(c *C) {
+	s.writeLayer(c, `
+services:
+    svc1:
+        override: replace
+        command: sleep 10
+        startup: enabled
+`)
+	restore := fakeArgs("pebble", "enter", "--run", "services")
+	defer restore()
+
+	err := pebble.RunMain()
+	c.Assert(err, IsNil)
+	c.Check(s.Stdout(), Matches, `(?s)Service +Startup +Current.*\nsvc1 +enabled +active\n`)
+}
+
+func (s *PebbleSuite) TestEnterError(c *C) {
+	restore := fakeArgs("pebble", "enter", "start", "svc1")
+	defer restore()
+
+	err := pebble.RunMain()
+	c.Assert(err, ErrorMatches, `cannot start services: service "svc1" does not exist`)
+}
+
+func (s *PebbleSuite) TestEnterExitStatus(c *C) {
+	restore := fakeArgs("pebble", "enter", "health", "chk1")
+	defer restore()
+
+	// The subcommand's error is passed through.
+	err := pebble.RunMain()
+	c.Assert(err, ErrorMatches, `cannot find check "chk1"`)
+}
+
+func (s *PebbleSuite) TestEnterUnsupportedCommand(c *C) {
+	restore := fakeArgs("pebble", "enter", "warnings")
+	defer restore()
+
+	err := pebble.RunMain()
+	c.Assert(err, ErrorMatches, `unknown command "warnings", see 'pebble help enter'.`)
+}
@@ -43,6 +43,7 @@ type cmdExec struct {
 	NoTerminal     bool          `short:"T"`
 	Interactive    bool          `short:"i"`
 	NonInteractive bool          `short:"I"`
+	Detach         bool          `long:"detach"`
 	Positional     struct {
 		Command string `positional-arg-name:"<command>" required:"1"`
 	} `positional-args:"yes"`
@@ -60,6 +61,7 @@ var execDescs = map[string]string{
 	"T":       "Disable remote pseudo-terminal allocation",
 	"i":       "Interactive mode: connect stdin to the pseudo-terminal (default if stdin and stdout are TTYs)",
 	"I":       "Disable interactive mode and use a pipe for stdin",
+	"detach":  "Run the command in the background and just print its change ID",
 }
 
 var shortExecHelp = "Execute a remote command and wait for it to finish"
@@ -72,6 +74,11 @@ To avoid confusion, exec options may be separated from the command and its
 arguments using "--", for example:
 
 pebble exec --timeout 10s -- echo -n foo bar
+
+With --detach, the command is started in the background and its change ID is
+printed straight away. It gets no input, and the end of its output is logged
+to the change, which fails if the command exits with a non-zero code. Use
+"pebble change <id>" to see how it went, or "pebble wait <id>" to wait for it.
 `
 
 func (cmd *cmdExec) Execute(args []string) error {
@@ -81,6 +88,9 @@ func (cmd *cmdExec) Execute(args []string) error {
 	if cmd.Interactive && cmd.NonInteractive {
 		return errors.New("cannot use -i and -I at the same time")
 	}
+	if cmd.Detach && (cmd.Terminal || cmd.Interactive) {
+		return errors.New("cannot use -t or -i with --detach")
+	}
 
 	command := append([]string{cmd.Positional.Command}, args...)
 	logger.Debugf("Executing command %q", command)
@@ -101,6 +111,24 @@ func (cmd *cmdExec) Execute(args []string) error {
 		env[key] = value
 	}
 
+	if cmd.Detach {
+		changeID, err := cmd.client.ExecDetached(&client.ExecOptions{
+			Command:     command,
+			Environment: env,
+			WorkingDir:  cmd.WorkingDir,
+			Timeout:     cmd.Timeout,
+			UserID:      cmd.UserID,
+			User:        cmd.User,
+			GroupID:     cmd.GroupID,
+			Group:       cmd.Group,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(Stdout, "%s\n", changeID)
+		return nil
+	}
+
 	// Specify Terminal=true if -t is given, or if stdout is a TTY.
 	stdoutIsTerminal := ptyutil.IsTerminal(unix.Stdout)
 	var terminal bool
@@ -0,0 +1,89 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+type cmdHealth struct {
+	clientMixin
+	formatMixin
+	Level      string `long:"level" choice:"alive" choice:"ready"`
+	Positional struct {
+		Checks []string `positional-arg-name:"<check>"`
+	} `positional-args:"yes"`
+}
+
+var healthDescs = map[string]string{
+	"level": `Check level to query: "alive", or "ready" (which includes "alive"
+checks). Defaults to "ready" if no checks are specified.`,
+}
+
+var shortHealthHelp = "Query health of checks"
+var longHealthHelp = `
+The health command queries the health of the given checks (or of all checks
+at the given level, "ready" by default). It prints "healthy" and exits with
+status 0 if they're all up, or prints "unhealthy" and exits with status 1
+otherwise, so it can be used directly as a Docker HEALTHCHECK or a Kubernetes
+exec probe, for example:
+
+pebble health --level=alive
+
+With --format=json or --format=yaml, an object with the single field
+"healthy" is written instead, and the exit status is the same.
+`
+
+// healthOutput is the structured output for the health command.
+type healthOutput struct {
+	Healthy bool `json:"healthy" yaml:"healthy"`
+}
+
+func (cmd *cmdHealth) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	opts := client.HealthOptions{
+		Level: client.CheckLevel(cmd.Level),
+		Names: cmd.Positional.Checks,
+	}
+	if opts.Level == client.UnsetLevel && len(opts.Names) == 0 {
+		opts.Level = client.ReadyLevel
+	}
+	healthy, err := cmd.client.CheckHealth(&opts)
+	if err != nil {
+		return err
+	}
+	if cmd.structured() {
+		if err := cmd.writeStructured(healthOutput{Healthy: healthy}); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintln(Stdout, colorEscapes().health(healthy))
+	}
+	if !healthy {
+		panic(&exitStatus{1})
+	}
+	return nil
+}
+
+func init() {
+	addCommand("health", shortHealthHelp, longHealthHelp, func() flags.Commander { return &cmdHealth{} }, merge(healthDescs, formatDescs), nil)
+}
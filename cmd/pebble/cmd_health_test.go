@@ -0,0 +1,113 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) TestHealthDefaultLevel(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/health")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{"level": {"ready"}})
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {"healthy": true}}`)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"health"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "healthy\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestHealthChecks(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v1/health")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"level": {"alive"},
+			"names": {"chk1,chk2"},
+		})
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {"healthy": true}}`)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"health", "--level", "alive", "chk1", "chk2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "healthy\n")
+}
+
+func (s *PebbleSuite) TestHealthUnhealthy(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{"names": {"chk1"}})
+		fmt.Fprint(w, `{"type": "sync", "status-code": 502, "result": {"healthy": false}}`)
+	})
+
+	c.Check(func() {
+		pebble.Parser(pebble.Client()).ParseArgs([]string{"health", "chk1"})
+	}, check.PanicMatches, `.*exitStatus\{1\}.*`)
+	c.Check(s.Stdout(), check.Equals, "unhealthy\n")
+}
+
+func (s *PebbleSuite) TestHealthNotFound(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		fmt.Fprint(w, `{"type": "error", "status-code": 404, "result": {"message": "cannot find check \"chk1\""}}`)
+	})
+
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"health", "chk1"})
+	c.Assert(err, check.ErrorMatches, `cannot find check "chk1"`)
+	c.Check(s.Stdout(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestHealthFormat(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v1/health")
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {"healthy": true}}`)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"health", "--format", "json"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+{
+    "healthy": true
+}
+`[1:])
+
+	s.ResetStdStreams()
+	rest, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"health", "--format", "yaml"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "healthy: true\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestHealthFormatUnhealthy(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "sync", "status-code": 502, "result": {"healthy": false}}`)
+	})
+
+	c.Check(func() {
+		pebble.Parser(pebble.Client()).ParseArgs([]string{"health", "--format", "yaml", "chk1"})
+	}, check.PanicMatches, `.*exitStatus\{1\}.*`)
+	c.Check(s.Stdout(), check.Equals, "healthy: false\n")
+}
@@ -18,8 +18,11 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/jessevdk/go-flags"
@@ -92,33 +95,35 @@ func (cmd *cmdHelp) setParser(parser *flags.Parser) {
 
 // manfixer is a hackish way to fix drawbacks in the generated manpage:
 // - no way to get it into section 8
+// - no way to set the date, which makes builds unreproducible
 // - duplicated TP lines that break older groff (e.g. 14.04), lp:1814767
 type manfixer struct {
 	bytes.Buffer
-	done bool
 }
 
-func (w *manfixer) Write(buf []byte) (int, error) {
-	if !w.done {
-		w.done = true
-		if bytes.HasPrefix(buf, []byte(".TH pebble 1 ")) {
-			// io.Writer.Write must not modify the buffer, even temporarily
-			n, _ := w.Buffer.Write(buf[:9])
-			w.Buffer.Write([]byte{'8'})
-			m, err := w.Buffer.Write(buf[10:])
-			return n + m + 1, err
-		}
-	}
-	return w.Buffer.Write(buf)
-}
-
-var tpRegexp = regexp.MustCompile(`(?m)(?:^\.TP\n)+`)
+var (
+	thRegexp = regexp.MustCompile(`^\.TH pebble 1 "[^"]*"`)
+	tpRegexp = regexp.MustCompile(`(?m)(?:^\.TP\n)+`)
+)
 
 func (w *manfixer) flush() {
-	str := tpRegexp.ReplaceAllLiteralString(w.Buffer.String(), ".TP\n")
+	th := fmt.Sprintf(`.TH pebble 8 "%s"`, manDate().Format("2 January 2006"))
+	str := thRegexp.ReplaceAllLiteralString(w.Buffer.String(), th)
+	str = tpRegexp.ReplaceAllLiteralString(str, ".TP\n")
 	io.Copy(Stdout, strings.NewReader(str))
 }
 
+// manDate returns the date to put in the manpage: the time given in
+// $SOURCE_DATE_EPOCH for reproducible builds, or the current time.
+func manDate() time.Time {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		if secs, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			return time.Unix(secs, 0).UTC()
+		}
+	}
+	return time.Now()
+}
+
 func (cmd cmdHelp) Execute(args []string) error {
 	if len(args) > 0 {
 		return ErrExtraArgs
@@ -168,23 +173,31 @@ type helpCategory struct {
 var helpCategories = []helpCategory{{
 	Label:       "Run",
 	Description: "run pebble",
-	Commands:    []string{"run", "help", "version"},
+	Commands:    []string{"run", "enter", "help", "version"},
 }, {
 	Label:       "Plan",
 	Description: "view and change configuration",
-	Commands:    []string{"add", "plan"},
+	Commands:    []string{"add", "remove-layer", "move-layer", "layers", "plan", "validate"},
 }, {
 	Label:       "Services",
 	Description: "manage services",
-	Commands:    []string{"services", "logs", "start", "restart", "signal", "stop", "replan"},
+	Commands:    []string{"services", "top", "logs", "start", "restart", "reload", "signal", "watchdog", "stop", "replan"},
+}, {
+	Label:       "Checks",
+	Description: "query health checks",
+	Commands:    []string{"health"},
 }, {
 	Label:       "Files",
 	Description: "work with files and execute commands",
-	Commands:    []string{"exec"},
+	Commands:    []string{"exec", "ls", "pull", "push"},
 }, {
 	Label:       "Changes",
 	Description: "manage changes and their tasks",
-	Commands:    []string{"changes", "tasks"},
+	Commands:    []string{"changes", "tasks", "wait", "abort"},
+}, {
+	Label:       "Notices",
+	Description: "record and list notices",
+	Commands:    []string{"notify", "notices"},
 }, {
 	Label:       "Warnings",
 	Description: "manage warnings",
@@ -199,8 +212,10 @@ the system that is running them.
 	pebbleUsage               = "Usage: pebble <command> [<options>...]"
 	pebbleHelpCategoriesIntro = "Commands can be classified as follows:"
 	pebbleHelpAllFooter       = "Set the PEBBLE environment variable to override the configuration directory \n" +
-		"(which defaults to " + defaultPebbleDir + "). Set PEBBLE_SOCKET to override \n" +
-		"the Unix socket used for the API (defaults to $PEBBLE/.pebble.socket).\n" +
+		"(which defaults to " + defaultPebbleDir + "). Set PEBBLE_SOCKET or use the \n" +
+		"--socket option to override the Unix socket used for the API (defaults to \n" +
+		"$PEBBLE/.pebble.socket). Use --remote ssh://[user@]host to manage a daemon \n" +
+		"on another host over SSH.\n" +
 		"\n" +
 		"For more information about a command, run 'pebble help <command>'."
 	pebbleHelpFooter = "For a short summary of all commands, run 'pebble help --all'."
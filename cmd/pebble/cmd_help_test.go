@@ -0,0 +1,42 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"os"
+	"strings"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) TestHelpManpage(c *check.C) {
+	os.Setenv("SOURCE_DATE_EPOCH", "1609459200")
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"help", "--man"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "")
+
+	out := s.Stdout()
+	c.Check(strings.HasPrefix(out, `.TH pebble 8 "1 January 2021"`+"\n.SH NAME\n"), check.Equals, true)
+	c.Check(out, check.Matches, `(?s).*\n\.SS services\nQuery the status of configured services\n.*`)
+	c.Check(out, check.Matches, `(?s).*\\fB\\-\\-format\\fR.*`)
+	c.Check(out, check.Not(check.Matches), `(?s).*\.TP\n\.TP\n.*`)
+	// Debug commands are hidden.
+	c.Check(out, check.Not(check.Matches), `(?s).*\.SS debug.*`)
+}
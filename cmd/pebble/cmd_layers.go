@@ -0,0 +1,98 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+type cmdLayers struct {
+	clientMixin
+	formatMixin
+}
+
+var shortLayersHelp = "List the plan's layers"
+var longLayersHelp = `
+The layers command lists the plan's layers in the order they're combined,
+with the order and label of each, and where it came from: the layers
+directory ("file"), or the API, kept in memory only ("dynamic") or saved to be
+restored when the daemon restarts ("persisted").
+
+With --format=json or --format=yaml, a list of layers is written, each with
+the fields "label", "order", "summary", "dynamic" and "persist".
+`
+
+// layerOutput is the structured output for a layer.
+type layerOutput struct {
+	Label   string `json:"label" yaml:"label"`
+	Order   int    `json:"order" yaml:"order"`
+	Summary string `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Dynamic bool   `json:"dynamic" yaml:"dynamic"`
+	Persist bool   `json:"persist" yaml:"persist"`
+}
+
+func (cmd *cmdLayers) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	layers, err := cmd.client.Layers(&client.LayersOptions{})
+	if err != nil {
+		return err
+	}
+	if cmd.structured() {
+		output := make([]layerOutput, len(layers))
+		for i, layer := range layers {
+			output[i] = layerOutput{
+				Label:   layer.Label,
+				Order:   layer.Order,
+				Summary: layer.Summary,
+				Dynamic: layer.Dynamic,
+				Persist: layer.Persist,
+			}
+		}
+		return cmd.writeStructured(output)
+	}
+	if len(layers) == 0 {
+		fmt.Fprintln(Stderr, "Plan has no layers")
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+	fmt.Fprintln(w, "Order\tLabel\tSource\tSummary")
+	for _, layer := range layers {
+		source := "file"
+		switch {
+		case layer.Persist:
+			source = "persisted"
+		case layer.Dynamic:
+			source = "dynamic"
+		}
+		summary := layer.Summary
+		if summary == "" {
+			summary = "-"
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\n", layer.Order, layer.Label, source, summary)
+	}
+	return nil
+}
+
+func init() {
+	addCommand("layers", shortLayersHelp, longLayersHelp, func() flags.Commander { return &cmdLayers{} }, formatDescs, nil)
+}
@@ -37,7 +37,7 @@ type cmdLogs struct {
 	Format     string `long:"format"`
 	N          string `short:"n"`
 	Positional struct {
-		Services []string `positional-arg-name:"<service>"`
+		Services []serviceName `positional-arg-name:"<service>"`
 	} `positional-args:"yes"`
 }
 
@@ -90,7 +90,7 @@ func (cmd *cmdLogs) Execute(args []string) error {
 
 	opts := client.LogsOptions{
 		WriteLog: writeLog,
-		Services: cmd.Positional.Services,
+		Services: serviceNames(cmd.Positional.Services),
 		N:        n,
 	}
 	var err error
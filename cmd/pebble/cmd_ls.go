@@ -0,0 +1,141 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+type cmdLs struct {
+	clientMixin
+	timeMixin
+
+	Directory bool `short:"d" long:"directory"`
+	Long      bool `short:"l" long:"long"`
+	NoFollow  bool `long:"no-follow"`
+
+	Positional struct {
+		Path string `positional-arg-name:"<path>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var lsDescs = map[string]string{
+	"directory": "List matching directories themselves, not their contents",
+	"long":      "Use a long listing format",
+	"no-follow": "Report a symlink given as <path> as such, rather than following it",
+}
+
+var shortLsHelp = "List path contents"
+var longLsHelp = `
+The ls command lists the entries in the directory at <path>, or the file at
+<path> itself. The path must be absolute.
+
+The path may contain wildcards in any component (quote it to stop the shell
+expanding them), in which case the daemon lists each match in a single
+request: the contents of matching directories, unless --directory is given,
+and other matching entries themselves. For example:
+
+pebble ls -l '/var/log/*.log'
+`
+
+// fileTypeChars are the characters shown for each file type in the long
+// listing format.
+var fileTypeChars = map[string]string{
+	"file":       "-",
+	"directory":  "d",
+	"symlink":    "l",
+	"socket":     "s",
+	"named-pipe": "p",
+	"device":     "c",
+}
+
+func (cmd *cmdLs) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	path := cmd.Positional.Path
+	glob := strings.ContainsAny(path, `*?[\`)
+	files, err := cmd.client.ListFiles(&client.ListFilesOptions{
+		Path:     path,
+		Glob:     glob,
+		Itself:   cmd.Directory,
+		NoFollow: cmd.NoFollow,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Show full paths unless listing a directory's contents, as ls does.
+	fullPaths := cmd.Directory || glob
+
+	if !cmd.Long {
+		for _, file := range files {
+			fmt.Fprintln(Stdout, cmd.name(file, path, fullPaths))
+		}
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+	fmt.Fprintln(w, "Permissions\tOwner\tGroup\tSize\tModified\tName")
+	for _, file := range files {
+		typeChar, ok := fileTypeChars[file.Type]
+		if !ok {
+			typeChar = "?"
+		}
+		size := "-"
+		if file.Type == "file" {
+			size = strconv.FormatInt(file.Size, 10)
+		}
+		name := cmd.name(file, path, fullPaths)
+		if file.LinkTarget != "" {
+			name += " -> " + file.LinkTarget
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\t%s\t%s\n",
+			typeChar, file.Permissions.String()[1:], owner(file.User, file.UserID),
+			owner(file.Group, file.GroupID), size, cmd.fmtTime(file.LastModified), name)
+	}
+	return nil
+}
+
+func (cmd *cmdLs) name(file *client.FileInfo, path string, fullPaths bool) string {
+	if fullPaths || file.Path == path {
+		return file.Path
+	}
+	return file.Name
+}
+
+// owner returns the name of a file's user or group, falling back to its ID.
+func owner(name string, id *int) string {
+	switch {
+	case name != "":
+		return name
+	case id != nil:
+		return strconv.Itoa(*id)
+	default:
+		return "-"
+	}
+}
+
+func init() {
+	addCommand("ls", shortLsHelp, longLsHelp, func() flags.Commander { return &cmdLs{} }, merge(lsDescs, timeDescs), nil)
+}
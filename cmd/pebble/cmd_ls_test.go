@@ -0,0 +1,159 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+const lsResult = `{"type": "sync", "result": [{
+	"path": "/var/log/app.log",
+	"name": "app.log",
+	"type": "file",
+	"size": 1234,
+	"permissions": "640",
+	"last-modified": "2021-04-10T12:05:06Z",
+	"user-id": 1000,
+	"user": "app",
+	"group-id": 1001,
+	"group": "adm"
+}, {
+	"path": "/var/log/archive",
+	"name": "archive",
+	"type": "directory",
+	"permissions": "755",
+	"last-modified": "2021-04-09T08:00:00Z",
+	"user-id": 1000,
+	"user": "",
+	"group-id": 1001,
+	"group": ""
+}, {
+	"path": "/var/log/current.log",
+	"name": "current.log",
+	"type": "symlink",
+	"link-target": "app.log",
+	"permissions": "777",
+	"last-modified": "2021-04-10T12:05:07Z",
+	"user-id": 0,
+	"user": "root",
+	"group-id": 0,
+	"group": "root"
+}]}`
+
+func (s *PebbleSuite) TestLs(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/files")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"action": {"list"},
+			"path":   {"/var/log"},
+		})
+		fmt.Fprint(w, lsResult)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"ls", "/var/log"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+app.log
+archive
+current.log
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestLsLong(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"action": {"list"},
+			"path":   {"/var/log"},
+			"follow": {"false"},
+		})
+		fmt.Fprint(w, lsResult)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"ls", "-l", "--abs-time", "--no-follow", "/var/log"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+Permissions  Owner  Group  Size  Modified              Name
+-rw-r-----   app    adm    1234  2021-04-10T12:05:06Z  app.log
+drwxr-xr-x   1000   1001   -     2021-04-09T08:00:00Z  archive
+lrwxrwxrwx   root   root   -     2021-04-10T12:05:07Z  current.log -> app.log
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestLsGlob(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"action": {"list"},
+			"path":   {"/var/log/*"},
+			"glob":   {"true"},
+		})
+		fmt.Fprint(w, lsResult)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"ls", "/var/log/*"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+/var/log/app.log
+/var/log/archive
+/var/log/current.log
+`[1:])
+}
+
+func (s *PebbleSuite) TestLsDirectoryItself(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"action": {"list"},
+			"path":   {"/var/log"},
+			"itself": {"true"},
+		})
+		fmt.Fprint(w, `{"type": "sync", "result": [{
+			"path": "/var/log",
+			"name": "log",
+			"type": "directory",
+			"permissions": "755",
+			"last-modified": "2021-04-09T08:00:00Z"
+		}]}`)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"ls", "-d", "/var/log"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "/var/log\n")
+}
+
+func (s *PebbleSuite) TestLsNotFound(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"type": "error", "status-code": 404, "result": {
+			"kind": "not-found",
+			"message": "stat /nope: no such file or directory"
+		}}`)
+	})
+
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"ls", "/nope"})
+	c.Assert(err, check.ErrorMatches, "stat /nope: no such file or directory")
+	c.Check(s.Stdout(), check.Equals, "")
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+type cmdMoveLayer struct {
+	clientMixin
+	Before     string `long:"before"`
+	Positional struct {
+		Label string `positional-arg-name:"<label>" required:"1"`
+	} `positional-args:"yes"`
+}
+
+var shortMoveLayerHelp = "Move a dynamic layer within the plan's layers"
+var longMoveLayerHelp = `
+The move-layer command moves the layer with the given label, which must have
+been added with the add command, to just before the layer given by --before
+(also added with the add command), or to the end of the plan's layers, and
+re-combines the plan, without restarting the daemon. Layers from the layers
+directory always come first, in the order of their filenames.
+
+Use the replan command to apply the updated plan to running services.
+`
+
+func (cmd *cmdMoveLayer) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	err := cmd.client.MoveLayer(&client.MoveLayerOptions{
+		Label:  cmd.Positional.Label,
+		Before: cmd.Before,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "Layer %q moved successfully\n", cmd.Positional.Label)
+	return nil
+}
+
+func init() {
+	addCommand("move-layer", shortMoveLayerHelp, longMoveLayerHelp, func() flags.Commander { return &cmdMoveLayer{} }, map[string]string{
+		"before": "Label of the layer to move it before (default is to move it to the end)",
+	}, nil)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+type cmdNotices struct {
+	clientMixin
+	timeMixin
+	formatMixin
+	pagerMixin
+	Types []string `long:"type"`
+	Keys  []string `long:"key"`
+}
+
+var shortNoticesHelp = "List notices"
+var longNoticesHelp = `
+The notices command lists the notices that have been recorded, oldest first
+by the time they were last repeated, optionally filtered by type and key.
+
+With --format=json or --format=yaml, a list of notices is written, each with
+the fields "id", "type", "key", "first-occurred", "last-occurred",
+"last-repeated", "occurrences" and "last-data" (if the last occurrence
+had data).
+`
+
+// noticeOutput is the structured output for a notice.
+type noticeOutput struct {
+	ID            string            `json:"id" yaml:"id"`
+	Type          string            `json:"type" yaml:"type"`
+	Key           string            `json:"key" yaml:"key"`
+	FirstOccurred time.Time         `json:"first-occurred" yaml:"first-occurred"`
+	LastOccurred  time.Time         `json:"last-occurred" yaml:"last-occurred"`
+	LastRepeated  time.Time         `json:"last-repeated" yaml:"last-repeated"`
+	Occurrences   int               `json:"occurrences" yaml:"occurrences"`
+	LastData      map[string]string `json:"last-data,omitempty" yaml:"last-data,omitempty"`
+}
+
+func init() {
+	addCommand("notices", shortNoticesHelp, longNoticesHelp, func() flags.Commander { return &cmdNotices{} }, merge(timeDescs, formatDescs, pagerDescs, map[string]string{
+		"type": "Only list notices of this type (can be repeated)",
+		"key":  "Only list notices with this key (can be repeated)",
+	}), nil)
+}
+
+func (cmd *cmdNotices) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	opts := client.NoticesOptions{Keys: cmd.Keys}
+	for _, t := range cmd.Types {
+		opts.Types = append(opts.Types, client.NoticeType(t))
+	}
+	stop := cmd.startPager()
+	defer stop()
+	notices, err := cmd.client.Notices(&opts)
+	if err != nil {
+		return err
+	}
+	if cmd.structured() {
+		output := make([]noticeOutput, len(notices))
+		for i, notice := range notices {
+			output[i] = noticeOutput{
+				ID:            notice.ID,
+				Type:          string(notice.Type),
+				Key:           notice.Key,
+				FirstOccurred: notice.FirstOccurred,
+				LastOccurred:  notice.LastOccurred,
+				LastRepeated:  notice.LastRepeated,
+				Occurrences:   notice.Occurrences,
+				LastData:      notice.LastData,
+			}
+		}
+		return cmd.writeStructured(output)
+	}
+	if len(notices) == 0 {
+		if len(cmd.Types) == 0 && len(cmd.Keys) == 0 {
+			fmt.Fprintln(Stderr, "No notices")
+		} else {
+			fmt.Fprintln(Stderr, "No matching notices")
+		}
+		return nil
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	fmt.Fprintln(w, "ID\tType\tKey\tFirst\tRepeated\tOccurrences")
+	for _, notice := range notices {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", notice.ID, notice.Type, notice.Key,
+			cmd.fmtTime(notice.FirstOccurred), cmd.fmtTime(notice.LastRepeated), notice.Occurrences)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+const noticesResponse = `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+		{"id": "1", "type": "custom", "key": "example.com/a", "first-occurred": "2023-09-01T10:00:00Z", "last-occurred": "2023-09-01T12:00:00Z", "last-repeated": "2023-09-01T11:00:00Z", "occurrences": 3, "last-data": {"path": "/tmp/x"}},
+		{"id": "2", "type": "start-limit", "key": "svc1", "first-occurred": "2023-09-02T10:00:00Z", "last-occurred": "2023-09-02T10:00:00Z", "last-repeated": "2023-09-02T10:00:00Z", "occurrences": 1}
+	]
+}`
+
+func (s *PebbleSuite) TestNotices(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/notices")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{})
+		fmt.Fprint(w, noticesResponse)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"notices", "--abs-time"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+ID   Type         Key            First                 Repeated              Occurrences
+1    custom       example.com/a  2023-09-01T10:00:00Z  2023-09-01T11:00:00Z  3
+2    start-limit  svc1           2023-09-02T10:00:00Z  2023-09-02T10:00:00Z  1
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestNoticesFilters(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"types": {"custom,start-limit"},
+			"keys":  {"example.com/a"},
+		})
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"notices", "--type", "custom", "--type", "start-limit", "--key", "example.com/a"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No matching notices\n")
+}
+
+func (s *PebbleSuite) TestNoticesFormat(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, noticesResponse)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"notices", "--format", "yaml"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+- id: "1"
+  type: custom
+  key: example.com/a
+  first-occurred: 2023-09-01T10:00:00Z
+  last-occurred: 2023-09-01T12:00:00Z
+  last-repeated: 2023-09-01T11:00:00Z
+  occurrences: 3
+  last-data:
+    path: /tmp/x
+- id: "2"
+  type: start-limit
+  key: svc1
+  first-occurred: 2023-09-02T10:00:00Z
+  last-occurred: 2023-09-02T10:00:00Z
+  last-repeated: 2023-09-02T10:00:00Z
+  occurrences: 1
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
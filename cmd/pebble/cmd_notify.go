@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+type cmdNotify struct {
+	clientMixin
+	RepeatAfter time.Duration `long:"repeat-after"`
+	Positional  struct {
+		Key  string   `positional-arg-name:"<key>" required:"1"`
+		Data []string `positional-arg-name:"<name=value>"`
+	} `positional-args:"yes"`
+}
+
+var shortNotifyHelp = "Record a custom notice"
+var longNotifyHelp = `
+The notify command records a custom notice with the given key and optional
+data fields. The key must be in the form "domain.com/key", for example:
+
+pebble notify example.com/db-backup path=/tmp/backup.tgz
+
+If a notice with the same key already exists, its occurrence count and data
+are updated rather than a new notice being recorded.
+
+Notices can also be recorded over the daemon's untrusted socket
+(".pebble.socket.untrusted"), which is all that workloads need access to.
+`
+
+func init() {
+	addCommand("notify", shortNotifyHelp, longNotifyHelp, func() flags.Commander { return &cmdNotify{} }, map[string]string{
+		"repeat-after": "Only repeat the notice this long after it was last repeated",
+	}, nil)
+}
+
+func (cmd *cmdNotify) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	var data map[string]string
+	for _, kv := range cmd.Positional.Data {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("data must be in name=value format, not %q", kv)
+		}
+		if data == nil {
+			data = make(map[string]string)
+		}
+		data[parts[0]] = parts[1]
+	}
+
+	id, err := cmd.client.Notify(&client.NotifyOptions{
+		Key:         cmd.Positional.Key,
+		Data:        data,
+		RepeatAfter: cmd.RepeatAfter,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "Recorded notice %s\n", id)
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) TestNotify(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/notices")
+		assertBodyEquals(c, r.Body, map[string]interface{}{
+			"action":       "add",
+			"type":         "custom",
+			"key":          "example.com/foo",
+			"data":         map[string]interface{}{"a": "b", "c": "d=e"},
+			"repeat-after": "1h0m0s",
+		})
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {"id": "42"}}`)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"notify", "--repeat-after", "1h", "example.com/foo", "a=b", "c=d=e"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "Recorded notice 42\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestNotifyInvalidData(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request")
+	})
+
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"notify", "example.com/foo", "novalue"})
+	c.Assert(err, check.ErrorMatches, `data must be in name=value format, not "novalue"`)
+}
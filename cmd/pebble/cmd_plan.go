@@ -15,25 +15,41 @@
 package main
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/jessevdk/go-flags"
 
 	"github.com/canonical/pebble/client"
+	"github.com/canonical/pebble/internal/plan"
 )
 
 type cmdPlan struct {
 	clientMixin
+	Diff string `long:"diff"`
+}
+
+var planDescs = map[string]string{
+	"diff": "Show how the plan would change if the given layer were added",
 }
 
 var shortPlanHelp = "Show the plan with layers combined"
 var longPlanHelp = `
 The plan command prints out the effective configuration of pebble in YAML
 format. Layers are combined according to the override rules defined in them.
+
+With --diff, the plan is not printed; instead the command shows which
+services would be added, modified, or removed (and which of their fields
+would change) if the given layer file were added to the plan.
 `
 
 func (cmd *cmdPlan) Execute(args []string) error {
 	if len(args) > 0 {
 		return ErrExtraArgs
 	}
+	if cmd.Diff != "" {
+		return cmd.showDiff()
+	}
 	planYAML, err := cmd.client.PlanBytes(&client.PlanOptions{})
 	if err != nil {
 		return err
@@ -42,6 +58,70 @@ func (cmd *cmdPlan) Execute(args []string) error {
 	return nil
 }
 
+// showDiff prints the changes to the services in the current plan that
+// adding the layer at cmd.Diff would make. The daemon's layers are fetched
+// as read, so that variables defined in one layer and used in another are
+// expanded only once, when the layers are combined.
+func (cmd *cmdPlan) showDiff() error {
+	infos, err := cmd.client.Layers(&client.LayersOptions{Content: true})
+	if err != nil {
+		return err
+	}
+	var layers []*plan.Layer
+	for _, info := range infos {
+		layer, err := plan.ParseLayer(info.Order, info.Label, []byte(info.Layer))
+		if err != nil {
+			return fmt.Errorf("cannot parse layer %q: %w", info.Label, err)
+		}
+		layers = append(layers, layer)
+	}
+	current, err := combineLayers(layers)
+	if err != nil {
+		return fmt.Errorf("cannot combine current layers: %w", err)
+	}
+	layer, err := plan.ReadLayerFile(cmd.Diff)
+	if err != nil {
+		return err
+	}
+	combined, err := combineLayers(append(layers, layer))
+	if err != nil {
+		return err
+	}
+	diffs, err := plan.DiffServices(current.Services, combined.Services)
+	if err != nil {
+		return err
+	}
+	if len(diffs) == 0 {
+		fmt.Fprintln(Stdout, "No changes.")
+		return nil
+	}
+	for _, diff := range diffs {
+		switch diff.Kind {
+		case plan.DiffAdded:
+			fmt.Fprintf(Stdout, "+ %s\n", diff.Name)
+		case plan.DiffModified:
+			fmt.Fprintf(Stdout, "~ %s: %s\n", diff.Name, strings.Join(diff.Fields, ", "))
+		case plan.DiffRemoved:
+			fmt.Fprintf(Stdout, "- %s\n", diff.Name)
+		}
+	}
+	return nil
+}
+
+// combineLayers combines the layers and expands their variables, as the
+// daemon does to make its plan.
+func combineLayers(layers []*plan.Layer) (*plan.Layer, error) {
+	combined, err := plan.CombineLayers(layers...)
+	if err != nil {
+		return nil, err
+	}
+	err = combined.ExpandVars()
+	if err != nil {
+		return nil, err
+	}
+	return combined, nil
+}
+
 func init() {
-	addCommand("plan", shortPlanHelp, longPlanHelp, func() flags.Commander { return &cmdPlan{} }, nil, nil)
+	addCommand("plan", shortPlanHelp, longPlanHelp, func() flags.Commander { return &cmdPlan{} }, planDescs, nil)
 }
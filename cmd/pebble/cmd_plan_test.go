@@ -16,8 +16,10 @@ package main_test
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"path/filepath"
 
 	"gopkg.in/check.v1"
 
@@ -46,3 +48,103 @@ services:
 `[1:])
 	c.Check(s.Stderr(), check.Equals, "")
 }
+
+// redirectToLayersServer serves the given layers (with their YAML content)
+// from the layers API, for plan --diff.
+func (s *PebbleSuite) redirectToLayersServer(c *check.C, layers ...string) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		switch r.URL.Path {
+		case "/v1/system-info":
+			fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": {"features": ["layers-content"]}}`)
+		case "/v1/layers":
+			c.Check(r.URL.Query(), check.DeepEquals, url.Values{"content": []string{"true"}})
+			var infos []map[string]interface{}
+			for i, layer := range layers {
+				infos = append(infos, map[string]interface{}{
+					"label": fmt.Sprintf("layer%d", i+1),
+					"order": i + 1,
+					"layer": layer,
+				})
+			}
+			EncodeResponseBody(c, w, map[string]interface{}{
+				"type":        "sync",
+				"status-code": 200,
+				"result":      infos,
+			})
+		default:
+			c.Errorf("unexpected path %q", r.URL.Path)
+		}
+	})
+}
+
+func (s *PebbleSuite) TestPlanDiff(c *check.C) {
+	s.redirectToLayersServer(c, `
+services:
+    foo:
+        override: replace
+        command: cmd
+    bar:
+        override: replace
+        command: cmd
+`)
+	path := filepath.Join(c.MkDir(), "layer.yaml")
+	err := ioutil.WriteFile(path, []byte(`
+services:
+    foo:
+        override: merge
+        command: newcmd
+        environment:
+            FOO: foo
+    baz:
+        override: replace
+        command: cmd
+`), 0644)
+	c.Assert(err, check.IsNil)
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"plan", "--diff", path})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
++ baz
+~ foo: command, environment
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestPlanDiffVars(c *check.C) {
+	// Variables defined in one layer can be used in another, and escaped
+	// references are only unescaped once.
+	s.redirectToLayersServer(c, `
+vars:
+    bin: /usr/bin
+`, `
+services:
+    foo:
+        override: replace
+        command: ${bin}/foo --arg=$${literal}
+`)
+	path := filepath.Join(c.MkDir(), "layer.yaml")
+	err := ioutil.WriteFile(path, []byte(`
+services:
+    bar:
+        override: replace
+        command: ${bin}/bar
+`), 0644)
+	c.Assert(err, check.IsNil)
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"plan", "--diff", path})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "+ bar\n")
+}
+
+func (s *PebbleSuite) TestPlanDiffNoChanges(c *check.C) {
+	s.redirectToLayersServer(c, "services:\n    foo:\n        override: replace\n        command: cmd\n")
+	path := filepath.Join(c.MkDir(), "layer.yaml")
+	err := ioutil.WriteFile(path, []byte("services:\n    foo:\n        override: merge\n        command: cmd\n"), 0644)
+	c.Assert(err, check.IsNil)
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"plan", "--diff", path})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "No changes.\n")
+}
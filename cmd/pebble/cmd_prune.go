@@ -0,0 +1,50 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+)
+
+type cmdPrune struct {
+	clientMixin
+}
+
+var shortPruneHelp = "Prune old changes and tasks now"
+var longPruneHelp = `
+The prune command asks the daemon to prune old changes and their tasks from
+its state immediately, rather than waiting for the next periodic prune.
+`
+
+func (cmd *cmdPrune) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	var result struct {
+		Pruned int `json:"pruned"`
+	}
+	err := cmd.client.DebugPost("prune", nil, &result)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "Pruned %d changes\n", result.Pruned)
+	return nil
+}
+
+func init() {
+	addDebugCommand("prune", shortPruneHelp, longPruneHelp, func() flags.Commander { return &cmdPrune{} }, nil, nil)
+}
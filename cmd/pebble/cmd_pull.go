@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+type cmdPull struct {
+	clientMixin
+
+	Archive  bool `long:"archive"`
+	Gzip     bool `short:"z" long:"gzip"`
+	NoFollow bool `long:"no-follow"`
+
+	Positional struct {
+		RemotePath string `positional-arg-name:"<remote-path>"`
+		LocalPath  string `positional-arg-name:"<local-path>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var pullDescs = map[string]string{
+	"archive":   "Save the directory tree at <remote-path> as a tar archive",
+	"gzip":      "Compress the archive with gzip (with --archive)",
+	"no-follow": "Archive a symlink at <remote-path> as such, rather than following it (with --archive)",
+}
+
+var shortPullHelp = "Retrieve a file from the remote system"
+var longPullHelp = `
+The pull command retrieves the file at <remote-path>, which must be absolute,
+and saves it to <local-path>. If <local-path> is "-", the contents are written
+to standard output.
+
+With --archive, the whole directory tree at <remote-path> is saved as a tar
+archive, streamed in a single request, which is handy for grabbing logs and
+other diagnostics. The archive extracts to a directory with the same name as
+the remote one. For example:
+
+pebble pull --archive --gzip /var/log/app app-logs.tar.gz
+`
+
+func (cmd *cmdPull) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	if !cmd.Archive && (cmd.Gzip || cmd.NoFollow) {
+		return errors.New("cannot use --gzip or --no-follow without --archive")
+	}
+
+	if cmd.Positional.LocalPath == "-" {
+		return cmd.pull(Stdout)
+	}
+	f, err := os.Create(cmd.Positional.LocalPath)
+	if err != nil {
+		return err
+	}
+	err = cmd.pull(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Don't leave a partial file behind.
+		os.Remove(cmd.Positional.LocalPath)
+	}
+	return err
+}
+
+func (cmd *cmdPull) pull(target io.Writer) error {
+	if cmd.Archive {
+		return cmd.client.PullArchive(&client.PullArchiveOptions{
+			Path:     cmd.Positional.RemotePath,
+			Gzip:     cmd.Gzip,
+			NoFollow: cmd.NoFollow,
+			Target:   target,
+		})
+	}
+	return cmd.client.Pull(&client.PullOptions{
+		Path:   cmd.Positional.RemotePath,
+		Target: target,
+	})
+}
+
+func init() {
+	addCommand("pull", shortPullHelp, longPullHelp, func() flags.Commander { return &cmdPull{} }, pullDescs, nil)
+}
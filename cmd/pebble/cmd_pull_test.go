@@ -0,0 +1,144 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+// writeReadResponse writes a files API read response with the given file
+// content to w.
+func writeReadResponse(c *check.C, w http.ResponseWriter, path, content string) {
+	mw := multipart.NewWriter(w)
+	w.Header().Set("Content-Type", mw.FormDataContentType())
+	fw, err := mw.CreateFormFile("files", path)
+	c.Assert(err, check.IsNil)
+	fmt.Fprint(fw, content)
+	fw, err = mw.CreateFormField("response")
+	c.Assert(err, check.IsNil)
+	fmt.Fprintf(fw, `{"type": "sync", "status-code": 200, "result": [{"path": %q}]}`, path)
+	c.Assert(mw.Close(), check.IsNil)
+}
+
+func (s *PebbleSuite) TestPull(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/files")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"action": {"read"},
+			"path":   {"/etc/app.conf"},
+		})
+		writeReadResponse(c, w, "/etc/app.conf", "key: value\n")
+	})
+
+	localPath := filepath.Join(c.MkDir(), "app.conf")
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"pull", "/etc/app.conf", localPath})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	data, err := ioutil.ReadFile(localPath)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "key: value\n")
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestPullStdout(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		writeReadResponse(c, w, "/etc/app.conf", "key: value\n")
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"pull", "/etc/app.conf", "-"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "key: value\n")
+}
+
+func (s *PebbleSuite) TestPullError(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", mw.FormDataContentType())
+		fw, err := mw.CreateFormField("response")
+		c.Assert(err, check.IsNil)
+		fmt.Fprint(fw, `{"type": "sync", "status-code": 200, "result": [{
+			"path": "/etc/missing",
+			"error": {"kind": "not-found", "message": "stat /etc/missing: no such file or directory"}
+		}]}`)
+		c.Assert(mw.Close(), check.IsNil)
+	})
+
+	localPath := filepath.Join(c.MkDir(), "missing")
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"pull", "/etc/missing", localPath})
+	c.Assert(err, check.ErrorMatches, "stat /etc/missing: no such file or directory")
+	_, err = os.Stat(localPath)
+	c.Check(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *PebbleSuite) TestPullArchive(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Path, check.Equals, "/v1/files")
+		c.Check(r.URL.Query(), check.DeepEquals, url.Values{
+			"action":      {"archive"},
+			"path":        {"/var/log/app"},
+			"compression": {"gzip"},
+			"follow":      {"false"},
+		})
+		w.Header().Set("Content-Type", "application/gzip")
+		fmt.Fprint(w, "archive data")
+	})
+
+	localPath := filepath.Join(c.MkDir(), "app-logs.tar.gz")
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"pull", "--archive", "-z", "--no-follow", "/var/log/app", localPath})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	data, err := ioutil.ReadFile(localPath)
+	c.Assert(err, check.IsNil)
+	c.Check(string(data), check.Equals, "archive data")
+}
+
+func (s *PebbleSuite) TestPullArchiveIncomplete(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Pebble-Archive-Error")
+		fmt.Fprint(w, "partial")
+		w.Header().Set("Pebble-Archive-Error", "open /var/log/app/secret: permission denied")
+	})
+
+	localPath := filepath.Join(c.MkDir(), "app-logs.tar")
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"pull", "--archive", "/var/log/app", localPath})
+	c.Assert(err, check.ErrorMatches, "archive is incomplete: open /var/log/app/secret: permission denied")
+	_, err = os.Stat(localPath)
+	c.Check(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *PebbleSuite) TestPullArchiveOptionsWithoutArchive(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request to %s", r.URL.Path)
+	})
+
+	for _, opt := range []string{"--gzip", "--no-follow"} {
+		_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"pull", opt, "/var/log/app", "-"})
+		c.Check(err, check.ErrorMatches, "cannot use --gzip or --no-follow without --archive")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+type cmdPush struct {
+	clientMixin
+
+	MakeDirs    bool   `short:"p"`
+	Permissions string `short:"m" long:"mode"`
+	UserID      *int   `long:"uid"`
+	User        string `long:"user"`
+	GroupID     *int   `long:"gid"`
+	Group       string `long:"group"`
+
+	Positional struct {
+		LocalPath  string `positional-arg-name:"<local-path>"`
+		RemotePath string `positional-arg-name:"<remote-path>"`
+	} `positional-args:"yes" required:"yes"`
+}
+
+var pushDescs = map[string]string{
+	"p":     "Create parent directories for the file",
+	"mode":  "Set permissions for the file in octal (default: local file's permissions, or 644)",
+	"uid":   "Use specified user ID for file ownership",
+	"user":  "Use specified username for file ownership (user's UID must match uid if both present)",
+	"gid":   "Use specified group ID for file ownership",
+	"group": "Use specified group name for file ownership (group's GID must match gid if both present)",
+}
+
+var shortPushHelp = "Transfer a file to the remote system"
+var longPushHelp = `
+The push command transfers a file to the remote system, creating or
+overwriting <remote-path>, which must be absolute. If <local-path> is "-",
+the file contents are read from standard input.
+
+The mode and ownership of the remote file can be set directly, avoiding a
+separate chmod or chown. If a user is given without a group, the file is
+owned by the user's primary group. For example:
+
+pebble push -p --mode=600 --user=app app.conf /etc/app/app.conf
+`
+
+func (cmd *cmdPush) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	var permissions os.FileMode
+	if cmd.Permissions != "" {
+		mode, err := strconv.ParseUint(cmd.Permissions, 8, 32)
+		if err != nil || mode > 0o777 {
+			return fmt.Errorf("invalid mode %q: must be an octal number between 000 and 777", cmd.Permissions)
+		}
+		permissions = os.FileMode(mode)
+	}
+
+	var source io.Reader
+	if cmd.Positional.LocalPath == "-" {
+		source = Stdin
+	} else {
+		f, err := os.Open(cmd.Positional.LocalPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		st, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if st.IsDir() {
+			return fmt.Errorf("cannot push %q: is a directory", cmd.Positional.LocalPath)
+		}
+		if cmd.Permissions == "" {
+			permissions = st.Mode().Perm()
+		}
+		source = f
+	}
+
+	return cmd.client.Push(&client.PushOptions{
+		Source:      source,
+		Path:        cmd.Positional.RemotePath,
+		MakeDirs:    cmd.MakeDirs,
+		Permissions: permissions,
+		UserID:      cmd.UserID,
+		User:        cmd.User,
+		GroupID:     cmd.GroupID,
+		Group:       cmd.Group,
+	})
+}
+
+func init() {
+	addCommand("push", shortPushHelp, longPushHelp, func() flags.Commander { return &cmdPush{} }, pushDescs, nil)
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+// pushHandler returns a test server handler that checks a files API write
+// request against the expected metadata and content.
+func pushHandler(c *check.C, metadata map[string]interface{}, content string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/files")
+		mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		c.Assert(err, check.IsNil)
+		c.Check(mediaType, check.Equals, "multipart/form-data")
+
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		part, err := mr.NextPart()
+		c.Assert(err, check.IsNil)
+		c.Check(part.FormName(), check.Equals, "request")
+		var request map[string]interface{}
+		c.Assert(json.NewDecoder(part).Decode(&request), check.IsNil)
+		c.Check(request, check.DeepEquals, map[string]interface{}{
+			"action": "write",
+			"files":  []interface{}{metadata},
+		})
+
+		part, err = mr.NextPart()
+		c.Assert(err, check.IsNil)
+		c.Check(part.FormName(), check.Equals, "files")
+		data, err := ioutil.ReadAll(part)
+		c.Assert(err, check.IsNil)
+		c.Check(string(data), check.Equals, content)
+
+		w.Write([]byte(`{"type": "sync", "result": [{"path": "` + metadata["path"].(string) + `"}]}`))
+	}
+}
+
+func (s *PebbleSuite) TestPush(c *check.C) {
+	localPath := filepath.Join(c.MkDir(), "app.conf")
+	err := ioutil.WriteFile(localPath, []byte("key: value\n"), 0o640)
+	c.Assert(err, check.IsNil)
+	// Don't depend on the umask for the expected permissions.
+	c.Assert(os.Chmod(localPath, 0o640), check.IsNil)
+
+	s.RedirectClientToTestServer(pushHandler(c, map[string]interface{}{
+		"path":        "/etc/app/app.conf",
+		"permissions": "640",
+	}, "key: value\n"))
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"push", localPath, "/etc/app/app.conf"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestPushOptions(c *check.C) {
+	localPath := filepath.Join(c.MkDir(), "app.conf")
+	err := ioutil.WriteFile(localPath, []byte("key: value\n"), 0o644)
+	c.Assert(err, check.IsNil)
+
+	s.RedirectClientToTestServer(pushHandler(c, map[string]interface{}{
+		"path":        "/etc/app/app.conf",
+		"make-dirs":   true,
+		"permissions": "600",
+		"user-id":     1000.0,
+		"user":        "app",
+		"group-id":    1001.0,
+		"group":       "staff",
+	}, "key: value\n"))
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{
+		"push", "-p", "--mode", "600", "--uid", "1000", "--user", "app",
+		"--gid", "1001", "--group", "staff", localPath, "/etc/app/app.conf",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+}
+
+func (s *PebbleSuite) TestPushStdin(c *check.C) {
+	s.stdin.WriteString("from stdin")
+
+	s.RedirectClientToTestServer(pushHandler(c, map[string]interface{}{
+		"path": "/tmp/file.txt",
+		"user": "app",
+	}, "from stdin"))
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"push", "--user", "app", "-", "/tmp/file.txt"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+}
+
+func (s *PebbleSuite) TestPushInvalidMode(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request to %s", r.URL.Path)
+	})
+
+	for _, mode := range []string{"abc", "888", "1777"} {
+		_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"push", "--mode", mode, "-", "/tmp/file.txt"})
+		c.Check(err, check.ErrorMatches, `invalid mode "`+mode+`": must be an octal number between 000 and 777`)
+	}
+}
+
+func (s *PebbleSuite) TestPushDirectory(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Fatalf("unexpected request to %s", r.URL.Path)
+	})
+
+	dir := c.MkDir()
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"push", dir, "/tmp/dir"})
+	c.Assert(err, check.ErrorMatches, `cannot push ".*": is a directory`)
+}
+
+func (s *PebbleSuite) TestPushFileError(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"type": "sync", "result": [{
+			"path": "/etc/app.conf",
+			"error": {"kind": "permission-denied", "message": "open /etc/app.conf: permission denied"}
+		}]}`))
+	})
+
+	s.stdin.WriteString("x")
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"push", "-", "/etc/app.conf"})
+	c.Assert(err, check.ErrorMatches, "open /etc/app.conf: permission denied")
+}
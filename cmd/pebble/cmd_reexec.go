@@ -0,0 +1,48 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+)
+
+type cmdReexec struct {
+	clientMixin
+}
+
+var shortReexecHelp = "Restart the daemon without stopping services"
+var longReexecHelp = `
+The reexec command asks the daemon to re-execute itself, for example to pick
+up an updated pebble binary. Running services are not stopped: the new daemon
+process takes them over, so the services see no downtime.
+`
+
+func (cmd *cmdReexec) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	err := cmd.client.DebugPost("reexec", nil, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(Stdout, "Daemon is re-executing")
+	return nil
+}
+
+func init() {
+	addDebugCommand("reexec", shortReexecHelp, longReexecHelp, func() flags.Commander { return &cmdReexec{} }, nil, nil)
+}
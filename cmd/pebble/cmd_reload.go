@@ -0,0 +1,61 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+var shortReloadHelp = "Reload a service's configuration"
+var longReloadHelp = `
+The reload command makes the named service(s) reload their configuration
+without being restarted, by running their reload-command or sending them their
+reload-signal. Services that have neither are restarted instead.
+`
+
+type cmdReload struct {
+	waitMixin
+	Positional struct {
+		Services []serviceName `positional-arg-name:"<service>" required:"1"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommand("reload", shortReloadHelp, longReloadHelp, func() flags.Commander { return &cmdReload{} }, waitDescs, nil)
+}
+
+func (cmd cmdReload) Execute(args []string) error {
+	if len(args) > 1 {
+		return ErrExtraArgs
+	}
+
+	servopts := client.ServiceOptions{
+		Names: serviceNames(cmd.Positional.Services),
+	}
+	changeID, err := cmd.client.Reload(&servopts)
+	if err != nil {
+		return err
+	}
+
+	if _, err := cmd.wait(changeID); err != nil {
+		if err == noWait {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/jessevdk/go-flags"
+
+	"github.com/canonical/pebble/client"
+)
+
+type cmdRemoveLayer struct {
+	clientMixin
+	Positional struct {
+		Label string `positional-arg-name:"<label>" required:"1"`
+	} `positional-args:"yes"`
+}
+
+var shortRemoveLayerHelp = "Dynamically remove a layer from the plan's layers"
+var longRemoveLayerHelp = `
+The remove-layer command removes the layer with the given label from the
+plan's layers and re-combines the plan, without restarting the daemon.
+
+Services that were defined only by the removed layer are no longer part of
+the plan, but are not stopped; use the replan command to apply the updated
+plan to running services. Layer files on disk are not modified, so layers
+loaded from the layers directory return when the daemon is restarted.
+`
+
+func (cmd *cmdRemoveLayer) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	err := cmd.client.RemoveLayer(&client.RemoveLayerOptions{
+		Label: cmd.Positional.Label,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(Stdout, "Layer %q removed successfully\n", cmd.Positional.Label)
+	return nil
+}
+
+func init() {
+	addCommand("remove-layer", shortRemoveLayerHelp, longRemoveLayerHelp, func() flags.Commander { return &cmdRemoveLayer{} }, nil, nil)
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) TestReplan(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/services":
+			c.Check(r.Method, check.Equals, "POST")
+			assertBodyEquals(c, r.Body, map[string]interface{}{
+				"action":   "replan",
+				"services": nil,
+			})
+			fmt.Fprint(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+		case "/v1/changes/42":
+			c.Check(r.Method, check.Equals, "GET")
+			fmt.Fprint(w, `{"type": "sync", "result": {"id": "42", "status": "Done", "ready": true}}`)
+		default:
+			c.Fatalf("unexpected path %q", r.URL.Path)
+		}
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"replan"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestReplanNoWait(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v1/services")
+		fmt.Fprint(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"replan", "--no-wait"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "42\n")
+}
@@ -28,7 +28,7 @@ The restart command restarts the named service(s) in the correct order.
 type cmdRestart struct {
 	waitMixin
 	Positional struct {
-		Services []string `positional-arg-name:"<service>" required:"1"`
+		Services []serviceName `positional-arg-name:"<service>" required:"1"`
 	} `positional-args:"yes"`
 }
 
@@ -42,7 +42,7 @@ func (cmd cmdRestart) Execute(args []string) error {
 	}
 
 	servopts := client.ServiceOptions{
-		Names: cmd.Positional.Services,
+		Names: serviceNames(cmd.Positional.Services),
 	}
 	changeID, err := cmd.client.Restart(&servopts)
 	if err != nil {
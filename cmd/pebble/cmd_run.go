@@ -18,7 +18,9 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -28,29 +30,127 @@ import (
 	"github.com/canonical/pebble/cmd"
 	"github.com/canonical/pebble/internal/daemon"
 	"github.com/canonical/pebble/internal/logger"
-	"github.com/canonical/pebble/internal/systemd"
+	"github.com/canonical/pebble/internal/reaper"
 )
 
 var shortRunHelp = "Run the pebble environment"
 var longRunHelp = `
 The run command starts pebble and runs the configured environment.
+
+When run as PID 1, for example as a container's entrypoint, pebble also acts
+as the init process: it reaps orphaned processes, and stops the running
+services gracefully when it receives SIGTERM or SIGINT. The other signals
+whose default action is to terminate the process (SIGHUP, SIGQUIT, SIGUSR1
+and SIGUSR2), which the kernel would otherwise ignore for PID 1, are handled
+the same way.
+
+The --rate-limit option limits how many API requests per second each user
+can make, to protect the daemon from a misbehaving client. Requests over the
+limit are rejected with HTTP status 429 and a Retry-After header.
+
+The --read-only option rejects all API requests that would change state,
+such as starting services or adding layers, while still allowing services,
+changes, logs and the plan to be inspected. This allows giving access to the
+socket to a monitoring process without risk of it changing anything.
+
+The --max-execs option limits how many commands started with "pebble exec"
+(or the exec API) may be running at once, so that a misbehaving client can't
+exhaust the processes and file descriptors available. Exec requests over the
+limit are rejected with HTTP status 429 until a command finishes.
+
+The --shutdown-grace-period option sets how long the daemon waits, when it
+receives SIGTERM (or another terminating signal as PID 1), for in-progress
+changes to finish, and then for the running services to stop, before exiting
+anyway.
+
+The --compress-state option writes the state file gzip-compressed, which
+keeps it small on devices with a long history of changes and notices. A
+compressed state file is read correctly even without this option.
+
+The --http option serves the health and metrics endpoints (/v1/health and
+/v1/metrics) over HTTP on the given TCP address, for example ":4000", without
+authentication. This allows HTTP probes such as Kubernetes' liveness and
+readiness probes to query checks, for example at /v1/health?names=<check>. No
+other endpoints are available on this address.
+
+The --pprof option serves the daemon's runtime profiles (CPU, heap,
+goroutines, execution trace and so on) to admin users at /v1/debug/pprof/,
+for diagnosing performance issues with "pebble debug pprof".
+
+A service environment value of the form "secret://<name>" is replaced, when
+the service starts, by the contents of the file <name> in the --secrets-dir
+directory, or else by the value of the PEBBLE_SECRET_<NAME> environment
+variable (with <name> in upper case and other characters replaced by "_").
+The secret's value isn't stored in the plan or the state.
+
+A service environment value may also refer to the daemon's own environment
+variables as "${HOST:NAME}", such as credentials injected into a container,
+but only to those allowed by a --host-env option, which gives a variable name
+or a pattern such as "AWS_*". The reference is replaced when the service
+starts, by an empty string if the variable isn't set.
+
+The layers in the "layers.d" sub-directory of the pebble directory, and then
+in each --layers-dir directory, are combined after those in the "layers"
+sub-directory. Their filenames don't need an order prefix ("some-label.yaml"
+is enough), so packages can ship layers without coordinating filenames.
+
+If the OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT
+environment variable is set, a trace span is exported to that OpenTelemetry
+collector (using OTLP over HTTP) for each API request, change and task. The
+spans are exported with OTEL_SERVICE_NAME as the service name, or "pebble" if
+that isn't set.
 `
 
 type cmdRun struct {
 	clientMixin
 
-	CreateDirs bool `long:"create-dirs"`
-	Hold       bool `long:"hold"`
-	Verbose    bool `short:"v" long:"verbose"`
+	CreateDirs      bool          `long:"create-dirs"`
+	Hold            bool          `long:"hold"`
+	Verbose         bool          `short:"v" long:"verbose"`
+	PruneWait       time.Duration `long:"prune-wait"`
+	PruneMaxChanges int           `long:"prune-max-changes"`
+	RateLimit       float64       `long:"rate-limit"`
+	RateBurst       int           `long:"rate-burst"`
+	ReadOnly        bool          `long:"read-only"`
+	MaxExecs        int           `long:"max-execs"`
+	ShutdownGrace   time.Duration `long:"shutdown-grace-period"`
+	CompressState   bool          `long:"compress-state"`
+	HTTP            string        `long:"http"`
+	Pprof           bool          `long:"pprof"`
+	SecretsDir      string        `long:"secrets-dir"`
+	LayersDirs      []string      `long:"layers-dir"`
+	HostEnv         []string      `long:"host-env"`
+
+	// onReady, if set, is called once the daemon is serving the API (with
+	// the ID of the change starting the default services, if any). The
+	// daemon stops when the returned channel is closed.
+	onReady func(startChangeID string) <-chan struct{}
 }
 
 func init() {
-	addCommand("run", shortRunHelp, longRunHelp, func() flags.Commander { return &cmdRun{} },
+	cmd := addCommand("run", shortRunHelp, longRunHelp, func() flags.Commander { return &cmdRun{} },
 		map[string]string{
-			"create-dirs": "Create pebble directory on startup if it doesn't exist",
-			"hold":        "Do not start default services automatically",
-			"verbose":     "Log all output from services to stdout",
+			"create-dirs":           "Deprecated: the pebble directory is always created",
+			"hold":                  "Do not start default services automatically",
+			"verbose":               "Log all output from services to stdout",
+			"prune-wait":            "How long to keep changes after they're ready (default 24h)",
+			"prune-max-changes":     "Maximum number of ready changes to keep (default 500)",
+			"rate-limit":            "Maximum API requests per second from each user (default no limit)",
+			"rate-burst":            "Number of API requests allowed in a burst above --rate-limit",
+			"read-only":             "Reject API requests that change state",
+			"max-execs":             "Maximum number of exec commands running at once (default no limit)",
+			"shutdown-grace-period": "How long to wait for changes and services on shutdown (default 30s)",
+			"compress-state":        "Write the state file gzip-compressed",
+			"http":                  "TCP address to serve health and metrics on, e.g. \":4000\"",
+			"pprof":                 "Serve runtime profiles for 'pebble debug pprof'",
+			"secrets-dir":           "Directory to read secret:// references in service environments from",
+			"layers-dir":            "Extra directory of drop-in layers (may be repeated)",
+			"host-env":              "Daemon environment variable (or pattern such as \"AWS_*\") services may use (may be repeated)",
 		}, nil)
+	cmd.extra = func(cmd *flags.Command) {
+		// Kept so that existing invocations continue to work.
+		cmd.FindOptionByLongName("create-dirs").Hidden = true
+	}
 }
 
 func (rcmd *cmdRun) Execute(args []string) error {
@@ -60,6 +160,9 @@ func (rcmd *cmdRun) Execute(args []string) error {
 
 	sigs := make(chan os.Signal, 2)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	if os.Getpid() == 1 {
+		signal.Notify(sigs, pid1Signals...)
+	}
 
 	if err := runDaemon(rcmd, sigs); err != nil {
 		if err == daemon.ErrRestartSocket {
@@ -68,6 +171,9 @@ func (rcmd *cmdRun) Execute(args []string) error {
 			// This exit code must be in system'd SuccessExitStatus.
 			panic(&exitStatus{42})
 		}
+		if err == daemon.ErrReexec {
+			err = reexec()
+		}
 		fmt.Fprintf(os.Stderr, "cannot run pebble: %v\n", err)
 		panic(&exitStatus{1})
 	}
@@ -75,37 +181,52 @@ func (rcmd *cmdRun) Execute(args []string) error {
 	return nil
 }
 
-func runWatchdog(d *daemon.Daemon) (*time.Ticker, error) {
+// pid1Signals are the signals, besides SIGINT and SIGTERM, whose default
+// action is to terminate the process. The kernel ignores them for PID 1 unless
+// they're handled, so as PID 1 they're handled like SIGTERM instead.
+var pid1Signals = []os.Signal{syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2}
+
+// reexec replaces the current process with a new instance of the (possibly
+// updated) pebble binary, run with the same arguments and environment.
+func reexec() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	logger.Noticef("Re-executing %s", exe)
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
+
+// watchdogInterval returns how often to notify the systemd watchdog (half
+// the watchdog timeout), or zero if not running under a systemd watchdog.
+func watchdogInterval() (time.Duration, error) {
 	if os.Getenv("WATCHDOG_USEC") == "" {
 		// Not running under systemd.
-		return nil, nil
+		return 0, nil
 	}
 	usec, err := strconv.ParseFloat(os.Getenv("WATCHDOG_USEC"), 10)
 	if usec == 0 || err != nil {
-		return nil, fmt.Errorf("cannot parse WATCHDOG_USEC: %q", os.Getenv("WATCHDOG_USEC"))
-	}
-	dur := time.Duration(usec/2) * time.Microsecond
-	logger.Debugf("Setting up sd_notify() watchdog timer every %s", dur)
-	wt := time.NewTicker(dur)
-
-	go func() {
-		for {
-			select {
-			case <-wt.C:
-				// TODO: poke the API here and only report WATCHDOG=1 if it
-				//       replies with valid data.
-				systemd.SdNotify("WATCHDOG=1")
-			case <-d.Dying():
-				return
-			}
-		}
-	}()
+		return 0, fmt.Errorf("cannot parse WATCHDOG_USEC: %q", os.Getenv("WATCHDOG_USEC"))
+	}
+	return time.Duration(usec/2) * time.Microsecond, nil
+}
 
-	return wt, nil
+// tracingConfig returns the OTLP traces endpoint and service name from the
+// standard OpenTelemetry environment variables.
+func tracingConfig() (endpoint, serviceName string) {
+	endpoint = os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+		}
+	}
+	return endpoint, os.Getenv("OTEL_SERVICE_NAME")
 }
 
 var checkRunningConditionsRetryDelay = 300 * time.Second
 
+var daemonNew = daemon.New
+
 func sanityCheck() error {
 	// Nothing interesting to check for now. See snapd's sanity package for examples.
 	return nil
@@ -115,21 +236,72 @@ func runDaemon(rcmd *cmdRun, ch chan os.Signal) error {
 	t0 := time.Now().Truncate(time.Millisecond)
 
 	pebbleDir, socketPath := getEnvPaths()
-	if rcmd.CreateDirs {
-		err := os.MkdirAll(pebbleDir, 0755)
-		if err != nil {
+	err := os.MkdirAll(filepath.Join(pebbleDir, "layers"), 0755)
+	if err != nil {
+		return fmt.Errorf("cannot create pebble directory: %w", err)
+	}
+	if rcmd.PruneWait < 0 {
+		return fmt.Errorf("invalid --prune-wait value %v", rcmd.PruneWait)
+	}
+	if rcmd.PruneMaxChanges < 0 {
+		return fmt.Errorf("invalid --prune-max-changes value %d", rcmd.PruneMaxChanges)
+	}
+	if rcmd.RateLimit < 0 {
+		return fmt.Errorf("invalid --rate-limit value %v", rcmd.RateLimit)
+	}
+	if rcmd.RateBurst < 0 {
+		return fmt.Errorf("invalid --rate-burst value %d", rcmd.RateBurst)
+	}
+	if rcmd.MaxExecs < 0 {
+		return fmt.Errorf("invalid --max-execs value %d", rcmd.MaxExecs)
+	}
+	if rcmd.ShutdownGrace < 0 {
+		return fmt.Errorf("invalid --shutdown-grace-period value %v", rcmd.ShutdownGrace)
+	}
+
+	// As PID 1, orphaned processes are re-parented to us and must be reaped,
+	// and the kernel ignores signals we don't handle rather than applying
+	// their default action.
+	pid1 := os.Getpid() == 1
+	if pid1 {
+		if err := reaper.Start(); err != nil {
 			return err
 		}
+		defer reaper.Stop()
 	}
+
+	watchdog, err := watchdogInterval()
+	if err != nil {
+		return fmt.Errorf("cannot run software watchdog: %v", err)
+	}
+	if watchdog > 0 {
+		logger.Debugf("Setting up sd_notify() watchdog timer every %s", watchdog)
+	}
+
 	dopts := daemon.Options{
-		Dir:        pebbleDir,
-		SocketPath: socketPath,
+		Dir:                 pebbleDir,
+		SocketPath:          socketPath,
+		PruneWait:           rcmd.PruneWait,
+		PruneMaxChanges:     rcmd.PruneMaxChanges,
+		WatchdogInterval:    watchdog,
+		RateLimit:           rcmd.RateLimit,
+		RateBurst:           rcmd.RateBurst,
+		ReadOnly:            rcmd.ReadOnly,
+		MaxExecs:            rcmd.MaxExecs,
+		ShutdownGracePeriod: rcmd.ShutdownGrace,
+		CompressState:       rcmd.CompressState,
+		HTTPAddress:         rcmd.HTTP,
+		Pprof:               rcmd.Pprof,
+		SecretsDir:          rcmd.SecretsDir,
+		LayersDirs:          rcmd.LayersDirs,
+		HostEnv:             rcmd.HostEnv,
 	}
+	dopts.TracingEndpoint, dopts.TracingServiceName = tracingConfig()
 	if rcmd.Verbose {
 		dopts.ServiceOutput = os.Stdout
 	}
 
-	d, err := daemon.New(&dopts)
+	d, err := daemonNew(&dopts)
 	if err != nil {
 		return err
 	}
@@ -153,16 +325,10 @@ func runDaemon(rcmd *cmdRun, ch chan os.Signal) error {
 	d.Version = cmd.Version
 	d.Start()
 
-	watchdog, err := runWatchdog(d)
-	if err != nil {
-		return fmt.Errorf("cannot run software watchdog: %v", err)
-	}
-	if watchdog != nil {
-		defer watchdog.Stop()
-	}
-
 	logger.Debugf("activation done in %v", time.Now().Truncate(time.Millisecond).Sub(t0))
 
+	// Tell systemd we're ready once the default services have started.
+	var startChangeID string
 	if !rcmd.Hold {
 		servopts := client.ServiceOptions{}
 		changeID, err := rcmd.client.AutoStart(&servopts)
@@ -170,14 +336,35 @@ func runDaemon(rcmd *cmdRun, ch chan os.Signal) error {
 			logger.Noticef("Cannot start default services: %v", err)
 		} else {
 			logger.Noticef("Started default services with change %s.", changeID)
+			startChangeID = changeID
 		}
 	}
+	d.NotifyReady(startChangeID)
+
+	var done <-chan struct{}
+	if rcmd.onReady != nil {
+		done = rcmd.onReady(startChangeID)
+	}
 
 out:
 	for {
 		select {
 		case sig := <-ch:
 			logger.Noticef("Exiting on %s signal.\n", sig)
+			if sig == syscall.SIGTERM || pid1 {
+				// Let in-progress changes finish and stop services
+				// cleanly before exiting. As PID 1, SIGINT (and the
+				// other pid1Signals) are also a request to shut the
+				// container down.
+				if err := d.Drain(); err != nil {
+					logger.Noticef("Cannot stop services cleanly: %v", err)
+				}
+			}
+			break out
+		case <-done:
+			if err := d.Drain(); err != nil {
+				logger.Noticef("Cannot stop services cleanly: %v", err)
+			}
 			break out
 		case <-d.Dying():
 			// something called Stop()
@@ -0,0 +1,47 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"syscall"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+	"github.com/canonical/pebble/internal/daemon"
+)
+
+func (s *PebbleSuite) TestRunShutdownGracePeriod(c *C) {
+	var gracePeriod time.Duration
+	restore := pebble.FakeDaemonNew(func(opts *daemon.Options) (*daemon.Daemon, error) {
+		gracePeriod = opts.ShutdownGracePeriod
+		d, err := daemon.New(opts)
+		if err == nil {
+			// Shut the daemon down again once it's running.
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+			}()
+		}
+		return d, err
+	})
+	defer restore()
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"run", "--hold", "--shutdown-grace-period=45s"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(gracePeriod, Equals, 45*time.Second)
+}
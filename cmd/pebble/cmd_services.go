@@ -16,16 +16,25 @@ package main
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 
 	"github.com/canonical/pebble/client"
+	"github.com/canonical/pebble/internal/strutil/quantity"
 )
 
 type cmdServices struct {
 	clientMixin
+	formatMixin
+	pagerMixin
+	timeMixin
+	Verbose    bool `short:"v" long:"verbose"`
+	History    bool `long:"history"`
 	Positional struct {
-		Services []string `positional-arg-name:"<service>"`
+		Services []serviceName `positional-arg-name:"<service>"`
 	} `positional-args:"yes"`
 }
 
@@ -33,20 +42,89 @@ var shortServicesHelp = "Query the status of configured services"
 var longServicesHelp = `
 The services command lists status information about the services specified, or
 about all services if none are specified.
+
+With --verbose, details of each running service's process are also shown: its
+PID, how long it has been running, how many times it has been restarted
+automatically since it was last started, and its average CPU usage and
+resident memory.
+
+With --history, the recent state transitions of each service are shown
+instead, oldest first, with the reason for each (for example, that its process
+was killed by a signal).
+
+With --format=json or --format=yaml, a list of services is written, each with
+the fields "name", "startup" and "current". With --verbose, running services
+also have the fields "pid", "start-time", "cpu-time", "rss" (in bytes) and
+"restarts". With --history, each service also has a "history" list of
+transitions, with the fields "time", "state" and "reason".
 `
 
+var timeNow = time.Now
+
+// serviceOutput is the structured output for a service.
+type serviceOutput struct {
+	Name      string     `json:"name" yaml:"name"`
+	Startup   string     `json:"startup" yaml:"startup"`
+	Current   string     `json:"current" yaml:"current"`
+	PID       int        `json:"pid,omitempty" yaml:"pid,omitempty"`
+	StartTime *time.Time `json:"start-time,omitempty" yaml:"start-time,omitempty"`
+	CPUTime   string     `json:"cpu-time,omitempty" yaml:"cpu-time,omitempty"`
+	RSS       int64      `json:"rss,omitempty" yaml:"rss,omitempty"`
+	Restarts  int        `json:"restarts,omitempty" yaml:"restarts,omitempty"`
+
+	History []transitionOutput `json:"history,omitempty" yaml:"history,omitempty"`
+}
+
+// transitionOutput is the structured output for a service state transition.
+type transitionOutput struct {
+	Time   time.Time `json:"time" yaml:"time"`
+	State  string    `json:"state" yaml:"state"`
+	Reason string    `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
 func (cmd *cmdServices) Execute(args []string) error {
 	if len(args) > 0 {
 		return ErrExtraArgs
 	}
 
 	opts := client.ServicesOptions{
-		Names: cmd.Positional.Services,
+		Names:   serviceNames(cmd.Positional.Services),
+		History: cmd.History,
 	}
+	stop := cmd.startPager()
+	defer stop()
 	services, err := cmd.client.Services(&opts)
 	if err != nil {
 		return err
 	}
+	if cmd.structured() {
+		output := make([]serviceOutput, len(services))
+		for i, svc := range services {
+			output[i] = serviceOutput{
+				Name:    svc.Name,
+				Startup: string(svc.Startup),
+				Current: string(svc.Current),
+			}
+			if cmd.Verbose {
+				output[i].Restarts = svc.Restarts
+				if svc.PID != 0 {
+					startTime := svc.StartTime
+					output[i].PID = svc.PID
+					output[i].StartTime = &startTime
+					output[i].CPUTime = svc.CPUTime.String()
+					output[i].RSS = svc.RSS
+				}
+			}
+			for _, t := range svc.History {
+				output[i].History = append(output[i].History, transitionOutput{
+					Time:   t.Time,
+					State:  t.State,
+					Reason: t.Reason,
+				})
+			}
+		}
+		return cmd.writeStructured(output)
+	}
 	if len(services) == 0 {
 		if len(cmd.Positional.Services) == 0 {
 			fmt.Fprintln(Stderr, "Plan has no services")
@@ -59,14 +137,70 @@ func (cmd *cmdServices) Execute(args []string) error {
 	w := tabWriter()
 	defer w.Flush()
 
-	fmt.Fprintln(w, "Service\tStartup\tCurrent")
+	esc := colorEscapes()
+	if cmd.History {
+		hasHistory := false
+		for _, svc := range services {
+			hasHistory = hasHistory || len(svc.History) > 0
+		}
+		if !hasHistory {
+			fmt.Fprintln(Stderr, "No state transitions recorded")
+			return nil
+		}
+		fmt.Fprintln(w, "Service\tTime\tState\tReason")
+		for _, svc := range services {
+			for _, t := range svc.History {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", svc.Name, cmd.fmtTime(t.Time), t.State, t.Reason)
+			}
+		}
+		return nil
+	}
+	if cmd.Verbose {
+		// The current status is colored, so color its heading too to keep
+		// the columns after it aligned.
+		fmt.Fprintf(w, "Service\tStartup\t%s\tPID\tUptime\tRestarts\tCPU\tRSS\n", esc.colored(esc.plain, "Current"))
+		now := timeNow()
+		for _, svc := range services {
+			pid, uptime, cpu, rss := processColumns(svc, now)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", svc.Name, svc.Startup,
+				esc.serviceStatus(svc.Current), pid, uptime, svc.Restarts, cpu, rss)
+		}
+		return nil
+	}
 
+	fmt.Fprintln(w, "Service\tStartup\tCurrent")
 	for _, svc := range services {
-		fmt.Fprintf(w, "%s\t%s\t%s\n", svc.Name, svc.Startup, svc.Current)
+		fmt.Fprintf(w, "%s\t%s\t%s\n", svc.Name, svc.Startup, esc.serviceStatus(svc.Current))
 	}
 	return nil
 }
 
+// processColumns returns the PID, uptime, CPU usage and resident memory of
+// a service's process for display, or dashes if it isn't running.
+func processColumns(svc *client.ServiceInfo, now time.Time) (pid, uptime, cpu, rss string) {
+	if svc.PID == 0 {
+		return "-", "-", "-", "-"
+	}
+	elapsed := now.Sub(svc.StartTime)
+	pid = strconv.Itoa(svc.PID)
+	uptime = strings.TrimSpace(quantity.FormatDuration(elapsed.Seconds()))
+	cpu = formatCPUPercent(svc.CPUTime, elapsed)
+	rss = strings.TrimSpace(quantity.FormatAmount(uint64(svc.RSS), -1)) + "B"
+	return pid, uptime, cpu, rss
+}
+
+// formatCPUPercent formats the CPU usage of a process that has used cpuTime
+// while running for elapsed, as a percentage of one CPU (like ps does).
+func formatCPUPercent(cpuTime, elapsed time.Duration) string {
+	if elapsed <= 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*cpuTime.Seconds()/elapsed.Seconds())
+}
+
 func init() {
-	addCommand("services", shortServicesHelp, longServicesHelp, func() flags.Commander { return &cmdServices{} }, nil, nil)
+	addCommand("services", shortServicesHelp, longServicesHelp, func() flags.Commander { return &cmdServices{} }, merge(formatDescs, pagerDescs, timeDescs, map[string]string{
+		"verbose": "Show details of each running service's process",
+		"history": "Show the recent state transitions of each service",
+	}), nil)
 }
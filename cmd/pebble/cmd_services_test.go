@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -75,3 +77,244 @@ foo      enabled   inactive
 `[1:])
 	c.Check(s.Stderr(), check.Equals, "")
 }
+
+func (s *PebbleSuite) TestServicesFormat(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, check.Equals, "GET")
+		c.Assert(r.URL.Path, check.Equals, "/v1/services")
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+		{"name": "svc1", "current": "inactive", "startup": "enabled"},
+		{"name": "svc2", "current": "active", "startup": "disabled"}
+	]
+}`)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"services", "--format", "json"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+[
+    {
+        "name": "svc1",
+        "startup": "enabled",
+        "current": "inactive"
+    },
+    {
+        "name": "svc2",
+        "startup": "disabled",
+        "current": "active"
+    }
+]
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+
+	s.ResetStdStreams()
+	rest, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"services", "--format", "yaml"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+- name: svc1
+  startup: enabled
+  current: inactive
+- name: svc2
+  startup: disabled
+  current: active
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+const verboseServicesResponse = `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+		{"name": "svc1", "current": "inactive", "startup": "enabled"},
+		{"name": "svc2", "current": "active", "startup": "disabled", "pid": 1234,
+		 "start-time": "2021-04-10T12:00:00Z", "cpu-time": "30s", "rss": 12345678,
+		 "restarts": 2}
+	]
+}`
+
+func (s *PebbleSuite) TestServicesVerbose(c *check.C) {
+	restore := pebble.FakeTimeNow(time.Date(2021, 4, 10, 12, 10, 0, 0, time.UTC))
+	defer restore()
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, check.Equals, "GET")
+		c.Assert(r.URL.Path, check.Equals, "/v1/services")
+		fmt.Fprint(w, verboseServicesResponse)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"services", "--verbose"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+Service  Startup   Current   PID   Uptime  Restarts  CPU   RSS
+svc1     enabled   inactive  -     -       0         -     -
+svc2     disabled  active    1234  10.0m   2         5.0%  12.3MB
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestServicesVerboseFormat(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, verboseServicesResponse)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"services", "--verbose", "--format", "yaml"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+- name: svc1
+  startup: enabled
+  current: inactive
+- name: svc2
+  startup: disabled
+  current: active
+  pid: 1234
+  start-time: 2021-04-10T12:00:00Z
+  cpu-time: 30s
+  rss: 12345678
+  restarts: 2
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestServicesHistory(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.Method, check.Equals, "GET")
+		c.Assert(r.URL.Path, check.Equals, "/v1/services")
+		c.Assert(r.URL.Query(), check.DeepEquals, url.Values{"names": {"svc1"}, "history": {"true"}})
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+		{"name": "svc1", "current": "backoff", "startup": "enabled", "history": [
+			{"time": "2021-04-10T12:00:00Z", "state": "starting", "reason": "process started"},
+			{"time": "2021-04-10T12:00:01Z", "state": "running", "reason": "running after okay-delay"},
+			{"time": "2021-04-10T12:05:00Z", "state": "backoff", "reason": "killed by SIGKILL"}
+		]}
+	]
+}`)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"services", "--history", "--abs-time", "svc1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+Service  Time                  State     Reason
+svc1     2021-04-10T12:00:00Z  starting  process started
+svc1     2021-04-10T12:00:01Z  running   running after okay-delay
+svc1     2021-04-10T12:05:00Z  backoff   killed by SIGKILL
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+
+	s.ResetStdStreams()
+	rest, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"services", "--history", "--format", "yaml", "svc1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+- name: svc1
+  startup: enabled
+  current: backoff
+  history:
+    - time: 2021-04-10T12:00:00Z
+      state: starting
+      reason: process started
+    - time: 2021-04-10T12:00:01Z
+      state: running
+      reason: running after okay-delay
+    - time: 2021-04-10T12:05:00Z
+      state: backoff
+      reason: killed by SIGKILL
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestServicesHistoryEmpty(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": [
+			{"name": "svc1", "current": "inactive", "startup": "enabled"}
+		]}`)
+	})
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"services", "--history"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "")
+	c.Check(s.Stderr(), check.Equals, "No state transitions recorded\n")
+}
+
+func (s *PebbleSuite) TestServicesFormatNoServices(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"services", "--format", "json"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "[]\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestServicesFormatInvalid(c *check.C) {
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"services", "--format", "xml"})
+	c.Assert(err, check.ErrorMatches, `Invalid value .xml. for option .--format.*`)
+}
+
+func (s *PebbleSuite) TestServicesColor(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+		{"name": "bar", "current": "active", "startup": "disabled"},
+		{"name": "foo", "current": "error", "startup": "enabled"}
+	]
+}`)
+	})
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"--color=always", "services"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, ""+
+		"Service  Startup   Current\n"+
+		"bar      disabled  \x1b[32mactive\x1b[0m\n"+
+		"foo      enabled   \x1b[31merror\x1b[0m\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
+
+func (s *PebbleSuite) TestServicesPager(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+    "type": "sync",
+    "status-code": 200,
+    "result": [
+		{"name": "bar", "current": "active", "startup": "disabled"},
+		{"name": "foo", "current": "inactive", "startup": "enabled"}
+	]
+}`)
+	})
+	defer pebble.FakeIsStdoutTTY(true)()
+	os.Setenv("PAGER", "sed s/^/paged:/")
+	defer os.Unsetenv("PAGER")
+	const output = "" +
+		"Service  Startup   Current\n" +
+		"bar      disabled  active\n" +
+		"foo      enabled   inactive\n"
+
+	// Output that fits on the terminal is written directly.
+	restore := pebble.FakeTermSize(80, 4)
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"--color=never", "services"})
+	restore()
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, output)
+	s.ResetStdStreams()
+
+	// Longer output goes through the pager, unless it's disabled.
+	defer pebble.FakeTermSize(80, 3)()
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"--color=never", "services"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, ""+
+		"paged:Service  Startup   Current\n"+
+		"paged:bar      disabled  active\n"+
+		"paged:foo      enabled   inactive\n")
+	s.ResetStdStreams()
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"--color=never", "services", "--no-pager"})
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, output)
+}
@@ -26,8 +26,8 @@ import (
 type cmdSignal struct {
 	clientMixin
 	Positional struct {
-		Signal   string   `positional-arg-name:"<SIGNAL>"`
-		Services []string `positional-arg-name:"<service>"`
+		Signal   string        `positional-arg-name:"<SIGNAL>"`
+		Services []serviceName `positional-arg-name:"<service>"`
 	} `positional-args:"yes" required:"yes"`
 }
 
@@ -48,7 +48,7 @@ func (cmd *cmdSignal) Execute(args []string) error {
 	}
 	opts := client.SendSignalOptions{
 		Signal:   cmd.Positional.Signal,
-		Services: cmd.Positional.Services,
+		Services: serviceNames(cmd.Positional.Services),
 	}
 	err := cmd.client.SendSignal(&opts)
 	if err != nil {
@@ -15,6 +15,8 @@
 package main
 
 import (
+	"errors"
+
 	"github.com/canonical/pebble/client"
 	"github.com/jessevdk/go-flags"
 )
@@ -22,18 +24,39 @@ import (
 var shortStartHelp = "Start a service and its dependencies"
 var longStartHelp = `
 The start command starts the service with the provided name and
-any other services it depends on, in the correct order.
+any other services it depends on, in the correct order. Instances of
+template services are started by appending the instance parameter to
+the template name, for example "worker@3".
+
+With --autostart, it instead starts all the services with "startup: enabled",
+as the daemon does when it starts.
+
+Arguments after "--" replace the default arguments of the service's command,
+which are given in a trailing "[ ... ]" group in the plan. For example, with
+"command: server --port 80 [ --verbose ]", "pebble start srv -- --quiet"
+runs "server --port 80 --quiet". Only one service may be given with
+arguments, and they are kept when the service is restarted automatically.
 `
 
 type cmdStart struct {
 	waitMixin
+	AutoStart  bool `long:"autostart"`
 	Positional struct {
-		Services []string `positional-arg-name:"<service>" required:"1"`
+		Services []serviceName `positional-arg-name:"<service>"`
 	} `positional-args:"yes"`
+
+	// serviceArgs holds the arguments after "--", or nil if there was none.
+	serviceArgs []string
 }
 
 func init() {
-	addCommand("start", shortStartHelp, longStartHelp, func() flags.Commander { return &cmdStart{} }, waitDescs, nil)
+	addCommand("start", shortStartHelp, longStartHelp, func() flags.Commander { return &cmdStart{} }, merge(waitDescs, map[string]string{
+		"autostart": "Start the services that are enabled at startup",
+	}), nil)
+}
+
+func (cmd *cmdStart) setDoubleDashArgs(args []string) {
+	cmd.serviceArgs = args
 }
 
 func (cmd cmdStart) Execute(args []string) error {
@@ -41,10 +64,36 @@ func (cmd cmdStart) Execute(args []string) error {
 		return ErrExtraArgs
 	}
 
+	names := serviceNames(cmd.Positional.Services)
+	var serviceArgs []string
+	if cmd.serviceArgs != nil && len(cmd.serviceArgs) <= len(names) {
+		n := len(names) - len(cmd.serviceArgs)
+		names, serviceArgs = names[:n], names[n:]
+	}
+
+	if cmd.AutoStart && (len(names) > 0 || serviceArgs != nil) {
+		return errors.New("cannot specify services with --autostart")
+	}
+	if !cmd.AutoStart && len(names) == 0 {
+		return errors.New("must specify one or more services, or --autostart")
+	}
+
 	servopts := client.ServiceOptions{
-		Names: cmd.Positional.Services,
+		Names: names,
+	}
+	if serviceArgs != nil {
+		if len(names) != 1 {
+			return errors.New("must specify exactly one service with arguments")
+		}
+		servopts.Args = map[string][]string{names[0]: serviceArgs}
+	}
+	var changeID string
+	var err error
+	if cmd.AutoStart {
+		changeID, err = cmd.client.AutoStart(&servopts)
+	} else {
+		changeID, err = cmd.client.Start(&servopts)
 	}
-	changeID, err := cmd.client.Start(&servopts)
 	if err != nil {
 		return err
 	}
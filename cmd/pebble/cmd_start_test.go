@@ -0,0 +1,100 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) TestStart(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/services")
+		assertBodyEquals(c, r.Body, map[string]interface{}{
+			"action":   "start",
+			"services": []interface{}{"srv1", "srv2"},
+		})
+		fmt.Fprint(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"start", "--no-wait", "srv1", "srv2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "42\n")
+}
+
+func (s *PebbleSuite) TestStartAutoStart(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/services")
+		assertBodyEquals(c, r.Body, map[string]interface{}{
+			"action":   "autostart",
+			"services": nil,
+		})
+		fmt.Fprint(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"start", "--autostart", "--no-wait"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "42\n")
+}
+
+func (s *PebbleSuite) TestStartErrors(c *check.C) {
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"start", "--autostart", "srv1"})
+	c.Check(err, check.ErrorMatches, "cannot specify services with --autostart")
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"start"})
+	c.Check(err, check.ErrorMatches, "must specify one or more services, or --autostart")
+}
+
+func (s *PebbleSuite) TestStartArgs(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/services")
+		assertBodyEquals(c, r.Body, map[string]interface{}{
+			"action":   "start",
+			"services": []interface{}{"srv1"},
+			"args": map[string]interface{}{
+				"srv1": []interface{}{"--port", "8080"},
+			},
+		})
+		fmt.Fprint(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+	})
+
+	restore := fakeArgs("pebble", "start", "--no-wait", "srv1", "--", "--port", "8080")
+	defer restore()
+
+	err := pebble.RunMain()
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "42\n")
+}
+
+func (s *PebbleSuite) TestStartArgsErrors(c *check.C) {
+	restore := fakeArgs("pebble", "start", "srv1", "srv2", "--", "--port", "8080")
+	defer restore()
+	err := pebble.RunMain()
+	c.Check(err, check.ErrorMatches, "must specify exactly one service with arguments")
+
+	restore = fakeArgs("pebble", "start", "--autostart", "--", "--port")
+	defer restore()
+	err = pebble.RunMain()
+	c.Check(err, check.ErrorMatches, "cannot specify services with --autostart")
+}
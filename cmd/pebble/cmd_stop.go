@@ -28,7 +28,7 @@ any other service that depends on it, in the correct order.
 type cmdStop struct {
 	waitMixin
 	Positional struct {
-		Services []string `positional-arg-name:"<service>" required:"1"`
+		Services []serviceName `positional-arg-name:"<service>" required:"1"`
 	} `positional-args:"yes"`
 }
 
@@ -42,7 +42,7 @@ func (cmd cmdStop) Execute(args []string) error {
 	}
 
 	servopts := client.ServiceOptions{
-		Names: cmd.Positional.Services,
+		Names: serviceNames(cmd.Positional.Services),
 	}
 	changeID, err := cmd.client.Stop(&servopts)
 	if err != nil {
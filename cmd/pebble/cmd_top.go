@@ -0,0 +1,242 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"golang.org/x/sys/unix"
+
+	"github.com/canonical/pebble/client"
+	"github.com/canonical/pebble/internal/ptyutil"
+)
+
+type cmdTop struct {
+	clientMixin
+	Refresh time.Duration `long:"refresh" default:"2s"`
+}
+
+var shortTopHelp = "Show a live view of services"
+var longTopHelp = `
+The top command shows a screen of services with their status, and the PID,
+uptime, CPU and memory usage of those running, along with how many times each
+has been restarted automatically. The screen is refreshed every couple of
+seconds (or as often as --refresh says).
+
+Select a service with the up and down arrow keys (or k and j), then press s to
+start it, t to stop it, or r to restart it. Press q to quit.
+`
+
+// Special keys read by readTopKeys, outside the range of bytes.
+const (
+	topKeyUp = 0x100 + iota
+	topKeyDown
+)
+
+// makeStdinRaw puts the terminal on stdin in raw mode, so that keys can be
+// read as they're pressed, and returns a function to restore it.
+var makeStdinRaw = func() (restore func(), err error) {
+	oldState, err := ptyutil.MakeRaw(unix.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	return func() { ptyutil.Restore(unix.Stdin, oldState) }, nil
+}
+
+func (cmd *cmdTop) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+	if cmd.Refresh <= 0 {
+		return fmt.Errorf("refresh interval must be positive, not %s", cmd.Refresh)
+	}
+	if !isStdinTTY || !isStdoutTTY {
+		return errors.New("top must be run in a terminal")
+	}
+
+	restore, err := makeStdinRaw()
+	if err != nil {
+		return fmt.Errorf("cannot change terminal to raw mode: %v", err)
+	}
+	defer restore()
+
+	keys := make(chan int)
+	go readTopKeys(Stdin, keys)
+
+	ticker := time.NewTicker(cmd.Refresh)
+	defer ticker.Stop()
+
+	var services []*client.ServiceInfo
+	var selected int
+	var message string
+	for {
+		latest, err := cmd.client.Services(&client.ServicesOptions{})
+		if err != nil {
+			message = err.Error()
+		} else {
+			services = latest
+		}
+		if selected >= len(services) {
+			selected = len(services) - 1
+		}
+		if selected < 0 {
+			selected = 0
+		}
+		cmd.draw(Stdout, services, selected, message)
+
+		select {
+		case <-ticker.C:
+		case key, ok := <-keys:
+			if !ok {
+				// Stdin closed, nothing more to do.
+				fmt.Fprint(Stdout, "\r\n")
+				return nil
+			}
+			message = ""
+			switch key {
+			case 'q', 'Q', 3: // 3 is Ctrl-C, as raw mode disables signals
+				fmt.Fprint(Stdout, "\r\n")
+				return nil
+			case topKeyUp, 'k':
+				if selected > 0 {
+					selected--
+				}
+			case topKeyDown, 'j':
+				if selected < len(services)-1 {
+					selected++
+				}
+			case 's', 't', 'r':
+				if len(services) > 0 {
+					message = cmd.act(key, services[selected].Name)
+				}
+			}
+		}
+	}
+}
+
+// act starts, stops or restarts the named service, without waiting for the
+// change to complete, and returns a message describing what happened.
+func (cmd *cmdTop) act(key int, name string) string {
+	opts := client.ServiceOptions{Names: []string{name}}
+	var changeID string
+	var err error
+	var verb string
+	switch key {
+	case 's':
+		verb = "Starting"
+		changeID, err = cmd.client.Start(&opts)
+	case 't':
+		verb = "Stopping"
+		changeID, err = cmd.client.Stop(&opts)
+	case 'r':
+		verb = "Restarting"
+		changeID, err = cmd.client.Restart(&opts)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("%s %q (change %s)", verb, name, changeID)
+}
+
+// draw writes a screen of the given services to w, marking the selected
+// one, and showing message (if any) below them.
+func (cmd *cmdTop) draw(w io.Writer, services []*client.ServiceInfo, selected int, message string) {
+	now := timeNow()
+	_, height := termSize()
+
+	// Leave room for the header lines and the help and message lines, and
+	// scroll so the selected service is visible.
+	rows := height - 5
+	if rows < 1 {
+		rows = 1
+	}
+	first := 0
+	if selected >= rows {
+		first = selected - rows + 1
+	}
+	last := first + rows
+	if last > len(services) {
+		last = len(services)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Services at %s, refreshed every %s\n\n", now.Format("15:04:05"), cmd.Refresh)
+	tw := tabWriterTo(&buf)
+	esc := colorEscapes()
+	fmt.Fprintf(tw, "  Service\tStartup\t%s\tPID\tUptime\tRestarts\tCPU\tRSS\n", esc.colored(esc.plain, "Current"))
+	for i := first; i < last; i++ {
+		svc := services[i]
+		marker := " "
+		if i == selected {
+			marker = ">"
+		}
+		pid, uptime, cpu, rss := processColumns(svc, now)
+		fmt.Fprintf(tw, "%s %s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", marker, svc.Name, svc.Startup,
+			esc.serviceStatus(svc.Current), pid, uptime, svc.Restarts, cpu, rss)
+	}
+	tw.Flush()
+	if len(services) == 0 {
+		fmt.Fprintln(&buf, "Plan has no services")
+	}
+	fmt.Fprintln(&buf, "\n[s]tart  s[t]op  [r]estart  [q]uit")
+	if message != "" {
+		fmt.Fprintln(&buf, message)
+	}
+
+	// Clear the screen and move to the top left before drawing. The terminal
+	// is in raw mode, so each line must also return the cursor.
+	fmt.Fprint(w, "\033[H\033[2J"+strings.ReplaceAll(buf.String(), "\n", "\r\n"))
+}
+
+// readTopKeys reads keys pressed from r and sends them to keys, closing it
+// when r is closed or can't be read.
+func readTopKeys(r io.Reader, keys chan<- int) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		for i := 0; i < n; i++ {
+			b := buf[i]
+			// Arrow keys are sent as escape sequences: ESC [ A for up,
+			// and ESC [ B for down.
+			if b == 0x1b && i+2 < n && buf[i+1] == '[' {
+				switch buf[i+2] {
+				case 'A':
+					keys <- topKeyUp
+				case 'B':
+					keys <- topKeyDown
+				}
+				i += 2
+				continue
+			}
+			keys <- int(b)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func init() {
+	addCommand("top", shortTopHelp, longTopHelp, func() flags.Commander { return &cmdTop{} }, map[string]string{
+		"refresh": "How often to refresh the screen",
+	}, nil)
+}
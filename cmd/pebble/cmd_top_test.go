@@ -0,0 +1,101 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) TestTopNotTerminal(c *check.C) {
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"top"})
+	c.Assert(err, check.ErrorMatches, "top must be run in a terminal")
+}
+
+func (s *PebbleSuite) TestTopBadRefresh(c *check.C) {
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"top", "--refresh", "0s"})
+	c.Assert(err, check.ErrorMatches, "refresh interval must be positive, not 0s")
+}
+
+func (s *PebbleSuite) TestTop(c *check.C) {
+	defer pebble.FakeIsStdinTTY(true)()
+	defer pebble.FakeIsStdoutTTY(true)()
+	defer pebble.FakeTermSize(80, 24)()
+	defer pebble.FakeTimeNow(time.Date(2021, 4, 10, 12, 10, 0, 0, time.UTC))()
+	rawRestored := false
+	defer pebble.FakeMakeStdinRaw(func() (func(), error) {
+		return func() { rawRestored = true }, nil
+	})()
+
+	var posted []map[string]interface{}
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Assert(r.URL.Path, check.Equals, "/v1/services")
+		switch r.Method {
+		case "GET":
+			fmt.Fprint(w, verboseServicesResponse)
+		case "POST":
+			var body map[string]interface{}
+			c.Assert(json.NewDecoder(r.Body).Decode(&body), check.IsNil)
+			posted = append(posted, body)
+			fmt.Fprint(w, `{"type": "async", "status-code": 202, "change": "42"}`)
+		default:
+			c.Fatalf("unexpected method %s", r.Method)
+		}
+	})
+
+	// Move down to the second service with the arrow key, restart it, and
+	// quit.
+	s.stdin.WriteString("\033[Brq")
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"--color=never", "top"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(rawRestored, check.Equals, true)
+
+	c.Check(posted, check.DeepEquals, []map[string]interface{}{
+		{"action": "restart", "services": []interface{}{"svc2"}},
+	})
+
+	// Each key redraws the screen, so the last one shows the result.
+	screens := strings.Split(s.Stdout(), "\033[H\033[2J")
+	c.Assert(screens, check.HasLen, 4)
+	c.Check(screens[0], check.Equals, "")
+	c.Check(screens[1], check.Equals, strings.ReplaceAll(`
+Services at 12:10:00, refreshed every 2s
+
+  Service  Startup   Current   PID   Uptime  Restarts  CPU   RSS
+> svc1     enabled   inactive  -     -       0         -     -
+  svc2     disabled  active    1234  10.0m   2         5.0%  12.3MB
+
+[s]tart  s[t]op  [r]estart  [q]uit
+`[1:], "\n", "\r\n"))
+	c.Check(screens[3], check.Equals, strings.ReplaceAll(`
+Services at 12:10:00, refreshed every 2s
+
+  Service  Startup   Current   PID   Uptime  Restarts  CPU   RSS
+  svc1     enabled   inactive  -     -       0         -     -
+> svc2     disabled  active    1234  10.0m   2         5.0%  12.3MB
+
+[s]tart  s[t]op  [r]estart  [q]uit
+Restarting "svc2" (change 42)
+`[1:], "\n", "\r\n")+"\r\n")
+	c.Check(s.Stderr(), check.Equals, "")
+}
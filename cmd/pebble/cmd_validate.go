@@ -0,0 +1,212 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jessevdk/go-flags"
+	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/pebble/internal/plan"
+)
+
+type cmdValidate struct {
+	LayersDirs []string `long:"layers-dir"`
+	Positional struct {
+		Path string `positional-arg-name:"<dir|file>" required:"1"`
+	} `positional-args:"yes"`
+}
+
+var shortValidateHelp = "Validate plan layers without a running daemon"
+var longValidateHelp = `
+The validate command parses and combines the layers in the given directory
+(a Pebble directory with a "layers" sub-directory, or a layers directory
+itself), or a single layer file, without contacting the Pebble daemon.
+
+When validating a Pebble directory, the drop-in layers in its "layers.d"
+sub-directory and in any --layers-dir directories are included, as with
+"pebble run".
+
+Errors such as unknown fields, invalid values, and dependency cycles are
+reported with their position in the layer file where possible, and the
+command exits with a non-zero status if the plan is invalid.
+`
+
+func (cmd *cmdValidate) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	path := cmd.Positional.Path
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	var layersDir string
+	var layers []*plan.Layer
+	if info.IsDir() {
+		layersDir = path
+		if info, statErr := os.Stat(filepath.Join(path, "layers")); statErr == nil && info.IsDir() {
+			layersDir = filepath.Join(path, "layers")
+			layers, err = plan.ReadLayers(path, cmd.LayersDirs...)
+		} else {
+			layers, err = plan.ReadLayersDir(layersDir)
+		}
+	} else {
+		layersDir = filepath.Dir(path)
+		var layer *plan.Layer
+		layer, err = plan.ReadLayerFile(path)
+		layers = []*plan.Layer{layer}
+	}
+	var combined *plan.Layer
+	if err == nil {
+		combined, err = plan.CombineLayers(layers...)
+	}
+	if err == nil {
+		err = combined.ExpandVars()
+	}
+	if err != nil {
+		return validateError(err, layersDir, path, layers)
+	}
+
+	fmt.Fprintf(Stdout, "Plan is valid (%d layers, %d services)\n", len(layers), len(combined.Services))
+	return nil
+}
+
+// validateError returns err prefixed with the file, line, and column the
+// error refers to, if that can be determined.
+func validateError(err error, layersDir, path string, layers []*plan.Layer) error {
+	ferr, ok := err.(*plan.FormatError)
+	if !ok || (ferr.Layer == "" && ferr.Service == "") {
+		return err
+	}
+
+	label := ferr.Layer
+	if label == "" {
+		// Error in the combined plan: find the last layer defining the service.
+		for i := len(layers) - 1; i >= 0; i-- {
+			if layers[i] != nil && layers[i].Services[ferr.Service] != nil {
+				label = layers[i].Label
+				break
+			}
+		}
+	}
+	filename := layerFilename(label, layersDir, path)
+	if filename == "" {
+		return err
+	}
+	data, readErr := ioutil.ReadFile(filename)
+	if readErr != nil {
+		return err
+	}
+
+	var keys []string
+	if ferr.Service == "" && ferr.Field == "" {
+		// Error applies to the whole file (parse errors include the line).
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	if ferr.Service != "" {
+		keys = append(keys, "services", ferr.Service)
+	}
+	if ferr.Field != "" {
+		keys = append(keys, ferr.Field)
+	}
+	line, column, found := yamlPosition(data, keys)
+	minFound := len(keys)
+	if ferr.Service != "" {
+		// Fall back to the service's position if the field is not present.
+		minFound = 2
+	}
+	if found < minFound {
+		return err
+	}
+	return fmt.Errorf("%s:%d:%d: %v", filename, line, column, err)
+}
+
+// layerFilename returns the filename of the layer (or included file) with
+// the given label, or "" if it cannot be found.
+func layerFilename(label, layersDir, path string) string {
+	if label == "" {
+		return ""
+	}
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		// Validating a single file, which may be the layer itself.
+		base := filepath.Base(path)
+		if base == label || fnameLabel(base) == label {
+			return path
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(layersDir, "[0-9][0-9][0-9]-"+label+".yaml"))
+	if len(matches) > 0 {
+		return matches[0]
+	}
+	included := filepath.Join(layersDir, label)
+	if _, err := os.Stat(included); err == nil {
+		return included
+	}
+	return ""
+}
+
+// fnameLabel returns the label part of a layer filename such as
+// "001-base.yaml", or "" if the filename is not in that form.
+func fnameLabel(filename string) string {
+	if len(filename) < 10 || filename[3] != '-' || filepath.Ext(filename) != ".yaml" {
+		return ""
+	}
+	return filename[4 : len(filename)-len(".yaml")]
+}
+
+// yamlPosition returns the line and column of the mapping key found by
+// following keys from the document's root, along with the number of keys
+// found. If not all keys are found, the position of the deepest key found
+// is returned.
+func yamlPosition(data []byte, keys []string) (line, column, found int) {
+	var doc yaml.Node
+	err := yaml.Unmarshal(data, &doc)
+	if err != nil || len(doc.Content) == 0 {
+		return 0, 0, 0
+	}
+	node := doc.Content[0]
+	line, column = node.Line, node.Column
+	for _, key := range keys {
+		if node.Kind != yaml.MappingNode {
+			break
+		}
+		var value *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line, column = node.Content[i].Line, node.Content[i].Column
+				value = node.Content[i+1]
+				break
+			}
+		}
+		if value == nil {
+			break
+		}
+		node = value
+		found++
+	}
+	return line, column, found
+}
+
+func init() {
+	addCommand("validate", shortValidateHelp, longValidateHelp, func() flags.Commander { return &cmdValidate{} }, map[string]string{
+		"layers-dir": "Extra directory of drop-in layers (may be repeated)",
+	}, nil)
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func writeLayers(c *check.C, layers map[string]string) string {
+	dir := c.MkDir()
+	layersDir := filepath.Join(dir, "layers")
+	err := os.Mkdir(layersDir, 0755)
+	c.Assert(err, check.IsNil)
+	for name, content := range layers {
+		err := ioutil.WriteFile(filepath.Join(layersDir, name), []byte(content), 0644)
+		c.Assert(err, check.IsNil)
+	}
+	return dir
+}
+
+func (s *PebbleSuite) TestValidate(c *check.C) {
+	dir := writeLayers(c, map[string]string{
+		"001-base.yaml": `
+services:
+    srv1:
+        override: replace
+        command: cmd
+`,
+		"002-more.yaml": `
+services:
+    srv1:
+        override: merge
+        environment:
+            FOO: bar
+    srv2:
+        override: replace
+        command: cmd
+`,
+	})
+
+	for _, path := range []string{dir, filepath.Join(dir, "layers")} {
+		rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"validate", path})
+		c.Assert(err, check.IsNil)
+		c.Assert(rest, check.HasLen, 0)
+		c.Check(s.Stdout(), check.Equals, "Plan is valid (2 layers, 2 services)\n")
+		c.Check(s.Stderr(), check.Equals, "")
+		s.ResetStdStreams()
+	}
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"validate", filepath.Join(dir, "layers", "001-base.yaml")})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, "Plan is valid (1 layers, 1 services)\n")
+}
+
+func (s *PebbleSuite) TestValidateErrors(c *check.C) {
+	tests := []struct {
+		layers map[string]string
+		error  string
+	}{{
+		layers: map[string]string{"001-base.yaml": `
+services:
+    srv1:
+        override: replace
+        command: cmd
+        future: true
+`},
+		error: `(?s).*/layers/001-base.yaml: cannot parse layer "base": .*line 6: field future not found.*`,
+	}, {
+		layers: map[string]string{"001-base.yaml": `
+services:
+    srv1:
+        override: replace
+        command: cmd
+        on-success: foo
+`},
+		error: `.*/layers/001-base.yaml:6:9: invalid on-success action "foo"`,
+	}, {
+		layers: map[string]string{"001-base.yaml": `
+services:
+    srv1:
+        override: foo
+        command: cmd
+`},
+		error: `.*/layers/001-base.yaml:4:9: layer "base" has invalid "override" value for service "srv1"`,
+	}, {
+		layers: map[string]string{
+			"001-base.yaml": `
+services:
+    srv1:
+        override: replace
+        command: cmd
+        after: [srv2]
+`,
+			"002-more.yaml": `
+services:
+    srv2:
+        override: replace
+        command: cmd
+        after: [srv1]
+`},
+		error: `.*/layers/00[12]-(base|more).yaml:3:5: services in before/after loop: srv1, srv2`,
+	}, {
+		layers: map[string]string{"001-base.yaml": `
+services:
+    srv1:
+        override: replace
+        command: cmd ${missing}
+`},
+		error: `.*/layers/001-base.yaml:5:9: service "srv1" command references undefined variable "missing"`,
+	}}
+
+	for _, test := range tests {
+		dir := writeLayers(c, test.layers)
+		_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"validate", dir})
+		c.Check(err, check.ErrorMatches, test.error)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+)
+
+type cmdWait struct {
+	clientMixin
+	Positional struct {
+		IDs []changeID `positional-arg-name:"<change-id>" required:"1"`
+	} `positional-args:"yes"`
+}
+
+var shortWaitHelp = "Wait for changes to finish"
+var longWaitHelp = `
+The wait command waits for the given changes to finish, for example changes
+started earlier with 'pebble start --no-wait'. It fails if any of the changes
+fail. Interrupting the command stops waiting, but doesn't abort the changes.
+`
+
+func init() {
+	addCommand("wait", shortWaitHelp, longWaitHelp, func() flags.Commander { return &cmdWait{} }, nil, nil)
+}
+
+func (cmd *cmdWait) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	waiter := waitMixin{clientMixin: cmd.clientMixin, skipAbort: true}
+	if len(cmd.Positional.IDs) == 1 {
+		_, err := waiter.wait(string(cmd.Positional.IDs[0]))
+		return err
+	}
+
+	// Wait for all the changes, even if some fail, so that the command
+	// only returns once they're all finished.
+	var errors []string
+	for _, id := range cmd.Positional.IDs {
+		_, err := waiter.wait(string(id))
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("change %s: %v", id, err))
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("%s", strings.Join(errors, "\n"))
+	}
+	return nil
+}
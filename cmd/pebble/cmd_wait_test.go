@@ -0,0 +1,72 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) TestWait(c *check.C) {
+	requests := map[string]int{}
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "GET")
+		c.Check(r.URL.Query().Get("wait"), check.Equals, "1s")
+		requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/v1/changes/1":
+			if requests[r.URL.Path] < 2 {
+				fmt.Fprint(w, `{"type": "sync", "result": {"id": "1", "status": "Doing", "ready": false}}`)
+			} else {
+				fmt.Fprint(w, `{"type": "sync", "result": {"id": "1", "status": "Done", "ready": true}}`)
+			}
+		case "/v1/changes/2":
+			fmt.Fprint(w, `{"type": "sync", "result": {"id": "2", "status": "Done", "ready": true}}`)
+		default:
+			c.Fatalf("unexpected path %q", r.URL.Path)
+		}
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"wait", "1", "2"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(requests, check.DeepEquals, map[string]int{"/v1/changes/1": 2, "/v1/changes/2": 1})
+}
+
+func (s *PebbleSuite) TestWaitErrors(c *check.C) {
+	requests := 0
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/v1/changes/1":
+			fmt.Fprint(w, `{"type": "sync", "result": {"id": "1", "status": "Error", "ready": true, "err": "boom"}}`)
+		case "/v1/changes/2":
+			fmt.Fprint(w, `{"type": "sync", "result": {"id": "2", "status": "Done", "ready": true}}`)
+		case "/v1/changes/3":
+			fmt.Fprint(w, `{"type": "error", "status-code": 404, "result": {"message": "cannot find change with id \"3\""}}`)
+		}
+	})
+
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"wait", "1", "2", "3"})
+	c.Assert(err, check.ErrorMatches, `change 1: boom\nchange 3: cannot find change with id "3"`)
+	c.Check(requests, check.Equals, 3)
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"wait", "1"})
+	c.Assert(err, check.ErrorMatches, `boom`)
+}
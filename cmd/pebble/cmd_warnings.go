@@ -35,6 +35,8 @@ type cmdWarnings struct {
 	clientMixin
 	timeMixin
 	unicodeMixin
+	formatMixin
+	pagerMixin
 	All     bool `long:"all"`
 	Verbose bool `long:"verbose"`
 }
@@ -50,8 +52,23 @@ silence them. A warning that's been silenced in this way will not be listed
 again unless it happens again, _and_ a cooldown time has passed.
 
 Warnings expire automatically, and once expired they are forgotten.
+
+With --format=json or --format=yaml, a list of warnings is written, each with
+the fields "message", "first-added", "last-added", "last-shown" (if the
+warning has been acknowledged), "expire-after" and "repeat-after" (both as
+durations like "672h0m0s").
 `
 
+// warningOutput is the structured output for a warning.
+type warningOutput struct {
+	Message     string     `json:"message" yaml:"message"`
+	FirstAdded  time.Time  `json:"first-added" yaml:"first-added"`
+	LastAdded   time.Time  `json:"last-added" yaml:"last-added"`
+	LastShown   *time.Time `json:"last-shown,omitempty" yaml:"last-shown,omitempty"`
+	ExpireAfter string     `json:"expire-after" yaml:"expire-after"`
+	RepeatAfter string     `json:"repeat-after" yaml:"repeat-after"`
+}
+
 var shortOkayHelp = "Acknowledge warnings"
 var longOkayHelp = `
 The okay command acknowledges the warnings listed with 'pebble warnings'.
@@ -61,7 +78,7 @@ sufficient time has passed.
 `
 
 func init() {
-	addCommand("warnings", shortWarningsHelp, longWarningsHelp, func() flags.Commander { return &cmdWarnings{} }, merge(timeDescs, unicodeDescs, map[string]string{
+	addCommand("warnings", shortWarningsHelp, longWarningsHelp, func() flags.Commander { return &cmdWarnings{} }, merge(timeDescs, unicodeDescs, formatDescs, pagerDescs, map[string]string{
 		"all":     "Show all warnings",
 		"verbose": "Show more information",
 	}), nil)
@@ -74,10 +91,32 @@ func (cmd *cmdWarnings) Execute(args []string) error {
 	}
 	now := time.Now()
 
+	stop := cmd.startPager()
+	defer stop()
+
 	warnings, err := cmd.client.Warnings(client.WarningsOptions{All: cmd.All})
 	if err != nil {
 		return err
 	}
+	if cmd.structured() {
+		output := make([]warningOutput, len(warnings))
+		for i, warning := range warnings {
+			output[i] = warningOutput{
+				Message:     warning.Message,
+				FirstAdded:  warning.FirstAdded,
+				LastAdded:   warning.LastAdded,
+				LastShown:   optionalTime(warning.LastShown),
+				ExpireAfter: warning.ExpireAfter.String(),
+				RepeatAfter: warning.RepeatAfter.String(),
+			}
+		}
+		if len(warnings) > 0 {
+			if err := writeWarningTimestamp(now); err != nil {
+				return err
+			}
+		}
+		return cmd.writeStructured(output)
+	}
 	if len(warnings) == 0 {
 		if t, _ := lastWarningTimestamp(); t.IsZero() {
 			fmt.Fprintln(Stdout, "No warnings.")
@@ -212,3 +212,24 @@ func (s *warningSuite) TestCommandWithWarnings(c *check.C) {
 	c.Check(s.Stdout(), check.Matches, `(?s)client.*server.*`)
 	c.Check(s.Stderr(), check.Equals, "WARNING: There are 2 new warnings. See 'pebble warnings'.\n")
 }
+
+func (s *warningSuite) TestWarningsFormat(c *check.C) {
+	s.RedirectClientToTestServer(mkWarningsFakeHandler(c, twoWarnings))
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"warnings", "--format", "yaml"})
+	c.Assert(err, check.IsNil)
+	c.Check(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "")
+	c.Check(s.Stdout(), check.Equals, `
+- message: hello world number one
+  first-added: 2018-09-19T12:41:18.505007495Z
+  last-added: 2018-09-19T12:41:18.505007495Z
+  expire-after: 672h0m0s
+  repeat-after: 24h0m0s
+- message: hello world number two
+  first-added: 2018-09-19T12:44:19.680362867Z
+  last-added: 2018-09-19T12:44:19.680362867Z
+  expire-after: 672h0m0s
+  repeat-after: 24h0m0s
+`[1:])
+}
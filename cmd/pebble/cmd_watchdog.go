@@ -0,0 +1,59 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"os"
+
+	"github.com/jessevdk/go-flags"
+)
+
+var shortWatchdogHelp = "Ping the watchdog of a service"
+var longWatchdogHelp = `
+The watchdog command tells Pebble that a service with a "watchdog" interval
+is still working. A service that isn't pinged within the interval is
+considered hung: it's killed, and its on-failure action is applied.
+
+It's usually run by the service itself, in which case the service name may
+be omitted: it's taken from $PEBBLE_WATCHDOG_SERVICE, which Pebble sets for
+services with a watchdog.
+`
+
+type cmdWatchdog struct {
+	clientMixin
+	Positional struct {
+		Service serviceName `positional-arg-name:"<service>"`
+	} `positional-args:"yes"`
+}
+
+func init() {
+	addCommand("watchdog", shortWatchdogHelp, longWatchdogHelp, func() flags.Commander { return &cmdWatchdog{} }, nil, nil)
+}
+
+func (cmd *cmdWatchdog) Execute(args []string) error {
+	if len(args) > 0 {
+		return ErrExtraArgs
+	}
+
+	service := string(cmd.Positional.Service)
+	if service == "" {
+		service = os.Getenv("PEBBLE_WATCHDOG_SERVICE")
+	}
+	if service == "" {
+		return errors.New("must specify a service, or run from a service with a watchdog")
+	}
+	return cmd.client.PingWatchdog(service)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) TestWatchdog(c *check.C) {
+	s.RedirectClientToTestServer(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Method, check.Equals, "POST")
+		c.Check(r.URL.Path, check.Equals, "/v1/services/svc1")
+		assertBodyEquals(c, r.Body, map[string]interface{}{
+			"action": "watchdog",
+		})
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": true}`)
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"watchdog", "svc1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+
+	os.Setenv("PEBBLE_WATCHDOG_SERVICE", "svc1")
+	defer os.Unsetenv("PEBBLE_WATCHDOG_SERVICE")
+	rest, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"watchdog"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+}
+
+func (s *PebbleSuite) TestWatchdogNoService(c *check.C) {
+	os.Unsetenv("PEBBLE_WATCHDOG_SERVICE")
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"watchdog"})
+	c.Assert(err, check.ErrorMatches, "must specify a service, or run from a service with a watchdog")
+}
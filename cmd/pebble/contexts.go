@@ -0,0 +1,204 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/pebble/client"
+)
+
+// cliConfig is the client configuration file, which defines named contexts
+// for the daemons the user manages, such as:
+//
+//	current-context: web
+//	contexts:
+//	    web:
+//	        socket: /srv/web/.pebble.socket
+//	    db:
+//	        remote: ssh://admin@db.example.com
+//	        format: yaml
+type cliConfig struct {
+	CurrentContext string                 `yaml:"current-context"`
+	Contexts       map[string]*cliContext `yaml:"contexts"`
+}
+
+// cliContext is a named context in the client configuration file. Each
+// field that is set takes the place of the equivalent global option or
+// environment variable.
+type cliContext struct {
+	// Dir and Socket are as for --dir and --socket.
+	Dir    string `yaml:"dir"`
+	Socket string `yaml:"socket"`
+
+	// Remote is as for --remote.
+	Remote string `yaml:"remote"`
+
+	// BaseURL is the HTTP or HTTPS address of the API, such as that of a
+	// proxy in front of the daemon's socket. CACert is a file of the
+	// (PEM-encoded) certificates to trust for HTTPS, instead of the system
+	// ones, and Cert and Key are the files of a client certificate and its
+	// private key to present. Relative paths are relative to the
+	// configuration file's directory.
+	BaseURL string `yaml:"base-url"`
+	CACert  string `yaml:"ca-cert"`
+	Cert    string `yaml:"cert"`
+	Key     string `yaml:"key"`
+
+	// Format is the default output format of commands with a --format
+	// option.
+	Format string `yaml:"format"`
+
+	// configDir is the directory of the configuration file.
+	configDir string
+}
+
+// contextOption is the name of the context given with the --context option,
+// if any, which takes precedence over $PEBBLE_CONTEXT and the configuration
+// file's current context.
+var contextOption string
+
+// activeContext is the selected context, or nil if none is.
+var activeContext *cliContext
+
+// configFilePath returns the path of the client configuration file:
+// $XDG_CONFIG_HOME/pebble/config.yaml, defaulting to
+// ~/.config/pebble/config.yaml.
+func configFilePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "pebble", "config.yaml"), nil
+}
+
+// readConfigFile reads the client configuration file, returning an empty
+// configuration if it doesn't exist.
+func readConfigFile() (*cliConfig, error) {
+	config := &cliConfig{}
+	path, err := configFilePath()
+	if err != nil {
+		return config, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read client configuration: %w", err)
+	}
+	err = yaml.Unmarshal(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse client configuration %q: %w", path, err)
+	}
+	for name, context := range config.Contexts {
+		if context == nil {
+			return nil, fmt.Errorf("cannot parse client configuration %q: context %q is empty", path, name)
+		}
+		switch context.Format {
+		case "", "text", "json", "yaml":
+		default:
+			return nil, fmt.Errorf("cannot parse client configuration %q: context %q has invalid format %q", path, name, context.Format)
+		}
+		context.configDir = filepath.Dir(path)
+	}
+	return config, nil
+}
+
+// selectContext sets the active context to the one named by --context,
+// $PEBBLE_CONTEXT, or the configuration file's current context, in that
+// order. No context is active if none of them is set.
+func selectContext() error {
+	name := contextOption
+	if name == "" {
+		name = os.Getenv("PEBBLE_CONTEXT")
+	}
+	config, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = config.CurrentContext
+	}
+	activeContext = nil
+	if name == "" {
+		return nil
+	}
+	context, ok := config.Contexts[name]
+	if !ok {
+		return fmt.Errorf("cannot find context %q in client configuration", name)
+	}
+	activeContext = context
+	return nil
+}
+
+// configureClient updates config with the context's remote or base URL
+// settings, unless a global option overrides them.
+func (ctx *cliContext) configureClient(config *client.Config) error {
+	if config.SSH != nil || socketOption != "" {
+		return nil
+	}
+	if ctx.Remote != "" {
+		sshConfig, err := client.ParseSSHURL(ctx.Remote)
+		if err != nil {
+			return err
+		}
+		config.SSH = sshConfig
+		return nil
+	}
+	if ctx.BaseURL == "" {
+		return nil
+	}
+	config.BaseURL = ctx.BaseURL
+	config.TLSConfig = nil
+	if ctx.CACert == "" && ctx.Cert == "" && ctx.Key == "" {
+		return nil
+	}
+	tlsConfig := &tls.Config{}
+	if ctx.CACert != "" {
+		data, err := ioutil.ReadFile(ctx.path(ctx.CACert))
+		if err != nil {
+			return fmt.Errorf("cannot read CA certificates: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(data) {
+			return fmt.Errorf("cannot find CA certificates in %q", ctx.path(ctx.CACert))
+		}
+	}
+	if ctx.Cert != "" || ctx.Key != "" {
+		cert, err := tls.LoadX509KeyPair(ctx.path(ctx.Cert), ctx.path(ctx.Key))
+		if err != nil {
+			return fmt.Errorf("cannot load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	config.TLSConfig = tlsConfig
+	return nil
+}
+
+// path returns path relative to the configuration file's directory.
+func (ctx *cliContext) path(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(ctx.configDir, path)
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+	"github.com/canonical/pebble/internal/overlord/state"
+)
+
+func (s *PebbleSuite) writeClientConfig(c *check.C, config string) {
+	dir := filepath.Join(s.configHome, "pebble")
+	err := os.MkdirAll(dir, 0755)
+	c.Assert(err, check.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, "config.yaml"), []byte(config), 0644)
+	c.Assert(err, check.IsNil)
+	s.AddCleanup(func() {
+		pebble.ClientConfig.BaseURL = ""
+		pebble.ClientConfig.TLSConfig = nil
+	})
+}
+
+func (s *PebbleSuite) TestContextBaseURLAndFormat(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/v1/layers")
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": [{"label": "base", "order": 1}]}`)
+	}))
+	defer server.Close()
+	s.writeClientConfig(c, fmt.Sprintf(`
+contexts:
+    test:
+        base-url: %s
+        format: yaml
+`, server.URL))
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"--context", "test", "layers"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+- label: base
+  order: 1
+  dynamic: false
+  persist: false
+`[1:])
+	s.ResetStdStreams()
+
+	// The --format option overrides the context's format.
+	rest, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"--context", "test", "layers", "--format", "text"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Matches, `Order +Label +Source +Summary\n001 +base +file +-\n`)
+}
+
+func (s *PebbleSuite) TestContextTLS(c *check.C) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": []}`)
+	}))
+	defer server.Close()
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	err := os.MkdirAll(filepath.Join(s.configHome, "pebble"), 0755)
+	c.Assert(err, check.IsNil)
+	err = ioutil.WriteFile(filepath.Join(s.configHome, "pebble", "ca.pem"), certPEM, 0644)
+	c.Assert(err, check.IsNil)
+	s.writeClientConfig(c, fmt.Sprintf(`
+contexts:
+    trusted:
+        base-url: %s
+        ca-cert: ca.pem
+    untrusted:
+        base-url: %s
+`, server.URL, server.URL))
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"--context", "trusted", "layers"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stderr(), check.Equals, "Plan has no layers\n")
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"--context", "untrusted", "layers"})
+	c.Assert(err, check.ErrorMatches, `.*certificate.*`)
+}
+
+func (s *PebbleSuite) TestContextDir(c *check.C) {
+	dir := c.MkDir()
+	st := state.New(nil)
+	st.Lock()
+	data, err := json.Marshal(st)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, ".pebble.state"), data, 0644)
+	c.Assert(err, check.IsNil)
+	otherDir := c.MkDir()
+	s.writeClientConfig(c, fmt.Sprintf(`
+current-context: current
+contexts:
+    current:
+        dir: %s
+    other:
+        dir: %s
+`, dir, otherDir))
+
+	// The configuration file's current context is used by default.
+	restore := fakeArgs("pebble", "debug", "state")
+	defer restore()
+	err = pebble.RunMain()
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "ID   Status  Spawn  Ready  Kind  Summary\n")
+	s.ResetStdStreams()
+
+	// $PEBBLE_CONTEXT overrides it, and --context overrides that.
+	os.Setenv("PEBBLE_CONTEXT", "other")
+	err = pebble.RunMain()
+	c.Assert(err, check.ErrorMatches, `cannot read the state file: .*`+otherDir+`/.pebble.state.*`)
+
+	restore = fakeArgs("pebble", "--context", "current", "debug", "state")
+	defer restore()
+	err = pebble.RunMain()
+	c.Assert(err, check.IsNil)
+	c.Check(s.Stdout(), check.Equals, "ID   Status  Spawn  Ready  Kind  Summary\n")
+}
+
+func (s *PebbleSuite) TestContextErrors(c *check.C) {
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"--context", "foo", "layers"})
+	c.Assert(err, check.ErrorMatches, `.*cannot find context "foo" in client configuration`)
+
+	s.writeClientConfig(c, `
+contexts:
+    foo:
+        format: xml
+`)
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"--context", "foo", "layers"})
+	c.Assert(err, check.ErrorMatches, `.*cannot parse client configuration ".*": context "foo" has invalid format "xml"`)
+}
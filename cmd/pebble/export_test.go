@@ -15,13 +15,21 @@
 package main
 
 import (
+	"time"
+
 	"github.com/canonical/pebble/client"
+	"github.com/canonical/pebble/internal/daemon"
 )
 
 var RunMain = run
 
 var ClientConfig = &clientConfig
 
+var (
+	DirOption    = &dirOption
+	SocketOption = &socketOption
+)
+
 func Client() *client.Client {
 	cli, err := client.New(ClientConfig)
 	if err != nil {
@@ -41,8 +49,18 @@ var (
 	MaybePresentWarnings  = maybePresentWarnings
 
 	GetEnvPaths = getEnvPaths
+
+	OutputHeight = outputHeight
 )
 
+func FakeDaemonNew(f func(opts *daemon.Options) (*daemon.Daemon, error)) (restore func()) {
+	old := daemonNew
+	daemonNew = f
+	return func() {
+		daemonNew = old
+	}
+}
+
 func FakeIsStdoutTTY(t bool) (restore func()) {
 	oldIsStdoutTTY := isStdoutTTY
 	isStdoutTTY = t
@@ -58,3 +76,27 @@ func FakeIsStdinTTY(t bool) (restore func()) {
 		isStdinTTY = oldIsStdinTTY
 	}
 }
+
+func FakeTermSize(width, height int) (restore func()) {
+	old := termSize
+	termSize = func() (int, int) { return width, height }
+	return func() {
+		termSize = old
+	}
+}
+
+func FakeTimeNow(t time.Time) (restore func()) {
+	old := timeNow
+	timeNow = func() time.Time { return t }
+	return func() {
+		timeNow = old
+	}
+}
+
+func FakeMakeStdinRaw(f func() (func(), error)) (restore func()) {
+	old := makeStdinRaw
+	makeStdinRaw = f
+	return func() {
+		makeStdinRaw = old
+	}
+}
@@ -16,6 +16,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"go/doc"
 	"io"
@@ -23,10 +24,14 @@ import (
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
 	"golang.org/x/crypto/ssh/terminal"
+	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/pebble/client"
 )
 
 type unicodeMixin struct {
@@ -51,14 +56,10 @@ func (ux unicodeMixin) getEscapes() *escapes {
 	return esc
 }
 
-type colorMixin struct {
-	Color string `long:"color" default:"auto" choice:"auto" choice:"never" choice:"always"`
-	unicodeMixin
-}
-
-func (mx colorMixin) getEscapes() *escapes {
-	esc := colorTable(mx.Color)
-	mx.addUnicodeChars(&esc)
+// colorEscapes returns the escapes to style output with, as selected by
+// the global --color option.
+func colorEscapes() *escapes {
+	esc := colorTable(optionsData.Color)
 	return &esc
 }
 
@@ -111,15 +112,77 @@ func colorTable(mode string) escapes {
 	return color
 }
 
-var colorDescs = map[string]string{
-	"color":   "Use a little bit of color to highlight some things.",
-	"unicode": unicodeDescs["unicode"],
-}
-
 var unicodeDescs = map[string]string{
 	"unicode": "Use a little bit of Unicode to improve legibility.",
 }
 
+// formatMixin adds a --format option to listing commands. In the "json" and
+// "yaml" formats, the command writes its result as the output structure
+// documented on the command (with the same field names in both formats),
+// instead of the tabular text output.
+type formatMixin struct {
+	Format string `long:"format" choice:"text" choice:"json" choice:"yaml"`
+}
+
+var formatDescs = map[string]string{
+	"format": "Output format: \"text\" (default, unless set by the context), \"json\" or \"yaml\".",
+}
+
+// format returns the selected output format: the --format option, or else
+// the active context's default format, or else "text".
+func (mx formatMixin) format() string {
+	if mx.Format != "" {
+		return mx.Format
+	}
+	if activeContext != nil && activeContext.Format != "" {
+		return activeContext.Format
+	}
+	return "text"
+}
+
+// structured reports whether the output should be written with
+// writeStructured rather than as text.
+func (mx formatMixin) structured() bool {
+	format := mx.format()
+	return format == "json" || format == "yaml"
+}
+
+// writeStructured writes v to Stdout in the selected format.
+func (mx formatMixin) writeStructured(v interface{}) error {
+	switch mx.format() {
+	case "json":
+		encoder := json.NewEncoder(Stdout)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(v)
+	case "yaml":
+		encoder := yaml.NewEncoder(Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+	return fmt.Errorf("internal error: cannot write %q format", mx.format())
+}
+
+// optionalDuration returns d formatted as a string like "1.5s", or "" if d is
+// zero, so that unset durations are omitted from structured output.
+func optionalDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// optionalTime returns a pointer to t, or nil if t is the zero time, so that
+// unset times are omitted from structured output.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 func merge(maps ...map[string]string) map[string]string {
 	count := 0
 	for _, m := range maps {
@@ -135,7 +198,12 @@ func merge(maps ...map[string]string) map[string]string {
 }
 
 type escapes struct {
-	green string
+	green  string
+	red    string
+	yellow string
+	// plain is the same length as the colors above, so that a column of
+	// colored text (some of it plain) stays aligned in a tabwriter.
+	plain string
 	bold  string
 	end   string
 
@@ -144,22 +212,77 @@ type escapes struct {
 
 var (
 	color = escapes{
-		green: "\033[32m",
-		bold:  "\033[1m",
-		end:   "\033[0m",
+		green:  "\033[32m",
+		red:    "\033[31m",
+		yellow: "\033[33m",
+		plain:  "\033[39m",
+		bold:   "\033[1m",
+		end:    "\033[0m",
 	}
 
 	mono = escapes{
-		green: "\033[1m",
-		bold:  "\033[1m",
-		end:   "\033[0m",
+		green:  "\033[01m",
+		red:    "\033[01m",
+		yellow: "\033[02m",
+		plain:  "\033[22m",
+		bold:   "\033[1m",
+		end:    "\033[0m",
 	}
 
 	noesc = escapes{}
 )
 
+// colored returns s styled with the given escape (one of esc's colors).
+func (esc *escapes) colored(color, s string) string {
+	if color == "" {
+		return s
+	}
+	return color + s + esc.end
+}
+
+// serviceStatus returns a service's status, colored by whether it's
+// running, failing or stopped.
+func (esc *escapes) serviceStatus(status client.ServiceStatus) string {
+	switch status {
+	case client.StatusActive:
+		return esc.colored(esc.green, string(status))
+	case client.StatusError:
+		return esc.colored(esc.red, string(status))
+	case client.StatusBackoff:
+		return esc.colored(esc.yellow, string(status))
+	}
+	return esc.colored(esc.plain, string(status))
+}
+
+// changeStatus returns the status of a change or task, colored by whether
+// it succeeded or failed.
+func (esc *escapes) changeStatus(status string) string {
+	switch status {
+	case "Done":
+		return esc.colored(esc.green, status)
+	case "Error":
+		return esc.colored(esc.red, status)
+	case "Hold", "Undo", "Undoing", "Undone", "Abort":
+		return esc.colored(esc.yellow, status)
+	}
+	return esc.colored(esc.plain, status)
+}
+
+// health returns "healthy" or "unhealthy", colored accordingly.
+func (esc *escapes) health(healthy bool) string {
+	if healthy {
+		return esc.colored(esc.green, "healthy")
+	}
+	return esc.colored(esc.red, "unhealthy")
+}
+
 func tabWriter() *tabwriter.Writer {
-	return tabwriter.NewWriter(Stdout, 5, 3, 2, ' ', 0)
+	return tabWriterTo(Stdout)
+}
+
+// tabWriterTo is like tabWriter, but writes to w instead of Stdout.
+func tabWriterTo(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 5, 3, 2, ' ', 0)
 }
 
 var termSize = termSizeImpl
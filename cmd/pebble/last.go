@@ -25,7 +25,7 @@ type changeIDMixin struct {
 	clientMixin
 	LastChangeType string `long:"last"`
 	Positional     struct {
-		ID string `positional-arg-name:"<id>"`
+		ID changeID `positional-arg-name:"<id>"`
 	} `positional-args:"yes"`
 }
 
@@ -44,13 +44,20 @@ var (
 	noticef = logger.Noticef
 )
 
-// defaultPebbleDir is the Pebble directory used if $PEBBLE is not set. It is
-// created by the daemon ("pebble run") if it doesn't exist, and also used by
-// the pebble client.
+// defaultPebbleDir is the Pebble directory used if neither --dir nor $PEBBLE
+// is set. It is created by the daemon ("pebble run") if it doesn't exist, and
+// also used by the pebble client.
 const defaultPebbleDir = "/var/lib/pebble/default"
 
 type options struct {
-	Version func() `long:"version"`
+	Version     func()             `long:"version"`
+	Dir         func(string) error `long:"dir" value-name:"<dir>"`
+	Socket      func(string) error `long:"socket" value-name:"<path>"`
+	Remote      func(string) error `long:"remote" value-name:"<url>"`
+	Context     func(string) error `long:"context" value-name:"<name>"`
+	Targets     string             `long:"targets" value-name:"<context>,..."`
+	AllContexts bool               `long:"all-contexts"`
+	Color       string             `long:"color" value-name:"<when>" default:"auto" choice:"auto" choice:"always" choice:"never"`
 }
 
 type argDesc struct {
@@ -60,6 +67,42 @@ type argDesc struct {
 
 var optionsData options
 
+// dirOption and socketOption are the paths given with the --dir and --socket
+// options, if any. They take precedence over $PEBBLE and $PEBBLE_SOCKET, for
+// both the client and the daemon.
+var (
+	dirOption    string
+	socketOption string
+)
+
+// doubleDashCommand is implemented by commands that treat the arguments
+// after "--" differently from their other positional arguments, which the
+// parser otherwise passes on together.
+type doubleDashCommand interface {
+	setDoubleDashArgs(args []string)
+}
+
+// parseArgs parses args with the given parser and runs the selected command
+// through its handler, first handing the command the arguments after "--" if
+// it's a doubleDashCommand.
+func parseArgs(parser *flags.Parser, args []string) ([]string, error) {
+	var doubleDashArgs []string
+	for i, arg := range args {
+		if arg == "--" {
+			doubleDashArgs = append([]string{}, args[i+1:]...)
+			break
+		}
+	}
+	handler := parser.CommandHandler
+	parser.CommandHandler = func(command flags.Commander, args []string) error {
+		if cmd, ok := command.(doubleDashCommand); ok {
+			cmd.setDoubleDashArgs(doubleDashArgs)
+		}
+		return handler(command, args)
+	}
+	return parser.ParseArgs(args)
+}
+
 // ErrExtraArgs is returned  if extra arguments to a command are found
 var ErrExtraArgs = fmt.Errorf("too many arguments for command")
 
@@ -169,6 +212,103 @@ func (ch *clientMixin) setClient(cli *client.Client) {
 	ch.client = cli
 }
 
+// updateClient points cli at the socket selected by the environment and the
+// options parsed so far.
+func updateClient(cli *client.Client) error {
+	_, clientConfig.Socket = getEnvPaths()
+	if activeContext != nil {
+		if err := activeContext.configureClient(&clientConfig); err != nil {
+			return err
+		}
+	}
+	newCli, err := client.New(&clientConfig)
+	if err != nil {
+		return fmt.Errorf("cannot create client: %v", err)
+	}
+	// Commands hold on to cli, so update it in place.
+	*cli = *newCli
+	return nil
+}
+
+// subcommandRunner is implemented by commands that have (some of) the
+// regular commands as subcommands, and run them in their own way.
+type subcommandRunner interface {
+	subcommands() []string
+	runSubcommand(name string, command flags.Commander, args []string) error
+}
+
+// commandInfo returns the information of the regular command with the given
+// name.
+func commandInfo(name string) *cmdInfo {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	logger.Panicf("internal error: no command %q", name)
+	return nil
+}
+
+// addCommandInfo adds a command built from c to parent, returning the
+// command's data and the command itself.
+func addCommandInfo(parent *flags.Command, c *cmdInfo, cli *client.Client, parser *flags.Parser) (flags.Commander, *flags.Command) {
+	obj := c.builder()
+	if x, ok := obj.(clientSetter); ok {
+		x.setClient(cli)
+	}
+	if x, ok := obj.(parserSetter); ok {
+		x.setParser(parser)
+	}
+
+	cmd, err := parent.AddCommand(c.name, c.shortHelp, strings.TrimSpace(c.longHelp), obj)
+	if err != nil {
+		logger.Panicf("cannot add command %q: %v", c.name, err)
+	}
+	cmd.Hidden = c.hidden
+	if c.alias != "" {
+		cmd.Aliases = append(cmd.Aliases, c.alias)
+	}
+
+	opts := cmd.Options()
+	if c.optDescs != nil && len(opts) != len(c.optDescs) {
+		logger.Panicf("wrong number of option descriptions for %s: expected %d, got %d", c.name, len(opts), len(c.optDescs))
+	}
+	for _, opt := range opts {
+		name := opt.LongName
+		if name == "" {
+			name = string(opt.ShortName)
+		}
+		desc, ok := c.optDescs[name]
+		if !(c.optDescs == nil || ok) {
+			logger.Panicf("%s missing description for %s", c.name, name)
+		}
+		lintDesc(c.name, name, desc, opt.Description)
+		if desc != "" {
+			opt.Description = desc
+		}
+	}
+
+	args := cmd.Args()
+	if c.argDescs != nil && len(args) != len(c.argDescs) {
+		logger.Panicf("wrong number of argument descriptions for %s: expected %d, got %d", c.name, len(args), len(c.argDescs))
+	}
+	for i, arg := range args {
+		name, desc := arg.Name, ""
+		if c.argDescs != nil {
+			name = c.argDescs[i].name
+			desc = c.argDescs[i].desc
+		}
+		lintArg(c.name, name, desc, arg.Description)
+		name = fixupArg(name)
+		arg.Name = name
+		arg.Description = desc
+	}
+	if c.extra != nil {
+		c.extra(cmd)
+	}
+	return obj, cmd
+}
+
 // Parser creates and populates a fresh parser.
 // Since commands have local state a fresh parser is required to isolate tests
 // from each other.
@@ -177,8 +317,40 @@ func Parser(cli *client.Client) *flags.Parser {
 		printVersions(cli)
 		panic(&exitStatus{0})
 	}
+	dirOption = ""
+	socketOption = ""
+	optionsData.Dir = func(dir string) error {
+		dirOption = dir
+		return updateClient(cli)
+	}
+	optionsData.Socket = func(path string) error {
+		socketOption = path
+		return updateClient(cli)
+	}
+	contextOption = ""
+	activeContext = nil
+	optionsData.Targets = ""
+	optionsData.AllContexts = false
+	optionsData.Context = func(name string) error {
+		contextOption = name
+		if err := selectContext(); err != nil {
+			return err
+		}
+		return updateClient(cli)
+	}
+	clientConfig.SSH = nil
+	clientConfig.TLSConfig = nil
+	optionsData.Remote = func(url string) error {
+		sshConfig, err := client.ParseSSHURL(url)
+		if err != nil {
+			return err
+		}
+		clientConfig.SSH = sshConfig
+		return updateClient(cli)
+	}
 	flagopts := flags.Options(flags.PassDoubleDash)
 	parser := flags.NewParser(&optionsData, flagopts)
+	parser.Name = "pebble"
 	parser.ShortDescription = "Tool to interact with pebble"
 	parser.LongDescription = longPebbleDescription
 	// hide the unhelpful "[OPTIONS]" from help output
@@ -187,64 +359,39 @@ func Parser(cli *client.Client) *flags.Parser {
 		version.Description = "Print the version and exit"
 		version.Hidden = true
 	}
+	if dir := parser.FindOptionByLongName("dir"); dir != nil {
+		dir.Description = "Pebble directory with the state, layers and socket (overrides $PEBBLE)"
+	}
+	if socket := parser.FindOptionByLongName("socket"); socket != nil {
+		socket.Description = "Unix socket used for the API (overrides $PEBBLE_SOCKET)"
+	}
+	if remote := parser.FindOptionByLongName("remote"); remote != nil {
+		remote.Description = "Manage the daemon on a remote host over SSH (ssh://[user@]host[:port][/socket])"
+	}
+	if context := parser.FindOptionByLongName("context"); context != nil {
+		context.Description = "Named context from the client configuration file to use (overrides $PEBBLE_CONTEXT)"
+	}
+	if targets := parser.FindOptionByLongName("targets"); targets != nil {
+		targets.Description = "Run a read-only command on each of these named contexts, with a target column"
+	}
+	if allContexts := parser.FindOptionByLongName("all-contexts"); allContexts != nil {
+		allContexts.Description = "Run a read-only command on every named context"
+	}
+	if color := parser.FindOptionByLongName("color"); color != nil {
+		color.Description = "Use color and bold for statuses: auto (if stdout is a terminal), always or never"
+	}
 	// add --help like what go-flags would do for us, but hidden
 	addHelp(parser)
 
 	// Add all regular commands
+	runners := make(map[*flags.Command]subcommandRunner)
 	for _, c := range commands {
-		obj := c.builder()
-		if x, ok := obj.(clientSetter); ok {
-			x.setClient(cli)
-		}
-		if x, ok := obj.(parserSetter); ok {
-			x.setParser(parser)
-		}
-
-		cmd, err := parser.AddCommand(c.name, c.shortHelp, strings.TrimSpace(c.longHelp), obj)
-		if err != nil {
-			logger.Panicf("cannot add command %q: %v", c.name, err)
-		}
-		cmd.Hidden = c.hidden
-		if c.alias != "" {
-			cmd.Aliases = append(cmd.Aliases, c.alias)
-		}
-
-		opts := cmd.Options()
-		if c.optDescs != nil && len(opts) != len(c.optDescs) {
-			logger.Panicf("wrong number of option descriptions for %s: expected %d, got %d", c.name, len(opts), len(c.optDescs))
-		}
-		for _, opt := range opts {
-			name := opt.LongName
-			if name == "" {
-				name = string(opt.ShortName)
-			}
-			desc, ok := c.optDescs[name]
-			if !(c.optDescs == nil || ok) {
-				logger.Panicf("%s missing description for %s", c.name, name)
-			}
-			lintDesc(c.name, name, desc, opt.Description)
-			if desc != "" {
-				opt.Description = desc
-			}
-		}
-
-		args := cmd.Args()
-		if c.argDescs != nil && len(args) != len(c.argDescs) {
-			logger.Panicf("wrong number of argument descriptions for %s: expected %d, got %d", c.name, len(args), len(c.argDescs))
-		}
-		for i, arg := range args {
-			name, desc := arg.Name, ""
-			if c.argDescs != nil {
-				name = c.argDescs[i].name
-				desc = c.argDescs[i].desc
+		obj, cmd := addCommandInfo(parser.Command, c, cli, parser)
+		if x, ok := obj.(subcommandRunner); ok {
+			runners[cmd] = x
+			for _, name := range x.subcommands() {
+				addCommandInfo(cmd, commandInfo(name), cli, parser)
 			}
-			lintArg(c.name, name, desc, arg.Description)
-			name = fixupArg(name)
-			arg.Name = name
-			arg.Description = desc
-		}
-		if c.extra != nil {
-			c.extra(cmd)
 		}
 	}
 	// Add the debug command
@@ -255,49 +402,27 @@ func Parser(cli *client.Client) *flags.Parser {
 	}
 	// Add all the sub-commands of the debug command
 	for _, c := range debugCommands {
-		obj := c.builder()
-		if x, ok := obj.(clientSetter); ok {
-			x.setClient(cli)
-		}
-		cmd, err := debugCommand.AddCommand(c.name, c.shortHelp, strings.TrimSpace(c.longHelp), obj)
-		if err != nil {
-			logger.Panicf("cannot add debug command %q: %v", c.name, err)
-		}
-		cmd.Hidden = c.hidden
-		opts := cmd.Options()
-		if c.optDescs != nil && len(opts) != len(c.optDescs) {
-			logger.Panicf("wrong number of option descriptions for %s: expected %d, got %d", c.name, len(opts), len(c.optDescs))
-		}
-		for _, opt := range opts {
-			name := opt.LongName
-			if name == "" {
-				name = string(opt.ShortName)
-			}
-			desc, ok := c.optDescs[name]
-			if !(c.optDescs == nil || ok) {
-				logger.Panicf("%s missing description for %s", c.name, name)
-			}
-			lintDesc(c.name, name, desc, opt.Description)
-			if desc != "" {
-				opt.Description = desc
+		addCommandInfo(debugCommand, c, cli, parser)
+	}
+
+	// Let commands such as "enter" run their subcommands themselves.
+	parser.CommandHandler = func(command flags.Commander, args []string) error {
+		if active := parser.Active; active != nil && active.Active != nil {
+			if runner, ok := runners[active]; ok {
+				return runner.runSubcommand(active.Active.Name, command, args)
 			}
 		}
-
-		args := cmd.Args()
-		if c.argDescs != nil && len(args) != len(c.argDescs) {
-			logger.Panicf("wrong number of argument descriptions for %s: expected %d, got %d", c.name, len(args), len(c.argDescs))
+		if command == nil {
+			return nil
 		}
-		for i, arg := range args {
-			name, desc := arg.Name, ""
-			if c.argDescs != nil {
-				name = c.argDescs[i].name
-				desc = c.argDescs[i].desc
-			}
-			lintArg(c.name, name, desc, arg.Description)
-			name = fixupArg(name)
-			arg.Name = name
-			arg.Description = desc
+		targets, err := targetNames()
+		if err != nil {
+			return err
 		}
+		if targets != nil {
+			return runOnTargets(cli, parser.Active.Name, command, args, targets)
+		}
+		return command.Execute(args)
 	}
 	return parser
 }
@@ -349,7 +474,17 @@ func run() error {
 	}
 
 	parser := Parser(cli)
-	xtra, err := parser.Parse()
+	// Select the context from $PEBBLE_CONTEXT or the configuration file;
+	// the --context option selects it again when it's parsed.
+	if err := selectContext(); err != nil {
+		return err
+	}
+	if activeContext != nil {
+		if err := updateClient(cli); err != nil {
+			return err
+		}
+	}
+	xtra, err := parseArgs(parser, os.Args[1:])
 	if err != nil {
 		if e, ok := err.(*flags.Error); ok {
 			switch e.Type {
@@ -424,12 +559,30 @@ func errorToMessage(e error) (normalMessage string, err error) {
 	return msg, nil
 }
 
+// getEnvPaths returns the Pebble directory and the path of the API socket,
+// which defaults to a file in the Pebble directory. The active context's
+// paths, if set, take the place of $PEBBLE and $PEBBLE_SOCKET.
 func getEnvPaths() (pebbleDir string, socketPath string) {
-	pebbleDir = os.Getenv("PEBBLE")
+	pebbleDir = dirOption
+	if pebbleDir == "" && activeContext != nil {
+		pebbleDir = activeContext.path(activeContext.Dir)
+	}
+	if pebbleDir == "" {
+		pebbleDir = os.Getenv("PEBBLE")
+	}
 	if pebbleDir == "" {
 		pebbleDir = defaultPebbleDir
 	}
-	socketPath = os.Getenv("PEBBLE_SOCKET")
+	socketPath = socketOption
+	if socketPath == "" && activeContext != nil {
+		socketPath = activeContext.path(activeContext.Socket)
+		if socketPath == "" && activeContext.Dir != "" {
+			socketPath = filepath.Join(pebbleDir, ".pebble.socket")
+		}
+	}
+	if socketPath == "" {
+		socketPath = os.Getenv("PEBBLE_SOCKET")
+	}
 	if socketPath == "" {
 		socketPath = filepath.Join(pebbleDir, ".pebble.socket")
 	}
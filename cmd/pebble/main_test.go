@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -14,6 +15,7 @@ import (
 
 	. "gopkg.in/check.v1"
 
+	"github.com/canonical/pebble/client"
 	"github.com/canonical/pebble/cmd"
 	"github.com/canonical/pebble/internal/testutil"
 
@@ -28,8 +30,9 @@ type BasePebbleSuite struct {
 	stdin     *bytes.Buffer
 	stdout    *bytes.Buffer
 	stderr    *bytes.Buffer
-	password  string
-	pebbleDir string
+	password   string
+	pebbleDir  string
+	configHome string
 
 	AuthFile string
 }
@@ -58,6 +61,11 @@ func (s *BasePebbleSuite) SetUpTest(c *C) {
 	s.AddCleanup(pebble.FakeIsStdinTTY(false))
 
 	os.Setenv("PEBBLE_LAST_WARNING_TIMESTAMP_FILENAME", filepath.Join(c.MkDir(), "warnings.json"))
+
+	// Don't use the user's client configuration file.
+	s.configHome = c.MkDir()
+	os.Setenv("XDG_CONFIG_HOME", s.configHome)
+	os.Setenv("PEBBLE_CONTEXT", "")
 }
 
 func (s *BasePebbleSuite) TearDownTest(c *C) {
@@ -70,6 +78,8 @@ func (s *BasePebbleSuite) TearDownTest(c *C) {
 	pebble.ReadPassword = terminal.ReadPassword
 
 	os.Setenv("PEBBLE_LAST_WARNING_TIMESTAMP_FILENAME", "")
+	os.Setenv("XDG_CONFIG_HOME", "")
+	os.Setenv("PEBBLE_CONTEXT", "")
 
 	s.BaseTest.TearDownTest(c)
 }
@@ -159,4 +169,61 @@ func (s *PebbleSuite) TestGetEnvPaths(c *C) {
 	pebbleDir, socketPath = pebble.GetEnvPaths()
 	c.Assert(pebbleDir, Equals, "/bar")
 	c.Assert(socketPath, Equals, "/path/to/socket")
+
+	os.Setenv("PEBBLE_SOCKET", "")
+	*pebble.DirOption = "/baz"
+	defer func() { *pebble.DirOption = "" }()
+	pebbleDir, socketPath = pebble.GetEnvPaths()
+	c.Assert(pebbleDir, Equals, "/baz")
+	c.Assert(socketPath, Equals, "/baz/.pebble.socket")
+}
+
+func (s *PebbleSuite) TestSocketOption(c *C) {
+	socketPath := filepath.Join(c.MkDir(), "alt.socket")
+	listener, err := net.Listen("unix", socketPath)
+	c.Assert(err, IsNil)
+	server := &httptest.Server{
+		Listener: listener,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.Check(r.URL.Path, Equals, "/v1/services")
+			fmt.Fprint(w, `{"type": "sync", "status-code": 200, "result": [{"name": "svc1", "current": "active", "startup": "enabled"}]}`)
+		})},
+	}
+	server.Start()
+	defer server.Close()
+
+	oldSocket := pebble.ClientConfig.Socket
+	defer func() {
+		pebble.ClientConfig.Socket = oldSocket
+		*pebble.SocketOption = ""
+	}()
+	pebble.ClientConfig.Socket = filepath.Join(c.MkDir(), "missing.socket")
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"--socket", socketPath, "services"})
+	c.Assert(err, IsNil)
+	c.Assert(rest, HasLen, 0)
+	c.Check(s.Stdout(), Matches, "(?s).*svc1 +enabled +active\n")
+
+	// The option also overrides $PEBBLE_SOCKET for the daemon.
+	os.Setenv("PEBBLE_SOCKET", "/path/to/socket")
+	defer os.Unsetenv("PEBBLE_SOCKET")
+	_, envSocketPath := pebble.GetEnvPaths()
+	c.Check(envSocketPath, Equals, socketPath)
+}
+
+func (s *PebbleSuite) TestRemoteOption(c *C) {
+	defer func() {
+		pebble.ClientConfig.SSH = nil
+	}()
+
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"--remote", "http://host", "services"})
+	c.Assert(err, ErrorMatches, `.*invalid SSH URL "http://host": scheme must be ssh`)
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"--remote", "ssh://bob@host:2222/run/pebble.socket", "completion", "bash"})
+	c.Assert(err, IsNil)
+	c.Check(pebble.ClientConfig.SSH, DeepEquals, &client.SSHConfig{
+		User:   "bob",
+		Host:   "host:2222",
+		Socket: "/run/pebble.socket",
+	})
 }
@@ -0,0 +1,116 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/canonical/pebble/internal/strutil/shlex"
+)
+
+// defaultPager is the pager used when $PAGER is not set. The options make
+// less exit if the output fits on one screen, pass colors through, and leave
+// the output on the screen when it exits.
+const defaultPager = "less -FRX"
+
+// pagerMixin adds a --no-pager option to listing commands. When standard
+// output is a terminal, their output is shown through the user's pager if it
+// doesn't fit on the screen.
+type pagerMixin struct {
+	NoPager bool `long:"no-pager"`
+}
+
+var pagerDescs = map[string]string{
+	"no-pager": "Do not pipe the output into a pager",
+}
+
+// startPager starts collecting everything written to Stdout, and returns a
+// function that stops collecting and writes the output, through the pager if
+// it is taller than the terminal. If paging is disabled the returned function
+// does nothing.
+func (mx pagerMixin) startPager() (stop func()) {
+	if mx.NoPager || !isStdoutTTY {
+		return func() {}
+	}
+	pager, ok := os.LookupEnv("PAGER")
+	if !ok {
+		pager = defaultPager
+	}
+	argv, err := shlex.Split(pager)
+	if err != nil || len(argv) == 0 || argv[0] == "cat" {
+		return func() {}
+	}
+
+	out := Stdout
+	var buf bytes.Buffer
+	Stdout = &buf
+	return func() {
+		Stdout = out
+		width, height := termSize()
+		if outputHeight(buf.String(), width) < height {
+			out.Write(buf.Bytes())
+			return
+		}
+		runPager(argv, &buf, out)
+	}
+}
+
+// runPager runs the pager to show the output read from r, falling back to
+// copying it directly to out if the pager can't be started.
+func runPager(argv []string, r io.Reader, out io.Writer) {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin = r
+	cmd.Stdout = out
+	cmd.Stderr = Stderr
+
+	// Ctrl-C is for the pager to handle while it is running.
+	signal.Ignore(os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+
+	if err := cmd.Start(); err != nil {
+		io.Copy(out, r)
+		return
+	}
+	// The pager exiting with an error (for example when the user quits
+	// before reading everything) is not an error in the command itself.
+	cmd.Wait()
+}
+
+// ansiEscapeExp matches the ANSI escape sequences used for colors and
+// cursor movement, which take up no space on the terminal.
+var ansiEscapeExp = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// outputHeight returns the number of terminal lines the output takes up when
+// shown on a terminal of the given width, taking long lines wrapping into
+// account.
+func outputHeight(output string, width int) int {
+	height := 0
+	for _, line := range strings.Split(strings.TrimSuffix(output, "\n"), "\n") {
+		n := utf8.RuneCountInString(ansiEscapeExp.ReplaceAllString(line, ""))
+		if n <= width {
+			height++
+		} else {
+			height += (n + width - 1) / width
+		}
+	}
+	return height
+}
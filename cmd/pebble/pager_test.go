@@ -0,0 +1,40 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+func (s *PebbleSuite) TestOutputHeight(c *check.C) {
+	for _, test := range []struct {
+		output string
+		height int
+	}{
+		{"", 1},
+		{"foo\n", 1},
+		{"foo\nbar\n", 2},
+		{"0123456789\n", 1},
+		{"0123456789a\n", 2},
+		{"ééééééééééé\n", 2},
+		// Color escapes take up no space.
+		{"\033[32m0123456789\033[0m\n", 1},
+		{"\033[1;31mfoo\033[0m\n\033[32mbar\033[0m\n", 2},
+	} {
+		c.Check(pebble.OutputHeight(test.output, 10), check.Equals, test.height, check.Commentf("%q", test.output))
+	}
+}
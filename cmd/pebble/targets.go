@@ -0,0 +1,277 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jessevdk/go-flags"
+	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/pebble/client"
+	"github.com/canonical/pebble/internal/strutil"
+)
+
+// targetCommands are the read-only commands that can be run on several
+// targets at once with --targets or --all-contexts.
+var targetCommands = []string{"changes", "health", "layers", "services"}
+
+// targetValueHeadings are the column headings for the commands whose text
+// output is a single value rather than a table.
+var targetValueHeadings = map[string]string{
+	"health": "Health",
+}
+
+// targetOutput is the captured output of a command run on one target.
+type targetOutput struct {
+	name     string
+	stdout   bytes.Buffer
+	stderr   bytes.Buffer
+	err      error
+	exitCode int
+}
+
+// targetNames returns the names of the contexts selected with --targets or
+// --all-contexts, or nil if neither was given.
+func targetNames() ([]string, error) {
+	if optionsData.Targets == "" && !optionsData.AllContexts {
+		return nil, nil
+	}
+	if optionsData.Targets != "" && optionsData.AllContexts {
+		return nil, fmt.Errorf("cannot use --targets and --all-contexts together")
+	}
+	if contextOption != "" || dirOption != "" || socketOption != "" || clientConfig.SSH != nil {
+		return nil, fmt.Errorf("cannot use --targets or --all-contexts with --context, --dir, --socket or --remote")
+	}
+	if optionsData.Targets != "" {
+		var names []string
+		for _, name := range strings.Split(optionsData.Targets, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+		return names, nil
+	}
+	config, err := readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Contexts) == 0 {
+		return nil, fmt.Errorf("cannot use --all-contexts: no contexts in client configuration")
+	}
+	var names []string
+	for name := range config.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// runOnTargets runs the command on each of the targets (named contexts) in
+// turn, and writes their combined output, with the target of each row.
+func runOnTargets(cli *client.Client, name string, command flags.Commander, args []string, targets []string) error {
+	if !strutil.ListContains(targetCommands, name) {
+		return fmt.Errorf("cannot use --targets or --all-contexts with %q (only with %s)", name, strings.Join(targetCommands, ", "))
+	}
+
+	// Restore the client (and the context) when done.
+	savedConfig := clientConfig
+	savedCli := *cli
+	savedContext := activeContext
+	defer func() {
+		clientConfig = savedConfig
+		*cli = savedCli
+		activeContext = savedContext
+		contextOption = ""
+	}()
+
+	outputs := make([]*targetOutput, len(targets))
+	for i, target := range targets {
+		outputs[i] = runOnTarget(cli, command, args, target)
+		clientConfig = savedConfig
+	}
+
+	format := "text"
+	if f, ok := command.(interface{ format() string }); ok {
+		format = f.format()
+	}
+	var err error
+	switch format {
+	case "json", "yaml":
+		err = writeTargetsStructured(format, outputs)
+	default:
+		err = writeTargetsText(name, outputs)
+	}
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	exitCode := 0
+	for _, output := range outputs {
+		for _, line := range strings.SplitAfter(output.stderr.String(), "\n") {
+			if line != "" {
+				fmt.Fprintf(Stderr, "%s: %s", output.name, line)
+			}
+		}
+		if output.err != nil {
+			failed++
+			fmt.Fprintf(Stderr, "%s: error: %v\n", output.name, output.err)
+		}
+		if output.exitCode != 0 {
+			exitCode = output.exitCode
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("cannot run %q on %d of %d targets", name, failed, len(outputs))
+	}
+	if exitCode != 0 {
+		panic(&exitStatus{exitCode})
+	}
+	return nil
+}
+
+// runOnTarget runs the command with the named context selected, capturing
+// its output.
+func runOnTarget(cli *client.Client, command flags.Commander, args []string, target string) (output *targetOutput) {
+	output = &targetOutput{name: target}
+	contextOption = target
+	if err := selectContext(); err != nil {
+		output.err = err
+		return output
+	}
+	clientConfig.SSH = nil
+	clientConfig.BaseURL = ""
+	clientConfig.TLSConfig = nil
+	if err := updateClient(cli); err != nil {
+		output.err = err
+		return output
+	}
+
+	stdout, stderr, stdoutTTY := Stdout, Stderr, isStdoutTTY
+	Stdout, Stderr, isStdoutTTY = &output.stdout, &output.stderr, false
+	defer func() {
+		Stdout, Stderr, isStdoutTTY = stdout, stderr, stdoutTTY
+		if v := recover(); v != nil {
+			e, ok := v.(*exitStatus)
+			if !ok {
+				panic(v)
+			}
+			output.exitCode = e.code
+		}
+	}()
+	err := command.Execute(args)
+	if err != nil {
+		_, output.err = errorToMessage(err)
+		if output.err == nil {
+			output.err = err
+		}
+	}
+	return output
+}
+
+var columnExp = regexp.MustCompile(`\S+( \S+)*`)
+
+// writeTargetsText writes the targets' text output as a single table, with
+// a "Target" column added. Each target's table is split into cells using
+// the column positions of its heading.
+func writeTargetsText(name string, outputs []*targetOutput) error {
+	var headings []string
+	var rows [][]string
+	for _, output := range outputs {
+		text := strings.TrimRight(output.stdout.String(), "\n")
+		if text == "" {
+			continue
+		}
+		lines := strings.Split(text, "\n")
+		if heading, ok := targetValueHeadings[name]; ok {
+			headings = []string{heading}
+			for _, line := range lines {
+				rows = append(rows, []string{output.name, line})
+			}
+			continue
+		}
+		starts := columnExp.FindAllStringIndex(lines[0], -1)
+		if headings == nil {
+			for _, start := range starts {
+				headings = append(headings, lines[0][start[0]:start[1]])
+			}
+		}
+		for _, line := range lines[1:] {
+			row := []string{output.name}
+			for i, start := range starts {
+				end := len(line)
+				if i+1 < len(starts) && starts[i+1][0] < end {
+					end = starts[i+1][0]
+				}
+				cell := ""
+				if start[0] < end {
+					cell = strings.TrimRight(line[start[0]:end], " ")
+				}
+				row = append(row, cell)
+			}
+			rows = append(rows, row)
+		}
+	}
+	if headings == nil {
+		return nil
+	}
+	w := tabWriter()
+	defer w.Flush()
+	fmt.Fprintf(w, "Target\t%s\n", strings.Join(headings, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return nil
+}
+
+// writeTargetsStructured writes the targets' JSON or YAML output as a list
+// with the target and result (or error) of each.
+func writeTargetsStructured(format string, outputs []*targetOutput) error {
+	type targetResult struct {
+		Target string      `json:"target" yaml:"target"`
+		Result interface{} `json:"result,omitempty" yaml:"result,omitempty"`
+		Error  string      `json:"error,omitempty" yaml:"error,omitempty"`
+	}
+	results := make([]targetResult, len(outputs))
+	for i, output := range outputs {
+		results[i].Target = output.name
+		if output.err != nil {
+			results[i].Error = output.err.Error()
+			continue
+		}
+		// Keep the result as it was written, so its fields stay in order.
+		data := output.stdout.Bytes()
+		if format == "json" {
+			if len(bytes.TrimSpace(data)) > 0 {
+				results[i].Result = json.RawMessage(data)
+			}
+			continue
+		}
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return fmt.Errorf("internal error: cannot parse %s output: %v", output.name, err)
+		}
+		if len(node.Content) > 0 {
+			results[i].Result = node.Content[0]
+		}
+	}
+	return formatMixin{Format: format}.writeStructured(results)
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"gopkg.in/check.v1"
+
+	pebble "github.com/canonical/pebble/cmd/pebble"
+)
+
+// writeTargetsConfig starts a test server for each of the targets, serving
+// the given response to each request, and writes a client configuration
+// with a context for each.
+func (s *PebbleSuite) writeTargetsConfig(c *check.C, responses map[string]string) {
+	config := "contexts:\n"
+	for name, response := range responses {
+		response := response
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, response)
+		}))
+		s.AddCleanup(server.Close)
+		config += fmt.Sprintf("    %s:\n        base-url: %s\n", name, server.URL)
+	}
+	s.writeClientConfig(c, config)
+}
+
+func (s *PebbleSuite) TestTargetsServices(c *check.C) {
+	s.writeTargetsConfig(c, map[string]string{
+		"web": `{"type": "sync", "status-code": 200, "result": [
+			{"name": "nginx", "startup": "enabled", "current": "active"},
+			{"name": "cron", "startup": "disabled", "current": "inactive"}
+		]}`,
+		"database": `{"type": "sync", "status-code": 200, "result": [
+			{"name": "postgresql", "startup": "enabled", "current": "backoff"}
+		]}`,
+		"empty": `{"type": "sync", "status-code": 200, "result": []}`,
+	})
+
+	rest, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"--all-contexts", "services"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+Target    Service     Startup   Current
+database  postgresql  enabled   backoff
+web       nginx       enabled   active
+web       cron        disabled  inactive
+`[1:])
+	c.Check(s.Stderr(), check.Equals, "empty: Plan has no services\n")
+	s.ResetStdStreams()
+
+	rest, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"--targets", "web,empty", "services", "--format", "json"})
+	c.Assert(err, check.IsNil)
+	c.Assert(rest, check.HasLen, 0)
+	c.Check(s.Stdout(), check.Equals, `
+[
+    {
+        "target": "web",
+        "result": [
+            {
+                "name": "nginx",
+                "startup": "enabled",
+                "current": "active"
+            },
+            {
+                "name": "cron",
+                "startup": "disabled",
+                "current": "inactive"
+            }
+        ]
+    },
+    {
+        "target": "empty",
+        "result": []
+    }
+]
+`[1:])
+}
+
+func (s *PebbleSuite) TestTargetsHealth(c *check.C) {
+	s.writeTargetsConfig(c, map[string]string{
+		"one": `{"type": "sync", "status-code": 200, "result": {"healthy": true}}`,
+		"two": `{"type": "sync", "status-code": 502, "result": {"healthy": false}}`,
+	})
+
+	c.Assert(func() {
+		pebble.Parser(pebble.Client()).ParseArgs([]string{"--targets", "one,two", "health"})
+	}, check.PanicMatches, `.*exitStatus\{1\}.*`)
+	c.Check(s.Stdout(), check.Equals, `
+Target  Health
+one     healthy
+two     unhealthy
+`[1:])
+}
+
+func (s *PebbleSuite) TestTargetsErrors(c *check.C) {
+	s.writeTargetsConfig(c, map[string]string{
+		"good": `{"type": "sync", "status-code": 200, "result": [{"label": "base", "order": 1}]}`,
+		"bad":  `{"type": "error", "status-code": 500, "result": {"message": "internal error"}}`,
+	})
+
+	_, err := pebble.Parser(pebble.Client()).ParseArgs([]string{"--targets", "good,bad,missing", "layers"})
+	c.Assert(err, check.ErrorMatches, `cannot run "layers" on 2 of 3 targets`)
+	c.Check(s.Stdout(), check.Equals, `
+Target  Order  Label  Source  Summary
+good    001    base   file    -
+`[1:])
+	c.Check(s.Stderr(), check.Equals, `
+bad: error: internal error
+missing: error: cannot find context "missing" in client configuration
+`[1:])
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"--all-contexts", "start", "foo"})
+	c.Assert(err, check.ErrorMatches, `cannot use --targets or --all-contexts with "start" \(only with changes, health, layers, services\)`)
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"--all-contexts", "--targets", "good", "layers"})
+	c.Assert(err, check.ErrorMatches, `cannot use --targets and --all-contexts together`)
+
+	_, err = pebble.Parser(pebble.Client()).ParseArgs([]string{"--context", "good", "--targets", "good", "layers"})
+	c.Assert(err, check.ErrorMatches, `cannot use --targets or --all-contexts with --context, --dir, --socket or --remote`)
+}
@@ -28,6 +28,10 @@ import (
 var (
 	maxGoneTime = 5 * time.Second
 	pollTime    = 100 * time.Millisecond
+
+	// pollWait is how long each request waits for the change to be ready,
+	// so progress is still shown at least this often.
+	pollWait = time.Second
 )
 
 type waitMixin struct {
@@ -37,7 +41,7 @@ type waitMixin struct {
 }
 
 var waitDescs = map[string]string{
-	"no-wait": "Do not wait for the operation to finish but just print the change id.",
+	"no-wait": "Do not wait for the operation to finish but just print the change id (see 'pebble wait').",
 }
 
 var noWait = errors.New("no wait for op")
@@ -79,7 +83,8 @@ func (wmx waitMixin) wait(id string) (*client.Change, error) {
 	lastLog := map[string]string{}
 	for {
 		var rebootingErr error
-		chg, err := cli.Change(id)
+		start := time.Now()
+		chg, err := cli.PollChange(id, pollWait)
 		if err != nil {
 			// A client.Error means we were able to communicate with
 			// the server (got an answer).
@@ -145,9 +150,11 @@ func (wmx waitMixin) wait(id string) (*client.Change, error) {
 			return nil, rebootingErr
 		}
 
-		// Not a ticker so it sleeps 100ms between calls
-		// rather than call once every 100ms.
-		time.Sleep(pollTime)
+		// The daemon waits up to pollWait for the change to be ready, but
+		// an older one returns straight away, so don't poll it too often.
+		if elapsed := time.Since(start); elapsed < pollTime {
+			time.Sleep(pollTime - elapsed)
+		}
 	}
 }
 
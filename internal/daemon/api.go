@@ -64,6 +64,7 @@ var api = []*Command{{
 }, {
 	Path:   "/v1/layers",
 	UserOK: true,
+	GET:    v1GetLayers,
 	POST:   v1PostLayers,
 }, {
 	Path:   "/v1/files",
@@ -82,10 +83,51 @@ var api = []*Command{{
 	Path:   "/v1/tasks/{task-id}/websocket/{websocket-id}",
 	UserOK: true,
 	GET:    v1GetTaskWebsocket,
+}, {
+	Path:   "/v1/events",
+	UserOK: true,
+	GET:    v1GetEvents,
 }, {
 	Path:   "/v1/signals",
 	UserOK: true,
 	POST:   v1PostSignals,
+}, {
+	Path:        "/v1/health",
+	GuestOK:     true,
+	UntrustedOK: true,
+	HTTPOK:      true,
+	GET:         v1Health,
+}, {
+	Path:        "/v1/metrics",
+	GuestOK:     true,
+	UntrustedOK: true,
+	HTTPOK:      true,
+	GET:         v1GetMetrics,
+}, {
+	Path:        "/v1/notices",
+	UserOK:      true,
+	UntrustedOK: true,
+	GET:         v1GetNotices,
+	POST:        v1PostNotices,
+}, {
+	Path:        "/v1/notices/{id}",
+	UserOK:      true,
+	UntrustedOK: true,
+	GET:         v1GetNotice,
+}, {
+	Path:      "/v1/state",
+	AdminOnly: true,
+	GET:       v1GetState,
+	POST:      v1PostState,
+}, {
+	Path:      "/v1/debug",
+	AdminOnly: true,
+	GET:       v1GetDebug,
+	POST:      v1PostDebug,
+}, {
+	PathPrefix: "/v1/debug/pprof/",
+	AdminOnly:  true,
+	GET:        v1GetPprof,
 }}
 
 var (
@@ -95,6 +137,7 @@ var (
 	stateEnsureBefore    = (*state.State).EnsureBefore
 
 	overlordServiceManager = (*overlord.Overlord).ServiceManager
+	overlordCheckManager   = (*overlord.Overlord).CheckManager
 
 	muxVars = mux.Vars
 )
@@ -110,13 +153,44 @@ func newChange(st *state.State, kind, summary string, taskSets []*state.TaskSet,
 	return chg
 }
 
+// apiFeatures lists the optional API features this daemon supports, so that
+// clients can give a clear error when talking to an older daemon. Add to
+// this list when adding endpoints or actions (but never remove from it).
+var apiFeatures = []string{
+	"changes-wait",
+	"debug-audit",
+	"debug-pprof",
+	"debug-prune",
+	"debug-reexec",
+	"events",
+	"exec-detach",
+	"files-archive",
+	"files-checksum",
+	"files-glob",
+	"files-symlinks",
+	"health",
+	"health-checks",
+	"layers-content",
+	"layers-list",
+	"layers-move",
+	"layers-persist",
+	"layers-remove",
+	"layers-replace",
+	"metrics",
+	"notices",
+	"notices-wait",
+	"services-reload",
+	"state",
+}
+
 func v1SystemInfo(c *Command, r *http.Request, _ *userState) Response {
 	state := c.d.overlord.State()
 	state.Lock()
 	defer state.Unlock()
 	result := map[string]interface{}{
-		"version": c.d.Version,
-		"boot-id": restart.BootID(state),
+		"version":  c.d.Version,
+		"boot-id":  restart.BootID(state),
+		"features": apiFeatures,
 	}
 	return SyncResponse(result)
 }
@@ -47,8 +47,13 @@ type taskInfo struct {
 	Progress taskInfoProgress `json:"progress"`
 
 	SpawnTime time.Time  `json:"spawn-time,omitempty"`
+	StartTime *time.Time `json:"start-time,omitempty"`
 	ReadyTime *time.Time `json:"ready-time,omitempty"`
 
+	// DoingTime and UndoingTime are durations such as "1.5s".
+	DoingTime   string `json:"doing-time,omitempty"`
+	UndoingTime string `json:"undoing-time,omitempty"`
+
 	Data map[string]*json.RawMessage `json:"data,omitempty"`
 }
 
@@ -95,10 +100,20 @@ func change2changeInfo(chg *state.Change) *changeInfo {
 			},
 			SpawnTime: t.SpawnTime(),
 		}
+		startTime := t.StartTime()
+		if !startTime.IsZero() {
+			taskInfo.StartTime = &startTime
+		}
 		readyTime := t.ReadyTime()
 		if !readyTime.IsZero() {
 			taskInfo.ReadyTime = &readyTime
 		}
+		if doingTime := t.DoingTime(); doingTime > 0 {
+			taskInfo.DoingTime = doingTime.String()
+		}
+		if undoingTime := t.UndoingTime(); undoingTime > 0 {
+			taskInfo.UndoingTime = undoingTime.String()
+		}
 		var data map[string]*json.RawMessage
 		if t.Get("api-data", &data) == nil {
 			taskInfo.Data = data
@@ -172,6 +187,15 @@ func v1GetChanges(c *Command, r *http.Request, _ *userState) Response {
 
 func v1GetChange(c *Command, r *http.Request, _ *userState) Response {
 	changeID := muxVars(r)["id"]
+	var wait time.Duration
+	if waitStr := r.URL.Query().Get("wait"); waitStr != "" {
+		var err error
+		wait, err = time.ParseDuration(waitStr)
+		if err != nil || wait < 0 {
+			return statusBadRequest("invalid wait %q", waitStr)
+		}
+	}
+
 	st := c.d.overlord.State()
 	st.Lock()
 	defer st.Unlock()
@@ -180,6 +204,23 @@ func v1GetChange(c *Command, r *http.Request, _ *userState) Response {
 		return statusNotFound("cannot find change with id %q", changeID)
 	}
 
+	if wait > 0 && !chg.IsReady() {
+		// Long poll: return the change once it's ready, or as it is when
+		// the wait elapses, whichever is first.
+		st.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-chg.Ready():
+			timer.Stop()
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			st.Lock()
+			return statusInternalError("request cancelled")
+		}
+		st.Lock()
+	}
+
 	return SyncResponse(change2changeInfo(chg))
 }
 
@@ -445,6 +445,12 @@ func (s *apiSuite) TestWaitChangeTimeoutCancel(c *check.C) {
 }
 
 func (s *apiSuite) testWaitChange(ctx context.Context, c *check.C, query string, markReady func(st *state.State, change *state.Change)) (*httptest.ResponseRecorder, *resp, string) {
+	return s.testGetChange(ctx, c, "/wait"+query, v1GetChangeWait, markReady)
+}
+
+// testGetChange creates a change that isn't ready and calls handler for the
+// change's endpoint (with suffix added to the URL), returning the response.
+func (s *apiSuite) testGetChange(ctx context.Context, c *check.C, suffix string, handler ResponseFunc, markReady func(st *state.State, change *state.Change)) (*httptest.ResponseRecorder, *resp, string) {
 	// Setup
 	d := s.daemon(c)
 	st := d.overlord.State()
@@ -460,10 +466,52 @@ func (s *apiSuite) testWaitChange(ctx context.Context, c *check.C, query string,
 
 	// Execute
 	s.vars = map[string]string{"id": change.ID()}
-	req, err := http.NewRequestWithContext(ctx, "GET", "/v1/changes/"+change.ID()+"/wait"+query, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", "/v1/changes/"+change.ID()+suffix, nil)
 	c.Assert(err, check.IsNil)
-	rsp := v1GetChangeWait(apiCmd("/v1/changes/{id}/wait"), req, nil).(*resp)
+	rsp := handler(apiCmd("/v1/changes/{id}"), req, nil).(*resp)
 	rec := httptest.NewRecorder()
 	rsp.ServeHTTP(rec, req)
 	return rec, rsp, change.ID()
 }
+
+func (s *apiSuite) TestStateChangeLongPoll(c *check.C) {
+	rec, rsp, changeID := s.testGetChange(context.Background(), c, "?wait=5s", v1GetChange, func(st *state.State, change *state.Change) {
+		time.Sleep(10 * time.Millisecond)
+		st.Lock()
+		change.SetStatus(state.DoneStatus)
+		st.Unlock()
+	})
+	c.Assert(rec.Code, check.Equals, 200)
+	result := rsp.Result.(*changeInfo)
+	c.Check(result.ID, check.Equals, changeID)
+	c.Check(result.Ready, check.Equals, true)
+}
+
+func (s *apiSuite) TestStateChangeLongPollElapsed(c *check.C) {
+	// The change is returned as it is when the wait elapses.
+	rec, rsp, changeID := s.testGetChange(context.Background(), c, "?wait=10ms", v1GetChange, nil)
+	c.Assert(rec.Code, check.Equals, 200)
+	result := rsp.Result.(*changeInfo)
+	c.Check(result.ID, check.Equals, changeID)
+	c.Check(result.Ready, check.Equals, false)
+}
+
+func (s *apiSuite) TestStateChangeLongPollCancel(c *check.C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	rec, rsp, _ := s.testGetChange(ctx, c, "?wait=5s", v1GetChange, nil)
+	c.Check(rec.Code, check.Equals, 500)
+	c.Check(rsp.Result.(*errorResult).Message, check.Equals, "request cancelled")
+}
+
+func (s *apiSuite) TestStateChangeLongPollInvalid(c *check.C) {
+	s.daemon(c)
+	for _, wait := range []string{"BAD", "-1s"} {
+		req, err := http.NewRequest("GET", "/v1/changes/x?wait="+wait, nil)
+		c.Assert(err, check.IsNil)
+		rsp := v1GetChange(apiCmd("/v1/changes/{id}"), req, nil).(*resp)
+		c.Check(rsp.Status, check.Equals, 400)
+		c.Check(rsp.Result.(*errorResult).Message, check.Equals, fmt.Sprintf("invalid wait %q", wait))
+	}
+}
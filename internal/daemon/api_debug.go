@@ -0,0 +1,104 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+type debugAction struct {
+	Action string          `json:"action"`
+	Params json.RawMessage `json:"params"`
+}
+
+func v1PostDebug(c *Command, r *http.Request, _ *userState) Response {
+	var payload debugAction
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&payload); err != nil {
+		return statusBadRequest("cannot decode request body: %v", err)
+	}
+
+	switch payload.Action {
+	case "prune":
+		return pruneChanges(c)
+	case "reexec":
+		c.d.Reexec()
+		return SyncResponse(nil)
+	default:
+		return statusBadRequest("unknown debug action: %v", payload.Action)
+	}
+}
+
+func v1GetDebug(c *Command, r *http.Request, _ *userState) Response {
+	action := r.URL.Query().Get("action")
+	switch action {
+	case "audit":
+		return SyncResponse(c.d.auditLog.entries())
+	default:
+		return statusBadRequest("unknown debug action: %v", action)
+	}
+}
+
+// pruneChanges forces a prune of old changes, responding with the number of
+// changes removed.
+func pruneChanges(c *Command) Response {
+	st := c.d.overlord.State()
+	st.Lock()
+	before := len(st.Changes())
+	st.Unlock()
+
+	c.d.overlord.Prune()
+
+	st.Lock()
+	after := len(st.Changes())
+	st.Unlock()
+
+	return SyncResponse(map[string]interface{}{
+		"pruned": before - after,
+	})
+}
+
+// pprofResponse is a Response that serves a runtime profile with the
+// net/http/pprof handlers.
+type pprofResponse string
+
+func (name pprofResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch name {
+	case "":
+		pprof.Index(w, r)
+	case "cmdline":
+		pprof.Cmdline(w, r)
+	case "profile":
+		pprof.Profile(w, r)
+	case "symbol":
+		pprof.Symbol(w, r)
+	case "trace":
+		pprof.Trace(w, r)
+	default:
+		pprof.Handler(string(name)).ServeHTTP(w, r)
+	}
+}
+
+// v1GetPprof serves the runtime profiles, if enabled with the daemon's Pprof
+// option.
+func v1GetPprof(c *Command, r *http.Request, _ *userState) Response {
+	if !c.d.pprof {
+		return statusNotFound("pprof endpoints are not enabled (see 'pebble run --pprof')")
+	}
+	return pprofResponse(strings.TrimPrefix(r.URL.Path, "/v1/debug/pprof/"))
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/overlord/state"
+)
+
+func (s *apiSuite) TestDebugPrune(c *C) {
+	d := s.daemon(c)
+	d.overlord.SetPruneLimits(time.Hour, 1)
+	debugCmd := apiCmd("/v1/debug")
+
+	st := d.overlord.State()
+	st.Lock()
+	for i := 0; i < 3; i++ {
+		chg := st.NewChange("foo", "...")
+		chg.SetStatus(state.DoneStatus)
+	}
+	st.Unlock()
+
+	req, err := http.NewRequest("POST", "/v1/debug", bytes.NewBufferString(`{"action": "prune"}`))
+	c.Assert(err, IsNil)
+	rsp := v1PostDebug(debugCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Check(rsp.Result, DeepEquals, map[string]interface{}{"pruned": 2})
+
+	st.Lock()
+	c.Check(st.Changes(), HasLen, 1)
+	st.Unlock()
+}
+
+func (s *apiSuite) TestDebugReexec(c *C) {
+	d := s.daemon(c)
+	debugCmd := apiCmd("/v1/debug")
+
+	req, err := http.NewRequest("POST", "/v1/debug", bytes.NewBufferString(`{"action": "reexec"}`))
+	c.Assert(err, IsNil)
+	rsp := v1PostDebug(debugCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+
+	select {
+	case <-d.Dying():
+	case <-time.After(time.Second):
+		c.Fatal("daemon did not start dying")
+	}
+	d.mu.Lock()
+	c.Check(d.reexec, Equals, true)
+	d.mu.Unlock()
+}
+
+func (s *apiSuite) TestDebugErrors(c *C) {
+	_ = s.daemon(c)
+	debugCmd := apiCmd("/v1/debug")
+
+	for _, test := range []struct {
+		payload string
+		message string
+	}{
+		{"@", `cannot decode request body: .*`},
+		{`{"action": "foo"}`, `unknown debug action: foo`},
+	} {
+		req, err := http.NewRequest("POST", "/v1/debug", bytes.NewBufferString(test.payload))
+		c.Assert(err, IsNil)
+		rsp := v1PostDebug(debugCmd, req, nil).(*resp)
+		c.Check(rsp.Status, Equals, 400)
+		c.Check(rsp.Result.(*errorResult).Message, Matches, test.message)
+	}
+}
+
+func (s *apiSuite) TestDebugAudit(c *C) {
+	d := s.daemon(c)
+	d.auditLog.record(auditEntry{Method: "POST", Path: "/v1/services", Status: 202})
+	debugCmd := apiCmd("/v1/debug")
+
+	req, err := http.NewRequest("GET", "/v1/debug?action=audit", nil)
+	c.Assert(err, IsNil)
+	rsp := v1GetDebug(debugCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Check(rsp.Result, DeepEquals, []auditEntry{{Method: "POST", Path: "/v1/services", Status: 202}})
+
+	req, err = http.NewRequest("GET", "/v1/debug?action=foo", nil)
+	c.Assert(err, IsNil)
+	rsp = v1GetDebug(debugCmd, req, nil).(*resp)
+	c.Check(rsp.Status, Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "unknown debug action: foo")
+}
+
+func (s *apiSuite) TestDebugPprof(c *C) {
+	d := s.daemon(c)
+	pprofCmd := apiCmd("/v1/debug/pprof/")
+
+	req, err := http.NewRequest("GET", "/v1/debug/pprof/goroutine?debug=1", nil)
+	c.Assert(err, IsNil)
+	rsp := v1GetPprof(pprofCmd, req, nil).(*resp)
+	c.Check(rsp.Status, Equals, 404)
+	c.Check(rsp.Result.(*errorResult).Message, Matches, "pprof endpoints are not enabled .*")
+
+	d.pprof = true
+	rec := httptest.NewRecorder()
+	v1GetPprof(pprofCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, Equals, 200)
+	c.Check(rec.Body.String(), Matches, `(?s)goroutine profile: total \d+\n.*`)
+
+	req, err = http.NewRequest("GET", "/v1/debug/pprof/", nil)
+	c.Assert(err, IsNil)
+	rec = httptest.NewRecorder()
+	v1GetPprof(pprofCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, Equals, 200)
+	c.Check(rec.Body.String(), Matches, `(?s).*heap.*`)
+}
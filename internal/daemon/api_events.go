@@ -0,0 +1,279 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/canonical/pebble/internal/logger"
+	"github.com/canonical/pebble/internal/overlord/servstate"
+	"github.com/canonical/pebble/internal/overlord/state"
+	"github.com/canonical/pebble/internal/strutil"
+)
+
+const (
+	// Types of events sent on the /v1/events websocket.
+	eventChangeStatus = "change-status"
+	eventTaskStatus   = "task-status"
+	eventTaskProgress = "task-progress"
+	eventService      = "service"
+
+	// eventQueueSize is the number of events buffered for each subscriber.
+	// Subscribers that fall further behind than this are disconnected.
+	eventQueueSize = 256
+
+	eventWriteTimeout = 10 * time.Second
+)
+
+var eventTypes = []string{eventChangeStatus, eventTaskStatus, eventTaskProgress, eventService}
+
+// eventInfo is the JSON representation of an event. Which fields are set
+// depends on the event type.
+type eventInfo struct {
+	Type      string            `json:"type"`
+	Time      time.Time         `json:"time"`
+	ChangeID  string            `json:"change-id,omitempty"`
+	TaskID    string            `json:"task-id,omitempty"`
+	Kind      string            `json:"kind,omitempty"`
+	Summary   string            `json:"summary,omitempty"`
+	Status    string            `json:"status,omitempty"`
+	OldStatus string            `json:"old-status,omitempty"`
+	Err       string            `json:"err,omitempty"`
+	Progress  *taskInfoProgress `json:"progress,omitempty"`
+	Service   string            `json:"service,omitempty"`
+}
+
+// eventHub fans out events to the /v1/events subscribers.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[*eventSubscriber]bool
+}
+
+type eventSubscriber struct {
+	events chan *eventInfo
+	filter func(e *eventInfo) bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subscribers: make(map[*eventSubscriber]bool)}
+}
+
+// subscribe returns a new subscriber that receives the events that match
+// filter. Its channel is closed if it falls too far behind.
+func (h *eventHub) subscribe(filter func(e *eventInfo) bool) *eventSubscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub := &eventSubscriber{
+		events: make(chan *eventInfo, eventQueueSize),
+		filter: filter,
+	}
+	h.subscribers[sub] = true
+	return sub
+}
+
+func (h *eventHub) unsubscribe(sub *eventSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[sub] {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// publish sends the event to all matching subscribers. It never blocks, as
+// it's called with the state or services lock held.
+func (h *eventHub) publish(e *eventInfo) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		if !sub.filter(e) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			delete(h.subscribers, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// watch registers handlers that publish change, task and service events.
+func (h *eventHub) watch(st *state.State, servmgr *servstate.ServiceManager) {
+	st.Lock()
+	st.AddChangeStatusChangedHandler(func(chg *state.Change, old, new state.Status) {
+		e := &eventInfo{
+			Type:     eventChangeStatus,
+			Time:     time.Now(),
+			ChangeID: chg.ID(),
+			Kind:     chg.Kind(),
+			Summary:  chg.Summary(),
+			Status:   new.String(),
+		}
+		if old != state.DefaultStatus {
+			e.OldStatus = old.String()
+		}
+		if new.Ready() {
+			if err := chg.Err(); err != nil {
+				e.Err = err.Error()
+			}
+		}
+		h.publish(e)
+	})
+	st.AddTaskStatusChangedHandler(func(t *state.Task, old, new state.Status) {
+		e := newTaskEvent(eventTaskStatus, t)
+		e.Status = new.String()
+		e.OldStatus = old.String()
+		h.publish(e)
+	})
+	st.AddTaskProgressHandler(func(t *state.Task) {
+		e := newTaskEvent(eventTaskProgress, t)
+		label, done, total := t.Progress()
+		e.Progress = &taskInfoProgress{Label: label, Done: done, Total: total}
+		h.publish(e)
+	})
+	st.Unlock()
+
+	servmgr.NotifyServiceEvents(func(event servstate.ServiceEvent) {
+		h.publish(&eventInfo{
+			Type:    eventService,
+			Time:    time.Now(),
+			Service: event.Service,
+			Status:  string(event.Kind),
+		})
+	})
+}
+
+func newTaskEvent(eventType string, t *state.Task) *eventInfo {
+	e := &eventInfo{
+		Type:    eventType,
+		Time:    time.Now(),
+		TaskID:  t.ID(),
+		Kind:    t.Kind(),
+		Summary: t.Summary(),
+	}
+	if chg := t.Change(); chg != nil {
+		e.ChangeID = chg.ID()
+	}
+	return e
+}
+
+var eventsUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func v1GetEvents(c *Command, r *http.Request, _ *userState) Response {
+	query := r.URL.Query()
+
+	types := make(map[string]bool)
+	for _, typesStr := range query["types"] {
+		for _, t := range strings.Split(typesStr, ",") {
+			if !strutil.ListContains(eventTypes, t) {
+				return statusBadRequest("invalid event type %q", t)
+			}
+			types[t] = true
+		}
+	}
+	changeID := query.Get("change-id")
+	services := make(map[string]bool)
+	for _, servicesStr := range query["services"] {
+		for _, name := range strings.Split(servicesStr, ",") {
+			services[name] = true
+		}
+	}
+
+	filter := func(e *eventInfo) bool {
+		if len(types) > 0 && !types[e.Type] {
+			return false
+		}
+		if changeID != "" && e.Type != eventService && e.ChangeID != changeID {
+			return false
+		}
+		if len(services) > 0 && e.Type == eventService && !services[e.Service] {
+			return false
+		}
+		return true
+	}
+	return eventsResponse{
+		hub:    c.d.events,
+		filter: filter,
+		dying:  c.d.tomb.Dying(),
+	}
+}
+
+// eventsResponse is a Response implementation that streams events over a
+// websocket until the client disconnects or the daemon stops.
+type eventsResponse struct {
+	hub    *eventHub
+	filter func(e *eventInfo) bool
+	dying  <-chan struct{}
+}
+
+func (r eventsResponse) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// Subscribe before completing the handshake, so that a client can fetch
+	// the current state once connected without missing any events.
+	sub := r.hub.subscribe(r.filter)
+	defer r.hub.unsubscribe(sub)
+
+	conn, err := eventsUpgrader.Upgrade(w, req, nil)
+	if err != nil {
+		// Upgrade has already written an error response.
+		logger.Noticef("Cannot upgrade events connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Read (and discard) anything the client sends, to process control
+	// messages and notice when the client goes away.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case e, ok := <-sub.events:
+			if !ok {
+				writeClose(conn, websocket.ClosePolicyViolation, "too many events pending")
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			if err := conn.WriteJSON(e); err != nil {
+				logger.Debugf("Cannot write event: %v", err)
+				return
+			}
+		case <-closed:
+			return
+		case <-r.dying:
+			writeClose(conn, websocket.CloseGoingAway, "daemon stopping")
+			return
+		}
+	}
+}
+
+func writeClose(conn *websocket.Conn, code int, text string) {
+	msg := websocket.FormatCloseMessage(code, text)
+	conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(eventWriteTimeout))
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "gopkg.in/check.v1"
+)
+
+func (s *apiSuite) eventsServer(c *C) *httptest.Server {
+	cmd := apiCmd("/v1/events")
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cmd.GET(cmd, r, nil).ServeHTTP(w, r)
+	}))
+}
+
+func (s *apiSuite) TestEvents(c *C) {
+	writeTestLayer(s.pebbleDir, `
+services:
+    test1:
+        override: replace
+        command: /bin/sh -c "exit 0"
+        kind: oneshot
+`)
+	d := s.daemon(c)
+	d.overlord.Loop()
+	defer d.overlord.Stop()
+
+	srv := s.eventsServer(c)
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial(strings.Replace(srv.URL, "http", "ws", 1), nil)
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	// Wait till the subscriber is registered before starting the service.
+	for i := 0; ; i++ {
+		if i > 100 {
+			c.Fatalf("timed out waiting for events subscriber")
+		}
+		d.events.mu.Lock()
+		n := len(d.events.subscribers)
+		d.events.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	payload := bytes.NewBufferString(`{"action": "start", "services": ["test1"]}`)
+	req, err := http.NewRequest("POST", "/v1/services", payload)
+	c.Assert(err, IsNil)
+	rsp := v1PostServices(apiCmd("/v1/services"), req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Assert(rec.Result().StatusCode, Equals, 202)
+	changeID := rsp.Change
+
+	var events []string
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		var e eventInfo
+		err := conn.ReadJSON(&e)
+		c.Assert(err, IsNil)
+		if e.Type != eventService {
+			c.Check(e.ChangeID, Equals, changeID)
+		}
+		events = append(events, fmt.Sprintf("%s %s %s->%s", e.Type, e.Service+e.Kind, e.OldStatus, e.Status))
+		if e.Type == eventChangeStatus && e.Status == "Done" {
+			break
+		}
+	}
+	c.Check(events, DeepEquals, []string{
+		"change-status start ->Do",
+		"task-status start Do->Doing",
+		"change-status start Do->Doing",
+		"service test1 ->stopped",
+		"task-status start Doing->Done",
+		"change-status start Doing->Done",
+	})
+}
+
+func (s *apiSuite) TestEventsFilter(c *C) {
+	s.daemon(c)
+
+	hub := newEventHub()
+	cmd := apiCmd("/v1/events")
+	req, err := http.NewRequest("GET", "/v1/events?types=task-status,service&change-id=1&services=svc1", nil)
+	c.Assert(err, IsNil)
+	rsp, ok := cmd.GET(cmd, req, nil).(eventsResponse)
+	c.Assert(ok, Equals, true)
+	sub := hub.subscribe(rsp.filter)
+
+	hub.publish(&eventInfo{Type: eventTaskStatus, ChangeID: "1", TaskID: "1"})
+	hub.publish(&eventInfo{Type: eventTaskStatus, ChangeID: "2", TaskID: "2"})
+	hub.publish(&eventInfo{Type: eventChangeStatus, ChangeID: "1"})
+	hub.publish(&eventInfo{Type: eventService, Service: "svc1"})
+	hub.publish(&eventInfo{Type: eventService, Service: "svc2"})
+	hub.unsubscribe(sub)
+
+	var received []eventInfo
+	for e := range sub.events {
+		received = append(received, *e)
+	}
+	c.Check(received, DeepEquals, []eventInfo{
+		{Type: eventTaskStatus, ChangeID: "1", TaskID: "1"},
+		{Type: eventService, Service: "svc1"},
+	})
+
+	req, err = http.NewRequest("GET", "/v1/events?types=foo", nil)
+	c.Assert(err, IsNil)
+	errRsp, ok := cmd.GET(cmd, req, nil).(*resp)
+	c.Assert(ok, Equals, true)
+	c.Check(errRsp.Status, Equals, 400)
+	c.Check(errRsp.Result.(*errorResult).Message, Equals, `invalid event type "foo"`)
+}
+
+func (s *apiSuite) TestEventsSlowSubscriber(c *C) {
+	hub := newEventHub()
+	sub := hub.subscribe(func(e *eventInfo) bool { return true })
+	for i := 0; i < eventQueueSize+1; i++ {
+		hub.publish(&eventInfo{Type: eventService})
+	}
+	n := 0
+	for range sub.events {
+		n++
+	}
+	c.Check(n, Equals, eventQueueSize)
+	// Unsubscribing after being dropped is fine.
+	hub.unsubscribe(sub)
+}
@@ -40,6 +40,7 @@ type execPayload struct {
 	SplitStderr bool              `json:"split-stderr"`
 	Width       int               `json:"width"`
 	Height      int               `json:"height"`
+	Detach      bool              `json:"detach"`
 }
 
 func v1PostExec(c *Command, req *http.Request, _ *userState) Response {
@@ -51,6 +52,9 @@ func v1PostExec(c *Command, req *http.Request, _ *userState) Response {
 	if len(payload.Command) < 1 {
 		return statusBadRequest("must specify command")
 	}
+	if payload.Detach && (payload.Terminal || payload.Interactive) {
+		return statusBadRequest("cannot use terminal or interactive mode with detach")
+	}
 
 	var timeout time.Duration
 	if payload.Timeout != "" {
@@ -77,6 +81,17 @@ func v1PostExec(c *Command, req *http.Request, _ *userState) Response {
 	st.Lock()
 	defer st.Unlock()
 
+	if c.d.maxExecs > 0 && runningExecs(st) >= c.d.maxExecs {
+		return &resp{
+			Type: ResponseTypeError,
+			Result: &errorResult{
+				Kind:    errorKindTooManyExecs,
+				Message: fmt.Sprintf("too many commands running (limit %d)", c.d.maxExecs),
+			},
+			Status: 429,
+		}
+	}
+
 	args := &cmdstate.ExecArgs{
 		Command:     payload.Command,
 		Environment: payload.Environment,
@@ -89,6 +104,7 @@ func v1PostExec(c *Command, req *http.Request, _ *userState) Response {
 		SplitStderr: payload.SplitStderr,
 		Width:       payload.Width,
 		Height:      payload.Height,
+		Detach:      payload.Detach,
 	}
 	task, metadata, err := cmdstate.Exec(st, args)
 	if err != nil {
@@ -108,3 +124,15 @@ func v1PostExec(c *Command, req *http.Request, _ *userState) Response {
 	}
 	return AsyncResponse(result, change.ID())
 }
+
+// runningExecs returns the number of exec changes that aren't ready yet,
+// including those still waiting for their websockets to be connected.
+func runningExecs(st *state.State) int {
+	n := 0
+	for _, chg := range st.Changes() {
+		if chg.Kind() == "exec" && !chg.Status().Ready() {
+			n++
+		}
+	}
+	return n
+}
@@ -308,6 +308,130 @@ func (s *execSuite) TestUserGroupError(c *C) {
 	c.Check(execResp.Result["message"], Matches, ".*must specify user, not just group.*")
 }
 
+func (s *execSuite) TestDetached(c *C) {
+	changeID, err := s.client.ExecDetached(&client.ExecOptions{
+		Command: []string{"/bin/sh", "-c", "echo OUT; echo ERR >&2"},
+	})
+	c.Assert(err, IsNil)
+
+	change := s.waitChange(c, changeID)
+	c.Check(change.Status, Equals, "Done")
+	c.Check(change.Err, Equals, "")
+	c.Assert(change.Tasks, HasLen, 1)
+	task := change.Tasks[0]
+	c.Assert(task.Log, HasLen, 1)
+	c.Check(task.Log[0], Matches, `(?s)\S+ INFO Output:\nOUT\nERR\n`)
+	var exitCode int
+	c.Assert(task.Get("exit-code", &exitCode), IsNil)
+	c.Check(exitCode, Equals, 0)
+}
+
+func (s *execSuite) TestDetachedExitError(c *C) {
+	changeID, err := s.client.ExecDetached(&client.ExecOptions{
+		Command: []string{"/bin/sh", "-c", "exit 3"},
+	})
+	c.Assert(err, IsNil)
+
+	change := s.waitChange(c, changeID)
+	c.Check(change.Status, Equals, "Error")
+	c.Check(change.Err, Matches, `(?s).*exited with code 3.*`)
+	c.Assert(change.Tasks, HasLen, 1)
+	c.Check(change.Tasks[0].Log, HasLen, 1) // just the error, no output
+	var exitCode int
+	c.Assert(change.Tasks[0].Get("exit-code", &exitCode), IsNil)
+	c.Check(exitCode, Equals, 3)
+}
+
+func (s *execSuite) TestDetachedBackgroundChild(c *C) {
+	// The background child keeps the output open after the command exits.
+	changeID, err := s.client.ExecDetached(&client.ExecOptions{
+		Command: []string{"/bin/sh", "-c", "echo OUT; sleep 10 &"},
+	})
+	c.Assert(err, IsNil)
+
+	start := time.Now()
+	change := s.waitChange(c, changeID)
+	c.Check(time.Since(start) < 5*time.Second, Equals, true)
+	c.Check(change.Status, Equals, "Done")
+	c.Assert(change.Tasks, HasLen, 1)
+	c.Assert(change.Tasks[0].Log, HasLen, 1)
+	c.Check(change.Tasks[0].Log[0], Matches, `(?s)\S+ INFO Output:\nOUT\n`)
+}
+
+func (s *execSuite) TestDetachedTimeout(c *C) {
+	changeID, err := s.client.ExecDetached(&client.ExecOptions{
+		Command: []string{"sleep", "1"},
+		Timeout: 10 * time.Millisecond,
+	})
+	c.Assert(err, IsNil)
+
+	change := s.waitChange(c, changeID)
+	c.Check(change.Status, Equals, "Error")
+	c.Check(change.Err, Matches, `(?s).*timed out after 10ms.*`)
+}
+
+func (s *execSuite) TestDetachedTerminal(c *C) {
+	body := []byte(`{"command": ["echo", "foo"], "detach": true, "terminal": true}`)
+	httpResp, respBody := doRequest(c, v1PostExec, "POST", "/v1/exec", nil, nil, body)
+	c.Check(httpResp.StatusCode, Equals, http.StatusBadRequest)
+	var execResp execResponse
+	c.Assert(json.Unmarshal(respBody.Bytes(), &execResp), IsNil)
+	c.Check(execResp.Result["message"], Equals, "cannot use terminal or interactive mode with detach")
+}
+
+func (s *execSuite) TestDetachedTruncatesOutput(c *C) {
+	// Write 100KiB of "x" then a marker line; only the tail is logged.
+	changeID, err := s.client.ExecDetached(&client.ExecOptions{
+		Command: []string{"/bin/sh", "-c", "head -c 102400 /dev/zero | tr '\\0' x; echo; echo END"},
+	})
+	c.Assert(err, IsNil)
+
+	change := s.waitChange(c, changeID)
+	c.Check(change.Status, Equals, "Done")
+	c.Assert(change.Tasks[0].Log, HasLen, 1)
+	log := change.Tasks[0].Log[0]
+	c.Check(strings.Contains(log, "Output (last 65536 bytes):\n"), Equals, true)
+	c.Check(strings.HasSuffix(log, "x\nEND\n"), Equals, true)
+}
+
+// waitChange polls until the change is ready, and returns it.
+func (s *execSuite) TestMaxExecs(c *C) {
+	s.daemon.maxExecs = 1
+
+	changeID, err := s.client.ExecDetached(&client.ExecOptions{
+		Command: []string{"sleep", "0.5"},
+	})
+	c.Assert(err, IsNil)
+
+	_, err = s.client.ExecDetached(&client.ExecOptions{
+		Command: []string{"true"},
+	})
+	c.Assert(err, ErrorMatches, `too many commands running \(limit 1\)`)
+	c.Check(client.IsTooManyExecs(err), Equals, true)
+
+	// Once the first command has finished, another can be started.
+	s.waitChange(c, changeID)
+	changeID, err = s.client.ExecDetached(&client.ExecOptions{
+		Command: []string{"true"},
+	})
+	c.Assert(err, IsNil)
+	change := s.waitChange(c, changeID)
+	c.Check(change.Status, Equals, "Done")
+}
+
+func (s *execSuite) waitChange(c *C, changeID string) *client.Change {
+	for i := 0; i < 500; i++ {
+		change, err := s.client.Change(changeID)
+		c.Assert(err, IsNil)
+		if change.Ready {
+			return change
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatalf("timed out waiting for change %s", changeID)
+	return nil
+}
+
 type execResponse struct {
 	StatusCode int                    `json:"status-code"`
 	Type       string                 `json:"type"`
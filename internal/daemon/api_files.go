@@ -15,6 +15,10 @@
 package daemon
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -27,10 +31,12 @@ import (
 	"os"
 	"os/user"
 	pathpkg "path"
+	"path/filepath"
 	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/canonical/pebble/internal/logger"
 	"github.com/canonical/pebble/internal/osutil"
 	"github.com/canonical/pebble/internal/osutil/sys"
 )
@@ -49,7 +55,11 @@ func v1GetFiles(_ *Command, req *http.Request, _ *userState) Response {
 		if req.Header.Get("Accept") != "multipart/form-data" {
 			return statusBadRequest(`must accept multipart/form-data`)
 		}
-		return readFilesResponse{paths: paths}
+		follow, err := parseFollow(query.Get("follow"))
+		if err != nil {
+			return statusBadRequest("%v", err)
+		}
+		return readFilesResponse{paths: paths, follow: follow}
 	case "list":
 		path := query.Get("path")
 		if path == "" {
@@ -60,22 +70,65 @@ func v1GetFiles(_ *Command, req *http.Request, _ *userState) Response {
 		if itself != "true" && itself != "false" && itself != "" {
 			return statusBadRequest(`itself parameter must be "true" or "false"`)
 		}
-		return listFilesResponse(path, pattern, itself == "true")
+		glob := query.Get("glob")
+		if glob != "true" && glob != "false" && glob != "" {
+			return statusBadRequest(`glob parameter must be "true" or "false"`)
+		}
+		follow, err := parseFollow(query.Get("follow"))
+		if err != nil {
+			return statusBadRequest("%v", err)
+		}
+		return listFilesResponse(path, pattern, itself == "true", glob == "true", follow)
+	case "checksum":
+		paths := query["path"]
+		if len(paths) == 0 {
+			return statusBadRequest("must specify one or more paths")
+		}
+		return checksumFiles(paths)
+	case "archive":
+		path := query.Get("path")
+		if path == "" {
+			return statusBadRequest("must specify path")
+		}
+		compression := query.Get("compression")
+		if compression != "" && compression != "gzip" {
+			return statusBadRequest(`compression parameter must be "gzip" if specified`)
+		}
+		follow, err := parseFollow(query.Get("follow"))
+		if err != nil {
+			return statusBadRequest("%v", err)
+		}
+		return archiveFilesResponse(path, compression == "gzip", follow)
 	default:
 		return statusBadRequest("invalid action %q", action)
 	}
 }
 
+// parseFollow parses the "follow" query parameter, which says whether a
+// symlink given as the path is followed (the default) or reported as such.
+func parseFollow(follow string) (bool, error) {
+	switch follow {
+	case "", "true":
+		return true, nil
+	case "false":
+		return false, nil
+	default:
+		return false, errors.New(`follow parameter must be "true" or "false"`)
+	}
+}
+
 type fileResult struct {
-	Path  string       `json:"path"`
-	Error *errorResult `json:"error,omitempty"`
+	Path       string       `json:"path"`
+	LinkTarget string       `json:"link-target,omitempty"`
+	Error      *errorResult `json:"error,omitempty"`
 }
 
 // Reading files
 
 // Custom Response implementation to serve the multipart.
 type readFilesResponse struct {
-	paths []string
+	paths  []string
+	follow bool
 }
 
 func (r readFilesResponse) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -89,10 +142,11 @@ func (r readFilesResponse) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// Read each file's contents to multipart response.
 	result := make([]fileResult, len(r.paths))
 	for i, path := range r.paths {
-		err := readFile(path, mw)
+		linkTarget, err := readFile(path, r.follow, mw)
 		result[i] = fileResult{
-			Path:  path,
-			Error: fileErrorToResult(err),
+			Path:       path,
+			LinkTarget: linkTarget,
+			Error:      fileErrorToResult(err),
 		}
 	}
 
@@ -132,32 +186,48 @@ func nonAbsolutePathError(path string) error {
 	return fmt.Errorf("paths must be absolute, got %q", path)
 }
 
-func readFile(path string, mw *multipart.Writer) error {
+// readFile writes the contents of the file at path to mw. If path is a
+// symlink, its target is returned, and the contents are only written if
+// follow is true.
+func readFile(path string, follow bool, mw *multipart.Writer) (linkTarget string, err error) {
 	if !pathpkg.IsAbs(path) {
-		return nonAbsolutePathError(path)
+		return "", nonAbsolutePathError(path)
 	}
-	info, err := os.Stat(path)
+	info, err := os.Lstat(path)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		linkTarget, err = os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		if !follow {
+			return linkTarget, nil
+		}
+		info, err = os.Stat(path)
+		if err != nil {
+			return linkTarget, err
+		}
 	}
 	if !info.Mode().IsRegular() {
-		return fmt.Errorf("can only read a regular file: %q", path)
+		return linkTarget, fmt.Errorf("can only read a regular file: %q", path)
 	}
 	f, err := os.Open(path)
 	if err != nil {
-		return err
+		return linkTarget, err
 	}
 	defer f.Close()
 
 	fw, err := mw.CreateFormFile("files", path)
 	if err != nil {
-		return err
+		return linkTarget, err
 	}
 	_, err = io.Copy(fw, f)
 	if err != nil {
-		return err
+		return linkTarget, err
 	}
-	return nil
+	return linkTarget, nil
 }
 
 func fileErrorToResult(err error) *errorResult {
@@ -179,6 +249,195 @@ func fileErrorToResult(err error) *errorResult {
 	}
 }
 
+// Checksumming files
+
+type checksumResult struct {
+	Path         string       `json:"path"`
+	SHA256       string       `json:"sha256,omitempty"`
+	Size         *int64       `json:"size,omitempty"`
+	LastModified string       `json:"last-modified,omitempty"`
+	LinkTarget   string       `json:"link-target,omitempty"`
+	Error        *errorResult `json:"error,omitempty"`
+}
+
+func checksumFiles(paths []string) Response {
+	result := make([]checksumResult, len(paths))
+	for i, path := range paths {
+		result[i] = checksumFile(path)
+	}
+	return SyncResponse(result)
+}
+
+// checksumFile returns the SHA256 checksum, size and modification time of
+// the regular file at path, following symlinks (whose target is reported).
+func checksumFile(path string) checksumResult {
+	result := checksumResult{Path: path}
+	if !pathpkg.IsAbs(path) {
+		result.Error = fileErrorToResult(nonAbsolutePathError(path))
+		return result
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		result.LinkTarget, _ = os.Readlink(path)
+	}
+
+	// Check the type first, as opening a named pipe would block.
+	info, err := os.Stat(path)
+	if err != nil {
+		result.Error = fileErrorToResult(err)
+		return result
+	}
+	if !info.Mode().IsRegular() {
+		result.Error = fileErrorToResult(fmt.Errorf("can only checksum a regular file: %q", path))
+		return result
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		result.Error = fileErrorToResult(err)
+		return result
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		result.Error = fileErrorToResult(err)
+		return result
+	}
+	result.SHA256 = hex.EncodeToString(h.Sum(nil))
+	result.Size = &size
+	result.LastModified = info.ModTime().Format(time.RFC3339)
+	return result
+}
+
+// Archiving files
+
+// archiveErrorTrailer is the HTTP trailer that reports an error that
+// happened after the archive response started, as the status has already
+// been sent by then.
+const archiveErrorTrailer = "Pebble-Archive-Error"
+
+// Custom Response implementation to stream the tar archive.
+type archiveResponse struct {
+	path string // path to archive, as given
+	root string // path to walk, with any symlink at path resolved
+	gzip bool
+}
+
+func archiveFilesResponse(path string, gzip, follow bool) Response {
+	if !pathpkg.IsAbs(path) {
+		return statusBadRequest("path must be absolute, got %q", path)
+	}
+	root := path
+	var err error
+	if follow {
+		root, err = filepath.EvalSymlinks(path)
+	} else {
+		_, err = os.Lstat(path)
+	}
+	if err != nil {
+		return &resp{
+			Type:   ResponseTypeError,
+			Result: fileErrorToResult(err),
+			Status: fileErrorToStatus(err),
+		}
+	}
+	return archiveResponse{path: path, root: root, gzip: gzip}
+}
+
+func (r archiveResponse) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	header := w.Header()
+	if r.gzip {
+		header.Set("Content-Type", "application/gzip")
+	} else {
+		header.Set("Content-Type", "application/x-tar")
+	}
+	header.Set("Trailer", archiveErrorTrailer)
+	w.WriteHeader(http.StatusOK)
+
+	err := r.write(w)
+	if err != nil {
+		// Leave the archive unterminated, and report the error in the
+		// trailer so that the client doesn't mistake it for a whole one.
+		logger.Noticef("Cannot archive %q: %v", r.path, err)
+		header.Set(archiveErrorTrailer, err.Error())
+	}
+}
+
+func (r archiveResponse) write(w io.Writer) error {
+	var gw *gzip.Writer
+	if r.gzip {
+		gw = gzip.NewWriter(w)
+		w = gw
+	}
+	tw := tar.NewWriter(w)
+
+	// Entries are named relative to the parent of the archived path, so the
+	// archive extracts to a directory with the same name.
+	base := pathpkg.Base(r.path)
+	if base == "/" {
+		base = "."
+	}
+	err := filepath.Walk(r.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(r.root, path)
+		if err != nil {
+			return err
+		}
+		return writeArchiveEntry(tw, path, pathpkg.Join(base, rel), info)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if gw != nil {
+		return gw.Close()
+	}
+	return nil
+}
+
+// writeArchiveEntry writes the file at path to tw as name. Symlinks are
+// written as such, and file types tar can't hold, such as sockets, are
+// skipped.
+func writeArchiveEntry(tw *tar.Writer, path, name string, info os.FileInfo) error {
+	var linkTarget string
+	switch mode := info.Mode(); {
+	case mode.IsRegular(), mode.IsDir():
+	case mode&os.ModeSymlink != 0:
+		var err error
+		linkTarget, err = os.Readlink(path)
+		if err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	hdr, err := tar.FileInfoHeader(info, linkTarget)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(tw, f, hdr.Size)
+	return err
+}
+
 // Listing files
 
 func fileErrorToStatus(err error) int {
@@ -199,6 +458,7 @@ type fileInfoResult struct {
 	Name         string   `json:"name"`
 	Type         fileType `json:"type"`
 	Size         *int64   `json:"size,omitempty"`
+	LinkTarget   string   `json:"link-target,omitempty"`
 	Permissions  string   `json:"permissions"`
 	LastModified string   `json:"last-modified"`
 	UserID       *int     `json:"user-id"`
@@ -253,6 +513,11 @@ func fileInfoToResult(fullPath string, info os.FileInfo, userCache, groupCache m
 		Permissions:  fmt.Sprintf("%03o", mode.Perm()),
 		LastModified: info.ModTime().Format(time.RFC3339),
 	}
+	if mode&os.ModeSymlink != 0 {
+		// Report the target even if it's dangling; an unreadable link just
+		// has no target in the result.
+		result.LinkTarget, _ = os.Readlink(fullPath)
+	}
 	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
 		uidInt := int(stat.Uid)
 		gidInt := int(stat.Gid)
@@ -281,11 +546,17 @@ func fileInfoToResult(fullPath string, info os.FileInfo, userCache, groupCache m
 	return result
 }
 
-func listFilesResponse(path, pattern string, itself bool) Response {
+func listFilesResponse(path, pattern string, itself, glob, follow bool) Response {
 	if !pathpkg.IsAbs(path) {
 		return statusBadRequest("path must be absolute, got %q", path)
 	}
-	result, err := listFiles(path, pattern, itself)
+	var result []fileInfoResult
+	var err error
+	if glob {
+		result, err = listGlob(path, pattern, itself, follow)
+	} else {
+		result, err = listFiles(path, pattern, itself, follow)
+	}
 	if err != nil {
 		return &resp{
 			Type:   ResponseTypeError,
@@ -296,8 +567,15 @@ func listFilesResponse(path, pattern string, itself bool) Response {
 	return SyncResponse(result)
 }
 
-func listFiles(path, pattern string, itself bool) ([]fileInfoResult, error) {
-	info, err := os.Stat(path)
+// listFiles lists the directory at path, or the file itself. If follow is
+// false, a symlink at path is reported as such instead of being followed.
+// Directory entries that are symlinks are never followed.
+func listFiles(path, pattern string, itself, follow bool) ([]fileInfoResult, error) {
+	stat := os.Stat
+	if !follow {
+		stat = os.Lstat
+	}
+	info, err := stat(path)
 	if err != nil {
 		return nil, err
 	}
@@ -337,6 +615,37 @@ func listFiles(path, pattern string, itself bool) ([]fileInfoResult, error) {
 	return result, nil
 }
 
+// listGlob expands the wildcards of path.Match in path, and lists each
+// match as listFiles does. A dangling symlink that matches is reported as
+// such, and an entry that was removed since it was matched is skipped. If
+// nothing matches, path is listed literally, as its name may contain the
+// wildcard characters.
+func listGlob(path, pattern string, itself, follow bool) ([]fileInfoResult, error) {
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %q: %w", path, err)
+	}
+	if len(matches) == 0 {
+		return listFiles(path, pattern, itself, follow)
+	}
+
+	result := make([]fileInfoResult, 0, len(matches))
+	for _, match := range matches {
+		infos, err := listFiles(match, pattern, itself, follow)
+		if errors.Is(err, os.ErrNotExist) && follow {
+			infos, err = listFiles(match, pattern, itself, false)
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, infos...)
+	}
+	return result, nil
+}
+
 func v1PostFiles(_ *Command, req *http.Request, _ *userState) Response {
 	contentType := req.Header.Get("Content-Type")
 	mediaType, params, err := mime.ParseMediaType(contentType)
@@ -353,9 +662,10 @@ func v1PostFiles(_ *Command, req *http.Request, _ *userState) Response {
 		return writeFiles(req.Body, boundary)
 	case "application/json":
 		var payload struct {
-			Action string            `json:"action"`
-			Dirs   []makeDirsItem    `json:"dirs"`
-			Paths  []removePathsItem `json:"paths"`
+			Action   string             `json:"action"`
+			Dirs     []makeDirsItem     `json:"dirs"`
+			Symlinks []makeSymlinksItem `json:"symlinks"`
+			Paths    []removePathsItem  `json:"paths"`
 		}
 		decoder := json.NewDecoder(req.Body)
 		if err := decoder.Decode(&payload); err != nil {
@@ -364,6 +674,8 @@ func v1PostFiles(_ *Command, req *http.Request, _ *userState) Response {
 		switch payload.Action {
 		case "make-dirs":
 			return makeDirs(payload.Dirs)
+		case "make-symlinks":
+			return makeSymlinks(payload.Symlinks)
 		case "remove":
 			return removePaths(payload.Paths)
 		case "write":
@@ -558,6 +870,47 @@ func makeDir(dir makeDirsItem) error {
 	return nil
 }
 
+// Creating symlinks
+
+type makeSymlinksItem struct {
+	Path        string `json:"path"`
+	Target      string `json:"target"`
+	MakeParents bool   `json:"make-parents"`
+}
+
+func makeSymlinks(symlinks []makeSymlinksItem) Response {
+	result := make([]fileResult, len(symlinks))
+	for i, symlink := range symlinks {
+		err := makeSymlink(symlink)
+		result[i] = fileResult{
+			Path:  symlink.Path,
+			Error: fileErrorToResult(err),
+		}
+		if err == nil {
+			result[i].LinkTarget = symlink.Target
+		}
+	}
+	return SyncResponse(result)
+}
+
+func makeSymlink(symlink makeSymlinksItem) error {
+	if !pathpkg.IsAbs(symlink.Path) {
+		return nonAbsolutePathError(symlink.Path)
+	}
+	if symlink.Target == "" {
+		return fmt.Errorf("must specify target for symlink %q", symlink.Path)
+	}
+	if symlink.MakeParents {
+		err := os.MkdirAll(pathpkg.Dir(symlink.Path), 0o755)
+		if err != nil {
+			return fmt.Errorf("cannot create directory: %w", err)
+		}
+	}
+	// The target may be relative (to the symlink's directory), and needn't
+	// exist yet.
+	return os.Symlink(symlink.Target, symlink.Path)
+}
+
 // Because it's hard to test os.Chown without running the tests as root.
 var (
 	chown            = os.Chown
@@ -584,6 +937,8 @@ func removePaths(paths []removePathsItem) Response {
 	return SyncResponse(result)
 }
 
+// removePath removes the file or directory at path. A symlink is removed
+// itself, and a recursive removal never follows the symlinks it finds.
 func removePath(path string, recursive bool) error {
 	if !pathpkg.IsAbs(path) {
 		return nonAbsolutePathError(path)
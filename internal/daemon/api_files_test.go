@@ -15,7 +15,9 @@
 package daemon
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -176,6 +178,355 @@ func (s *filesSuite) TestListFilesNoResults(c *C) {
 	c.Assert(r.Result, HasLen, 0) // should be empty slice, not nil
 }
 
+func (s *filesSuite) TestListFilesGlob(c *C) {
+	tmpDir := createTestFiles(c)
+	writeTempFile(c, tmpDir+"/sub", "three.txt", "dee", 0o644)
+	c.Assert(os.Symlink("nonexistent.txt", tmpDir+"/dangling.txt"), IsNil)
+
+	query := url.Values{
+		"action": []string{"list"},
+		"path":   []string{tmpDir + "/*.txt"},
+		"glob":   []string{"true"},
+	}
+	response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	r := decodeResp(c, body, http.StatusOK, ResponseTypeSync)
+	c.Assert(r.Result, HasLen, 3)
+	assertListResult(c, r.Result, 0, "symlink", tmpDir, "dangling.txt", "777", -1)
+	assertListResult(c, r.Result, 1, "file", tmpDir, "one.txt", "600", 2)
+	assertListResult(c, r.Result, 2, "file", tmpDir, "two.txt", "755", 3)
+
+	// Wildcards can be in any component, and the matches are filtered by
+	// pattern.
+	query = url.Values{
+		"action":  []string{"list"},
+		"path":    []string{tmpDir + "/s?b/*"},
+		"pattern": []string{"t*"},
+		"glob":    []string{"true"},
+	}
+	response, body = doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	r = decodeResp(c, body, http.StatusOK, ResponseTypeSync)
+	c.Assert(r.Result, HasLen, 1)
+	assertListResult(c, r.Result, 0, "file", tmpDir+"/sub", "three.txt", "644", 3)
+
+	// Matching directories are listed, unless itself is set.
+	query = url.Values{
+		"action": []string{"list"},
+		"path":   []string{tmpDir + "/[st]*"},
+		"glob":   []string{"true"},
+	}
+	response, body = doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	r = decodeResp(c, body, http.StatusOK, ResponseTypeSync)
+	c.Assert(r.Result, HasLen, 2)
+	assertListResult(c, r.Result, 0, "file", tmpDir+"/sub", "three.txt", "644", 3)
+	assertListResult(c, r.Result, 1, "file", tmpDir, "two.txt", "755", 3)
+
+	query.Set("itself", "true")
+	response, body = doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	r = decodeResp(c, body, http.StatusOK, ResponseTypeSync)
+	c.Assert(r.Result, HasLen, 2)
+	assertListResult(c, r.Result, 0, "directory", tmpDir, "sub", "755", -1)
+	assertListResult(c, r.Result, 1, "file", tmpDir, "two.txt", "755", 3)
+}
+
+func (s *filesSuite) TestListFilesLiteralWildcards(c *C) {
+	tmpDir := createTestFiles(c)
+	writeTempFile(c, tmpDir, "[st]*", "literal", 0o644)
+
+	// Without glob, wildcards in path are taken literally.
+	query := url.Values{
+		"action": []string{"list"},
+		"path":   []string{tmpDir + "/[st]*"},
+	}
+	response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	r := decodeResp(c, body, http.StatusOK, ResponseTypeSync)
+	c.Assert(r.Result, HasLen, 1)
+	assertListResult(c, r.Result, 0, "file", tmpDir, "[st]*", "644", 7)
+
+	// With glob, a path that matches nothing is taken literally.
+	query.Set("path", tmpDir+"/[x]")
+	writeTempFile(c, tmpDir, "[x]", "literal", 0o644)
+	query.Set("glob", "true")
+	response, body = doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	r = decodeResp(c, body, http.StatusOK, ResponseTypeSync)
+	c.Assert(r.Result, HasLen, 1)
+	assertListResult(c, r.Result, 0, "file", tmpDir, "[x]", "644", 7)
+}
+
+func (s *filesSuite) TestListFilesGlobInvalid(c *C) {
+	query := url.Values{
+		"action": []string{"list"},
+		"path":   []string{"/tmp/[abc"},
+		"glob":   []string{"true"},
+	}
+	response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusBadRequest)
+	assertError(c, body, http.StatusBadRequest, "generic-file-error", `invalid glob pattern "/tmp/\[abc": syntax error in pattern`)
+
+	query.Set("glob", "yes")
+	response, body = doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusBadRequest)
+	assertError(c, body, http.StatusBadRequest, "", `glob parameter must be "true" or "false"`)
+}
+
+func (s *filesSuite) TestListFilesSymlinkEntries(c *C) {
+	tmpDir := createTestFiles(c)
+	c.Assert(os.Symlink("one.txt", tmpDir+"/link"), IsNil)
+	c.Assert(os.Symlink("/nonexistent", tmpDir+"/dangling"), IsNil)
+
+	query := url.Values{
+		"action": []string{"list"},
+		"path":   []string{tmpDir},
+	}
+	response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	r := decodeResp(c, body, http.StatusOK, ResponseTypeSync)
+	results := r.Result.([]interface{})
+	c.Assert(results, HasLen, 6)
+	assertListResult(c, r.Result, 0, "symlink", tmpDir, "dangling", "777", -1)
+	c.Check(results[0].(map[string]interface{})["link-target"], Equals, "/nonexistent")
+	assertListResult(c, r.Result, 2, "symlink", tmpDir, "link", "777", -1)
+	c.Check(results[2].(map[string]interface{})["link-target"], Equals, "one.txt")
+	_, ok := results[1].(map[string]interface{})["link-target"]
+	c.Check(ok, Equals, false)
+}
+
+func (s *filesSuite) TestListFilesFollow(c *C) {
+	tmpDir := createTestFiles(c)
+	linkDir := c.MkDir()
+	c.Assert(os.Symlink(tmpDir+"/sub", linkDir+"/sublink"), IsNil)
+	writeTempFile(c, tmpDir+"/sub", "bar", "dee", 0o644)
+
+	// By default, a symlink given as the path is followed.
+	for _, follow := range []string{"", "true"} {
+		query := url.Values{
+			"action": []string{"list"},
+			"path":   []string{linkDir + "/sublink"},
+			"follow": []string{follow},
+		}
+		response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+		c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+		r := decodeResp(c, body, http.StatusOK, ResponseTypeSync)
+		c.Assert(r.Result, HasLen, 1)
+		assertListResult(c, r.Result, 0, "file", linkDir+"/sublink", "bar", "644", 3)
+	}
+
+	query := url.Values{
+		"action": []string{"list"},
+		"path":   []string{linkDir + "/sublink"},
+		"follow": []string{"false"},
+	}
+	response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	r := decodeResp(c, body, http.StatusOK, ResponseTypeSync)
+	c.Assert(r.Result, HasLen, 1)
+	assertListResult(c, r.Result, 0, "symlink", linkDir, "sublink", "777", -1)
+	c.Check(r.Result.([]interface{})[0].(map[string]interface{})["link-target"], Equals, tmpDir+"/sub")
+}
+
+func (s *filesSuite) TestListFilesInvalidFollow(c *C) {
+	query := url.Values{
+		"action": []string{"list"},
+		"path":   []string{"/tmp"},
+		"follow": []string{"yes"},
+	}
+	response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusBadRequest)
+	assertError(c, body, http.StatusBadRequest, "", `follow parameter must be "true" or "false"`)
+}
+
+func (s *filesSuite) TestChecksumNoPaths(c *C) {
+	query := url.Values{"action": []string{"checksum"}}
+	response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusBadRequest)
+	assertError(c, body, http.StatusBadRequest, "", "must specify one or more paths")
+}
+
+func (s *filesSuite) TestChecksum(c *C) {
+	tmpDir := createTestFiles(c)
+	c.Assert(os.Symlink("one.txt", tmpDir+"/link"), IsNil)
+	mtime := time.Date(2021, 4, 10, 12, 5, 6, 0, time.UTC)
+	c.Assert(os.Chtimes(tmpDir+"/one.txt", mtime, mtime), IsNil)
+
+	query := url.Values{
+		"action": []string{"checksum"},
+		"path":   []string{tmpDir + "/one.txt", tmpDir + "/link", tmpDir + "/sub", tmpDir + "/missing", "rel"},
+	}
+	response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+
+	var r struct {
+		Result []struct {
+			Path         string
+			SHA256       string
+			Size         *int64
+			LastModified string `json:"last-modified"`
+			LinkTarget   string `json:"link-target"`
+			Error        struct {
+				Kind    string
+				Message string
+			}
+		}
+	}
+	c.Assert(json.NewDecoder(body).Decode(&r), IsNil)
+	c.Assert(r.Result, HasLen, 5)
+
+	const sum = "46599c5bb5c33101f80cea8438e2228085513dbbb19b2f5ce97bd68494d3344d" // "be"
+	one := r.Result[0]
+	c.Check(one.Path, Equals, tmpDir+"/one.txt")
+	c.Check(one.SHA256, Equals, sum)
+	c.Assert(one.Size, NotNil)
+	c.Check(*one.Size, Equals, int64(2))
+	c.Check(one.LastModified, Equals, mtime.Local().Format(time.RFC3339))
+	c.Check(one.Error.Kind, Equals, "")
+
+	link := r.Result[1]
+	c.Check(link.Path, Equals, tmpDir+"/link")
+	c.Check(link.SHA256, Equals, sum)
+	c.Check(link.LinkTarget, Equals, "one.txt")
+
+	c.Check(r.Result[2].SHA256, Equals, "")
+	c.Check(r.Result[2].Error.Kind, Equals, "generic-file-error")
+	c.Check(r.Result[2].Error.Message, Matches, "can only checksum a regular file: .*")
+	c.Check(r.Result[3].Error.Kind, Equals, "not-found")
+	c.Check(r.Result[4].Error.Message, Matches, "paths must be absolute, got .*")
+}
+
+func (s *filesSuite) TestArchive(c *C) {
+	tmpDir := createTestFiles(c)
+	writeTempFile(c, tmpDir+"/sub", "bar", "dee", 0o640)
+	c.Assert(os.Symlink("../foo", tmpDir+"/sub/link"), IsNil)
+	c.Assert(syscall.Mkfifo(tmpDir+"/sub/fifo", 0o600), IsNil)
+	c.Assert(os.Chmod(tmpDir, 0o755), IsNil)
+
+	for _, compression := range []string{"", "gzip"} {
+		query := url.Values{
+			"action":      []string{"archive"},
+			"path":        []string{tmpDir},
+			"compression": []string{compression},
+		}
+		response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+		c.Assert(response.StatusCode, Equals, http.StatusOK)
+		c.Check(response.Trailer.Get("Pebble-Archive-Error"), Equals, "")
+
+		var r io.Reader = body
+		if compression == "gzip" {
+			c.Check(response.Header.Get("Content-Type"), Equals, "application/gzip")
+			gr, err := gzip.NewReader(body)
+			c.Assert(err, IsNil)
+			r = gr
+		} else {
+			c.Check(response.Header.Get("Content-Type"), Equals, "application/x-tar")
+		}
+
+		base := filepath.Base(tmpDir)
+		c.Check(readTar(c, r), DeepEquals, []string{
+			base + "/ 755",
+			base + "/foo 644 a",
+			base + "/one.txt 600 be",
+			base + "/sub/ 755",
+			base + "/sub/bar 640 dee",
+			base + "/sub/link 777 -> ../foo",
+			base + "/two.txt 755 cee",
+		})
+	}
+}
+
+func (s *filesSuite) TestArchiveFollow(c *C) {
+	tmpDir := createTestFiles(c)
+	linkDir := c.MkDir()
+	c.Assert(os.Symlink(tmpDir+"/sub", linkDir+"/sublink"), IsNil)
+	writeTempFile(c, tmpDir+"/sub", "bar", "dee", 0o644)
+
+	query := url.Values{
+		"action": []string{"archive"},
+		"path":   []string{linkDir + "/sublink"},
+	}
+	response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+	c.Check(readTar(c, body), DeepEquals, []string{
+		"sublink/ 755",
+		"sublink/bar 644 dee",
+	})
+
+	query.Set("follow", "false")
+	response, body = doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
+	c.Assert(response.StatusCode, Equals, http.StatusOK)
+	c.Check(readTar(c, body), DeepEquals, []string{
+		"sublink 777 -> " + tmpDir + "/sub",
+	})
+}
+
+func (s *filesSuite) TestArchiveErrors(c *C) {
+	tmpDir := c.MkDir()
+	for _, test := range []struct {
+		query   url.Values
+		status  int
+		kind    string
+		message string
+	}{{
+		query:   url.Values{"action": {"archive"}},
+		status:  http.StatusBadRequest,
+		message: "must specify path",
+	}, {
+		query:   url.Values{"action": {"archive"}, "path": {"rel"}},
+		status:  http.StatusBadRequest,
+		message: "path must be absolute, got .*",
+	}, {
+		query:   url.Values{"action": {"archive"}, "path": {tmpDir}, "compression": {"xz"}},
+		status:  http.StatusBadRequest,
+		message: `compression parameter must be "gzip" if specified`,
+	}, {
+		query:   url.Values{"action": {"archive"}, "path": {tmpDir + "/missing"}},
+		status:  http.StatusNotFound,
+		kind:    "not-found",
+		message: ".*: no such file or directory",
+	}} {
+		response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", test.query, nil, nil)
+		c.Check(response.StatusCode, Equals, test.status)
+		assertError(c, body, test.status, test.kind, test.message)
+	}
+}
+
+// readTar returns a summary of each entry in the tar archive read from r:
+// its name and permissions, then the link target or content, if any.
+func readTar(c *C, r io.Reader) []string {
+	var entries []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		entry := fmt.Sprintf("%s %03o", hdr.Name, hdr.Mode&0o777)
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			entry += " -> " + hdr.Linkname
+		case tar.TypeReg:
+			data, err := ioutil.ReadAll(tr)
+			c.Assert(err, IsNil)
+			entry += " " + string(data)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
 func (s *filesSuite) TestReadNoPaths(c *C) {
 	query := url.Values{"action": []string{"read"}}
 	response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, nil, nil)
@@ -191,8 +542,9 @@ func (s *filesSuite) TestReadNoMultipartHeader(c *C) {
 }
 
 type testFileResult struct {
-	Path  string
-	Error struct {
+	Path       string
+	LinkTarget string `json:"link-target"`
+	Error      struct {
 		Kind    string
 		Message string
 	}
@@ -300,6 +652,48 @@ func (s *filesSuite) TestReadMultiple(c *C) {
 	})
 }
 
+func (s *filesSuite) TestReadSymlink(c *C) {
+	tmpDir := createTestFiles(c)
+	c.Assert(os.Symlink("one.txt", tmpDir+"/link"), IsNil)
+	c.Assert(os.Symlink("nonexistent", tmpDir+"/dangling"), IsNil)
+	headers := http.Header{
+		"Accept": []string{"multipart/form-data"},
+	}
+
+	// By default, symlinks are followed and their target is reported.
+	query := url.Values{
+		"action": []string{"read"},
+		"path":   []string{tmpDir + "/link", tmpDir + "/dangling"},
+	}
+	response, body := doRequest(c, v1GetFiles, "GET", "/v1/files", query, headers, nil)
+	c.Check(response.StatusCode, Equals, http.StatusOK)
+
+	var r testFilesResponse
+	files := readMultipart(c, response, body, &r)
+	c.Assert(r.Result, HasLen, 2)
+	checkFileResult(c, r.Result[0], tmpDir+"/link", "", "")
+	c.Check(r.Result[0].LinkTarget, Equals, "one.txt")
+	checkFileResult(c, r.Result[1], tmpDir+"/dangling", "not-found", ".*: no such file or directory")
+	c.Check(r.Result[1].LinkTarget, Equals, "nonexistent")
+	c.Check(files, DeepEquals, map[string]string{
+		tmpDir + "/link": "be",
+	})
+
+	// With follow=false, symlinks are reported without their content.
+	query["follow"] = []string{"false"}
+	response, body = doRequest(c, v1GetFiles, "GET", "/v1/files", query, headers, nil)
+	c.Check(response.StatusCode, Equals, http.StatusOK)
+
+	r = testFilesResponse{}
+	files = readMultipart(c, response, body, &r)
+	c.Assert(r.Result, HasLen, 2)
+	checkFileResult(c, r.Result[0], tmpDir+"/link", "", "")
+	c.Check(r.Result[0].LinkTarget, Equals, "one.txt")
+	checkFileResult(c, r.Result[1], tmpDir+"/dangling", "", "")
+	c.Check(r.Result[1].LinkTarget, Equals, "nonexistent")
+	c.Check(files, HasLen, 0)
+}
+
 func (s *filesSuite) TestReadErrors(c *C) {
 	tmpDir := createTestFiles(c)
 	writeTempFile(c, tmpDir, "no-access", "x", 0)
@@ -505,6 +899,52 @@ func (s *filesSuite) TestMakeDirsUserGroupMocked(c *C) {
 	c.Check(osutil.IsDir(tmpDir+"/user-group"), Equals, true)
 }
 
+func (s *filesSuite) TestMakeSymlinks(c *C) {
+	tmpDir := c.MkDir()
+	writeTempFile(c, tmpDir, "file", "a", 0o644)
+
+	headers := http.Header{
+		"Content-Type": []string{"application/json"},
+	}
+	payload := struct {
+		Action   string
+		Symlinks []makeSymlinksItem
+	}{
+		Action: "make-symlinks",
+		Symlinks: []makeSymlinksItem{
+			{Path: tmpDir + "/relative", Target: "file"},
+			{Path: tmpDir + "/a/b/absolute", Target: tmpDir + "/file", MakeParents: true},
+			{Path: tmpDir + "/c/no-parents", Target: "file"},
+			{Path: tmpDir + "/file", Target: "other"},
+			{Path: tmpDir + "/no-target"},
+			{Path: "rel/path", Target: "file"},
+		},
+	}
+	reqBody, err := json.Marshal(payload)
+	c.Assert(err, IsNil)
+	response, body := doRequest(c, v1PostFiles, "POST", "/v1/files", nil, headers, reqBody)
+	c.Check(response.StatusCode, Equals, http.StatusOK)
+
+	var r testFilesResponse
+	c.Assert(json.NewDecoder(body).Decode(&r), IsNil)
+	c.Check(r.StatusCode, Equals, http.StatusOK)
+	c.Check(r.Type, Equals, "sync")
+	c.Assert(r.Result, HasLen, 6)
+	checkFileResult(c, r.Result[0], tmpDir+"/relative", "", "")
+	c.Check(r.Result[0].LinkTarget, Equals, "file")
+	checkFileResult(c, r.Result[1], tmpDir+"/a/b/absolute", "", "")
+	c.Check(r.Result[1].LinkTarget, Equals, tmpDir+"/file")
+	checkFileResult(c, r.Result[2], tmpDir+"/c/no-parents", "not-found", ".*: no such file or directory")
+	checkFileResult(c, r.Result[3], tmpDir+"/file", "generic-file-error", ".*: file exists")
+	checkFileResult(c, r.Result[4], tmpDir+"/no-target", "generic-file-error", "must specify target for symlink .*")
+	checkFileResult(c, r.Result[5], "rel/path", "generic-file-error", "paths must be absolute, got .*")
+
+	target, err := os.Readlink(tmpDir + "/relative")
+	c.Assert(err, IsNil)
+	c.Check(target, Equals, "file")
+	assertFile(c, tmpDir+"/a/b/absolute", 0o644, "a")
+}
+
 func (s *filesSuite) TestRemoveSingle(c *C) {
 	tmpDir := c.MkDir()
 	writeTempFile(c, tmpDir, "file", "a", 0o644)
@@ -581,6 +1021,44 @@ func (s *filesSuite) TestRemoveMultiple(c *C) {
 	c.Check(osutil.IsDir(tmpDir+"/recursive"), Equals, false)
 }
 
+func (s *filesSuite) TestRemoveSymlinkRecursive(c *C) {
+	tmpDir := c.MkDir()
+	c.Assert(os.Mkdir(tmpDir+"/target", 0o755), IsNil)
+	writeTempFile(c, tmpDir, "target/file", "a", 0o644)
+	c.Assert(os.Mkdir(tmpDir+"/dir", 0o755), IsNil)
+	c.Assert(os.Symlink(tmpDir+"/target", tmpDir+"/dir/link"), IsNil)
+	c.Assert(os.Symlink(tmpDir+"/target", tmpDir+"/toplink"), IsNil)
+
+	headers := http.Header{
+		"Content-Type": []string{"application/json"},
+	}
+	payload := struct {
+		Action string
+		Paths  []removePathsItem
+	}{
+		Action: "remove",
+		Paths: []removePathsItem{
+			{Path: tmpDir + "/dir", Recursive: true},
+			{Path: tmpDir + "/toplink", Recursive: true},
+		},
+	}
+	reqBody, err := json.Marshal(payload)
+	c.Assert(err, IsNil)
+	response, body := doRequest(c, v1PostFiles, "POST", "/v1/files", nil, headers, reqBody)
+	c.Check(response.StatusCode, Equals, http.StatusOK)
+
+	var r testFilesResponse
+	c.Assert(json.NewDecoder(body).Decode(&r), IsNil)
+	c.Assert(r.Result, HasLen, 2)
+	checkFileResult(c, r.Result[0], tmpDir+"/dir", "", "")
+	checkFileResult(c, r.Result[1], tmpDir+"/toplink", "", "")
+
+	// The symlinks are removed, but not what they point to.
+	c.Check(osutil.CanStat(tmpDir+"/dir"), Equals, false)
+	c.Check(osutil.CanStat(tmpDir+"/toplink"), Equals, false)
+	assertFile(c, tmpDir+"/target/file", 0o644, "a")
+}
+
 func (s *filesSuite) TestWriteNoMetadata(c *C) {
 	headers := http.Header{
 		"Content-Type": []string{"multipart/form-data; boundary=01234567890123456789012345678901"},
@@ -0,0 +1,109 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/canonical/pebble/internal/overlord/checkstate"
+	"github.com/canonical/pebble/internal/overlord/servstate"
+	"github.com/canonical/pebble/internal/plan"
+	"github.com/canonical/pebble/internal/strutil"
+)
+
+type healthInfo struct {
+	Healthy bool `json:"healthy"`
+}
+
+// v1Health reports whether the daemon and its services are healthy: that
+// is, the daemon isn't in degraded mode and no service is failing (in
+// backoff or error state). If a check level or names are given, it instead
+// reports whether those health checks are all up. It responds with status
+// 502 if unhealthy, so that it can be used directly as an HTTP health probe.
+func v1Health(c *Command, r *http.Request, _ *userState) Response {
+	query := r.URL.Query()
+	level := plan.CheckLevel(query.Get("level"))
+	switch level {
+	case plan.UnsetLevel, plan.AliveLevel, plan.ReadyLevel:
+	default:
+		return statusBadRequest(`level must be "alive" or "ready"`)
+	}
+	names := strutil.CommaSeparatedList(query.Get("names"))
+
+	healthy := c.d.degradedErr == nil
+	if level != plan.UnsetLevel || len(names) > 0 {
+		checks := overlordCheckManager(c.d.overlord).Checks()
+		var err error
+		healthy, err = checksHealthy(checks, level, names)
+		if err != nil {
+			return statusNotFound("%v", err)
+		}
+	} else if healthy {
+		services, err := c.d.overlord.ServiceManager().Services(nil)
+		if err != nil {
+			return statusInternalError("%v", err)
+		}
+		for _, service := range services {
+			if service.Current == servstate.StatusBackoff || service.Current == servstate.StatusError {
+				healthy = false
+				break
+			}
+		}
+	}
+
+	status := http.StatusOK
+	if !healthy {
+		status = http.StatusBadGateway
+	}
+	return &resp{
+		Type:   ResponseTypeSync,
+		Status: status,
+		Result: healthInfo{Healthy: healthy},
+	}
+}
+
+// checksHealthy reports whether all the checks with the given names (or all
+// checks, if names is empty) at the given level are up. As a service isn't
+// ready if it isn't alive, the "ready" level includes "alive" checks.
+func checksHealthy(checks []*checkstate.CheckInfo, level plan.CheckLevel, names []string) (bool, error) {
+	found := make(map[string]bool)
+	healthy := true
+	for _, check := range checks {
+		if len(names) > 0 && !strutil.ListContains(names, check.Name) {
+			continue
+		}
+		found[check.Name] = true
+		switch level {
+		case plan.AliveLevel:
+			if check.Level != plan.AliveLevel {
+				continue
+			}
+		case plan.ReadyLevel:
+			if check.Level != plan.AliveLevel && check.Level != plan.ReadyLevel {
+				continue
+			}
+		}
+		if check.Status != checkstate.CheckStatusUp {
+			healthy = false
+		}
+	}
+	for _, name := range names {
+		if !found[name] {
+			return false, fmt.Errorf("cannot find check %q", name)
+		}
+	}
+	return healthy, nil
+}
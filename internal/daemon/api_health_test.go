@@ -0,0 +1,96 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *apiSuite) TestHealthChecks(c *C) {
+	writeTestLayer(s.pebbleDir, `
+checks:
+    chk-alive:
+        override: replace
+        level: alive
+        period: 20ms
+        timeout: 10ms
+        threshold: 1
+        exec:
+            command: "true"
+    chk-ready:
+        override: replace
+        level: ready
+        period: 20ms
+        timeout: 10ms
+        threshold: 1
+        exec:
+            command: "false"
+    chk-other:
+        override: replace
+        period: 20ms
+        timeout: 10ms
+        threshold: 1
+        exec:
+            command: "true"
+`)
+	d := s.daemon(c)
+	checkMgr := d.overlord.CheckManager()
+	defer checkMgr.Stop()
+
+	// Wait for the failing check to be down.
+	for i := 0; ; i++ {
+		if i > 100 {
+			c.Fatalf("timed out waiting for checks to run")
+		}
+		checks := checkMgr.Checks()
+		if len(checks) == 3 && checks[2].Name == "chk-ready" && checks[2].Status == "down" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	healthCmd := apiCmd("/v1/health")
+	for _, test := range []struct {
+		query   string
+		status  int
+		healthy bool
+	}{
+		{"level=alive", 200, true},
+		{"level=ready", 502, false},
+		{"names=chk-alive,chk-other", 200, true},
+		{"names=chk-alive,chk-ready", 502, false},
+		{"level=alive&names=chk-ready", 200, true},
+	} {
+		req, err := http.NewRequest("GET", "/v1/health?"+test.query, nil)
+		c.Assert(err, IsNil)
+		rsp := healthCmd.GET(healthCmd, req, nil).(*resp)
+		c.Check(rsp.Status, Equals, test.status, Commentf("%s", test.query))
+		c.Check(rsp.Result, DeepEquals, healthInfo{Healthy: test.healthy}, Commentf("%s", test.query))
+	}
+
+	req, err := http.NewRequest("GET", "/v1/health?names=chk-alive,chk-missing", nil)
+	c.Assert(err, IsNil)
+	rsp := healthCmd.GET(healthCmd, req, nil).(*resp)
+	c.Check(rsp.Status, Equals, 404)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, `cannot find check "chk-missing"`)
+
+	req, err = http.NewRequest("GET", "/v1/health?level=dead", nil)
+	c.Assert(err, IsNil)
+	rsp = healthCmd.GET(healthCmd, req, nil).(*resp)
+	c.Check(rsp.Status, Equals, 400)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/canonical/pebble/internal/overlord/checkstate"
+)
+
+// metricsContentType is the content type of the Prometheus text format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metricsResponse is a Response that writes metrics in the Prometheus text
+// exposition format.
+type metricsResponse []byte
+
+func (r metricsResponse) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", metricsContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(r)
+}
+
+// v1GetMetrics reports the status of each health check as Prometheus
+// metrics, so that alerting rules can be built on Pebble's checks.
+func v1GetMetrics(c *Command, r *http.Request, _ *userState) Response {
+	checks := overlordCheckManager(c.d.overlord).Checks()
+
+	var buf bytes.Buffer
+	writeCheckMetric(&buf, checks, "pebble_check_up", "gauge",
+		"Whether the health check is up (1) or down (0).",
+		func(check *checkstate.CheckInfo) string {
+			if check.Status == checkstate.CheckStatusUp {
+				return "1"
+			}
+			return "0"
+		})
+	writeCheckMetric(&buf, checks, "pebble_check_failures", "gauge",
+		"Number of consecutive failures of the health check.",
+		func(check *checkstate.CheckInfo) string {
+			return fmt.Sprint(check.Failures)
+		})
+	writeCheckMetric(&buf, checks, "pebble_check_duration_seconds", "gauge",
+		"Duration of the most recent run of the health check, in seconds.",
+		func(check *checkstate.CheckInfo) string {
+			return fmt.Sprint(check.Duration.Seconds())
+		})
+	return metricsResponse(buf.Bytes())
+}
+
+// writeCheckMetric writes a metric family with one sample per check,
+// labelled with the check name and level.
+func writeCheckMetric(buf *bytes.Buffer, checks []*checkstate.CheckInfo, name, kind, help string, value func(*checkstate.CheckInfo) string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, kind)
+	for _, check := range checks {
+		fmt.Fprintf(buf, "%s{check=\"%s\",level=\"%s\"} %s\n",
+			name, escapeLabelValue(check.Name), escapeLabelValue(string(check.Level)), value(check))
+	}
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue escapes a metric label value as required by the
+// Prometheus text format.
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
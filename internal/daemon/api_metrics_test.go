@@ -0,0 +1,85 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *apiSuite) TestMetrics(c *C) {
+	writeTestLayer(s.pebbleDir, `
+checks:
+    chk-up:
+        override: replace
+        level: ready
+        period: 20ms
+        timeout: 10ms
+        threshold: 1
+        exec:
+            command: "true"
+    chk-down:
+        override: replace
+        period: 20ms
+        timeout: 10ms
+        threshold: 1
+        exec:
+            command: "false"
+`)
+	d := s.daemon(c)
+	checkMgr := d.overlord.CheckManager()
+	defer checkMgr.Stop()
+
+	// Wait for both checks to have run.
+	for i := 0; ; i++ {
+		if i > 100 {
+			c.Fatalf("timed out waiting for checks to run")
+		}
+		checks := checkMgr.Checks()
+		if len(checks) == 2 && checks[0].Duration > 0 && checks[1].Duration > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	metricsCmd := apiCmd("/v1/metrics")
+	req, err := http.NewRequest("GET", "/v1/metrics", nil)
+	c.Assert(err, IsNil)
+	rec := httptest.NewRecorder()
+	metricsCmd.GET(metricsCmd, req, nil).ServeHTTP(rec, req)
+	c.Check(rec.Code, Equals, 200)
+	c.Check(rec.Header().Get("Content-Type"), Equals, "text/plain; version=0.0.4; charset=utf-8")
+	c.Check(rec.Body.String(), Matches, `
+# HELP pebble_check_up Whether the health check is up \(1\) or down \(0\).
+# TYPE pebble_check_up gauge
+pebble_check_up{check="chk-down",level=""} 0
+pebble_check_up{check="chk-up",level="ready"} 1
+# HELP pebble_check_failures Number of consecutive failures of the health check.
+# TYPE pebble_check_failures gauge
+pebble_check_failures{check="chk-down",level=""} [1-9][0-9]*
+pebble_check_failures{check="chk-up",level="ready"} 0
+# HELP pebble_check_duration_seconds Duration of the most recent run of the health check, in seconds.
+# TYPE pebble_check_duration_seconds gauge
+pebble_check_duration_seconds{check="chk-down",level=""} [0-9.e-]+
+pebble_check_duration_seconds{check="chk-up",level="ready"} [0-9.e-]+
+`[1:])
+}
+
+func (s *apiSuite) TestEscapeLabelValue(c *C) {
+	c.Check(escapeLabelValue(`a "b"\c`+"\nd"), Equals, `a \"b\"\\c\nd`)
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/canonical/pebble/internal/overlord/state"
+)
+
+const (
+	maxNoticeKeyLength = 256
+	maxNoticeDataSize  = 4 * 1024
+
+	// maxCustomNotices limits how many distinct custom notices can exist,
+	// as they can be added by anyone with access to the untrusted socket.
+	maxCustomNotices = 1000
+)
+
+// customNoticeKeyRegexp matches keys of custom notices, which must be in
+// the form "domain.com/key", to avoid clashes between different clients.
+var customNoticeKeyRegexp = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*(\.[a-z0-9]+(-[a-z0-9]+)*)+(/[a-z0-9]+(-[a-z0-9]+)*)+$`)
+
+func v1GetNotices(c *Command, r *http.Request, _ *userState) Response {
+	query := r.URL.Query()
+
+	var filter state.NoticeFilter
+	for _, typesStr := range query["types"] {
+		for _, t := range strings.Split(typesStr, ",") {
+			switch state.NoticeType(t) {
+			case state.CustomNotice, state.StartLimitNotice:
+			default:
+				return statusBadRequest("invalid notice type %q", t)
+			}
+			filter.Types = append(filter.Types, state.NoticeType(t))
+		}
+	}
+	for _, keysStr := range query["keys"] {
+		filter.Keys = append(filter.Keys, strings.Split(keysStr, ",")...)
+	}
+	if after := query.Get("after"); after != "" {
+		var err error
+		filter.After, err = time.Parse(time.RFC3339Nano, after)
+		if err != nil {
+			return statusBadRequest("invalid after parameter: %q", after)
+		}
+	}
+	var timeout time.Duration
+	if timeoutStr := query.Get("timeout"); timeoutStr != "" {
+		var err error
+		timeout, err = time.ParseDuration(timeoutStr)
+		if err != nil || timeout < 0 {
+			return statusBadRequest("invalid timeout parameter: %q", timeoutStr)
+		}
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	var notices []*state.Notice
+	if timeout > 0 {
+		// Wait until there are matching notices, returning an empty list
+		// if there are none before the timeout.
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		var err error
+		notices, err = st.WaitNotices(ctx, &filter)
+		if errors.Is(err, context.Canceled) {
+			return statusInternalError("request cancelled")
+		}
+	} else {
+		notices = st.Notices(&filter)
+	}
+	if notices == nil {
+		notices = []*state.Notice{}
+	}
+	return SyncResponse(notices)
+}
+
+type noticesPayload struct {
+	Action      string            `json:"action"`
+	Type        string            `json:"type"`
+	Key         string            `json:"key"`
+	RepeatAfter string            `json:"repeat-after"`
+	Data        map[string]string `json:"data"`
+}
+
+func v1PostNotices(c *Command, r *http.Request, _ *userState) Response {
+	var payload noticesPayload
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&payload); err != nil {
+		return statusBadRequest("cannot decode request body: %v", err)
+	}
+
+	if payload.Action != "add" {
+		return statusBadRequest("invalid action %q", payload.Action)
+	}
+	if payload.Type != string(state.CustomNotice) {
+		return statusBadRequest(`invalid type %q (can only add "custom" notices)`, payload.Type)
+	}
+	if len(payload.Key) > maxNoticeKeyLength {
+		return statusBadRequest("key must be %d bytes or less", maxNoticeKeyLength)
+	}
+	if !customNoticeKeyRegexp.MatchString(payload.Key) {
+		return statusBadRequest(`invalid key %q (must be in "domain.com/key" format)`, payload.Key)
+	}
+	var repeatAfter time.Duration
+	if payload.RepeatAfter != "" {
+		var err error
+		repeatAfter, err = time.ParseDuration(payload.RepeatAfter)
+		if err != nil || repeatAfter < 0 {
+			return statusBadRequest("invalid repeat-after %q", payload.RepeatAfter)
+		}
+	}
+	dataSize := 0
+	for k, v := range payload.Data {
+		dataSize += len(k) + len(v)
+	}
+	if dataSize > maxNoticeDataSize {
+		return statusBadRequest("total size of data must be %d bytes or less", maxNoticeDataSize)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	existing := st.Notices(&state.NoticeFilter{
+		Types: []state.NoticeType{state.CustomNotice},
+		Keys:  []string{payload.Key},
+	})
+	if len(existing) == 0 {
+		all := st.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.CustomNotice}})
+		if len(all) >= maxCustomNotices {
+			return statusBadRequest("cannot add more than %d custom notices", maxCustomNotices)
+		}
+	}
+	id := st.AddNotice(state.CustomNotice, payload.Key, &state.AddNoticeOptions{
+		Data:        payload.Data,
+		RepeatAfter: repeatAfter,
+	})
+	return SyncResponse(map[string]string{"id": id})
+}
+
+func v1GetNotice(c *Command, r *http.Request, _ *userState) Response {
+	noticeID := muxVars(r)["id"]
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	notice := st.Notice(noticeID)
+	if notice == nil {
+		return statusNotFound("cannot find notice with id %q", noticeID)
+	}
+	return SyncResponse(notice)
+}
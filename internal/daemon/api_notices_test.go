@@ -0,0 +1,207 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/overlord/state"
+)
+
+func (s *apiSuite) TestNotices(c *C) {
+	d := s.daemon(c)
+	noticesCmd := apiCmd("/v1/notices")
+
+	for _, body := range []string{
+		`{"action": "add", "type": "custom", "key": "example.com/foo", "data": {"a": "b"}}`,
+		`{"action": "add", "type": "custom", "key": "example.com/bar"}`,
+		`{"action": "add", "type": "custom", "key": "example.com/foo", "data": {"a": "c"}}`,
+	} {
+		req, err := http.NewRequest("POST", "/v1/notices", bytes.NewBufferString(body))
+		c.Assert(err, IsNil)
+		rsp := noticesCmd.POST(noticesCmd, req, nil).(*resp)
+		c.Assert(rsp.Status, Equals, 200, Commentf("%v", rsp.Result))
+	}
+
+	req, err := http.NewRequest("GET", "/v1/notices?keys=example.com/foo", nil)
+	c.Assert(err, IsNil)
+	notices := s.getNotices(c, noticesCmd, req)
+	c.Assert(notices, HasLen, 1)
+	c.Check(notices[0]["id"], Equals, "1")
+	c.Check(notices[0]["occurrences"], Equals, 2.0)
+	c.Check(notices[0]["last-data"], DeepEquals, map[string]interface{}{"a": "c"})
+
+	req, err = http.NewRequest("GET", "/v1/notices?types=custom", nil)
+	c.Assert(err, IsNil)
+	c.Check(s.getNotices(c, noticesCmd, req), HasLen, 2)
+
+	st := d.overlord.State()
+	st.Lock()
+	c.Check(st.Notices(nil), HasLen, 2)
+	st.Unlock()
+
+	noticeCmd := apiCmd("/v1/notices/{id}")
+	s.vars = map[string]string{"id": "2"}
+	req, err = http.NewRequest("GET", "/v1/notices/2", nil)
+	c.Assert(err, IsNil)
+	rsp := noticeCmd.GET(noticeCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Check(rsp.Result.(*state.Notice).Key(), Equals, "example.com/bar")
+
+	s.vars = map[string]string{"id": "3"}
+	rsp = noticeCmd.GET(noticeCmd, req, nil).(*resp)
+	c.Check(rsp.Status, Equals, 404)
+}
+
+func (s *apiSuite) getNotices(c *C, cmd *Command, req *http.Request) []map[string]interface{} {
+	rsp := cmd.GET(cmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	var body struct {
+		Result []map[string]interface{}
+	}
+	c.Assert(json.NewDecoder(rec.Body).Decode(&body), IsNil)
+	return body.Result
+}
+
+func (s *apiSuite) TestNoticesWait(c *C) {
+	d := s.daemon(c)
+	noticesCmd := apiCmd("/v1/notices")
+
+	st := d.overlord.State()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		st.Lock()
+		defer st.Unlock()
+		st.AddNotice(state.CustomNotice, "example.com/bar", nil)
+		st.AddNotice(state.CustomNotice, "example.com/foo", nil)
+	}()
+
+	req, err := http.NewRequest("GET", "/v1/notices?keys=example.com/foo&timeout=5s", nil)
+	c.Assert(err, IsNil)
+	notices := s.getNotices(c, noticesCmd, req)
+	c.Assert(notices, HasLen, 1)
+	c.Check(notices[0]["key"], Equals, "example.com/foo")
+}
+
+func (s *apiSuite) TestNoticesWaitTimeout(c *C) {
+	s.daemon(c)
+	noticesCmd := apiCmd("/v1/notices")
+
+	req, err := http.NewRequest("GET", "/v1/notices?timeout=10ms", nil)
+	c.Assert(err, IsNil)
+	c.Check(s.getNotices(c, noticesCmd, req), HasLen, 0)
+}
+
+func (s *apiSuite) TestNoticesWaitCancelled(c *C) {
+	s.daemon(c)
+	noticesCmd := apiCmd("/v1/notices")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", "/v1/notices?timeout=5s", nil)
+	c.Assert(err, IsNil)
+	time.AfterFunc(10*time.Millisecond, cancel)
+	rsp := noticesCmd.GET(noticesCmd, req, nil).(*resp)
+	c.Check(rsp.Status, Equals, 500)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "request cancelled")
+}
+
+func (s *apiSuite) TestNoticesErrors(c *C) {
+	s.daemon(c)
+	noticesCmd := apiCmd("/v1/notices")
+
+	for _, test := range []struct {
+		body    string
+		message string
+	}{
+		{`@`, `cannot decode request body: .*`},
+		{`{"action": "foo"}`, `invalid action "foo"`},
+		{`{"action": "add", "type": "other", "key": "example.com/foo"}`, `invalid type "other" .*`},
+		{`{"action": "add", "type": "custom", "key": "foo"}`, `invalid key "foo" .*`},
+		{`{"action": "add", "type": "custom", "key": "example.com/Foo"}`, `invalid key "example.com/Foo" .*`},
+		{`{"action": "add", "type": "custom", "key": "example.com/foo", "repeat-after": "x"}`, `invalid repeat-after "x"`},
+	} {
+		req, err := http.NewRequest("POST", "/v1/notices", bytes.NewBufferString(test.body))
+		c.Assert(err, IsNil)
+		rsp := noticesCmd.POST(noticesCmd, req, nil).(*resp)
+		c.Check(rsp.Status, Equals, 400)
+		c.Check(rsp.Result.(*errorResult).Message, Matches, test.message)
+	}
+
+	for _, query := range []string{"types=foo", "after=yesterday", "timeout=x", "timeout=-1s"} {
+		req, err := http.NewRequest("GET", "/v1/notices?"+query, nil)
+		c.Assert(err, IsNil)
+		rsp := noticesCmd.GET(noticesCmd, req, nil).(*resp)
+		c.Check(rsp.Status, Equals, 400)
+	}
+}
+
+func (s *apiSuite) TestNoticesLimit(c *C) {
+	d := s.daemon(c)
+	noticesCmd := apiCmd("/v1/notices")
+
+	st := d.overlord.State()
+	st.Lock()
+	for i := 0; i < maxCustomNotices; i++ {
+		st.AddNotice(state.CustomNotice, fmt.Sprintf("example.com/%d", i), nil)
+	}
+	st.Unlock()
+
+	// Existing notices can still be repeated, but new ones can't be added.
+	body := `{"action": "add", "type": "custom", "key": "example.com/0"}`
+	req, err := http.NewRequest("POST", "/v1/notices", bytes.NewBufferString(body))
+	c.Assert(err, IsNil)
+	rsp := noticesCmd.POST(noticesCmd, req, nil).(*resp)
+	c.Check(rsp.Status, Equals, 200)
+
+	body = `{"action": "add", "type": "custom", "key": "example.com/new"}`
+	req, err = http.NewRequest("POST", "/v1/notices", bytes.NewBufferString(body))
+	c.Assert(err, IsNil)
+	rsp = noticesCmd.POST(noticesCmd, req, nil).(*resp)
+	c.Check(rsp.Status, Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot add more than 1000 custom notices")
+}
+
+func (s *apiSuite) TestHealth(c *C) {
+	writeTestLayer(s.pebbleDir, `
+services:
+    test1:
+        override: replace
+        command: sleep 10
+`)
+	d := s.daemon(c)
+	healthCmd := apiCmd("/v1/health")
+
+	req, err := http.NewRequest("GET", "/v1/health", nil)
+	c.Assert(err, IsNil)
+	rsp := healthCmd.GET(healthCmd, req, nil).(*resp)
+	c.Check(rsp.Status, Equals, 200)
+	c.Check(rsp.Result, DeepEquals, healthInfo{Healthy: true})
+
+	d.SetDegradedMode(errors.New("foo"))
+	rsp = healthCmd.GET(healthCmd, req, nil).(*resp)
+	c.Check(rsp.Status, Equals, 502)
+	c.Check(rsp.Result, DeepEquals, healthInfo{Healthy: false})
+}
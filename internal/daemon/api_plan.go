@@ -42,11 +42,51 @@ func v1GetPlan(c *Command, r *http.Request, _ *userState) Response {
 	return SyncResponse(string(planYAML))
 }
 
+type layerInfo struct {
+	Label   string `json:"label"`
+	Order   int    `json:"order"`
+	Summary string `json:"summary,omitempty"`
+	Dynamic bool   `json:"dynamic,omitempty"`
+	Persist bool   `json:"persist,omitempty"`
+	Layer   string `json:"layer,omitempty"`
+}
+
+func v1GetLayers(c *Command, r *http.Request, _ *userState) Response {
+	servmgr := overlordServiceManager(c.d.overlord)
+	p, err := servmgr.Plan()
+	if err != nil {
+		return statusInternalError("%v", err)
+	}
+	content := r.URL.Query().Get("content") == "true"
+	infos := make([]layerInfo, 0, len(p.Layers))
+	for _, layer := range p.Layers {
+		info := layerInfo{
+			Label:   layer.Label,
+			Order:   layer.Order,
+			Summary: layer.Summary,
+			Dynamic: layer.Dynamic,
+			Persist: layer.Persist,
+		}
+		if content {
+			// The layer as read, with its variable references unexpanded.
+			layerYAML, err := yaml.Marshal(layer)
+			if err != nil {
+				return statusInternalError("cannot serialize layer %q: %v", layer.Label, err)
+			}
+			info.Layer = string(layerYAML)
+		}
+		infos = append(infos, info)
+	}
+	return SyncResponse(infos)
+}
+
 func v1PostLayers(c *Command, r *http.Request, _ *userState) Response {
 	var payload struct {
 		Action  string `json:"action"`
 		Combine bool   `json:"combine"`
+		Persist bool   `json:"persist"`
 		Label   string `json:"label"`
+		Before  string `json:"before"`
 		Format  string `json:"format"`
 		Layer   string `json:"layer"`
 	}
@@ -55,12 +95,40 @@ func v1PostLayers(c *Command, r *http.Request, _ *userState) Response {
 		return statusBadRequest("cannot decode request body: %v", err)
 	}
 
-	if payload.Action != "add" {
+	switch payload.Action {
+	case "add", "replace", "remove", "move":
+	default:
 		return statusBadRequest("invalid action %q", payload.Action)
 	}
 	if payload.Label == "" {
 		return statusBadRequest("label must be set")
 	}
+	if payload.Persist && payload.Action != "add" {
+		return statusBadRequest("persist can only be set when adding a layer")
+	}
+	if payload.Before != "" && payload.Action != "add" && payload.Action != "move" {
+		return statusBadRequest("before can only be set when adding or moving a layer")
+	}
+	if payload.Before != "" && payload.Combine {
+		return statusBadRequest("before cannot be set when combining layers")
+	}
+
+	servmgr := overlordServiceManager(c.d.overlord)
+	if payload.Action == "remove" {
+		err := servmgr.RemoveLayer(payload.Label)
+		if err != nil {
+			return layerErrorResponse(err)
+		}
+		return SyncResponse(true)
+	}
+	if payload.Action == "move" {
+		err := servmgr.MoveLayer(payload.Label, payload.Before)
+		if err != nil {
+			return layerErrorResponse(err)
+		}
+		return SyncResponse(true)
+	}
+
 	if payload.Format != "yaml" {
 		return statusBadRequest("invalid format %q", payload.Format)
 	}
@@ -68,21 +136,34 @@ func v1PostLayers(c *Command, r *http.Request, _ *userState) Response {
 	if err != nil {
 		return statusBadRequest("cannot parse layer YAML: %v", err)
 	}
+	if len(layer.Include) > 0 {
+		return statusBadRequest("cannot use include in layers added via the API")
+	}
+	layer.Dynamic = true
+	layer.Persist = payload.Persist
 
-	servmgr := overlordServiceManager(c.d.overlord)
-	if payload.Combine {
+	switch {
+	case payload.Action == "replace":
+		err = servmgr.ReplaceLayer(layer)
+	case payload.Combine:
 		err = servmgr.CombineLayer(layer)
-	} else {
+	case payload.Before != "":
+		err = servmgr.InsertLayer(layer, payload.Before)
+	default:
 		err = servmgr.AppendLayer(layer)
 	}
 	if err != nil {
-		if _, ok := err.(*servstate.LabelExists); ok {
-			return statusBadRequest("%v", err)
-		}
-		if _, ok := err.(*plan.FormatError); ok {
-			return statusBadRequest("%v", err)
-		}
-		return statusInternalError("%v", err)
+		return layerErrorResponse(err)
 	}
 	return SyncResponse(true)
 }
+
+func layerErrorResponse(err error) Response {
+	switch err.(type) {
+	case *servstate.LabelNotFound:
+		return statusNotFound("%v", err)
+	case *servstate.LabelExists, *servstate.LayerNotDynamic, *plan.FormatError:
+		return statusBadRequest("%v", err)
+	}
+	return statusInternalError("%v", err)
+}
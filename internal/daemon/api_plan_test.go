@@ -16,11 +16,14 @@ package daemon
 
 import (
 	"bytes"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 
 	. "gopkg.in/check.v1"
 	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/pebble/internal/plan"
 )
 
 var planLayer = `
@@ -109,6 +112,16 @@ func (s *apiSuite) TestLayersErrors(c *C) {
 		{`{"action": "add", "label": "", "format": "yaml"}`, 400, `label must be set`},
 		{`{"action": "add", "label": "x", "format": "xml"}`, 400, `invalid format "xml"`},
 		{`{"action": "add", "label": "x", "format": "yaml", "layer": "@"}`, 400, `cannot parse layer YAML: .*`},
+		{`{"action": "add", "label": "x", "format": "yaml", "layer": "include: [foo.yaml]"}`, 400, `cannot use include in layers added via the API`},
+		{`{"action": "remove", "label": ""}`, 400, `label must be set`},
+		{`{"action": "remove", "label": "x"}`, 404, `layer "x" not found`},
+		{`{"action": "replace", "label": "x", "format": "yaml", "layer": "services: {}"}`, 404, `layer "x" not found`},
+		{`{"action": "replace", "persist": true, "label": "x", "format": "yaml", "layer": "services: {}"}`, 400, `persist can only be set when adding a layer`},
+		{`{"action": "remove", "label": "x", "before": "y"}`, 400, `before can only be set when adding or moving a layer`},
+		{`{"action": "add", "combine": true, "label": "x", "before": "y", "format": "yaml", "layer": "services: {}"}`, 400, `before cannot be set when combining layers`},
+		{`{"action": "add", "label": "x", "before": "y", "format": "yaml", "layer": "services: {}"}`, 404, `layer "y" not found`},
+		{`{"action": "move", "label": ""}`, 400, `label must be set`},
+		{`{"action": "move", "label": "x"}`, 404, `layer "x" not found`},
 	}
 
 	_ = s.daemon(c)
@@ -154,6 +167,39 @@ services:
 	s.planLayersHasLen(c, 2)
 }
 
+func (s *apiSuite) TestLayersAddPersist(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+
+	for _, persist := range []bool{false, true} {
+		payload := fmt.Sprintf(`{"action": "add", "persist": %v, "label": "foo%v", "format": "yaml", "layer": "services: {}"}`, persist, persist)
+		req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+		c.Assert(err, IsNil)
+		rsp := v1PostLayers(layersCmd, req, nil).(*resp)
+		c.Assert(rsp.Status, Equals, 200)
+	}
+
+	// Layers added via the API are dynamic, and only saved in the state
+	// (to be restored when the daemon restarts) if they're persisted.
+	p, err := s.d.overlord.ServiceManager().Plan()
+	c.Assert(err, IsNil)
+	c.Assert(p.Layers, HasLen, 3)
+	c.Check(p.Layers[0].Dynamic, Equals, false)
+	c.Check(p.Layers[1].Dynamic, Equals, true)
+	c.Check(p.Layers[1].Persist, Equals, false)
+	c.Check(p.Layers[2].Dynamic, Equals, true)
+	c.Check(p.Layers[2].Persist, Equals, true)
+
+	st := s.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+	var saved []map[string]interface{}
+	c.Assert(st.Get("layers", &saved), IsNil)
+	c.Assert(saved, HasLen, 1)
+	c.Check(saved[0]["label"], Equals, "footrue")
+}
+
 func (s *apiSuite) TestLayersAddCombine(c *C) {
 	writeTestLayer(s.pebbleDir, planLayer)
 	_ = s.daemon(c)
@@ -198,3 +244,134 @@ func (s *apiSuite) TestLayersCombineFormatError(c *C) {
 	result := rsp.Result.(*errorResult)
 	c.Assert(result.Message, Matches, `layer "base" must define "override" for service "dynamic"`)
 }
+
+func (s *apiSuite) TestLayersReplace(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+
+	payload := `{"action": "replace", "label": "base", "format": "yaml", "layer": "services:\n dynamic:\n  override: replace\n  command: echo dynamic\n"}`
+	req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp := v1PostLayers(layersCmd, req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	c.Assert(rsp.Result.(bool), Equals, true)
+	c.Assert(s.planYAML(c), Equals, `
+services:
+    dynamic:
+        override: replace
+        command: echo dynamic
+`[1:])
+	s.planLayersHasLen(c, 1)
+}
+
+func (s *apiSuite) TestLayersRemove(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+
+	payload := `{"action": "add", "label": "foo", "format": "yaml", "layer": "services:\n dynamic:\n  override: replace\n  command: echo dynamic\n"}`
+	req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp := v1PostLayers(layersCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	s.planLayersHasLen(c, 2)
+
+	payload = `{"action": "remove", "label": "foo"}`
+	req, err = http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp = v1PostLayers(layersCmd, req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	c.Assert(rsp.Result.(bool), Equals, true)
+	c.Assert(s.planYAML(c), Equals, `
+services:
+    static:
+        override: replace
+        command: echo static
+`[1:])
+	s.planLayersHasLen(c, 1)
+}
+
+func (s *apiSuite) TestGetLayers(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+
+	payload := `{"action": "add", "persist": true, "label": "foo", "format": "yaml", "layer": "summary: foo layer"}`
+	req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+	c.Assert(err, IsNil)
+	rsp := v1PostLayers(layersCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+
+	req, err = http.NewRequest("GET", "/v1/layers", nil)
+	c.Assert(err, IsNil)
+	rsp = v1GetLayers(layersCmd, req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Type, Equals, ResponseTypeSync)
+	c.Assert(rsp.Result, DeepEquals, []layerInfo{
+		{Label: "base", Order: 1, Summary: "this is a summary"},
+		{Label: "foo", Order: 2, Summary: "foo layer", Dynamic: true, Persist: true},
+	})
+
+	// The layers' content can be requested too.
+	req, err = http.NewRequest("GET", "/v1/layers?content=true", nil)
+	c.Assert(err, IsNil)
+	rsp = v1GetLayers(layersCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	infos := rsp.Result.([]layerInfo)
+	c.Assert(infos, HasLen, 2)
+	c.Check(infos[1].Layer, Equals, "summary: foo layer\n")
+	layer, err := plan.ParseLayer(1, "base", []byte(infos[0].Layer))
+	c.Assert(err, IsNil)
+	c.Check(layer.Services, HasLen, 1)
+}
+
+func (s *apiSuite) TestLayersInsertAndMove(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	_ = s.daemon(c)
+	layersCmd := apiCmd("/v1/layers")
+
+	post := func(payload string) *resp {
+		req, err := http.NewRequest("POST", "/v1/layers", bytes.NewBufferString(payload))
+		c.Assert(err, IsNil)
+		return v1PostLayers(layersCmd, req, nil).(*resp)
+	}
+	layerLabels := func() []string {
+		p, err := s.d.overlord.ServiceManager().Plan()
+		c.Assert(err, IsNil)
+		var labels []string
+		for _, layer := range p.Layers {
+			labels = append(labels, fmt.Sprintf("%s:%d", layer.Label, layer.Order))
+		}
+		return labels
+	}
+
+	rsp := post(`{"action": "add", "label": "foo", "format": "yaml", "layer": "services: {}"}`)
+	c.Assert(rsp.Status, Equals, 200)
+	rsp = post(`{"action": "add", "label": "bar", "before": "foo", "format": "yaml", "layer": "services: {}"}`)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Check(layerLabels(), DeepEquals, []string{"base:1", "bar:2", "foo:3"})
+
+	rsp = post(`{"action": "move", "label": "bar"}`)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Result.(bool), Equals, true)
+	c.Check(layerLabels(), DeepEquals, []string{"base:1", "foo:2", "bar:3"})
+
+	rsp = post(`{"action": "move", "label": "bar", "before": "foo"}`)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Check(layerLabels(), DeepEquals, []string{"base:1", "bar:2", "foo:3"})
+
+	rsp = post(`{"action": "move", "label": "foo", "before": "base"}`)
+	c.Assert(rsp.Status, Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, `layer "base" is from the layers directory and cannot be reordered`)
+	rsp = post(`{"action": "move", "label": "base"}`)
+	c.Assert(rsp.Status, Equals, 400)
+	c.Check(layerLabels(), DeepEquals, []string{"base:1", "bar:2", "foo:3"})
+}
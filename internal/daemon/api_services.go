@@ -20,6 +20,7 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/canonical/pebble/internal/overlord/servstate"
 	"github.com/canonical/pebble/internal/overlord/state"
@@ -27,13 +28,36 @@ import (
 )
 
 type serviceInfo struct {
-	Name    string `json:"name"`
-	Startup string `json:"startup"`
-	Current string `json:"current"`
+	Name          string       `json:"name"`
+	Startup       string       `json:"startup"`
+	Current       string       `json:"current"`
+	PID           int          `json:"pid,omitempty"`
+	StartTime     *time.Time   `json:"start-time,omitempty"`
+	CPUTime       string       `json:"cpu-time,omitempty"`
+	RSS           int64        `json:"rss,omitempty"`
+	Restarts      int          `json:"restarts,omitempty"`
+	TotalRestarts int          `json:"total-restarts,omitempty"`
+	LastExit      *serviceExit `json:"last-exit,omitempty"`
+
+	History []serviceTransition `json:"history,omitempty"`
+}
+
+type serviceTransition struct {
+	Time   time.Time `json:"time"`
+	State  string    `json:"state"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+type serviceExit struct {
+	Code   int       `json:"code"`
+	Signal string    `json:"signal,omitempty"`
+	Time   time.Time `json:"time"`
 }
 
 func v1GetServices(c *Command, r *http.Request, _ *userState) Response {
-	names := strutil.CommaSeparatedList(r.URL.Query().Get("names"))
+	query := r.URL.Query()
+	names := strutil.CommaSeparatedList(query.Get("names"))
+	history := query.Get("history") == "true"
 
 	servmgr := overlordServiceManager(c.d.overlord)
 	services, err := servmgr.Services(names)
@@ -44,9 +68,34 @@ func v1GetServices(c *Command, r *http.Request, _ *userState) Response {
 	infos := make([]serviceInfo, 0, len(services))
 	for _, svc := range services {
 		info := serviceInfo{
-			Name:    svc.Name,
-			Startup: string(svc.Startup),
-			Current: string(svc.Current),
+			Name:          svc.Name,
+			Startup:       string(svc.Startup),
+			Current:       string(svc.Current),
+			PID:           svc.PID,
+			RSS:           svc.RSS,
+			Restarts:      svc.Restarts,
+			TotalRestarts: svc.TotalRestarts,
+		}
+		if svc.LastExit != nil {
+			info.LastExit = &serviceExit{
+				Code:   svc.LastExit.Code,
+				Signal: svc.LastExit.Signal,
+				Time:   svc.LastExit.Time,
+			}
+		}
+		if history {
+			for _, t := range svc.History {
+				info.History = append(info.History, serviceTransition{
+					Time:   t.Time,
+					State:  t.State,
+					Reason: t.Reason,
+				})
+			}
+		}
+		if svc.PID != 0 {
+			startTime := svc.StartTime
+			info.StartTime = &startTime
+			info.CPUTime = svc.CPUTime.String()
 		}
 		infos = append(infos, info)
 	}
@@ -55,8 +104,9 @@ func v1GetServices(c *Command, r *http.Request, _ *userState) Response {
 
 func v1PostServices(c *Command, r *http.Request, _ *userState) Response {
 	var payload struct {
-		Action   string   `json:"action"`
-		Services []string `json:"services"`
+		Action   string              `json:"action"`
+		Services []string            `json:"services"`
+		Args     map[string][]string `json:"args"`
 	}
 
 	decoder := json.NewDecoder(r.Body)
@@ -92,6 +142,14 @@ func v1PostServices(c *Command, r *http.Request, _ *userState) Response {
 			return statusBadRequest("no services to %s provided", payload.Action)
 		}
 	}
+	if len(payload.Args) > 0 {
+		if payload.Action != "start" && payload.Action != "restart" {
+			return statusBadRequest("%s accepts no service arguments", payload.Action)
+		}
+		if err := checkServiceArgs(servmgr, payload.Services, payload.Args); err != nil {
+			return statusBadRequest("%v", err)
+		}
+	}
 
 	st := c.d.overlord.State()
 	st.Lock()
@@ -105,37 +163,40 @@ func v1PostServices(c *Command, r *http.Request, _ *userState) Response {
 		if err != nil {
 			break
 		}
-		taskSet, err = servstate.Start(st, services)
+		taskSet, err = serviceStartTasks(st, servmgr, services, payload.Args)
 	case "stop":
 		services, err = servmgr.StopOrder(payload.Services)
 		if err != nil {
 			break
 		}
-		taskSet, err = servstate.Stop(st, services)
+		taskSet, err = serviceStopTasks(st, servmgr, services)
 	case "restart":
-		services, err = servmgr.StopOrder(payload.Services)
+		services, taskSet, err = serviceRestartTasks(st, servmgr, payload.Services, payload.Args)
+	case "reload":
+		// Services that can't be reloaded are restarted instead.
+		var reload, restart []string
+		reload, restart, err = splitReloadable(servmgr, payload.Services)
 		if err != nil {
 			break
 		}
-		services = intersectOrdered(payload.Services, services)
-		var stopTasks *state.TaskSet
-		stopTasks, err = servstate.Stop(st, services)
-		if err != nil {
-			break
-		}
-		services, err = servmgr.StartOrder(payload.Services)
-		if err != nil {
-			break
+		taskSet = state.NewTaskSet()
+		if len(reload) > 0 {
+			var reloadTasks *state.TaskSet
+			reloadTasks, err = servstate.Reload(st, reload)
+			if err != nil {
+				break
+			}
+			taskSet.AddAll(reloadTasks)
 		}
-		var startTasks *state.TaskSet
-		startTasks, err = servstate.Start(st, services)
-		if err != nil {
-			break
+		if len(restart) > 0 {
+			var restartTasks *state.TaskSet
+			restart, restartTasks, err = serviceRestartTasks(st, servmgr, restart, nil)
+			if err != nil {
+				break
+			}
+			taskSet.AddAll(restartTasks)
 		}
-		startTasks.WaitAll(stopTasks)
-		taskSet = state.NewTaskSet()
-		taskSet.AddAll(stopTasks)
-		taskSet.AddAll(startTasks)
+		services = append(reload, restart...)
 	case "replan":
 		var stopNames, startNames []string
 		stopNames, startNames, err = servmgr.Replan()
@@ -143,12 +204,12 @@ func v1PostServices(c *Command, r *http.Request, _ *userState) Response {
 			break
 		}
 		var stopTasks *state.TaskSet
-		stopTasks, err = servstate.Stop(st, stopNames)
+		stopTasks, err = serviceStopTasks(st, servmgr, stopNames)
 		if err != nil {
 			break
 		}
 		var startTasks *state.TaskSet
-		startTasks, err = servstate.Start(st, startNames)
+		startTasks, err = serviceStartTasks(st, servmgr, startNames, nil)
 		if err != nil {
 			break
 		}
@@ -197,7 +258,122 @@ func v1GetService(c *Command, r *http.Request, _ *userState) Response {
 }
 
 func v1PostService(c *Command, r *http.Request, _ *userState) Response {
-	return statusBadRequest("not implemented")
+	var payload struct {
+		Action string `json:"action"`
+	}
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&payload); err != nil {
+		return statusBadRequest("cannot decode data from request body: %v", err)
+	}
+
+	name := muxVars(r)["name"]
+	servmgr := overlordServiceManager(c.d.overlord)
+	switch payload.Action {
+	case "watchdog":
+		if err := servmgr.PingWatchdog(name); err != nil {
+			return statusBadRequest("%v", err)
+		}
+		return SyncResponse(true)
+	default:
+		return statusBadRequest("action %q is unsupported", payload.Action)
+	}
+}
+
+// serviceStartTasks returns the tasks to start services, which must be in
+// start order, starting services that aren't ordered against each other in
+// parallel.
+func serviceStartTasks(st *state.State, servmgr *servstate.ServiceManager, services []string, args map[string][]string) (*state.TaskSet, error) {
+	p, err := servmgr.Plan()
+	if err != nil {
+		return nil, err
+	}
+	return servstate.StartWithHooks(st, p, services, p.StartDependencies(services), args)
+}
+
+// serviceRestartTasks returns the tasks to restart the given services,
+// stopping them (in stop order) and then starting them again (in start
+// order, which may include services they require), along with the services
+// started.
+func serviceRestartTasks(st *state.State, servmgr *servstate.ServiceManager, names []string, args map[string][]string) ([]string, *state.TaskSet, error) {
+	services, err := servmgr.StopOrder(names)
+	if err != nil {
+		return nil, nil, err
+	}
+	services = intersectOrdered(names, services)
+	stopTasks, err := serviceStopTasks(st, servmgr, services)
+	if err != nil {
+		return nil, nil, err
+	}
+	services, err = servmgr.StartOrder(names)
+	if err != nil {
+		return nil, nil, err
+	}
+	startTasks, err := serviceStartTasks(st, servmgr, services, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	startTasks.WaitAll(stopTasks)
+	taskSet := state.NewTaskSet()
+	taskSet.AddAll(stopTasks)
+	taskSet.AddAll(startTasks)
+	return services, taskSet, nil
+}
+
+// splitReloadable splits the named services into those that have a
+// reload-command or reload-signal and those that don't.
+func splitReloadable(servmgr *servstate.ServiceManager, names []string) (reload, restart []string, err error) {
+	p, err := servmgr.Plan()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range names {
+		service, ok := p.Service(name)
+		if !ok {
+			return nil, nil, fmt.Errorf("service %q does not exist", name)
+		}
+		if service.CanReload() {
+			reload = append(reload, name)
+		} else {
+			restart = append(restart, name)
+		}
+	}
+	return reload, restart, nil
+}
+
+// checkServiceArgs ensures that the services given arguments are among those
+// being started, and that their commands have default arguments to replace.
+func checkServiceArgs(servmgr *servstate.ServiceManager, services []string, args map[string][]string) error {
+	p, err := servmgr.Plan()
+	if err != nil {
+		return err
+	}
+	for name := range args {
+		if !strutil.ListContains(services, name) {
+			return fmt.Errorf("cannot give arguments to service %q that is not being started", name)
+		}
+		service, ok := p.Service(name)
+		if !ok {
+			return fmt.Errorf("service %q does not exist", name)
+		}
+		_, _, hasDefaults, err := service.ParseCommand()
+		if err != nil {
+			return fmt.Errorf("cannot parse service %q command: %v", name, err)
+		}
+		if !hasDefaults {
+			return fmt.Errorf("cannot give arguments to service %q: command has no [ ... ] group", name)
+		}
+	}
+	return nil
+}
+
+// serviceStopTasks is like serviceStartTasks, but for stopping services,
+// which must be in stop order.
+func serviceStopTasks(st *state.State, servmgr *servstate.ServiceManager, services []string) (*state.TaskSet, error) {
+	p, err := servmgr.Plan()
+	if err != nil {
+		return nil, err
+	}
+	return servstate.StopWithHooks(st, p, services, p.StopDependencies(services))
 }
 
 // intersectOrdered returns the intersection of left and right where
@@ -24,6 +24,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/canonical/pebble/internal/overlord/servstate"
 	"github.com/canonical/pebble/internal/overlord/state"
 
 	. "gopkg.in/check.v1"
@@ -112,6 +113,139 @@ func (s *apiSuite) TestServicesStart(c *C) {
 	c.Assert(tasks[2].Summary(), Equals, `Start service "test3"`)
 }
 
+func (s *apiSuite) TestServicesStartArgs(c *C) {
+	writeTestLayer(s.pebbleDir, `
+services:
+    test1:
+        override: replace
+        command: server --port 80 [ --verbose ]
+        requires:
+            - test2
+    test2:
+        override: replace
+        command: helper
+`)
+	d := s.daemon(c)
+	st := d.overlord.State()
+	restore := FakeStateEnsureBefore(func(st *state.State, d time.Duration) {})
+	defer restore()
+	servicesCmd := apiCmd("/v1/services")
+
+	payload := bytes.NewBufferString(`{"action": "start", "services": ["test1"], "args": {"test1": ["--quiet"]}}`)
+	req, err := http.NewRequest("POST", "/v1/services", payload)
+	c.Assert(err, IsNil)
+	rsp := v1PostServices(servicesCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 202, Commentf("%v", rsp.Result))
+
+	st.Lock()
+	tasks := st.Change(rsp.Change).Tasks()
+	c.Assert(tasks, HasLen, 2)
+	request, err := servstate.TaskServiceRequest(tasks[0])
+	c.Assert(err, IsNil)
+	c.Check(request.Name, Equals, "test1")
+	c.Check(request.Args, DeepEquals, []string{"--quiet"})
+	request, err = servstate.TaskServiceRequest(tasks[1])
+	c.Assert(err, IsNil)
+	c.Check(request.Name, Equals, "test2")
+	c.Check(request.Args, IsNil)
+	st.Unlock()
+
+	for _, test := range []struct {
+		payload string
+		error   string
+	}{
+		{`{"action": "stop", "services": ["test1"], "args": {"test1": []}}`, `stop accepts no service arguments`},
+		{`{"action": "start", "services": ["test1"], "args": {"test2": []}}`, `cannot give arguments to service "test2" that is not being started`},
+		{`{"action": "start", "services": ["test2"], "args": {"test2": []}}`, `cannot give arguments to service "test2": command has no \[ ... \] group`},
+	} {
+		req, err := http.NewRequest("POST", "/v1/services", bytes.NewBufferString(test.payload))
+		c.Assert(err, IsNil)
+		rsp := v1PostServices(servicesCmd, req, nil).(*resp)
+		c.Check(rsp.Status, Equals, 400, Commentf(test.payload))
+		c.Check(rsp.Result.(*errorResult).Message, Matches, test.error)
+	}
+}
+
+func (s *apiSuite) TestServicesRestartHooks(c *C) {
+	writeTestLayer(s.pebbleDir, `
+services:
+    test1:
+        override: replace
+        command: server
+        hooks:
+            pre-start:
+                command: migrate
+            post-stop:
+                command: cleanup
+`)
+	d := s.daemon(c)
+	st := d.overlord.State()
+
+	restore := FakeStateEnsureBefore(func(st *state.State, d time.Duration) {})
+	defer restore()
+
+	payload := bytes.NewBufferString(`{"action": "restart", "services": ["test1"]}`)
+	req, err := http.NewRequest("POST", "/v1/services", payload)
+	c.Assert(err, IsNil)
+	rsp := v1PostServices(apiCmd("/v1/services"), req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 202)
+
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, NotNil)
+
+	// The hooks are run as tasks of their own, in order.
+	tasks := chg.Tasks()
+	c.Assert(tasks, HasLen, 4)
+	c.Check(tasks[0].Summary(), Equals, `Stop service "test1"`)
+	c.Check(tasks[1].Summary(), Equals, `Run post-stop hook of service "test1"`)
+	c.Check(tasks[2].Summary(), Equals, `Run pre-start hook of service "test1"`)
+	c.Check(tasks[3].Summary(), Equals, `Start service "test1"`)
+	c.Check(tasks[1].WaitTasks(), DeepEquals, []*state.Task{tasks[0]})
+	c.Check(tasks[2].WaitTasks(), DeepEquals, []*state.Task{tasks[0], tasks[1]})
+	c.Check(tasks[3].WaitTasks(), DeepEquals, []*state.Task{tasks[2], tasks[0], tasks[1]})
+}
+
+func (s *apiSuite) TestServicesReload(c *C) {
+	writeTestLayer(s.pebbleDir, `
+services:
+    test1:
+        override: replace
+        command: server
+        reload-signal: SIGHUP
+    test2:
+        override: replace
+        command: helper
+`)
+	d := s.daemon(c)
+	st := d.overlord.State()
+
+	restore := FakeStateEnsureBefore(func(st *state.State, d time.Duration) {})
+	defer restore()
+
+	payload := bytes.NewBufferString(`{"action": "reload", "services": ["test1", "test2"]}`)
+	req, err := http.NewRequest("POST", "/v1/services", payload)
+	c.Assert(err, IsNil)
+	rsp := v1PostServices(apiCmd("/v1/services"), req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 202)
+
+	st.Lock()
+	defer st.Unlock()
+	chg := st.Change(rsp.Change)
+	c.Assert(chg, NotNil)
+	c.Check(chg.Kind(), Equals, "reload")
+	c.Check(chg.Summary(), Equals, `Reload service "test1" and 1 more`)
+
+	// A service without a reload-command or reload-signal is restarted.
+	tasks := chg.Tasks()
+	c.Assert(tasks, HasLen, 3)
+	c.Check(tasks[0].Summary(), Equals, `Reload service "test1"`)
+	c.Check(tasks[1].Summary(), Equals, `Stop service "test2"`)
+	c.Check(tasks[2].Summary(), Equals, `Start service "test2"`)
+	c.Check(tasks[0].WaitTasks(), HasLen, 0)
+}
+
 func (s *apiSuite) TestServicesStop(c *C) {
 	// Setup
 	writeTestLayer(s.pebbleDir, servicesLayer)
@@ -230,6 +364,133 @@ func (s *apiSuite) TestServicesGet(c *C) {
 	})
 }
 
+func (s *apiSuite) TestServicesGetRunning(c *C) {
+	writeTestLayer(s.pebbleDir, `
+services:
+    test1:
+        override: replace
+        command: sleep 10
+`)
+	d := s.daemon(c)
+	d.overlord.Loop()
+
+	payload := bytes.NewBufferString(`{"action": "start", "services": ["test1"]}`)
+	req, err := http.NewRequest("POST", "/v1/services", payload)
+	c.Assert(err, IsNil)
+	rsp := v1PostServices(apiCmd("/v1/services"), req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Check(rec.Code, Equals, 202)
+
+	var info map[string]interface{}
+	for i := 0; ; i++ {
+		if i > 50 {
+			c.Fatalf("timed out waiting for service to start")
+		}
+		req, err = http.NewRequest("GET", "/v1/services?names=test1", nil)
+		c.Assert(err, IsNil)
+		rsp = v1GetServices(apiCmd("/v1/services"), req, nil).(*resp)
+		rec = httptest.NewRecorder()
+		rsp.ServeHTTP(rec, req)
+		c.Assert(rec.Code, Equals, 200)
+		var body map[string]interface{}
+		c.Assert(json.Unmarshal(rec.Body.Bytes(), &body), IsNil)
+		result := body["result"].([]interface{})
+		c.Assert(result, HasLen, 1)
+		info = result[0].(map[string]interface{})
+		if info["current"] == "active" && info["pid"] != nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Check(info["pid"], Not(Equals), float64(0))
+	c.Check(info["start-time"], NotNil)
+	c.Check(info["cpu-time"], Matches, `[0-9.]+[mµn]?s`)
+	c.Check(info["rss"], NotNil)
+	c.Check(info["restarts"], IsNil)
+}
+
+func (s *apiSuite) TestServicesGetLastExit(c *C) {
+	writeTestLayer(s.pebbleDir, `
+services:
+    test1:
+        override: replace
+        command: sleep 10
+        okay-delay: 10ms
+        on-failure: ignore
+`)
+	d := s.daemon(c)
+	d.overlord.Loop()
+
+	payload := bytes.NewBufferString(`{"action": "start", "services": ["test1"]}`)
+	req, err := http.NewRequest("POST", "/v1/services", payload)
+	c.Assert(err, IsNil)
+	rsp := v1PostServices(apiCmd("/v1/services"), req, nil).(*resp)
+	rec := httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Check(rec.Code, Equals, 202)
+
+	st := d.overlord.State()
+	st.Lock()
+	chg := st.Change(rsp.Change)
+	st.Unlock()
+	select {
+	case <-chg.Ready():
+	case <-time.After(5 * time.Second):
+		c.Fatalf("timed out waiting for service to start")
+	}
+
+	// Kill it, and wait for it to stop (it's not restarted).
+	servmgr := d.overlord.ServiceManager()
+	c.Assert(servmgr.SendSignal([]string{"test1"}, "SIGTERM"), IsNil)
+	var info map[string]interface{}
+	for i := 0; ; i++ {
+		if i > 100 {
+			c.Fatalf("timed out waiting for service to stop")
+		}
+		req, err = http.NewRequest("GET", "/v1/services?names=test1", nil)
+		c.Assert(err, IsNil)
+		rsp = v1GetServices(apiCmd("/v1/services"), req, nil).(*resp)
+		rec = httptest.NewRecorder()
+		rsp.ServeHTTP(rec, req)
+		c.Assert(rec.Code, Equals, 200)
+		var body map[string]interface{}
+		c.Assert(json.Unmarshal(rec.Body.Bytes(), &body), IsNil)
+		info = body["result"].([]interface{})[0].(map[string]interface{})
+		if info["current"] == "inactive" {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.Check(info["pid"], IsNil)
+	c.Check(info["restarts"], IsNil)
+	c.Check(info["total-restarts"], IsNil)
+	lastExit, ok := info["last-exit"].(map[string]interface{})
+	c.Assert(ok, Equals, true)
+	c.Check(lastExit["code"], Equals, float64(143))
+	c.Check(lastExit["signal"], Equals, "SIGTERM")
+	c.Check(lastExit["time"], NotNil)
+	c.Check(info["history"], IsNil)
+
+	// The history is only included if asked for.
+	req, err = http.NewRequest("GET", "/v1/services?names=test1&history=true", nil)
+	c.Assert(err, IsNil)
+	rsp = v1GetServices(apiCmd("/v1/services"), req, nil).(*resp)
+	rec = httptest.NewRecorder()
+	rsp.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+	var body map[string]interface{}
+	c.Assert(json.Unmarshal(rec.Body.Bytes(), &body), IsNil)
+	info = body["result"].([]interface{})[0].(map[string]interface{})
+	history, ok := info["history"].([]interface{})
+	c.Assert(ok, Equals, true)
+	c.Assert(history, HasLen, 3)
+	last := history[2].(map[string]interface{})
+	c.Check(last["state"], Equals, "stopped")
+	c.Check(last["reason"], Equals, "killed by SIGTERM")
+	c.Check(last["time"], NotNil)
+}
+
 func (s *apiSuite) TestServicesRestart(c *C) {
 	// Setup
 	writeTestLayer(s.pebbleDir, servicesLayer)
@@ -320,3 +581,59 @@ func (s *apiSuite) TestServicesReplan(c *C) {
 	c.Check(tasks[0].Summary(), Equals, `Start service "test1"`)
 	c.Check(tasks[1].Summary(), Equals, `Start service "test2"`)
 }
+
+func (s *apiSuite) TestServiceWatchdog(c *C) {
+	writeTestLayer(s.pebbleDir, `
+services:
+    test1:
+        override: replace
+        command: sleep 10
+        watchdog: 1m
+    test2:
+        override: replace
+        command: sleep 10
+`)
+	d := s.daemon(c)
+	d.overlord.Loop()
+
+	payload := bytes.NewBufferString(`{"action": "start", "services": ["test1", "test2"]}`)
+	req, err := http.NewRequest("POST", "/v1/services", payload)
+	c.Assert(err, IsNil)
+	rsp := v1PostServices(apiCmd("/v1/services"), req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 202)
+
+	serviceMgr := d.overlord.ServiceManager()
+	for i := 0; ; i++ {
+		if i > 50 {
+			c.Fatalf("timed out waiting for services to start")
+		}
+		services, err := serviceMgr.Services([]string{"test1", "test2"})
+		c.Assert(err, IsNil)
+		if len(services) == 2 && services[0].Current == servstate.StatusActive && services[1].Current == servstate.StatusActive {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	serviceCmd := apiCmd("/v1/services/{name}")
+	for _, test := range []struct {
+		name    string
+		payload string
+		status  int
+		error   string
+	}{
+		{"test1", `{"action": "watchdog"}`, 200, ""},
+		{"test2", `{"action": "watchdog"}`, 400, `service "test2" has no watchdog`},
+		{"test3", `{"action": "watchdog"}`, 400, `service "test3" is not running`},
+		{"test1", `{"action": "foo"}`, 400, `action "foo" is unsupported`},
+	} {
+		s.vars = map[string]string{"name": test.name}
+		req, err := http.NewRequest("POST", "/v1/services/"+test.name, bytes.NewBufferString(test.payload))
+		c.Assert(err, IsNil)
+		rsp := v1PostService(serviceCmd, req, nil).(*resp)
+		c.Check(rsp.Status, Equals, test.status, Commentf("%s %s", test.name, test.payload))
+		if test.error != "" {
+			c.Check(rsp.Result.(*errorResult).Message, Equals, test.error)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/canonical/pebble/internal/overlord/state"
+)
+
+// stateExport is the portable document used to export and import the
+// overlord state. Services is informational only and is ignored on import.
+type stateExport struct {
+	State    json.RawMessage `json:"state"`
+	Services []serviceInfo   `json:"services"`
+}
+
+func v1GetState(c *Command, r *http.Request, _ *userState) Response {
+	servmgr := overlordServiceManager(c.d.overlord)
+	services, err := servmgr.Services(nil)
+	if err != nil {
+		return statusInternalError("%v", err)
+	}
+	infos := make([]serviceInfo, 0, len(services))
+	for _, svc := range services {
+		infos = append(infos, serviceInfo{
+			Name:    svc.Name,
+			Startup: string(svc.Startup),
+			Current: string(svc.Current),
+		})
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	data, err := json.Marshal(st)
+	st.Unlock()
+	if err != nil {
+		return statusInternalError("cannot serialize state: %v", err)
+	}
+
+	return SyncResponse(&stateExport{
+		State:    data,
+		Services: infos,
+	})
+}
+
+func v1PostState(c *Command, r *http.Request, _ *userState) Response {
+	var payload stateExport
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&payload); err != nil {
+		return statusBadRequest("cannot decode request body: %v", err)
+	}
+	if len(payload.State) == 0 {
+		return statusBadRequest("state must be set")
+	}
+	// Check that the state is valid before touching the daemon's state.
+	imported, err := state.ReadState(nil, bytes.NewReader(payload.State))
+	if err != nil {
+		return statusBadRequest("%v", err)
+	}
+	// Changes that aren't ready would be run again by this daemon, so only
+	// the history of finished changes can be imported.
+	imported.Lock()
+	for _, chg := range imported.Changes() {
+		if !chg.IsReady() {
+			imported.Unlock()
+			return statusBadRequest("cannot import state with change %s that isn't ready", chg.ID())
+		}
+	}
+	imported.Unlock()
+	data, err := fillStateSections(payload.State)
+	if err != nil {
+		return statusBadRequest("cannot read state: %v", err)
+	}
+
+	st := c.d.overlord.State()
+	st.Lock()
+	defer st.Unlock()
+
+	if len(st.Changes()) > 0 {
+		return statusBadRequest("cannot import state into a daemon that has changes")
+	}
+	// The daemon's state is already at the current patch level, which
+	// must be kept whatever level the imported state was written at.
+	var patchLevel, patchSublevel int
+	levelErr := st.Get("patch-level", &patchLevel)
+	sublevelErr := st.Get("patch-sublevel", &patchSublevel)
+	if err := st.UnmarshalJSON(data); err != nil {
+		return statusInternalError("cannot import state: %v", err)
+	}
+	if levelErr == nil {
+		st.Set("patch-level", patchLevel)
+	}
+	if sublevelErr == nil {
+		st.Set("patch-sublevel", patchSublevel)
+	}
+	stateEnsureBefore(st, 0)
+
+	return SyncResponse(true)
+}
+
+// fillStateSections returns the state document with empty objects in place
+// of any missing data, changes, or tasks sections, so that the imported
+// state can be modified.
+func fillStateSections(data []byte) ([]byte, error) {
+	var sections map[string]json.RawMessage
+	err := json.Unmarshal(data, &sections)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"data", "changes", "tasks"} {
+		if value, ok := sections[name]; !ok || string(value) == "null" {
+			sections[name] = json.RawMessage("{}")
+		}
+	}
+	return json.Marshal(sections)
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/overlord/state"
+)
+
+func (s *apiSuite) TestStateExportImport(c *C) {
+	writeTestLayer(s.pebbleDir, planLayer)
+	d := s.daemon(c)
+	stateCmd := apiCmd("/v1/state")
+	restore := FakeStateEnsureBefore(func(st *state.State, d time.Duration) {})
+	defer restore()
+
+	st := d.overlord.State()
+	st.Lock()
+	var patchLevel int
+	c.Assert(st.Get("patch-level", &patchLevel), IsNil)
+	st.Unlock()
+
+	// Build a state document from another state with a change in it, at an
+	// older patch level.
+	other := state.New(nil)
+	other.Lock()
+	other.NewChange("foo", "Foo change")
+	other.Set("patch-level", patchLevel-1)
+	otherData, err := json.Marshal(other)
+	other.Unlock()
+	c.Assert(err, IsNil)
+	doc, err := json.Marshal(&stateExport{State: otherData})
+	c.Assert(err, IsNil)
+
+	req, err := http.NewRequest("POST", "/v1/state", bytes.NewReader(doc))
+	c.Assert(err, IsNil)
+	rsp := v1PostState(stateCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	c.Assert(rsp.Result, Equals, true)
+
+	st.Lock()
+	changes := st.Changes()
+	var importedLevel int
+	c.Assert(st.Get("patch-level", &importedLevel), IsNil)
+	st.Unlock()
+	c.Assert(changes, HasLen, 1)
+	c.Check(changes[0].Kind(), Equals, "foo")
+	c.Check(importedLevel, Equals, patchLevel)
+
+	// Importing again fails, as the daemon now has changes.
+	req, err = http.NewRequest("POST", "/v1/state", bytes.NewReader(doc))
+	c.Assert(err, IsNil)
+	rsp = v1PostState(stateCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot import state into a daemon that has changes")
+
+	// Export includes the imported change and the services.
+	req, err = http.NewRequest("GET", "/v1/state", nil)
+	c.Assert(err, IsNil)
+	rsp = v1GetState(stateCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	export := rsp.Result.(*stateExport)
+	c.Check(export.Services, DeepEquals, []serviceInfo{
+		{Name: "static", Startup: "disabled", Current: "inactive"},
+	})
+	var exported struct {
+		Changes map[string]struct {
+			Kind string `json:"kind"`
+		} `json:"changes"`
+	}
+	c.Assert(json.Unmarshal(export.State, &exported), IsNil)
+	c.Assert(exported.Changes, HasLen, 1)
+	for _, chg := range exported.Changes {
+		c.Check(chg.Kind, Equals, "foo")
+	}
+}
+
+func (s *apiSuite) TestStateImportErrors(c *C) {
+	d := s.daemon(c)
+	stateCmd := apiCmd("/v1/state")
+	restore := FakeStateEnsureBefore(func(st *state.State, d time.Duration) {})
+	defer restore()
+
+	// Changes that aren't ready can't be imported, as they would run again.
+	other := state.New(nil)
+	other.Lock()
+	chg := other.NewChange("foo", "Foo change")
+	chg.AddTask(other.NewTask("bar", "Bar task"))
+	otherData, err := json.Marshal(other)
+	other.Unlock()
+	c.Assert(err, IsNil)
+	doc, err := json.Marshal(&stateExport{State: otherData})
+	c.Assert(err, IsNil)
+	req, err := http.NewRequest("POST", "/v1/state", bytes.NewReader(doc))
+	c.Assert(err, IsNil)
+	rsp := v1PostState(stateCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 400)
+	c.Check(rsp.Result.(*errorResult).Message, Equals, "cannot import state with change 1 that isn't ready")
+
+	// Missing sections are filled in, so the imported state can be modified.
+	req, err = http.NewRequest("POST", "/v1/state", bytes.NewBufferString(`{"state": {}}`))
+	c.Assert(err, IsNil)
+	rsp = v1PostState(stateCmd, req, nil).(*resp)
+	c.Assert(rsp.Status, Equals, 200)
+	st := d.overlord.State()
+	st.Lock()
+	st.Set("foo", "bar")
+	c.Check(st.NewChange("foo", "Foo change"), NotNil)
+	st.Unlock()
+
+	for _, test := range []struct {
+		payload string
+		message string
+	}{
+		{"@", `cannot decode request body: .*`},
+		{`{}`, `state must be set`},
+		{`{"state": "foo"}`, `cannot read state: .*`},
+		{`{"state": {}}`, `cannot import state into a daemon that has changes`},
+	} {
+		req, err := http.NewRequest("POST", "/v1/state", bytes.NewBufferString(test.payload))
+		c.Assert(err, IsNil)
+		rsp = v1PostState(stateCmd, req, nil).(*resp)
+		c.Check(rsp.Status, Equals, 400)
+		c.Check(rsp.Result.(*errorResult).Message, Matches, test.message)
+	}
+}
@@ -64,7 +64,7 @@ func (s *apiSuite) daemon(c *check.C) *Daemon {
 
 func apiCmd(path string) *Command {
 	for _, cmd := range api {
-		if cmd.Path == path {
+		if cmd.Path == path || cmd.PathPrefix == path {
 			return cmd
 		}
 	}
@@ -94,6 +94,9 @@ func (s *apiSuite) TestSysInfo(c *check.C) {
 	expected := map[string]interface{}{
 		"version": "42b1",
 		"boot-id": "ffffffff-ffff-ffff-ffff-ffffffffffff",
+		"features": []interface{}{
+			"changes-wait", "debug-audit", "debug-pprof", "debug-prune", "debug-reexec", "events", "exec-detach", "files-archive", "files-checksum", "files-glob", "files-symlinks", "health", "health-checks", "layers-content", "layers-list", "layers-move", "layers-persist", "layers-remove", "layers-replace", "metrics", "notices", "notices-wait", "services-reload", "state",
+		},
 	}
 	var rsp resp
 	c.Assert(json.Unmarshal(rec.Body.Bytes(), &rsp), check.IsNil)
@@ -0,0 +1,136 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/canonical/pebble/internal/logger"
+)
+
+// auditRecentEntries is the number of audit entries kept in memory for the
+// debug API.
+const auditRecentEntries = 100
+
+// auditEntry records a single state-mutating API request.
+type auditEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	PID        *int32    `json:"pid,omitempty"`
+	UID        *uint32   `json:"uid,omitempty"`
+	RemoteAddr string    `json:"remote-addr,omitempty"`
+	Status     int       `json:"status"`
+}
+
+// auditLog appends an entry for each mutating request to an append-only
+// file (one JSON object per line), and keeps the most recent entries in
+// memory.
+type auditLog struct {
+	mu      sync.Mutex
+	file    *os.File
+	recent  []auditEntry
+	next    int
+	failing bool
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{file: f}, nil
+}
+
+// newAuditEntry returns the audit entry for request r that completed with
+// the given HTTP status.
+func newAuditEntry(r *http.Request, status int, now time.Time) auditEntry {
+	entry := auditEntry{
+		Time:   now,
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Status: status,
+	}
+	pid, uid, _, err := ucrednetGet(r.RemoteAddr)
+	if err == nil {
+		entry.PID = &pid
+		entry.UID = &uid
+	} else {
+		entry.RemoteAddr = r.RemoteAddr
+	}
+	return entry
+}
+
+// record writes the entry to the audit file and adds it to the recent
+// entries. Write errors are logged (once until a write succeeds again), but
+// don't fail the request.
+func (l *auditLog) record(entry auditEntry) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.recent) < auditRecentEntries {
+		l.recent = append(l.recent, entry)
+	} else {
+		l.recent[l.next] = entry
+	}
+	l.next = (l.next + 1) % auditRecentEntries
+
+	data, err := json.Marshal(entry)
+	if err == nil {
+		_, err = l.file.Write(append(data, '\n'))
+	}
+	if err != nil {
+		if !l.failing {
+			logger.Noticef("Cannot write audit log entry: %v", err)
+		}
+		l.failing = true
+		return
+	}
+	l.failing = false
+}
+
+// entries returns the recent audit entries, oldest first.
+func (l *auditLog) entries() []auditEntry {
+	if l == nil {
+		return []auditEntry{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := make([]auditEntry, 0, len(l.recent))
+	if len(l.recent) == auditRecentEntries {
+		entries = append(entries, l.recent[l.next:]...)
+		entries = append(entries, l.recent[:l.next]...)
+	} else {
+		entries = append(entries, l.recent...)
+	}
+	return entries
+}
+
+func (l *auditLog) close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
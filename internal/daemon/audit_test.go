@@ -0,0 +1,98 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *daemonSuite) TestAuditLog(c *C) {
+	d := s.newDaemon(c)
+	cmd := &Command{d: d}
+	cmd.GET = func(*Command, *http.Request, *userState) Response {
+		return SyncResponse(nil)
+	}
+	cmd.POST = func(*Command, *http.Request, *userState) Response {
+		return statusBadRequest("bad")
+	}
+	cmd.PUT = func(*Command, *http.Request, *userState) Response {
+		return SyncResponse(nil)
+	}
+
+	doTestReq(c, cmd, "GET")
+	doTestReq(c, cmd, "POST")
+	doTestReq(c, cmd, "PUT")
+	doTestReq(c, cmd, "DELETE")
+
+	pid, uid := int32(100), uint32(0)
+	entries := d.auditLog.entries()
+	c.Assert(entries, HasLen, 3)
+	for i, expected := range []struct {
+		method string
+		status int
+	}{
+		{"POST", 400},
+		{"PUT", 200},
+		{"DELETE", 405},
+	} {
+		entry := entries[i]
+		c.Check(entry.Time.IsZero(), Equals, false)
+		entry.Time = time.Time{}
+		c.Check(entry, DeepEquals, auditEntry{
+			Method: expected.method,
+			PID:    &pid,
+			UID:    &uid,
+			Status: expected.status,
+		})
+	}
+
+	// The same entries were appended to the audit file.
+	f, err := os.Open(filepath.Join(s.pebbleDir, ".pebble.audit"))
+	c.Assert(err, IsNil)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	var methods []string
+	for scanner.Scan() {
+		var entry auditEntry
+		c.Assert(json.Unmarshal(scanner.Bytes(), &entry), IsNil)
+		c.Check(*entry.UID, Equals, uint32(0))
+		methods = append(methods, fmt.Sprintf("%s %d", entry.Method, entry.Status))
+	}
+	c.Assert(scanner.Err(), IsNil)
+	c.Check(methods, DeepEquals, []string{"POST 400", "PUT 200", "DELETE 405"})
+}
+
+func (s *daemonSuite) TestAuditLogRecent(c *C) {
+	l, err := openAuditLog(filepath.Join(c.MkDir(), "audit"))
+	c.Assert(err, IsNil)
+	defer l.close()
+
+	c.Check(l.entries(), HasLen, 0)
+	for i := 0; i < auditRecentEntries+10; i++ {
+		l.record(auditEntry{Path: fmt.Sprintf("/v1/%d", i)})
+	}
+	entries := l.entries()
+	c.Assert(entries, HasLen, auditRecentEntries)
+	c.Check(entries[0].Path, Equals, "/v1/10")
+	c.Check(entries[auditRecentEntries-1].Path, Equals, fmt.Sprintf("/v1/%d", auditRecentEntries+9))
+}
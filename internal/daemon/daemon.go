@@ -25,6 +25,8 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"path"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
@@ -40,13 +42,18 @@ import (
 	"github.com/canonical/pebble/internal/osutil/sys"
 	"github.com/canonical/pebble/internal/overlord"
 	"github.com/canonical/pebble/internal/overlord/restart"
+	"github.com/canonical/pebble/internal/overlord/servstate"
 	"github.com/canonical/pebble/internal/overlord/standby"
 	"github.com/canonical/pebble/internal/overlord/state"
+	"github.com/canonical/pebble/internal/reaper"
+	"github.com/canonical/pebble/internal/secrets"
 	"github.com/canonical/pebble/internal/systemd"
+	"github.com/canonical/pebble/internal/tracing"
 )
 
 var (
 	ErrRestartSocket = fmt.Errorf("daemon stop requested to wait for socket activation")
+	ErrReexec        = fmt.Errorf("daemon stop requested to re-execute itself")
 
 	systemdSdNotify = systemd.SdNotify
 	sysGetuid       = sys.Getuid
@@ -65,6 +72,80 @@ type Options struct {
 	// ServiceOuput is an optional io.Writer for the service log output, if set, all services
 	// log output will be written to the writer.
 	ServiceOutput io.Writer
+
+	// PruneWait is how long ready changes are kept before being pruned from
+	// the state. Defaults to 24 hours.
+	PruneWait time.Duration
+
+	// PruneMaxChanges is the maximum number of ready changes kept in the
+	// state; older ones are pruned even if they are more recent than
+	// PruneWait. Defaults to 500.
+	PruneMaxChanges int
+
+	// ShutdownGracePeriod is how long Drain waits for in-progress changes
+	// to finish, and then for services to stop. Defaults to 30 seconds.
+	ShutdownGracePeriod time.Duration
+
+	// WatchdogInterval is how often the ensure loop sends WATCHDOG=1 to
+	// systemd. Zero (the default) means no watchdog notifications are sent.
+	WatchdogInterval time.Duration
+
+	// RateLimit is the number of API requests per second allowed from each
+	// client (identified by its uid). Zero (the default) means no limit.
+	RateLimit float64
+
+	// RateBurst is the number of requests a client can make in a burst
+	// before being limited to RateLimit. Defaults to RateLimit.
+	RateBurst int
+
+	// ReadOnly, if true, rejects all API requests that may change state
+	// (anything but GET), so that the API can only be used for inspection.
+	ReadOnly bool
+
+	// MaxExecs is the maximum number of commands started by the exec API
+	// that may be running at once. Further exec requests are rejected with
+	// a "too-many-execs" error until one finishes. Zero (the default)
+	// means no limit.
+	MaxExecs int
+
+	// CompressState, if true, writes the state file gzip-compressed, to
+	// save space when it holds a long history of changes and notices.
+	CompressState bool
+
+	// HTTPAddress is an optional TCP address (for example ":4000") to
+	// serve the HTTPOK endpoints on, such as /v1/health, without any
+	// authentication. This lets HTTP probes that can't use a Unix socket,
+	// like Kubernetes', query the daemon.
+	HTTPAddress string
+
+	// Pprof, if true, serves the net/http/pprof runtime profiles under
+	// /v1/debug/pprof/ (to admin users only), for diagnosing performance
+	// issues.
+	Pprof bool
+
+	// TracingEndpoint is an optional OTLP/HTTP traces endpoint (for example
+	// "http://localhost:4318/v1/traces") to export a span to for each API
+	// request, change and task.
+	TracingEndpoint string
+
+	// TracingServiceName is the service name spans are exported with.
+	// Defaults to "pebble".
+	TracingServiceName string
+
+	// SecretsDir is an optional directory that "secret://<name>" references
+	// in service environment values are read from, as the file <name>.
+	// Secrets are also read from PEBBLE_SECRET_<NAME> environment variables.
+	SecretsDir string
+
+	// HostEnv lists the patterns (such as "AWS_*") of the daemon's
+	// environment variables that service environment values may refer to as
+	// "${HOST:NAME}". By default, none may be referred to.
+	HostEnv []string
+
+	// LayersDirs are extra directories of drop-in layers, combined in order
+	// after the layers in the "layers" and "layers.d" sub-directories of
+	// Dir. Directories that don't exist are skipped.
+	LayersDirs []string
 }
 
 // A Daemon listens for requests and routes them to the right command
@@ -78,11 +159,21 @@ type Daemon struct {
 	state               *state.State
 	generalListener     net.Listener
 	untrustedListener   net.Listener
+	httpAddress         string
+	httpListener        net.Listener
 	connTracker         *connTracker
 	serve               *http.Server
 	tomb                tomb.Tomb
 	router              *mux.Router
 	standbyOpinions     *standby.StandbyOpinions
+	events              *eventHub
+	rateLimiter         *rateLimiter
+	readOnly            bool
+	maxExecs            int
+	pprof               bool
+	auditLog            *auditLog
+	tracer              *tracer
+	traceExporter       *tracing.Exporter
 
 	// set to remember we need to restart the system
 	restartSystem bool
@@ -91,11 +182,19 @@ type Daemon struct {
 	// prevents systemd from restarting it
 	restartSocket bool
 
+	// set to remember that the daemon should re-execute itself, leaving
+	// services running
+	reexec bool
+
 	// degradedErr is set when the daemon is in degraded mode
 	degradedErr error
 
 	rebootIsMissing bool
 
+	// draining is set once Drain is called, to reject mutating requests
+	draining            bool
+	shutdownGracePeriod time.Duration
+
 	mu sync.Mutex
 }
 
@@ -117,6 +216,7 @@ type Command struct {
 	GuestOK     bool
 	UserOK      bool
 	UntrustedOK bool
+	HTTPOK      bool
 	AdminOnly   bool
 
 	d *Daemon
@@ -141,11 +241,19 @@ const (
 // - UserOK: any uid on the local system can access GET
 // - AdminOnly: only the administrator can access this
 // - UntrustedOK: can access this via the untrusted socket
+// - HTTPOK: anyone can access GET via the (unauthenticated) HTTP listener
 func (c *Command) canAccess(r *http.Request, user *userState) accessResult {
-	if c.AdminOnly && (c.UserOK || c.GuestOK || c.UntrustedOK) {
+	if c.AdminOnly && (c.UserOK || c.GuestOK || c.UntrustedOK || c.HTTPOK) {
 		logger.Panicf("internal error: command cannot have AdminOnly together with any *OK flag")
 	}
 
+	if isHTTPRequest(r) {
+		if c.HTTPOK && r.Method == "GET" {
+			return accessOK
+		}
+		return accessUnauthorized
+	}
+
 	if user != nil && !c.AdminOnly {
 		// Authenticated users do anything not requiring explicit admin.
 		return accessOK
@@ -202,11 +310,66 @@ func (c *Command) canAccess(r *http.Request, user *userState) accessResult {
 	return accessUnauthorized
 }
 
+// httpListener wraps the HTTP listener so that connections accepted on it,
+// and therefore requests received on it, can be identified.
+type httpListener struct {
+	net.Listener
+}
+
+type httpConn struct {
+	net.Conn
+}
+
+func (l *httpListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &httpConn{conn}, nil
+}
+
+type httpRequestKey struct{}
+
+// connContext marks the context of requests received on the HTTP listener.
+func connContext(ctx context.Context, conn net.Conn) context.Context {
+	if _, ok := conn.(*httpConn); ok {
+		return context.WithValue(ctx, httpRequestKey{}, true)
+	}
+	return ctx
+}
+
+// isHTTPRequest reports whether the request was received on the HTTP
+// listener, rather than on one of the Unix sockets.
+func isHTTPRequest(r *http.Request) bool {
+	return r.Context().Value(httpRequestKey{}) != nil
+}
+
 func userFromRequest(state interface{}, r *http.Request) (*userState, error) {
 	return nil, nil
 }
 
 func (c *Command) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Record every request that may mutate state, along with its outcome.
+	if r.Method != "GET" {
+		ww := &wrappedWriter{w: w}
+		w = ww
+		defer func() {
+			c.d.auditLog.record(newAuditEntry(r, ww.status(), time.Now()))
+		}()
+	}
+
+	// Record a span for the request, linked to the change it makes (if any).
+	var span *tracing.Span
+	var changeID string
+	if c.d.tracer != nil {
+		ww := &wrappedWriter{w: w}
+		w = ww
+		span = c.d.tracer.startRequest(c, r)
+		defer func() {
+			c.d.tracer.endRequest(span, ww.status(), changeID)
+		}()
+	}
+
 	st := c.d.state
 	st.Lock()
 	user, err := userFromRequest(st, r)
@@ -216,12 +379,38 @@ func (c *Command) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	st.Unlock()
 
+	if c.d.rateLimiter != nil {
+		ok, retryAfter := c.d.rateLimiter.allow(rateLimitKey(r), time.Now())
+		if !ok {
+			rateLimitedResponse{retryAfter}.ServeHTTP(w, r)
+			return
+		}
+	}
+
 	// check if we are in degradedMode
 	if c.d.degradedErr != nil && r.Method != "GET" {
 		statusInternalError(c.d.degradedErr.Error()).ServeHTTP(w, r)
 		return
 	}
 
+	c.d.mu.Lock()
+	draining := c.d.draining
+	c.d.mu.Unlock()
+	if draining && r.Method != "GET" {
+		statusServiceUnavailable("daemon is shutting down").ServeHTTP(w, r)
+		return
+	}
+
+	if c.d.readOnly && r.Method != "GET" {
+		rsp := &resp{
+			Type:   ResponseTypeError,
+			Result: &errorResult{Kind: errorKindReadOnly, Message: "daemon is in read-only mode"},
+			Status: 403,
+		}
+		rsp.ServeHTTP(w, r)
+		return
+	}
+
 	switch c.canAccess(r, user) {
 	case accessOK:
 		// nothing
@@ -252,6 +441,10 @@ func (c *Command) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if rsp, ok := rsp.(*resp); ok {
+		if span != nil && rsp.Change != "" {
+			changeID = rsp.Change
+			c.d.tracer.linkChange(changeID, span.Context)
+		}
 		st.Lock()
 		_, rst := restart.Pending(st)
 		st.Unlock()
@@ -360,6 +553,15 @@ func (d *Daemon) Init() error {
 		logger.Debugf("cannot get listener for %q: %v", d.untrustedSocketPath, err)
 	}
 
+	if d.httpAddress != "" {
+		listener, err := net.Listen("tcp", d.httpAddress)
+		if err != nil {
+			return fmt.Errorf("cannot listen on %s: %v", d.httpAddress, err)
+		}
+		d.httpListener = &httpListener{Listener: listener}
+		logger.Noticef("Serving HTTP API on %s", listener.Addr())
+	}
+
 	d.addRoutes()
 
 	logger.Noticef("Started daemon.")
@@ -449,8 +651,9 @@ func (d *Daemon) Start() {
 
 	d.connTracker = &connTracker{conns: make(map[net.Conn]struct{})}
 	d.serve = &http.Server{
-		Handler:   logit(d.router),
-		ConnState: d.connTracker.trackConn,
+		Handler:     logit(d.router),
+		ConnState:   d.connTracker.trackConn,
+		ConnContext: connContext,
 	}
 
 	d.initStandbyHandling()
@@ -466,14 +669,46 @@ func (d *Daemon) Start() {
 				return nil
 			})
 		}
+		if d.httpListener != nil {
+			d.tomb.Go(func() error {
+				if err := d.serve.Serve(d.httpListener); err != http.ErrServerClosed && d.tomb.Err() == tomb.ErrStillAlive {
+					return err
+				}
+				return nil
+			})
+		}
 		if err := d.serve.Serve(d.generalListener); err != http.ErrServerClosed && d.tomb.Err() == tomb.ErrStillAlive {
 			return err
 		}
 		return nil
 	})
+}
 
-	// notify systemd that we are ready
-	systemdSdNotify("READY=1")
+// NotifyReady tells systemd that the daemon is ready, once the API is being
+// served (after Start) and the change with the given ID, typically the one
+// starting the default services, is ready. If changeID is empty, systemd is
+// notified straight away.
+func (d *Daemon) NotifyReady(changeID string) {
+	var ready <-chan struct{}
+	if changeID != "" && d.overlord != nil {
+		d.state.Lock()
+		chg := d.state.Change(changeID)
+		d.state.Unlock()
+		if chg != nil {
+			ready = chg.Ready()
+		}
+	}
+	if ready == nil {
+		systemdSdNotify("READY=1")
+		return
+	}
+	go func() {
+		select {
+		case <-ready:
+			systemdSdNotify("READY=1")
+		case <-d.tomb.Dying():
+		}
+	}()
 }
 
 // HandleRestart implements overlord.RestartBehavior.
@@ -511,6 +746,99 @@ var (
 
 var shutdownTimeout = 25 * time.Second
 
+var defaultShutdownGracePeriod = 30 * time.Second
+
+// Drain prepares the daemon for a graceful shutdown: it stops accepting
+// mutating API requests, waits (up to the shutdown grace period) for
+// in-progress changes to finish, and then stops all running services in
+// reverse dependency order. It should be called before Stop.
+func (d *Daemon) Drain() error {
+	if d.overlord == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	d.draining = true
+	gracePeriod := d.shutdownGracePeriod
+	d.mu.Unlock()
+	if gracePeriod <= 0 {
+		gracePeriod = defaultShutdownGracePeriod
+	}
+
+	// No new changes can be made while draining, so wait for the ones in
+	// progress now.
+	st := d.overlord.State()
+	st.Lock()
+	var pending []*state.Change
+	for _, chg := range st.Changes() {
+		if !chg.IsReady() {
+			pending = append(pending, chg)
+		}
+	}
+	st.Unlock()
+	timeout := time.NewTimer(gracePeriod)
+	defer timeout.Stop()
+waitChanges:
+	for i, chg := range pending {
+		select {
+		case <-chg.Ready():
+		case <-timeout.C:
+			logger.Noticef("Timed out waiting for %d change(s) to finish before shutdown", len(pending)-i)
+			break waitChanges
+		}
+	}
+
+	servmgr := d.overlord.ServiceManager()
+	services, err := servmgr.Services(nil)
+	if err != nil {
+		return err
+	}
+	var running []string
+	for _, svc := range services {
+		if svc.Current == servstate.StatusActive || svc.Current == servstate.StatusBackoff {
+			running = append(running, svc.Name)
+		}
+	}
+	if len(running) == 0 {
+		return nil
+	}
+	stopOrder, err := servmgr.StopOrder(running)
+	if err != nil {
+		return err
+	}
+	// StopOrder includes dependents that may not be running; stopping
+	// those is a no-op.
+
+	st.Lock()
+	taskSet, err := serviceStopTasks(st, servmgr, stopOrder)
+	if err != nil {
+		st.Unlock()
+		return err
+	}
+	chg := newChange(st, "stop", "Stop service(s) for shutdown", []*state.TaskSet{taskSet}, stopOrder)
+	st.EnsureBefore(0)
+	st.Unlock()
+
+	select {
+	case <-chg.Ready():
+	case <-time.After(gracePeriod):
+		return fmt.Errorf("timed out waiting for services to stop")
+	}
+	st.Lock()
+	defer st.Unlock()
+	return chg.Err()
+}
+
+// Reexec asks the daemon to stop and re-execute itself (for example, after
+// its binary has been updated). Running services are left running and are
+// adopted by the new daemon process. See ErrReexec.
+func (d *Daemon) Reexec() {
+	d.mu.Lock()
+	d.reexec = true
+	d.mu.Unlock()
+	d.tomb.Kill(nil)
+}
+
 // Stop shuts down the Daemon.
 func (d *Daemon) Stop(sigCh chan<- os.Signal) error {
 	if d.rebootIsMissing {
@@ -526,6 +854,7 @@ func (d *Daemon) Stop(sigCh chan<- os.Signal) error {
 	d.mu.Lock()
 	restartSystem := d.restartSystem
 	restartSocket := d.restartSocket
+	reexec := d.reexec
 	d.mu.Unlock()
 
 	d.generalListener.Close()
@@ -535,6 +864,10 @@ func (d *Daemon) Stop(sigCh chan<- os.Signal) error {
 		d.untrustedListener.Close()
 	}
 
+	if d.httpListener != nil {
+		d.httpListener.Close()
+	}
+
 	if restartSystem {
 		// give time to polling clients to notice restart
 		time.Sleep(rebootNoticeWait)
@@ -547,7 +880,10 @@ func (d *Daemon) Stop(sigCh chan<- os.Signal) error {
 	d.tomb.Kill(d.serve.Shutdown(ctx))
 	cancel()
 
-	if !restartSystem {
+	if reexec {
+		// the new process will notify systemd when it's ready
+		systemdSdNotify("RELOADING=1")
+	} else if !restartSystem {
 		// tell systemd that we are stopping
 		systemdSdNotify("STOPPING=1")
 	}
@@ -568,6 +904,10 @@ func (d *Daemon) Stop(sigCh chan<- os.Signal) error {
 	d.overlord.Stop()
 
 	err := d.tomb.Wait()
+	d.auditLog.close()
+	if d.traceExporter != nil {
+		d.traceExporter.Stop()
+	}
 	if err != nil {
 		// do not stop the shutdown even if the tomb errors
 		// because we already scheduled a slow shutdown and
@@ -588,6 +928,14 @@ func (d *Daemon) Stop(sigCh chan<- os.Signal) error {
 		return ErrRestartSocket
 	}
 
+	if reexec {
+		err := d.overlord.ServiceManager().PrepareReexec()
+		if err != nil {
+			return fmt.Errorf("cannot prepare to re-execute: %w", err)
+		}
+		return ErrReexec
+	}
+
 	return nil
 }
 
@@ -650,7 +998,7 @@ func rebootImpl(rebootDelay time.Duration) error {
 	}
 	mins := int64(rebootDelay / time.Minute)
 	cmd := exec.Command("shutdown", "-r", fmt.Sprintf("+%d", mins), shutdownMsg)
-	if out, err := cmd.CombinedOutput(); err != nil {
+	if out, err := reaper.CommandCombinedOutput(cmd); err != nil {
 		return osutil.OutputErr(out, err)
 	}
 	return nil
@@ -701,11 +1049,22 @@ func (d *Daemon) RebootIsMissing(st *state.State) error {
 	return errExpectedReboot
 }
 
+// newSecretsProvider returns the provider for service secrets: the files in
+// dir (if set), and then the daemon's PEBBLE_SECRET_* environment variables.
+func newSecretsProvider(dir string) secrets.Provider {
+	var chain secrets.Chain
+	if dir != "" {
+		chain = append(chain, secrets.Dir(dir))
+	}
+	return append(chain, secrets.Env(secrets.EnvPrefix))
+}
+
 func New(opts *Options) (*Daemon, error) {
 	d := &Daemon{
 		pebbleDir:           opts.Dir,
 		normalSocketPath:    opts.SocketPath,
 		untrustedSocketPath: opts.SocketPath + ".untrusted",
+		httpAddress:         opts.HTTPAddress,
 	}
 
 	ovld, err := overlord.New(opts.Dir, d, opts.ServiceOutput)
@@ -720,8 +1079,54 @@ func New(opts *Options) (*Daemon, error) {
 	if err != nil {
 		return nil, err
 	}
+	ovld.SetPruneLimits(opts.PruneWait, opts.PruneMaxChanges)
+	ovld.SetCompressState(opts.CompressState)
+	if opts.WatchdogInterval > 0 {
+		ovld.SetWatchdog(opts.WatchdogInterval, func() { systemdSdNotify("WATCHDOG=1") })
+	}
+	d.shutdownGracePeriod = opts.ShutdownGracePeriod
+	d.readOnly = opts.ReadOnly
+	if d.readOnly {
+		logger.Noticef("API is read-only: rejecting requests that change state")
+	}
+	d.maxExecs = opts.MaxExecs
+	if d.maxExecs > 0 {
+		logger.Noticef("Limiting exec commands to %d running at once", d.maxExecs)
+	}
+	d.pprof = opts.Pprof
+	ovld.ServiceManager().SetSecrets(newSecretsProvider(opts.SecretsDir))
+	for _, pattern := range opts.HostEnv {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid host environment pattern %q", pattern)
+		}
+	}
+	ovld.ServiceManager().SetHostEnv(opts.HostEnv)
+	if len(opts.LayersDirs) > 0 {
+		ovld.ServiceManager().SetDropInDirs(opts.LayersDirs)
+	}
+	d.rateLimiter = newRateLimiter(opts.RateLimit, opts.RateBurst)
+	if d.rateLimiter != nil {
+		logger.Noticef("Limiting API requests from each client to %g per second (burst %g)",
+			d.rateLimiter.rate, d.rateLimiter.burst)
+	}
+	d.auditLog, err = openAuditLog(filepath.Join(opts.Dir, ".pebble.audit"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot open audit log: %w", err)
+	}
 	d.overlord = ovld
 	d.state = ovld.State()
+	d.events = newEventHub()
+	d.events.watch(d.state, ovld.ServiceManager())
+	if opts.TracingEndpoint != "" {
+		serviceName := opts.TracingServiceName
+		if serviceName == "" {
+			serviceName = "pebble"
+		}
+		d.traceExporter = tracing.NewExporter(opts.TracingEndpoint, serviceName)
+		d.tracer = newTracer(d.traceExporter)
+		d.tracer.watch(d.state)
+		logger.Noticef("Exporting traces to %s", opts.TracingEndpoint)
+	}
 	return d, nil
 }
 
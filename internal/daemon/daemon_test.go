@@ -15,6 +15,7 @@
 package daemon
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -23,6 +24,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 	"testing"
@@ -31,6 +33,7 @@ import (
 	"github.com/gorilla/mux"
 
 	"gopkg.in/check.v1"
+	"gopkg.in/tomb.v2"
 
 	// XXX Delete import above and make this file like the other ones.
 	. "gopkg.in/check.v1"
@@ -38,6 +41,7 @@ import (
 	"github.com/canonical/pebble/internal/osutil"
 	"github.com/canonical/pebble/internal/overlord/patch"
 	"github.com/canonical/pebble/internal/overlord/restart"
+	"github.com/canonical/pebble/internal/overlord/servstate"
 	"github.com/canonical/pebble/internal/overlord/standby"
 	"github.com/canonical/pebble/internal/overlord/state"
 	"github.com/canonical/pebble/internal/systemd"
@@ -301,6 +305,86 @@ func (s *daemonSuite) TestUntrustedAccessUntrustedOKWithRoot(c *check.C) {
 	c.Check(cmd.canAccess(del, nil), check.Equals, accessOK)
 }
 
+func (s *daemonSuite) TestUntrustedSocketAPI(c *check.C) {
+	d := s.newDaemon(c)
+
+	// Only health, metrics and notices are available on the untrusted socket.
+	remoteAddr := "pid=100;uid=1000;socket=" + d.untrustedSocketPath + ";"
+	var available []string
+	for _, cmd := range api {
+		cmd.d = d
+		req := &http.Request{Method: "GET", RemoteAddr: remoteAddr}
+		if cmd.canAccess(req, nil) == accessOK {
+			available = append(available, cmd.Path)
+		}
+	}
+	c.Check(available, check.DeepEquals, []string{"/v1/health", "/v1/metrics", "/v1/notices", "/v1/notices/{id}"})
+}
+
+func (s *daemonSuite) TestHTTPAccess(c *check.C) {
+	d := s.newDaemon(c)
+
+	ctx := context.WithValue(context.Background(), httpRequestKey{}, true)
+	get := (&http.Request{Method: "GET"}).WithContext(ctx)
+	put := (&http.Request{Method: "PUT"}).WithContext(ctx)
+
+	cmd := &Command{d: d, HTTPOK: true}
+	c.Check(cmd.canAccess(get, nil), check.Equals, accessOK)
+	c.Check(cmd.canAccess(put, nil), check.Equals, accessUnauthorized)
+
+	// Guest access doesn't extend to the HTTP listener.
+	cmd = &Command{d: d, GuestOK: true}
+	c.Check(cmd.canAccess(get, nil), check.Equals, accessUnauthorized)
+
+	// Only health and metrics are available on the HTTP listener.
+	var available []string
+	for _, cmd := range api {
+		cmd.d = d
+		if cmd.canAccess(get, nil) == accessOK {
+			available = append(available, cmd.Path)
+		}
+	}
+	c.Check(available, check.DeepEquals, []string{"/v1/health", "/v1/metrics"})
+}
+
+func (s *daemonSuite) TestHTTPListener(c *check.C) {
+	writeTestLayer(s.pebbleDir, `
+checks:
+    chk1:
+        override: replace
+        period: 10s
+        exec:
+            command: "true"
+`)
+	s.socketPath = filepath.Join(c.MkDir(), "pebble.socket")
+	d, err := New(&Options{Dir: s.pebbleDir, SocketPath: s.socketPath, HTTPAddress: "127.0.0.1:0"})
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Init(), check.IsNil)
+	d.Start()
+	defer d.Stop(nil)
+
+	url := "http://" + d.httpListener.Addr().String()
+	rsp, err := http.Get(url + "/v1/health?names=chk1")
+	c.Assert(err, check.IsNil)
+	rsp.Body.Close()
+	c.Check(rsp.StatusCode, check.Equals, 200)
+
+	rsp, err = http.Get(url + "/v1/health?names=chk2")
+	c.Assert(err, check.IsNil)
+	rsp.Body.Close()
+	c.Check(rsp.StatusCode, check.Equals, 404)
+
+	rsp, err = http.Get(url + "/v1/services")
+	c.Assert(err, check.IsNil)
+	rsp.Body.Close()
+	c.Check(rsp.StatusCode, check.Equals, 401)
+
+	rsp, err = http.Post(url+"/v1/services", "application/json", strings.NewReader(`{"action": "start", "services": ["foo"]}`))
+	c.Assert(err, check.IsNil)
+	rsp.Body.Close()
+	c.Check(rsp.StatusCode, check.Equals, 401)
+}
+
 func (s *daemonSuite) TestUserAccess(c *check.C) {
 	d := s.newDaemon(c)
 
@@ -629,6 +713,7 @@ func (s *daemonSuite) TestRestartSystemWiring(c *check.C) {
 	d.untrustedListener = &witnessAcceptListener{Listener: l, accept: untrustedAccept}
 
 	d.Start()
+	d.NotifyReady("")
 	defer d.Stop(nil)
 
 	st := d.overlord.State()
@@ -1047,3 +1132,249 @@ func (s *daemonSuite) TestDegradedModeReply(c *check.C) {
 	rec = doTestReq(c, cmd, "POST")
 	c.Check(rec.Code, check.Equals, 200)
 }
+
+func (s *daemonSuite) TestReadOnlyReply(c *check.C) {
+	d, err := New(&Options{Dir: s.pebbleDir, SocketPath: s.socketPath, ReadOnly: true})
+	c.Assert(err, check.IsNil)
+	cmd := &Command{d: d}
+	cmd.GET = func(*Command, *http.Request, *userState) Response {
+		return SyncResponse(nil)
+	}
+	cmd.POST = func(*Command, *http.Request, *userState) Response {
+		return SyncResponse(nil)
+	}
+
+	rec := doTestReq(c, cmd, "GET")
+	c.Check(rec.Code, check.Equals, 200)
+	rec = doTestReq(c, cmd, "POST")
+	c.Check(rec.Code, check.Equals, 403)
+	var v struct{ Result errorResult }
+	c.Assert(json.NewDecoder(rec.Body).Decode(&v), check.IsNil)
+	c.Check(v.Result, check.DeepEquals, errorResult{
+		Message: "daemon is in read-only mode",
+		Kind:    errorKindReadOnly,
+	})
+}
+
+func (s *daemonSuite) TestDrain(c *check.C) {
+	writeTestLayer(s.pebbleDir, `
+services:
+    test1:
+        override: replace
+        command: sleep 10
+`)
+	s.socketPath = filepath.Join(c.MkDir(), "pebble.socket")
+	d, err := New(&Options{Dir: s.pebbleDir, SocketPath: s.socketPath, ShutdownGracePeriod: 5 * time.Second})
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Init(), check.IsNil)
+	d.Start()
+	defer d.Stop(nil)
+
+	// Start the service and wait for it to be running.
+	st := d.overlord.State()
+	st.Lock()
+	taskSet, err := servstate.Start(st, []string{"test1"}, nil)
+	c.Assert(err, check.IsNil)
+	chg := newChange(st, "start", "Start test1", []*state.TaskSet{taskSet}, []string{"test1"})
+	st.EnsureBefore(0)
+	st.Unlock()
+	select {
+	case <-chg.Ready():
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for service to start")
+	}
+	st.Lock()
+	c.Assert(chg.Err(), check.IsNil)
+	st.Unlock()
+
+	err = d.Drain()
+	c.Assert(err, check.IsNil)
+
+	services, err := d.overlord.ServiceManager().Services(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(services, check.HasLen, 1)
+	c.Check(services[0].Current, check.Equals, servstate.StatusInactive)
+
+	// Mutating requests are rejected while draining, but GET still works.
+	cmd := &Command{d: d}
+	cmd.GET = func(*Command, *http.Request, *userState) Response {
+		return SyncResponse(nil)
+	}
+	cmd.POST = func(*Command, *http.Request, *userState) Response {
+		return SyncResponse(nil)
+	}
+	rec := doTestReq(c, cmd, "GET")
+	c.Check(rec.Code, check.Equals, 200)
+	rec = doTestReq(c, cmd, "POST")
+	c.Check(rec.Code, check.Equals, 503)
+}
+
+func (s *daemonSuite) TestDrainWaitsForChanges(c *check.C) {
+	s.socketPath = filepath.Join(c.MkDir(), "pebble.socket")
+	d, err := New(&Options{Dir: s.pebbleDir, SocketPath: s.socketPath, ShutdownGracePeriod: 10 * time.Second})
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Init(), check.IsNil)
+	d.Start()
+	defer d.Stop(nil)
+
+	release := make(chan struct{})
+	d.overlord.TaskRunner().AddHandler("foo-test", func(t *state.Task, tomb *tomb.Tomb) error {
+		<-release
+		return nil
+	}, nil)
+	st := d.overlord.State()
+	st.Lock()
+	chg := st.NewChange("foo", "Foo change")
+	chg.AddTask(st.NewTask("foo-test", "Foo task"))
+	st.EnsureBefore(0)
+	st.Unlock()
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- d.Drain()
+	}()
+	select {
+	case <-drained:
+		c.Fatal("drain finished before the change was ready")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Drain finishes as soon as the change is ready.
+	close(release)
+	select {
+	case err := <-drained:
+		c.Assert(err, check.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for drain to finish")
+	}
+}
+
+func (s *daemonSuite) TestDrainTimeout(c *check.C) {
+	s.socketPath = filepath.Join(c.MkDir(), "pebble.socket")
+	d, err := New(&Options{Dir: s.pebbleDir, SocketPath: s.socketPath, ShutdownGracePeriod: 50 * time.Millisecond})
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Init(), check.IsNil)
+	d.Start()
+	defer d.Stop(nil)
+
+	release := make(chan struct{})
+	defer close(release)
+	d.overlord.TaskRunner().AddHandler("foo-test", func(t *state.Task, tomb *tomb.Tomb) error {
+		<-release
+		return nil
+	}, nil)
+	st := d.overlord.State()
+	st.Lock()
+	chg := st.NewChange("foo", "Foo change")
+	chg.AddTask(st.NewTask("foo-test", "Foo task"))
+	st.EnsureBefore(0)
+	st.Unlock()
+
+	// The change doesn't become ready, so drain gives up after the grace
+	// period.
+	err = d.Drain()
+	c.Assert(err, check.IsNil)
+	st.Lock()
+	c.Check(chg.IsReady(), check.Equals, false)
+	st.Unlock()
+}
+
+func (s *daemonSuite) TestReexec(c *check.C) {
+	writeTestLayer(s.pebbleDir, `
+services:
+    test1:
+        override: replace
+        command: sleep 10
+`)
+	s.socketPath = filepath.Join(c.MkDir(), "pebble.socket")
+	d, err := New(&Options{Dir: s.pebbleDir, SocketPath: s.socketPath})
+	c.Assert(err, check.IsNil)
+	c.Assert(d.Init(), check.IsNil)
+	d.Start()
+
+	st := d.overlord.State()
+	st.Lock()
+	taskSet, err := servstate.Start(st, []string{"test1"}, nil)
+	c.Assert(err, check.IsNil)
+	chg := newChange(st, "start", "Start test1", []*state.TaskSet{taskSet}, []string{"test1"})
+	st.EnsureBefore(0)
+	st.Unlock()
+	select {
+	case <-chg.Ready():
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for service to start")
+	}
+	st.Lock()
+	c.Assert(chg.Err(), check.IsNil)
+	st.Unlock()
+
+	d.Reexec()
+	select {
+	case <-d.Dying():
+	case <-time.After(time.Second):
+		c.Fatal("daemon did not start dying")
+	}
+	err = d.Stop(nil)
+	c.Assert(err, check.Equals, ErrReexec)
+
+	// The service is still running, and recorded for the new daemon to adopt.
+	var services []struct {
+		PID int `json:"pid"`
+	}
+	st.Lock()
+	err = st.Get("reexec-services", &services)
+	st.Unlock()
+	c.Assert(err, check.IsNil)
+	c.Assert(services, check.HasLen, 1)
+	c.Check(syscall.Kill(services[0].PID, 0), check.IsNil)
+	c.Check(syscall.Kill(-services[0].PID, syscall.SIGKILL), check.IsNil)
+}
+
+func (s *daemonSuite) TestNotifyReady(c *check.C) {
+	notified := make(chan string, 1)
+	systemdSdNotify = func(notif string) error {
+		notified <- notif
+		return nil
+	}
+
+	d := s.newDaemon(c)
+	c.Assert(d.Init(), check.IsNil)
+	d.Start()
+	defer d.Stop(nil)
+
+	// Not notified on Start, only once the given change is ready.
+	st := d.overlord.State()
+	st.Lock()
+	chg := st.NewChange("autostart", "Autostart")
+	st.Unlock()
+	d.NotifyReady(chg.ID())
+	select {
+	case notif := <-notified:
+		c.Fatalf("unexpected notification %q", notif)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	st.Lock()
+	chg.SetStatus(state.DoneStatus)
+	st.Unlock()
+	select {
+	case notif := <-notified:
+		c.Check(notif, check.Equals, "READY=1")
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for READY=1")
+	}
+
+	// Without a change, notify straight away.
+	d.NotifyReady("")
+	select {
+	case notif := <-notified:
+		c.Check(notif, check.Equals, "READY=1")
+	default:
+		c.Fatal("READY=1 not sent")
+	}
+}
+
+func (s *daemonSuite) TestInvalidHostEnvPattern(c *check.C) {
+	_, err := New(&Options{Dir: s.pebbleDir, SocketPath: s.socketPath, HostEnv: []string{"AWS_*", "[A-"}})
+	c.Assert(err, check.ErrorMatches, `invalid host environment pattern "\[A-"`)
+}
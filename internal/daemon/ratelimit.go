@@ -0,0 +1,132 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitPruneInterval is how often buckets that are full again (that is,
+// of clients that have been idle for a while) are forgotten.
+const rateLimitPruneInterval = time.Minute
+
+// rateLimiter is a token bucket rate limiter with a bucket per client
+// identity (peer uid, or remote host if there's no uid).
+type rateLimiter struct {
+	rate  float64 // tokens added per second
+	burst float64 // maximum tokens in a bucket
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a rate limiter that allows rate requests per
+// second, with bursts of up to burst requests. If burst is zero, it defaults
+// to rate (rounded up). It returns nil, meaning no limit, if rate is zero.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(rate))
+	}
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// allow reports whether a request from the client identified by key is
+// allowed at time now, and if not, how long until it would be.
+func (l *rateLimiter) allow(key string, now time.Time) (ok bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) >= rateLimitPruneInterval {
+		l.prune(now)
+		l.lastPrune = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	seconds := (1 - b.tokens) / l.rate
+	return false, time.Duration(seconds * float64(time.Second))
+}
+
+func (l *rateLimiter) refill(b *tokenBucket, now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+		b.last = now
+	}
+}
+
+func (l *rateLimiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimitKey returns the identity a request is rate limited by.
+func rateLimitKey(r *http.Request) string {
+	_, uid, _, err := ucrednetGet(r.RemoteAddr)
+	if err == nil {
+		return "uid:" + strconv.FormatUint(uint64(uid), 10)
+	}
+	// Limit by host, not port, as each connection uses a new port.
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
+
+// rateLimitedResponse is the 429 response to a request over the rate limit.
+type rateLimitedResponse struct {
+	retryAfter time.Duration
+}
+
+func (r rateLimitedResponse) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// Retry-After is in whole seconds, so round up.
+	seconds := int(math.Ceil(r.retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	statusTooManyRequests("too many requests, retry after %d second(s)", seconds).ServeHTTP(w, req)
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type rateLimitSuite struct{}
+
+var _ = Suite(&rateLimitSuite{})
+
+func (s *rateLimitSuite) TestDisabled(c *C) {
+	c.Check(newRateLimiter(0, 10), IsNil)
+}
+
+func (s *rateLimitSuite) TestAllow(c *C) {
+	l := newRateLimiter(2, 3)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// The burst is allowed straight away.
+	for i := 0; i < 3; i++ {
+		ok, _ := l.allow("uid:1000", now)
+		c.Check(ok, Equals, true)
+	}
+	ok, retryAfter := l.allow("uid:1000", now)
+	c.Check(ok, Equals, false)
+	c.Check(retryAfter, Equals, 500*time.Millisecond)
+
+	// Other clients have their own bucket.
+	ok, _ = l.allow("uid:0", now)
+	c.Check(ok, Equals, true)
+
+	// Tokens are added at the given rate.
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.allow("uid:1000", now)
+	c.Check(ok, Equals, true)
+	ok, _ = l.allow("uid:1000", now)
+	c.Check(ok, Equals, false)
+
+	// Idle clients are forgotten once their bucket is full again.
+	now = now.Add(rateLimitPruneInterval)
+	l.allow("uid:1001", now)
+	c.Check(l.buckets, HasLen, 1)
+}
+
+func (s *rateLimitSuite) TestDefaultBurst(c *C) {
+	l := newRateLimiter(2.5, 0)
+	c.Check(l.burst, Equals, 3.0)
+}
+
+func (s *rateLimitSuite) TestKey(c *C) {
+	req, err := http.NewRequest("GET", "/v1/system-info", nil)
+	c.Assert(err, IsNil)
+	req.RemoteAddr = "pid=100;uid=1000;socket=/tmp/foo;"
+	c.Check(rateLimitKey(req), Equals, "uid:1000")
+	req.RemoteAddr = "127.0.0.1:1234"
+	c.Check(rateLimitKey(req), Equals, "addr:127.0.0.1")
+	req.RemoteAddr = "127.0.0.1:5678"
+	c.Check(rateLimitKey(req), Equals, "addr:127.0.0.1")
+	req.RemoteAddr = "[::1]:1234"
+	c.Check(rateLimitKey(req), Equals, "addr:::1")
+}
+
+func (s *daemonSuite) TestRateLimitReply(c *C) {
+	d, err := New(&Options{Dir: s.pebbleDir, SocketPath: s.socketPath, RateLimit: 0.1, RateBurst: 2})
+	c.Assert(err, IsNil)
+	cmd := &Command{d: d}
+	cmd.GET = func(*Command, *http.Request, *userState) Response {
+		return SyncResponse(nil)
+	}
+
+	c.Check(doTestReq(c, cmd, "GET").Code, Equals, 200)
+	c.Check(doTestReq(c, cmd, "GET").Code, Equals, 200)
+	rec := doTestReq(c, cmd, "GET")
+	c.Check(rec.Code, Equals, 429)
+	c.Check(rec.Header().Get("Retry-After"), Equals, "10")
+	var v struct{ Result errorResult }
+	c.Assert(json.NewDecoder(rec.Body).Decode(&v), IsNil)
+	c.Check(v.Result, DeepEquals, errorResult{
+		Message: "too many requests, retry after 10 second(s)",
+		Kind:    errorKindRateLimited,
+	})
+
+	// A different client isn't limited.
+	req, err := http.NewRequest("GET", "", nil)
+	c.Assert(err, IsNil)
+	req.RemoteAddr = "pid=100;uid=1000;socket=;"
+	rec = httptest.NewRecorder()
+	cmd.UserOK = true
+	cmd.ServeHTTP(rec, req)
+	c.Check(rec.Code, Equals, 200)
+}
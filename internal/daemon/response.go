@@ -124,6 +124,9 @@ const (
 	errorKindNotFound          = errorKind("not-found")
 	errorKindPermissionDenied  = errorKind("permission-denied")
 	errorKindGenericFileError  = errorKind("generic-file-error")
+	errorKindRateLimited       = errorKind("rate-limited")
+	errorKindReadOnly          = errorKind("read-only")
+	errorKindTooManyExecs      = errorKind("too-many-execs")
 )
 
 type errorValue interface{}
@@ -177,8 +180,11 @@ func makeErrorResponder(status int) errorResponder {
 		} else {
 			res.Message = fmt.Sprintf(format, v...)
 		}
-		if status == 401 {
+		switch status {
+		case 401:
 			res.Kind = errorKindLoginRequired
+		case 429:
+			res.Kind = errorKindRateLimited
 		}
 		return &resp{
 			Type:   ResponseTypeError,
@@ -194,11 +200,13 @@ type errorResponder func(string, ...interface{}) Response
 
 // Standard error responses.
 var (
-	statusBadRequest       = makeErrorResponder(400)
-	statusUnauthorized     = makeErrorResponder(401)
-	statusForbidden        = makeErrorResponder(403)
-	statusNotFound         = makeErrorResponder(404)
-	statusMethodNotAllowed = makeErrorResponder(405)
-	statusInternalError    = makeErrorResponder(500)
-	statusGatewayTimeout   = makeErrorResponder(504)
+	statusBadRequest         = makeErrorResponder(400)
+	statusUnauthorized       = makeErrorResponder(401)
+	statusForbidden          = makeErrorResponder(403)
+	statusNotFound           = makeErrorResponder(404)
+	statusMethodNotAllowed   = makeErrorResponder(405)
+	statusTooManyRequests    = makeErrorResponder(429)
+	statusInternalError      = makeErrorResponder(500)
+	statusServiceUnavailable = makeErrorResponder(503)
+	statusGatewayTimeout     = makeErrorResponder(504)
 )
@@ -0,0 +1,229 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/canonical/pebble/internal/overlord/servstate"
+	"github.com/canonical/pebble/internal/overlord/state"
+	"github.com/canonical/pebble/internal/tracing"
+)
+
+// tracer records a span for each API request, change and task. A change's
+// span is a child of the request that made the change, and its tasks' spans
+// are children of the change's span.
+type tracer struct {
+	exporter spanExporter
+
+	mu      sync.Mutex
+	changes map[string]changeSpan
+}
+
+// changeSpan holds the IDs of the span of a change that isn't ready yet.
+type changeSpan struct {
+	context tracing.SpanContext
+	parent  tracing.SpanID
+}
+
+// spanExporter is implemented by *tracing.Exporter.
+type spanExporter interface {
+	Export(span *tracing.Span)
+}
+
+func newTracer(exporter spanExporter) *tracer {
+	return &tracer{
+		exporter: exporter,
+		changes:  make(map[string]changeSpan),
+	}
+}
+
+// changeSpan returns the IDs of the change's span, creating them (as the
+// root of a new trace) if needed.
+func (t *tracer) changeSpan(id string) changeSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span, ok := t.changes[id]
+	if !ok {
+		span = changeSpan{context: tracing.NewSpanContext(tracing.SpanContext{})}
+		t.changes[id] = span
+	}
+	return span
+}
+
+// linkChange makes the change's span a child of the request's span, unless
+// the change's span was already started by one of its tasks finishing.
+func (t *tracer) linkChange(id string, request tracing.SpanContext) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.changes[id]; !ok {
+		t.changes[id] = changeSpan{
+			context: tracing.NewSpanContext(request),
+			parent:  request.SpanID,
+		}
+	}
+}
+
+// startRequest starts the span for an API request, as a child of the
+// span in the request's "traceparent" header, if any.
+func (t *tracer) startRequest(c *Command, r *http.Request) *tracing.Span {
+	parent, _ := tracing.ParseTraceParent(r.Header.Get("traceparent"))
+	route := c.Path
+	if route == "" {
+		route = c.PathPrefix
+	}
+	return &tracing.Span{
+		Context: tracing.NewSpanContext(parent),
+		Parent:  parent.SpanID,
+		Name:    r.Method + " " + route,
+		Kind:    tracing.SpanKindServer,
+		Start:   time.Now(),
+		Attributes: []tracing.Attribute{
+			tracing.Attr("http.method", r.Method),
+			tracing.Attr("http.route", route),
+			tracing.Attr("http.target", r.URL.RequestURI()),
+		},
+	}
+}
+
+// endRequest ends and exports the span of an API request.
+func (t *tracer) endRequest(span *tracing.Span, status int, changeID string) {
+	span.End = time.Now()
+	span.Attributes = append(span.Attributes, tracing.Attr("http.status_code", status))
+	if changeID != "" {
+		span.Attributes = append(span.Attributes, tracing.Attr("pebble.change.id", changeID))
+	}
+	if status >= 500 {
+		span.Err = http.StatusText(status)
+	}
+	t.exporter.Export(span)
+}
+
+// watch registers handlers that record the spans of changes and tasks when
+// they're ready.
+func (t *tracer) watch(st *state.State) {
+	st.Lock()
+	defer st.Unlock()
+	st.AddChangeStatusChangedHandler(func(chg *state.Change, old, new state.Status) {
+		if new.Ready() && !old.Ready() {
+			t.changeReady(chg, new)
+		}
+	})
+	st.AddTaskStatusChangedHandler(func(task *state.Task, old, new state.Status) {
+		if new.Ready() && !old.Ready() {
+			t.taskReady(task, new)
+		}
+	})
+}
+
+func (t *tracer) changeReady(chg *state.Change, status state.Status) {
+	cs := t.changeSpan(chg.ID())
+	t.mu.Lock()
+	delete(t.changes, chg.ID())
+	t.mu.Unlock()
+
+	// The ready time is set just after the handlers are called.
+	end := chg.ReadyTime()
+	if end.IsZero() {
+		end = time.Now()
+	}
+	span := &tracing.Span{
+		Context: cs.context,
+		Parent:  cs.parent,
+		Name:    chg.Kind(),
+		Kind:    tracing.SpanKindInternal,
+		Start:   chg.SpawnTime(),
+		End:     end,
+		Attributes: []tracing.Attribute{
+			tracing.Attr("pebble.change.id", chg.ID()),
+			tracing.Attr("pebble.change.kind", chg.Kind()),
+			tracing.Attr("pebble.change.summary", chg.Summary()),
+			tracing.Attr("pebble.change.status", status.String()),
+		},
+	}
+	if services := changeServices(chg); len(services) > 0 {
+		span.Attributes = append(span.Attributes, tracing.Attr("pebble.services", services))
+	}
+	if err := chg.Err(); err != nil {
+		span.Err = err.Error()
+	}
+	t.exporter.Export(span)
+}
+
+func (t *tracer) taskReady(task *state.Task, status state.Status) {
+	chg := task.Change()
+	if chg == nil {
+		return
+	}
+	cs := t.changeSpan(chg.ID())
+	start := task.StartTime()
+	if start.IsZero() {
+		start = task.SpawnTime()
+	}
+	span := &tracing.Span{
+		Context: tracing.NewSpanContext(cs.context),
+		Parent:  cs.context.SpanID,
+		Name:    task.Kind(),
+		Kind:    tracing.SpanKindInternal,
+		Start:   start,
+		End:     task.ReadyTime(),
+		Attributes: []tracing.Attribute{
+			tracing.Attr("pebble.task.id", task.ID()),
+			tracing.Attr("pebble.task.kind", task.Kind()),
+			tracing.Attr("pebble.task.summary", task.Summary()),
+			tracing.Attr("pebble.task.status", status.String()),
+			tracing.Attr("pebble.change.id", chg.ID()),
+		},
+	}
+	if req, err := servstate.TaskServiceRequest(task); err == nil {
+		span.Attributes = append(span.Attributes, tracing.Attr("pebble.service", req.Name))
+	}
+	if status == state.ErrorStatus {
+		span.Err = taskError(task)
+	}
+	t.exporter.Export(span)
+}
+
+// changeServices returns the names of the services the change's tasks act on.
+func changeServices(chg *state.Change) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, task := range chg.Tasks() {
+		req, err := servstate.TaskServiceRequest(task)
+		if err != nil || seen[req.Name] {
+			continue
+		}
+		seen[req.Name] = true
+		names = append(names, req.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// taskError returns the last error logged by the task.
+func taskError(task *state.Task) string {
+	log := task.Log()
+	prefix := " " + state.LogError + " "
+	for i := len(log) - 1; i >= 0; i-- {
+		if j := strings.Index(log[i], prefix); j >= 0 {
+			return log[i][j+len(prefix):]
+		}
+	}
+	return "task failed"
+}
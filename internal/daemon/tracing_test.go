@@ -0,0 +1,139 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package daemon
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/overlord/state"
+	"github.com/canonical/pebble/internal/tracing"
+)
+
+type fakeSpanExporter struct {
+	spans []*tracing.Span
+}
+
+func (e *fakeSpanExporter) Export(span *tracing.Span) {
+	e.spans = append(e.spans, span)
+}
+
+func spanAttributes(span *tracing.Span) map[string]interface{} {
+	attrs := make(map[string]interface{})
+	for _, attr := range span.Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+	return attrs
+}
+
+func (s *daemonSuite) TestTracing(c *C) {
+	d := s.newDaemon(c)
+	exporter := &fakeSpanExporter{}
+	d.tracer = newTracer(exporter)
+	d.tracer.watch(d.state)
+
+	st := d.state
+	st.Lock()
+	chg := st.NewChange("foo", "Do foo")
+	t1 := st.NewTask("bar", "Do bar")
+	t2 := st.NewTask("baz", "Do baz")
+	chg.AddTask(t1)
+	chg.AddTask(t2)
+	st.Unlock()
+
+	cmd := &Command{d: d, Path: "/v1/foo"}
+	cmd.POST = func(*Command, *http.Request, *userState) Response {
+		return AsyncResponse(nil, chg.ID())
+	}
+	req, err := http.NewRequest("POST", "/v1/foo?x=1", nil)
+	c.Assert(err, IsNil)
+	req.RemoteAddr = "pid=100;uid=0;socket=;"
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	cmd.ServeHTTP(httptest.NewRecorder(), req)
+
+	c.Assert(exporter.spans, HasLen, 1)
+	reqSpan := exporter.spans[0]
+	c.Check(reqSpan.Name, Equals, "POST /v1/foo")
+	c.Check(reqSpan.Kind, Equals, tracing.SpanKindServer)
+	c.Check(reqSpan.Context.TraceID.String(), Equals, "4bf92f3577b34da6a3ce929d0e0e4736")
+	c.Check(reqSpan.Parent.String(), Equals, "00f067aa0ba902b7")
+	c.Check(reqSpan.Err, Equals, "")
+	c.Check(spanAttributes(reqSpan), DeepEquals, map[string]interface{}{
+		"http.method":      "POST",
+		"http.route":       "/v1/foo",
+		"http.target":      "/v1/foo?x=1",
+		"http.status_code": 202,
+		"pebble.change.id": chg.ID(),
+	})
+
+	st.Lock()
+	t1.SetStatus(state.DoneStatus)
+	t2.Errorf("oops")
+	t2.SetStatus(state.ErrorStatus)
+	st.Unlock()
+
+	c.Assert(exporter.spans, HasLen, 4)
+	t1Span, t2Span, chgSpan := exporter.spans[1], exporter.spans[2], exporter.spans[3]
+
+	c.Check(chgSpan.Name, Equals, "foo")
+	c.Check(chgSpan.Context.TraceID, Equals, reqSpan.Context.TraceID)
+	c.Check(chgSpan.Parent, Equals, reqSpan.Context.SpanID)
+	c.Check(chgSpan.Err, Matches, `(?s)cannot perform the following tasks:.*oops.*`)
+	c.Check(spanAttributes(chgSpan), DeepEquals, map[string]interface{}{
+		"pebble.change.id":      chg.ID(),
+		"pebble.change.kind":    "foo",
+		"pebble.change.summary": "Do foo",
+		"pebble.change.status":  "Error",
+	})
+
+	c.Check(t1Span.Name, Equals, "bar")
+	c.Check(t1Span.Context.TraceID, Equals, reqSpan.Context.TraceID)
+	c.Check(t1Span.Parent, Equals, chgSpan.Context.SpanID)
+	c.Check(t1Span.Err, Equals, "")
+	c.Check(spanAttributes(t1Span)["pebble.task.status"], Equals, "Done")
+
+	c.Check(t2Span.Name, Equals, "baz")
+	c.Check(t2Span.Parent, Equals, chgSpan.Context.SpanID)
+	c.Check(t2Span.Err, Equals, "oops")
+	c.Check(spanAttributes(t2Span), DeepEquals, map[string]interface{}{
+		"pebble.task.id":      t2.ID(),
+		"pebble.task.kind":    "baz",
+		"pebble.task.summary": "Do baz",
+		"pebble.task.status":  "Error",
+		"pebble.change.id":    chg.ID(),
+	})
+}
+
+func (s *daemonSuite) TestTracingRequestError(c *C) {
+	d := s.newDaemon(c)
+	exporter := &fakeSpanExporter{}
+	d.tracer = newTracer(exporter)
+
+	cmd := &Command{d: d, PathPrefix: "/v1/bar/"}
+	cmd.GET = func(*Command, *http.Request, *userState) Response {
+		return statusInternalError("oops")
+	}
+	doTestReq(c, cmd, "GET")
+
+	c.Assert(exporter.spans, HasLen, 1)
+	span := exporter.spans[0]
+	c.Check(span.Name, Equals, "GET /v1/bar/")
+	c.Check(span.Parent.IsValid(), Equals, false)
+	c.Check(span.Context.TraceID.IsValid(), Equals, true)
+	c.Check(span.Err, Equals, "Internal Server Error")
+	c.Check(spanAttributes(span)["http.status_code"], Equals, 500)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package osutil_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/osutil"
+)
+
+type envFileSuite struct{}
+
+var _ = Suite(&envFileSuite{})
+
+func (s *envFileSuite) TestReadEnvFile(c *C) {
+	path := filepath.Join(c.MkDir(), "env")
+	err := ioutil.WriteFile(path, []byte(`
+# A comment
+FOO=bar
+  BAZ = qux
+export QUOTED="a b = c"
+SINGLE='it''s'
+EMPTY=
+URL=http://example.com/?x=1
+`), 0600)
+	c.Assert(err, IsNil)
+
+	env, err := osutil.ReadEnvFile(path)
+	c.Assert(err, IsNil)
+	c.Check(env, DeepEquals, map[string]string{
+		"FOO":    "bar",
+		"BAZ":    "qux",
+		"QUOTED": "a b = c",
+		"SINGLE": "it''s",
+		"EMPTY":  "",
+		"URL":    "http://example.com/?x=1",
+	})
+}
+
+func (s *envFileSuite) TestReadEnvFileErrors(c *C) {
+	dir := c.MkDir()
+
+	_, err := osutil.ReadEnvFile(filepath.Join(dir, "missing"))
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	for _, content := range []string{"FOO\n", "FOO=1\n1BAR=2\n", "=x\n", "FOO BAR=1\n"} {
+		path := filepath.Join(dir, "env")
+		err := ioutil.WriteFile(path, []byte(content), 0600)
+		c.Assert(err, IsNil)
+		_, err = osutil.ReadEnvFile(path)
+		c.Check(err, ErrorMatches, `invalid line \d in environment file ".*/env"`, Commentf("content %q", content))
+	}
+}
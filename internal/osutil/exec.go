@@ -24,6 +24,7 @@ import (
 
 	"gopkg.in/tomb.v2"
 
+	"github.com/canonical/pebble/internal/reaper"
 	"github.com/canonical/pebble/internal/strutil"
 )
 
@@ -76,7 +77,7 @@ func RunAndWait(argv []string, env []string, timeout time.Duration, tomb *tomb.T
 	command.Stderr = buffer
 
 	// Actually run the command.
-	if err := command.Start(); err != nil {
+	if err := reaper.StartCommand(command); err != nil {
 		return nil, err
 	}
 
@@ -87,7 +88,7 @@ func RunAndWait(argv []string, env []string, timeout time.Duration, tomb *tomb.T
 	var commandError error
 	go func() {
 		// Wait for hook to complete
-		commandError = command.Wait()
+		commandError = reaper.CommandWait(command)
 		close(commandCompleted)
 	}()
 
@@ -134,7 +135,7 @@ func (r *waitingReader) Close() error {
 	if r.cmd.Process != nil {
 		r.cmd.Process.Kill()
 	}
-	return r.cmd.Wait()
+	return reaper.CommandWait(r.cmd)
 }
 
 func (r *waitingReader) Read(b []byte) (int, error) {
@@ -162,7 +163,7 @@ func StreamCommand(name string, args ...string) (io.ReadCloser, error) {
 	}
 	cmd.Stderr = os.Stderr
 
-	if err := cmd.Start(); err != nil {
+	if err := reaper.StartCommand(cmd); err != nil {
 		return nil, err
 	}
 
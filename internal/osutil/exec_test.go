@@ -139,6 +139,9 @@ func (s *execSuite) TestStreamCommandSad(c *C) {
 	_, err = io.Copy(&buf, stdout)
 	c.Assert(err, ErrorMatches, "exit status 1")
 	c.Check(buf.String(), Equals, "")
+	exitCode, err := osutil.ExitCode(err)
+	c.Assert(err, IsNil)
+	c.Check(exitCode, Equals, 1)
 
 	wrf, wrc := osutil.WaitingReaderGuts(stdout)
 	c.Assert(wrf, FitsTypeOf, &os.File{})
@@ -17,10 +17,13 @@ package osutil
 import (
 	"os/exec"
 	"syscall"
+
+	"github.com/canonical/pebble/internal/reaper"
 )
 
-// ExitCode extract the exit code from the error of a failed cmd.Run() or the
-// original error if its not a exec.ExitError
+// ExitCode extract the exit code from the error of a failed cmd.Run() or
+// reaper.CommandCombinedOutput, or the original error if its not an
+// exec.ExitError or reaper.ExitError
 func ExitCode(runErr error) (e int, err error) {
 	// golang, you are kidding me, right?
 	if exitErr, ok := runErr.(*exec.ExitError); ok {
@@ -28,5 +31,8 @@ func ExitCode(runErr error) (e int, err error) {
 		e = waitStatus.ExitStatus()
 		return e, nil
 	}
+	if exitErr, ok := runErr.(*reaper.ExitError); ok {
+		return exitErr.ExitCode(), nil
+	}
 	return e, runErr
 }
@@ -19,6 +19,7 @@ import (
 	"strings"
 
 	"github.com/canonical/pebble/internal/osutil"
+	"github.com/canonical/pebble/internal/reaper"
 )
 
 // useFuse detects if we should be using squashfuse instead
@@ -33,7 +34,7 @@ func useFuseImpl() bool {
 		return false
 	}
 
-	out, err := exec.Command("systemd-detect-virt", "--container").Output()
+	out, err := reaper.CommandOutput(exec.Command("systemd-detect-virt", "--container"))
 	if err != nil {
 		return false
 	}
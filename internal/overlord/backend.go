@@ -15,22 +15,166 @@
 package overlord
 
 import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
 	"time"
 
+	"github.com/canonical/pebble/internal/logger"
 	"github.com/canonical/pebble/internal/osutil"
 	"github.com/canonical/pebble/internal/overlord/restart"
 )
 
 type overlordStateBackend struct {
 	path           string
+	backups        int
 	ensureBefore   func(d time.Duration)
 	requestRestart func(t restart.RestartType)
+
+	// Checkpoints are coalesced: the state is written once no further
+	// checkpoint has arrived for delay, or once maxDelay has passed since
+	// the oldest unwritten one. If delay is zero, every checkpoint is
+	// written straight away.
+	delay    time.Duration
+	maxDelay time.Duration
+
+	mu       sync.Mutex
+	compress bool
+	pending  []byte
+	since    time.Time
+	timer    *time.Timer
+	stopped  bool
 }
 
 func (osb *overlordStateBackend) Checkpoint(data []byte) error {
+	osb.mu.Lock()
+	defer osb.mu.Unlock()
+
+	if osb.delay <= 0 || osb.stopped {
+		osb.pending = nil
+		return osb.write(data)
+	}
+
+	now := time.Now()
+	if osb.pending == nil {
+		osb.since = now
+	}
+	osb.pending = data
+	wait := osb.delay
+	if deadline := osb.since.Add(osb.maxDelay); now.Add(wait).After(deadline) {
+		wait = deadline.Sub(now)
+	}
+	if osb.timer == nil {
+		osb.timer = time.AfterFunc(wait, osb.writePending)
+	} else {
+		osb.timer.Reset(wait)
+	}
+	return nil
+}
+
+// writePending writes the latest unwritten checkpoint, if any. If that
+// fails, it's retried after the maximum delay.
+func (osb *overlordStateBackend) writePending() {
+	osb.mu.Lock()
+	defer osb.mu.Unlock()
+
+	if osb.pending == nil {
+		return
+	}
+	err := osb.write(osb.pending)
+	if err != nil {
+		logger.Noticef("Cannot write state file, will retry: %v", err)
+		osb.timer.Reset(osb.maxDelay)
+		return
+	}
+	osb.pending = nil
+}
+
+// Flush writes the latest unwritten checkpoint, if any, straight away.
+func (osb *overlordStateBackend) Flush() error {
+	osb.mu.Lock()
+	defer osb.mu.Unlock()
+
+	if osb.timer != nil {
+		osb.timer.Stop()
+	}
+	if osb.pending == nil {
+		return nil
+	}
+	err := osb.write(osb.pending)
+	if err != nil {
+		return err
+	}
+	osb.pending = nil
+	return nil
+}
+
+// stop flushes any unwritten checkpoint, and makes later checkpoints be
+// written straight away, as there may not be anything left to flush them.
+func (osb *overlordStateBackend) stop() error {
+	err := osb.Flush()
+	osb.mu.Lock()
+	osb.stopped = true
+	osb.mu.Unlock()
+	return err
+}
+
+func (osb *overlordStateBackend) setCompress(compress bool) {
+	osb.mu.Lock()
+	defer osb.mu.Unlock()
+	osb.compress = compress
+}
+
+func (osb *overlordStateBackend) write(data []byte) error {
+	if osb.compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	if osb.backups > 0 {
+		// Failing to back up shouldn't prevent the checkpoint itself.
+		if err := osb.rotateBackups(); err != nil {
+			logger.Noticef("Cannot back up state file: %v", err)
+		}
+	}
 	return osutil.AtomicWriteFile(osb.path, data, 0600, 0)
 }
 
+// rotateBackups shifts the existing backups of the state file up by one,
+// dropping the oldest, and copies the current state file to the first
+// backup.
+func (osb *overlordStateBackend) rotateBackups() error {
+	current, err := ioutil.ReadFile(osb.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for i := osb.backups - 1; i >= 1; i-- {
+		err := os.Rename(stateBackupPath(osb.path, i), stateBackupPath(osb.path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return osutil.AtomicWriteFile(stateBackupPath(osb.path, 1), current, 0600, 0)
+}
+
+// stateBackupPath returns the path of the n'th most recent backup of the
+// state file at path.
+func stateBackupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
 func (osb *overlordStateBackend) EnsureBefore(d time.Duration) {
 	osb.ensureBefore(d)
 }
@@ -0,0 +1,185 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package checkstate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/canonical/pebble/internal/plan"
+	"github.com/canonical/pebble/internal/reaper"
+	"github.com/canonical/pebble/internal/secrets"
+	"github.com/canonical/pebble/internal/strutil/shlex"
+)
+
+// maxErrorBytes is the maximum number of bytes of an HTTP response body
+// included in a check error.
+const maxErrorBytes = 1024
+
+// checker is the interface implemented by the different types of check.
+type checker interface {
+	// check performs a single check, returning an error if it failed or
+	// couldn't complete before ctx is done.
+	check(ctx context.Context) error
+}
+
+// RunCheck performs a single run of the given check, returning an error if
+// it failed or didn't complete within the check's timeout.
+func RunCheck(ctx context.Context, config *plan.Check) error {
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout.Value)
+	defer cancel()
+	return newChecker(config).check(ctx)
+}
+
+// newChecker returns the checker for the given check configuration.
+func newChecker(config *plan.Check) checker {
+	switch {
+	case config.HTTP != nil:
+		return &httpChecker{
+			name:    config.Name,
+			url:     config.HTTP.URL,
+			headers: config.HTTP.Headers,
+		}
+	case config.TCP != nil:
+		return &tcpChecker{
+			name: config.Name,
+			host: config.TCP.Host,
+			port: config.TCP.Port,
+		}
+	case config.Exec != nil:
+		return &execChecker{
+			name:        config.Name,
+			command:     config.Exec.Command,
+			environment: config.Exec.Environment,
+			workingDir:  config.Exec.WorkingDir,
+		}
+	default:
+		// This should never happen, as it's checked when the plan is read.
+		panic(fmt.Sprintf("internal error: check %q has no checker", config.Name))
+	}
+}
+
+// httpChecker succeeds if an HTTP GET of the URL returns a 20x status.
+type httpChecker struct {
+	name    string
+	url     string
+	headers map[string]string
+}
+
+func (c *httpChecker) check(ctx context.Context) error {
+	request, err := http.NewRequest("GET", c.url, nil)
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	for k, v := range c.headers {
+		request.Header.Set(k, v)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, maxErrorBytes))
+		if len(body) > 0 {
+			return fmt.Errorf("non-20x status code %d: %s", response.StatusCode, body)
+		}
+		return fmt.Errorf("non-20x status code %d", response.StatusCode)
+	}
+	return nil
+}
+
+// tcpChecker succeeds if a TCP connection to the host and port can be
+// established.
+type tcpChecker struct {
+	name string
+	host string
+	port int
+}
+
+func (c *tcpChecker) check(ctx context.Context) error {
+	host := c.host
+	if host == "" {
+		host = "localhost"
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(c.port)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// execChecker succeeds if the command exits with code 0.
+type execChecker struct {
+	name        string
+	command     string
+	environment map[string]string
+	workingDir  string
+}
+
+func (c *execChecker) check(ctx context.Context) error {
+	args, err := shlex.Split(c.command)
+	if err != nil {
+		// Shouldn't happen as it should have failed on parsing.
+		return fmt.Errorf("cannot parse check command: %v", err)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Env = secrets.Environ()
+	for k, v := range c.environment {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Dir = c.workingDir
+	err = reaper.StartCommand(cmd)
+	if err != nil {
+		return err
+	}
+	type result struct {
+		exitCode int
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		exitCode, err := reaper.WaitCommand(cmd)
+		done <- result{exitCode, err}
+	}()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		// Kill the whole process group, so that any processes the command
+		// started don't outlive the check.
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return ctx.Err()
+	}
+	if res.err != nil {
+		return res.err
+	}
+	if res.exitCode != 0 {
+		return fmt.Errorf("exit status %d", res.exitCode)
+	}
+	return nil
+}
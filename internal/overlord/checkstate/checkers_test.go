@@ -0,0 +1,143 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package checkstate_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/overlord/checkstate"
+	"github.com/canonical/pebble/internal/plan"
+	"github.com/canonical/pebble/internal/reaper"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type CheckersSuite struct{}
+
+var _ = Suite(&CheckersSuite{})
+
+func (s *CheckersSuite) SetUpSuite(c *C) {
+	err := reaper.Start()
+	c.Assert(err, IsNil)
+}
+
+func (s *CheckersSuite) TearDownSuite(c *C) {
+	err := reaper.Stop()
+	c.Assert(err, IsNil)
+}
+
+func runCheck(check *plan.Check) error {
+	check.Name = "chk"
+	if check.Timeout.Value == 0 {
+		check.Timeout.Value = time.Second
+	}
+	return checkstate.RunCheck(context.Background(), check)
+}
+
+func (s *CheckersSuite) TestHTTP(c *C) {
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Test")
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/error":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("something went wrong"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	err := runCheck(&plan.Check{HTTP: &plan.HTTPCheck{
+		URL:     server.URL + "/ok",
+		Headers: map[string]string{"X-Test": "foo"},
+	}})
+	c.Check(err, IsNil)
+	c.Check(header, Equals, "foo")
+
+	err = runCheck(&plan.Check{HTTP: &plan.HTTPCheck{URL: server.URL + "/error"}})
+	c.Check(err, ErrorMatches, "non-20x status code 500: something went wrong")
+
+	err = runCheck(&plan.Check{HTTP: &plan.HTTPCheck{URL: server.URL + "/missing"}})
+	c.Check(err, ErrorMatches, "non-20x status code 404")
+}
+
+func (s *CheckersSuite) TestTCP(c *C) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	err = runCheck(&plan.Check{TCP: &plan.TCPCheck{Host: "127.0.0.1", Port: port}})
+	c.Check(err, IsNil)
+
+	listener.Close()
+	err = runCheck(&plan.Check{TCP: &plan.TCPCheck{Host: "127.0.0.1", Port: port}})
+	c.Check(err, ErrorMatches, ".*connection refused")
+}
+
+func (s *CheckersSuite) TestExec(c *C) {
+	err := runCheck(&plan.Check{Exec: &plan.ExecCheck{Command: "true"}})
+	c.Check(err, IsNil)
+
+	err = runCheck(&plan.Check{Exec: &plan.ExecCheck{Command: "/bin/sh -c 'exit 3'"}})
+	c.Check(err, ErrorMatches, "exit status 3")
+
+	err = runCheck(&plan.Check{Exec: &plan.ExecCheck{
+		Command:     `/bin/sh -c '[ "$FOO" = bar ] && [ "$(pwd)" = /tmp ]'`,
+		Environment: map[string]string{"FOO": "bar"},
+		WorkingDir:  "/tmp",
+	}})
+	c.Check(err, IsNil)
+
+	err = runCheck(&plan.Check{
+		Timeout: plan.OptionalDuration{Value: 50 * time.Millisecond},
+		Exec:    &plan.ExecCheck{Command: "sleep 1"},
+	})
+	c.Check(err, Equals, context.DeadlineExceeded)
+}
+
+func (s *CheckersSuite) TestExecTimeoutKillsChildren(c *C) {
+	pidFile := filepath.Join(c.MkDir(), "pid")
+	err := runCheck(&plan.Check{
+		Timeout: plan.OptionalDuration{Value: 100 * time.Millisecond},
+		Exec:    &plan.ExecCheck{Command: "/bin/sh -c 'sleep 10 & echo $! >" + pidFile + "; wait'"},
+	})
+	c.Check(err, Equals, context.DeadlineExceeded)
+
+	data, err := ioutil.ReadFile(pidFile)
+	c.Assert(err, IsNil)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	c.Assert(err, IsNil)
+	for start := time.Now(); syscall.Kill(pid, 0) == nil; {
+		if time.Since(start) > 5*time.Second {
+			c.Fatalf("child process %d still running after check timed out", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
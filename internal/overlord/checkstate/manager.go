@@ -0,0 +1,220 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package checkstate
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/canonical/pebble/internal/logger"
+	"github.com/canonical/pebble/internal/plan"
+)
+
+// CheckManager runs the checks in the plan periodically and keeps track of
+// their results.
+type CheckManager struct {
+	mutex  sync.Mutex
+	checks map[string]*checkData
+}
+
+// NewManager creates a new check manager.
+func NewManager() *CheckManager {
+	return &CheckManager{
+		checks: make(map[string]*checkData),
+	}
+}
+
+// Ensure implements StateManager.Ensure.
+func (m *CheckManager) Ensure() error {
+	return nil
+}
+
+// Stop implements StateStopper. It stops all running checks.
+func (m *CheckManager) Stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for name, check := range m.checks {
+		check.stop()
+		delete(m.checks, name)
+	}
+}
+
+// PlanChanged handles updates to the plan (server configuration), stopping
+// checks that were removed or changed and starting checks that were added or
+// changed. Checks whose configuration is unchanged keep running, and keep
+// their results.
+func (m *CheckManager) PlanChanged(p *plan.Plan) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for name, check := range m.checks {
+		config, ok := p.Checks[name]
+		if ok && reflect.DeepEqual(config, check.config) {
+			continue
+		}
+		check.stop()
+		delete(m.checks, name)
+	}
+
+	for name, config := range p.Checks {
+		if _, ok := m.checks[name]; ok {
+			continue
+		}
+		check := newCheckData(config.Copy())
+		m.checks[name] = check
+		go check.loop()
+	}
+}
+
+// CheckInfo provides status information about a single check.
+type CheckInfo struct {
+	Name      string
+	Level     plan.CheckLevel
+	Status    CheckStatus
+	Failures  int
+	Threshold int
+	LastError string
+	// Duration is how long the most recent run of the check took (zero if
+	// the check hasn't run yet).
+	Duration time.Duration
+}
+
+type CheckStatus string
+
+const (
+	CheckStatusUp   CheckStatus = "up"
+	CheckStatusDown CheckStatus = "down"
+)
+
+// Checks returns the list of currently-configured checks and their status,
+// ordered by name.
+func (m *CheckManager) Checks() []*CheckInfo {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	infos := make([]*CheckInfo, 0, len(m.checks))
+	for _, check := range m.checks {
+		infos = append(infos, check.info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// checkData holds the configuration and current results of a running check.
+type checkData struct {
+	config  *plan.Check
+	checker checker
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mutex    sync.Mutex
+	failures int
+	lastErr  error
+	duration time.Duration
+}
+
+func newCheckData(config *plan.Check) *checkData {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &checkData{
+		config:  config,
+		checker: newChecker(config),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+}
+
+// loop runs the check every period until it's stopped.
+func (c *checkData) loop() {
+	defer close(c.done)
+	logger.Debugf("Check %q starting with period %s", c.config.Name, c.config.Period.Value)
+
+	ticker := time.NewTicker(c.config.Period.Value)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.runCheck()
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// runCheck performs a single run of the check and records the result.
+func (c *checkData) runCheck() {
+	ctx, cancel := context.WithTimeout(c.ctx, c.config.Timeout.Value)
+	defer cancel()
+	start := time.Now()
+	err := c.checker.check(ctx)
+	duration := time.Since(start)
+	if c.ctx.Err() != nil {
+		// Check was stopped while running, don't record the result.
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.duration = duration
+	c.lastErr = err
+	if err == nil {
+		if c.failures >= c.config.Threshold {
+			logger.Noticef("Check %q succeeded after %d failures, now up", c.config.Name, c.failures)
+		}
+		c.failures = 0
+		return
+	}
+	c.failures++
+	logger.Debugf("Check %q failure %d/%d: %v", c.config.Name, c.failures, c.config.Threshold, err)
+	if c.failures == c.config.Threshold {
+		logger.Noticef("Check %q failure threshold %d hit, now down: %v", c.config.Name, c.config.Threshold, err)
+	}
+}
+
+func (c *checkData) info() *CheckInfo {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	info := &CheckInfo{
+		Name:      c.config.Name,
+		Level:     c.config.Level,
+		Status:    CheckStatusUp,
+		Failures:  c.failures,
+		Threshold: c.config.Threshold,
+		Duration:  c.duration,
+	}
+	if c.failures >= c.config.Threshold {
+		info.Status = CheckStatusDown
+	}
+	if c.lastErr != nil {
+		info.LastError = c.lastErr.Error()
+	}
+	return info
+}
+
+// stop stops the check's loop and waits for it to finish.
+func (c *checkData) stop() {
+	c.cancel()
+	<-c.done
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package checkstate_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/overlord/checkstate"
+	"github.com/canonical/pebble/internal/plan"
+	"github.com/canonical/pebble/internal/reaper"
+)
+
+type ManagerSuite struct{}
+
+var _ = Suite(&ManagerSuite{})
+
+func (s *ManagerSuite) SetUpSuite(c *C) {
+	err := reaper.Start()
+	c.Assert(err, IsNil)
+}
+
+func (s *ManagerSuite) TearDownSuite(c *C) {
+	err := reaper.Stop()
+	c.Assert(err, IsNil)
+}
+
+func execCheck(name, command string, threshold int) *plan.Check {
+	return &plan.Check{
+		Name:      name,
+		Period:    plan.OptionalDuration{Value: 10 * time.Millisecond},
+		Timeout:   plan.OptionalDuration{Value: 5 * time.Millisecond},
+		Threshold: threshold,
+		Exec:      &plan.ExecCheck{Command: command},
+	}
+}
+
+// waitChecks waits until f returns true for the current checks.
+func waitChecks(c *C, mgr *checkstate.CheckManager, f func(checks []*checkstate.CheckInfo) bool) []*checkstate.CheckInfo {
+	for i := 0; i < 200; i++ {
+		checks := mgr.Checks()
+		if f(checks) {
+			return checks
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Fatalf("timed out waiting for checks")
+	return nil
+}
+
+func (s *ManagerSuite) TestChecks(c *C) {
+	mgr := checkstate.NewManager()
+	defer mgr.Stop()
+
+	mgr.PlanChanged(&plan.Plan{Checks: map[string]*plan.Check{
+		"chk1": execCheck("chk1", "true", 3),
+		"chk2": execCheck("chk2", "/bin/sh -c 'echo oops; exit 1'", 2),
+	}})
+
+	checks := waitChecks(c, mgr, func(checks []*checkstate.CheckInfo) bool {
+		return len(checks) == 2 && checks[0].Duration > 0 && checks[1].Failures >= 2
+	})
+	c.Check(checks[0].Name, Equals, "chk1")
+	c.Check(checks[0].Status, Equals, checkstate.CheckStatusUp)
+	c.Check(checks[0].Failures, Equals, 0)
+	c.Check(checks[0].Threshold, Equals, 3)
+	c.Check(checks[0].LastError, Equals, "")
+	c.Check(checks[1].Name, Equals, "chk2")
+	c.Check(checks[1].Status, Equals, checkstate.CheckStatusDown)
+	c.Check(checks[1].Threshold, Equals, 2)
+	c.Check(checks[1].LastError, Equals, "exit status 1")
+
+	// Unchanged checks keep their results; removed checks are stopped.
+	mgr.PlanChanged(&plan.Plan{Checks: map[string]*plan.Check{
+		"chk2": execCheck("chk2", "/bin/sh -c 'echo oops; exit 1'", 2),
+	}})
+	checks = mgr.Checks()
+	c.Assert(checks, HasLen, 1)
+	c.Check(checks[0].Name, Equals, "chk2")
+	c.Check(checks[0].Status, Equals, checkstate.CheckStatusDown)
+
+	// Changed checks are restarted.
+	mgr.PlanChanged(&plan.Plan{Checks: map[string]*plan.Check{
+		"chk2": execCheck("chk2", "true", 2),
+	}})
+	checks = mgr.Checks()
+	c.Assert(checks, HasLen, 1)
+	c.Check(checks[0].Status, Equals, checkstate.CheckStatusUp)
+	c.Check(checks[0].Failures, Equals, 0)
+
+	mgr.Stop()
+	c.Check(mgr.Checks(), HasLen, 0)
+}
@@ -34,6 +34,7 @@ import (
 	"github.com/canonical/pebble/internal/logger"
 	"github.com/canonical/pebble/internal/overlord/state"
 	"github.com/canonical/pebble/internal/ptyutil"
+	"github.com/canonical/pebble/internal/reaper"
 	"github.com/canonical/pebble/internal/wsutil"
 )
 
@@ -44,6 +45,14 @@ const (
 	wsControl = "control"
 	wsStdio   = "stdio"
 	wsStderr  = "stderr"
+
+	// maxDetachedOutput is how much of the end of a detached command's
+	// output is logged to its task.
+	maxDetachedOutput = 64 * 1024
+
+	// outputWait is how long to wait for a detached command's output to be
+	// copied after it exits.
+	outputWait = 1 * time.Second
 )
 
 // execution tracks the execution of a command.
@@ -59,6 +68,7 @@ type execution struct {
 	userID      *int
 	groupID     *int
 	workingDir  string
+	detach      bool
 
 	websockets       map[string]*websocket.Conn
 	websocketsLock   sync.Mutex
@@ -89,6 +99,7 @@ func (m *CommandManager) doExec(task *state.Task, tomb *tomb.Tomb) error {
 		userID:           setup.UserID,
 		groupID:          setup.GroupID,
 		workingDir:       setup.WorkingDir,
+		detach:           setup.Detach,
 		websockets:       make(map[string]*websocket.Conn),
 		ioConnected:      make(chan struct{}),
 		controlConnected: make(chan struct{}),
@@ -114,6 +125,9 @@ func (m *CommandManager) doExec(task *state.Task, tomb *tomb.Tomb) error {
 
 	// Run the command! Killing the tomb will terminate the command.
 	ctx := tomb.Context(context.Background())
+	if e.detach {
+		return e.doDetached(ctx, task)
+	}
 	return e.do(ctx, task)
 }
 
@@ -325,32 +339,11 @@ func (e *execution) do(ctx context.Context, task *state.Task) error {
 		defer cancel()
 	}
 
-	cmd := exec.CommandContext(ctx, e.command[0], e.command[1:]...)
-
-	for k, v := range e.environment {
-		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
-	}
-
-	cmd.Dir = e.workingDir
-
+	cmd := e.newCmd(ctx)
 	cmd.Stdin = stdin
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 
-	cmd.SysProcAttr = &syscall.SysProcAttr{}
-	if e.userID != nil && e.groupID != nil {
-		cmd.SysProcAttr.Credential = &syscall.Credential{
-			Uid: uint32(*e.userID),
-			Gid: uint32(*e.groupID),
-		}
-	}
-
-	// Creates a new session if the calling process is not a process group
-	// leader. The calling process is the leader of the new session, the
-	// process group leader of the new process group, and has no controlling
-	// terminal. This is important to allow remote shells to handle Ctrl+C.
-	cmd.SysProcAttr.Setsid = true
-
 	// Make the given terminal the controlling terminal of the calling
 	// process. The calling process must be a session leader and not have a
 	// controlling terminal already. This is important as allows Ctrl+C to
@@ -360,13 +353,14 @@ func (e *execution) do(ctx context.Context, task *state.Task) error {
 	}
 
 	// Start the command!
-	err = cmd.Start()
+	exitCode := -1
+	err = reaper.StartCommand(cmd)
 	if err == nil {
 		// Send its PID to the control loop.
 		pidCh <- cmd.Process.Pid
 
 		// Wait for it to finish.
-		err = cmd.Wait()
+		exitCode, err = reaper.WaitCommand(cmd)
 	}
 
 	// Close open files and channels.
@@ -388,33 +382,133 @@ func (e *execution) do(ctx context.Context, task *state.Task) error {
 		_ = closer.Close()
 	}
 
-	// Handle errors: timeout, non-zero exit code, or other error.
+	// Handle errors: timeout or other error (a non-zero exit code is not an
+	// error, it is reported to the client).
 	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
 		setExitCode(task, -1)
 		return fmt.Errorf("timed out after %v: %w", e.timeout, ctx.Err())
-	} else if exitErr, ok := err.(*exec.ExitError); ok {
-		status, ok := exitErr.Sys().(syscall.WaitStatus)
-		if ok {
-			if status.Signaled() {
-				// 128 + n == Fatal error signal "n"
-				setExitCode(task, 128+int(status.Signal()))
-				return nil
-			}
-			setExitCode(task, status.ExitStatus())
-			return nil
-		}
-		setExitCode(task, -1)
-		return err
 	} else if err != nil {
 		setExitCode(task, -1)
 		return err
 	}
 
-	// Successful exit (exit code 0).
-	setExitCode(task, 0)
+	setExitCode(task, exitCode)
 	return nil
 }
 
+// newCmd returns the command to run, without its standard I/O set up.
+func (e *execution) newCmd(ctx context.Context) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, e.command[0], e.command[1:]...)
+
+	for k, v := range e.environment {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	cmd.Dir = e.workingDir
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if e.userID != nil && e.groupID != nil {
+		cmd.SysProcAttr.Credential = &syscall.Credential{
+			Uid: uint32(*e.userID),
+			Gid: uint32(*e.groupID),
+		}
+	}
+
+	// Creates a new session if the calling process is not a process group
+	// leader. The calling process is the leader of the new session, the
+	// process group leader of the new process group, and has no controlling
+	// terminal. This is important to allow remote shells to handle Ctrl+C.
+	cmd.SysProcAttr.Setsid = true
+
+	return cmd
+}
+
+// doDetached runs the command without any websockets, logging the tail of
+// its combined output to the task when it finishes. Unlike an attached
+// command, a non-zero exit code is an error, so that it shows in the change.
+func (e *execution) doDetached(ctx context.Context, task *state.Task) error {
+	if e.timeout != 0 {
+		var cancel func()
+		ctx, cancel = context.WithTimeout(ctx, e.timeout)
+		defer cancel()
+	}
+
+	// Read the output through a pipe rather than having exec.Cmd copy it,
+	// as the reaper waits for the process instead of cmd.Wait.
+	outputReader, outputWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	output := &tailBuffer{max: maxDetachedOutput}
+	outputDone := make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		io.Copy(output, outputReader)
+		outputReader.Close()
+	}()
+
+	cmd := e.newCmd(ctx)
+	cmd.Stdout = outputWriter
+	cmd.Stderr = outputWriter
+
+	exitCode := -1
+	err = reaper.StartCommand(cmd)
+	if err == nil {
+		exitCode, err = reaper.WaitCommand(cmd)
+	}
+	outputWriter.Close()
+	// The output isn't closed until any background processes the command
+	// started that share it have exited too, so give up on them after a
+	// short time.
+	select {
+	case <-outputDone:
+	case <-time.After(outputWait):
+		outputReader.Close()
+		<-outputDone
+	}
+
+	st := task.State()
+	st.Lock()
+	if len(output.buf) > 0 {
+		if output.truncated {
+			task.Logf("Output (last %d bytes):\n%s", len(output.buf), output.buf)
+		} else {
+			task.Logf("Output:\n%s", output.buf)
+		}
+	}
+	st.Unlock()
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		setExitCode(task, -1)
+		return fmt.Errorf("timed out after %v: %w", e.timeout, ctx.Err())
+	case err != nil:
+		setExitCode(task, -1)
+		return err
+	}
+	setExitCode(task, exitCode)
+	if exitCode != 0 {
+		return fmt.Errorf("exited with code %d", exitCode)
+	}
+	return nil
+}
+
+// tailBuffer is an io.Writer that keeps the last max bytes written to it.
+type tailBuffer struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = append([]byte(nil), b.buf[len(b.buf)-b.max:]...)
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
 func setExitCode(task *state.Task, exitCode int) {
 	st := task.State()
 	st.Lock()
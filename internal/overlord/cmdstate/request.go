@@ -39,6 +39,10 @@ type ExecArgs struct {
 	SplitStderr bool
 	Width       int
 	Height      int
+
+	// Detach runs the command in the background without a client connected:
+	// it gets no input, and the tail of its output is logged to the task.
+	Detach bool
 }
 
 // ExecMetadata is the metadata returned from an Exec call.
@@ -61,6 +65,7 @@ type execSetup struct {
 	UserID      *int
 	GroupID     *int
 	WorkingDir  string
+	Detach      bool
 }
 
 // Exec creates a task that will execute the command with the given arguments.
@@ -68,6 +73,9 @@ func Exec(st *state.State, args *ExecArgs) (*state.Task, ExecMetadata, error) {
 	if args.Interactive && !args.Terminal {
 		return nil, ExecMetadata{}, errors.New("cannot use interactive mode without a terminal")
 	}
+	if args.Detach && args.Terminal {
+		return nil, ExecMetadata{}, errors.New("cannot use a terminal in detached mode")
+	}
 
 	environment := map[string]string{}
 	for k, v := range args.Environment {
@@ -130,6 +138,7 @@ func Exec(st *state.State, args *ExecArgs) (*state.Task, ExecMetadata, error) {
 		UserID:      args.UserID,
 		GroupID:     args.GroupID,
 		WorkingDir:  workingDir,
+		Detach:      args.Detach,
 	}
 	task.Set("exec-setup", &setup)
 
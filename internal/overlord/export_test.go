@@ -49,3 +49,27 @@ func FakeEnsureNext(o *Overlord, t time.Time) {
 func (o *Overlord) Engine() *StateEngine {
 	return o.stateEng
 }
+
+// FakeStateBackups sets the number of state file backups for tests.
+func FakeStateBackups(n int) (restore func()) {
+	old := stateBackups
+	stateBackups = n
+	return func() { stateBackups = old }
+}
+
+// FakeCheckpointDelay sets the state checkpoint coalescing delays for tests.
+func FakeCheckpointDelay(delay, maxDelay time.Duration) (restore func()) {
+	oldDelay := checkpointDelay
+	oldMaxDelay := checkpointMaxDelay
+	checkpointDelay = delay
+	checkpointMaxDelay = maxDelay
+	return func() {
+		checkpointDelay = oldDelay
+		checkpointMaxDelay = oldMaxDelay
+	}
+}
+
+// StateBackend exposes the state backend in an Overlord for tests.
+func (o *Overlord) StateBackend() interface{ Flush() error } {
+	return o.backend
+}
@@ -16,6 +16,9 @@
 package overlord
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
@@ -26,7 +29,9 @@ import (
 
 	"gopkg.in/tomb.v2"
 
+	"github.com/canonical/pebble/internal/logger"
 	"github.com/canonical/pebble/internal/osutil"
+	"github.com/canonical/pebble/internal/overlord/checkstate"
 	"github.com/canonical/pebble/internal/overlord/cmdstate"
 	"github.com/canonical/pebble/internal/overlord/patch"
 	"github.com/canonical/pebble/internal/overlord/restart"
@@ -45,6 +50,16 @@ var (
 	pruneMaxChanges = 500
 
 	defaultCachedDownloads = 5
+
+	// stateBackups is the number of rotated copies of the state file kept
+	// for recovering from a corrupt state file.
+	stateBackups = 3
+
+	// Checkpoints of the state are coalesced into a single write of the
+	// state file when they happen within checkpointDelay of each other, but
+	// the file is always written within checkpointMaxDelay.
+	checkpointDelay    = 100 * time.Millisecond
+	checkpointMaxDelay = time.Second
 )
 
 // Overlord is the central manager of the system, keeping track
@@ -52,6 +67,7 @@ var (
 type Overlord struct {
 	pebbleDir string
 	stateEng  *StateEngine
+	backend   *overlordStateBackend
 
 	// ensure loop
 	loopTomb    *tomb.Tomb
@@ -61,11 +77,21 @@ type Overlord struct {
 	ensureRun   int32
 	pruneTicker *time.Ticker
 
+	// watchdog notifications from the ensure loop (disabled if zero)
+	watchdogInterval time.Duration
+	watchdogNotify   func()
+	watchdogTicker   *time.Ticker
+
+	// pruning limits (zero means use the default)
+	pruneWait       time.Duration
+	pruneMaxChanges int
+
 	// managers
 	inited     bool
 	runner     *state.TaskRunner
 	serviceMgr *servstate.ServiceManager
 	commandMgr *cmdstate.CommandManager
+	checkMgr   *checkstate.CheckManager
 }
 
 // New creates a new Overlord with all its state managers.
@@ -87,8 +113,12 @@ func New(pebbleDir string, restartHandler restart.Handler, serviceOutput io.Writ
 
 	backend := &overlordStateBackend{
 		path:         statePath,
+		backups:      stateBackups,
 		ensureBefore: o.ensureBefore,
+		delay:        checkpointDelay,
+		maxDelay:     checkpointMaxDelay,
 	}
+	o.backend = backend
 	s, err := loadState(statePath, restartHandler, backend)
 	if err != nil {
 		return nil, err
@@ -112,6 +142,17 @@ func New(pebbleDir string, restartHandler restart.Handler, serviceOutput io.Writ
 	o.commandMgr = cmdstate.NewManager(o.runner)
 	o.addManager(o.commandMgr)
 
+	o.checkMgr = checkstate.NewManager()
+	o.addManager(o.checkMgr)
+
+	// Run the checks in the plan, and keep them up to date as it changes.
+	// Load the plan straight away so that checks start running even if no
+	// services are started.
+	o.serviceMgr.NotifyPlanChanged(o.checkMgr.PlanChanged)
+	if _, err := o.serviceMgr.Plan(); err != nil {
+		logger.Noticef("Cannot load plan: %v", err)
+	}
+
 	// the shared task runner should be added last!
 	o.stateEng.AddManager(o.runner)
 
@@ -153,15 +194,23 @@ func loadState(statePath string, restartHandler restart.Handler, backend state.B
 		return s, nil
 	}
 
-	r, err := os.Open(statePath)
-	if err != nil {
-		return nil, fmt.Errorf("cannot read the state file: %s", err)
-	}
-	defer r.Close()
-
-	var s *state.State
 	span := timings.StartNested("read-state", "read state from disk")
-	s, err = state.ReadState(backend, r)
+	s, err := readStateFile(statePath, backend)
+	if _, ok := err.(*corruptStateError); ok {
+		// Fall back to the most recent valid backup, if any.
+		for i := 1; i <= stateBackups; i++ {
+			backupPath := stateBackupPath(statePath, i)
+			if !osutil.CanStat(backupPath) {
+				break
+			}
+			backupState, backupErr := readStateFile(backupPath, backend)
+			if backupErr == nil {
+				logger.Noticef("Cannot read state file %q (%v), using backup %q", statePath, err, backupPath)
+				s, err = backupState, nil
+				break
+			}
+		}
+	}
 	span.Stop()
 	if err != nil {
 		return nil, err
@@ -186,6 +235,53 @@ func loadState(statePath string, restartHandler restart.Handler, backend state.B
 	return s, nil
 }
 
+// corruptStateError is returned by readStateFile if the state file exists but
+// cannot be parsed.
+type corruptStateError struct {
+	err error
+}
+
+func (e *corruptStateError) Error() string {
+	return e.err.Error()
+}
+
+// ReadStateFile reads the state file at path without loading the overlord,
+// decompressing it first if it was written with SetCompressState.
+func ReadStateFile(path string) (*state.State, error) {
+	return readStateFile(path, nil)
+}
+
+func readStateFile(path string, backend state.Backend) (*state.State, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the state file: %s", err)
+	}
+	defer r.Close()
+
+	// The state file may be gzip-compressed (see SetCompressState), which
+	// is detected from its first bytes rather than from the setting, so
+	// that the file can always be read whichever way it was written.
+	br := bufio.NewReader(r)
+	var sr io.Reader = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, gzipMagic) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, &corruptStateError{err}
+		}
+		defer zr.Close()
+		sr = zr
+	}
+
+	s, err := state.ReadState(backend, sr)
+	if err != nil {
+		return nil, &corruptStateError{err}
+	}
+	return s, nil
+}
+
+// gzipMagic is the header that starts a gzip-compressed file.
+var gzipMagic = []byte{0x1f, 0x8b}
+
 func initRestart(s *state.State, curBootID string, restartHandler restart.Handler) error {
 	s.Lock()
 	defer s.Unlock()
@@ -198,6 +294,9 @@ func (o *Overlord) ensureTimerSetup() {
 	o.ensureTimer = time.NewTimer(ensureInterval)
 	o.ensureNext = time.Now().Add(ensureInterval)
 	o.pruneTicker = time.NewTicker(pruneInterval)
+	if o.watchdogInterval > 0 {
+		o.watchdogTicker = time.NewTicker(o.watchdogInterval)
+	}
 }
 
 func (o *Overlord) ensureTimerReset() time.Time {
@@ -237,6 +336,10 @@ func (o *Overlord) ensureBefore(d time.Duration) {
 // Loop runs a loop in a goroutine to ensure the current state regularly through StateEngine Ensure.
 func (o *Overlord) Loop() {
 	o.ensureTimerSetup()
+	var watchdog <-chan time.Time
+	if o.watchdogTicker != nil {
+		watchdog = o.watchdogTicker.C
+	}
 	o.loopTomb.Go(func() error {
 		for {
 			// TODO: pass a proper context into Ensure
@@ -250,10 +353,11 @@ func (o *Overlord) Loop() {
 				return nil
 			case <-o.ensureTimer.C:
 			case <-o.pruneTicker.C:
-				st := o.State()
-				st.Lock()
-				st.Prune(pruneWait, abortWait, pruneMaxChanges)
-				st.Unlock()
+				o.Prune()
+			case <-watchdog:
+				// Notify from the loop itself so that a stuck ensure
+				// loop stops the notifications.
+				o.watchdogNotify()
 			}
 		}
 	})
@@ -268,11 +372,17 @@ func (o *Overlord) CanStandby() bool {
 	return run != 0
 }
 
-// Stop stops the ensure loop and the managers under the StateEngine.
+// Stop stops the ensure loop and the managers under the StateEngine, and
+// writes out any state checkpoint that is still pending.
 func (o *Overlord) Stop() error {
 	o.loopTomb.Kill(nil)
 	err := o.loopTomb.Wait()
 	o.stateEng.Stop()
+	if o.backend != nil {
+		if flushErr := o.backend.stop(); flushErr != nil {
+			logger.Noticef("Cannot write state file: %v", flushErr)
+		}
+	}
 	return err
 }
 
@@ -363,6 +473,55 @@ func (o *Overlord) SettleObserveBeforeCleanups(timeout time.Duration, beforeClea
 	return o.settle(timeout, beforeCleanups)
 }
 
+// SetPruneLimits sets how long ready changes are kept before being pruned,
+// and the maximum number of ready changes to keep. Zero values mean the
+// defaults are used.
+func (o *Overlord) SetPruneLimits(wait time.Duration, maxChanges int) {
+	o.ensureLock.Lock()
+	defer o.ensureLock.Unlock()
+	o.pruneWait = wait
+	o.pruneMaxChanges = maxChanges
+}
+
+// SetCompressState sets whether the state file is written gzip-compressed.
+// The state file is read correctly either way.
+func (o *Overlord) SetCompressState(compress bool) {
+	if o.backend != nil {
+		o.backend.setCompress(compress)
+	}
+}
+
+// SetWatchdog makes the ensure loop call notify every interval, for example
+// to send keep-alive notifications to the systemd watchdog. It must be called
+// before Loop.
+func (o *Overlord) SetWatchdog(interval time.Duration, notify func()) {
+	o.ensureLock.Lock()
+	defer o.ensureLock.Unlock()
+	o.watchdogInterval = interval
+	o.watchdogNotify = notify
+}
+
+// Prune removes old ready changes and their tasks from the state, aborts
+// changes that have been pending for too long, and removes expired
+// warnings. It is called periodically by the ensure loop, but may also be
+// called directly to force a prune.
+func (o *Overlord) Prune() {
+	o.ensureLock.Lock()
+	wait, maxChanges := o.pruneWait, o.pruneMaxChanges
+	o.ensureLock.Unlock()
+	if wait == 0 {
+		wait = pruneWait
+	}
+	if maxChanges == 0 {
+		maxChanges = pruneMaxChanges
+	}
+
+	st := o.State()
+	st.Lock()
+	defer st.Unlock()
+	st.Prune(wait, abortWait, maxChanges)
+}
+
 // State returns the system state managed by the overlord.
 func (o *Overlord) State() *state.State {
 	return o.stateEng.State()
@@ -391,6 +550,12 @@ func (o *Overlord) CommandManager() *cmdstate.CommandManager {
 	return o.commandMgr
 }
 
+// CheckManager returns the check manager responsible for running health
+// checks under the overlord.
+func (o *Overlord) CheckManager() *checkstate.CheckManager {
+	return o.checkMgr
+}
+
 // Fake creates an Overlord without any managers and with a backend
 // not using disk. Managers can be added with AddManager. For testing.
 func Fake() *Overlord {
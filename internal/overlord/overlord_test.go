@@ -15,12 +15,14 @@
 package overlord_test
 
 import (
+	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
@@ -204,6 +206,31 @@ func (ovs *overlordSuite) TestUnknownTasks(c *C) {
 	c.Check(chg.Status(), Equals, state.DoneStatus)
 }
 
+func (ovs *overlordSuite) TestEnsureLoopWatchdog(c *C) {
+	o := overlord.Fake()
+
+	notified := make(chan struct{}, 10)
+	o.SetWatchdog(10*time.Millisecond, func() {
+		select {
+		case notified <- struct{}{}:
+		default:
+		}
+	})
+	o.Loop()
+	defer o.Stop()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-notified:
+		case <-time.After(2 * time.Second):
+			c.Fatal("watchdog notifications not happening")
+		}
+	}
+
+	err := o.Stop()
+	c.Assert(err, IsNil)
+}
+
 func (ovs *overlordSuite) TestEnsureLoopRunAndStop(c *C) {
 	restoreIntv := overlord.FakeEnsureInterval(10 * time.Millisecond)
 	defer restoreIntv()
@@ -482,9 +509,48 @@ func (ovs *overlordSuite) TestEnsureLoopPruneRunsMultipleTimes(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (ovs *overlordSuite) TestPruneLimits(c *C) {
+	o := overlord.Fake()
+
+	st := o.State()
+	st.Lock()
+	for i := 0; i < 3; i++ {
+		chg := st.NewChange("foo", "...")
+		chg.SetStatus(state.DoneStatus)
+	}
+	chg := st.NewChange("pending", "...")
+	chg.AddTask(st.NewTask("foo", "..."))
+	st.Unlock()
+
+	// Recent changes are kept with the default limits.
+	o.Prune()
+	st.Lock()
+	c.Check(st.Changes(), HasLen, 4)
+	st.Unlock()
+
+	// Only the most recent ready change is kept, along with pending ones.
+	o.SetPruneLimits(time.Hour, 1)
+	o.Prune()
+	st.Lock()
+	c.Check(st.Changes(), HasLen, 2)
+	c.Check(st.Change(chg.ID()), Equals, chg)
+	st.Unlock()
+
+	// Ready changes are pruned once older than the wait.
+	o.SetPruneLimits(time.Nanosecond, 0)
+	time.Sleep(time.Millisecond)
+	o.Prune()
+	st.Lock()
+	c.Check(st.Changes(), HasLen, 1)
+	c.Check(st.Change(chg.ID()), Equals, chg)
+	st.Unlock()
+}
+
 func (ovs *overlordSuite) TestCheckpoint(c *C) {
 	oldUmask := syscall.Umask(0)
 	defer syscall.Umask(oldUmask)
+	restoreDelay := overlord.FakeCheckpointDelay(0, 0)
+	defer restoreDelay()
 
 	o, err := overlord.New(ovs.dir, nil, nil)
 	c.Assert(err, IsNil)
@@ -501,6 +567,172 @@ func (ovs *overlordSuite) TestCheckpoint(c *C) {
 	c.Check(ovs.statePath, testutil.FileContains, `"mark":1`)
 }
 
+func (ovs *overlordSuite) TestCheckpointBackups(c *C) {
+	restore := overlord.FakeStateBackups(2)
+	defer restore()
+	restoreDelay := overlord.FakeCheckpointDelay(0, 0)
+	defer restoreDelay()
+
+	o, err := overlord.New(ovs.dir, nil, nil)
+	c.Assert(err, IsNil)
+
+	s := o.State()
+	for i := 1; i <= 4; i++ {
+		s.Lock()
+		s.Set("mark", i)
+		s.Unlock()
+	}
+
+	c.Check(ovs.statePath, testutil.FileContains, `"mark":4`)
+	c.Check(ovs.statePath+".1", testutil.FileContains, `"mark":3`)
+	c.Check(ovs.statePath+".2", testutil.FileContains, `"mark":2`)
+	c.Check(osutil.CanStat(ovs.statePath+".3"), Equals, false)
+
+	st, err := os.Stat(ovs.statePath + ".1")
+	c.Assert(err, IsNil)
+	c.Check(st.Mode().Perm(), Equals, os.FileMode(0600))
+}
+
+func (ovs *overlordSuite) TestCheckpointCoalesced(c *C) {
+	restore := overlord.FakeStateBackups(2)
+	defer restore()
+	restoreDelay := overlord.FakeCheckpointDelay(50*time.Millisecond, time.Minute)
+	defer restoreDelay()
+
+	o, err := overlord.New(ovs.dir, nil, nil)
+	c.Assert(err, IsNil)
+
+	s := o.State()
+	s.Lock()
+	s.Set("mark", 1)
+	s.Unlock()
+	c.Assert(o.StateBackend().Flush(), IsNil)
+	c.Check(ovs.statePath, testutil.FileContains, `"mark":1`)
+
+	for i := 2; i <= 4; i++ {
+		s.Lock()
+		s.Set("mark", i)
+		s.Unlock()
+	}
+	c.Check(ovs.statePath, testutil.FileContains, `"mark":1`)
+
+	// The checkpoints are written once, after the delay.
+	for i := 0; i < 100; i++ {
+		data, err := ioutil.ReadFile(ovs.statePath)
+		c.Assert(err, IsNil)
+		if strings.Contains(string(data), `"mark":4`) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Check(ovs.statePath, testutil.FileContains, `"mark":4`)
+	c.Check(ovs.statePath+".1", testutil.FileContains, `"mark":1`)
+}
+
+func (ovs *overlordSuite) TestCheckpointMaxDelay(c *C) {
+	restoreDelay := overlord.FakeCheckpointDelay(time.Minute, 50*time.Millisecond)
+	defer restoreDelay()
+
+	o, err := overlord.New(ovs.dir, nil, nil)
+	c.Assert(err, IsNil)
+
+	s := o.State()
+	s.Lock()
+	s.Set("mark", 1)
+	s.Unlock()
+
+	for i := 0; i < 100 && !osutil.CanStat(ovs.statePath); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Check(ovs.statePath, testutil.FileContains, `"mark":1`)
+}
+
+func (ovs *overlordSuite) TestCheckpointFlushedOnStop(c *C) {
+	restoreDelay := overlord.FakeCheckpointDelay(time.Minute, time.Minute)
+	defer restoreDelay()
+
+	o, err := overlord.New(ovs.dir, nil, nil)
+	c.Assert(err, IsNil)
+	o.Loop()
+
+	s := o.State()
+	s.Lock()
+	s.Set("mark", 1)
+	s.Unlock()
+
+	c.Assert(o.Stop(), IsNil)
+	c.Check(ovs.statePath, testutil.FileContains, `"mark":1`)
+
+	// Once stopped, checkpoints are written straight away.
+	s.Lock()
+	s.Set("mark", 2)
+	s.Unlock()
+	c.Check(ovs.statePath, testutil.FileContains, `"mark":2`)
+}
+
+func (ovs *overlordSuite) TestCheckpointCompressed(c *C) {
+	restoreDelay := overlord.FakeCheckpointDelay(0, 0)
+	defer restoreDelay()
+
+	o, err := overlord.New(ovs.dir, nil, nil)
+	c.Assert(err, IsNil)
+	o.SetCompressState(true)
+
+	s := o.State()
+	s.Lock()
+	s.Set("mark", 1)
+	s.Unlock()
+
+	f, err := os.Open(ovs.statePath)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(zr)
+	c.Assert(err, IsNil)
+	c.Check(string(data), testutil.Contains, `"mark":1`)
+
+	// The compressed state file is detected on load.
+	o, err = overlord.New(ovs.dir, nil, nil)
+	c.Assert(err, IsNil)
+	s = o.State()
+	s.Lock()
+	defer s.Unlock()
+	var mark int
+	c.Assert(s.Get("mark", &mark), IsNil)
+	c.Check(mark, Equals, 1)
+}
+
+func (ovs *overlordSuite) TestNewWithCorruptStateUsesBackup(c *C) {
+	goodState := fmt.Sprintf(`{"data":{"patch-level":%d,"patch-sublevel":%d,"patch-sublevel-last-version":%q,"some":"data"},"changes":null,"tasks":null,"last-change-id":0,"last-task-id":0,"last-lane-id":0}`, patch.Level, patch.Sublevel, cmd.Version)
+	err := ioutil.WriteFile(ovs.statePath, []byte("{corrupt"), 0600)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(ovs.statePath+".1", []byte(""), 0600)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(ovs.statePath+".2", []byte(goodState), 0600)
+	c.Assert(err, IsNil)
+
+	o, err := overlord.New(ovs.dir, nil, nil)
+	c.Assert(err, IsNil)
+
+	s := o.State()
+	s.Lock()
+	defer s.Unlock()
+	var some string
+	c.Assert(s.Get("some", &some), IsNil)
+	c.Check(some, Equals, "data")
+}
+
+func (ovs *overlordSuite) TestNewWithCorruptStateNoValidBackup(c *C) {
+	err := ioutil.WriteFile(ovs.statePath, []byte(""), 0600)
+	c.Assert(err, IsNil)
+	err = ioutil.WriteFile(ovs.statePath+".1", []byte("{corrupt"), 0600)
+	c.Assert(err, IsNil)
+
+	_, err = overlord.New(ovs.dir, nil, nil)
+	c.Assert(err, ErrorMatches, "cannot read state: EOF")
+}
+
 type sampleManager struct {
 	ensureCallback func()
 }
@@ -15,6 +15,8 @@
 package servstate
 
 import (
+	"io"
+	"log/syslog"
 	"os/exec"
 	"syscall"
 	"time"
@@ -22,6 +24,14 @@ import (
 	"github.com/canonical/pebble/internal/plan"
 )
 
+func FakeNewJournalWriter(f func(identifier string, priority syslog.Priority) (io.WriteCloser, error)) (restore func()) {
+	old := newJournalWriter
+	newJournalWriter = f
+	return func() {
+		newJournalWriter = old
+	}
+}
+
 var CalculateNextBackoff = calculateNextBackoff
 var GetAction = getAction
 
@@ -80,6 +90,22 @@ func FakeKillWait(kill, fail time.Duration) (restore func()) {
 	}
 }
 
+func FakeOutputWait(wait time.Duration) (restore func()) {
+	old := outputWait
+	outputWait = wait
+	return func() {
+		outputWait = old
+	}
+}
+
+func FakeReadyRetryDelay(delay time.Duration) (restore func()) {
+	old := readyRetryDelay
+	readyRetryDelay = delay
+	return func() {
+		readyRetryDelay = old
+	}
+}
+
 func FakeSetCmdCredential(f func(cmd *exec.Cmd, credential *syscall.Credential)) (restore func()) {
 	old := setCmdCredential
 	setCmdCredential = f
@@ -87,3 +113,21 @@ func FakeSetCmdCredential(f func(cmd *exec.Cmd, credential *syscall.Credential))
 		setCmdCredential = old
 	}
 }
+
+func FakeProcDir(dir string) (restore func()) {
+	old := procDir
+	procDir = dir
+	return func() {
+		procDir = old
+	}
+}
+
+func ReadProcessStats(pid int) (cpuTime time.Duration, rss int64, err error) {
+	stats, err := readProcessStats(pid)
+	if err != nil {
+		return 0, 0, err
+	}
+	return stats.cpuTime, stats.rss, nil
+}
+
+const MaxServiceHistory = maxServiceHistory
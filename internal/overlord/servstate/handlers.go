@@ -1,11 +1,14 @@
 package servstate
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log/syslog"
 	"os"
 	"os/exec"
+	"path"
 	"regexp"
 	"strings"
 	"syscall"
@@ -16,11 +19,15 @@ import (
 
 	"github.com/canonical/pebble/internal/logger"
 	"github.com/canonical/pebble/internal/osutil"
+	"github.com/canonical/pebble/internal/overlord/checkstate"
 	"github.com/canonical/pebble/internal/overlord/restart"
 	"github.com/canonical/pebble/internal/overlord/state"
 	"github.com/canonical/pebble/internal/plan"
+	"github.com/canonical/pebble/internal/reaper"
+	"github.com/canonical/pebble/internal/sandbox"
+	"github.com/canonical/pebble/internal/secrets"
 	"github.com/canonical/pebble/internal/servicelog"
-	"github.com/canonical/pebble/internal/strutil/shlex"
+	"github.com/canonical/pebble/internal/systemd"
 )
 
 // TaskServiceRequest extracts the *ServiceRequest that was associated
@@ -57,8 +64,24 @@ var (
 	okayWait = 1 * time.Second
 	killWait = 5 * time.Second
 	failWait = 10 * time.Second
+
+	// How long to wait for output to be copied after the process exits
+	outputWait = 1 * time.Second
+
+	readyRetryDelay = 500 * time.Millisecond
+
+	newJournalWriter = func(identifier string, priority syslog.Priority) (io.WriteCloser, error) {
+		return systemd.NewJournalWriter(identifier, priority)
+	}
 )
 
+const defaultReadyTimeout = 30 * time.Second
+
+const defaultStartLimitInterval = 10 * time.Second
+
+// maxServiceHistory is the number of state transitions kept per service.
+const maxServiceHistory = 50
+
 const (
 	maxLogBytes  = 100 * 1024
 	lastLogLines = 20
@@ -75,20 +98,31 @@ const (
 	stateKilling     serviceState = "killing"
 	stateStopped     serviceState = "stopped"
 	stateBackoff     serviceState = "backoff"
+	stateExited      serviceState = "exited"
+	stateFailed      serviceState = "failed"
 )
 
 // serviceData holds the state and other data for a service under our control.
 type serviceData struct {
-	manager     *ServiceManager
-	state       serviceState
-	config      *plan.Service
-	logs        *servicelog.RingBuffer
-	started     chan error
-	stopped     chan error
-	cmd         *exec.Cmd
-	backoffNum  int
-	backoffTime time.Duration
-	resetTimer  *time.Timer
+	manager       *ServiceManager
+	state         serviceState
+	config        *plan.Service
+	args          []string
+	logs          *servicelog.RingBuffer
+	started       chan error
+	stopped       chan error
+	cmd           *exec.Cmd
+	backoffNum    int
+	backoffTime   time.Duration
+	restarts      []time.Time
+	restartCount  int
+	totalRestarts int
+	lastExit      *ServiceExit
+	startTime     time.Time
+	hung          bool
+	watchdogTimer *time.Timer
+	resetTimer    *time.Timer
+	logReader     *os.File
 }
 
 func (m *ServiceManager) doStart(task *state.Task, tomb *tomb.Tomb) error {
@@ -103,14 +137,20 @@ func (m *ServiceManager) doStart(task *state.Task, tomb *tomb.Tomb) error {
 	if err != nil {
 		return fmt.Errorf("cannot acquire plan lock: %w", err)
 	}
-	config, ok := m.plan.Services[request.Name]
+	config, ok := m.plan.Service(request.Name)
+	var readyChecks []*plan.Check
+	if ok {
+		for _, name := range config.ReadyChecks {
+			readyChecks = append(readyChecks, m.plan.Checks[name])
+		}
+	}
 	releasePlan()
 	if !ok {
 		return fmt.Errorf("cannot find service %q in plan", request.Name)
 	}
 
 	// Create the service object (or reuse the existing one by name).
-	service := m.serviceForStart(task, config)
+	service := m.serviceForStart(task, config, request.Args)
 	if service == nil {
 		return nil
 	}
@@ -122,8 +162,9 @@ func (m *ServiceManager) doStart(task *state.Task, tomb *tomb.Tomb) error {
 		return err
 	}
 
-	// Wait for a small amount of time, and if the service hasn't exited,
-	// consider it a success.
+	// Wait for the service's okay-delay (a second by default), and if the
+	// service hasn't exited, consider it a success. One-shot services are instead waited on until
+	// they exit, and succeed only if they exit with code 0.
 	select {
 	case err := <-service.started:
 		if err != nil {
@@ -132,6 +173,9 @@ func (m *ServiceManager) doStart(task *state.Task, tomb *tomb.Tomb) error {
 			return fmt.Errorf("cannot start service: %w", err)
 		}
 		// Started successfully (ran for small amount of time without exiting).
+		if len(readyChecks) > 0 {
+			return waitReady(task, tomb, config, readyChecks)
+		}
 		return nil
 	case <-tomb.Dying():
 		// User tried to abort the start, sending SIGKILL to process is about
@@ -139,7 +183,7 @@ func (m *ServiceManager) doStart(task *state.Task, tomb *tomb.Tomb) error {
 		m.removeService(config.Name)
 		m.servicesLock.Lock()
 		defer m.servicesLock.Unlock()
-		err := syscall.Kill(-service.cmd.Process.Pid, syscall.SIGKILL)
+		err := syscall.Kill(service.killPid(), syscall.SIGKILL)
 		if err != nil {
 			return fmt.Errorf("start aborted, but cannot send SIGKILL to process: %v", err)
 		}
@@ -147,11 +191,44 @@ func (m *ServiceManager) doStart(task *state.Task, tomb *tomb.Tomb) error {
 	}
 }
 
+// waitReady waits until all of the service's ready checks pass, so that the
+// start task (and thus the start of services ordered after this one) only
+// completes once the service is actually ready. It returns an error if the
+// checks haven't all passed within the service's ready-timeout.
+func waitReady(task *state.Task, tomb *tomb.Tomb, config *plan.Service, checks []*plan.Check) error {
+	taskLogf(task, "Waiting for service %q to be ready.", config.Name)
+	timeout := defaultReadyTimeout
+	if config.ReadyTimeout.IsSet {
+		timeout = config.ReadyTimeout.Value
+	}
+	ctx := tomb.Context(nil)
+	deadline := time.Now().Add(timeout)
+	for _, check := range checks {
+		for {
+			err := checkstate.RunCheck(ctx, check)
+			if err == nil {
+				break
+			}
+			if !time.Now().Before(deadline) {
+				return fmt.Errorf("service not ready after %s: check %q failed: %v",
+					timeout, check.Name, err)
+			}
+			select {
+			case <-time.After(readyRetryDelay):
+			case <-tomb.Dying():
+				return fmt.Errorf("wait for service readiness aborted")
+			}
+		}
+	}
+	return nil
+}
+
 // serviceForStart looks up the service by name in the services map; it
 // creates a new service object if one doesn't exist, returns the existing one
 // if it already exists but is stopped, or returns nil if it already exists
-// and is running.
-func (m *ServiceManager) serviceForStart(task *state.Task, config *plan.Service) *serviceData {
+// and is running. The args, if not nil, replace the default arguments of
+// the service command until it's next started.
+func (m *ServiceManager) serviceForStart(task *state.Task, config *plan.Service, args []string) *serviceData {
 	m.servicesLock.Lock()
 	defer m.servicesLock.Unlock()
 
@@ -162,6 +239,7 @@ func (m *ServiceManager) serviceForStart(task *state.Task, config *plan.Service)
 			manager: m,
 			state:   stateInitial,
 			config:  config.Copy(),
+			args:    args,
 			logs:    servicelog.NewRingBuffer(maxLogBytes),
 			started: make(chan error, 1),
 			stopped: make(chan error, 2), // enough for killTimeElapsed to send, and exit if it happens after
@@ -177,11 +255,17 @@ func (m *ServiceManager) serviceForStart(task *state.Task, config *plan.Service)
 	case stateInitial, stateStarting, stateRunning:
 		taskLogf(task, "Service %q already started.", config.Name)
 		return nil
-	case stateBackoff, stateStopped:
-		// Start allowed in "backoff" and "stopped" states.
+	case stateExited:
+		taskLogf(task, "Service %q already completed.", config.Name)
+		return nil
+	case stateBackoff, stateStopped, stateFailed:
+		// Start allowed in "backoff", "stopped" and "failed" states.
+		service.args = args
 		service.backoffNum = 0
 		service.backoffTime = 0
-		service.transition(stateInitial)
+		service.restarts = nil
+		service.restartCount = 0
+		service.transition(stateInitial, "start requested")
 		return service
 	default:
 		// Cannot start service while terminating or killing, handle in start().
@@ -210,8 +294,8 @@ func (m *ServiceManager) doStop(task *state.Task, tomb *tomb.Tomb) error {
 		return nil
 	}
 
-	// Stop service: send SIGTERM, and if that doesn't stop the process in a
-	// short time, send SIGKILL.
+	// Stop service: send its stop signal (SIGTERM by default), and if that
+	// doesn't stop the process in a short time, send SIGKILL.
 	err = service.stop()
 	if err != nil {
 		return err
@@ -234,6 +318,58 @@ func (m *ServiceManager) doStop(task *state.Task, tomb *tomb.Tomb) error {
 	}
 }
 
+func (m *ServiceManager) doReload(task *state.Task, tomb *tomb.Tomb) error {
+	m.state.Lock()
+	request, err := TaskServiceRequest(task)
+	m.state.Unlock()
+	if err != nil {
+		return err
+	}
+
+	releasePlan, err := m.acquirePlan()
+	if err != nil {
+		return fmt.Errorf("cannot acquire plan lock: %w", err)
+	}
+	config, ok := m.plan.Service(request.Name)
+	releasePlan()
+	if !ok {
+		return fmt.Errorf("cannot find service %q in plan", request.Name)
+	}
+
+	m.servicesLock.Lock()
+	service := m.services[request.Name]
+	pid := 0
+	if service != nil && (service.state == stateStarting || service.state == stateRunning) {
+		pid = service.cmd.Process.Pid
+	}
+	m.servicesLock.Unlock()
+	if pid == 0 {
+		return fmt.Errorf("cannot reload service %q: service is not running", request.Name)
+	}
+
+	switch {
+	case config.ReloadSignal != "":
+		return m.SendSignal([]string{request.Name}, config.ReloadSignal)
+	case config.ReloadCommand != "":
+		// The command is given the service's PID, as it'll usually need to
+		// signal or otherwise talk to the service's process.
+		logger.Noticef("Service %q reloading: %s", request.Name, config.ReloadCommand)
+		output, err := m.runServiceCommand(tomb, config, config.ReloadCommand, defaultCommandTimeout,
+			fmt.Sprintf("PEBBLE_SERVICE_PID=%d", pid))
+		if output != "" {
+			m.state.Lock()
+			task.Logf("Output of reload-command:\n%s", output)
+			m.state.Unlock()
+		}
+		if err != nil {
+			return fmt.Errorf("cannot reload service %q: reload-command failed: %w", request.Name, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("cannot reload service %q: no reload-command or reload-signal", request.Name)
+	}
+}
+
 // serviceForStop looks up the service by name in the services map; it
 // returns the service object if it exists and is running, or nil if it's
 // already stopped or has never been started.
@@ -266,10 +402,45 @@ func (m *ServiceManager) removeService(name string) {
 	delete(m.services, name)
 }
 
-// transition changes the service's state machine to the given state.
-func (s *serviceData) transition(state serviceState) {
+// recordTransition adds a state transition to the service's history,
+// dropping the oldest one if the history is full. It assumes the services
+// lock is held.
+func (m *ServiceManager) recordTransition(name string, state serviceState, reason string) {
+	history := m.history[name]
+	if len(history) >= maxServiceHistory {
+		copy(history, history[1:])
+		history = history[:len(history)-1]
+	}
+	m.history[name] = append(history, ServiceTransition{
+		Time:   time.Now(),
+		State:  string(state),
+		Reason: reason,
+	})
+}
+
+// transition changes the service's state machine to the given state, for
+// the given reason (recorded in the service's history).
+func (s *serviceData) transition(state serviceState, reason string) {
 	logger.Debugf("Service %q transitioning to state %q", s.config.Name, state)
 	s.state = state
+	s.manager.recordTransition(s.config.Name, state, reason)
+	switch state {
+	case stateRunning:
+		s.manager.notifyServiceEvent(s.config.Name, ServiceStarted)
+	case stateExited:
+		s.manager.notifyServiceEvent(s.config.Name, ServiceExited)
+	case stateStopped:
+		s.manager.notifyServiceEvent(s.config.Name, ServiceStopped)
+	}
+}
+
+// transitionFailed is like transition, but is used when the service failed
+// (for example, exited unexpectedly), and reports it as such.
+func (s *serviceData) transitionFailed(state serviceState, reason string) {
+	logger.Debugf("Service %q failed, transitioning to state %q", s.config.Name, state)
+	s.state = state
+	s.manager.recordTransition(s.config.Name, state, reason)
+	s.manager.notifyServiceEvent(s.config.Name, ServiceFailed)
 }
 
 // start is called to transition from the initial state and start the service.
@@ -283,8 +454,12 @@ func (s *serviceData) start() error {
 		if err != nil {
 			return err
 		}
-		s.transition(stateStarting)
-		time.AfterFunc(okayWait, func() { logError(s.okayWaitElapsed()) })
+		s.transition(stateStarting, "process started")
+		wait := okayWait
+		if s.config.OkayDelay.IsSet {
+			wait = s.config.OkayDelay.Value
+		}
+		time.AfterFunc(wait, func() { logError(s.okayWaitElapsed()) })
 
 	default:
 		return fmt.Errorf("cannot start service while %s", s.state)
@@ -302,14 +477,23 @@ func logError(err error) {
 // command. It assumes the caller has ensures the service is in a valid state,
 // and it sets s.cmd and other relevant fields.
 func (s *serviceData) startInternal() error {
-	args, err := shlex.Split(s.config.Command)
+	args, defaults, _, err := s.config.ParseCommand()
 	if err != nil {
 		// Shouldn't happen as it should have failed on parsing, but
 		// it does not hurt to double check and report.
 		return fmt.Errorf("cannot parse service command: %s", err)
 	}
+	// The args given at start time (kept for restarts) replace the defaults.
+	if s.args != nil {
+		defaults = s.args
+	}
+	args = append(args, defaults...)
 	s.cmd = exec.Command(args[0], args[1:]...)
+	// Always run the service in its own process group (even if its
+	// kill-mode only signals the leader), so that children of a shell
+	// wrapper stay in the group rather than escaping into Pebble's.
 	s.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	s.cmd.Dir = s.config.WorkingDir
 
 	// Start as another user if specified in plan.
 	uid, gid, err := osutil.NormalizeUidGid(s.config.UserID, s.config.GroupID, s.config.User, s.config.Group)
@@ -323,41 +507,178 @@ func (s *serviceData) startInternal() error {
 		})
 	}
 
-	// Pass service description's environment variables to child process.
-	s.cmd.Env = os.Environ()
-	for k, v := range s.config.Environment {
-		s.cmd.Env = append(s.cmd.Env, k+"="+v)
+	s.cmd.Env, err = s.manager.serviceEnvironment(s.config)
+	if err != nil {
+		return err
+	}
+	if s.config.Watchdog.IsSet {
+		// So that "pebble watchdog" knows which service to ping.
+		s.cmd.Env = append(s.cmd.Env, "PEBBLE_WATCHDOG_SERVICE="+s.config.Name)
 	}
 
-	// Set up stdout and stderr to write to log ring buffer.
-	var outputIterator servicelog.Iterator
-	if s.manager.serviceOutput != nil {
-		// Use the head iterator so that we copy from where this service
-		// started (previous logs have already been copied).
-		outputIterator = s.logs.HeadIterator(0)
+	umask, err := s.config.ParseUmask()
+	if err != nil {
+		return err
+	}
+
+	// Confine the process if the service asks for any sandboxing (which
+	// includes setting its umask, done by the sandbox helper before exec).
+	var mounts []sandbox.Mount
+	for _, mount := range s.config.Mounts {
+		mounts = append(mounts, sandbox.Mount{
+			Source:   mount.Source,
+			Target:   mount.Target,
+			ReadOnly: mount.ReadOnly,
+		})
+	}
+	err = sandbox.Command(s.cmd, &sandbox.Config{
+		Seccomp:         s.config.Seccomp,
+		AppArmorProfile: s.config.AppArmorProfile,
+		Capabilities:    s.config.Capabilities,
+		Mounts:          mounts,
+		Network:         s.config.Network,
+		PIDNamespace:    s.config.PIDNamespace,
+		Umask:           umask,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Set up stdout and stderr to write to log ring buffer. The output goes
+	// through a pipe we own (rather than one created by exec.Cmd) so that it
+	// can be handed over to a re-executed daemon.
+	logReader, logPipe, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("cannot create log pipe: %w", err)
+	}
+	s.cmd.Stdout = logPipe
+	s.cmd.Stderr = logPipe
+
+	logFile, err := s.openLogFile()
+	if err != nil {
+		logReader.Close()
+		logPipe.Close()
+		return err
+	}
+	journal, err := s.openJournal()
+	if err != nil {
+		logReader.Close()
+		logPipe.Close()
+		if logFile != nil {
+			logFile.Close()
+		}
+		return err
 	}
-	logWriter := servicelog.NewFormatWriter(s.logs, s.config.Name)
-	s.cmd.Stdout = logWriter
-	s.cmd.Stderr = logWriter
 
 	// Start the process!
 	logger.Noticef("Service %q starting: %s", s.config.Name, s.config.Command)
-	err = s.cmd.Start()
+	err = reaper.StartCommand(s.cmd)
+	logPipe.Close()
 	if err != nil {
-		if outputIterator != nil {
-			_ = outputIterator.Close()
+		logReader.Close()
+		if logFile != nil {
+			logFile.Close()
+		}
+		if journal != nil {
+			journal.Close()
 		}
 		_ = s.logs.Close()
 		return fmt.Errorf("cannot start service: %w", err)
 	}
+	s.startTime = time.Now()
 	s.resetTimer = time.AfterFunc(s.config.BackoffLimit.Value, func() { logError(s.backoffResetElapsed()) })
+	s.hung = false
+	s.armWatchdog()
+
+	s.monitor(func() (int, error) { return reaper.WaitCommand(s.cmd) }, logReader, logFile, journal)
+	return nil
+}
+
+// openLogFile opens the file the service's output is written to, if the
+// service has one configured, or returns nil if it doesn't.
+func (s *serviceData) openLogFile() (*servicelog.FileWriter, error) {
+	if s.config.LogTo == nil {
+		return nil, nil
+	}
+	logFile, err := servicelog.NewFileWriter(s.config.LogTo.Path, servicelog.FileOptions{
+		MaxSize:  int64(s.config.LogTo.MaxSize),
+		Backups:  s.config.LogTo.Backups,
+		Compress: s.config.LogTo.Compress,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open service log file: %w", err)
+	}
+	return logFile, nil
+}
+
+// openJournal connects to the systemd journal, if the service's output is
+// sent there, or returns nil if it isn't.
+func (s *serviceData) openJournal() (io.WriteCloser, error) {
+	if !s.config.LogToJournald {
+		return nil, nil
+	}
+	journal, err := newJournalWriter(s.config.Name, syslog.LOG_INFO)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to journal: %w", err)
+	}
+	return journal, nil
+}
+
+// monitor starts goroutines to copy the service's output from logReader to
+// its log buffer (and logFile and journal, if not nil), and to call wait
+// (which returns the process's exit code) and then transition state when the
+// process exits.
+func (s *serviceData) monitor(wait func() (int, error), logReader *os.File, logFile *servicelog.FileWriter, journal io.WriteCloser) {
+	s.logReader = logReader
+
+	var outputIterator servicelog.Iterator
+	if s.manager.serviceOutput != nil {
+		// Use the head iterator so that we copy from where this service
+		// started (previous logs have already been copied).
+		outputIterator = s.logs.HeadIterator(0)
+	}
+
+	// Start a goroutine to copy output to the log ring buffer.
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		var dest io.Writer = s.logs
+		if logFile != nil {
+			defer logFile.Close()
+			dest = &logFileTee{buffer: s.logs, file: logFile, service: s.config.Name}
+		}
+		logWriter := servicelog.NewFormatWriter(dest, s.config.Name)
+		var src io.Reader = logReader
+		if journal != nil {
+			// The journal records its own timestamps and identifier, so
+			// it's sent the output as is, rather than formatted.
+			defer journal.Close()
+			src = io.TeeReader(logReader, &journalTee{journal: journal, service: s.config.Name})
+		}
+		_, err := io.Copy(logWriter, src)
+		if err != nil && !errors.Is(err, os.ErrClosed) {
+			logger.Noticef("Service %q log read failed: %v", s.config.Name, err)
+		}
+	}()
 
 	// Start a goroutine to wait for the process to finish.
 	done := make(chan struct{})
 	go func() {
-		waitErr := s.cmd.Wait()
+		exitCode, err := wait()
+		if err != nil {
+			logger.Noticef("Cannot wait for service %q: %v", s.config.Name, err)
+		}
+		// Like exec.Cmd.Wait, wait until all output has been copied. But
+		// children left running (for example, when only the leader is
+		// killed) may hold the pipe open, so like exec.Cmd.WaitDelay, give
+		// up on them after a short time.
+		select {
+		case <-copied:
+		case <-time.After(outputWait):
+		}
+		logReader.Close()
 		close(done)
-		err := s.exited(waitErr)
+		err = s.exited(exitCode)
 		if err != nil {
 			logger.Noticef("Cannot transition state after service exit: %v", err)
 		}
@@ -375,8 +696,50 @@ func (s *serviceData) startInternal() error {
 			}
 		}()
 	}
+}
 
-	return nil
+// logFileTee writes service output to the log buffer and also to the
+// service's log file. Errors writing the file are logged (once) but
+// otherwise ignored, so that they don't stop output being captured.
+type logFileTee struct {
+	buffer  io.Writer
+	file    io.Writer
+	service string
+	failed  bool
+}
+
+func (t *logFileTee) Write(p []byte) (int, error) {
+	n, err := t.buffer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if !t.failed {
+		_, err := t.file.Write(p)
+		if err != nil {
+			logger.Noticef("Service %q log file write failed: %v", t.service, err)
+			t.failed = true
+		}
+	}
+	return n, nil
+}
+
+// journalTee sends service output to the journal. Like with logFileTee,
+// errors are logged (once) but otherwise ignored.
+type journalTee struct {
+	journal io.Writer
+	service string
+	failed  bool
+}
+
+func (t *journalTee) Write(p []byte) (int, error) {
+	if !t.failed {
+		_, err := t.journal.Write(p)
+		if err != nil {
+			logger.Noticef("Service %q journal write failed: %v", t.service, err)
+			t.failed = true
+		}
+	}
+	return len(p), nil
 }
 
 // okayWaitElapsed is called when the okay-wait timer has elapsed (and the
@@ -387,8 +750,12 @@ func (s *serviceData) okayWaitElapsed() error {
 
 	switch s.state {
 	case stateStarting:
+		if s.config.Kind == plan.KindOneshot {
+			// One-shot services are only started once they exit.
+			return nil
+		}
 		s.started <- nil // still running fine after short duration, no error
-		s.transition(stateRunning)
+		s.transition(stateRunning, "running after okay-delay")
 
 	default:
 		// Ignore if timer elapsed in any other state.
@@ -397,39 +764,90 @@ func (s *serviceData) okayWaitElapsed() error {
 	return nil
 }
 
+// newServiceExit returns a ServiceExit for a process that has just exited
+// with the given code (as returned by the reaper).
+func newServiceExit(exitCode int) *ServiceExit {
+	exit := &ServiceExit{Code: exitCode, Time: time.Now()}
+	if exitCode > 128 {
+		// The reaper reports processes terminated by a signal as 128+signal.
+		exit.Signal = unix.SignalName(syscall.Signal(exitCode - 128))
+	}
+	return exit
+}
+
+// reason describes the exit for the service's history.
+func (e *ServiceExit) reason() string {
+	if e.Signal != "" {
+		return "killed by " + e.Signal
+	}
+	return fmt.Sprintf("exited with code %d", e.Code)
+}
+
 // exited is called when the service's process exits.
-func (s *serviceData) exited(waitErr error) error {
+func (s *serviceData) exited(exitCode int) error {
 	s.manager.servicesLock.Lock()
 	defer s.manager.servicesLock.Unlock()
 
 	if s.resetTimer != nil {
 		s.resetTimer.Stop()
 	}
+	if s.watchdogTimer != nil {
+		s.watchdogTimer.Stop()
+	}
+	s.lastExit = newServiceExit(exitCode)
+	reason := s.lastExit.reason()
+	if s.hung {
+		reason = "killed by watchdog"
+	}
 
 	switch s.state {
 	case stateStarting:
-		s.started <- fmt.Errorf("exited quickly with code %d", exitCode(s.cmd))
-		s.transition(stateStopped) // not strictly necessary as doStart will return, but doesn't hurt
+		if s.config.Kind == plan.KindOneshot {
+			if exitCode != 0 {
+				s.started <- fmt.Errorf("exited with code %d", exitCode)
+				s.transitionFailed(stateStopped, reason)
+				break
+			}
+			logger.Noticef("Service %q completed successfully", s.config.Name)
+			s.started <- nil
+			if s.config.RemainAfterExit {
+				s.transition(stateExited, "completed successfully")
+			} else {
+				s.transition(stateStopped, "completed successfully")
+			}
+			break
+		}
+		s.started <- fmt.Errorf("exited quickly with code %d", exitCode)
+		s.transitionFailed(stateStopped, reason+" while starting") // not strictly necessary as doStart will return, but doesn't hurt
 
 	case stateRunning:
-		logger.Noticef("Service %q stopped unexpectedly with code %d", s.config.Name, exitCode(s.cmd))
-		action, onType := getAction(s.config, waitErr == nil)
+		logger.Noticef("Service %q stopped unexpectedly with code %d", s.config.Name, exitCode)
+		action, onType := getAction(s.config, exitCode == 0 && !s.hung)
 		switch action {
 		case plan.ActionIgnore:
 			logger.Noticef("Service %q %s action is %q, transitioning to stopped state", s.config.Name, onType, action)
-			s.transition(stateStopped)
+			s.transitionFailed(stateStopped, reason)
 
 		case plan.ActionHalt:
 			logger.Noticef("Service %q %s action is %q, triggering server exit", s.config.Name, onType, action)
 			s.manager.restarter.HandleRestart(restart.RestartDaemon)
-			s.transition(stateStopped)
+			s.transitionFailed(stateStopped, reason+", halting daemon")
 
 		case plan.ActionRestart:
+			if s.startLimitReached() {
+				logger.Noticef("Service %q restarted too often, not restarting until started explicitly", s.config.Name)
+				s.transitionFailed(stateFailed, reason+", start limit reached")
+				// The state lock mustn't be taken with the services lock
+				// held (callers such as Replan take them the other way
+				// round), so the notice is added separately.
+				go s.manager.addStartLimitNotice(s.config.Name)
+				break
+			}
 			s.backoffNum++
 			s.backoffTime = calculateNextBackoff(s.config, s.backoffTime)
 			logger.Noticef("Service %q %s action is %q, waiting ~%s before restart (backoff %d)",
 				s.config.Name, onType, action, s.backoffTime, s.backoffNum)
-			s.transition(stateBackoff)
+			s.transitionFailed(stateBackoff, reason)
 			duration := s.backoffTime + s.manager.getJitter(s.backoffTime)
 			time.AfterFunc(duration, func() { logError(s.backoffTimeElapsed()) })
 
@@ -440,7 +858,7 @@ func (s *serviceData) exited(waitErr error) error {
 	case stateTerminating, stateKilling:
 		logger.Noticef("Service %q stopped", s.config.Name)
 		s.stopped <- nil
-		s.transition(stateStopped)
+		s.transition(stateStopped, "stopped, "+reason)
 
 	default:
 		return fmt.Errorf("internal error: exited invalid in state %q", s.state)
@@ -493,6 +911,34 @@ func getLastLogs(logBuffer *servicelog.RingBuffer) (string, error) {
 	return strings.Join(lines, "\n"), nil
 }
 
+// startLimitReached records an automatic restart of the service, and
+// reports whether it has now been restarted more than start-limit-burst
+// times within start-limit-interval.
+func (s *serviceData) startLimitReached() bool {
+	if s.config.StartLimitBurst == 0 {
+		return false
+	}
+	interval := defaultStartLimitInterval
+	if s.config.StartLimitInterval.IsSet {
+		interval = s.config.StartLimitInterval.Value
+	}
+	now := time.Now()
+	var restarts []time.Time
+	for _, t := range s.restarts {
+		if now.Sub(t) < interval {
+			restarts = append(restarts, t)
+		}
+	}
+	s.restarts = append(restarts, now)
+	return len(s.restarts) > s.config.StartLimitBurst
+}
+
+func (m *ServiceManager) addStartLimitNotice(name string) {
+	m.state.Lock()
+	defer m.state.Unlock()
+	m.state.AddNotice(state.StartLimitNotice, name, nil)
+}
+
 func calculateNextBackoff(config *plan.Service, current time.Duration) time.Duration {
 	if current == 0 {
 		// First backoff time
@@ -521,19 +967,6 @@ func (m *ServiceManager) getJitter(duration time.Duration) time.Duration {
 	return time.Duration(jitter * float64(time.Second))
 }
 
-// exitCode returns the exit code of the given command, or 128+signal if it
-// exited via a signal.
-func exitCode(cmd *exec.Cmd) int {
-	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
-	if ok {
-		if status.Signaled() {
-			return 128 + int(status.Signal())
-		}
-		return status.ExitStatus()
-	}
-	return cmd.ProcessState.ExitCode()
-}
-
 // getAction returns the correct action to perform from the plan and whether
 // or not the service exited with a success exit code (0).
 func getAction(config *plan.Service, success bool) (action plan.ServiceAction, onType string) {
@@ -565,7 +998,7 @@ func (s *serviceData) sendSignal(signal string) error {
 			return err
 		}
 
-	case stateBackoff, stateTerminating, stateKilling, stateStopped:
+	case stateBackoff, stateTerminating, stateKilling, stateStopped, stateExited, stateFailed:
 		return fmt.Errorf("service is not running")
 
 	default:
@@ -574,6 +1007,16 @@ func (s *serviceData) sendSignal(signal string) error {
 	return nil
 }
 
+// killPid returns the PID to pass to kill(2) to signal the service when
+// stopping or killing it: by default the whole process group, but only the
+// process itself if its kill-mode is "process".
+func (s *serviceData) killPid() int {
+	if s.config.KillMode == plan.KillModeProcess {
+		return s.cmd.Process.Pid
+	}
+	return -s.cmd.Process.Pid
+}
+
 // stop is called to stop a running (or backing off) service.
 func (s *serviceData) stop() error {
 	s.manager.servicesLock.Lock()
@@ -581,19 +1024,36 @@ func (s *serviceData) stop() error {
 
 	switch s.state {
 	case stateRunning:
-		logger.Debugf("Attempting to stop service %q by sending SIGTERM", s.config.Name)
-		// First send SIGTERM to try to terminate it gracefully.
-		err := syscall.Kill(-s.cmd.Process.Pid, syscall.SIGTERM)
+		sig, err := s.config.ParseStopSignal()
+		if err != nil {
+			// Shouldn't happen as it's validated when the plan is parsed.
+			return err
+		}
+		sigName := unix.SignalName(sig)
+		logger.Debugf("Attempting to stop service %q by sending %s", s.config.Name, sigName)
+		// First send the stop signal (SIGTERM by default) to try to
+		// terminate it gracefully.
+		err = syscall.Kill(s.killPid(), sig)
 		if err != nil {
-			logger.Noticef("Cannot send SIGTERM to process: %v", err)
+			logger.Noticef("Cannot send %s to process: %v", sigName, err)
 		}
-		s.transition(stateTerminating)
+		s.transition(stateTerminating, "stop requested, sent "+sigName)
 		time.AfterFunc(killWait, func() { logError(s.terminateTimeElapsed()) })
 
 	case stateBackoff:
 		logger.Noticef("Service %q stopped while waiting for backoff", s.config.Name)
 		s.stopped <- nil
-		s.transition(stateStopped)
+		s.transition(stateStopped, "stop requested")
+
+	case stateExited:
+		logger.Noticef("Service %q stopped after completion", s.config.Name)
+		s.stopped <- nil
+		s.transition(stateStopped, "stop requested")
+
+	case stateFailed:
+		logger.Noticef("Service %q stopped after reaching its start limit", s.config.Name)
+		s.stopped <- nil
+		s.transition(stateStopped, "stop requested")
 
 	default:
 		return fmt.Errorf("cannot stop service while %s", s.state)
@@ -613,7 +1073,9 @@ func (s *serviceData) backoffTimeElapsed() error {
 		if err != nil {
 			return err
 		}
-		s.transition(stateRunning)
+		s.restartCount++
+		s.totalRestarts++
+		s.transition(stateRunning, "restarted after backoff")
 
 	default:
 		// Ignore if timer elapsed in any other state.
@@ -632,11 +1094,11 @@ func (s *serviceData) terminateTimeElapsed() error {
 	case stateTerminating:
 		logger.Debugf("Attempting to stop service %q again by sending SIGKILL", s.config.Name)
 		// Process hasn't exited after SIGTERM, try SIGKILL.
-		err := syscall.Kill(-s.cmd.Process.Pid, syscall.SIGKILL)
+		err := syscall.Kill(s.killPid(), syscall.SIGKILL)
 		if err != nil {
 			logger.Noticef("Cannot send SIGKILL to process: %v", err)
 		}
-		s.transition(stateKilling)
+		s.transition(stateKilling, "still running after stop signal, sent SIGKILL")
 		time.AfterFunc(failWait-killWait, func() { logError(s.killTimeElapsed()) })
 
 	default:
@@ -656,7 +1118,47 @@ func (s *serviceData) killTimeElapsed() error {
 	case stateKilling:
 		logger.Noticef("Service %q still running after SIGTERM and SIGKILL", s.config.Name)
 		s.stopped <- fmt.Errorf("process still running after SIGTERM and SIGKILL")
-		s.transition(stateStopped)
+		s.transitionFailed(stateStopped, "still running after SIGKILL")
+
+	default:
+		// Ignore if timer elapsed in any other state.
+		return nil
+	}
+	return nil
+}
+
+// armWatchdog (re)starts the service's watchdog timer, if it has a
+// watchdog. It assumes the services lock is held.
+func (s *serviceData) armWatchdog() {
+	if !s.config.Watchdog.IsSet {
+		return
+	}
+	if s.watchdogTimer != nil {
+		s.watchdogTimer.Stop()
+	}
+	cmd := s.cmd
+	s.watchdogTimer = time.AfterFunc(s.config.Watchdog.Value, func() { logError(s.watchdogElapsed(cmd)) })
+}
+
+// watchdogElapsed is called when the service hasn't pinged its watchdog
+// within the watchdog interval. The service is considered hung: it's killed,
+// and its on-failure action applied when it exits.
+func (s *serviceData) watchdogElapsed(cmd *exec.Cmd) error {
+	s.manager.servicesLock.Lock()
+	defer s.manager.servicesLock.Unlock()
+
+	if s.cmd != cmd {
+		// Timer for a previous run of the service.
+		return nil
+	}
+	switch s.state {
+	case stateStarting, stateRunning:
+		logger.Noticef("Service %q watchdog not pinged within %s, killing it as hung", s.config.Name, s.config.Watchdog.Value)
+		s.hung = true
+		err := syscall.Kill(s.killPid(), syscall.SIGKILL)
+		if err != nil {
+			return fmt.Errorf("cannot send SIGKILL to hung service %q: %v", s.config.Name, err)
+		}
 
 	default:
 		// Ignore if timer elapsed in any other state.
@@ -686,6 +1188,55 @@ func (s *serviceData) backoffResetElapsed() error {
 	return nil
 }
 
+// serviceEnvironment returns the environment a service's processes are run
+// with: Pebble's own (without the secrets in its environment), then the
+// service's environment variables, followed by those from its environment
+// files (which take precedence).
+func (m *ServiceManager) serviceEnvironment(config *plan.Service) ([]string, error) {
+	env := secrets.Environ()
+	for k, v := range config.Environment {
+		var err error
+		if strings.HasPrefix(v, secrets.RefPrefix) {
+			// Secrets are only resolved here, so their values aren't kept
+			// in the plan or the state. Their values are used as-is.
+			v, err = secrets.Resolve(m.secrets, v)
+		} else {
+			v, err = plan.ExpandHostVars(v, m.lookupHostVar)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot set environment variable %q: %w", k, err)
+		}
+		env = append(env, k+"="+v)
+	}
+	for _, path := range config.EnvironmentFiles {
+		optional := strings.HasPrefix(path, "-")
+		path = strings.TrimPrefix(path, "-")
+		fileEnv, err := osutil.ReadEnvFile(path)
+		if os.IsNotExist(err) && optional {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read environment file: %w", err)
+		}
+		for k, v := range fileEnv {
+			env = append(env, k+"="+v)
+		}
+	}
+	return env, nil
+}
+
+// lookupHostVar returns the value of the daemon's environment variable name
+// (empty if it isn't set), or an error if it isn't in the host environment
+// allowlist.
+func (m *ServiceManager) lookupHostVar(name string) (string, error) {
+	for _, pattern := range m.hostEnv {
+		if matched, _ := path.Match(pattern, name); matched {
+			return os.Getenv(name), nil
+		}
+	}
+	return "", fmt.Errorf("host variable %q is not in the allowlist", name)
+}
+
 var setCmdCredential = func(cmd *exec.Cmd, credential *syscall.Credential) {
 	cmd.SysProcAttr.Credential = credential
 }
@@ -0,0 +1,167 @@
+package servstate
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internal/logger"
+	"github.com/canonical/pebble/internal/osutil"
+	"github.com/canonical/pebble/internal/overlord/state"
+	"github.com/canonical/pebble/internal/plan"
+	"github.com/canonical/pebble/internal/reaper"
+	"github.com/canonical/pebble/internal/strutil/shlex"
+)
+
+// defaultCommandTimeout is how long a hook may run if it doesn't specify a
+// timeout, and how long a reload command may run.
+const defaultCommandTimeout = time.Minute
+
+// maxCommandOutput is the most output from a hook or reload command that's
+// kept for the task log.
+const maxCommandOutput = 4096
+
+func (m *ServiceManager) doRunHook(task *state.Task, tomb *tomb.Tomb) error {
+	m.state.Lock()
+	request, err := TaskServiceRequest(task)
+	m.state.Unlock()
+	if err != nil {
+		return err
+	}
+
+	releasePlan, err := m.acquirePlan()
+	if err != nil {
+		return fmt.Errorf("cannot acquire plan lock: %w", err)
+	}
+	config, ok := m.plan.Service(request.Name)
+	releasePlan()
+	if !ok {
+		return fmt.Errorf("cannot find service %q in plan", request.Name)
+	}
+	hook := config.Hooks.Hook(request.Hook)
+	if hook == nil {
+		// The hook was removed from the plan since the change was made.
+		return nil
+	}
+
+	logger.Noticef("Service %q running %s hook: %s", request.Name, request.Hook, hook.Command)
+	timeout := defaultCommandTimeout
+	if hook.Timeout.IsSet {
+		timeout = hook.Timeout.Value
+	}
+	output, err := m.runServiceCommand(tomb, config, hook.Command, timeout)
+	m.state.Lock()
+	if output != "" {
+		task.Logf("Output of %s hook:\n%s", request.Hook, output)
+	}
+	if err != nil && hook.OnFailure == plan.HookFailureWarn {
+		logger.Noticef("Service %q %s hook failed: %v", request.Name, request.Hook, err)
+		task.Logf("Ignoring failure of %s hook: %v", request.Hook, err)
+		err = nil
+	}
+	m.state.Unlock()
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %w", request.Hook, err)
+	}
+	return nil
+}
+
+// runServiceCommand runs a command (such as a hook) with the service's
+// environment, plus any extra variables, and its user, group and working
+// directory, killing it if it takes longer than timeout or the task is
+// aborted. It returns the command's combined output (truncated to its last
+// few kilobytes).
+func (m *ServiceManager) runServiceCommand(tomb *tomb.Tomb, config *plan.Service, command string, timeout time.Duration, extraEnv ...string) (string, error) {
+	args, err := shlex.Split(command)
+	if err != nil {
+		// Shouldn't happen as it should have failed on parsing.
+		return "", fmt.Errorf("cannot parse command: %v", err)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	// Run the hook in its own process group, so that any children it
+	// starts are killed with it on timeout.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Dir = config.WorkingDir
+	uid, gid, err := osutil.NormalizeUidGid(config.UserID, config.GroupID, config.User, config.Group)
+	if err != nil {
+		return "", err
+	}
+	if uid != nil && gid != nil {
+		setCmdCredential(cmd, &syscall.Credential{
+			Uid: uint32(*uid),
+			Gid: uint32(*gid),
+		})
+	}
+	cmd.Env, err = m.serviceEnvironment(config)
+	if err != nil {
+		return "", err
+	}
+	cmd.Env = append(cmd.Env, extraEnv...)
+
+	// Write output to a file rather than a pipe, so that nothing is left
+	// waiting on it if the hook leaves a child running.
+	outputFile, err := ioutil.TempFile("", "pebble-hook-")
+	if err != nil {
+		return "", fmt.Errorf("cannot create output file: %w", err)
+	}
+	defer os.Remove(outputFile.Name())
+	defer outputFile.Close()
+	cmd.Stdout = outputFile
+	cmd.Stderr = outputFile
+
+	err = reaper.StartCommand(cmd)
+	if err != nil {
+		return "", err
+	}
+	type result struct {
+		exitCode int
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		exitCode, err := reaper.WaitCommand(cmd)
+		done <- result{exitCode, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-timer.C:
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		res.err = fmt.Errorf("timed out after %s", timeout)
+	case <-tomb.Dying():
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		res.err = fmt.Errorf("aborted")
+	}
+	if res.err == nil && res.exitCode != 0 {
+		res.err = fmt.Errorf("exit status %d", res.exitCode)
+	}
+	return readCommandOutput(outputFile), res.err
+}
+
+// readCommandOutput returns the last maxCommandOutput bytes written to f.
+func readCommandOutput(f *os.File) string {
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+	offset := info.Size() - maxCommandOutput
+	if offset < 0 {
+		offset = 0
+	}
+	buf := make([]byte, info.Size()-offset)
+	n, _ := f.ReadAt(buf, offset)
+	return strings.TrimRight(string(bytes.ToValidUTF8(buf[:n], nil)), "\n")
+}
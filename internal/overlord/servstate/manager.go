@@ -9,9 +9,13 @@ import (
 	"sync"
 	"time"
 
+	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/pebble/internal/logger"
 	"github.com/canonical/pebble/internal/overlord/restart"
 	"github.com/canonical/pebble/internal/overlord/state"
 	"github.com/canonical/pebble/internal/plan"
+	"github.com/canonical/pebble/internal/secrets"
 	"github.com/canonical/pebble/internal/servicelog"
 )
 
@@ -20,14 +24,31 @@ type ServiceManager struct {
 	runner    *state.TaskRunner
 	pebbleDir string
 
-	planLock sync.Mutex
-	plan     *plan.Plan
+	planLock   sync.Mutex
+	plan       *plan.Plan
+	dropInDirs []string
 
 	servicesLock sync.Mutex
 	services     map[string]*serviceData
+	history      map[string][]ServiceTransition
 
 	serviceOutput io.Writer
 	restarter     Restarter
+	secrets       secrets.Provider
+	hostEnv       []string
+
+	// Dynamic layers read from the state, restored when the plan is first
+	// loaded; layersSaved reports whether any are currently saved.
+	layersLock  sync.Mutex
+	savedLayers []savedLayer
+	layersSaved bool
+
+	// Dynamic layers kept when the plan is reset, restored when it's loaded
+	// again. Protected by planLock.
+	keptLayers []*plan.Layer
+
+	eventHandlers []func(ServiceEvent)
+	planHandlers  []func(*plan.Plan)
 
 	randLock sync.Mutex
 	rand     *rand.Rand
@@ -47,12 +68,34 @@ func (e *LabelExists) Error() string {
 	return fmt.Sprintf("layer %q already exists", e.Label)
 }
 
+// LabelNotFound is the error returned by RemoveLayer and ReplaceLayer when
+// no layer with that label exists.
+type LabelNotFound struct {
+	Label string
+}
+
+func (e *LabelNotFound) Error() string {
+	return fmt.Sprintf("layer %q not found", e.Label)
+}
+
+// LayerNotDynamic is the error returned by InsertLayer and MoveLayer when a
+// layer they would reorder is from the layers directory, rather than added
+// via the API.
+type LayerNotDynamic struct {
+	Label string
+}
+
+func (e *LayerNotDynamic) Error() string {
+	return fmt.Sprintf("layer %q is from the layers directory and cannot be reordered", e.Label)
+}
+
 func NewManager(s *state.State, runner *state.TaskRunner, pebbleDir string, serviceOutput io.Writer, restarter Restarter) (*ServiceManager, error) {
 	manager := &ServiceManager{
 		state:         s,
 		runner:        runner,
 		pebbleDir:     pebbleDir,
 		services:      make(map[string]*serviceData),
+		history:       make(map[string][]ServiceTransition),
 		serviceOutput: serviceOutput,
 		restarter:     restarter,
 		rand:          rand.New(rand.NewSource(time.Now().UnixNano())),
@@ -60,19 +103,130 @@ func NewManager(s *state.State, runner *state.TaskRunner, pebbleDir string, serv
 
 	runner.AddHandler("start", manager.doStart, nil)
 	runner.AddHandler("stop", manager.doStop, nil)
+	runner.AddHandler("run-hook", manager.doRunHook, nil)
+	runner.AddHandler("reload", manager.doReload, nil)
+
+	s.Lock()
+	err := s.Get(savedLayersKey, &manager.savedLayers)
+	s.Unlock()
+	if err != nil && err != state.ErrNoState {
+		return nil, fmt.Errorf("cannot read saved layers: %w", err)
+	}
+	manager.layersSaved = len(manager.savedLayers) > 0
+
+	// Take over any services left running by a re-exec of the daemon.
+	err = manager.adoptServices()
+	if err != nil {
+		logger.Noticef("Cannot adopt running services: %v", err)
+	}
 
 	return manager, nil
 }
 
 func (m *ServiceManager) reloadPlan() error {
-	p, err := plan.ReadDir(m.pebbleDir)
+	p, err := plan.ReadDir(m.pebbleDir, m.dropInDirs...)
 	if err != nil {
 		return err
 	}
 	m.plan = p
+
+	// Add back the layers that were added via the API before the daemon
+	// restarted, or before the plan was reset by SetDropInDirs, after those
+	// in the layers directory.
+	restored := false
+	for _, saved := range m.savedLayers {
+		layer, err := plan.ParseLayer(0, saved.Label, []byte(saved.Layer))
+		if err != nil {
+			logger.Noticef("Cannot restore layer %q: %v", saved.Label, err)
+			continue
+		}
+		layer.Dynamic = true
+		layer.Persist = true
+		if m.restoreLayer(layer) {
+			restored = true
+		}
+	}
+	for _, layer := range m.keptLayers {
+		if m.restoreLayer(layer) {
+			restored = true
+		}
+	}
+	m.keptLayers = nil
+	m.savedLayers = nil
+	if !restored {
+		m.notifyPlanChanged()
+	}
 	return nil
 }
 
+// restoreLayer appends a dynamic layer when the plan is reloaded, reporting
+// whether it was appended.
+func (m *ServiceManager) restoreLayer(layer *plan.Layer) bool {
+	index, _ := findLayer(m.plan.Layers, layer.Label)
+	if index >= 0 {
+		logger.Noticef("Cannot restore layer %q: a layer with that label already exists", layer.Label)
+		return false
+	}
+	err := m.appendLayer(layer)
+	if err != nil {
+		logger.Noticef("Cannot restore layer %q: %v", layer.Label, err)
+		return false
+	}
+	return true
+}
+
+// NotifyPlanChanged registers f to be called whenever the plan is loaded or
+// updated. It's called with the plan lock held, so it must not call back
+// into the manager.
+func (m *ServiceManager) NotifyPlanChanged(f func(p *plan.Plan)) {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+	m.planHandlers = append(m.planHandlers, f)
+}
+
+// SetSecrets sets the provider that "secret://" references in service
+// environment values are resolved with when the services are started.
+func (m *ServiceManager) SetSecrets(p secrets.Provider) {
+	m.servicesLock.Lock()
+	defer m.servicesLock.Unlock()
+	m.secrets = p
+}
+
+// SetHostEnv sets the patterns (as for path.Match, such as "AWS_*") of the
+// daemon's environment variables that service environment values may refer
+// to as "${HOST:NAME}". By default, none may be referred to.
+func (m *ServiceManager) SetHostEnv(patterns []string) {
+	m.servicesLock.Lock()
+	defer m.servicesLock.Unlock()
+	m.hostEnv = patterns
+}
+
+// SetDropInDirs sets extra directories of drop-in layers, which are combined
+// (in order) after the layers in the pebble directory's "layers" and
+// "layers.d" sub-directories. The plan is read again when next used, keeping
+// the layers added via the API.
+func (m *ServiceManager) SetDropInDirs(dirs []string) {
+	m.planLock.Lock()
+	defer m.planLock.Unlock()
+	m.dropInDirs = dirs
+	if m.plan != nil {
+		for _, layer := range m.plan.Layers {
+			if layer.Dynamic {
+				m.keptLayers = append(m.keptLayers, layer)
+			}
+		}
+	}
+	m.plan = nil
+}
+
+// notifyPlanChanged calls the registered plan handlers. It must be called
+// with the plan lock held.
+func (m *ServiceManager) notifyPlanChanged() {
+	for _, f := range m.planHandlers {
+		f(m.plan)
+	}
+}
+
 // Plan returns the configuration plan.
 func (m *ServiceManager) Plan() (*plan.Plan, error) {
 	releasePlan, err := m.acquirePlan()
@@ -87,18 +241,13 @@ func (m *ServiceManager) Plan() (*plan.Plan, error) {
 // layer.Order field to the new order. If a layer with layer.Label already
 // exists, return an error of type *LabelExists.
 func (m *ServiceManager) AppendLayer(layer *plan.Layer) error {
-	releasePlan, err := m.acquirePlan()
-	if err != nil {
-		return err
-	}
-	defer releasePlan()
-
-	index, _ := findLayer(m.plan.Layers, layer.Label)
-	if index >= 0 {
-		return &LabelExists{Label: layer.Label}
-	}
-
-	return m.appendLayer(layer)
+	return m.updateLayers(func() error {
+		index, _ := findLayer(m.plan.Layers, layer.Label)
+		if index >= 0 {
+			return &LabelExists{Label: layer.Label}
+		}
+		return m.appendLayer(layer)
+	})
 }
 
 func (m *ServiceManager) appendLayer(layer *plan.Layer) error {
@@ -122,10 +271,16 @@ func (m *ServiceManager) updatePlan(layers []*plan.Layer) error {
 	if err != nil {
 		return err
 	}
+	err = combined.ExpandVars()
+	if err != nil {
+		return err
+	}
 	m.plan = &plan.Plan{
 		Layers:   layers,
 		Services: combined.Services,
+		Checks:   combined.Checks,
 	}
+	m.notifyPlanChanged()
 	return nil
 }
 
@@ -143,13 +298,14 @@ func findLayer(layers []*plan.Layer, label string) (int, *plan.Layer) {
 // CombineLayer combines the given layer with an existing layer that has the
 // same label. If no existing layer has the label, append a new one. In either
 // case, update the layer.Order field to the new order.
+//
+// The combined layer keeps whether the existing layer is dynamic and
+// persisted.
 func (m *ServiceManager) CombineLayer(layer *plan.Layer) error {
-	releasePlan, err := m.acquirePlan()
-	if err != nil {
-		return err
-	}
-	defer releasePlan()
+	return m.updateLayers(func() error { return m.combineLayer(layer) })
+}
 
+func (m *ServiceManager) combineLayer(layer *plan.Layer) error {
 	index, found := findLayer(m.plan.Layers, layer.Label)
 	if index < 0 {
 		// No layer found with this label, append new one.
@@ -163,6 +319,8 @@ func (m *ServiceManager) CombineLayer(layer *plan.Layer) error {
 	}
 	combined.Order = found.Order
 	combined.Label = found.Label
+	combined.Dynamic = found.Dynamic
+	combined.Persist = found.Persist
 
 	// Insert combined layer back into plan's layers list.
 	newLayers := make([]*plan.Layer, len(m.plan.Layers))
@@ -176,6 +334,208 @@ func (m *ServiceManager) CombineLayer(layer *plan.Layer) error {
 	return nil
 }
 
+// ReplaceLayer replaces the contents of the existing layer that has the same
+// label as the given layer, keeping its position in the plan's layers, and
+// updates the layer.Order field to that order. If no layer with layer.Label
+// exists, return an error of type *LabelNotFound.
+//
+// Like CombineLayer, the new layer keeps whether the existing layer is
+// dynamic and persisted.
+func (m *ServiceManager) ReplaceLayer(layer *plan.Layer) error {
+	return m.updateLayers(func() error {
+		index, found := findLayer(m.plan.Layers, layer.Label)
+		if index < 0 {
+			return &LabelNotFound{Label: layer.Label}
+		}
+		layer.Dynamic = found.Dynamic
+		layer.Persist = found.Persist
+
+		newLayers := make([]*plan.Layer, len(m.plan.Layers))
+		copy(newLayers, m.plan.Layers)
+		newLayers[index] = layer
+		err := m.updatePlan(newLayers)
+		if err != nil {
+			return err
+		}
+		layer.Order = found.Order
+		return nil
+	})
+}
+
+// RemoveLayer removes the layer with the given label from the plan's layers
+// and re-combines the plan. Services that were only defined by that layer
+// are removed from the plan, but are not stopped. If no layer with the label
+// exists, return an error of type *LabelNotFound.
+func (m *ServiceManager) RemoveLayer(label string) error {
+	return m.updateLayers(func() error {
+		index, _ := findLayer(m.plan.Layers, label)
+		if index < 0 {
+			return &LabelNotFound{Label: label}
+		}
+
+		newLayers := make([]*plan.Layer, 0, len(m.plan.Layers)-1)
+		newLayers = append(newLayers, m.plan.Layers[:index]...)
+		newLayers = append(newLayers, m.plan.Layers[index+1:]...)
+		return m.updatePlan(newLayers)
+	})
+}
+
+// InsertLayer inserts the given dynamic layer before the existing layer
+// labelled before, or appends it if before is empty, and updates the
+// layer.Order field to the new order. The layers after it are renumbered.
+//
+// Dynamic layers always come after the layers from the layers directory, so
+// before must be the label of another dynamic layer (if not, return an
+// error of type *LayerNotDynamic). If a layer with layer.Label already
+// exists, return an error of type *LabelExists; if no layer is labelled
+// before, return an error of type *LabelNotFound.
+func (m *ServiceManager) InsertLayer(layer *plan.Layer, before string) error {
+	return m.updateLayers(func() error {
+		index, _ := findLayer(m.plan.Layers, layer.Label)
+		if index >= 0 {
+			return &LabelExists{Label: layer.Label}
+		}
+		if before == "" {
+			return m.appendLayer(layer)
+		}
+		if !layer.Dynamic {
+			return &LayerNotDynamic{Label: layer.Label}
+		}
+		newLayers, err := placeLayer(m.plan.Layers, layer, before)
+		if err != nil {
+			return err
+		}
+		err = m.updatePlan(newLayers)
+		if err != nil {
+			return err
+		}
+		renumberLayers(newLayers)
+		return nil
+	})
+}
+
+// MoveLayer moves the existing dynamic layer labelled label to before the
+// dynamic layer labelled before, or to the end of the plan's layers if
+// before is empty, renumbering the dynamic layers. If either layer doesn't
+// exist, return an error of type *LabelNotFound, and if either is from the
+// layers directory, an error of type *LayerNotDynamic.
+func (m *ServiceManager) MoveLayer(label, before string) error {
+	return m.updateLayers(func() error {
+		index, layer := findLayer(m.plan.Layers, label)
+		if index < 0 {
+			return &LabelNotFound{Label: label}
+		}
+		if !layer.Dynamic {
+			return &LayerNotDynamic{Label: label}
+		}
+		if label == before {
+			return nil
+		}
+		others := make([]*plan.Layer, 0, len(m.plan.Layers)-1)
+		others = append(others, m.plan.Layers[:index]...)
+		others = append(others, m.plan.Layers[index+1:]...)
+		newLayers, err := placeLayer(others, layer, before)
+		if err != nil {
+			return err
+		}
+		err = m.updatePlan(newLayers)
+		if err != nil {
+			return err
+		}
+		renumberLayers(newLayers)
+		return nil
+	})
+}
+
+// placeLayer returns a copy of layers with layer inserted before the
+// dynamic layer labelled before (or at the end if before is empty).
+func placeLayer(layers []*plan.Layer, layer *plan.Layer, before string) ([]*plan.Layer, error) {
+	index := len(layers)
+	if before != "" {
+		var found *plan.Layer
+		index, found = findLayer(layers, before)
+		if index < 0 {
+			return nil, &LabelNotFound{Label: before}
+		}
+		if !found.Dynamic {
+			return nil, &LayerNotDynamic{Label: before}
+		}
+	}
+	newLayers := make([]*plan.Layer, 0, len(layers)+1)
+	newLayers = append(newLayers, layers[:index]...)
+	newLayers = append(newLayers, layer)
+	newLayers = append(newLayers, layers[index:]...)
+	return newLayers, nil
+}
+
+// renumberLayers renumbers the dynamic layers in order, following on from
+// the last layer from the layers directory.
+func renumberLayers(layers []*plan.Layer) {
+	order := 0
+	for _, layer := range layers {
+		if layer.Dynamic {
+			order++
+			layer.Order = order
+		} else {
+			order = layer.Order
+		}
+	}
+}
+
+// savedLayersKey is the state key under which the dynamic layers that
+// are persisted are saved, so that they're restored when the daemon
+// restarts.
+const savedLayersKey = "layers"
+
+// savedLayer is a dynamic layer saved in the state.
+type savedLayer struct {
+	Label string `json:"label"`
+	// Layer is the layer in YAML format.
+	Layer string `json:"layer"`
+}
+
+// updateLayers calls update with the plan lock held, and then saves the
+// dynamic layers that are persisted in the state.
+func (m *ServiceManager) updateLayers(update func() error) error {
+	// Held while saving too, so that concurrent updates are saved in order.
+	m.layersLock.Lock()
+	defer m.layersLock.Unlock()
+
+	releasePlan, err := m.acquirePlan()
+	if err != nil {
+		return err
+	}
+	err = update()
+	layers := m.plan.Layers
+	releasePlan()
+	if err != nil {
+		return err
+	}
+
+	var saved []savedLayer
+	for _, layer := range layers {
+		if !layer.Dynamic || !layer.Persist {
+			continue
+		}
+		data, err := yaml.Marshal(layer)
+		if err != nil {
+			return fmt.Errorf("cannot save layer %q: %w", layer.Label, err)
+		}
+		saved = append(saved, savedLayer{Label: layer.Label, Layer: string(data)})
+	}
+	if len(saved) == 0 && !m.layersSaved {
+		// Nothing to save (or to remove).
+		return nil
+	}
+	// The plan lock must not be held here, as the state lock is taken
+	// before it elsewhere.
+	m.state.Lock()
+	defer m.state.Unlock()
+	m.state.Set(savedLayersKey, saved)
+	m.layersSaved = len(saved) > 0
+	return nil
+}
+
 func (m *ServiceManager) acquirePlan() (release func(), err error) {
 	m.planLock.Lock()
 	if m.plan == nil {
@@ -204,6 +564,41 @@ type ServiceInfo struct {
 	Name    string
 	Startup ServiceStartup
 	Current ServiceStatus
+
+	// Details of the service's process, only set while it's running
+	PID       int
+	StartTime time.Time
+	CPUTime   time.Duration
+	RSS       int64
+
+	// Number of times the service has been restarted automatically since
+	// it was last started manually, and in total since the daemon started
+	Restarts      int
+	TotalRestarts int
+
+	// How the service's process last exited, or nil if it hasn't yet
+	LastExit *ServiceExit
+
+	// The service's most recent state transitions, oldest first
+	History []ServiceTransition
+}
+
+// ServiceTransition records a service changing state, and why.
+type ServiceTransition struct {
+	Time   time.Time
+	State  string
+	Reason string
+}
+
+// ServiceExit describes how a service's process exited.
+type ServiceExit struct {
+	// Exit code, or 128+signal if it was terminated by a signal
+	Code int
+
+	// Name of the signal that terminated it (such as "SIGKILL"), if any
+	Signal string
+
+	Time time.Time
 }
 
 type ServiceStartup string
@@ -224,6 +619,8 @@ const (
 
 // Services returns the list of configured services and their status, sorted
 // by service name. Filter by the specified service names if provided.
+// Instances of template services are included if they have been started or
+// are requested by name.
 func (m *ServiceManager) Services(names []string) ([]*ServiceInfo, error) {
 	releasePlan, err := m.acquirePlan()
 	if err != nil {
@@ -239,12 +636,27 @@ func (m *ServiceManager) Services(names []string) ([]*ServiceInfo, error) {
 		requested[name] = true
 	}
 
+	candidates := make(map[string]bool)
+	for name := range m.plan.Services {
+		candidates[name] = true
+	}
+	for name := range m.services {
+		candidates[name] = true
+	}
+	for name := range requested {
+		candidates[name] = true
+	}
+
 	var services []*ServiceInfo
 	matchNames := len(names) > 0
-	for name, config := range m.plan.Services {
+	for name := range candidates {
 		if matchNames && !requested[name] {
 			continue
 		}
+		config, ok := m.plan.Service(name)
+		if !ok {
+			continue
+		}
 		info := &ServiceInfo{
 			Name:    name,
 			Startup: StartupDisabled,
@@ -253,18 +665,40 @@ func (m *ServiceManager) Services(names []string) ([]*ServiceInfo, error) {
 		if config.Startup == plan.StartupEnabled {
 			info.Startup = StartupEnabled
 		}
+		if history := m.history[name]; len(history) > 0 {
+			info.History = append([]ServiceTransition(nil), history...)
+		}
 		if s, ok := m.services[name]; ok {
 			switch s.state {
-			case stateInitial, stateStarting, stateRunning:
+			case stateInitial, stateStarting, stateRunning, stateExited:
 				info.Current = StatusActive
 			case stateTerminating, stateKilling, stateStopped:
 				// Already set to inactive above, but it's nice to be explicit for each state
 				info.Current = StatusInactive
 			case stateBackoff:
 				info.Current = StatusBackoff
+			case stateFailed:
+				info.Current = StatusError
 			default:
 				info.Current = StatusError
 			}
+			info.Restarts = s.restartCount
+			info.TotalRestarts = s.totalRestarts
+			if s.lastExit != nil {
+				lastExit := *s.lastExit
+				info.LastExit = &lastExit
+			}
+			if (s.state == stateStarting || s.state == stateRunning) && s.cmd != nil && s.cmd.Process != nil {
+				info.PID = s.cmd.Process.Pid
+				info.StartTime = s.startTime
+				stats, err := readProcessStats(info.PID)
+				if err == nil {
+					info.CPUTime = stats.cpuTime
+					info.RSS = stats.rss
+				} else {
+					logger.Debugf("Cannot read stats for service %q: %v", name, err)
+				}
+			}
 		}
 		services = append(services, info)
 	}
@@ -274,6 +708,40 @@ func (m *ServiceManager) Services(names []string) ([]*ServiceInfo, error) {
 	return services, nil
 }
 
+// ServiceEvent describes a service starting, stopping, exiting (a oneshot
+// service with remain-after-exit completing successfully) or failing.
+type ServiceEvent struct {
+	Service string
+	Kind    ServiceEventKind
+}
+
+type ServiceEventKind string
+
+const (
+	ServiceStarted ServiceEventKind = "started"
+	ServiceStopped ServiceEventKind = "stopped"
+	ServiceExited  ServiceEventKind = "exited"
+	ServiceFailed  ServiceEventKind = "failed"
+)
+
+// NotifyServiceEvents registers f to be called whenever a service starts,
+// stops, exits or fails. It's called with the services lock held, so it must not
+// block or call back into the manager.
+func (m *ServiceManager) NotifyServiceEvents(f func(event ServiceEvent)) {
+	m.servicesLock.Lock()
+	defer m.servicesLock.Unlock()
+	m.eventHandlers = append(m.eventHandlers, f)
+}
+
+// notifyServiceEvent calls the registered event handlers. It must be called
+// with the services lock held.
+func (m *ServiceManager) notifyServiceEvent(name string, kind ServiceEventKind) {
+	event := ServiceEvent{Service: name, Kind: kind}
+	for _, f := range m.eventHandlers {
+		f(event)
+	}
+}
+
 // DefaultServiceNames returns the name of the services set to start
 // by default.
 func (m *ServiceManager) DefaultServiceNames() ([]string, error) {
@@ -368,7 +836,7 @@ func (m *ServiceManager) Replan() ([]string, []string, error) {
 	needsRestart := make(map[string]bool)
 	var stop []string
 	for name, s := range m.services {
-		if config, ok := m.plan.Services[name]; ok {
+		if config, ok := m.plan.Service(name); ok {
 			if config.Equal(s.config) {
 				continue
 			}
@@ -384,6 +852,15 @@ func (m *ServiceManager) Replan() ([]string, []string, error) {
 			start = append(start, name)
 		}
 	}
+	for name := range needsRestart {
+		if _, ok := m.plan.Services[name]; ok {
+			continue
+		}
+		if _, ok := m.plan.Service(name); ok {
+			// Instance of a template service, restart with its new config.
+			start = append(start, name)
+		}
+	}
 
 	stop, err = m.plan.StopOrder(stop)
 	if err != nil {
@@ -403,6 +880,23 @@ func (m *ServiceManager) Replan() ([]string, []string, error) {
 	return stop, start, nil
 }
 
+// PingWatchdog tells the watchdog of the named service that the service is
+// still working, restarting the watchdog interval.
+func (m *ServiceManager) PingWatchdog(name string) error {
+	m.servicesLock.Lock()
+	defer m.servicesLock.Unlock()
+
+	s := m.services[name]
+	if s == nil || (s.state != stateStarting && s.state != stateRunning) {
+		return fmt.Errorf("service %q is not running", name)
+	}
+	if !s.config.Watchdog.IsSet {
+		return fmt.Errorf("service %q has no watchdog", name)
+	}
+	s.armWatchdog()
+	return nil
+}
+
 func (m *ServiceManager) SendSignal(services []string, signal string) error {
 	m.servicesLock.Lock()
 	defer m.servicesLock.Unlock()
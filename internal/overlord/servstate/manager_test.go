@@ -16,19 +16,24 @@ package servstate_test
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log/syslog"
 	"os"
 	"os/exec"
 	"os/user"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
 	"testing"
 	"time"
 
+	"golang.org/x/sys/unix"
 	. "gopkg.in/check.v1"
 	"gopkg.in/yaml.v3"
 
@@ -37,6 +42,7 @@ import (
 	"github.com/canonical/pebble/internal/overlord/servstate"
 	"github.com/canonical/pebble/internal/overlord/state"
 	"github.com/canonical/pebble/internal/plan"
+	"github.com/canonical/pebble/internal/secrets"
 	"github.com/canonical/pebble/internal/testutil"
 )
 
@@ -195,7 +201,7 @@ func (s *S) ensure(c *C, n int) {
 
 func (s *S) startServices(c *C, services []string, nEnsure int) *state.Change {
 	s.st.Lock()
-	ts, err := servstate.Start(s.st, services)
+	ts, err := servstate.Start(s.st, services, sequential(services))
 	c.Check(err, IsNil)
 	chg := s.st.NewChange("test", "Start test")
 	chg.AddAll(ts)
@@ -209,7 +215,7 @@ func (s *S) startServices(c *C, services []string, nEnsure int) *state.Change {
 
 func (s *S) stopServices(c *C, services []string, nEnsure int) *state.Change {
 	s.st.Lock()
-	ts, err := servstate.Stop(s.st, services)
+	ts, err := servstate.Stop(s.st, services, sequential(services))
 	c.Check(err, IsNil)
 	chg := s.st.NewChange("test", "Stop test")
 	chg.AddAll(ts)
@@ -221,6 +227,16 @@ func (s *S) stopServices(c *C, services []string, nEnsure int) *state.Change {
 	return chg
 }
 
+// sequential returns dependencies that start or stop services one after the
+// other, in the given order.
+func sequential(services []string) map[string][]string {
+	deps := make(map[string][]string, len(services))
+	for i := 1; i < len(services); i++ {
+		deps[services[i]] = []string{services[i-1]}
+	}
+	return deps
+}
+
 func (s *S) startTestServices(c *C) {
 	chg := s.startServices(c, []string{"test1", "test2"}, 2)
 	s.st.Lock()
@@ -614,6 +630,77 @@ services:
 	s.planLayersHasLen(c, manager, 3)
 }
 
+func (s *S) TestReplaceAndRemoveLayer(c *C) {
+	dir := c.MkDir()
+	os.Mkdir(filepath.Join(dir, "layers"), 0755)
+	runner := state.NewTaskRunner(s.st)
+	manager, err := servstate.NewManager(s.st, runner, dir, nil, nil)
+	c.Assert(err, IsNil)
+
+	for _, label := range []string{"label1", "label2"} {
+		err = manager.AppendLayer(parseLayer(c, 0, label, `
+services:
+    `+label+`:
+        override: replace
+        command: /bin/sh
+`))
+		c.Assert(err, IsNil)
+	}
+
+	// Replace the first layer, keeping its order.
+	layer := parseLayer(c, 0, "label1", `
+services:
+    svc1:
+        override: replace
+        command: /bin/bash
+`)
+	err = manager.ReplaceLayer(layer)
+	c.Assert(err, IsNil)
+	c.Assert(layer.Order, Equals, 1)
+	c.Assert(planYAML(c, manager), Equals, `
+services:
+    label2:
+        override: replace
+        command: /bin/sh
+    svc1:
+        override: replace
+        command: /bin/bash
+`[1:])
+	s.planLayersHasLen(c, manager, 2)
+
+	// Replacing a layer that doesn't exist is an error.
+	err = manager.ReplaceLayer(parseLayer(c, 0, "label3", "services: {}"))
+	c.Assert(err.(*servstate.LabelNotFound).Label, Equals, "label3")
+
+	// Remove the first layer.
+	err = manager.RemoveLayer("label1")
+	c.Assert(err, IsNil)
+	c.Assert(planYAML(c, manager), Equals, `
+services:
+    label2:
+        override: replace
+        command: /bin/sh
+`[1:])
+	s.planLayersHasLen(c, manager, 1)
+
+	err = manager.RemoveLayer("label1")
+	c.Assert(err.(*servstate.LabelNotFound).Label, Equals, "label1")
+	s.planLayersHasLen(c, manager, 1)
+
+	// Removing a layer that leaves the plan invalid is an error.
+	err = manager.AppendLayer(parseLayer(c, 0, "label3", `
+services:
+    label2:
+        override: merge
+        environment:
+            FOO: foo
+`))
+	c.Assert(err, IsNil)
+	err = manager.RemoveLayer("label2")
+	c.Assert(err, ErrorMatches, `.*"label2".*`)
+	s.planLayersHasLen(c, manager, 2)
+}
+
 func (s *S) TestCombineLayer(c *C) {
 	dir := c.MkDir()
 	os.Mkdir(filepath.Join(dir, "layers"), 0755)
@@ -750,6 +837,14 @@ func (s *S) TestServices(c *C) {
 
 	services, err = s.manager.Services(nil)
 	c.Assert(err, IsNil)
+	// The running service's process details vary, so check them separately.
+	c.Assert(services, HasLen, 5)
+	running := services[1]
+	c.Check(running.PID, Not(Equals), 0)
+	c.Check(time.Since(running.StartTime) < time.Minute, Equals, true)
+	c.Check(running.RSS > 0, Equals, true)
+	c.Check(running.Restarts, Equals, 0)
+	services[1] = &servstate.ServiceInfo{Name: running.Name, Current: running.Current, Startup: running.Startup}
 	c.Assert(services, DeepEquals, []*servstate.ServiceInfo{
 		{Name: "test1", Current: servstate.StatusInactive, Startup: servstate.StartupEnabled},
 		{Name: "test2", Current: servstate.StatusActive, Startup: servstate.StartupDisabled},
@@ -805,6 +900,337 @@ PEBBLE_ENV_TEST_PARENT=from-parent
 `[1:])
 }
 
+func (s *S) TestEnvironmentFiles(c *C) {
+	dir := c.MkDir()
+	logPath := filepath.Join(dir, "log.txt")
+	envPath := filepath.Join(dir, "env")
+	err := ioutil.WriteFile(envPath, []byte("PEBBLE_ENVFILE_TEST_2=from-file\nPEBBLE_ENVFILE_TEST_3='secret'\n"), 0600)
+	c.Assert(err, IsNil)
+	layer := parseLayer(c, 0, "envlayer", fmt.Sprintf(`
+services:
+    envtest:
+        override: replace
+        command: /bin/sh -c "env | grep PEBBLE_ENVFILE_TEST | sort > %s; sleep 300"
+        environment:
+            PEBBLE_ENVFILE_TEST_1: foo
+            PEBBLE_ENVFILE_TEST_2: bar
+        environment-files:
+            - %s
+            - -%s/missing
+`, logPath, envPath, dir))
+	err = s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"envtest"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	data, err := ioutil.ReadFile(logPath)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, `
+PEBBLE_ENVFILE_TEST_1=foo
+PEBBLE_ENVFILE_TEST_2=from-file
+PEBBLE_ENVFILE_TEST_3=secret
+`[1:])
+}
+
+func (s *S) TestStartWithArgs(c *C) {
+	logPath := filepath.Join(c.MkDir(), "log.txt")
+	layer := parseLayer(c, 0, "argslayer", fmt.Sprintf(`
+services:
+    argstest:
+        override: replace
+        command: /bin/sh -c 'echo "$*" > %s; sleep 300' sh [ --default ]
+`, logPath))
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"argstest"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+	s.waitForLogLine(c, logPath, "--default\n")
+
+	chg = s.stopServices(c, []string{"argstest"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	s.st.Lock()
+	ts, err := servstate.StartWithArgs(s.st, []string{"argstest"}, nil, map[string][]string{
+		"argstest": {"--port", "8080"},
+	})
+	c.Assert(err, IsNil)
+	chg = s.st.NewChange("test", "Start test")
+	chg.AddAll(ts)
+	s.st.Unlock()
+	s.ensure(c, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+	s.waitForLogLine(c, logPath, "--port 8080\n")
+}
+
+// waitForLogLine waits for the file at path to have the given content.
+func (s *S) waitForLogLine(c *C, path, content string) {
+	for i := 0; ; i++ {
+		data, _ := ioutil.ReadFile(path)
+		if string(data) == content {
+			return
+		}
+		if i >= 100 {
+			c.Fatalf("timed out waiting for %q in %s, got %q", content, path, data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *S) TestWorkingDir(c *C) {
+	dir := c.MkDir()
+	logPath := filepath.Join(dir, "log.txt")
+	workingDir := filepath.Join(dir, "work")
+	c.Assert(os.Mkdir(workingDir, 0755), IsNil)
+	layer := parseLayer(c, 0, "layer", fmt.Sprintf(`
+services:
+    wdtest:
+        override: replace
+        command: /bin/sh -c "pwd > %s; sleep 300"
+        working-dir: %s
+`, logPath, workingDir))
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"wdtest"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+	s.waitForLogLine(c, logPath, workingDir+"\n")
+}
+
+func (s *S) TestOkayDelay(c *C) {
+	// The service exits well after the (short) default okay-wait, but within
+	// its own okay-delay, so its start fails.
+	layer := parseLayer(c, 0, "layer", `
+services:
+    slowfail:
+        override: replace
+        command: /bin/sh -c "sleep 0.2; exit 3"
+        okay-delay: 5s
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"slowfail"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot start service: exited quickly with code 3.*`)
+	s.st.Unlock()
+
+	svc := s.serviceByName(c, "slowfail")
+	c.Assert(svc.Current, Equals, servstate.StatusInactive)
+}
+
+func (s *S) TestStopSignal(c *C) {
+	dir := c.MkDir()
+	logPath := filepath.Join(dir, "log.txt")
+	layer := parseLayer(c, 0, "layer", fmt.Sprintf(`
+services:
+    sigtest:
+        override: replace
+        command: /bin/sh -c 'trap "echo INT > %s; exit 0" INT; while true; do sleep 0.1; done'
+        stop-signal: SIGINT
+`, logPath))
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"sigtest"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	chg = s.stopServices(c, []string{"sigtest"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+	s.waitForLogLine(c, logPath, "INT\n")
+}
+
+func (s *S) TestKillModeProcess(c *C) {
+	restore := servstate.FakeOutputWait(10 * time.Millisecond)
+	defer restore()
+
+	dir := c.MkDir()
+	pidPath := filepath.Join(dir, "pid.txt")
+	layer := parseLayer(c, 0, "layer", fmt.Sprintf(`
+services:
+    leader:
+        override: replace
+        command: /bin/sh -c 'sleep 300 & echo $! > %s; wait'
+        kill-mode: process
+`, pidPath))
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"leader"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	var childPid int
+	for i := 0; ; i++ {
+		data, _ := ioutil.ReadFile(pidPath)
+		if n, err := fmt.Sscanf(string(data), "%d\n", &childPid); n == 1 && err == nil {
+			break
+		}
+		if i >= 100 {
+			c.Fatalf("timed out waiting for child PID in %s", pidPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer syscall.Kill(childPid, syscall.SIGKILL)
+
+	chg = s.stopServices(c, []string{"leader"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	// Only the leader was signalled, so its child is still running.
+	c.Check(syscall.Kill(childPid, 0), IsNil)
+}
+
+func (s *S) TestEnvironmentSecrets(c *C) {
+	dir := c.MkDir()
+	logPath := filepath.Join(dir, "log.txt")
+	c.Assert(os.Mkdir(filepath.Join(dir, "db"), 0700), IsNil)
+	// Secret values are used as-is, without expanding host variables.
+	err := ioutil.WriteFile(filepath.Join(dir, "db", "password"), []byte("s3cret$${HOST:A}${HOST:B}\n"), 0600)
+	c.Assert(err, IsNil)
+	s.manager.SetSecrets(secrets.Dir(dir))
+
+	// Secrets in the daemon's environment that the service doesn't refer to
+	// aren't visible to it.
+	os.Setenv("PEBBLE_SECRET_TEST_UNUSED", "l3ak")
+	defer os.Unsetenv("PEBBLE_SECRET_TEST_UNUSED")
+
+	layer := parseLayer(c, 0, "envlayer", fmt.Sprintf(`
+services:
+    envtest:
+        override: replace
+        command: /bin/sh -c "env | grep PEBBLE_SECRET_TEST | sort > %s; sleep 300"
+        environment:
+            PEBBLE_SECRET_TEST_PASS: secret://db/password
+`, logPath))
+	err = s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"envtest"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	data, err := ioutil.ReadFile(logPath)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "PEBBLE_SECRET_TEST_PASS=s3cret$${HOST:A}${HOST:B}\n")
+
+	// The plan only has the reference.
+	p, err := s.manager.Plan()
+	c.Assert(err, IsNil)
+	c.Check(p.Services["envtest"].Environment["PEBBLE_SECRET_TEST_PASS"], Equals, "secret://db/password")
+}
+
+func (s *S) TestEnvironmentHostVars(c *C) {
+	logPath := filepath.Join(c.MkDir(), "log.txt")
+	os.Setenv("PEBBLE_TEST_HOST_KEY", "k3y")
+	defer os.Unsetenv("PEBBLE_TEST_HOST_KEY")
+	s.manager.SetHostEnv([]string{"PEBBLE_TEST_HOST_*"})
+
+	layer := parseLayer(c, 0, "envlayer", fmt.Sprintf(`
+services:
+    envtest:
+        override: replace
+        command: /bin/sh -c "env | grep PEBBLE_TEST_SERVICE | sort > %s; sleep 300"
+        environment:
+            PEBBLE_TEST_SERVICE_KEY: key=${HOST:PEBBLE_TEST_HOST_KEY}
+            PEBBLE_TEST_SERVICE_UNSET: ${HOST:PEBBLE_TEST_HOST_UNSET}
+`, logPath))
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"envtest"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	data, err := ioutil.ReadFile(logPath)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "PEBBLE_TEST_SERVICE_KEY=key=k3y\nPEBBLE_TEST_SERVICE_UNSET=\n")
+
+	// The plan only has the reference.
+	p, err := s.manager.Plan()
+	c.Assert(err, IsNil)
+	c.Check(p.Services["envtest"].Environment["PEBBLE_TEST_SERVICE_KEY"], Equals, "key=${HOST:PEBBLE_TEST_HOST_KEY}")
+}
+
+func (s *S) TestEnvironmentHostVarNotAllowed(c *C) {
+	layer := parseLayer(c, 0, "envlayer", `
+services:
+    envtest:
+        override: replace
+        command: /bin/sh -c "sleep 300"
+        environment:
+            PATH_COPY: ${HOST:PATH}
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"envtest"}, 1)
+	s.st.Lock()
+	defer s.st.Unlock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot set environment variable "PATH_COPY": host variable "PATH" is not in the allowlist.*`)
+}
+
+func (s *S) TestEnvironmentSecretNotFound(c *C) {
+	s.manager.SetSecrets(secrets.Dir(c.MkDir()))
+	layer := parseLayer(c, 0, "envlayer", `
+services:
+    envtest:
+        override: replace
+        command: /bin/sh -c "sleep 300"
+        environment:
+            PASS: secret://db/password
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"envtest"}, 1)
+	s.st.Lock()
+	defer s.st.Unlock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot set environment variable "PASS": secret "db/password" not found.*`)
+}
+
+func (s *S) TestEnvironmentFileMissing(c *C) {
+	envPath := filepath.Join(c.MkDir(), "missing")
+	layer := parseLayer(c, 0, "envlayer", fmt.Sprintf(`
+services:
+    envtest:
+        override: replace
+        command: /bin/sh -c "sleep 300"
+        environment-files:
+            - %s
+`, envPath))
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"envtest"}, 1)
+	s.st.Lock()
+	defer s.st.Unlock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot read environment file: open .*/missing: no such file or directory.*`)
+}
+
 type writerFunc func([]byte) (int, error)
 
 func (f writerFunc) Write(p []byte) (int, error) {
@@ -844,12 +1270,19 @@ services:
 	s.waitUntilService(c, "test2", func(svc *servstate.ServiceInfo) bool {
 		return svc.Current == servstate.StatusBackoff && s.manager.BackoffNum("test2") == 1
 	})
+	svc := s.serviceByName(c, "test2")
+	c.Assert(svc.LastExit, NotNil)
+	c.Check(svc.LastExit.Code, Equals, 128+int(syscall.SIGTERM))
+	c.Check(svc.LastExit.Signal, Equals, "SIGTERM")
+	c.Check(time.Since(svc.LastExit.Time) < time.Minute, Equals, true)
 
 	// Then wait for it to auto-restart (backoff time plus a bit).
 	time.Sleep(75 * time.Millisecond)
-	svc := s.serviceByName(c, "test2")
+	svc = s.serviceByName(c, "test2")
 	c.Assert(svc.Current, Equals, servstate.StatusActive)
 	c.Check(s.logBufferString(), Matches, `2.* \[test2\] test2\n`)
+	c.Check(svc.Restarts, Equals, 1)
+	c.Check(svc.TotalRestarts, Equals, 1)
 
 	// Send signal to terminate it again.
 	err = s.manager.SendSignal([]string{"test2"}, "SIGTERM")
@@ -865,6 +1298,8 @@ services:
 	svc = s.serviceByName(c, "test2")
 	c.Assert(svc.Current, Equals, servstate.StatusActive)
 	c.Check(s.logBufferString(), Matches, `2.* \[test2\] test2\n`)
+	c.Check(svc.Restarts, Equals, 2)
+	c.Check(svc.TotalRestarts, Equals, 2)
 
 	// Test that backoff reset time is working (set to backoff-limit)
 	time.Sleep(175 * time.Millisecond)
@@ -884,11 +1319,57 @@ services:
 	svc = s.serviceByName(c, "test2")
 	c.Assert(svc.Current, Equals, servstate.StatusActive)
 	c.Check(s.logBufferString(), Matches, `2.* \[test2\] test2\n`)
+	c.Check(svc.TotalRestarts, Equals, 3)
+
+	// Starting it manually resets the count of recent restarts, but not
+	// the total.
+	s.stopServices(c, []string{"test2"}, 1)
+	s.startServices(c, []string{"test2"}, 1)
+	svc = s.serviceByName(c, "test2")
+	c.Assert(svc.Current, Equals, servstate.StatusActive)
+	c.Check(svc.Restarts, Equals, 0)
+	c.Check(svc.TotalRestarts, Equals, 3)
 }
 
-func (s *S) TestStopDuringBackoff(c *C) {
-	layer := parseLayer(c, 0, "layer", `
-services:
+func (s *S) TestServiceHistory(c *C) {
+	s.startServices(c, []string{"test2"}, 1)
+	s.waitUntilService(c, "test2", func(svc *servstate.ServiceInfo) bool {
+		return svc.Current == servstate.StatusActive
+	})
+	s.stopServices(c, []string{"test2"}, 1)
+
+	svc := s.serviceByName(c, "test2")
+	var states, reasons []string
+	for _, t := range svc.History {
+		c.Check(time.Since(t.Time) < time.Minute, Equals, true)
+		states = append(states, t.State)
+		reasons = append(reasons, t.Reason)
+	}
+	c.Check(states, DeepEquals, []string{"starting", "running", "terminating", "stopped"})
+	c.Check(reasons, DeepEquals, []string{
+		"process started",
+		"running after okay-delay",
+		"stop requested, sent SIGTERM",
+		"stopped, killed by SIGTERM",
+	})
+
+	// The history is kept when the service is started again, but only the
+	// most recent transitions are kept.
+	for i := 0; len(svc.History) < servstate.MaxServiceHistory; i++ {
+		s.startServices(c, []string{"test2"}, 1)
+		s.stopServices(c, []string{"test2"}, 1)
+		svc = s.serviceByName(c, "test2")
+	}
+	s.startServices(c, []string{"test2"}, 1)
+	svc = s.serviceByName(c, "test2")
+	c.Assert(svc.History, HasLen, servstate.MaxServiceHistory)
+	last := svc.History[len(svc.History)-1]
+	c.Check(last.State, Equals, "running")
+}
+
+func (s *S) TestStopDuringBackoff(c *C) {
+	layer := parseLayer(c, 0, "layer", `
+services:
     test2:
         override: merge
         command: sleep 0.1
@@ -921,6 +1402,86 @@ services:
 	})
 }
 
+func (s *S) TestStartLimit(c *C) {
+	layer := parseLayer(c, 0, "layer", `
+services:
+    test2:
+        override: merge
+        command: sleep 0.1
+        backoff-delay: 10ms
+        backoff-limit: 10ms
+        start-limit-burst: 1
+        start-limit-interval: 10s
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"test2"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	// It's restarted once, and then put in the failed state when it exits
+	// again, with a notice recorded.
+	for i := 0; ; i++ {
+		s.st.Lock()
+		notices := s.st.Notices(&state.NoticeFilter{Types: []state.NoticeType{state.StartLimitNotice}})
+		s.st.Unlock()
+		if len(notices) > 0 {
+			c.Check(notices[0].Key(), Equals, "test2")
+			break
+		}
+		if i >= 100 {
+			c.Fatalf("timed out waiting for start-limit notice")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Check(s.serviceByName(c, "test2").Current, Equals, servstate.StatusError)
+
+	// It stays failed until started explicitly.
+	time.Sleep(50 * time.Millisecond)
+	c.Check(s.serviceByName(c, "test2").Current, Equals, servstate.StatusError)
+	chg = s.startServices(c, []string{"test2"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+	c.Check(s.serviceByName(c, "test2").Current, Equals, servstate.StatusActive)
+}
+
+func (s *S) TestWatchdog(c *C) {
+	layer := parseLayer(c, 0, "layer", `
+services:
+    test2:
+        override: merge
+        command: sleep 10
+        watchdog: 100ms
+        on-failure: ignore
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"test2"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	// Pinging the watchdog keeps the service running.
+	for i := 0; i < 10; i++ {
+		c.Assert(s.manager.PingWatchdog("test2"), IsNil)
+		time.Sleep(30 * time.Millisecond)
+	}
+	c.Check(s.serviceByName(c, "test2").Current, Equals, servstate.StatusActive)
+
+	// Once it's no longer pinged, it's killed as hung.
+	for i := 0; s.serviceByName(c, "test2").Current != servstate.StatusInactive; i++ {
+		if i >= 100 {
+			c.Fatalf("timed out waiting for service to be killed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Check(s.manager.PingWatchdog("test2"), ErrorMatches, `service "test2" is not running`)
+}
+
 func (s *S) waitUntilService(c *C, service string, f func(svc *servstate.ServiceInfo) bool) {
 	for i := 0; i < 20; i++ {
 		svc := s.serviceByName(c, service)
@@ -985,6 +1546,404 @@ services:
 	})
 }
 
+func (s *S) TestOneshot(c *C) {
+	layer := parseLayer(c, 0, "layer", `
+services:
+    init1:
+        override: replace
+        command: /bin/sh -c "sleep 0.1; echo init1"
+        kind: oneshot
+    init2:
+        override: replace
+        command: /bin/sh -c "sleep 0.1; echo init2"
+        kind: oneshot
+        remain-after-exit: true
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	// The start task only completes once the service has exited (which is
+	// longer than the okay-wait used for regular services).
+	chg := s.startServices(c, []string{"init1", "init2"}, 2)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	c.Check(s.serviceByName(c, "init1").Current, Equals, servstate.StatusInactive)
+	c.Check(s.serviceByName(c, "init2").Current, Equals, servstate.StatusActive)
+
+	// Stopping a one-shot service that remains after exit makes it inactive.
+	chg = s.stopServices(c, []string{"init2"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+	c.Check(s.serviceByName(c, "init2").Current, Equals, servstate.StatusInactive)
+}
+
+func (s *S) TestOneshotFailure(c *C) {
+	layer := parseLayer(c, 0, "layer", `
+services:
+    init1:
+        override: replace
+        command: /bin/sh -c "sleep 0.1; echo failed; exit 3"
+        kind: oneshot
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"init1"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*\n- Start service "init1" \(cannot start service: exited with code 3\)`)
+	c.Check(chg.Tasks()[0].Log()[0], Matches, `(?s).* INFO Most recent service output:\n    failed`)
+	s.st.Unlock()
+
+	c.Check(s.serviceByName(c, "init1").Current, Equals, servstate.StatusInactive)
+}
+
+func (s *S) TestReadyChecks(c *C) {
+	restore := servstate.FakeReadyRetryDelay(10 * time.Millisecond)
+	defer restore()
+
+	readyFile := filepath.Join(s.dir, "ready")
+	layer := parseLayer(c, 0, "layer", fmt.Sprintf(`
+services:
+    db:
+        override: replace
+        command: /bin/sh -c "sleep 0.2; touch %[1]s; sleep 300"
+        ready-checks:
+            - db-ready
+    web:
+        override: replace
+        command: /bin/sh -c "test -f %[1]s && echo web ready; sleep 300"
+        requires:
+            - db
+        after:
+            - db
+checks:
+    db-ready:
+        override: replace
+        exec:
+            command: test -f %[1]s
+`, readyFile))
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	// Web is only started once db's ready check passes (well after the
+	// okay-wait has elapsed).
+	chg := s.startServices(c, []string{"db", "web"}, 2)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	c.Check(chg.Tasks()[0].Log()[0], Matches, `.* INFO Waiting for service "db" to be ready.`)
+	s.st.Unlock()
+
+	c.Check(s.manager.RunningCmds(), HasLen, 2)
+	c.Check(s.logBufferString(), Matches, `(?s).*\[web\] web ready\n.*`)
+
+	s.stopServices(c, []string{"db", "web"}, 2)
+}
+
+func (s *S) TestReadyChecksTimeout(c *C) {
+	restore := servstate.FakeReadyRetryDelay(10 * time.Millisecond)
+	defer restore()
+
+	layer := parseLayer(c, 0, "layer", `
+services:
+    db:
+        override: replace
+        command: /bin/sh -c "sleep 300"
+        ready-checks:
+            - db-ready
+        ready-timeout: 200ms
+    web:
+        override: replace
+        command: /bin/sh -c "sleep 300"
+        requires:
+            - db
+        after:
+            - db
+checks:
+    db-ready:
+        override: replace
+        exec:
+            command: /bin/sh -c "exit 1"
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"db", "web"}, 2)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*\n- Start service "db" \(service not ready after 200ms: check "db-ready" failed: exit status 1\)`)
+	s.st.Unlock()
+
+	// The service whose checks failed is left running, but the services
+	// that depend on it aren't started.
+	c.Check(s.serviceByName(c, "db").Current, Equals, servstate.StatusActive)
+	c.Check(s.serviceByName(c, "web").Current, Equals, servstate.StatusInactive)
+
+	s.stopServices(c, []string{"db"}, 1)
+}
+
+func (s *S) TestLogTo(c *C) {
+	logPath := filepath.Join(s.dir, "logs", "echo.log")
+	layer := parseLayer(c, 0, "layer", fmt.Sprintf(`
+services:
+    echo:
+        override: replace
+        command: /bin/sh -c "echo hello; sleep 300"
+        log-to:
+            path: %s
+`, logPath))
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"echo"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	s.stopServices(c, []string{"echo"}, 1)
+
+	data, err := ioutil.ReadFile(logPath)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Matches, `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{3}Z \[echo\] hello\n`)
+	c.Check(s.logBufferString(), Matches, `(?s).*\[echo\] hello\n.*`)
+}
+
+type fakeJournal struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (j *fakeJournal) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.buf.Write(p)
+}
+
+func (j *fakeJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.closed = true
+	return nil
+}
+
+func (s *S) TestLogToJournald(c *C) {
+	journal := &fakeJournal{}
+	var identifier string
+	restore := servstate.FakeNewJournalWriter(func(id string, priority syslog.Priority) (io.WriteCloser, error) {
+		identifier = id
+		c.Check(priority, Equals, syslog.LOG_INFO)
+		return journal, nil
+	})
+	defer restore()
+
+	layer := parseLayer(c, 0, "layer", `
+services:
+    echo:
+        override: replace
+        command: /bin/sh -c "echo hello; sleep 300"
+        log-to-journald: true
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"echo"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	s.stopServices(c, []string{"echo"}, 1)
+
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	c.Check(identifier, Equals, "echo")
+	c.Check(journal.buf.String(), Equals, "hello\n")
+	c.Check(journal.closed, Equals, true)
+	c.Check(s.logBufferString(), Matches, `(?s).*\[echo\] hello\n.*`)
+}
+
+func (s *S) TestLogToJournaldUnavailable(c *C) {
+	restore := servstate.FakeNewJournalWriter(func(id string, priority syslog.Priority) (io.WriteCloser, error) {
+		return nil, errors.New("no journal")
+	})
+	defer restore()
+
+	layer := parseLayer(c, 0, "layer", `
+services:
+    echo:
+        override: replace
+        command: /bin/sh -c "echo hello; sleep 300"
+        log-to-journald: true
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"echo"}, 1)
+	s.st.Lock()
+	defer s.st.Unlock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot connect to journal: no journal.*`)
+}
+
+func (s *S) TestSeccomp(c *C) {
+	layer := parseLayer(c, 0, "layer", `
+services:
+    confined:
+        override: replace
+        command: /bin/sh -c "grep ^Seccomp /proc/self/status; sleep 300"
+        seccomp: default
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"confined"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	s.stopServices(c, []string{"confined"}, 1)
+	c.Check(s.logBufferString(), Matches, `(?s).*\[confined\] Seccomp:\s+2\n.*`)
+}
+
+func (s *S) TestUmask(c *C) {
+	layer := parseLayer(c, 0, "layer", `
+services:
+    masked:
+        override: replace
+        command: /bin/sh -c "umask; sleep 300"
+        umask: 027
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"masked"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	s.stopServices(c, []string{"masked"}, 1)
+	c.Check(s.logBufferString(), Matches, `(?s).*\[masked\] 0027\n.*`)
+}
+
+func (s *S) TestMounts(c *C) {
+	if os.Getuid() != 0 {
+		c.Skip("requires root to create a mount namespace")
+	}
+	source := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(source, "file"), []byte("mounted\n"), 0644)
+	c.Assert(err, IsNil)
+	target := c.MkDir()
+
+	layer := parseLayer(c, 0, "layer", fmt.Sprintf(`
+services:
+    mounter:
+        override: replace
+        command: /bin/sh -c "cat %s/file; sleep 300"
+        mounts:
+            - source: %s
+              target: %s
+              read-only: true
+`, target, source, target))
+	err = s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"mounter"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	s.stopServices(c, []string{"mounter"}, 1)
+	c.Check(s.logBufferString(), Matches, `(?s).*\[mounter\] mounted\n.*`)
+}
+
+func (s *S) TestServiceEvents(c *C) {
+	var mu sync.Mutex
+	var events []servstate.ServiceEvent
+	s.manager.NotifyServiceEvents(func(event servstate.ServiceEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	})
+
+	layer := parseLayer(c, 0, "layer", `
+services:
+    init1:
+        override: replace
+        command: /bin/sh -c "sleep 0.1; exit 3"
+        kind: oneshot
+    init2:
+        override: replace
+        command: /bin/sh -c "sleep 0.1"
+        kind: oneshot
+        remain-after-exit: true
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	s.startTestServices(c)
+	s.stopTestServices(c)
+	s.startServices(c, []string{"init1"}, 1)
+	s.startServices(c, []string{"init2"}, 1)
+
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(events, HasLen, 6)
+	// The services are stopped concurrently, so sort those events.
+	stops := events[2:4]
+	sort.Slice(stops, func(i, j int) bool {
+		return stops[i].Service < stops[j].Service
+	})
+	c.Check(events, DeepEquals, []servstate.ServiceEvent{
+		{Service: "test1", Kind: servstate.ServiceStarted},
+		{Service: "test2", Kind: servstate.ServiceStarted},
+		{Service: "test1", Kind: servstate.ServiceStopped},
+		{Service: "test2", Kind: servstate.ServiceStopped},
+		{Service: "init1", Kind: servstate.ServiceFailed},
+		{Service: "init2", Kind: servstate.ServiceExited},
+	})
+}
+
+func (s *S) TestTemplateInstances(c *C) {
+	layer := parseLayer(c, 0, "layer", `
+services:
+    worker@:
+        override: replace
+        command: /bin/sh -c "echo worker %i $WORKER_NAME; sleep 300"
+        environment:
+            WORKER_NAME: name-%i
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"worker@1", "worker@2"}, 2)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	cmds := s.manager.RunningCmds()
+	c.Check(cmds, HasLen, 2)
+	c.Check(s.manager.Config("worker@2").Command, Equals, plan.ServiceCommand(`/bin/sh -c "echo worker 2 $WORKER_NAME; sleep 300"`))
+	logs := s.logBufferString()
+	c.Check(logs, Matches, `(?s).*\[worker@1\] worker 1 name-1\n.*`)
+	c.Check(logs, Matches, `(?s).*\[worker@2\] worker 2 name-2\n.*`)
+
+	services, err := s.manager.Services([]string{"worker@", "worker@1", "worker@3"})
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 3)
+	c.Check(services[0].Name, Equals, "worker@")
+	c.Check(services[0].Current, Equals, servstate.StatusInactive)
+	c.Check(services[1].Name, Equals, "worker@1")
+	c.Check(services[1].Current, Equals, servstate.StatusActive)
+	c.Check(services[2].Name, Equals, "worker@3")
+	c.Check(services[2].Current, Equals, servstate.StatusInactive)
+
+	s.stopServices(c, []string{"worker@1", "worker@2"}, 2)
+	c.Check(s.manager.RunningCmds(), HasLen, 0)
+}
+
 func (s *S) TestGetAction(c *C) {
 	tests := []struct {
 		onSuccess plan.ServiceAction
@@ -1098,3 +2057,546 @@ func (s *S) TestCalculateNextBackoff(c *C) {
 			test.delay, test.factor, test.limit, test.current))
 	}
 }
+
+func (s *S) TestPrepareReexec(c *C) {
+	s.startTestServices(c)
+	if c.Failed() {
+		return
+	}
+	defer s.stopTestServices(c)
+
+	err := s.manager.PrepareReexec()
+	c.Assert(err, IsNil)
+
+	var services []struct {
+		PID    int           `json:"pid"`
+		LogFD  int           `json:"log-fd"`
+		Config *plan.Service `json:"config"`
+	}
+	s.st.Lock()
+	err = s.st.Get("reexec-services", &services)
+	s.st.Unlock()
+	c.Assert(err, IsNil)
+	c.Assert(services, HasLen, 2)
+
+	cmds := s.manager.RunningCmds()
+	for _, service := range services {
+		cmd := cmds[service.Config.Name]
+		c.Assert(cmd, NotNil, Commentf("service %q", service.Config.Name))
+		c.Check(service.PID, Equals, cmd.Process.Pid)
+		flags, err := unix.FcntlInt(uintptr(service.LogFD), unix.F_GETFD, 0)
+		c.Assert(err, IsNil)
+		c.Check(flags&unix.FD_CLOEXEC, Equals, 0)
+	}
+}
+
+func (s *S) TestAdoptServices(c *C) {
+	// Start a process the way a previous daemon process would have.
+	logReader, logPipe, err := os.Pipe()
+	c.Assert(err, IsNil)
+	cmd := exec.Command("/bin/sh", "-c", "echo adopted; sleep 10")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stdout = logPipe
+	cmd.Stderr = logPipe
+	c.Assert(cmd.Start(), IsNil)
+	logPipe.Close()
+	logFD, err := unix.Dup(int(logReader.Fd()))
+	c.Assert(err, IsNil)
+	logReader.Close()
+
+	s.st.Lock()
+	s.st.Set("reexec-services", []map[string]interface{}{{
+		"pid":    cmd.Process.Pid,
+		"log-fd": logFD,
+		"config": &plan.Service{Name: "test2", Command: "/bin/sh -c 'echo adopted; sleep 10'"},
+	}})
+	s.st.Unlock()
+
+	// Create a new manager, as the re-executed daemon would.
+	s.runner = state.NewTaskRunner(s.st)
+	manager, err := servstate.NewManager(s.st, s.runner, s.dir, nil, testRestarter{s.stopDaemon})
+	c.Assert(err, IsNil)
+	s.manager = manager
+
+	s.st.Lock()
+	var services []interface{}
+	c.Check(s.st.Get("reexec-services", &services), Equals, state.ErrNoState)
+	s.st.Unlock()
+
+	svc := s.serviceByName(c, "test2")
+	c.Check(svc.Current, Equals, servstate.StatusActive)
+	cmds := s.manager.RunningCmds()
+	c.Assert(cmds["test2"], NotNil)
+	c.Check(cmds["test2"].Process.Pid, Equals, cmd.Process.Pid)
+
+	// Output from the process is read from the inherited pipe.
+	iterators, err := s.manager.ServiceLogs([]string{"test2"}, -1)
+	c.Assert(err, IsNil)
+	it := iterators["test2"]
+	c.Assert(it, NotNil)
+	done := make(chan struct{})
+	time.AfterFunc(5*time.Second, func() { close(done) })
+	buf := &bytes.Buffer{}
+	for !strings.Contains(buf.String(), "[test2] adopted") && it.Next(done) {
+		_, err = io.Copy(buf, it)
+		c.Assert(err, IsNil)
+	}
+	c.Check(buf.String(), Matches, `(?s).*\[test2\] adopted\n`)
+	c.Assert(it.Close(), IsNil)
+
+	// The adopted service can be stopped as usual.
+	chg := s.stopServices(c, []string{"test2"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+	svc = s.serviceByName(c, "test2")
+	c.Check(svc.Current, Equals, servstate.StatusInactive)
+}
+
+func (s *S) TestRestoreServices(c *C) {
+	// Services without a process are handed over with just their state.
+	s.st.Lock()
+	s.st.Set("reexec-services", []map[string]interface{}{{
+		"state":      "exited",
+		"config":     &plan.Service{Name: "test1", Command: "/bin/sh -c 'exit 0'"},
+		"start-time": time.Now(),
+	}, {
+		"state":        "backoff",
+		"config":       &plan.Service{Name: "test2", Command: "/bin/sh -c 'exit 1'"},
+		"restarts":     2,
+		"start-time":   time.Now(),
+		"backoff-num":  3,
+		"backoff-time": time.Hour,
+	}})
+	s.st.Unlock()
+
+	s.runner = state.NewTaskRunner(s.st)
+	manager, err := servstate.NewManager(s.st, s.runner, s.dir, nil, testRestarter{s.stopDaemon})
+	c.Assert(err, IsNil)
+	s.manager = manager
+
+	c.Check(s.serviceByName(c, "test1").Current, Equals, servstate.StatusActive)
+	svc := s.serviceByName(c, "test2")
+	c.Check(svc.Current, Equals, servstate.StatusBackoff)
+	c.Check(svc.Restarts, Equals, 2)
+
+	// A restored service in backoff can be stopped as usual.
+	chg := s.stopServices(c, []string{"test2"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+	c.Check(s.serviceByName(c, "test2").Current, Equals, servstate.StatusInactive)
+}
+
+// runHookTasks runs the given start or stop tasks (with the hooks from the
+// manager's plan) in a change, and returns it.
+func (s *S) runHookTasks(c *C, stop bool, services []string, nEnsure int) *state.Change {
+	p, err := s.manager.Plan()
+	c.Assert(err, IsNil)
+	s.st.Lock()
+	var ts *state.TaskSet
+	if stop {
+		ts, err = servstate.StopWithHooks(s.st, p, services, sequential(services))
+	} else {
+		ts, err = servstate.StartWithHooks(s.st, p, services, sequential(services), nil)
+	}
+	c.Check(err, IsNil)
+	chg := s.st.NewChange("test", "Hooks test")
+	chg.AddAll(ts)
+	s.st.Unlock()
+
+	s.ensure(c, nEnsure)
+	return chg
+}
+
+func (s *S) TestHooks(c *C) {
+	dir := c.MkDir()
+	logPath := filepath.Join(dir, "log.txt")
+	layer := parseLayer(c, 0, "layer", fmt.Sprintf(`
+services:
+    hooked:
+        override: replace
+        command: /bin/sh -c "echo service >> %[1]s; sleep 10"
+        environment:
+            WHO: hook
+        hooks:
+            pre-start:
+                command: /bin/sh -c "echo pre-start $WHO >> %[1]s; echo migrated"
+            post-start:
+                command: /bin/sh -c "echo post-start >> %[1]s"
+            post-stop:
+                command: /bin/sh -c "echo post-stop >> %[1]s"
+`, logPath))
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.runHookTasks(c, false, []string{"hooked"}, 3)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	tasks := chg.Tasks()
+	c.Assert(tasks, HasLen, 3)
+	c.Check(tasks[0].Log(), HasLen, 1)
+	c.Check(tasks[0].Log()[0], Matches, `(?s).*Output of pre-start hook:\nmigrated`)
+	s.st.Unlock()
+	c.Check(s.serviceByName(c, "hooked").Current, Equals, servstate.StatusActive)
+
+	chg = s.runHookTasks(c, true, []string{"hooked"}, 2)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+
+	data, err := ioutil.ReadFile(logPath)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, "pre-start hook\nservice\npost-start\npost-stop\n")
+}
+
+func (s *S) TestPreStartHookAbort(c *C) {
+	layer := parseLayer(c, 0, "layer", `
+services:
+    hooked:
+        override: replace
+        command: /bin/sh -c "sleep 10"
+        hooks:
+            pre-start:
+                command: /bin/sh -c "echo cannot migrate; exit 3"
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.runHookTasks(c, false, []string{"hooked"}, 2)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*pre-start hook failed: exit status 3.*`)
+	c.Check(chg.Tasks()[1].Status(), Equals, state.HoldStatus)
+	s.st.Unlock()
+	c.Check(s.serviceByName(c, "hooked").Current, Equals, servstate.StatusInactive)
+}
+
+func (s *S) TestHookTimeoutWarn(c *C) {
+	layer := parseLayer(c, 0, "layer", `
+services:
+    hooked:
+        override: replace
+        command: /bin/sh -c "sleep 10"
+        hooks:
+            pre-start:
+                command: sleep 10
+                timeout: 50ms
+                on-failure: warn
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.runHookTasks(c, false, []string{"hooked"}, 2)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	log := chg.Tasks()[0].Log()
+	c.Assert(log, HasLen, 1)
+	c.Check(log[0], Matches, `.* Ignoring failure of pre-start hook: timed out after 50ms`)
+	s.st.Unlock()
+	c.Check(s.serviceByName(c, "hooked").Current, Equals, servstate.StatusActive)
+}
+
+func (s *S) reloadServices(c *C, services []string) *state.Change {
+	s.st.Lock()
+	ts, err := servstate.Reload(s.st, services)
+	c.Check(err, IsNil)
+	chg := s.st.NewChange("test", "Reload test")
+	chg.AddAll(ts)
+	s.st.Unlock()
+
+	s.ensure(c, 1)
+	return chg
+}
+
+func (s *S) TestReloadSignal(c *C) {
+	dir := c.MkDir()
+	logPath := filepath.Join(dir, "log.txt")
+	layer := parseLayer(c, 0, "layer", fmt.Sprintf(`
+services:
+    reloadtest:
+        override: replace
+        command: /bin/sh -c 'trap "echo HUP >> %s" HUP; while true; do sleep 0.1; done'
+        reload-signal: SIGHUP
+`, logPath))
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"reloadtest"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+	pid := s.manager.RunningCmds()["reloadtest"].Process.Pid
+
+	chg = s.reloadServices(c, []string{"reloadtest"})
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+	s.waitForLogLine(c, logPath, "HUP\n")
+
+	// The service was reloaded, not restarted.
+	svc := s.serviceByName(c, "reloadtest")
+	c.Check(svc.Current, Equals, servstate.StatusActive)
+	c.Check(svc.PID, Equals, pid)
+}
+
+func (s *S) TestReloadCommand(c *C) {
+	dir := c.MkDir()
+	logPath := filepath.Join(dir, "log.txt")
+	layer := parseLayer(c, 0, "layer", fmt.Sprintf(`
+services:
+    reloadtest:
+        override: replace
+        command: /bin/sh -c 'while true; do sleep 0.1; done'
+        reload-command: /bin/sh -c 'echo reload $PEBBLE_SERVICE_PID > %s'
+`, logPath))
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.startServices(c, []string{"reloadtest"}, 1)
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+	pid := s.manager.RunningCmds()["reloadtest"].Process.Pid
+
+	chg = s.reloadServices(c, []string{"reloadtest"})
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.DoneStatus, Commentf("Error: %v", chg.Err()))
+	s.st.Unlock()
+	data, err := ioutil.ReadFile(logPath)
+	c.Assert(err, IsNil)
+	c.Check(string(data), Equals, fmt.Sprintf("reload %d\n", pid))
+}
+
+func (s *S) TestReloadNotRunning(c *C) {
+	layer := parseLayer(c, 0, "layer", `
+services:
+    reloadtest:
+        override: replace
+        command: /bin/sh -c 'sleep 10'
+        reload-signal: SIGHUP
+`)
+	err := s.manager.AppendLayer(layer)
+	c.Assert(err, IsNil)
+
+	chg := s.reloadServices(c, []string{"reloadtest"})
+	s.st.Lock()
+	c.Check(chg.Status(), Equals, state.ErrorStatus)
+	c.Check(chg.Err(), ErrorMatches, `(?s).*cannot reload service "reloadtest": service is not running.*`)
+	s.st.Unlock()
+}
+
+func (s *S) TestDynamicLayersRestored(c *C) {
+	dynamic := parseLayer(c, 0, "dynamic", `
+services:
+    dynamic:
+        override: replace
+        command: echo dynamic
+`)
+	dynamic.Dynamic = true
+	dynamic.Persist = true
+	err := s.manager.AppendLayer(dynamic)
+	c.Assert(err, IsNil)
+
+	memory := parseLayer(c, 0, "memory", `
+services:
+    memory:
+        override: replace
+        command: echo memory
+`)
+	memory.Dynamic = true
+	err = s.manager.AppendLayer(memory)
+	c.Assert(err, IsNil)
+
+	// Combining with the dynamic layer updates what's saved.
+	err = s.manager.CombineLayer(parseLayer(c, 0, "dynamic", `
+services:
+    dynamic:
+        override: merge
+        summary: Dynamic service
+`))
+	c.Assert(err, IsNil)
+
+	// A new manager (as when the daemon restarts) restores the dynamic
+	// layer, but not the one that isn't persisted.
+	manager, err := servstate.NewManager(s.st, state.NewTaskRunner(s.st), s.dir, ioutil.Discard, nil)
+	c.Assert(err, IsNil)
+	p, err := manager.Plan()
+	c.Assert(err, IsNil)
+	c.Assert(p.Layers, HasLen, 3)
+	c.Check(p.Layers[2].Label, Equals, "dynamic")
+	c.Check(p.Layers[2].Order, Equals, 3)
+	c.Check(p.Layers[2].Dynamic, Equals, true)
+	c.Check(p.Layers[2].Persist, Equals, true)
+	c.Check(p.Services["dynamic"].Summary, Equals, "Dynamic service")
+	c.Check(p.Services["memory"], IsNil)
+
+	// Removing the layer removes it from the saved layers too.
+	err = manager.RemoveLayer("dynamic")
+	c.Assert(err, IsNil)
+	manager, err = servstate.NewManager(s.st, state.NewTaskRunner(s.st), s.dir, ioutil.Discard, nil)
+	c.Assert(err, IsNil)
+	p, err = manager.Plan()
+	c.Assert(err, IsNil)
+	c.Check(p.Layers, HasLen, 2)
+}
+
+func (s *S) TestPersistedLayersKeepPositions(c *C) {
+	for _, label := range []string{"a", "b", "c"} {
+		layer := parseLayer(c, 0, label, "summary: "+label+"\n")
+		layer.Dynamic = true
+		layer.Persist = true
+		err := s.manager.AppendLayer(layer)
+		c.Assert(err, IsNil)
+	}
+	layer := parseLayer(c, 0, "d", "summary: d\n")
+	layer.Dynamic = true
+	layer.Persist = true
+	err := s.manager.InsertLayer(layer, "a")
+	c.Assert(err, IsNil)
+	err = s.manager.MoveLayer("c", "b")
+	c.Assert(err, IsNil)
+
+	// A new manager (as when the daemon restarts) restores the layers in
+	// the order they were inserted and moved to.
+	manager, err := servstate.NewManager(s.st, state.NewTaskRunner(s.st), s.dir, ioutil.Discard, nil)
+	c.Assert(err, IsNil)
+	p, err := manager.Plan()
+	c.Assert(err, IsNil)
+	var labels []string
+	for _, layer := range p.Layers {
+		labels = append(labels, fmt.Sprintf("%s:%d", layer.Label, layer.Order))
+	}
+	c.Check(labels, DeepEquals, []string{"base:1", "two:2", "d:3", "a:4", "c:5", "b:6"})
+}
+
+func (s *S) TestInsertAndMoveLayer(c *C) {
+	layerLabels := func() []string {
+		p, err := s.manager.Plan()
+		c.Assert(err, IsNil)
+		var labels []string
+		for _, layer := range p.Layers {
+			labels = append(labels, fmt.Sprintf("%s:%d", layer.Label, layer.Order))
+		}
+		return labels
+	}
+	svcCommand := func() string {
+		p, err := s.manager.Plan()
+		c.Assert(err, IsNil)
+		return string(p.Services["svc"].Command)
+	}
+	addLayer := func(label, before, command string) error {
+		layer := parseLayer(c, 0, label, `
+services:
+    svc:
+        override: replace
+        command: `+command+`
+`)
+		layer.Dynamic = true
+		return s.manager.InsertLayer(layer, before)
+	}
+
+	err := addLayer("a", "", "echo a")
+	c.Assert(err, IsNil)
+	err = addLayer("b", "a", "echo b")
+	c.Assert(err, IsNil)
+	c.Check(layerLabels(), DeepEquals, []string{"base:1", "two:2", "b:3", "a:4"})
+	c.Check(svcCommand(), Equals, "echo a")
+
+	err = s.manager.MoveLayer("a", "b")
+	c.Assert(err, IsNil)
+	c.Check(layerLabels(), DeepEquals, []string{"base:1", "two:2", "a:3", "b:4"})
+	c.Check(svcCommand(), Equals, "echo b")
+
+	err = s.manager.MoveLayer("a", "")
+	c.Assert(err, IsNil)
+	c.Check(layerLabels(), DeepEquals, []string{"base:1", "two:2", "b:3", "a:4"})
+
+	// Layers from the layers directory can't be moved, or have layers
+	// inserted before them.
+	err = s.manager.MoveLayer("base", "")
+	c.Check(err, FitsTypeOf, &servstate.LayerNotDynamic{})
+	c.Check(err, ErrorMatches, `layer "base" is from the layers directory and cannot be reordered`)
+	err = s.manager.MoveLayer("a", "two")
+	c.Check(err, FitsTypeOf, &servstate.LayerNotDynamic{})
+	err = addLayer("c", "base", "echo c")
+	c.Check(err, FitsTypeOf, &servstate.LayerNotDynamic{})
+
+	err = s.manager.MoveLayer("x", "")
+	c.Check(err, FitsTypeOf, &servstate.LabelNotFound{})
+	err = s.manager.MoveLayer("a", "x")
+	c.Check(err, FitsTypeOf, &servstate.LabelNotFound{})
+	err = addLayer("a", "b", "echo a")
+	c.Check(err, FitsTypeOf, &servstate.LabelExists{})
+	c.Check(layerLabels(), DeepEquals, []string{"base:1", "two:2", "b:3", "a:4"})
+}
+
+func (s *S) TestSetDropInDirs(c *C) {
+	dropInDir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dropInDir, "dropin.yaml"), []byte(`
+services:
+    dropin:
+        override: replace
+        command: echo dropin
+`), 0644)
+	c.Assert(err, IsNil)
+
+	s.planLayersHasLen(c, s.manager, 2)
+	s.manager.SetDropInDirs([]string{dropInDir})
+	p, err := s.manager.Plan()
+	c.Assert(err, IsNil)
+	c.Assert(p.Layers, HasLen, 3)
+	c.Check(p.Layers[2].Label, Equals, "dropin")
+	c.Check(p.Layers[2].Order, Equals, 3)
+	c.Check(p.Services["dropin"], NotNil)
+}
+
+func (s *S) TestSetDropInDirsKeepsLayers(c *C) {
+	dropInDir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dropInDir, "dropin.yaml"), []byte(`
+services:
+    dropin:
+        override: replace
+        command: echo dropin
+`), 0644)
+	c.Assert(err, IsNil)
+
+	dynamic := parseLayer(c, 0, "dynamic", `
+services:
+    dynamic:
+        override: replace
+        command: echo dynamic
+`)
+	dynamic.Dynamic = true
+	dynamic.Persist = true
+	err = s.manager.AppendLayer(dynamic)
+	c.Assert(err, IsNil)
+
+	// As when the daemon restarts: the saved layer is restored when the plan
+	// is first loaded, before the drop-in directories are set.
+	manager, err := servstate.NewManager(s.st, state.NewTaskRunner(s.st), s.dir, ioutil.Discard, nil)
+	c.Assert(err, IsNil)
+	s.planLayersHasLen(c, manager, 3)
+	manager.SetDropInDirs([]string{dropInDir})
+	p, err := manager.Plan()
+	c.Assert(err, IsNil)
+	c.Assert(p.Layers, HasLen, 4)
+	c.Check(p.Layers[2].Label, Equals, "dropin")
+	c.Check(p.Layers[3].Label, Equals, "dynamic")
+	c.Check(p.Layers[3].Order, Equals, 4)
+	c.Check(p.Services["dynamic"], NotNil)
+
+	// Updating the layers keeps the restored layer saved.
+	err = manager.AppendLayer(parseLayer(c, 0, "other", `
+services:
+    other:
+        override: replace
+        command: echo other
+`))
+	c.Assert(err, IsNil)
+	manager, err = servstate.NewManager(s.st, state.NewTaskRunner(s.st), s.dir, ioutil.Discard, nil)
+	c.Assert(err, IsNil)
+	p, err = manager.Plan()
+	c.Assert(err, IsNil)
+	c.Check(p.Services["dynamic"], NotNil)
+}
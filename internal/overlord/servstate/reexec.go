@@ -0,0 +1,229 @@
+package servstate
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/canonical/pebble/internal/logger"
+	"github.com/canonical/pebble/internal/overlord/state"
+	"github.com/canonical/pebble/internal/plan"
+	"github.com/canonical/pebble/internal/reaper"
+	"github.com/canonical/pebble/internal/servicelog"
+)
+
+// reexecServicesKey is the state key used to hand running services over to
+// a re-executed daemon.
+const reexecServicesKey = "reexec-services"
+
+// reexecService records what a re-executed daemon needs to adopt a service
+// process that is still running, or to restore a service that is backing
+// off, has exited (remain-after-exit), or has reached its start limit, none
+// of which have a process.
+type reexecService struct {
+	State         serviceState  `json:"state,omitempty"`
+	PID           int           `json:"pid,omitempty"`
+	LogFD         int           `json:"log-fd,omitempty"`
+	Config        *plan.Service `json:"config"`
+	Args          []string      `json:"args"`
+	StartTime     time.Time     `json:"start-time"`
+	Restarts      int           `json:"restarts"`
+	TotalRestarts int           `json:"total-restarts"`
+	RestartTimes  []time.Time   `json:"restart-times,omitempty"`
+	BackoffNum    int           `json:"backoff-num,omitempty"`
+	BackoffTime   time.Duration `json:"backoff-time,omitempty"`
+	LastExit      *ServiceExit  `json:"last-exit,omitempty"`
+}
+
+// PrepareReexec records the services in the state so that they can be
+// adopted by the daemon after it re-executes itself, and marks the log pipes
+// of running services to be inherited across the exec. The services are
+// left running.
+func (m *ServiceManager) PrepareReexec() error {
+	m.servicesLock.Lock()
+	defer m.servicesLock.Unlock()
+
+	var services []*reexecService
+	for name, s := range m.services {
+		r := &reexecService{
+			State:         s.state,
+			Config:        s.config,
+			Args:          s.args,
+			StartTime:     s.startTime,
+			Restarts:      s.restartCount,
+			TotalRestarts: s.totalRestarts,
+			RestartTimes:  s.restarts,
+			BackoffNum:    s.backoffNum,
+			BackoffTime:   s.backoffTime,
+			LastExit:      s.lastExit,
+		}
+		switch s.state {
+		case stateStarting, stateRunning, stateTerminating, stateKilling:
+			// A service being stopped is adopted as running, and the
+			// new daemon's stop task signals it again.
+			if s.cmd == nil || s.cmd.Process == nil || s.logReader == nil {
+				continue
+			}
+			logFD, err := inheritFD(s.logReader)
+			if err != nil {
+				return fmt.Errorf("cannot hand over service %q: %w", name, err)
+			}
+			r.State = stateRunning
+			r.PID = s.cmd.Process.Pid
+			r.LogFD = logFD
+		case stateBackoff, stateExited, stateFailed:
+			// No process to hand over, only the service's state.
+		default:
+			continue
+		}
+		services = append(services, r)
+	}
+
+	m.state.Lock()
+	defer m.state.Unlock()
+	if len(services) == 0 {
+		m.state.Set(reexecServicesKey, nil)
+	} else {
+		m.state.Set(reexecServicesKey, services)
+	}
+	return nil
+}
+
+// inheritFD clears close-on-exec on the file's descriptor so that it's
+// inherited across the exec, and returns the descriptor.
+func inheritFD(f *os.File) (int, error) {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var fd int
+	var fcntlErr error
+	err = conn.Control(func(fdPtr uintptr) {
+		fd = int(fdPtr)
+		_, fcntlErr = unix.FcntlInt(fdPtr, unix.F_SETFD, 0)
+	})
+	if err == nil {
+		err = fcntlErr
+	}
+	return fd, err
+}
+
+// adoptServices takes over the service processes left running by the
+// previous daemon process before it re-executed itself.
+func (m *ServiceManager) adoptServices() error {
+	m.state.Lock()
+	var services []*reexecService
+	err := m.state.Get(reexecServicesKey, &services)
+	if err == state.ErrNoState {
+		m.state.Unlock()
+		return nil
+	}
+	// Only try to adopt the services once.
+	m.state.Set(reexecServicesKey, nil)
+	m.state.Unlock()
+	if err != nil {
+		return err
+	}
+
+	m.servicesLock.Lock()
+	defer m.servicesLock.Unlock()
+
+	for _, r := range services {
+		if r.Config == nil {
+			continue
+		}
+		switch r.State {
+		case stateRunning, "":
+			m.adoptService(r)
+		case stateBackoff, stateExited, stateFailed:
+			m.restoreService(r)
+		}
+	}
+	return nil
+}
+
+// adoptService creates a running service for the given process. It assumes
+// the services lock is held.
+//
+// Its watchdog and backoff reset timers are started again, but the output
+// it wrote before the exec isn't in the new daemon's log buffer.
+func (m *ServiceManager) adoptService(r *reexecService) {
+	// The log pipe was inherited without close-on-exec; restore it so it
+	// doesn't leak into service processes started from now on.
+	unix.CloseOnExec(r.LogFD)
+	logReader := os.NewFile(uintptr(r.LogFD), r.Config.Name+" output")
+
+	// The process is still our child (exec keeps the PID), so it can be
+	// waited for and signalled as usual.
+	process, _ := os.FindProcess(r.PID)
+	s := &serviceData{
+		manager:       m,
+		state:         stateRunning,
+		config:        r.Config,
+		args:          r.Args,
+		logs:          servicelog.NewRingBuffer(maxLogBytes),
+		started:       make(chan error, 1),
+		stopped:       make(chan error, 2),
+		cmd:           &exec.Cmd{Process: process},
+		startTime:     r.StartTime,
+		restartCount:  r.Restarts,
+		totalRestarts: r.TotalRestarts,
+		restarts:      r.RestartTimes,
+		backoffNum:    r.BackoffNum,
+		backoffTime:   r.BackoffTime,
+		lastExit:      r.LastExit,
+	}
+	m.services[r.Config.Name] = s
+
+	resetWait := s.config.BackoffLimit.Value - time.Since(s.startTime)
+	if resetWait < 0 {
+		resetWait = 0
+	}
+	s.resetTimer = time.AfterFunc(resetWait, func() { logError(s.backoffResetElapsed()) })
+	s.armWatchdog()
+
+	logFile, err := s.openLogFile()
+	if err != nil {
+		logger.Noticef("Service %q: %v", r.Config.Name, err)
+	}
+	journal, err := s.openJournal()
+	if err != nil {
+		logger.Noticef("Service %q: %v", r.Config.Name, err)
+	}
+
+	logger.Noticef("Service %q adopted (pid %d)", r.Config.Name, r.PID)
+	s.monitor(func() (int, error) { return reaper.WaitProcess(r.PID) }, logReader, logFile, journal)
+}
+
+// restoreService creates a service that has no process, in the backoff,
+// exited or failed state it was in before the exec. A service in backoff is
+// restarted after its full backoff delay. It assumes the services lock is
+// held.
+func (m *ServiceManager) restoreService(r *reexecService) {
+	s := &serviceData{
+		manager:       m,
+		state:         r.State,
+		config:        r.Config,
+		args:          r.Args,
+		logs:          servicelog.NewRingBuffer(maxLogBytes),
+		started:       make(chan error, 1),
+		stopped:       make(chan error, 2),
+		startTime:     r.StartTime,
+		restartCount:  r.Restarts,
+		totalRestarts: r.TotalRestarts,
+		restarts:      r.RestartTimes,
+		backoffNum:    r.BackoffNum,
+		backoffTime:   r.BackoffTime,
+		lastExit:      r.LastExit,
+	}
+	m.services[r.Config.Name] = s
+
+	if s.state == stateBackoff {
+		duration := s.backoffTime + m.getJitter(s.backoffTime)
+		time.AfterFunc(duration, func() { logError(s.backoffTimeElapsed()) })
+	}
+	logger.Noticef("Service %q restored (%s)", r.Config.Name, r.State)
+}
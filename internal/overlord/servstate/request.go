@@ -2,6 +2,7 @@ package servstate
 
 import (
 	"github.com/canonical/pebble/internal/overlord/state"
+	"github.com/canonical/pebble/internal/plan"
 
 	"fmt"
 )
@@ -9,40 +10,112 @@ import (
 // ServiceRequest holds the details required to perform service tasks.
 type ServiceRequest struct {
 	Name string
+
+	// Args, if not nil, replaces the default arguments of the service
+	// command (those in its trailing "[ ... ]" group) for this start.
+	Args []string
+
+	// Hook, for a "run-hook" task, is the name of the service's hook to
+	// run: "pre-start", "post-start" or "post-stop".
+	Hook string
 }
 
 // Start creates and returns a task set for starting the given services.
-func Start(s *state.State, services []string) (*state.TaskSet, error) {
-	var tasks []*state.Task
-	for _, name := range services {
-		task := s.NewTask("start", fmt.Sprintf("Start service %q", name))
-		req := ServiceRequest{
-			Name: name,
-		}
-		task.Set("service-request", &req)
-		if len(tasks) > 0 {
-			// TODO Allow non-dependent services to start in parallel.
-			task.WaitFor(tasks[len(tasks)-1])
-		}
-		tasks = append(tasks, task)
-	}
-	return state.NewTaskSet(tasks...), nil
+//
+// Each service is started in a state lane of its own, after the services
+// that deps lists for it (as returned by Plan.StartDependencies) have been
+// started. Services that don't depend on one another start in parallel, and
+// a service failing to start only aborts the services that depend on it.
+func Start(s *state.State, services []string, deps map[string][]string) (*state.TaskSet, error) {
+	return serviceTasks(s, "start", "Start service %q", services, deps, nil, nil, "", ""), nil
+}
+
+// StartWithArgs is like Start, but starts the services named in args with
+// the given arguments in place of the default arguments of their commands.
+func StartWithArgs(s *state.State, services []string, deps map[string][]string, args map[string][]string) (*state.TaskSet, error) {
+	return serviceTasks(s, "start", "Start service %q", services, deps, args, nil, "", ""), nil
+}
+
+// StartWithHooks is like StartWithArgs, but also runs the pre-start and
+// post-start hooks that services have in the plan p, each as a task of its
+// own before or after the service's start task in its lane. A pre-start
+// hook that fails (and aborts) prevents the service from being started.
+func StartWithHooks(s *state.State, p *plan.Plan, services []string, deps map[string][]string, args map[string][]string) (*state.TaskSet, error) {
+	return serviceTasks(s, "start", "Start service %q", services, deps, args, p, "pre-start", "post-start"), nil
 }
 
 // Stop creates and returns a task set for stopping the given services.
-func Stop(s *state.State, services []string) (*state.TaskSet, error) {
+//
+// As with Start, each service is stopped in a lane of its own, after the
+// services that deps lists for it (as returned by Plan.StopDependencies).
+func Stop(s *state.State, services []string, deps map[string][]string) (*state.TaskSet, error) {
+	return serviceTasks(s, "stop", "Stop service %q", services, deps, nil, nil, "", ""), nil
+}
+
+// StopWithHooks is like Stop, but also runs the post-stop hooks that
+// services have in the plan p, each as a task of its own after the
+// service's stop task in its lane.
+func StopWithHooks(s *state.State, p *plan.Plan, services []string, deps map[string][]string) (*state.TaskSet, error) {
+	return serviceTasks(s, "stop", "Stop service %q", services, deps, nil, p, "", "post-stop"), nil
+}
+
+// Reload creates and returns a task set for reloading the given services,
+// using their reload-command or reload-signal. Unlike starting and stopping,
+// reloading doesn't depend on the order of services, so each is reloaded in
+// parallel.
+func Reload(s *state.State, services []string) (*state.TaskSet, error) {
+	return serviceTasks(s, "reload", "Reload service %q", services, nil, nil, nil, "", ""), nil
+}
+
+// serviceTasks creates a task of the given kind for each service, in a lane
+// of its own, waiting for the tasks of the services it depends on. If p is
+// not nil, the tasks to run the services' before and after hooks (if they
+// have them) are added around them.
+func serviceTasks(s *state.State, kind, summary string, services []string, deps map[string][]string, args map[string][]string, p *plan.Plan, before, after string) *state.TaskSet {
 	var tasks []*state.Task
+	first := make(map[string]*state.Task, len(services))
+	last := make(map[string]*state.Task, len(services))
 	for _, name := range services {
-		task := s.NewTask("stop", fmt.Sprintf("Stop service %q", name))
-		req := ServiceRequest{
+		lane := s.NewLane()
+		add := func(task *state.Task, req *ServiceRequest) {
+			task.Set("service-request", req)
+			task.JoinLane(lane)
+			if prev := last[name]; prev != nil {
+				task.WaitFor(prev)
+			} else {
+				first[name] = task
+			}
+			tasks = append(tasks, task)
+			last[name] = task
+		}
+		var hooks plan.ServiceHooks
+		if p != nil {
+			if config, ok := p.Service(name); ok {
+				hooks = config.Hooks
+			}
+		}
+		if before != "" && hooks.Hook(before) != nil {
+			add(hookTask(s, name, before))
+		}
+		add(s.NewTask(kind, fmt.Sprintf(summary, name)), &ServiceRequest{
 			Name: name,
+			Args: args[name],
+		})
+		if after != "" && hooks.Hook(after) != nil {
+			add(hookTask(s, name, after))
 		}
-		task.Set("service-request", &req)
-		if len(tasks) > 1 {
-			// TODO Allow non-dependent services to stop in parallel.
-			task.WaitFor(tasks[len(tasks)-1])
+	}
+	for _, name := range services {
+		for _, dep := range deps[name] {
+			if task := last[dep]; task != nil {
+				first[name].WaitFor(task)
+			}
 		}
-		tasks = append(tasks, task)
 	}
-	return state.NewTaskSet(tasks...), nil
+	return state.NewTaskSet(tasks...)
+}
+
+func hookTask(s *state.State, service, hook string) (*state.Task, *ServiceRequest) {
+	task := s.NewTask("run-hook", fmt.Sprintf("Run %s hook of service %q", hook, service))
+	return task, &ServiceRequest{Name: service, Hook: hook}
 }
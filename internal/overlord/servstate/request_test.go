@@ -18,46 +18,118 @@ import (
 	. "gopkg.in/check.v1"
 
 	"github.com/canonical/pebble/internal/overlord/servstate"
+	"github.com/canonical/pebble/internal/overlord/state"
+	"github.com/canonical/pebble/internal/plan"
 )
 
 func (s *S) TestStart(c *C) {
 	s.st.Lock()
 	defer s.st.Unlock()
 
-	tset, err := servstate.Start(s.st, []string{"one", "two"})
+	tset, err := servstate.Start(s.st, []string{"one", "two", "three"}, map[string][]string{
+		"two": {"one"},
+	})
 	c.Assert(err, IsNil)
 
 	tasks := tset.Tasks()
-	c.Assert(len(tasks), Equals, 2)
+	c.Assert(len(tasks), Equals, 3)
 
-	c.Assert(tasks[0].Kind(), Equals, "start")
-	req, err := servstate.TaskServiceRequest(tasks[0])
-	c.Assert(err, IsNil)
-	c.Assert(req.Name, Equals, "one")
+	for i, name := range []string{"one", "two", "three"} {
+		c.Assert(tasks[i].Kind(), Equals, "start")
+		req, err := servstate.TaskServiceRequest(tasks[i])
+		c.Assert(err, IsNil)
+		c.Assert(req.Name, Equals, name)
+	}
 
-	c.Assert(tasks[1].Kind(), Equals, "start")
-	req, err = servstate.TaskServiceRequest(tasks[1])
-	c.Assert(err, IsNil)
-	c.Assert(req.Name, Equals, "two")
+	// Each service has a lane of its own, and waits for the services it
+	// depends on; the others start in parallel.
+	c.Check(tasks[0].WaitTasks(), HasLen, 0)
+	c.Check(tasks[1].WaitTasks(), DeepEquals, []*state.Task{tasks[0]})
+	c.Check(tasks[2].WaitTasks(), HasLen, 0)
+	for i := range tasks {
+		c.Assert(tasks[i].Lanes(), HasLen, 1)
+		for j := 0; j < i; j++ {
+			c.Check(tasks[i].Lanes()[0], Not(Equals), tasks[j].Lanes()[0])
+		}
+	}
 }
 
 func (s *S) TestStop(c *C) {
 	s.st.Lock()
 	defer s.st.Unlock()
 
-	tset, err := servstate.Stop(s.st, []string{"one", "two"})
+	tset, err := servstate.Stop(s.st, []string{"one", "two", "three"}, map[string][]string{
+		"two":   {"one"},
+		"three": {"one", "two"},
+	})
 	c.Assert(err, IsNil)
 
 	tasks := tset.Tasks()
-	c.Assert(len(tasks), Equals, 2)
+	c.Assert(len(tasks), Equals, 3)
+
+	for i, name := range []string{"one", "two", "three"} {
+		c.Assert(tasks[i].Kind(), Equals, "stop")
+		req, err := servstate.TaskServiceRequest(tasks[i])
+		c.Assert(err, IsNil)
+		c.Assert(req.Name, Equals, name)
+	}
 
-	c.Assert(tasks[0].Kind(), Equals, "stop")
+	c.Check(tasks[0].WaitTasks(), HasLen, 0)
+	c.Check(tasks[1].WaitTasks(), DeepEquals, []*state.Task{tasks[0]})
+	c.Check(tasks[2].WaitTasks(), DeepEquals, []*state.Task{tasks[0], tasks[1]})
+}
+
+func (s *S) TestStartWithHooks(c *C) {
+	p := &plan.Plan{Services: map[string]*plan.Service{
+		"one": {Name: "one", Hooks: plan.ServiceHooks{
+			PreStart:  &plan.ServiceHook{Command: "migrate"},
+			PostStart: &plan.ServiceHook{Command: "notify"},
+			PostStop:  &plan.ServiceHook{Command: "cleanup"},
+		}},
+		"two": {Name: "two"},
+	}}
+
+	s.st.Lock()
+	defer s.st.Unlock()
+
+	tset, err := servstate.StartWithHooks(s.st, p, []string{"one", "two"}, map[string][]string{
+		"two": {"one"},
+	}, nil)
+	c.Assert(err, IsNil)
+
+	tasks := tset.Tasks()
+	c.Assert(len(tasks), Equals, 4)
+	for i, kind := range []string{"run-hook", "start", "run-hook", "start"} {
+		c.Assert(tasks[i].Kind(), Equals, kind)
+		if i > 0 {
+			c.Check(tasks[i].WaitTasks(), DeepEquals, []*state.Task{tasks[i-1]})
+		}
+	}
+	// The hooks run in the lane of their service, and "two" waits for the
+	// post-start hook of "one", which it depends on.
+	c.Check(tasks[1].Lanes(), DeepEquals, tasks[0].Lanes())
+	c.Check(tasks[2].Lanes(), DeepEquals, tasks[0].Lanes())
+	c.Check(tasks[3].Lanes(), Not(DeepEquals), tasks[0].Lanes())
+	c.Check(tasks[0].Summary(), Equals, `Run pre-start hook of service "one"`)
 	req, err := servstate.TaskServiceRequest(tasks[0])
 	c.Assert(err, IsNil)
-	c.Assert(req.Name, Equals, "one")
+	c.Check(req.Name, Equals, "one")
+	c.Check(req.Hook, Equals, "pre-start")
+	req, err = servstate.TaskServiceRequest(tasks[2])
+	c.Assert(err, IsNil)
+	c.Check(req.Hook, Equals, "post-start")
 
-	c.Assert(tasks[1].Kind(), Equals, "stop")
-	req, err = servstate.TaskServiceRequest(tasks[1])
+	tset, err = servstate.StopWithHooks(s.st, p, []string{"two", "one"}, map[string][]string{
+		"one": {"two"},
+	})
+	c.Assert(err, IsNil)
+	tasks = tset.Tasks()
+	c.Assert(len(tasks), Equals, 3)
+	for i, kind := range []string{"stop", "stop", "run-hook"} {
+		c.Assert(tasks[i].Kind(), Equals, kind)
+	}
+	req, err = servstate.TaskServiceRequest(tasks[2])
 	c.Assert(err, IsNil)
-	c.Assert(req.Name, Equals, "two")
+	c.Check(req.Name, Equals, "one")
+	c.Check(req.Hook, Equals, "post-stop")
 }
@@ -0,0 +1,63 @@
+package servstate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var procDir = "/proc"
+
+// clockTicks is the number of clock ticks per second that CPU times in
+// /proc/<pid>/stat are measured in (USER_HZ, which is 100 on all the
+// architectures Linux supports).
+const clockTicks = 100
+
+// processStats holds resource usage of a single process.
+type processStats struct {
+	// CPU time (user and system) used by the process so far
+	cpuTime time.Duration
+
+	// Resident set size, in bytes
+	rss int64
+}
+
+// readProcessStats reads the resource usage of the process with the given
+// PID from /proc.
+func readProcessStats(pid int) (*processStats, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("%s/%d/stat", procDir, pid))
+	if err != nil {
+		return nil, err
+	}
+	// The command name (the second field) is in parentheses and may itself
+	// contain spaces and parentheses, so split after the last one.
+	stat := string(data)
+	i := strings.LastIndexByte(stat, ')')
+	if i < 0 {
+		return nil, fmt.Errorf("invalid process stat %q", stat)
+	}
+	// Fields after the command name, starting from the third (state).
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("invalid process stat %q", stat)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid utime in process stat: %v", err)
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stime in process stat: %v", err)
+	}
+	rssPages, err := strconv.ParseInt(fields[21], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rss in process stat: %v", err)
+	}
+	return &processStats{
+		cpuTime: time.Duration(utime+stime) * time.Second / clockTicks,
+		rss:     rssPages * int64(os.Getpagesize()),
+	}, nil
+}
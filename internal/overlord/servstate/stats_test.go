@@ -0,0 +1,69 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package servstate_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/overlord/servstate"
+)
+
+type statsSuite struct{}
+
+var _ = Suite(&statsSuite{})
+
+func (s *statsSuite) TestReadProcessStats(c *C) {
+	dir := c.MkDir()
+	restore := servstate.FakeProcDir(dir)
+	defer restore()
+
+	// The command name contains spaces and parentheses, which mustn't
+	// confuse the field positions.
+	c.Assert(os.Mkdir(filepath.Join(dir, "42"), 0755), IsNil)
+	stat := "42 (my (odd) cmd) S 1 42 42 0 -1 4194560 100 0 0 0 250 50 0 0 20 0 1 0 1000 12345678 300 18446744073709551615\n"
+	err := ioutil.WriteFile(filepath.Join(dir, "42", "stat"), []byte(stat), 0644)
+	c.Assert(err, IsNil)
+
+	cpuTime, rss, err := servstate.ReadProcessStats(42)
+	c.Assert(err, IsNil)
+	c.Check(cpuTime, Equals, 3*time.Second)
+	c.Check(rss, Equals, int64(300*os.Getpagesize()))
+}
+
+func (s *statsSuite) TestReadProcessStatsErrors(c *C) {
+	dir := c.MkDir()
+	restore := servstate.FakeProcDir(dir)
+	defer restore()
+
+	_, _, err := servstate.ReadProcessStats(42)
+	c.Check(os.IsNotExist(err), Equals, true)
+
+	c.Assert(os.Mkdir(filepath.Join(dir, "42"), 0755), IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, "42", "stat"), []byte("42 (cmd) S 1 42\n"), 0644)
+	c.Assert(err, IsNil)
+	_, _, err = servstate.ReadProcessStats(42)
+	c.Check(err, ErrorMatches, `invalid process stat .*`)
+}
+
+func (s *statsSuite) TestReadProcessStatsSelf(c *C) {
+	_, rss, err := servstate.ReadProcessStats(os.Getpid())
+	c.Assert(err, IsNil)
+	c.Check(rss > 0, Equals, true)
+}
@@ -126,6 +126,16 @@ type Change struct {
 	lanes   int
 	ready   chan struct{}
 
+	// lastObservedStatus is the status last reported to the change status
+	// handlers; it's not persisted.
+	lastObservedStatus Status
+
+	// statusCounts caches the number of tasks in each status (as returned
+	// by Task.Status), so that the change status handlers can be called
+	// without going through all the tasks whenever one changes. It's nil
+	// until first needed, and it's not persisted.
+	statusCounts []int
+
 	spawnTime time.Time
 	readyTime time.Time
 }
@@ -217,7 +227,8 @@ func (c *Change) UnmarshalJSON(data []byte) error {
 
 // finishUnmarshal is called after the state and tasks are accessible.
 func (c *Change) finishUnmarshal() {
-	if c.Status().Ready() {
+	c.lastObservedStatus = c.Status()
+	if c.lastObservedStatus.Ready() {
 		close(c.ready)
 	}
 }
@@ -305,6 +316,45 @@ func (c *Change) SetStatus(s Status) {
 	if s.Ready() {
 		c.markReady()
 	}
+	c.notifyStatusChange()
+}
+
+// notifyStatusChange calls the change status handlers if the change's
+// status differs from the one last observed.
+func (c *Change) notifyStatusChange() {
+	if len(c.state.changeStatusHandlers) == 0 {
+		return
+	}
+	old, new := c.lastObservedStatus, c.cachedStatus()
+	if old == new {
+		return
+	}
+	c.lastObservedStatus = new
+	for _, f := range c.state.changeStatusHandlers {
+		f(c, old, new)
+	}
+}
+
+// cachedStatus returns the same as Status, using statusCounts.
+func (c *Change) cachedStatus() Status {
+	if c.status != DefaultStatus {
+		return c.status
+	}
+	if len(c.taskIDs) == 0 {
+		return HoldStatus
+	}
+	if c.statusCounts == nil {
+		c.statusCounts = make([]int, nStatuses)
+		for _, tid := range c.taskIDs {
+			c.statusCounts[c.state.tasks[tid].Status()]++
+		}
+	}
+	for _, s := range statusOrder {
+		if c.statusCounts[s] > 0 {
+			return s
+		}
+	}
+	panic(fmt.Sprintf("internal error: cannot process change status: %v", c.statusCounts))
 }
 
 func (c *Change) markReady() {
@@ -326,6 +376,17 @@ func (c *Change) Ready() <-chan struct{} {
 // taskStatusChanged is called by tasks when their status is changed,
 // to give the opportunity for the change to close its ready channel.
 func (c *Change) taskStatusChanged(t *Task, old, new Status) {
+	if c.statusCounts != nil {
+		if old == DefaultStatus {
+			old = DoStatus
+		}
+		if new == DefaultStatus {
+			new = DoStatus
+		}
+		c.statusCounts[old]--
+		c.statusCounts[new]++
+	}
+	c.notifyStatusChange()
 	if old.Ready() == new.Ready() {
 		return
 	}
@@ -460,6 +521,10 @@ func (c *Change) AddTask(t *Task) {
 	}
 	t.change = c.id
 	c.taskIDs = addOnce(c.taskIDs, t.ID())
+	if c.statusCounts != nil {
+		c.statusCounts[t.Status()]++
+	}
+	c.notifyStatusChange()
 }
 
 // AddAll registers all tasks in the set as required for the state
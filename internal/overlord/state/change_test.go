@@ -724,3 +724,85 @@ func (ts *taskRunnerSuite) TestAbortLanes(c *C) {
 		c.Assert(strings.Join(obtained, " "), Equals, strings.Join(expected, " "), Commentf("setup: %s", test.setup))
 	}
 }
+
+func (cs *changeSuite) TestStatusChangedHandlers(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	var changeEvents, taskEvents []string
+	st.AddChangeStatusChangedHandler(func(chg *state.Change, old, new state.Status) {
+		changeEvents = append(changeEvents, fmt.Sprintf("%s: %s -> %s", chg.ID(), old, new))
+	})
+	st.AddTaskStatusChangedHandler(func(t *state.Task, old, new state.Status) {
+		taskEvents = append(taskEvents, fmt.Sprintf("%s: %s -> %s", t.ID(), old, new))
+	})
+	progress := 0
+	st.AddTaskProgressHandler(func(t *state.Task) {
+		progress++
+	})
+
+	chg := st.NewChange("install", "...")
+	t1 := st.NewTask("download", "1...")
+	t2 := st.NewTask("activate", "2...")
+	chg.AddAll(state.NewTaskSet(t1, t2))
+
+	t1.SetStatus(state.DoingStatus)
+	t1.SetProgress("foo", 1, 2)
+	t1.SetStatus(state.DoingStatus)
+	t1.SetStatus(state.DoneStatus)
+	t2.SetStatus(state.DoStatus)
+	t2.SetStatus(state.ErrorStatus)
+	chg.SetStatus(state.HoldStatus)
+
+	c.Check(changeEvents, DeepEquals, []string{
+		"1: Default -> Do",
+		"1: Do -> Doing",
+		"1: Doing -> Do",
+		"1: Do -> Error",
+		"1: Error -> Hold",
+	})
+	c.Check(taskEvents, DeepEquals, []string{
+		"1: Do -> Doing",
+		"1: Doing -> Done",
+		"2: Do -> Error",
+	})
+	c.Check(progress, Equals, 1)
+}
+
+func (cs *changeSuite) TestStatusChangedHandlersTrackStatus(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.NewChange("install", "...")
+	t1 := st.NewTask("download", "1...")
+	chg.AddTask(t1)
+
+	// The handlers are registered after the change has tasks, and tasks
+	// are added and change status afterwards.
+	var last state.Status
+	st.AddChangeStatusChangedHandler(func(chg *state.Change, old, new state.Status) {
+		last = new
+	})
+	t2 := st.NewTask("activate", "2...")
+	t2.SetStatus(state.DoneStatus)
+	chg.AddTask(t2)
+	c.Check(last, Equals, chg.Status())
+
+	statuses := []state.Status{
+		state.DoingStatus, state.DoneStatus, state.UndoStatus, state.UndoingStatus,
+		state.UndoneStatus, state.AbortStatus, state.HoldStatus, state.ErrorStatus,
+	}
+	// t3 keeps the change from becoming ready until the end.
+	t3 := st.NewTask("wait", "3...")
+	chg.AddTask(t3)
+	for i, status := range statuses {
+		for j, t := range []*state.Task{t1, t2} {
+			t.SetStatus(statuses[(i+j*3)%len(statuses)])
+			c.Check(last, Equals, chg.Status(), Commentf("%s", status))
+		}
+	}
+	t3.SetStatus(state.DoneStatus)
+	c.Check(last, Equals, chg.Status())
+}
@@ -66,6 +66,10 @@ func (t *Task) AccumulateUndoingTime(duration time.Duration) {
 	t.accumulateUndoingTime(duration)
 }
 
+func (t *Task) MarkStarted() {
+	t.markStarted()
+}
+
 var (
 	ErrNoWarningMessage     = errNoWarningMessage
 	ErrBadWarningMessage    = errBadWarningMessage
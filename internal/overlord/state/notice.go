@@ -0,0 +1,344 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/canonical/pebble/internal/strutil"
+)
+
+// DefaultNoticeExpireAfter is how long after a notice last occurred it's
+// dropped.
+var DefaultNoticeExpireAfter = 7 * 24 * time.Hour
+
+// NoticeType is the type of a notice.
+type NoticeType string
+
+const (
+	// CustomNotice is a notice reported by a client, for example a
+	// workload signalling that something happened. Its key must be in the
+	// form "domain.com/key".
+	CustomNotice NoticeType = "custom"
+
+	// StartLimitNotice is recorded when a service has been restarted too
+	// often and won't be restarted again until it's started explicitly.
+	// Its key is the name of the service.
+	StartLimitNotice NoticeType = "start-limit"
+)
+
+// Notice records an occurrence of an event of interest to clients. Notices
+// are unique by type and key: when an event with the same type and key
+// occurs again, the existing notice is updated.
+type Notice struct {
+	// unique identifier for the notice
+	id string
+	// type and key together identify the notice
+	noticeType NoticeType
+	key        string
+	// the first and last time one of these notices occurred
+	firstOccurred time.Time
+	lastOccurred  time.Time
+	// the last time the notice was "repeated", that is, occurred at least
+	// repeatAfter after the previous repeat; clients wait on this
+	lastRepeated time.Time
+	// number of times one of these notices has occurred
+	occurrences int
+	// data from the most recent occurrence
+	lastData map[string]string
+	// how long after one of these was last repeated it should be repeated
+	// again (zero means every occurrence is a repeat)
+	repeatAfter time.Duration
+	// how long since one of these last occurred should we drop the notice
+	expireAfter time.Duration
+}
+
+type jsonNotice struct {
+	ID            string            `json:"id"`
+	Type          string            `json:"type"`
+	Key           string            `json:"key"`
+	FirstOccurred time.Time         `json:"first-occurred"`
+	LastOccurred  time.Time         `json:"last-occurred"`
+	LastRepeated  time.Time         `json:"last-repeated"`
+	Occurrences   int               `json:"occurrences"`
+	LastData      map[string]string `json:"last-data,omitempty"`
+	RepeatAfter   string            `json:"repeat-after,omitempty"`
+	ExpireAfter   string            `json:"expire-after,omitempty"`
+}
+
+// ID returns the notice's unique identifier.
+func (n *Notice) ID() string {
+	return n.id
+}
+
+// Type returns the notice's type.
+func (n *Notice) Type() NoticeType {
+	return n.noticeType
+}
+
+// Key returns the notice's key.
+func (n *Notice) Key() string {
+	return n.key
+}
+
+// LastRepeated returns the last time the notice was repeated.
+func (n *Notice) LastRepeated() time.Time {
+	return n.lastRepeated
+}
+
+func (n *Notice) String() string {
+	return "Notice " + n.id + " (" + string(n.noticeType) + ":" + n.key + ")"
+}
+
+func (n *Notice) MarshalJSON() ([]byte, error) {
+	jn := jsonNotice{
+		ID:            n.id,
+		Type:          string(n.noticeType),
+		Key:           n.key,
+		FirstOccurred: n.firstOccurred,
+		LastOccurred:  n.lastOccurred,
+		LastRepeated:  n.lastRepeated,
+		Occurrences:   n.occurrences,
+		LastData:      n.lastData,
+		ExpireAfter:   n.expireAfter.String(),
+	}
+	if n.repeatAfter != 0 {
+		jn.RepeatAfter = n.repeatAfter.String()
+	}
+	return json.Marshal(jn)
+}
+
+func (n *Notice) UnmarshalJSON(data []byte) error {
+	var jn jsonNotice
+	err := json.Unmarshal(data, &jn)
+	if err != nil {
+		return err
+	}
+	n.id = jn.ID
+	n.noticeType = NoticeType(jn.Type)
+	n.key = jn.Key
+	n.firstOccurred = jn.FirstOccurred
+	n.lastOccurred = jn.LastOccurred
+	n.lastRepeated = jn.LastRepeated
+	n.occurrences = jn.Occurrences
+	n.lastData = jn.LastData
+	if jn.RepeatAfter != "" {
+		n.repeatAfter, err = time.ParseDuration(jn.RepeatAfter)
+		if err != nil {
+			return err
+		}
+	}
+	if jn.ExpireAfter != "" {
+		n.expireAfter, err = time.ParseDuration(jn.ExpireAfter)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *Notice) expired(now time.Time) bool {
+	return n.lastOccurred.Add(n.expireAfter).Before(now)
+}
+
+// AddNoticeOptions holds the options for AddNotice.
+type AddNoticeOptions struct {
+	// Data is the optional key-value data for this occurrence.
+	Data map[string]string
+
+	// RepeatAfter defines how long after this notice was last repeated we
+	// should allow it to repeat. Zero means always repeat.
+	RepeatAfter time.Duration
+
+	// Time, if set, overrides time.Now() as the time of the occurrence.
+	Time time.Time
+}
+
+// AddNotice records an occurrence of a notice with the specified type and
+// key, returning the notice's ID. If a notice with this type and key
+// already exists, it's updated rather than a new one being added.
+func (s *State) AddNotice(noticeType NoticeType, key string, options *AddNoticeOptions) string {
+	if options == nil {
+		options = &AddNoticeOptions{}
+	}
+	s.writing()
+
+	now := options.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	now = now.UTC()
+
+	uniqueKey := noticeKey(noticeType, key)
+	notice, ok := s.notices[uniqueKey]
+	if !ok || notice.expired(now) {
+		s.lastNoticeId++
+		notice = &Notice{
+			id:            strconv.Itoa(s.lastNoticeId),
+			noticeType:    noticeType,
+			key:           key,
+			firstOccurred: now,
+			lastRepeated:  now,
+			expireAfter:   DefaultNoticeExpireAfter,
+		}
+		s.notices[uniqueKey] = notice
+	} else if !now.Before(notice.lastRepeated.Add(notice.repeatAfter)) {
+		notice.lastRepeated = now
+	}
+	notice.occurrences++
+	notice.lastOccurred = now
+	notice.lastData = options.Data
+	notice.repeatAfter = options.RepeatAfter
+
+	if s.noticeAdded != nil {
+		close(s.noticeAdded)
+		s.noticeAdded = nil
+	}
+	return notice.id
+}
+
+func noticeKey(noticeType NoticeType, key string) string {
+	return string(noticeType) + ":" + key
+}
+
+// NoticeFilter allows filtering notices by various fields.
+type NoticeFilter struct {
+	// Types, if not empty, includes only notices whose type is one of
+	// these.
+	Types []NoticeType
+
+	// Keys, if not empty, includes only notices whose key is one of these.
+	Keys []string
+
+	// After, if set, includes only notices that were last repeated after
+	// this time.
+	After time.Time
+}
+
+func (f *NoticeFilter) matches(n *Notice) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Types) > 0 && !noticeTypeIn(n.noticeType, f.Types) {
+		return false
+	}
+	if len(f.Keys) > 0 && !strutil.ListContains(f.Keys, n.key) {
+		return false
+	}
+	if !f.After.IsZero() && !n.lastRepeated.After(f.After) {
+		return false
+	}
+	return true
+}
+
+func noticeTypeIn(t NoticeType, types []NoticeType) bool {
+	for _, typ := range types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Notices returns the notices that match the filter (which may be nil, to
+// return all notices), sorted by the time they were last repeated.
+func (s *State) Notices(filter *NoticeFilter) []*Notice {
+	s.reading()
+
+	now := time.Now()
+	var notices []*Notice
+	for _, n := range s.notices {
+		if n.expired(now) || !filter.matches(n) {
+			continue
+		}
+		notices = append(notices, n)
+	}
+	sort.Slice(notices, func(i, j int) bool {
+		return notices[i].lastRepeated.Before(notices[j].lastRepeated)
+	})
+	return notices
+}
+
+// WaitNotices waits for notices that match the filter to exist or occur,
+// returning them as soon as there are any. It returns ctx's error if ctx is
+// done first. It must be called with the state lock held, which is released
+// while waiting.
+func (s *State) WaitNotices(ctx context.Context, filter *NoticeFilter) ([]*Notice, error) {
+	s.reading()
+
+	for {
+		notices := s.Notices(filter)
+		if len(notices) > 0 {
+			return notices, nil
+		}
+
+		if s.noticeAdded == nil {
+			s.noticeAdded = make(chan struct{})
+		}
+		added := s.noticeAdded
+		s.Unlock()
+		select {
+		case <-added:
+			s.Lock()
+		case <-ctx.Done():
+			s.Lock()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Notice returns the notice with the given ID, or nil if there's none.
+func (s *State) Notice(id string) *Notice {
+	s.reading()
+
+	now := time.Now()
+	for _, n := range s.notices {
+		if n.id == id && !n.expired(now) {
+			return n
+		}
+	}
+	return nil
+}
+
+// flattenNotices returns the non-expired notices as a flat list, for
+// serialising. Call with the lock held.
+func (s *State) flattenNotices() []*Notice {
+	now := time.Now()
+	var flat []*Notice
+	for _, n := range s.notices {
+		if n.expired(now) {
+			continue
+		}
+		flat = append(flat, n)
+	}
+	return flat
+}
+
+// unflattenNotices takes a flat list of notices and replaces the notices
+// map with them, ignoring expired notices. Call with the lock held.
+func (s *State) unflattenNotices(flat []*Notice) {
+	now := time.Now()
+	s.notices = make(map[string]*Notice, len(flat))
+	for _, n := range flat {
+		if n.expired(now) {
+			continue
+		}
+		s.notices[noticeKey(n.noticeType, n.key)] = n
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package state_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/overlord/state"
+)
+
+func (stateSuite) TestAddNotice(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	t0 := time.Now().UTC().Truncate(time.Second)
+	id1 := st.AddNotice(state.CustomNotice, "example.com/foo", &state.AddNoticeOptions{
+		Data: map[string]string{"a": "1"},
+		Time: t0,
+	})
+	id2 := st.AddNotice(state.CustomNotice, "example.com/bar", &state.AddNoticeOptions{
+		Time: t0.Add(time.Second),
+	})
+	c.Check(id1, check.Equals, "1")
+	c.Check(id2, check.Equals, "2")
+
+	// Same type and key updates the existing notice.
+	id := st.AddNotice(state.CustomNotice, "example.com/foo", &state.AddNoticeOptions{
+		Data: map[string]string{"a": "2"},
+		Time: t0.Add(2 * time.Second),
+	})
+	c.Check(id, check.Equals, id1)
+
+	notices := st.Notices(nil)
+	c.Assert(notices, check.HasLen, 2)
+	c.Check(notices[0].ID(), check.Equals, "2")
+	c.Check(notices[1].ID(), check.Equals, "1")
+
+	n := noticeToMap(c, st.Notice("1"))
+	c.Check(n, check.DeepEquals, map[string]interface{}{
+		"id":             "1",
+		"type":           "custom",
+		"key":            "example.com/foo",
+		"first-occurred": t0.Format(time.RFC3339),
+		"last-occurred":  t0.Add(2 * time.Second).Format(time.RFC3339),
+		"last-repeated":  t0.Add(2 * time.Second).Format(time.RFC3339),
+		"occurrences":    2.0,
+		"last-data":      map[string]interface{}{"a": "2"},
+		"expire-after":   "168h0m0s",
+	})
+	c.Check(st.Notice("3"), check.IsNil)
+}
+
+func (stateSuite) TestNoticeRepeatAfter(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	t0 := time.Now().UTC()
+	options := &state.AddNoticeOptions{RepeatAfter: time.Minute, Time: t0}
+	st.AddNotice(state.CustomNotice, "example.com/foo", options)
+	options.Time = t0.Add(30 * time.Second)
+	st.AddNotice(state.CustomNotice, "example.com/foo", options)
+	c.Check(st.Notice("1").LastRepeated(), check.Equals, t0)
+
+	options.Time = t0.Add(time.Minute)
+	st.AddNotice(state.CustomNotice, "example.com/foo", options)
+	c.Check(st.Notice("1").LastRepeated(), check.Equals, t0.Add(time.Minute))
+}
+
+func (stateSuite) TestNoticesFilter(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	t0 := time.Now().UTC()
+	st.AddNotice(state.CustomNotice, "example.com/a", &state.AddNoticeOptions{Time: t0})
+	st.AddNotice(state.CustomNotice, "example.com/b", &state.AddNoticeOptions{Time: t0.Add(time.Second)})
+	st.AddNotice(state.CustomNotice, "example.com/c", &state.AddNoticeOptions{Time: t0.Add(2 * time.Second)})
+
+	keys := func(notices []*state.Notice) []string {
+		var keys []string
+		for _, n := range notices {
+			keys = append(keys, n.Key())
+		}
+		return keys
+	}
+	c.Check(keys(st.Notices(&state.NoticeFilter{Keys: []string{"example.com/a", "example.com/c"}})),
+		check.DeepEquals, []string{"example.com/a", "example.com/c"})
+	c.Check(keys(st.Notices(&state.NoticeFilter{After: t0})),
+		check.DeepEquals, []string{"example.com/b", "example.com/c"})
+	c.Check(keys(st.Notices(&state.NoticeFilter{Types: []state.NoticeType{"other"}})), check.HasLen, 0)
+}
+
+func (stateSuite) TestNoticesExpireAndPersist(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	old := time.Now().Add(-state.DefaultNoticeExpireAfter - time.Hour)
+	st.AddNotice(state.CustomNotice, "example.com/old", &state.AddNoticeOptions{Time: old})
+	st.AddNotice(state.CustomNotice, "example.com/new", nil)
+	c.Assert(st.Notices(nil), check.HasLen, 1)
+
+	buf, err := json.Marshal(st)
+	c.Assert(err, check.IsNil)
+	st2, err := state.ReadState(nil, bytes.NewReader(buf))
+	c.Assert(err, check.IsNil)
+	st2.Lock()
+	defer st2.Unlock()
+	notices := st2.Notices(nil)
+	c.Assert(notices, check.HasLen, 1)
+	c.Check(notices[0].Key(), check.Equals, "example.com/new")
+
+	// IDs continue from the last one.
+	id := st2.AddNotice(state.CustomNotice, "example.com/other", nil)
+	c.Check(id, check.Equals, "3")
+}
+
+func (stateSuite) TestWaitNoticesExisting(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	st.AddNotice(state.CustomNotice, "example.com/foo", nil)
+	notices, err := st.WaitNotices(context.Background(), &state.NoticeFilter{Keys: []string{"example.com/foo"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(notices, check.HasLen, 1)
+	c.Check(notices[0].Key(), check.Equals, "example.com/foo")
+}
+
+func (stateSuite) TestWaitNoticesNew(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		st.Lock()
+		defer st.Unlock()
+		// A notice that doesn't match doesn't end the wait.
+		st.AddNotice(state.CustomNotice, "example.com/bar", nil)
+		st.AddNotice(state.CustomNotice, "example.com/foo", nil)
+	}()
+
+	notices, err := st.WaitNotices(context.Background(), &state.NoticeFilter{Keys: []string{"example.com/foo"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(notices, check.HasLen, 1)
+	c.Check(notices[0].Key(), check.Equals, "example.com/foo")
+}
+
+func (stateSuite) TestWaitNoticesTimeout(c *check.C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	notices, err := st.WaitNotices(ctx, nil)
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+	c.Check(notices, check.HasLen, 0)
+}
+
+func noticeToMap(c *check.C, notice *state.Notice) map[string]interface{} {
+	buf, err := json.Marshal(notice)
+	c.Assert(err, check.IsNil)
+	var n map[string]interface{}
+	c.Assert(json.Unmarshal(buf, &n), check.IsNil)
+	return n
+}
@@ -87,16 +87,26 @@ type State struct {
 	lastTaskId   int
 	lastChangeId int
 	lastLaneId   int
+	lastNoticeId int
 
 	backend  Backend
 	data     customData
 	changes  map[string]*Change
 	tasks    map[string]*Task
 	warnings map[string]*Warning
+	notices  map[string]*Notice
+
+	// noticeAdded is closed (and cleared) when a notice is added, to wake
+	// up WaitNotices callers
+	noticeAdded chan struct{}
 
 	modified bool
 
 	cache map[interface{}]interface{}
+
+	changeStatusHandlers []func(chg *Change, old, new Status)
+	taskStatusHandlers   []func(t *Task, old, new Status)
+	taskProgressHandlers []func(t *Task)
 }
 
 // New returns a new empty state.
@@ -107,6 +117,7 @@ func New(backend Backend) *State {
 		changes:  make(map[string]*Change),
 		tasks:    make(map[string]*Task),
 		warnings: make(map[string]*Warning),
+		notices:  make(map[string]*Notice),
 		modified: true,
 		cache:    make(map[interface{}]interface{}),
 	}
@@ -146,10 +157,12 @@ type marshalledState struct {
 	Changes  map[string]*Change          `json:"changes"`
 	Tasks    map[string]*Task            `json:"tasks"`
 	Warnings []*Warning                  `json:"warnings,omitempty"`
+	Notices  []*Notice                   `json:"notices,omitempty"`
 
 	LastChangeId int `json:"last-change-id"`
 	LastTaskId   int `json:"last-task-id"`
 	LastLaneId   int `json:"last-lane-id"`
+	LastNoticeId int `json:"last-notice-id,omitempty"`
 }
 
 // MarshalJSON makes State a json.Marshaller
@@ -160,10 +173,12 @@ func (s *State) MarshalJSON() ([]byte, error) {
 		Changes:  s.changes,
 		Tasks:    s.tasks,
 		Warnings: s.flattenWarnings(),
+		Notices:  s.flattenNotices(),
 
 		LastTaskId:   s.lastTaskId,
 		LastChangeId: s.lastChangeId,
 		LastLaneId:   s.lastLaneId,
+		LastNoticeId: s.lastNoticeId,
 	})
 }
 
@@ -179,9 +194,11 @@ func (s *State) UnmarshalJSON(data []byte) error {
 	s.changes = unmarshalled.Changes
 	s.tasks = unmarshalled.Tasks
 	s.unflattenWarnings(unmarshalled.Warnings)
+	s.unflattenNotices(unmarshalled.Notices)
 	s.lastChangeId = unmarshalled.LastChangeId
 	s.lastTaskId = unmarshalled.LastTaskId
 	s.lastLaneId = unmarshalled.LastLaneId
+	s.lastNoticeId = unmarshalled.LastNoticeId
 	// backlink state again
 	for _, t := range s.tasks {
 		t.state = s
@@ -274,6 +291,37 @@ func (s *State) Cache(key, value interface{}) {
 	}
 }
 
+// AddChangeStatusChangedHandler registers f to be called whenever the
+// aggregated status of a change differs from the one last observed. The
+// old status is DefaultStatus the first time a new change is observed.
+//
+// Handlers are called with the state lock held, so they must not block or
+// try to acquire it.
+func (s *State) AddChangeStatusChangedHandler(f func(chg *Change, old, new Status)) {
+	s.reading()
+	s.changeStatusHandlers = append(s.changeStatusHandlers, f)
+}
+
+// AddTaskStatusChangedHandler registers f to be called whenever the status
+// of a task is set to a different value.
+//
+// Handlers are called with the state lock held, so they must not block or
+// try to acquire it.
+func (s *State) AddTaskStatusChangedHandler(f func(t *Task, old, new Status)) {
+	s.reading()
+	s.taskStatusHandlers = append(s.taskStatusHandlers, f)
+}
+
+// AddTaskProgressHandler registers f to be called whenever the progress of
+// a task is updated.
+//
+// Handlers are called with the state lock held, so they must not block or
+// try to acquire it.
+func (s *State) AddTaskProgressHandler(f func(t *Task)) {
+	s.reading()
+	s.taskProgressHandlers = append(s.taskProgressHandlers, f)
+}
+
 // NewChange adds a new change to the state.
 func (s *State) NewChange(kind, summary string) *Change {
 	s.writing()
@@ -366,7 +414,7 @@ func (s *State) tasksIn(tids []string) []*Task {
 //    changes than the limit set via "maxReadyChanges" those changes in ready
 //    state will also removed even if they are below the pruneWait duration.
 //
-//  * it removes expired warnings.
+//  * it removes expired warnings and notices.
 func (s *State) Prune(pruneWait, abortWait time.Duration, maxReadyChanges int) {
 	now := time.Now()
 	pruneLimit := now.Add(-pruneWait)
@@ -394,6 +442,13 @@ func (s *State) Prune(pruneWait, abortWait time.Duration, maxReadyChanges int) {
 		}
 	}
 
+	for k, n := range s.notices {
+		if n.expired(now) {
+			s.writing()
+			delete(s.notices, k)
+		}
+	}
+
 	for _, chg := range changes {
 		spawnTime := chg.SpawnTime()
 		readyTime := chg.ReadyTime()
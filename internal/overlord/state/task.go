@@ -53,6 +53,7 @@ type Task struct {
 	change    string
 
 	spawnTime time.Time
+	startTime time.Time
 	readyTime time.Time
 
 	// TODO: add:
@@ -91,6 +92,7 @@ type marshalledTask struct {
 	Change    string                      `json:"change"`
 
 	SpawnTime time.Time  `json:"spawn-time"`
+	StartTime *time.Time `json:"start-time,omitempty"`
 	ReadyTime *time.Time `json:"ready-time,omitempty"`
 
 	DoingTime   time.Duration `json:"doing-time,omitempty"`
@@ -102,6 +104,10 @@ type marshalledTask struct {
 // MarshalJSON makes Task a json.Marshaller
 func (t *Task) MarshalJSON() ([]byte, error) {
 	t.state.reading()
+	var startTime *time.Time
+	if !t.startTime.IsZero() {
+		startTime = &t.startTime
+	}
 	var readyTime *time.Time
 	if !t.readyTime.IsZero() {
 		readyTime = &t.readyTime
@@ -125,6 +131,7 @@ func (t *Task) MarshalJSON() ([]byte, error) {
 		Change:    t.change,
 
 		SpawnTime: t.spawnTime,
+		StartTime: startTime,
 		ReadyTime: readyTime,
 
 		DoingTime:   t.doingTime,
@@ -161,6 +168,9 @@ func (t *Task) UnmarshalJSON(data []byte) error {
 	t.log = unmarshalled.Log
 	t.change = unmarshalled.Change
 	t.spawnTime = unmarshalled.SpawnTime
+	if unmarshalled.StartTime != nil {
+		t.startTime = *unmarshalled.StartTime
+	}
 	if unmarshalled.ReadyTime != nil {
 		t.readyTime = *unmarshalled.ReadyTime
 	}
@@ -204,6 +214,19 @@ func (t *Task) SetStatus(new Status) {
 	if !old.Ready() && new.Ready() {
 		t.readyTime = timeNow()
 	}
+	if len(t.state.taskStatusHandlers) > 0 {
+		// Report the statuses as Status would have returned them.
+		oldStatus := old
+		if oldStatus == DefaultStatus {
+			oldStatus = DoStatus
+		}
+		newStatus := t.Status()
+		if oldStatus != newStatus {
+			for _, f := range t.state.taskStatusHandlers {
+				f(t, oldStatus, newStatus)
+			}
+		}
+	}
 	chg := t.Change()
 	if chg != nil {
 		chg.taskStatusChanged(t, old, new)
@@ -270,6 +293,9 @@ func (t *Task) SetProgress(label string, done, total int) {
 	} else {
 		t.progress = &progress{Label: label, Done: done, Total: total}
 	}
+	for _, f := range t.state.taskProgressHandlers {
+		f(t)
+	}
 }
 
 // SpawnTime returns the time when the change was created.
@@ -284,6 +310,20 @@ func (t *Task) ReadyTime() time.Time {
 	return t.readyTime
 }
 
+// StartTime returns the time when the task's handler first started running,
+// or the zero time if it hasn't run yet.
+func (t *Task) StartTime() time.Time {
+	t.state.reading()
+	return t.startTime
+}
+
+func (t *Task) markStarted() {
+	t.state.writing()
+	if t.startTime.IsZero() {
+		t.startTime = timeNow()
+	}
+}
+
 // AtTime returns the time at which the task is scheduled to run. A zero time means no special schedule, i.e. run as soon as prerequisites are met.
 func (t *Task) AtTime() time.Time {
 	t.state.reading()
@@ -300,11 +340,13 @@ func (t *Task) accumulateUndoingTime(duration time.Duration) {
 	t.undoingTime += duration
 }
 
+// DoingTime returns the total time the task's do handler has run for.
 func (t *Task) DoingTime() time.Duration {
 	t.state.reading()
 	return t.doingTime
 }
 
+// UndoingTime returns the total time the task's undo handler has run for.
 func (t *Task) UndoingTime() time.Duration {
 	t.state.reading()
 	return t.undoingTime
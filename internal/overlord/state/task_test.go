@@ -20,6 +20,7 @@
 package state_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -280,6 +281,35 @@ func (ts *taskSuite) TestTaskMarshalsDoingUndoingTime(c *C) {
 	c.Assert(string(d), testutil.Contains, `"undoing-time":654321`)
 }
 
+func (ts *taskSuite) TestTaskMarshalsStartTime(c *C) {
+	st := state.New(nil)
+	st.Lock()
+	defer st.Unlock()
+
+	chg := st.NewChange("install", "...")
+	t := st.NewTask("download", "1...")
+	chg.AddTask(t)
+	d, err := t.MarshalJSON()
+	c.Assert(err, IsNil)
+	c.Check(string(d), Not(testutil.Contains), `"start-time"`)
+
+	startTime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	restore := state.FakeTime(startTime)
+	defer restore()
+	t.MarkStarted()
+	d, err = t.MarshalJSON()
+	c.Assert(err, IsNil)
+	c.Check(string(d), testutil.Contains, `"start-time":"2021-01-02T03:04:05Z"`)
+
+	data, err := json.Marshal(st)
+	c.Assert(err, IsNil)
+	st2, err := state.ReadState(nil, bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	st2.Lock()
+	defer st2.Unlock()
+	c.Check(st2.Task(t.ID()).StartTime().Equal(startTime), Equals, true)
+}
+
 func (ts *taskSuite) TestTaskWaitFor(c *C) {
 	st := state.New(nil)
 	st.Lock()
@@ -428,6 +458,7 @@ func (cs *taskSuite) TestMethodEntrance(c *C) {
 		func() { t1.Lanes() },
 		func() { t1.DoingTime() },
 		func() { t1.UndoingTime() },
+		func() { t1.StartTime() },
 	}
 
 	for i, f := range reads {
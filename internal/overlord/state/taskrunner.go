@@ -20,6 +20,7 @@
 package state
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -36,10 +37,16 @@ type HandlerFunc func(task *Task, tomb *tomb.Tomb) error
 // is asked to stop through its tomb. After can be used to indicate
 // how much to postpone the retry, 0 (the default) means at the next
 // ensure pass and is what should be used if stopped through its tomb.
-// Reason is an optional explanation of the conflict.
+// Reason is an optional explanation of the conflict. MaxAttempts, if
+// non-zero, is the maximum number of times the handler may be run before
+// the task fails instead of being retried again; the number of attempts
+// so far is tracked separately for the do and undo handlers, in the task's
+// "do-retry-attempts" and "undo-retry-attempts" data, and is reset when the
+// handler succeeds.
 type Retry struct {
-	After  time.Duration
-	Reason string
+	After       time.Duration
+	Reason      string
+	MaxAttempts int
 }
 
 func (r *Retry) Error() string {
@@ -162,6 +169,7 @@ func (r *TaskRunner) AddBlocked(pred func(t *Task, running []*Task) bool) {
 func (r *TaskRunner) run(t *Task) {
 	var handler HandlerFunc
 	var accuRuntime func(dur time.Duration)
+	var attemptsKey string
 	switch t.Status() {
 	case DoStatus:
 		t.SetStatus(DoingStatus)
@@ -169,6 +177,7 @@ func (r *TaskRunner) run(t *Task) {
 	case DoingStatus:
 		handler = r.handlerPair(t).do
 		accuRuntime = t.accumulateDoingTime
+		attemptsKey = "do-retry-attempts"
 
 	case UndoStatus:
 		t.SetStatus(UndoingStatus)
@@ -176,6 +185,7 @@ func (r *TaskRunner) run(t *Task) {
 	case UndoingStatus:
 		handler = r.handlerPair(t).undo
 		accuRuntime = t.accumulateUndoingTime
+		attemptsKey = "undo-retry-attempts"
 
 	default:
 		panic("internal error: attempted to run task in status " + t.Status().String())
@@ -185,6 +195,7 @@ func (r *TaskRunner) run(t *Task) {
 	}
 
 	t.At(time.Time{}) // clear schedule
+	t.markStarted()
 	tomb := &tomb.Tomb{}
 	r.tombs[t.ID()] = tomb
 	tomb.Go(func() error {
@@ -224,6 +235,10 @@ func (r *TaskRunner) run(t *Task) {
 			}
 		}
 
+		if x, ok := err.(*Retry); ok && x.MaxAttempts > 0 && !r.stopped && t.Status() != AbortStatus {
+			err = retryAttempt(t, x, attemptsKey)
+		}
+
 		switch x := err.(type) {
 		case *Retry:
 			// Handler asked to be called again later.
@@ -235,6 +250,7 @@ func (r *TaskRunner) run(t *Task) {
 				t.At(timeNow().Add(x.After))
 			}
 		case nil:
+			t.Clear(attemptsKey)
 			var next []*Task
 			switch t.Status() {
 			case DoingStatus:
@@ -265,6 +281,26 @@ func (r *TaskRunner) run(t *Task) {
 	})
 }
 
+// retryAttempt records another attempt of the task's handler in the task's
+// attemptsKey data, returning the retry unchanged if the attempt budget
+// allows another attempt, or an error if the budget is exhausted.
+func retryAttempt(t *Task, retry *Retry, attemptsKey string) error {
+	var attempts int
+	err := t.Get(attemptsKey, &attempts)
+	if err != nil && err != ErrNoState {
+		return err
+	}
+	attempts++
+	if attempts >= retry.MaxAttempts {
+		if retry.Reason != "" {
+			return fmt.Errorf("giving up after %d attempts: %s", attempts, retry.Reason)
+		}
+		return fmt.Errorf("giving up after %d attempts", attempts)
+	}
+	t.Set(attemptsKey, attempts)
+	return retry
+}
+
 func (r *TaskRunner) clean(t *Task) {
 	if !t.Change().IsReady() {
 		// Whole Change is not ready so don't run cleanups yet.
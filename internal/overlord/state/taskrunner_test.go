@@ -401,6 +401,8 @@ func (ts *taskRunnerSuite) TestStopHandlerJustFinishing(c *C) {
 	c.Check(t.Status(), Equals, state.DoneStatus)
 	c.Check(t.DoingTime(), Not(Equals), 0)
 	c.Check(t.UndoingTime(), Equals, time.Duration(0))
+	c.Check(t.StartTime().IsZero(), Equals, false)
+	c.Check(t.StartTime().Before(t.SpawnTime()), Equals, false)
 }
 
 func (ts *taskRunnerSuite) TestStopKinds(c *C) {
@@ -508,6 +510,97 @@ func (ts *taskRunnerSuite) TestStopAskForRetry(c *C) {
 	c.Check(t.AtTime().IsZero(), Equals, false)
 }
 
+func (ts *taskRunnerSuite) TestRetryMaxAttempts(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	attempts := 0
+	r.AddHandler("retry-forever", func(t *state.Task, _ *tomb.Tomb) error {
+		attempts++
+		return &state.Retry{Reason: "socket not ready", MaxAttempts: 3}
+	}, nil)
+	r.AddHandler("retry-once", func(t *state.Task, _ *tomb.Tomb) error {
+		var n int
+		t.State().Lock()
+		t.Get("do-retry-attempts", &n)
+		t.State().Unlock()
+		if n == 0 {
+			return &state.Retry{MaxAttempts: 2}
+		}
+		return nil
+	}, nil)
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	t1 := st.NewTask("retry-forever", "...")
+	chg.AddTask(t1)
+	chg2 := st.NewChange("install", "...")
+	t2 := st.NewTask("retry-once", "...")
+	chg2.AddTask(t2)
+	st.Unlock()
+
+	for i := 0; i < 5; i++ {
+		r.Ensure()
+		r.Wait()
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	c.Check(attempts, Equals, 3)
+	c.Check(t1.Status(), Equals, state.ErrorStatus)
+	c.Check(strings.Join(t1.Log(), ""), Matches, `.*giving up after 3 attempts: socket not ready`)
+	c.Check(t2.Status(), Equals, state.DoneStatus)
+	c.Check(t2.Has("do-retry-attempts"), Equals, false)
+}
+
+func (ts *taskRunnerSuite) TestRetryMaxAttemptsUndo(c *C) {
+	sb := &stateBackend{}
+	st := state.New(sb)
+	r := state.NewTaskRunner(st)
+	defer r.Stop()
+
+	undoAttempts := 0
+	r.AddHandler("retry", func(t *state.Task, _ *tomb.Tomb) error {
+		return &state.Retry{MaxAttempts: 3}
+	}, func(t *state.Task, _ *tomb.Tomb) error {
+		undoAttempts++
+		if undoAttempts == 1 {
+			return &state.Retry{MaxAttempts: 2}
+		}
+		return nil
+	})
+
+	st.Lock()
+	chg := st.NewChange("install", "...")
+	t := st.NewTask("retry", "...")
+	chg.AddTask(t)
+	st.Unlock()
+
+	for i := 0; i < 2; i++ {
+		r.Ensure()
+		r.Wait()
+	}
+
+	st.Lock()
+	c.Check(t.Status(), Equals, state.DoingStatus)
+	chg.Abort()
+	st.Unlock()
+
+	// The do attempts so far don't count towards the undo handler's budget.
+	for i := 0; i < 3; i++ {
+		r.Ensure()
+		r.Wait()
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	c.Check(undoAttempts, Equals, 2)
+	c.Check(t.Status(), Equals, state.UndoneStatus)
+	c.Check(t.Has("undo-retry-attempts"), Equals, false)
+}
+
 func (ts *taskRunnerSuite) TestRetryAfterDuration(c *C) {
 	ensureBeforeTick := make(chan bool, 1)
 	sb := &stateBackend{
@@ -0,0 +1,109 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+type DiffKind string
+
+const (
+	DiffAdded    DiffKind = "added"
+	DiffModified DiffKind = "modified"
+	DiffRemoved  DiffKind = "removed"
+)
+
+// ServiceDiff describes how a service differs between two plans.
+type ServiceDiff struct {
+	Name string
+	Kind DiffKind
+	// Fields holds the names of the YAML fields that changed, sorted, if
+	// the service was modified.
+	Fields []string
+}
+
+// DiffServices compares two sets of services (for example, the services of a
+// plan before and after adding a layer), and returns the services that were
+// added, modified, or removed, sorted by name.
+func DiffServices(old, new map[string]*Service) ([]*ServiceDiff, error) {
+	var diffs []*ServiceDiff
+	for name, oldService := range old {
+		newService, ok := new[name]
+		if !ok {
+			diffs = append(diffs, &ServiceDiff{Name: name, Kind: DiffRemoved})
+			continue
+		}
+		fields, err := diffFields(oldService, newService)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) > 0 {
+			diffs = append(diffs, &ServiceDiff{Name: name, Kind: DiffModified, Fields: fields})
+		}
+	}
+	for name := range new {
+		if _, ok := old[name]; !ok {
+			diffs = append(diffs, &ServiceDiff{Name: name, Kind: DiffAdded})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Name < diffs[j].Name
+	})
+	return diffs, nil
+}
+
+// diffFields returns the sorted names of the YAML fields that differ between
+// the two services.
+func diffFields(old, new *Service) ([]string, error) {
+	oldFields, err := serviceFields(old)
+	if err != nil {
+		return nil, err
+	}
+	newFields, err := serviceFields(new)
+	if err != nil {
+		return nil, err
+	}
+	var fields []string
+	for field, oldValue := range oldFields {
+		if !reflect.DeepEqual(oldValue, newFields[field]) {
+			fields = append(fields, field)
+		}
+	}
+	for field := range newFields {
+		if _, ok := oldFields[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// serviceFields returns the service's fields as they appear in YAML.
+func serviceFields(service *Service) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(service)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = yaml.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
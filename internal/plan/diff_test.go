@@ -0,0 +1,70 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/plan"
+)
+
+func (s *S) TestDiffServices(c *C) {
+	layer1, err := plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			srv1:
+				override: replace
+				command: cmd1
+			srv2:
+				override: replace
+				command: cmd2
+				environment:
+					FOO: foo
+			srv3:
+				override: replace
+				command: cmd3`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(2, "layer2", reindent(`
+		services:
+			srv2:
+				override: merge
+				command: cmd2b
+				startup: enabled
+				environment:
+					BAR: bar
+			srv3:
+				override: merge
+			srv4:
+				override: replace
+				command: cmd4`))
+	c.Assert(err, IsNil)
+
+	old, err := plan.CombineLayers(layer1)
+	c.Assert(err, IsNil)
+	new, err := plan.CombineLayers(layer1, layer2)
+	c.Assert(err, IsNil)
+	delete(new.Services, "srv1")
+
+	diffs, err := plan.DiffServices(old.Services, new.Services)
+	c.Assert(err, IsNil)
+	c.Check(diffs, DeepEquals, []*plan.ServiceDiff{
+		{Name: "srv1", Kind: plan.DiffRemoved},
+		{Name: "srv2", Kind: plan.DiffModified, Fields: []string{"command", "environment", "startup"}},
+		{Name: "srv4", Kind: plan.DiffAdded},
+	})
+
+	diffs, err = plan.DiffServices(old.Services, old.Services)
+	c.Assert(err, IsNil)
+	c.Check(diffs, HasLen, 0)
+}
@@ -22,22 +22,34 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"golang.org/x/sys/unix"
 	"gopkg.in/yaml.v3"
+
+	"github.com/canonical/pebble/internal/sandbox"
+	"github.com/canonical/pebble/internal/secrets"
+	"github.com/canonical/pebble/internal/strutil"
+	"github.com/canonical/pebble/internal/strutil/shlex"
 )
 
 const (
 	defaultBackoffDelay  = 500 * time.Millisecond
 	defaultBackoffFactor = 2.0
 	defaultBackoffLimit  = 30 * time.Second
+
+	defaultCheckPeriod    = 10 * time.Second
+	defaultCheckTimeout   = 3 * time.Second
+	defaultCheckThreshold = 3
 )
 
 type Plan struct {
 	Layers   []*Layer            `yaml:"-"`
 	Services map[string]*Service `yaml:"services,omitempty"`
+	Checks   map[string]*Check   `yaml:"checks,omitempty"`
 }
 
 type Layer struct {
@@ -45,7 +57,17 @@ type Layer struct {
 	Label       string              `yaml:"-"`
 	Summary     string              `yaml:"summary,omitempty"`
 	Description string              `yaml:"description,omitempty"`
+	Include     []string            `yaml:"include,omitempty"`
+	Vars        map[string]string   `yaml:"vars,omitempty"`
 	Services    map[string]*Service `yaml:"services,omitempty"`
+	Checks      map[string]*Check   `yaml:"checks,omitempty"`
+
+	// Dynamic is true for a layer added via the API, rather than read from
+	// the layers directory. Dynamic layers are only kept in memory, unless
+	// Persist is also true, in which case they're saved in the daemon's
+	// state and restored when it restarts.
+	Dynamic bool `yaml:"-"`
+	Persist bool `yaml:"-"`
 }
 
 type Service struct {
@@ -55,7 +77,15 @@ type Service struct {
 	Description string          `yaml:"description,omitempty"`
 	Startup     ServiceStartup  `yaml:"startup,omitempty"`
 	Override    ServiceOverride `yaml:"override,omitempty"`
-	Command     string          `yaml:"command,omitempty"`
+	Command     ServiceCommand  `yaml:"command,omitempty"`
+
+	// Another service in the plan whose configuration this one inherits,
+	// with the fields set here merged over it
+	Extends string `yaml:"extends,omitempty"`
+
+	// One-shot services run to completion rather than being kept running
+	Kind            ServiceKind `yaml:"kind,omitempty"`
+	RemainAfterExit bool        `yaml:"remain-after-exit,omitempty"`
 
 	// Service dependencies
 	After    []string `yaml:"after,omitempty"`
@@ -63,11 +93,14 @@ type Service struct {
 	Requires []string `yaml:"requires,omitempty"`
 
 	// Options for command execution
-	Environment map[string]string `yaml:"environment,omitempty"`
-	UserID      *int              `yaml:"user-id,omitempty"`
-	User        string            `yaml:"user,omitempty"`
-	GroupID     *int              `yaml:"group-id,omitempty"`
-	Group       string            `yaml:"group,omitempty"`
+	Environment      map[string]string `yaml:"environment,omitempty"`
+	EnvironmentFiles []string          `yaml:"environment-files,omitempty"`
+	WorkingDir       string            `yaml:"working-dir,omitempty"`
+	Umask            string            `yaml:"umask,omitempty"`
+	UserID           *int              `yaml:"user-id,omitempty"`
+	User             string            `yaml:"user,omitempty"`
+	GroupID          *int              `yaml:"group-id,omitempty"`
+	Group            string            `yaml:"group,omitempty"`
 
 	// Auto-restart and backoff functionality
 	OnSuccess     ServiceAction    `yaml:"on-success,omitempty"`
@@ -75,6 +108,55 @@ type Service struct {
 	BackoffDelay  OptionalDuration `yaml:"backoff-delay,omitempty"`
 	BackoffFactor OptionalFloat    `yaml:"backoff-factor,omitempty"`
 	BackoffLimit  OptionalDuration `yaml:"backoff-limit,omitempty"`
+
+	// Signal sent to the service to stop it gracefully, before SIGKILL
+	StopSignal string `yaml:"stop-signal,omitempty"`
+
+	// Whether stop and kill signals are sent to the service's whole process
+	// group, or only to the process Pebble started
+	KillMode KillMode `yaml:"kill-mode,omitempty"`
+
+	// How to make the service reload its configuration without restarting
+	// it: a command to run, or a signal to send to its process (at most one
+	// of these is set)
+	ReloadCommand string `yaml:"reload-command,omitempty"`
+	ReloadSignal  string `yaml:"reload-signal,omitempty"`
+
+	// Stop restarting the service if it's restarted more than
+	// StartLimitBurst times within StartLimitInterval
+	StartLimitBurst    int              `yaml:"start-limit-burst,omitempty"`
+	StartLimitInterval OptionalDuration `yaml:"start-limit-interval,omitempty"`
+
+	// How long the service must run without exiting before its start is
+	// considered successful
+	OkayDelay OptionalDuration `yaml:"okay-delay,omitempty"`
+
+	// Readiness: starting the service only completes (and services ordered
+	// after it are only started) once all of these checks pass
+	ReadyChecks  []string         `yaml:"ready-checks,omitempty"`
+	ReadyTimeout OptionalDuration `yaml:"ready-timeout,omitempty"`
+
+	// The service must ping its watchdog at least this often, or it's
+	// considered hung and killed
+	Watchdog OptionalDuration `yaml:"watchdog,omitempty"`
+
+	// Commands run before the service is started, after it has started,
+	// and after it has stopped
+	Hooks ServiceHooks `yaml:"hooks,omitempty"`
+
+	// Write output to a file on disk as well as the in-memory log buffer
+	LogTo *LogTo `yaml:"log-to,omitempty"`
+
+	// Send output to the systemd journal, identified by the service name
+	LogToJournald bool `yaml:"log-to-journald,omitempty"`
+
+	// Sandboxing applied to the service's process
+	Seccomp         string   `yaml:"seccomp,omitempty"`
+	AppArmorProfile string   `yaml:"apparmor-profile,omitempty"`
+	Capabilities    []string `yaml:"capabilities,omitempty"`
+	Mounts          []Mount  `yaml:"mounts,omitempty"`
+	Network         string   `yaml:"network,omitempty"`
+	PIDNamespace    bool     `yaml:"pid-namespace,omitempty"`
 }
 
 // Copy returns a deep copy of the service.
@@ -83,6 +165,10 @@ func (s *Service) Copy() *Service {
 	copy.After = append([]string(nil), s.After...)
 	copy.Before = append([]string(nil), s.Before...)
 	copy.Requires = append([]string(nil), s.Requires...)
+	copy.ReadyChecks = append([]string(nil), s.ReadyChecks...)
+	copy.EnvironmentFiles = append([]string(nil), s.EnvironmentFiles...)
+	copy.Capabilities = append([]string(nil), s.Capabilities...)
+	copy.Mounts = append([]Mount(nil), s.Mounts...)
 	if s.Environment != nil {
 		copy.Environment = make(map[string]string)
 		for k, v := range s.Environment {
@@ -97,9 +183,120 @@ func (s *Service) Copy() *Service {
 		groupID := *s.GroupID
 		copy.GroupID = &groupID
 	}
+	if s.LogTo != nil {
+		logTo := *s.LogTo
+		copy.LogTo = &logTo
+	}
+	copy.Hooks = s.Hooks.copy()
 	return &copy
 }
 
+// Instantiate returns a copy of the template service instantiated with the
+// given instance parameter, with "%i" in the command and environment values
+// replaced by the parameter.
+func (s *Service) Instantiate(instance string) *Service {
+	copy := s.Copy()
+	copy.Name = s.Name + instance
+	copy.Command = ServiceCommand(strings.ReplaceAll(string(s.Command), "%i", instance))
+	for k, v := range copy.Environment {
+		copy.Environment[k] = strings.ReplaceAll(v, "%i", instance)
+	}
+	for i, path := range copy.EnvironmentFiles {
+		copy.EnvironmentFiles[i] = strings.ReplaceAll(path, "%i", instance)
+	}
+	copy.WorkingDir = strings.ReplaceAll(s.WorkingDir, "%i", instance)
+	if copy.LogTo != nil {
+		copy.LogTo.Path = strings.ReplaceAll(copy.LogTo.Path, "%i", instance)
+	}
+	copy.ReloadCommand = strings.ReplaceAll(s.ReloadCommand, "%i", instance)
+	for _, hook := range []*ServiceHook{copy.Hooks.PreStart, copy.Hooks.PostStart, copy.Hooks.PostStop} {
+		if hook != nil {
+			hook.Command = strings.ReplaceAll(hook.Command, "%i", instance)
+		}
+	}
+	return copy
+}
+
+// ParseCommand splits the service command into its base arguments and its
+// default arguments. The default arguments are those in a trailing
+// "[ ... ]" group, as in "server --port 80 [ --debug ]", and may be replaced
+// when the service is started. The returned hasDefaults reports whether the
+// command has such a group at all.
+func (s *Service) ParseCommand() (base, defaults []string, hasDefaults bool, err error) {
+	args, err := shlex.Split(string(s.Command))
+	if err != nil {
+		return nil, nil, false, err
+	}
+	start := -1
+	for i, arg := range args {
+		switch arg {
+		case "[":
+			if start >= 0 {
+				return nil, nil, false, fmt.Errorf("cannot nest [ ... ] groups")
+			}
+			start = i
+		case "]":
+			if start < 0 {
+				return nil, nil, false, fmt.Errorf("cannot have ] outside of [ ... ] group")
+			}
+			if i != len(args)-1 {
+				return nil, nil, false, fmt.Errorf("cannot have any arguments after [ ... ] group")
+			}
+			return args[:start], args[start+1 : i], true, nil
+		}
+	}
+	if start >= 0 {
+		return nil, nil, false, fmt.Errorf("cannot have [ without a closing ]")
+	}
+	return args, nil, false, nil
+}
+
+// ParseUmask returns the service's umask, given in octal, or nil if it
+// isn't set.
+func (s *Service) ParseUmask() (*int, error) {
+	if s.Umask == "" {
+		return nil, nil
+	}
+	umask, err := strconv.ParseUint(s.Umask, 8, 32)
+	if err != nil || umask > 0777 {
+		return nil, fmt.Errorf("umask must be an octal number from 000 to 777, not %q", s.Umask)
+	}
+	v := int(umask)
+	return &v, nil
+}
+
+// ParseStopSignal returns the signal used to stop the service gracefully,
+// which is SIGTERM unless stop-signal is set.
+func (s *Service) ParseStopSignal() (unix.Signal, error) {
+	if s.StopSignal == "" {
+		return unix.SIGTERM, nil
+	}
+	sig := unix.SignalNum(s.StopSignal)
+	if sig == 0 {
+		return 0, fmt.Errorf("stop-signal must be a signal name such as SIGINT, not %q", s.StopSignal)
+	}
+	return sig, nil
+}
+
+// ParseReloadSignal returns the signal sent to the service to reload it, or
+// zero if reload-signal isn't set.
+func (s *Service) ParseReloadSignal() (unix.Signal, error) {
+	if s.ReloadSignal == "" {
+		return 0, nil
+	}
+	sig := unix.SignalNum(s.ReloadSignal)
+	if sig == 0 {
+		return 0, fmt.Errorf("reload-signal must be a signal name such as SIGHUP, not %q", s.ReloadSignal)
+	}
+	return sig, nil
+}
+
+// CanReload reports whether the service has a way to reload its
+// configuration without being restarted.
+func (s *Service) CanReload() bool {
+	return s.ReloadCommand != "" || s.ReloadSignal != ""
+}
+
 // Equal returns true when the two services are equal in value.
 func (s *Service) Equal(other *Service) bool {
 	if s == other {
@@ -108,6 +305,119 @@ func (s *Service) Equal(other *Service) bool {
 	return reflect.DeepEqual(s, other)
 }
 
+// LogTo specifies a file that a service's output is written to, in addition
+// to the in-memory log buffer.
+type LogTo struct {
+	// Path is the absolute path of the log file.
+	Path string `yaml:"path,omitempty"`
+
+	// MaxSize is the size the file may grow to before it's rotated; zero
+	// means the file is never rotated.
+	MaxSize ByteSize `yaml:"max-size,omitempty"`
+
+	// Backups is the number of rotated files to keep.
+	Backups int `yaml:"backups,omitempty"`
+
+	// Compress specifies whether rotated files are gzip-compressed.
+	Compress bool `yaml:"compress,omitempty"`
+}
+
+// ServiceHooks specifies the commands run at points in a service's
+// lifecycle. Each is run as a task of its own in the change that starts or
+// stops the service.
+type ServiceHooks struct {
+	// PreStart is run before the service is started; if it fails (and
+	// aborts), the service isn't started.
+	PreStart *ServiceHook `yaml:"pre-start,omitempty"`
+
+	// PostStart is run once the service has started successfully.
+	PostStart *ServiceHook `yaml:"post-start,omitempty"`
+
+	// PostStop is run after the service has been stopped.
+	PostStop *ServiceHook `yaml:"post-stop,omitempty"`
+}
+
+// Hook returns the hook with the given name ("pre-start", "post-start" or
+// "post-stop"), or nil if it isn't set.
+func (h *ServiceHooks) Hook(name string) *ServiceHook {
+	switch name {
+	case "pre-start":
+		return h.PreStart
+	case "post-start":
+		return h.PostStart
+	case "post-stop":
+		return h.PostStop
+	default:
+		return nil
+	}
+}
+
+func (h ServiceHooks) copy() ServiceHooks {
+	copyHook := func(hook *ServiceHook) *ServiceHook {
+		if hook == nil {
+			return nil
+		}
+		copy := *hook
+		return &copy
+	}
+	return ServiceHooks{
+		PreStart:  copyHook(h.PreStart),
+		PostStart: copyHook(h.PostStart),
+		PostStop:  copyHook(h.PostStop),
+	}
+}
+
+// ServiceHook specifies a command run at a point in a service's lifecycle.
+// It's run with the service's environment, user, group and working
+// directory.
+type ServiceHook struct {
+	// Command is the command line to run, split as the service command is.
+	Command string `yaml:"command,omitempty"`
+
+	// Timeout is how long the command may run before it's killed and
+	// considered to have failed.
+	Timeout OptionalDuration `yaml:"timeout,omitempty"`
+
+	// OnFailure is what happens when the command fails: "abort" (the
+	// default) fails its task, and with it the change, while "warn" only
+	// logs the failure.
+	OnFailure HookFailureAction `yaml:"on-failure,omitempty"`
+}
+
+// merge merges the fields set in other into h.
+func (h *ServiceHook) merge(other *ServiceHook) {
+	if other.Command != "" {
+		h.Command = other.Command
+	}
+	if other.Timeout.IsSet {
+		h.Timeout = other.Timeout
+	}
+	if other.OnFailure != HookFailureUnset {
+		h.OnFailure = other.OnFailure
+	}
+}
+
+type HookFailureAction string
+
+const (
+	HookFailureUnset HookFailureAction = ""
+	HookFailureAbort HookFailureAction = "abort"
+	HookFailureWarn  HookFailureAction = "warn"
+)
+
+// Mount specifies a host path that's bind-mounted into the service's
+// private mount namespace.
+type Mount struct {
+	// Source is the absolute path of the host file or directory mounted.
+	Source string `yaml:"source"`
+
+	// Target is the absolute path it's mounted on.
+	Target string `yaml:"target"`
+
+	// ReadOnly specifies whether the mount is read-only.
+	ReadOnly bool `yaml:"read-only,omitempty"`
+}
+
 type ServiceStartup string
 
 const (
@@ -116,6 +426,22 @@ const (
 	StartupDisabled ServiceStartup = "disabled"
 )
 
+type ServiceKind string
+
+const (
+	KindUnknown ServiceKind = ""
+	KindDaemon  ServiceKind = "daemon"
+	KindOneshot ServiceKind = "oneshot"
+)
+
+type KillMode string
+
+const (
+	KillModeUnknown      KillMode = ""
+	KillModeProcessGroup KillMode = "process-group"
+	KillModeProcess      KillMode = "process"
+)
+
 type ServiceOverride string
 
 const (
@@ -133,10 +459,154 @@ const (
 	ActionIgnore  ServiceAction = "ignore"
 )
 
+// Check specifies configuration for a single health check.
+type Check struct {
+	// Basic details
+	Name     string          `yaml:"-"`
+	Override ServiceOverride `yaml:"override,omitempty"`
+	Level    CheckLevel      `yaml:"level,omitempty"`
+
+	// Common check settings
+	Period    OptionalDuration `yaml:"period,omitempty"`
+	Timeout   OptionalDuration `yaml:"timeout,omitempty"`
+	Threshold int              `yaml:"threshold,omitempty"`
+
+	// Type-specific check settings (only one of these can be set)
+	HTTP *HTTPCheck `yaml:"http,omitempty"`
+	TCP  *TCPCheck  `yaml:"tcp,omitempty"`
+	Exec *ExecCheck `yaml:"exec,omitempty"`
+}
+
+// Copy returns a deep copy of the check configuration.
+func (c *Check) Copy() *Check {
+	copy := *c
+	if c.HTTP != nil {
+		copy.HTTP = c.HTTP.Copy()
+	}
+	if c.TCP != nil {
+		copy.TCP = c.TCP.Copy()
+	}
+	if c.Exec != nil {
+		copy.Exec = c.Exec.Copy()
+	}
+	return &copy
+}
+
+// CheckLevel specifies the optional check level.
+type CheckLevel string
+
+const (
+	UnsetLevel CheckLevel = ""
+	AliveLevel CheckLevel = "alive"
+	ReadyLevel CheckLevel = "ready"
+)
+
+// HTTPCheck holds the configuration for an HTTP health check.
+type HTTPCheck struct {
+	URL     string            `yaml:"url,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// Copy returns a deep copy of the HTTP check configuration.
+func (c *HTTPCheck) Copy() *HTTPCheck {
+	copy := *c
+	if c.Headers != nil {
+		copy.Headers = make(map[string]string, len(c.Headers))
+		for k, v := range c.Headers {
+			copy.Headers[k] = v
+		}
+	}
+	return &copy
+}
+
+// TCPCheck holds the configuration for a TCP health check.
+type TCPCheck struct {
+	Port int    `yaml:"port,omitempty"`
+	Host string `yaml:"host,omitempty"`
+}
+
+// Copy returns a deep copy of the TCP check configuration.
+func (c *TCPCheck) Copy() *TCPCheck {
+	copy := *c
+	return &copy
+}
+
+// ExecCheck holds the configuration for an exec health check.
+type ExecCheck struct {
+	Command     string            `yaml:"command,omitempty"`
+	Environment map[string]string `yaml:"environment,omitempty"`
+	WorkingDir  string            `yaml:"working-dir,omitempty"`
+}
+
+// Copy returns a deep copy of the exec check configuration.
+func (c *ExecCheck) Copy() *ExecCheck {
+	copy := *c
+	if c.Environment != nil {
+		copy.Environment = make(map[string]string, len(c.Environment))
+		for k, v := range c.Environment {
+			copy.Environment[k] = v
+		}
+	}
+	return &copy
+}
+
+// templateSuffix is the suffix that marks a service as a template, for
+// example "worker@". Templates are started by appending an instance
+// parameter to the name, for example "worker@3".
+const templateSuffix = "@"
+
+var instanceExp = regexp.MustCompile(`^[A-Za-z0-9._:-]+$`)
+
+// IsTemplateName reports whether name is the name of a template service.
+func IsTemplateName(name string) bool {
+	return strings.HasSuffix(name, templateSuffix)
+}
+
+// SplitInstanceName splits a template instance name such as "worker@3" into
+// its template name ("worker@") and instance parameter ("3"). It returns
+// ok=false if name is not a valid instance name.
+func SplitInstanceName(name string) (template, instance string, ok bool) {
+	i := strings.Index(name, templateSuffix)
+	if i < 0 {
+		return "", "", false
+	}
+	template, instance = name[:i+len(templateSuffix)], name[i+len(templateSuffix):]
+	if !instanceExp.MatchString(instance) {
+		return "", "", false
+	}
+	return template, instance, true
+}
+
+// lookupService returns the named service from services. If name refers to
+// an instance of a template service, the instantiated template is returned.
+func lookupService(services map[string]*Service, name string) (*Service, bool) {
+	if service, ok := services[name]; ok {
+		return service, true
+	}
+	template, instance, ok := SplitInstanceName(name)
+	if !ok {
+		return nil, false
+	}
+	service, ok := services[template]
+	if !ok {
+		return nil, false
+	}
+	return service.Instantiate(instance), true
+}
+
 // FormatError is the error returned when a layer has a format error, such as
 // a missing "override" field.
 type FormatError struct {
 	Message string
+
+	// Layer, Service, Check, and Field optionally identify where the error
+	// is, for tools that report the position of the error in the layer
+	// file. Layer is the layer label, and Field is a field of the service
+	// or check.
+	Layer   string
+	Service string
+	Check   string
+	Field   string
 }
 
 func (e *FormatError) Error() string {
@@ -146,6 +616,140 @@ func (e *FormatError) Error() string {
 // CombineLayers combines the given layers into a single layer, with the later
 // layers overriding earlier ones.
 func CombineLayers(layers ...*Layer) (*Layer, error) {
+	combined, err := mergeLayers(layers...)
+	if err != nil {
+		return nil, err
+	}
+	err = combined.resolveExtends()
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure fields in combined layers validate correctly.
+	for name, service := range combined.Services {
+		if service.Command == "" {
+			return nil, &FormatError{
+				Message: fmt.Sprintf(`plan must define "command" for service %q`, name),
+				Service: name,
+			}
+		}
+		base, _, _, err := service.ParseCommand()
+		if err != nil {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("cannot parse service %q command: %v", name, err),
+				Service: name,
+				Field:   "command",
+			}
+		}
+		if len(base) == 0 {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("service %q command must have a program before [ ... ] group", name),
+				Service: name,
+				Field:   "command",
+			}
+		}
+		for _, hookName := range []string{"pre-start", "post-start", "post-stop"} {
+			if hook := service.Hooks.Hook(hookName); hook != nil && hook.Command == "" {
+				return nil, &FormatError{
+					Message: fmt.Sprintf("service %q %s hook must have a command", name, hookName),
+					Service: name,
+					Field:   "hooks",
+				}
+			}
+		}
+		if IsTemplateName(name) && service.Startup == StartupEnabled {
+			return nil, &FormatError{
+				Message: fmt.Sprintf(`template service %q cannot have "startup: enabled"`, name),
+				Service: name,
+				Field:   "startup",
+			}
+		}
+		for _, req := range service.Requires {
+			if IsTemplateName(req) {
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`service %q cannot require template service %q (specify an instance)`, name, req),
+					Service: name,
+					Field:   "requires",
+				}
+			}
+		}
+		if service.RemainAfterExit && service.Kind != KindOneshot {
+			return nil, &FormatError{
+				Message: fmt.Sprintf(`plan must set "kind: oneshot" to use "remain-after-exit" for service %q`, name),
+				Service: name,
+				Field:   "remain-after-exit",
+			}
+		}
+		for _, check := range service.ReadyChecks {
+			if _, ok := combined.Checks[check]; !ok {
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`service %q has unknown check %q in "ready-checks"`, name, check),
+					Service: name,
+					Field:   "ready-checks",
+				}
+			}
+		}
+	}
+
+	for name, check := range combined.Checks {
+		numTypes := 0
+		if check.HTTP != nil {
+			if check.HTTP.URL == "" {
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`plan must set "url" for http check %q`, name),
+					Check:   name,
+					Field:   "http",
+				}
+			}
+			numTypes++
+		}
+		if check.TCP != nil {
+			if check.TCP.Port == 0 {
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`plan must set "port" for tcp check %q`, name),
+					Check:   name,
+					Field:   "tcp",
+				}
+			}
+			numTypes++
+		}
+		if check.Exec != nil {
+			if check.Exec.Command == "" {
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`plan must set "command" for exec check %q`, name),
+					Check:   name,
+					Field:   "exec",
+				}
+			}
+			numTypes++
+		}
+		if numTypes != 1 {
+			return nil, &FormatError{
+				Message: fmt.Sprintf(`plan must specify one of "http", "tcp", or "exec" for check %q`, name),
+				Check:   name,
+			}
+		}
+		if check.Timeout.Value >= check.Period.Value {
+			return nil, &FormatError{
+				Message: fmt.Sprintf(`check %q timeout must be less than period`, name),
+				Check:   name,
+				Field:   "timeout",
+			}
+		}
+	}
+
+	// Ensure combined layers don't have cycles.
+	err = combined.checkCycles()
+	if err != nil {
+		return nil, err
+	}
+
+	return combined, nil
+}
+
+// mergeLayers merges the given layers into a single layer according to the
+// override rules of their services, without validating the result.
+func mergeLayers(layers ...*Layer) (*Layer, error) {
 	combined := &Layer{
 		Services: make(map[string]*Service),
 	}
@@ -156,58 +760,18 @@ func CombineLayers(layers ...*Layer) (*Layer, error) {
 	combined.Summary = last.Summary
 	combined.Description = last.Description
 	for _, layer := range layers {
+		for name, value := range layer.Vars {
+			if combined.Vars == nil {
+				combined.Vars = make(map[string]string)
+			}
+			combined.Vars[name] = value
+		}
 		for name, service := range layer.Services {
 			switch service.Override {
 			case MergeOverride:
 				if old, ok := combined.Services[name]; ok {
 					copy := old.Copy()
-					if service.Summary != "" {
-						copy.Summary = service.Summary
-					}
-					if service.Description != "" {
-						copy.Description = service.Description
-					}
-					if service.Startup != StartupUnknown {
-						copy.Startup = service.Startup
-					}
-					if service.Command != "" {
-						copy.Command = service.Command
-					}
-					if service.UserID != nil {
-						v := *service.UserID
-						copy.UserID = &v
-					}
-					if service.User != "" {
-						copy.User = service.User
-					}
-					if service.GroupID != nil {
-						v := *service.GroupID
-						copy.GroupID = &v
-					}
-					if service.Group != "" {
-						copy.Group = service.Group
-					}
-					copy.Before = append(copy.Before, service.Before...)
-					copy.After = append(copy.After, service.After...)
-					copy.Requires = append(copy.Requires, service.Requires...)
-					for k, v := range service.Environment {
-						copy.Environment[k] = v
-					}
-					if service.OnSuccess != "" {
-						copy.OnSuccess = service.OnSuccess
-					}
-					if service.OnFailure != "" {
-						copy.OnFailure = service.OnFailure
-					}
-					if service.BackoffDelay.IsSet {
-						copy.BackoffDelay = service.BackoffDelay
-					}
-					if service.BackoffFactor.IsSet {
-						copy.BackoffFactor = service.BackoffFactor
-					}
-					if service.BackoffLimit.IsSet {
-						copy.BackoffLimit = service.BackoffLimit
-					}
+					copy.merge(service)
 					combined.Services[name] = copy
 					break
 				}
@@ -218,48 +782,667 @@ func CombineLayers(layers ...*Layer) (*Layer, error) {
 				return nil, &FormatError{
 					Message: fmt.Sprintf(`layer %q must define "override" for service %q`,
 						layer.Label, service.Name),
+					Layer:   layer.Label,
+					Service: name,
 				}
 			default:
 				return nil, &FormatError{
 					Message: fmt.Sprintf(`layer %q has invalid "override" value for service %q`,
 						layer.Label, service.Name),
+					Layer:   layer.Label,
+					Service: name,
+					Field:   "override",
+				}
+			}
+		}
+		for name, check := range layer.Checks {
+			if combined.Checks == nil {
+				combined.Checks = make(map[string]*Check)
+			}
+			switch check.Override {
+			case MergeOverride:
+				if old, ok := combined.Checks[name]; ok {
+					copy := old.Copy()
+					copy.merge(check)
+					combined.Checks[name] = copy
+					break
+				}
+				fallthrough
+			case ReplaceOverride:
+				combined.Checks[name] = check.Copy()
+			case UnknownOverride:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q must define "override" for check %q`,
+						layer.Label, check.Name),
+					Layer: layer.Label,
+					Check: name,
+				}
+			default:
+				return nil, &FormatError{
+					Message: fmt.Sprintf(`layer %q has invalid "override" value for check %q`,
+						layer.Label, check.Name),
+					Layer: layer.Label,
+					Check: name,
+					Field: "override",
 				}
 			}
 		}
 	}
+	return combined, nil
+}
 
-	// Ensure fields in combined layers validate correctly.
-	for name, service := range combined.Services {
-		if service.Command == "" {
-			return nil, &FormatError{
-				Message: fmt.Sprintf(`plan must define "command" for service %q`, name),
+// resolveExtends replaces each service that extends another with a copy of
+// that service (after resolving its own "extends"), merged with the fields
+// set in the extending service.
+func (l *Layer) resolveExtends() error {
+	resolved := make(map[string]bool)
+	var resolve func(name string, path []string) error
+	resolve = func(name string, path []string) error {
+		service := l.Services[name]
+		if service.Extends == "" || resolved[name] {
+			return nil
+		}
+		path = append(path, name)
+		if strutil.ListContains(path, service.Extends) {
+			return &FormatError{
+				Message: fmt.Sprintf(`service %q has a cycle in "extends": %s -> %s`,
+					path[0], strings.Join(path, " -> "), service.Extends),
+				Service: path[0],
+				Field:   "extends",
 			}
 		}
+		if _, ok := l.Services[service.Extends]; !ok {
+			return &FormatError{
+				Message: fmt.Sprintf(`service %q extends unknown service %q`, name, service.Extends),
+				Service: name,
+				Field:   "extends",
+			}
+		}
+		err := resolve(service.Extends, path)
+		if err != nil {
+			return err
+		}
+		extended := l.Services[service.Extends].Copy()
+		extended.merge(service)
+		extended.Name = service.Name
+		extended.Override = service.Override
+		extended.Extends = service.Extends
+		l.Services[name] = extended
+		resolved[name] = true
+		return nil
 	}
 
-	// Ensure combined layers don't have cycles.
-	err := combined.checkCycles()
+	names := make([]string, 0, len(l.Services))
+	for name := range l.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err := resolve(name, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge merges the fields set in other into s.
+func (s *Service) merge(other *Service) {
+	if other.Extends != "" {
+		s.Extends = other.Extends
+	}
+	if other.Summary != "" {
+		s.Summary = other.Summary
+	}
+	if other.Description != "" {
+		s.Description = other.Description
+	}
+	if other.Startup != StartupUnknown {
+		s.Startup = other.Startup
+	}
+	if other.Command != "" {
+		s.Command = other.Command
+	}
+	if other.Kind != KindUnknown {
+		s.Kind = other.Kind
+	}
+	if other.RemainAfterExit {
+		s.RemainAfterExit = true
+	}
+	if other.UserID != nil {
+		v := *other.UserID
+		s.UserID = &v
+	}
+	if other.User != "" {
+		s.User = other.User
+	}
+	if other.GroupID != nil {
+		v := *other.GroupID
+		s.GroupID = &v
+	}
+	if other.Group != "" {
+		s.Group = other.Group
+	}
+	s.Before = append(s.Before, other.Before...)
+	s.After = append(s.After, other.After...)
+	s.Requires = append(s.Requires, other.Requires...)
+	for k, v := range other.Environment {
+		if s.Environment == nil {
+			s.Environment = make(map[string]string)
+		}
+		s.Environment[k] = v
+	}
+	s.EnvironmentFiles = append(s.EnvironmentFiles, other.EnvironmentFiles...)
+	if other.WorkingDir != "" {
+		s.WorkingDir = other.WorkingDir
+	}
+	if other.Umask != "" {
+		s.Umask = other.Umask
+	}
+	if other.StopSignal != "" {
+		s.StopSignal = other.StopSignal
+	}
+	if other.KillMode != KillModeUnknown {
+		s.KillMode = other.KillMode
+	}
+	// A reload command or signal replaces whichever of them was set before.
+	if other.ReloadCommand != "" {
+		s.ReloadCommand = other.ReloadCommand
+		s.ReloadSignal = ""
+	}
+	if other.ReloadSignal != "" {
+		s.ReloadSignal = other.ReloadSignal
+		s.ReloadCommand = ""
+	}
+	if other.OnSuccess != "" {
+		s.OnSuccess = other.OnSuccess
+	}
+	if other.OnFailure != "" {
+		s.OnFailure = other.OnFailure
+	}
+	if other.BackoffDelay.IsSet {
+		s.BackoffDelay = other.BackoffDelay
+	}
+	if other.BackoffFactor.IsSet {
+		s.BackoffFactor = other.BackoffFactor
+	}
+	if other.BackoffLimit.IsSet {
+		s.BackoffLimit = other.BackoffLimit
+	}
+	if other.StartLimitBurst != 0 {
+		s.StartLimitBurst = other.StartLimitBurst
+	}
+	if other.StartLimitInterval.IsSet {
+		s.StartLimitInterval = other.StartLimitInterval
+	}
+	if other.Watchdog.IsSet {
+		s.Watchdog = other.Watchdog
+	}
+	if other.OkayDelay.IsSet {
+		s.OkayDelay = other.OkayDelay
+	}
+	s.ReadyChecks = append(s.ReadyChecks, other.ReadyChecks...)
+	if other.ReadyTimeout.IsSet {
+		s.ReadyTimeout = other.ReadyTimeout
+	}
+	mergeHook(&s.Hooks.PreStart, other.Hooks.PreStart)
+	mergeHook(&s.Hooks.PostStart, other.Hooks.PostStart)
+	mergeHook(&s.Hooks.PostStop, other.Hooks.PostStop)
+	if other.LogTo != nil {
+		logTo := *other.LogTo
+		s.LogTo = &logTo
+	}
+	if other.LogToJournald {
+		s.LogToJournald = true
+	}
+	if other.Seccomp != "" {
+		s.Seccomp = other.Seccomp
+	}
+	if other.AppArmorProfile != "" {
+		s.AppArmorProfile = other.AppArmorProfile
+	}
+	s.Capabilities = append(s.Capabilities, other.Capabilities...)
+	s.Mounts = append(s.Mounts, other.Mounts...)
+	if other.Network != "" {
+		s.Network = other.Network
+	}
+	if other.PIDNamespace {
+		s.PIDNamespace = true
+	}
+}
+
+// mergeHook merges the hook other (if set) into the hook at dst, creating it
+// if needed.
+func mergeHook(dst **ServiceHook, other *ServiceHook) {
+	if other == nil {
+		return
+	}
+	if *dst == nil {
+		*dst = &ServiceHook{}
+	}
+	(*dst).merge(other)
+}
+
+// merge merges the fields set in other into c.
+func (c *Check) merge(other *Check) {
+	if other.Level != UnsetLevel {
+		c.Level = other.Level
+	}
+	if other.Period.IsSet {
+		c.Period = other.Period
+	}
+	if other.Timeout.IsSet {
+		c.Timeout = other.Timeout
+	}
+	if other.Threshold != 0 {
+		c.Threshold = other.Threshold
+	}
+	if other.HTTP != nil {
+		if c.HTTP == nil {
+			c.HTTP = &HTTPCheck{}
+		}
+		if other.HTTP.URL != "" {
+			c.HTTP.URL = other.HTTP.URL
+		}
+		for k, v := range other.HTTP.Headers {
+			if c.HTTP.Headers == nil {
+				c.HTTP.Headers = make(map[string]string)
+			}
+			c.HTTP.Headers[k] = v
+		}
+	}
+	if other.TCP != nil {
+		if c.TCP == nil {
+			c.TCP = &TCPCheck{}
+		}
+		if other.TCP.Port != 0 {
+			c.TCP.Port = other.TCP.Port
+		}
+		if other.TCP.Host != "" {
+			c.TCP.Host = other.TCP.Host
+		}
+	}
+	if other.Exec != nil {
+		if c.Exec == nil {
+			c.Exec = &ExecCheck{}
+		}
+		if other.Exec.Command != "" {
+			c.Exec.Command = other.Exec.Command
+		}
+		for k, v := range other.Exec.Environment {
+			if c.Exec.Environment == nil {
+				c.Exec.Environment = make(map[string]string)
+			}
+			c.Exec.Environment[k] = v
+		}
+		if other.Exec.WorkingDir != "" {
+			c.Exec.WorkingDir = other.Exec.WorkingDir
+		}
+	}
+}
+
+// Service returns the named service from the plan. If name refers to an
+// instance of a template service (for example "worker@3" for the template
+// "worker@"), the template instantiated with that parameter is returned.
+func (p *Plan) Service(name string) (*Service, bool) {
+	return lookupService(p.Services, name)
+}
+
+var varRefExp = regexp.MustCompile(`\$?\$\{([^}]*)\}`)
+
+// hostVarPrefix is the prefix of a reference to one of the daemon's
+// environment variables in a service environment value, such as
+// "${HOST:PATH}". These are only expanded when the service starts (see
+// ExpandHostVars), so that their values aren't kept in the plan.
+const hostVarPrefix = "HOST:"
+
+var hostVarNameExp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ExpandVars expands variable references of the form "${name}" in the
+// service commands and environment values, and in the check URLs, headers,
+// hosts, commands, environment values and working directories, of the
+// (usually combined) layer, using the values defined in the layer's "vars"
+// section. A reference may
+// be escaped as "$${name}" to produce a literal "${name}". References to the
+// daemon's environment of the form "${HOST:NAME}" in environment values are
+// left for ExpandHostVars.
+func (l *Layer) ExpandVars() error {
+	for name, service := range l.Services {
+		command, err := expandCommandVars(string(service.Command), l.Vars)
+		if err != nil {
+			return &FormatError{
+				Message: fmt.Sprintf("service %q command %v", name, err),
+				Service: name,
+				Field:   "command",
+			}
+		}
+		service.Command = ServiceCommand(command)
+		service.ReloadCommand, err = expandVars(service.ReloadCommand, l.Vars, false)
+		if err != nil {
+			return &FormatError{
+				Message: fmt.Sprintf("service %q reload-command %v", name, err),
+				Service: name,
+				Field:   "reload-command",
+			}
+		}
+		for _, hookName := range []string{"pre-start", "post-start", "post-stop"} {
+			hook := service.Hooks.Hook(hookName)
+			if hook == nil {
+				continue
+			}
+			hook.Command, err = expandVars(hook.Command, l.Vars, false)
+			if err != nil {
+				return &FormatError{
+					Message: fmt.Sprintf("service %q %s hook command %v", name, hookName, err),
+					Service: name,
+					Field:   "hooks",
+				}
+			}
+		}
+		for k, v := range service.Environment {
+			value, err := expandVars(v, l.Vars, true)
+			if err != nil {
+				return &FormatError{
+					Message: fmt.Sprintf("service %q environment variable %q %v", name, k, err),
+					Service: name,
+					Field:   "environment",
+				}
+			}
+			service.Environment[k] = value
+		}
+	}
+	for _, check := range l.Checks {
+		err := check.expandVars(l.Vars)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Check) expandVars(vars map[string]string) error {
+	var err error
+	if c.HTTP != nil {
+		c.HTTP.URL, err = expandVars(c.HTTP.URL, vars, false)
+		if err != nil {
+			return c.expandError("http", "url", err)
+		}
+		for k, v := range c.HTTP.Headers {
+			value, err := expandVars(v, vars, false)
+			if err != nil {
+				return c.expandError("http", fmt.Sprintf("header %q", k), err)
+			}
+			c.HTTP.Headers[k] = value
+		}
+	}
+	if c.TCP != nil {
+		c.TCP.Host, err = expandVars(c.TCP.Host, vars, false)
+		if err != nil {
+			return c.expandError("tcp", "host", err)
+		}
+	}
+	if c.Exec != nil {
+		c.Exec.Command, err = expandVars(c.Exec.Command, vars, false)
+		if err != nil {
+			return c.expandError("exec", "command", err)
+		}
+		for k, v := range c.Exec.Environment {
+			value, err := expandVars(v, vars, false)
+			if err != nil {
+				return c.expandError("exec", fmt.Sprintf("environment variable %q", k), err)
+			}
+			c.Exec.Environment[k] = value
+		}
+		c.Exec.WorkingDir, err = expandVars(c.Exec.WorkingDir, vars, false)
+		if err != nil {
+			return c.expandError("exec", "working-dir", err)
+		}
+	}
+	return nil
+}
+
+func (c *Check) expandError(field, what string, err error) error {
+	return &FormatError{
+		Message: fmt.Sprintf("check %q %s %s %v", c.Name, field, what, err),
+		Check:   c.Name,
+		Field:   field,
+	}
+}
+
+// expandCommandVars expands the variable references in a service command.
+// The value of a reference within quotes is escaped as needed for those
+// quotes, so that it's split back into arguments as-is. This includes the
+// references in each argument of a command given as a list, which are always
+// quoted (see quoteArg).
+func expandCommandVars(command string, vars map[string]string) (string, error) {
+	var b strings.Builder
+	var quote byte
+	last := 0
+	for _, loc := range varRefExp.FindAllStringIndex(command, -1) {
+		quote = scanQuotes(command[last:loc[0]], quote)
+		b.WriteString(command[last:loc[0]])
+		value, err := expandVars(command[loc[0]:loc[1]], vars, false)
+		if err != nil {
+			return "", err
+		}
+		switch quote {
+		case '\'':
+			value = strings.ReplaceAll(value, "'", `'"'"'`)
+		case '"':
+			value = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+		}
+		b.WriteString(value)
+		last = loc[1]
+	}
+	b.WriteString(command[last:])
+	return b.String(), nil
+}
+
+// scanQuotes returns the quote character (or zero if none) that's open at
+// the end of s, given the one open at its start, as for shlex.Split.
+func scanQuotes(s string, quote byte) byte {
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != '\'' && s[i] == '\\':
+			i++
+		case quote == 0 && (s[i] == '\'' || s[i] == '"'):
+			quote = s[i]
+		case quote != 0 && s[i] == quote:
+			quote = 0
+		}
+	}
+	return quote
+}
+
+func expandVars(s string, vars map[string]string, hostRefs bool) (string, error) {
+	var err error
+	expanded := varRefExp.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[strings.Index(ref, "{")+1 : len(ref)-1]
+		if hostRefs && strings.HasPrefix(name, hostVarPrefix) {
+			hostName := name[len(hostVarPrefix):]
+			if !hostVarNameExp.MatchString(hostName) && err == nil {
+				err = fmt.Errorf("references invalid host variable %q", hostName)
+			}
+			// Keep escaped references escaped for ExpandHostVars.
+			return ref
+		}
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		value, ok := vars[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("references undefined variable %q", name)
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+// ExpandHostVars expands references to the daemon's environment variables of
+// the form "${HOST:NAME}" in a service environment value (already expanded
+// by ExpandVars), using lookup to get each variable's value, or to return an
+// error if it may not be used. A reference escaped as "$${HOST:NAME}"
+// produces a literal "${HOST:NAME}".
+func ExpandHostVars(s string, lookup func(name string) (string, error)) (string, error) {
+	var err error
+	expanded := varRefExp.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[strings.Index(ref, "{")+1 : len(ref)-1]
+		if !strings.HasPrefix(name, hostVarPrefix) {
+			return ref
+		}
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+		value, lookupErr := lookup(name[len(hostVarPrefix):])
+		if lookupErr != nil && err == nil {
+			err = lookupErr
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+// StartOrder returns the required services that must be started for the named
+// services to be properly started, in the order that they must be started.
+// An error is returned when a provided service name does not exist, or there
+// is an order cycle involving the provided service or its dependencies.
+func (p *Plan) StartOrder(names []string) ([]string, error) {
+	err := checkNotTemplates(names)
 	if err != nil {
 		return nil, err
 	}
-
-	return combined, nil
+	return order(p.Services, names, false)
+}
+
+// StopOrder returns the required services that must be stopped for the named
+// services to be properly stopped, in the order that they must be stopped.
+// An error is returned when a provided service name does not exist, or there
+// is an order cycle involving the provided service or its dependencies.
+func (p *Plan) StopOrder(names []string) ([]string, error) {
+	err := checkNotTemplates(names)
+	if err != nil {
+		return nil, err
+	}
+	return order(p.Services, names, true)
+}
+
+// StartDependencies returns, for each of the services, which must already be
+// in start order (as returned by StartOrder), the other services in the list
+// that must be started before it: those it's ordered after through before
+// and after, and those it requires. Services that don't depend on each other
+// this way may be started in parallel.
+func (p *Plan) StartDependencies(services []string) map[string][]string {
+	return dependencies(p.Services, services, false)
+}
+
+// StopDependencies is like StartDependencies, but for services in stop
+// order (as returned by StopOrder): a service must be stopped after the
+// services that require it, and according to before and after in reverse.
+func (p *Plan) StopDependencies(services []string) map[string][]string {
+	return dependencies(p.Services, services, true)
+}
+
+func dependencies(services map[string]*Service, names []string, stop bool) map[string][]string {
+	waits := make(map[string]map[string]bool, len(names))
+	for _, name := range names {
+		waits[name] = make(map[string]bool)
+	}
+	// reaches reports whether a waits for b, directly or indirectly.
+	var reaches func(a, b string, seen map[string]bool) bool
+	reaches = func(a, b string, seen map[string]bool) bool {
+		if a == b {
+			return true
+		}
+		seen[a] = true
+		for next := range waits[a] {
+			if !seen[next] && reaches(next, b, seen) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// The services are sorted according to before and after already, so
+	// those only order a service after an earlier one.
+	for i, name := range names {
+		service, ok := lookupService(services, name)
+		if !ok {
+			continue
+		}
+		for _, other := range names[:i] {
+			otherService, ok := lookupService(services, other)
+			if !ok {
+				continue
+			}
+			if stop {
+				if contains(service.Before, other) || contains(otherService.After, name) {
+					waits[name][other] = true
+				}
+			} else if contains(service.After, other) || contains(otherService.Before, name) {
+				waits[name][other] = true
+			}
+		}
+	}
+
+	// Requires doesn't affect the order, so a service may come before one
+	// it requires. Skip such a dependency if it would form a cycle.
+	for _, name := range names {
+		service, ok := lookupService(services, name)
+		if !ok {
+			continue
+		}
+		for _, required := range service.Requires {
+			if _, ok := waits[required]; !ok {
+				continue
+			}
+			// When stopping, the required service waits instead.
+			a, b := name, required
+			if stop {
+				a, b = b, a
+			}
+			if !reaches(b, a, make(map[string]bool)) {
+				waits[a][b] = true
+			}
+		}
+	}
+
+	deps := make(map[string][]string, len(names))
+	for _, name := range names {
+		var list []string
+		for _, other := range names {
+			if waits[name][other] {
+				list = append(list, other)
+			}
+		}
+		deps[name] = list
+	}
+	return deps
 }
 
-// StartOrder returns the required services that must be started for the named
-// services to be properly started, in the order that they must be started.
-// An error is returned when a provided service name does not exist, or there
-// is an order cycle involving the provided service or its dependencies.
-func (p *Plan) StartOrder(names []string) ([]string, error) {
-	return order(p.Services, names, false)
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
 }
 
-// StopOrder returns the required services that must be stopped for the named
-// services to be properly stopped, in the order that they must be stopped.
-// An error is returned when a provided service name does not exist, or there
-// is an order cycle involving the provided service or its dependencies.
-func (p *Plan) StopOrder(names []string) ([]string, error) {
-	return order(p.Services, names, true)
+func checkNotTemplates(names []string) error {
+	for _, name := range names {
+		if IsTemplateName(name) {
+			return &FormatError{
+				Message: fmt.Sprintf("cannot use template service %q without an instance (for example %q)", name, name+"1"),
+			}
+		}
+	}
+	return nil
 }
 
 func order(services map[string]*Service, names []string, stop bool) ([]string, error) {
@@ -286,7 +1469,7 @@ func order(services map[string]*Service, names []string, stop bool) ([]string, e
 		if stop {
 			pending = append(pending, predecessors[name]...)
 		} else {
-			service, ok := services[name]
+			service, ok := lookupService(services, name)
 			if !ok {
 				return nil, &FormatError{
 					Message: fmt.Sprintf("service %q does not exist", name),
@@ -298,7 +1481,7 @@ func order(services map[string]*Service, names []string, stop bool) ([]string, e
 
 	// Create a list of successors involving those services only.
 	for name := range successors {
-		service, ok := services[name]
+		service, ok := lookupService(services, name)
 		if !ok {
 			return nil, &FormatError{
 				Message: fmt.Sprintf("service %q does not exist", name),
@@ -329,6 +1512,7 @@ func order(services map[string]*Service, names []string, stop bool) ([]string, e
 		if len(names) > 1 {
 			return nil, &FormatError{
 				Message: fmt.Sprintf("services in before/after loop: %s", strings.Join(names, ", ")),
+				Service: names[0],
 			}
 		}
 		order = append(order, names[0])
@@ -353,10 +1537,19 @@ func ParseLayer(order int, label string, data []byte) (*Layer, error) {
 	if err != nil {
 		return nil, &FormatError{
 			Message: fmt.Sprintf("cannot parse layer %q: %v", label, err),
+			Layer:   label,
 		}
 	}
 	layer.Order = order
 	layer.Label = label
+	for name := range layer.Vars {
+		if !varNameExp.MatchString(name) {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("invalid variable name %q", name),
+				Layer:   label,
+			}
+		}
+	}
 	for name, service := range layer.Services {
 		if name == "" {
 			return nil, &FormatError{
@@ -368,20 +1561,57 @@ func ParseLayer(order int, label string, data []byte) (*Layer, error) {
 			// in log output).
 			return nil, &FormatError{
 				Message: fmt.Sprintf("cannot use reserved service name %q", name),
+				Layer:   label,
+				Service: name,
 			}
 		}
 		if service == nil {
 			return nil, &FormatError{
 				Message: fmt.Sprintf("service object cannot be null for service %q", name),
+				Layer:   label,
+				Service: name,
+			}
+		}
+		if i := strings.Index(name, templateSuffix); i >= 0 && i != len(name)-len(templateSuffix) {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("cannot use %q in service name %q except as template suffix", templateSuffix, name),
+				Layer:   label,
+				Service: name,
 			}
 		}
 
 		// Set defaults and validate values
+		if !validServiceKind(service.Kind) {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("invalid kind %q", service.Kind),
+				Layer:   label,
+				Service: name,
+				Field:   "kind",
+			}
+		}
+		if !validKillMode(service.KillMode) {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("invalid kill-mode %q", service.KillMode),
+				Layer:   label,
+				Service: name,
+				Field:   "kill-mode",
+			}
+		}
 		if !validServiceAction(service.OnSuccess) {
-			return nil, &FormatError{Message: fmt.Sprintf("invalid on-success action %q", service.OnSuccess)}
+			return nil, &FormatError{
+				Message: fmt.Sprintf("invalid on-success action %q", service.OnSuccess),
+				Layer:   label,
+				Service: name,
+				Field:   "on-success",
+			}
 		}
 		if !validServiceAction(service.OnFailure) {
-			return nil, &FormatError{Message: fmt.Sprintf("invalid on-failure action %q", service.OnFailure)}
+			return nil, &FormatError{
+				Message: fmt.Sprintf("invalid on-failure action %q", service.OnFailure),
+				Layer:   label,
+				Service: name,
+				Field:   "on-failure",
+			}
 		}
 		if !service.BackoffDelay.IsSet {
 			service.BackoffDelay.Value = defaultBackoffDelay
@@ -389,21 +1619,329 @@ func ParseLayer(order int, label string, data []byte) (*Layer, error) {
 		if !service.BackoffFactor.IsSet {
 			service.BackoffFactor.Value = defaultBackoffFactor
 		} else if service.BackoffFactor.Value < 1 {
-			return nil, &FormatError{Message: fmt.Sprintf("backoff-factor must be 1.0 or greater, not %g", service.BackoffFactor.Value)}
+			return nil, &FormatError{
+				Message: fmt.Sprintf("backoff-factor must be 1.0 or greater, not %g", service.BackoffFactor.Value),
+				Layer:   label,
+				Service: name,
+				Field:   "backoff-factor",
+			}
 		}
 		if !service.BackoffLimit.IsSet {
 			service.BackoffLimit.Value = defaultBackoffLimit
 		}
+		if service.StartLimitBurst < 0 {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("start-limit-burst must not be negative, not %d", service.StartLimitBurst),
+				Layer:   label,
+				Service: name,
+				Field:   "start-limit-burst",
+			}
+		}
+		if service.Watchdog.IsSet && service.Watchdog.Value <= 0 {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("watchdog must be positive, not %s", service.Watchdog.Value),
+				Layer:   label,
+				Service: name,
+				Field:   "watchdog",
+			}
+		}
+		if service.OkayDelay.IsSet && service.OkayDelay.Value <= 0 {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("okay-delay must be positive, not %s", service.OkayDelay.Value),
+				Layer:   label,
+				Service: name,
+				Field:   "okay-delay",
+			}
+		}
+		if err := validateHooks(&service.Hooks); err != nil {
+			return nil, &FormatError{
+				Message: err.Error(),
+				Layer:   label,
+				Service: name,
+				Field:   "hooks",
+			}
+		}
+		if service.StartLimitInterval.IsSet && service.StartLimitInterval.Value <= 0 {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("start-limit-interval must be positive, not %s", service.StartLimitInterval.Value),
+				Layer:   label,
+				Service: name,
+				Field:   "start-limit-interval",
+			}
+		}
+		for k, v := range service.Environment {
+			if _, _, err := secrets.ParseRef(v); err != nil {
+				return nil, &FormatError{
+					Message: fmt.Sprintf("environment variable %q has %v", k, err),
+					Layer:   label,
+					Service: name,
+					Field:   "environment",
+				}
+			}
+		}
+		for _, path := range service.EnvironmentFiles {
+			if !filepath.IsAbs(strings.TrimPrefix(path, "-")) {
+				return nil, &FormatError{
+					Message: fmt.Sprintf("environment-files must be absolute paths, not %q", path),
+					Layer:   label,
+					Service: name,
+					Field:   "environment-files",
+				}
+			}
+		}
+		if service.WorkingDir != "" && !filepath.IsAbs(service.WorkingDir) {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("working-dir must be an absolute path, not %q", service.WorkingDir),
+				Layer:   label,
+				Service: name,
+				Field:   "working-dir",
+			}
+		}
+		if service.Umask != "" {
+			if _, err := service.ParseUmask(); err != nil {
+				return nil, &FormatError{
+					Message: err.Error(),
+					Layer:   label,
+					Service: name,
+					Field:   "umask",
+				}
+			}
+		}
+		if _, err := service.ParseStopSignal(); err != nil {
+			return nil, &FormatError{
+				Message: err.Error(),
+				Layer:   label,
+				Service: name,
+				Field:   "stop-signal",
+			}
+		}
+		if _, err := service.ParseReloadSignal(); err != nil {
+			return nil, &FormatError{
+				Message: err.Error(),
+				Layer:   label,
+				Service: name,
+				Field:   "reload-signal",
+			}
+		}
+		if service.ReloadCommand != "" && service.ReloadSignal != "" {
+			return nil, &FormatError{
+				Message: "cannot set both reload-command and reload-signal",
+				Layer:   label,
+				Service: name,
+				Field:   "reload-command",
+			}
+		}
+		if _, err := shlex.Split(service.ReloadCommand); err != nil {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("cannot parse reload-command: %v", err),
+				Layer:   label,
+				Service: name,
+				Field:   "reload-command",
+			}
+		}
+		if service.LogTo != nil {
+			if !filepath.IsAbs(service.LogTo.Path) {
+				return nil, &FormatError{
+					Message: fmt.Sprintf("log-to path must be an absolute path, not %q", service.LogTo.Path),
+					Layer:   label,
+					Service: name,
+					Field:   "log-to",
+				}
+			}
+			if service.LogTo.Backups < 0 {
+				return nil, &FormatError{
+					Message: fmt.Sprintf("log-to backups must not be negative, not %d", service.LogTo.Backups),
+					Layer:   label,
+					Service: name,
+					Field:   "log-to",
+				}
+			}
+		}
+		if service.Seccomp != "" && !filepath.IsAbs(service.Seccomp) && !strutil.ListContains(sandbox.SeccompProfiles(), service.Seccomp) {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("seccomp must be one of %s, or the absolute path of a BPF program, not %q",
+					strutil.Quoted(sandbox.SeccompProfiles()), service.Seccomp),
+				Layer:   label,
+				Service: name,
+				Field:   "seccomp",
+			}
+		}
+		for _, capability := range service.Capabilities {
+			if _, err := sandbox.ParseCapability(capability); err != nil {
+				return nil, &FormatError{
+					Message: err.Error(),
+					Layer:   label,
+					Service: name,
+					Field:   "capabilities",
+				}
+			}
+		}
+		for _, mount := range service.Mounts {
+			if !filepath.IsAbs(mount.Source) || !filepath.IsAbs(mount.Target) {
+				return nil, &FormatError{
+					Message: fmt.Sprintf("mount source and target must be absolute paths, not %q and %q", mount.Source, mount.Target),
+					Layer:   label,
+					Service: name,
+					Field:   "mounts",
+				}
+			}
+		}
+		if err := sandbox.CheckNetwork(service.Network); err != nil {
+			return nil, &FormatError{
+				Message: err.Error(),
+				Layer:   label,
+				Service: name,
+				Field:   "network",
+			}
+		}
+		if strings.ContainsAny(service.AppArmorProfile, "\x00\n") {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("invalid apparmor-profile %q", service.AppArmorProfile),
+				Layer:   label,
+				Service: name,
+				Field:   "apparmor-profile",
+			}
+		}
+		if service.ReadyTimeout.IsSet && service.ReadyTimeout.Value <= 0 {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("ready-timeout must be greater than zero, not %s", service.ReadyTimeout.Value),
+				Layer:   label,
+				Service: name,
+				Field:   "ready-timeout",
+			}
+		}
 
 		service.Name = name
 	}
+	for name, check := range layer.Checks {
+		if name == "" {
+			return nil, &FormatError{
+				Message: "cannot use empty string as check name",
+				Layer:   label,
+			}
+		}
+		if check == nil {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("check object cannot be null for check %q", name),
+				Layer:   label,
+				Check:   name,
+			}
+		}
+		if !validCheckLevel(check.Level) {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("invalid level %q for check %q", check.Level, name),
+				Layer:   label,
+				Check:   name,
+				Field:   "level",
+			}
+		}
+		if !check.Period.IsSet {
+			check.Period.Value = defaultCheckPeriod
+		} else if check.Period.Value <= 0 {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("check %q period must be greater than zero", name),
+				Layer:   label,
+				Check:   name,
+				Field:   "period",
+			}
+		}
+		if !check.Timeout.IsSet {
+			check.Timeout.Value = defaultCheckTimeout
+		} else if check.Timeout.Value <= 0 {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("check %q timeout must be greater than zero", name),
+				Layer:   label,
+				Check:   name,
+				Field:   "timeout",
+			}
+		}
+		if check.Threshold == 0 {
+			// Default number of failures in a row before check triggers
+			// action, default is >1 to avoid flapping due to glitches.
+			check.Threshold = defaultCheckThreshold
+		} else if check.Threshold < 0 {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("check %q threshold must be greater than zero", name),
+				Layer:   label,
+				Check:   name,
+				Field:   "threshold",
+			}
+		}
+		if check.Exec != nil {
+			_, err := shlex.Split(check.Exec.Command)
+			if err != nil {
+				return nil, &FormatError{
+					Message: fmt.Sprintf("cannot parse check %q command: %v", name, err),
+					Layer:   label,
+					Check:   name,
+					Field:   "exec",
+				}
+			}
+		}
+
+		check.Name = name
+	}
 	err = layer.checkCycles()
 	if err != nil {
+		if e, ok := err.(*FormatError); ok {
+			e.Layer = label
+		}
 		return nil, err
 	}
 	return &layer, err
 }
 
+func validServiceKind(kind ServiceKind) bool {
+	switch kind {
+	case KindUnknown, KindDaemon, KindOneshot:
+		return true
+	default:
+		return false
+	}
+}
+
+// validateHooks checks that each hook set in a layer has a valid command,
+// timeout and on-failure action. Whether each has a command at all is only
+// checked once layers are combined.
+func validateHooks(hooks *ServiceHooks) error {
+	for _, name := range []string{"pre-start", "post-start", "post-stop"} {
+		hook := hooks.Hook(name)
+		if hook == nil {
+			continue
+		}
+		if _, err := shlex.Split(hook.Command); err != nil {
+			return fmt.Errorf("cannot parse %s hook command: %v", name, err)
+		}
+		if hook.Timeout.IsSet && hook.Timeout.Value <= 0 {
+			return fmt.Errorf("%s hook timeout must be positive, not %s", name, hook.Timeout.Value)
+		}
+		switch hook.OnFailure {
+		case HookFailureUnset, HookFailureAbort, HookFailureWarn:
+		default:
+			return fmt.Errorf("invalid %s hook on-failure action %q", name, hook.OnFailure)
+		}
+	}
+	return nil
+}
+
+func validKillMode(mode KillMode) bool {
+	switch mode {
+	case KillModeUnknown, KillModeProcessGroup, KillModeProcess:
+		return true
+	default:
+		return false
+	}
+}
+
+func validCheckLevel(level CheckLevel) bool {
+	switch level {
+	case UnsetLevel, AliveLevel, ReadyLevel:
+		return true
+	default:
+		return false
+	}
+}
+
 func validServiceAction(action ServiceAction) bool {
 	switch action {
 	case ActionUnset, ActionRestart, ActionHalt, ActionIgnore:
@@ -413,6 +1951,8 @@ func validServiceAction(action ServiceAction) bool {
 	}
 }
 
+var varNameExp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
 var fnameExp = regexp.MustCompile("^([0-9]{3})-([a-z](?:-?[a-z0-9]){2,}).yaml$")
 
 func ReadLayersDir(dirname string) ([]*Layer, error) {
@@ -469,25 +2009,175 @@ func ReadLayersDir(dirname string) ([]*Layer, error) {
 		if err != nil {
 			return nil, err
 		}
+		layer, err = resolveIncludes(dirname, layer, make(map[string]bool))
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
+// DropInDirName is the name of the sub-directory of the pebble directory
+// whose layers are combined after those in the "layers" sub-directory.
+const DropInDirName = "layers.d"
+
+var dropInFnameExp = regexp.MustCompile("^(?:[0-9]+-)?([a-z](?:-?[a-z0-9]){2,}).yaml$")
+
+// ReadDropInDir reads the layers in a drop-in layers directory, in filename
+// order, numbering them from order+1. Unlike in the layers directory,
+// filenames don't need an order prefix: the label is the filename without
+// the ".yaml" suffix or any leading digits and hyphen, so that packages can
+// ship layers without coordinating their filenames.
+func ReadDropInDir(dirname string, order int) ([]*Layer, error) {
+	finfos, err := ioutil.ReadDir(dirname)
+	if err != nil {
+		// Errors from package os generally include the path.
+		return nil, fmt.Errorf("cannot read layers directory: %v", err)
+	}
+
+	labels := make(map[string]string)
+
+	var layers []*Layer
+	for _, finfo := range finfos {
+		if finfo.IsDir() || !strings.HasSuffix(finfo.Name(), ".yaml") {
+			continue
+		}
+		match := dropInFnameExp.FindStringSubmatch(finfo.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid layer filename: %q (must look like \"some-label.yaml\")", finfo.Name())
+		}
+		label := match[1]
+		if oldName, ok := labels[label]; ok {
+			return nil, fmt.Errorf("invalid layer filename: %q not unique (have %q already)", finfo.Name(), oldName)
+		}
+		labels[label] = finfo.Name()
+
+		data, err := ioutil.ReadFile(filepath.Join(dirname, finfo.Name()))
+		if err != nil {
+			// Errors from package os generally include the path.
+			return nil, fmt.Errorf("cannot read layer file: %v", err)
+		}
+		order++
+		layer, err := ParseLayer(order, label, data)
+		if err != nil {
+			return nil, err
+		}
+		layer, err = resolveIncludes(dirname, layer, make(map[string]bool))
+		if err != nil {
+			return nil, err
+		}
 		layers = append(layers, layer)
 	}
 	return layers, nil
 }
 
-// ReadDir reads the configuration layers from the "layers" sub-directory in
-// dir, and returns the resulting Plan. If the "layers" sub-directory doesn't
-// exist, it returns a valid Plan with no layers.
-func ReadDir(dir string) (*Plan, error) {
+// ReadLayerFile reads and parses a single layer file, resolving any files it
+// includes relative to the file's directory. The layer's order and label are
+// taken from the filename if it is a valid layer filename, otherwise the
+// order is zero and the label is the filename.
+func ReadLayerFile(path string) (*Layer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		// Errors from package os generally include the path.
+		return nil, fmt.Errorf("cannot read layer file: %v", err)
+	}
+	order, label := 0, filepath.Base(path)
+	if match := fnameExp.FindStringSubmatch(label); match != nil {
+		order, _ = strconv.Atoi(match[1])
+		label = match[2]
+	}
+	layer, err := ParseLayer(order, label, data)
+	if err != nil {
+		return nil, err
+	}
+	return resolveIncludes(filepath.Dir(path), layer, make(map[string]bool))
+}
+
+// resolveIncludes reads the files included by layer (relative to the layers
+// directory) and merges them before the layer itself, returning the result.
+// Included files may include other files, but not cyclically.
+func resolveIncludes(layersDir string, layer *Layer, seen map[string]bool) (*Layer, error) {
+	if len(layer.Include) == 0 {
+		return layer, nil
+	}
+	var layers []*Layer
+	for _, include := range layer.Include {
+		path := filepath.Clean(include)
+		if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, "../") {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("layer %q cannot include %q: path must be inside the layers directory", layer.Label, include),
+				Layer:   layer.Label,
+				Field:   "include",
+			}
+		}
+		if seen[path] {
+			return nil, &FormatError{
+				Message: fmt.Sprintf("layer %q cannot include %q: include cycle", layer.Label, include),
+				Layer:   layer.Label,
+				Field:   "include",
+			}
+		}
+		data, err := ioutil.ReadFile(filepath.Join(layersDir, path))
+		if err != nil {
+			// Errors from package os generally include the path.
+			return nil, fmt.Errorf("cannot read included file: %v", err)
+		}
+		included, err := ParseLayer(layer.Order, path, data)
+		if err != nil {
+			return nil, err
+		}
+		seen[path] = true
+		included, err = resolveIncludes(layersDir, included, seen)
+		delete(seen, path)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, included)
+	}
+	merged, err := mergeLayers(append(layers, layer)...)
+	if err != nil {
+		return nil, err
+	}
+	merged.Order = layer.Order
+	merged.Label = layer.Label
+	merged.Include = layer.Include
+	return merged, nil
+}
+
+// ReadLayers reads the configuration layers from the "layers" sub-directory
+// in dir, followed by those in the "layers.d" sub-directory and then in each
+// of dropInDirs (see ReadDropInDir). Any of these directories that doesn't
+// exist is skipped.
+func ReadLayers(dir string, dropInDirs ...string) ([]*Layer, error) {
+	var layers []*Layer
 	layersDir := filepath.Join(dir, "layers")
 	_, err := os.Stat(layersDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return &Plan{}, nil
+	if err == nil {
+		layers, err = ReadLayersDir(layersDir)
+		if err != nil {
+			return nil, err
 		}
+	} else if !os.IsNotExist(err) {
 		return nil, err
 	}
 
-	layers, err := ReadLayersDir(layersDir)
+	dropInDirs = append([]string{filepath.Join(dir, DropInDirName)}, dropInDirs...)
+	for _, dropInDir := range dropInDirs {
+		more, err := readDropInDirIfExists(dropInDir, layers)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, more...)
+	}
+	return layers, nil
+}
+
+// ReadDir reads the configuration layers in dir and dropInDirs (see
+// ReadLayers), and returns the resulting Plan. If there are no layers, it
+// returns a valid Plan with no layers.
+func ReadDir(dir string, dropInDirs ...string) (*Plan, error) {
+	layers, err := ReadLayers(dir, dropInDirs...)
 	if err != nil {
 		return nil, err
 	}
@@ -495,9 +2185,41 @@ func ReadDir(dir string) (*Plan, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = combined.ExpandVars()
+	if err != nil {
+		return nil, err
+	}
 	plan := &Plan{
 		Layers:   layers,
 		Services: combined.Services,
+		Checks:   combined.Checks,
 	}
 	return plan, err
 }
+
+// readDropInDirIfExists reads the layers in the drop-in directory dir (if it
+// exists), numbered after and with labels distinct from the given layers.
+func readDropInDirIfExists(dir string, layers []*Layer) ([]*Layer, error) {
+	_, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	order := 0
+	if len(layers) > 0 {
+		order = layers[len(layers)-1].Order
+	}
+	more, err := ReadDropInDir(dir, order)
+	if err != nil {
+		return nil, err
+	}
+	for _, layer := range more {
+		for _, existing := range layers {
+			if existing.Label == layer.Label {
+				return nil, fmt.Errorf("cannot read layers directory %q: layer %q already exists", dir, layer.Label)
+			}
+		}
+	}
+	return more, nil
+}
@@ -19,6 +19,7 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -34,6 +35,10 @@ const (
 	defaultBackoffDelay  = 500 * time.Millisecond
 	defaultBackoffFactor = 2.0
 	defaultBackoffLimit  = 30 * time.Second
+
+	defaultCheckPeriod    = 10 * time.Second
+	defaultCheckTimeout   = 3 * time.Second
+	defaultCheckThreshold = 3
 )
 
 // TODOs:
@@ -79,6 +84,50 @@ type planTest struct {
 }
 
 var planTests = []planTest{{
+	summary: `One-shot service kind`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				kind: oneshot
+				remain-after-exit: true
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:            "svc1",
+				Override:        "replace",
+				Command:         "cmd",
+				Kind:            plan.KindOneshot,
+				RemainAfterExit: true,
+				BackoffDelay:    plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor:   plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:    plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Invalid kind`,
+	error:   `invalid kind "foo"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				kind: foo
+	`},
+}, {
+	summary: `Cannot use remain-after-exit without one-shot kind`,
+	error:   `plan must set "kind: oneshot" to use "remain-after-exit" for service "svc1"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				remain-after-exit: true
+	`},
+}, {
 	summary: "Relatively simple layer with override on top",
 	input: []string{`
 		summary: Simple layer
@@ -435,234 +484,1336 @@ var planTests = []planTest{{
 				command: cmd
 				backoff-factor: foo
 	`},
-}}
-
-func (s *S) TestParseLayer(c *C) {
-	for _, test := range planTests {
-		var sup plan.Plan
-		var err error
-		for i, yml := range test.input {
-			layer, e := plan.ParseLayer(i, fmt.Sprintf("layer-%d", i), reindent(yml))
-			if e != nil {
-				err = e
-				break
-			}
-			if len(test.layers) > 0 && test.layers[i] != nil {
-				c.Assert(layer, DeepEquals, test.layers[i])
-			}
-			sup.Layers = append(sup.Layers, layer)
-		}
-		if err == nil {
-			var result *plan.Layer
-			result, err = plan.CombineLayers(sup.Layers...)
-			if err == nil && test.result != nil {
-				c.Assert(result, DeepEquals, test.result)
-			}
-			if err == nil {
-				for name, order := range test.start {
-					p := plan.Plan{Services: result.Services}
-					names, err := p.StartOrder([]string{name})
-					c.Assert(err, IsNil)
-					c.Assert(names, DeepEquals, order)
-				}
-				for name, order := range test.stop {
-					p := plan.Plan{Services: result.Services}
-					names, err := p.StopOrder([]string{name})
-					c.Assert(err, IsNil)
-					c.Assert(names, DeepEquals, order)
-				}
-			}
-		}
-		if err != nil || test.error != "" {
-			if test.error != "" {
-				c.Assert(err, ErrorMatches, test.error)
-			} else {
-				c.Assert(err, IsNil)
-			}
-		}
-	}
-}
-
-func (s *S) TestCombineLayersCycle(c *C) {
-	// Even if individual layers don't have cycles, combined layers might.
-	layer1, err := plan.ParseLayer(1, "label1", []byte(`
-services:
-    srv1:
-        override: replace
-        command: cmd
-        after:
-            - srv2
-`))
-	c.Assert(err, IsNil)
-	layer2, err := plan.ParseLayer(2, "label2", []byte(`
-services:
-    srv2:
-        override: replace
-        command: cmd
-        after:
-            - srv1
-`))
-	c.Assert(err, IsNil)
-	_, err = plan.CombineLayers(layer1, layer2)
-	c.Assert(err, ErrorMatches, `services in before/after loop: .*`)
-	_, ok := err.(*plan.FormatError)
-	c.Assert(ok, Equals, true, Commentf("error must be *plan.FormatError, not %T", err))
-}
-
-func (s *S) TestMissingOverride(c *C) {
-	layer1, err := plan.ParseLayer(1, "label1", []byte("{}"))
-	c.Assert(err, IsNil)
-	layer2, err := plan.ParseLayer(2, "label2", []byte(`
-services:
-    srv1:
-        command: cmd
-`))
-	c.Assert(err, IsNil)
-	_, err = plan.CombineLayers(layer1, layer2)
-	c.Check(err, ErrorMatches, `layer "label2" must define \"override\" for service "srv1"`)
-	_, ok := err.(*plan.FormatError)
-	c.Check(ok, Equals, true, Commentf("error must be *plan.FormatError, not %T", err))
-}
-
-func (s *S) TestMissingCommand(c *C) {
-	// Combine fails if no command in combined plan
-	layer1, err := plan.ParseLayer(1, "label1", []byte("{}"))
-	c.Assert(err, IsNil)
-	layer2, err := plan.ParseLayer(2, "label2", []byte(`
-services:
-    srv1:
-        override: merge
-`))
-	c.Assert(err, IsNil)
-	_, err = plan.CombineLayers(layer1, layer2)
-	c.Check(err, ErrorMatches, `plan must define "command" for service "srv1"`)
-	_, ok := err.(*plan.FormatError)
-	c.Check(ok, Equals, true, Commentf("error must be *plan.FormatError, not %T", err))
-
-	// Combine succeeds if there is a command in combined plan
-	layer1, err = plan.ParseLayer(1, "label1", []byte(`
-services:
-    srv1:
-        override: merge
-        command: foo --bar
-`))
-	c.Assert(err, IsNil)
-	layer2, err = plan.ParseLayer(2, "label2", []byte(`
-services:
-    srv1:
-        override: merge
-`))
-	c.Assert(err, IsNil)
-	combined, err := plan.CombineLayers(layer1, layer2)
-	c.Assert(err, IsNil)
-	c.Assert(combined.Services["srv1"].Command, Equals, "foo --bar")
-}
-
-func (s *S) TestReadDir(c *C) {
-	pebbleDir := c.MkDir()
-	layersDir := filepath.Join(pebbleDir, "layers")
-	err := os.Mkdir(layersDir, 0755)
-	c.Assert(err, IsNil)
-
-	for _, test := range planTests {
-		for i, yml := range test.input {
-			err := ioutil.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%03d-layer-%d.yaml", i, i)), []byte(reindent(yml)), 0644)
-			c.Assert(err, IsNil)
-		}
-		sup, err := plan.ReadDir(pebbleDir)
-		if err == nil {
-			var result *plan.Layer
-			result, err = plan.CombineLayers(sup.Layers...)
-			if err == nil && test.result != nil {
-				c.Assert(result, DeepEquals, test.result)
-			}
-			if err == nil {
-				for name, order := range test.start {
-					p := plan.Plan{Services: result.Services}
-					names, err := p.StartOrder([]string{name})
-					c.Assert(err, IsNil)
-					c.Assert(names, DeepEquals, order)
-				}
-				for name, order := range test.stop {
-					p := plan.Plan{Services: result.Services}
-					names, err := p.StopOrder([]string{name})
-					c.Assert(err, IsNil)
-					c.Assert(names, DeepEquals, order)
-				}
-			}
-		}
-		if err != nil || test.error != "" {
-			if test.error != "" {
-				c.Assert(err, ErrorMatches, test.error)
-			} else {
-				c.Assert(err, IsNil)
-			}
-		}
-	}
-}
-
-var readDirBadNames = []string{
-	"001-l.yaml",
-	"01-label.yaml",
-	"0001-label.yaml",
-	"0001-label.yaml",
-	"001-label-.yaml",
-	"001--label.yaml",
-	"001-label--label.yaml",
-}
-
-func (s *S) TestReadDirBadNames(c *C) {
-	pebbleDir := c.MkDir()
-	layersDir := filepath.Join(pebbleDir, "layers")
-	err := os.Mkdir(layersDir, 0755)
-	c.Assert(err, IsNil)
-
-	for _, fname := range readDirBadNames {
-		fpath := filepath.Join(layersDir, fname)
-		err := ioutil.WriteFile(fpath, []byte("<ignore>"), 0644)
-		c.Assert(err, IsNil)
-		_, err = plan.ReadDir(pebbleDir)
-		c.Assert(err.Error(), Equals, fmt.Sprintf("invalid layer filename: %q (must look like \"123-some-label.yaml\")", fname))
-		err = os.Remove(fpath)
-		c.Assert(err, IsNil)
-	}
-}
-
-var readDirDupNames = [][]string{
-	{"001-bar.yaml", "001-foo.yaml"},
-	{"001-foo.yaml", "002-foo.yaml"},
-}
-
-func (s *S) TestReadDirDupNames(c *C) {
-	pebbleDir := c.MkDir()
-	layersDir := filepath.Join(pebbleDir, "layers")
-	err := os.Mkdir(layersDir, 0755)
-	c.Assert(err, IsNil)
-
-	for _, fnames := range readDirDupNames {
-		for _, fname := range fnames {
-			fpath := filepath.Join(layersDir, fname)
-			err := ioutil.WriteFile(fpath, []byte("summary: ignore"), 0644)
-			c.Assert(err, IsNil)
-		}
-		_, err = plan.ReadDir(pebbleDir)
-		c.Assert(err.Error(), Equals, fmt.Sprintf("invalid layer filename: %q not unique (have %q already)", fnames[1], fnames[0]))
-		for _, fname := range fnames {
-			fpath := filepath.Join(layersDir, fname)
-			err = os.Remove(fpath)
-			c.Assert(err, IsNil)
-		}
-	}
-}
-
-func (s *S) TestMarshalLayer(c *C) {
-	layerBytes := reindent(`
-		summary: Simple layer
-		description: A simple layer.
+}, {
+	summary: `Service okay-delay`,
+	input: []string{`
 		services:
-			srv1:
-				summary: Service summary
-				startup: enabled
+			"svc1":
+				override: replace
+				command: cmd
+				okay-delay: 30s
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:          "svc1",
+				Override:      "replace",
+				Command:       "cmd",
+				OkayDelay:     plan.OptionalDuration{Value: 30 * time.Second, IsSet: true},
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Service hooks`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				hooks:
+					pre-start:
+						command: migrate --up
+						timeout: 5m
+					post-stop:
+						command: cleanup
+	`, `
+		services:
+			"svc1":
+				override: merge
+				hooks:
+					pre-start:
+						on-failure: warn
+					post-start:
+						command: notify started
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:     "svc1",
+				Override: "replace",
+				Command:  "cmd",
+				Hooks: plan.ServiceHooks{
+					PreStart: &plan.ServiceHook{
+						Command:   "migrate --up",
+						Timeout:   plan.OptionalDuration{Value: 5 * time.Minute, IsSet: true},
+						OnFailure: plan.HookFailureWarn,
+					},
+					PostStart: &plan.ServiceHook{Command: "notify started"},
+					PostStop:  &plan.ServiceHook{Command: "cleanup"},
+				},
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Reload command replaces reload signal`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				reload-signal: SIGHUP
+			"svc2":
+				override: replace
+				command: cmd
+				reload-command: cmd --reload
+	`, `
+		services:
+			"svc1":
+				override: merge
+				reload-command: cmd --reload
+			"svc2":
+				override: merge
+				reload-signal: SIGUSR1
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:          "svc1",
+				Override:      "replace",
+				Command:       "cmd",
+				ReloadCommand: "cmd --reload",
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+			"svc2": {
+				Name:          "svc2",
+				Override:      "replace",
+				Command:       "cmd",
+				ReloadSignal:  "SIGUSR1",
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Checks and ready-checks`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				ready-checks:
+					- chk1
+				ready-timeout: 1m
+		checks:
+			chk1:
+				override: replace
+				http:
+					url: http://localhost:8080/ready
+			chk2:
+				override: replace
+				period: 20s
+				timeout: 5s
+				threshold: 2
+				exec:
+					command: ping -c1 localhost
+	`, `
+		checks:
+			chk1:
+				override: merge
+				level: ready
+				http:
+					headers:
+						X-Test: foo
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:          "svc1",
+				Override:      "replace",
+				Command:       "cmd",
+				ReadyChecks:   []string{"chk1"},
+				ReadyTimeout:  plan.OptionalDuration{Value: time.Minute, IsSet: true},
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+		Checks: map[string]*plan.Check{
+			"chk1": {
+				Name:      "chk1",
+				Override:  "replace",
+				Level:     plan.ReadyLevel,
+				Period:    plan.OptionalDuration{Value: defaultCheckPeriod},
+				Timeout:   plan.OptionalDuration{Value: defaultCheckTimeout},
+				Threshold: defaultCheckThreshold,
+				HTTP: &plan.HTTPCheck{
+					URL:     "http://localhost:8080/ready",
+					Headers: map[string]string{"X-Test": "foo"},
+				},
+			},
+			"chk2": {
+				Name:      "chk2",
+				Override:  "replace",
+				Period:    plan.OptionalDuration{Value: 20 * time.Second, IsSet: true},
+				Timeout:   plan.OptionalDuration{Value: 5 * time.Second, IsSet: true},
+				Threshold: 2,
+				Exec: &plan.ExecCheck{
+					Command: "ping -c1 localhost",
+				},
+			},
+		},
+	},
+}, {
+	summary: `Service log file`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				log-to:
+					path: /var/log/svc1.log
+			"svc2":
+				override: replace
+				command: cmd
+	`, `
+		services:
+			"svc2":
+				override: merge
+				log-to:
+					path: /var/log/svc2.log
+					max-size: 10M
+					backups: 3
+					compress: true
+				log-to-journald: true
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:          "svc1",
+				Override:      "replace",
+				Command:       "cmd",
+				LogTo:         &plan.LogTo{Path: "/var/log/svc1.log"},
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+			"svc2": {
+				Name:     "svc2",
+				Override: "replace",
+				Command:  "cmd",
+				LogTo: &plan.LogTo{
+					Path:     "/var/log/svc2.log",
+					MaxSize:  10 * 1024 * 1024,
+					Backups:  3,
+					Compress: true,
+				},
+				LogToJournald: true,
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Services inherit from the services they extend`,
+	input: []string{`
+		services:
+			"base":
+				override: replace
+				command: server --port=80
+				user: app
+				environment:
+					MODE: production
+					LEVEL: info
+				after:
+					- db
+			"worker":
+				override: replace
+				extends: base
+				command: worker
+				environment:
+					LEVEL: debug
+			"db":
+				override: replace
+				command: db
+	`, `
+		services:
+			"worker2":
+				override: replace
+				extends: worker
+				backoff-delay: 5s
+			"base":
+				override: merge
+				group: app
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"base": {
+				Name:          "base",
+				Override:      "replace",
+				Command:       "server --port=80",
+				User:          "app",
+				Group:         "app",
+				Environment:   map[string]string{"MODE": "production", "LEVEL": "info"},
+				After:         []string{"db"},
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+			"worker": {
+				Name:          "worker",
+				Override:      "replace",
+				Extends:       "base",
+				Command:       "worker",
+				User:          "app",
+				Group:         "app",
+				Environment:   map[string]string{"MODE": "production", "LEVEL": "debug"},
+				After:         []string{"db"},
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+			"worker2": {
+				Name:          "worker2",
+				Override:      "replace",
+				Extends:       "worker",
+				Command:       "worker",
+				User:          "app",
+				Group:         "app",
+				Environment:   map[string]string{"MODE": "production", "LEVEL": "debug"},
+				After:         []string{"db"},
+				BackoffDelay:  plan.OptionalDuration{Value: 5 * time.Second, IsSet: true},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+			"db": {
+				Name:          "db",
+				Override:      "replace",
+				Command:       "db",
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Extending an unknown service`,
+	error:   `service "worker" extends unknown service "base"`,
+	input: []string{`
+		services:
+			"worker":
+				override: replace
+				extends: base
+	`},
+}, {
+	summary: `Cycle in extends`,
+	error:   `service "a" has a cycle in "extends": a -> b -> c -> a`,
+	input: []string{`
+		services:
+			"a":
+				override: replace
+				extends: b
+			"b":
+				override: replace
+				extends: c
+			"c":
+				override: replace
+				command: cmd
+				extends: a
+	`},
+}, {
+	summary: `Environment files are combined`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				environment-files:
+					- /etc/svc1/env
+	`, `
+		services:
+			"svc1":
+				override: merge
+				environment-files:
+					- -/etc/svc1/secrets
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:             "svc1",
+				Override:         "replace",
+				Command:          "cmd",
+				EnvironmentFiles: []string{"/etc/svc1/env", "-/etc/svc1/secrets"},
+				BackoffDelay:     plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor:    plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:     plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Invalid secret reference`,
+	error:   `environment variable "PASS" has invalid secret reference "secret://../pass"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				environment:
+					PASS: secret://../pass
+	`},
+}, {
+	summary: `Relative environment file path`,
+	error:   `environment-files must be absolute paths, not "-env"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				environment-files:
+					- -env
+	`},
+}, {
+	summary: `Working directory is overridden`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				working-dir: /srv/one
+	`, `
+		services:
+			"svc1":
+				override: merge
+				working-dir: /srv/two
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:          "svc1",
+				Override:      "replace",
+				Command:       "cmd",
+				WorkingDir:    "/srv/two",
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Relative working directory`,
+	error:   `working-dir must be an absolute path, not "srv"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				working-dir: srv
+	`},
+}, {
+	summary: `Umask is overridden`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				umask: 077
+	`, `
+		services:
+			"svc1":
+				override: merge
+				umask: 0022
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:          "svc1",
+				Override:      "replace",
+				Command:       "cmd",
+				Umask:         "0022",
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Invalid umask`,
+	error:   `umask must be an octal number from 000 to 777, not "089"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				umask: 089
+	`},
+}, {
+	summary: `Start limit is overridden`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				start-limit-burst: 5
+				start-limit-interval: 1m
+	`, `
+		services:
+			"svc1":
+				override: merge
+				start-limit-burst: 3
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:               "svc1",
+				Override:           "replace",
+				Command:            "cmd",
+				BackoffDelay:       plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor:      plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:       plan.OptionalDuration{Value: defaultBackoffLimit},
+				StartLimitBurst:    3,
+				StartLimitInterval: plan.OptionalDuration{Value: time.Minute, IsSet: true},
+			},
+		},
+	},
+}, {
+	summary: `Negative start-limit-burst`,
+	error:   `start-limit-burst must not be negative, not -1`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				start-limit-burst: -1
+	`},
+}, {
+	summary: `Zero watchdog interval`,
+	error:   `watchdog must be positive, not 0s`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				watchdog: 0s
+	`},
+}, {
+	summary: `Zero okay-delay`,
+	error:   `okay-delay must be positive, not 0s`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				okay-delay: 0s
+	`},
+}, {
+	summary: `Invalid stop-signal`,
+	error:   `stop-signal must be a signal name such as SIGINT, not "QUIT"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				stop-signal: QUIT
+	`},
+}, {
+	summary: `Invalid kill-mode`,
+	error:   `invalid kill-mode "leader"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				kill-mode: leader
+	`},
+}, {
+	summary: `Invalid hook on-failure action`,
+	error:   `invalid post-start hook on-failure action "retry"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				hooks:
+					post-start:
+						command: notify
+						on-failure: retry
+	`},
+}, {
+	summary: `Zero hook timeout`,
+	error:   `pre-start hook timeout must be positive, not 0s`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				hooks:
+					pre-start:
+						command: migrate
+						timeout: 0s
+	`},
+}, {
+	summary: `Hook without a command`,
+	error:   `service "svc1" post-stop hook must have a command`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				hooks:
+					post-stop:
+						timeout: 10s
+	`},
+}, {
+	summary: `Invalid reload-signal`,
+	error:   `reload-signal must be a signal name such as SIGHUP, not "HUP"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				reload-signal: HUP
+	`},
+}, {
+	summary: `Both reload-command and reload-signal`,
+	error:   `cannot set both reload-command and reload-signal`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				reload-command: cmd --reload
+				reload-signal: SIGHUP
+	`},
+}, {
+	summary: `Relative log file path`,
+	error:   `log-to path must be an absolute path, not "svc1.log"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				log-to:
+					path: svc1.log
+	`},
+}, {
+	summary: `Invalid log file size`,
+	error:   `cannot parse layer "layer-0": invalid size "10X"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				log-to:
+					path: /var/log/svc1.log
+					max-size: 10X
+	`},
+}, {
+	summary: `Seccomp profiles`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				seccomp: default
+			"svc2":
+				override: replace
+				command: cmd
+				seccomp: /etc/pebble/svc2.bpf
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:          "svc1",
+				Override:      "replace",
+				Command:       "cmd",
+				Seccomp:       "default",
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+			"svc2": {
+				Name:          "svc2",
+				Override:      "replace",
+				Command:       "cmd",
+				Seccomp:       "/etc/pebble/svc2.bpf",
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `AppArmor profile`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				apparmor-profile: pebble-svc1
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:            "svc1",
+				Override:        "replace",
+				Command:         "cmd",
+				AppArmorProfile: "pebble-svc1",
+				BackoffDelay:    plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor:   plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:    plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Invalid AppArmor profile`,
+	error:   `invalid apparmor-profile "foo\\nbar"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				apparmor-profile: "foo\nbar"
+	`},
+}, {
+	summary: `Capabilities`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				capabilities:
+					- net_bind_service
+	`, `
+		services:
+			"svc1":
+				override: merge
+				capabilities:
+					- CAP_NET_RAW
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:          "svc1",
+				Override:      "replace",
+				Command:       "cmd",
+				Capabilities:  []string{"net_bind_service", "CAP_NET_RAW"},
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Unknown capability`,
+	error:   `unknown capability "fly"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				capabilities:
+					- fly
+	`},
+}, {
+	summary: `Mounts`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				mounts:
+					- source: /srv/data
+					  target: /data
+	`, `
+		services:
+			"svc1":
+				override: merge
+				mounts:
+					- source: /etc/svc1
+					  target: /etc/svc1
+					  read-only: true
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:     "svc1",
+				Override: "replace",
+				Command:  "cmd",
+				Mounts: []plan.Mount{
+					{Source: "/srv/data", Target: "/data"},
+					{Source: "/etc/svc1", Target: "/etc/svc1", ReadOnly: true},
+				},
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Relative mount path`,
+	error:   `mount source and target must be absolute paths, not "data" and "/data"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				mounts:
+					- source: data
+					  target: /data
+	`},
+}, {
+	summary: `Network and PID namespaces`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				network: none
+	`, `
+		services:
+			"svc1":
+				override: merge
+				network: netns:blue
+				pid-namespace: true
+	`},
+	result: &plan.Layer{
+		Services: map[string]*plan.Service{
+			"svc1": {
+				Name:          "svc1",
+				Override:      "replace",
+				Command:       "cmd",
+				Network:       "netns:blue",
+				PIDNamespace:  true,
+				BackoffDelay:  plan.OptionalDuration{Value: defaultBackoffDelay},
+				BackoffFactor: plan.OptionalFloat{Value: defaultBackoffFactor},
+				BackoffLimit:  plan.OptionalDuration{Value: defaultBackoffLimit},
+			},
+		},
+	},
+}, {
+	summary: `Invalid network`,
+	error:   `network must be "host", "none", or "netns:<name>", not "bridge"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				network: bridge
+	`},
+}, {
+	summary: `Unknown seccomp profile`,
+	error:   `seccomp must be one of "default", or the absolute path of a BPF program, not "strict"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				seccomp: strict
+	`},
+}, {
+	summary: `Unknown ready check`,
+	error:   `service "svc1" has unknown check "chk1" in "ready-checks"`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				ready-checks:
+					- chk1
+	`},
+}, {
+	summary: `Invalid ready-timeout`,
+	error:   `ready-timeout must be greater than zero, not 0s`,
+	input: []string{`
+		services:
+			"svc1":
+				override: replace
+				command: cmd
+				ready-timeout: 0s
+	`},
+}, {
+	summary: `Check without a type`,
+	error:   `plan must specify one of "http", "tcp", or "exec" for check "chk1"`,
+	input: []string{`
+		checks:
+			chk1:
+				override: replace
+				period: 5s
+	`},
+}, {
+	summary: `Check with more than one type`,
+	error:   `plan must specify one of "http", "tcp", or "exec" for check "chk1"`,
+	input: []string{`
+		checks:
+			chk1:
+				override: replace
+				tcp:
+					port: 80
+				exec:
+					command: true
+	`},
+}, {
+	summary: `Check timeout not less than period`,
+	error:   `check "chk1" timeout must be less than period`,
+	input: []string{`
+		checks:
+			chk1:
+				override: replace
+				period: 1s
+				timeout: 1s
+				tcp:
+					port: 80
+	`},
+}, {
+	summary: `Invalid check level`,
+	error:   `invalid level "foo" for check "chk1"`,
+	input: []string{`
+		checks:
+			chk1:
+				override: replace
+				level: foo
+				tcp:
+					port: 80
+	`},
+}, {
+	summary: `Check missing override`,
+	error:   `layer "layer-0" must define "override" for check "chk1"`,
+	input: []string{`
+		checks:
+			chk1:
+				tcp:
+					port: 80
+	`},
+}}
+
+func (s *S) TestParseLayer(c *C) {
+	for _, test := range planTests {
+		var sup plan.Plan
+		var err error
+		for i, yml := range test.input {
+			layer, e := plan.ParseLayer(i, fmt.Sprintf("layer-%d", i), reindent(yml))
+			if e != nil {
+				err = e
+				break
+			}
+			if len(test.layers) > 0 && test.layers[i] != nil {
+				c.Assert(layer, DeepEquals, test.layers[i])
+			}
+			sup.Layers = append(sup.Layers, layer)
+		}
+		if err == nil {
+			var result *plan.Layer
+			result, err = plan.CombineLayers(sup.Layers...)
+			if err == nil && test.result != nil {
+				c.Assert(result, DeepEquals, test.result)
+			}
+			if err == nil {
+				for name, order := range test.start {
+					p := plan.Plan{Services: result.Services}
+					names, err := p.StartOrder([]string{name})
+					c.Assert(err, IsNil)
+					c.Assert(names, DeepEquals, order)
+				}
+				for name, order := range test.stop {
+					p := plan.Plan{Services: result.Services}
+					names, err := p.StopOrder([]string{name})
+					c.Assert(err, IsNil)
+					c.Assert(names, DeepEquals, order)
+				}
+			}
+		}
+		if err != nil || test.error != "" {
+			if test.error != "" {
+				c.Assert(err, ErrorMatches, test.error)
+			} else {
+				c.Assert(err, IsNil)
+			}
+		}
+	}
+}
+
+func (s *S) TestCombineLayersCycle(c *C) {
+	// Even if individual layers don't have cycles, combined layers might.
+	layer1, err := plan.ParseLayer(1, "label1", []byte(`
+services:
+    srv1:
+        override: replace
+        command: cmd
+        after:
+            - srv2
+`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(2, "label2", []byte(`
+services:
+    srv2:
+        override: replace
+        command: cmd
+        after:
+            - srv1
+`))
+	c.Assert(err, IsNil)
+	_, err = plan.CombineLayers(layer1, layer2)
+	c.Assert(err, ErrorMatches, `services in before/after loop: .*`)
+	_, ok := err.(*plan.FormatError)
+	c.Assert(ok, Equals, true, Commentf("error must be *plan.FormatError, not %T", err))
+}
+
+func (s *S) TestMissingOverride(c *C) {
+	layer1, err := plan.ParseLayer(1, "label1", []byte("{}"))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(2, "label2", []byte(`
+services:
+    srv1:
+        command: cmd
+`))
+	c.Assert(err, IsNil)
+	_, err = plan.CombineLayers(layer1, layer2)
+	c.Check(err, ErrorMatches, `layer "label2" must define \"override\" for service "srv1"`)
+	_, ok := err.(*plan.FormatError)
+	c.Check(ok, Equals, true, Commentf("error must be *plan.FormatError, not %T", err))
+}
+
+func (s *S) TestInvalidOverride(c *C) {
+	layer1, err := plan.ParseLayer(1, "label1", []byte(`
+services:
+    srv1:
+        override: replace
+        command: cmd
+`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(2, "label2", []byte(`
+services:
+    srv1:
+        override: update
+        command: cmd2
+`))
+	c.Assert(err, IsNil)
+	_, err = plan.CombineLayers(layer1, layer2)
+	c.Check(err, ErrorMatches, `layer "label2" has invalid \"override\" value for service "srv1"`)
+	ferr, ok := err.(*plan.FormatError)
+	c.Assert(ok, Equals, true, Commentf("error must be *plan.FormatError, not %T", err))
+	c.Check(ferr.Field, Equals, "override")
+}
+
+func (s *S) TestMissingCommand(c *C) {
+	// Combine fails if no command in combined plan
+	layer1, err := plan.ParseLayer(1, "label1", []byte("{}"))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(2, "label2", []byte(`
+services:
+    srv1:
+        override: merge
+`))
+	c.Assert(err, IsNil)
+	_, err = plan.CombineLayers(layer1, layer2)
+	c.Check(err, ErrorMatches, `plan must define "command" for service "srv1"`)
+	_, ok := err.(*plan.FormatError)
+	c.Check(ok, Equals, true, Commentf("error must be *plan.FormatError, not %T", err))
+
+	// Combine succeeds if there is a command in combined plan
+	layer1, err = plan.ParseLayer(1, "label1", []byte(`
+services:
+    srv1:
+        override: merge
+        command: foo --bar
+`))
+	c.Assert(err, IsNil)
+	layer2, err = plan.ParseLayer(2, "label2", []byte(`
+services:
+    srv1:
+        override: merge
+`))
+	c.Assert(err, IsNil)
+	combined, err := plan.CombineLayers(layer1, layer2)
+	c.Assert(err, IsNil)
+	c.Assert(combined.Services["srv1"].Command, Equals, plan.ServiceCommand("foo --bar"))
+}
+
+func (s *S) TestParseCommand(c *C) {
+	for _, test := range []struct {
+		command     string
+		base        []string
+		defaults    []string
+		hasDefaults bool
+		err         string
+	}{
+		{command: "server --port 80", base: []string{"server", "--port", "80"}},
+		{command: "server [ --verbose ]", base: []string{"server"}, defaults: []string{"--verbose"}, hasDefaults: true},
+		{command: "server [ ]", base: []string{"server"}, defaults: []string{}, hasDefaults: true},
+		{command: "server [ x", err: "cannot have \\[ without a closing \\]"},
+		{command: "server [ a [ b ] ]", err: "cannot nest \\[ ... \\] groups"},
+		{command: "server ] a", err: "cannot have \\] outside of \\[ ... \\] group"},
+		{command: "server [ a ] b", err: "cannot have any arguments after \\[ ... \\] group"},
+	} {
+		service := &plan.Service{Command: plan.ServiceCommand(test.command)}
+		base, defaults, hasDefaults, err := service.ParseCommand()
+		comment := Commentf("command %q", test.command)
+		if test.err != "" {
+			c.Check(err, ErrorMatches, test.err, comment)
+			continue
+		}
+		c.Assert(err, IsNil, comment)
+		c.Check(base, DeepEquals, test.base, comment)
+		c.Check(defaults, DeepEquals, test.defaults, comment)
+		c.Check(hasDefaults, Equals, test.hasDefaults, comment)
+	}
+
+	layer, err := plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			srv1:
+				override: replace
+				command: server [ a ] b`))
+	c.Assert(err, IsNil)
+	_, err = plan.CombineLayers(layer)
+	c.Check(err, ErrorMatches, `cannot parse service "srv1" command: cannot have any arguments after \[ ... \] group`)
+
+	layer, err = plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			srv1:
+				override: replace
+				command: "[ a ]"`))
+	c.Assert(err, IsNil)
+	_, err = plan.CombineLayers(layer)
+	c.Check(err, ErrorMatches, `service "srv1" command must have a program before \[ ... \] group`)
+}
+
+func (s *S) TestCommandList(c *C) {
+	layer, err := plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			srv1:
+				override: replace
+				command: [/bin/echo, "hello world", "it's", "", "#1", "a\\b", "[", "--verbose", "]"]`))
+	c.Assert(err, IsNil)
+	service := layer.Services["srv1"]
+	c.Check(service.Command, Equals, plan.ServiceCommand(`/bin/echo 'hello world' 'it'"'"'s' '' '#1' 'a\b' [ --verbose ]`))
+	base, defaults, hasDefaults, err := service.ParseCommand()
+	c.Assert(err, IsNil)
+	c.Check(base, DeepEquals, []string{"/bin/echo", "hello world", "it's", "", "#1", `a\b`})
+	c.Check(defaults, DeepEquals, []string{"--verbose"})
+	c.Check(hasDefaults, Equals, true)
+
+	layer, err = plan.ParseLayer(1, "layer1", reindent(`
+		vars:
+			name: two words
+		services:
+			srv1:
+				override: replace
+				command: [/bin/echo, "${name}"]`))
+	c.Assert(err, IsNil)
+	combined, err := plan.CombineLayers(layer)
+	c.Assert(err, IsNil)
+	c.Assert(combined.ExpandVars(), IsNil)
+	base, _, _, err = combined.Services["srv1"].ParseCommand()
+	c.Assert(err, IsNil)
+	c.Check(base, DeepEquals, []string{"/bin/echo", "two words"})
+
+	// Values with quotes or backslashes stay a single argument as-is, as do
+	// those of references quoted in a command string.
+	layer, err = plan.ParseLayer(1, "layer1", reindent(`
+		vars:
+			msg: it's "here" \ $HOME
+		services:
+			srv1:
+				override: replace
+				command: [/bin/echo, "${msg}", "say: ${msg}"]
+			srv2:
+				override: replace
+				command: /bin/echo '${msg}' "${msg}"`))
+	c.Assert(err, IsNil)
+	combined, err = plan.CombineLayers(layer)
+	c.Assert(err, IsNil)
+	c.Assert(combined.ExpandVars(), IsNil)
+	base, _, _, err = combined.Services["srv1"].ParseCommand()
+	c.Assert(err, IsNil)
+	c.Check(base, DeepEquals, []string{"/bin/echo", `it's "here" \ $HOME`, `say: it's "here" \ $HOME`})
+	base, _, _, err = combined.Services["srv2"].ParseCommand()
+	c.Assert(err, IsNil)
+	c.Check(base, DeepEquals, []string{"/bin/echo", `it's "here" \ $HOME`, `it's "here" \ $HOME`})
+
+	_, err = plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			srv1:
+				override: replace
+				command: []`))
+	c.Check(err, ErrorMatches, `cannot parse layer "layer1": command list must not be empty`)
+
+	_, err = plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			srv1:
+				override: replace
+				command: {a: b}`))
+	c.Check(err, ErrorMatches, `cannot parse layer "layer1": command must be a YAML string or list of strings`)
+}
+
+func (s *S) TestReadDir(c *C) {
+	for _, test := range planTests {
+		pebbleDir := c.MkDir()
+		layersDir := filepath.Join(pebbleDir, "layers")
+		err := os.Mkdir(layersDir, 0755)
+		c.Assert(err, IsNil)
+
+		for i, yml := range test.input {
+			err := ioutil.WriteFile(filepath.Join(layersDir, fmt.Sprintf("%03d-layer-%d.yaml", i, i)), []byte(reindent(yml)), 0644)
+			c.Assert(err, IsNil)
+		}
+		sup, err := plan.ReadDir(pebbleDir)
+		if err == nil {
+			var result *plan.Layer
+			result, err = plan.CombineLayers(sup.Layers...)
+			if err == nil && test.result != nil {
+				c.Assert(result, DeepEquals, test.result)
+			}
+			if err == nil {
+				for name, order := range test.start {
+					p := plan.Plan{Services: result.Services}
+					names, err := p.StartOrder([]string{name})
+					c.Assert(err, IsNil)
+					c.Assert(names, DeepEquals, order)
+				}
+				for name, order := range test.stop {
+					p := plan.Plan{Services: result.Services}
+					names, err := p.StopOrder([]string{name})
+					c.Assert(err, IsNil)
+					c.Assert(names, DeepEquals, order)
+				}
+			}
+		}
+		if err != nil || test.error != "" {
+			if test.error != "" {
+				c.Assert(err, ErrorMatches, test.error)
+			} else {
+				c.Assert(err, IsNil)
+			}
+		}
+	}
+}
+
+var readDirBadNames = []string{
+	"001-l.yaml",
+	"01-label.yaml",
+	"0001-label.yaml",
+	"0001-label.yaml",
+	"001-label-.yaml",
+	"001--label.yaml",
+	"001-label--label.yaml",
+}
+
+func (s *S) TestReadDirBadNames(c *C) {
+	pebbleDir := c.MkDir()
+	layersDir := filepath.Join(pebbleDir, "layers")
+	err := os.Mkdir(layersDir, 0755)
+	c.Assert(err, IsNil)
+
+	for _, fname := range readDirBadNames {
+		fpath := filepath.Join(layersDir, fname)
+		err := ioutil.WriteFile(fpath, []byte("<ignore>"), 0644)
+		c.Assert(err, IsNil)
+		_, err = plan.ReadDir(pebbleDir)
+		c.Assert(err.Error(), Equals, fmt.Sprintf("invalid layer filename: %q (must look like \"123-some-label.yaml\")", fname))
+		err = os.Remove(fpath)
+		c.Assert(err, IsNil)
+	}
+}
+
+var readDirDupNames = [][]string{
+	{"001-bar.yaml", "001-foo.yaml"},
+	{"001-foo.yaml", "002-foo.yaml"},
+}
+
+func (s *S) TestReadDirDupNames(c *C) {
+	pebbleDir := c.MkDir()
+	layersDir := filepath.Join(pebbleDir, "layers")
+	err := os.Mkdir(layersDir, 0755)
+	c.Assert(err, IsNil)
+
+	for _, fnames := range readDirDupNames {
+		for _, fname := range fnames {
+			fpath := filepath.Join(layersDir, fname)
+			err := ioutil.WriteFile(fpath, []byte("summary: ignore"), 0644)
+			c.Assert(err, IsNil)
+		}
+		_, err = plan.ReadDir(pebbleDir)
+		c.Assert(err.Error(), Equals, fmt.Sprintf("invalid layer filename: %q not unique (have %q already)", fnames[1], fnames[0]))
+		for _, fname := range fnames {
+			fpath := filepath.Join(layersDir, fname)
+			err = os.Remove(fpath)
+			c.Assert(err, IsNil)
+		}
+	}
+}
+
+func (s *S) TestReadDirDropIns(c *C) {
+	pebbleDir := c.MkDir()
+	extraDir := c.MkDir()
+	for path, content := range map[string]string{
+		"layers/001-base.yaml":     "services: {srv: {override: replace, command: base}}",
+		"layers.d/zzz-last.yaml":   "services: {srv: {override: merge, command: last}}",
+		"layers.d/10-myapp.yaml":   "services: {app: {override: replace, command: myapp}}",
+		"layers.d/notes.txt":       "ignored",
+		"layers.d/common/foo.yaml": "ignored",
+	} {
+		fpath := filepath.Join(pebbleDir, path)
+		err := os.MkdirAll(filepath.Dir(fpath), 0755)
+		c.Assert(err, IsNil)
+		err = ioutil.WriteFile(fpath, []byte(content), 0644)
+		c.Assert(err, IsNil)
+	}
+	err := ioutil.WriteFile(filepath.Join(extraDir, "extra.yaml"), []byte("services: {srv: {override: merge, command: extra}}"), 0644)
+	c.Assert(err, IsNil)
+
+	p, err := plan.ReadDir(pebbleDir, extraDir, filepath.Join(pebbleDir, "missing"))
+	c.Assert(err, IsNil)
+	var layers []string
+	for _, layer := range p.Layers {
+		layers = append(layers, fmt.Sprintf("%d-%s", layer.Order, layer.Label))
+	}
+	c.Check(layers, DeepEquals, []string{"1-base", "2-myapp", "3-zzz-last", "4-extra"})
+	c.Check(p.Services["srv"].Command, Equals, plan.ServiceCommand("extra"))
+	c.Check(p.Services["app"].Command, Equals, plan.ServiceCommand("myapp"))
+
+	// Drop-in layers without a layers directory.
+	err = os.RemoveAll(filepath.Join(pebbleDir, "layers"))
+	c.Assert(err, IsNil)
+	p, err = plan.ReadDir(pebbleDir)
+	c.Assert(err, IsNil)
+	c.Assert(p.Layers, HasLen, 2)
+	c.Check(p.Layers[0].Label, Equals, "myapp")
+	c.Check(p.Layers[0].Order, Equals, 1)
+
+	// Labels must be unique across all the directories.
+	err = ioutil.WriteFile(filepath.Join(extraDir, "myapp.yaml"), []byte("summary: dup"), 0644)
+	c.Assert(err, IsNil)
+	_, err = plan.ReadDir(pebbleDir, extraDir)
+	c.Check(err, ErrorMatches, `cannot read layers directory ".*": layer "myapp" already exists`)
+}
+
+func (s *S) TestReadDropInDirBadNames(c *C) {
+	for _, fnames := range [][]string{
+		{"Foo.yaml"},
+		{"fo.yaml"},
+		{"1-foo.yaml", "2-foo.yaml"},
+	} {
+		dir := c.MkDir()
+		for _, fname := range fnames {
+			err := ioutil.WriteFile(filepath.Join(dir, fname), []byte("summary: ignore"), 0644)
+			c.Assert(err, IsNil)
+		}
+		_, err := plan.ReadDropInDir(dir, 0)
+		if len(fnames) == 1 {
+			c.Check(err, ErrorMatches, fmt.Sprintf(`invalid layer filename: %q \(must look like "some-label.yaml"\)`, fnames[0]))
+		} else {
+			c.Check(err, ErrorMatches, fmt.Sprintf(`invalid layer filename: %q not unique \(have %q already\)`, fnames[1], fnames[0]))
+		}
+	}
+}
+
+func (s *S) TestMarshalLayer(c *C) {
+	layerBytes := reindent(`
+		summary: Simple layer
+		description: A simple layer.
+		services:
+			srv1:
+				summary: Service summary
+				startup: enabled
 				override: replace
 				command: cmd arg1 "arg2 arg3"
 				after:
@@ -691,3 +1842,520 @@ func (s *S) TestMarshalLayer(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(string(out), Equals, string(layerBytes))
 }
+
+func (s *S) TestTemplateService(c *C) {
+	layer, err := plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			worker@:
+				override: replace
+				command: worker --id %i
+				environment:
+					WORKER_ID: "%i"
+				after:
+					- db
+			db:
+				override: replace
+				command: db`))
+	c.Assert(err, IsNil)
+	combined, err := plan.CombineLayers(layer)
+	c.Assert(err, IsNil)
+	p := &plan.Plan{Services: combined.Services}
+
+	service, ok := p.Service("worker@3")
+	c.Assert(ok, Equals, true)
+	c.Check(service.Name, Equals, "worker@3")
+	c.Check(service.Command, Equals, plan.ServiceCommand("worker --id 3"))
+	c.Check(service.Environment, DeepEquals, map[string]string{"WORKER_ID": "3"})
+	c.Check(combined.Services["worker@"].Command, Equals, plan.ServiceCommand("worker --id %i"))
+
+	_, ok = p.Service("worker@bad id")
+	c.Check(ok, Equals, false)
+	_, ok = p.Service("other@3")
+	c.Check(ok, Equals, false)
+
+	names, err := p.StartOrder([]string{"worker@3", "db"})
+	c.Assert(err, IsNil)
+	c.Check(names, DeepEquals, []string{"db", "worker@3"})
+
+	_, err = p.StartOrder([]string{"worker@"})
+	c.Check(err, ErrorMatches, `cannot use template service "worker@" without an instance \(for example "worker@1"\)`)
+}
+
+func (s *S) TestByteSize(c *C) {
+	for _, test := range []struct {
+		input string
+		size  plan.ByteSize
+		err   string
+	}{
+		{input: "512", size: 512},
+		{input: "512K", size: 512 * 1024},
+		{input: "512k", size: 512 * 1024},
+		{input: "10M", size: 10 * 1024 * 1024},
+		{input: "10m", size: 10 * 1024 * 1024},
+		{input: "1GiB", size: 1024 * 1024 * 1024},
+		{input: "1gib", size: 1024 * 1024 * 1024},
+		{input: "2GB", size: 2 * 1024 * 1024 * 1024},
+		{input: "10X", err: `invalid size "10X"`},
+		{input: "-1K", err: `invalid size "-1K"`},
+		{input: "9223372036854775807", size: math.MaxInt64},
+		{input: "9223372036854775807K", err: `size "9223372036854775807K" is too large`},
+		{input: "8589934592G", err: `size "8589934592G" is too large`},
+	} {
+		var size plan.ByteSize
+		err := yaml.Unmarshal([]byte(test.input), &size)
+		if test.err != "" {
+			c.Check(err, ErrorMatches, test.err, Commentf("%s", test.input))
+			continue
+		}
+		c.Check(err, IsNil, Commentf("%s", test.input))
+		c.Check(size, Equals, test.size, Commentf("%s", test.input))
+	}
+}
+
+func (s *S) TestDependencies(c *C) {
+	layer, err := plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			db:
+				override: replace
+				command: db
+			web:
+				override: replace
+				command: web
+				after:
+					- db
+			worker:
+				override: replace
+				command: worker
+				before:
+					- web
+			cache:
+				override: replace
+				command: cache
+			metrics:
+				override: replace
+				command: metrics
+				requires:
+					- db`))
+	c.Assert(err, IsNil)
+	combined, err := plan.CombineLayers(layer)
+	c.Assert(err, IsNil)
+	p := &plan.Plan{Services: combined.Services}
+
+	// db and worker have no ordering between them, but both must start
+	// before web, and metrics waits for db, which it requires.
+	names, err := p.StartOrder([]string{"cache", "db", "metrics", "web", "worker"})
+	c.Assert(err, IsNil)
+	c.Check(p.StartDependencies(names), DeepEquals, map[string][]string{
+		"cache":   nil,
+		"db":      nil,
+		"metrics": {"db"},
+		"web":     depsInOrder(names, "db", "worker"),
+		"worker":  nil,
+	})
+
+	// Stopping db also stops metrics, which must be stopped first.
+	names, err = p.StopOrder([]string{"db", "web"})
+	c.Assert(err, IsNil)
+	c.Check(p.StopDependencies(names), DeepEquals, map[string][]string{
+		"db":      depsInOrder(names, "metrics", "web"),
+		"metrics": nil,
+		"web":     nil,
+	})
+
+	// Only dependencies between the given services are considered.
+	c.Check(p.StartDependencies([]string{"worker", "metrics"}), DeepEquals, map[string][]string{
+		"metrics": nil,
+		"worker":  nil,
+	})
+}
+
+func (s *S) TestDependenciesRequiresCycle(c *C) {
+	layer, err := plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			one:
+				override: replace
+				command: one
+				requires:
+					- two
+			two:
+				override: replace
+				command: two
+				after:
+					- one
+				requires:
+					- one`))
+	c.Assert(err, IsNil)
+	combined, err := plan.CombineLayers(layer)
+	c.Assert(err, IsNil)
+	p := &plan.Plan{Services: combined.Services}
+
+	// two starts after one, so one can't also wait for two.
+	names, err := p.StartOrder([]string{"one", "two"})
+	c.Assert(err, IsNil)
+	c.Check(names, DeepEquals, []string{"one", "two"})
+	c.Check(p.StartDependencies(names), DeepEquals, map[string][]string{
+		"one": nil,
+		"two": {"one"},
+	})
+}
+
+// depsInOrder returns the given services in the order they're in names.
+func depsInOrder(names []string, services ...string) []string {
+	var deps []string
+	for _, name := range names {
+		for _, service := range services {
+			if name == service {
+				deps = append(deps, name)
+			}
+		}
+	}
+	return deps
+}
+
+func (s *S) TestTemplateServiceErrors(c *C) {
+	_, err := plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			worker@1:
+				override: replace
+				command: worker`))
+	c.Check(err, ErrorMatches, `cannot use "@" in service name "worker@1" except as template suffix`)
+
+	layer, err := plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			worker@:
+				override: replace
+				command: worker
+				startup: enabled`))
+	c.Assert(err, IsNil)
+	_, err = plan.CombineLayers(layer)
+	c.Check(err, ErrorMatches, `template service "worker@" cannot have "startup: enabled"`)
+
+	layer, err = plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			worker@:
+				override: replace
+				command: worker
+			srv1:
+				override: replace
+				command: srv1
+				requires:
+					- worker@`))
+	c.Assert(err, IsNil)
+	_, err = plan.CombineLayers(layer)
+	c.Check(err, ErrorMatches, `service "srv1" cannot require template service "worker@" \(specify an instance\)`)
+}
+
+func (s *S) TestExpandVars(c *C) {
+	layer1, err := plan.ParseLayer(1, "layer1", reindent(`
+		vars:
+			port: "8080"
+			name: base
+		services:
+			srv1:
+				override: replace
+				command: srv1 --port ${port} --name ${name} --literal $${port}
+				environment:
+					URL: http://localhost:${port}/
+					HOME: $HOME`))
+	c.Assert(err, IsNil)
+	layer2, err := plan.ParseLayer(2, "layer2", reindent(`
+		vars:
+			port: "9090"`))
+	c.Assert(err, IsNil)
+
+	combined, err := plan.CombineLayers(layer1, layer2)
+	c.Assert(err, IsNil)
+	c.Check(combined.Vars, DeepEquals, map[string]string{"port": "9090", "name": "base"})
+	err = combined.ExpandVars()
+	c.Assert(err, IsNil)
+	srv1 := combined.Services["srv1"]
+	c.Check(srv1.Command, Equals, plan.ServiceCommand("srv1 --port 9090 --name base --literal ${port}"))
+	c.Check(srv1.Environment, DeepEquals, map[string]string{
+		"URL":  "http://localhost:9090/",
+		"HOME": "$HOME",
+	})
+
+	// The original layers are left untouched.
+	c.Check(layer1.Services["srv1"].Command, Equals, plan.ServiceCommand("srv1 --port ${port} --name ${name} --literal $${port}"))
+}
+
+func (s *S) TestExpandVarsChecks(c *C) {
+	layer, err := plan.ParseLayer(1, "layer1", reindent(`
+		vars:
+			host: example.com
+			port: "8080"
+			dir: /srv
+		checks:
+			chk-http:
+				override: replace
+				http:
+					url: http://${host}:${port}/health
+					headers:
+						Host: ${host}
+			chk-tcp:
+				override: replace
+				tcp:
+					host: ${host}
+					port: 80
+			chk-exec:
+				override: replace
+				exec:
+					command: check --port ${port} --literal $${port}
+					environment:
+						DIR: ${dir}/data
+					working-dir: ${dir}`))
+	c.Assert(err, IsNil)
+	combined, err := plan.CombineLayers(layer)
+	c.Assert(err, IsNil)
+	err = combined.ExpandVars()
+	c.Assert(err, IsNil)
+
+	c.Check(combined.Checks["chk-http"].HTTP.URL, Equals, "http://example.com:8080/health")
+	c.Check(combined.Checks["chk-http"].HTTP.Headers, DeepEquals, map[string]string{"Host": "example.com"})
+	c.Check(combined.Checks["chk-tcp"].TCP.Host, Equals, "example.com")
+	exec := combined.Checks["chk-exec"].Exec
+	c.Check(exec.Command, Equals, "check --port 8080 --literal ${port}")
+	c.Check(exec.Environment, DeepEquals, map[string]string{"DIR": "/srv/data"})
+	c.Check(exec.WorkingDir, Equals, "/srv")
+
+	// The original layer is left untouched.
+	c.Check(layer.Checks["chk-http"].HTTP.URL, Equals, "http://${host}:${port}/health")
+	c.Check(layer.Checks["chk-http"].HTTP.Headers["Host"], Equals, "${host}")
+}
+
+func (s *S) TestExpandHostVars(c *C) {
+	layer, err := plan.ParseLayer(1, "layer1", reindent(`
+		vars:
+			region: eu
+		services:
+			srv1:
+				override: replace
+				command: srv1
+				environment:
+					KEY: ${HOST:AWS_KEY}
+					URL: https://${region}.example.com/${HOST:USER}/$${HOST:LITERAL}`))
+	c.Assert(err, IsNil)
+	combined, err := plan.CombineLayers(layer)
+	c.Assert(err, IsNil)
+	err = combined.ExpandVars()
+	c.Assert(err, IsNil)
+
+	// Host variables are left to expand when the service starts.
+	env := combined.Services["srv1"].Environment
+	c.Check(env, DeepEquals, map[string]string{
+		"KEY": "${HOST:AWS_KEY}",
+		"URL": "https://eu.example.com/${HOST:USER}/$${HOST:LITERAL}",
+	})
+
+	lookup := func(name string) (string, error) {
+		if name == "USER" {
+			return "", fmt.Errorf("host variable %q is not allowed", name)
+		}
+		return "<" + name + ">", nil
+	}
+	value, err := plan.ExpandHostVars(env["KEY"], lookup)
+	c.Assert(err, IsNil)
+	c.Check(value, Equals, "<AWS_KEY>")
+	_, err = plan.ExpandHostVars(env["URL"], lookup)
+	c.Check(err, ErrorMatches, `host variable "USER" is not allowed`)
+	value, err = plan.ExpandHostVars("${other} $${HOST:LITERAL}", lookup)
+	c.Assert(err, IsNil)
+	c.Check(value, Equals, "${other} ${HOST:LITERAL}")
+
+	// Host variables can only be used in environment values.
+	for _, yaml := range []string{`
+		services:
+			srv1:
+				override: replace
+				command: srv1 ${HOST:PATH}`, `
+		services:
+			srv1:
+				override: replace
+				command: srv1
+				environment:
+					FOO: ${HOST:BAD-NAME}`,
+	} {
+		layer, err = plan.ParseLayer(1, "layer1", reindent(yaml))
+		c.Assert(err, IsNil)
+		combined, err = plan.CombineLayers(layer)
+		c.Assert(err, IsNil)
+		err = combined.ExpandVars()
+		c.Check(err, ErrorMatches, `service "srv1" (command references undefined variable "HOST:PATH"|environment variable "FOO" references invalid host variable "BAD-NAME")`)
+	}
+}
+
+func (s *S) TestExpandVarsErrors(c *C) {
+	layer, err := plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			srv1:
+				override: replace
+				command: srv1 --port ${port}`))
+	c.Assert(err, IsNil)
+	combined, err := plan.CombineLayers(layer)
+	c.Assert(err, IsNil)
+	err = combined.ExpandVars()
+	c.Check(err, ErrorMatches, `service "srv1" command references undefined variable "port"`)
+	_, ok := err.(*plan.FormatError)
+	c.Check(ok, Equals, true, Commentf("error must be *plan.FormatError, not %T", err))
+
+	layer, err = plan.ParseLayer(1, "layer1", reindent(`
+		services:
+			srv1:
+				override: replace
+				command: srv1
+				environment:
+					FOO: ${foo}`))
+	c.Assert(err, IsNil)
+	combined, err = plan.CombineLayers(layer)
+	c.Assert(err, IsNil)
+	err = combined.ExpandVars()
+	c.Check(err, ErrorMatches, `service "srv1" environment variable "FOO" references undefined variable "foo"`)
+
+	for _, test := range []struct {
+		yaml  string
+		field string
+		error string
+	}{{`
+		checks:
+			chk1:
+				override: replace
+				http:
+					url: http://${host}/`,
+		"http", `check "chk1" http url references undefined variable "host"`,
+	}, {`
+		checks:
+			chk1:
+				override: replace
+				http:
+					url: http://localhost/
+					headers:
+						Host: ${host}`,
+		"http", `check "chk1" http header "Host" references undefined variable "host"`,
+	}, {`
+		checks:
+			chk1:
+				override: replace
+				tcp:
+					host: ${host}
+					port: 80`,
+		"tcp", `check "chk1" tcp host references undefined variable "host"`,
+	}, {`
+		checks:
+			chk1:
+				override: replace
+				exec:
+					command: check
+					working-dir: ${dir}`,
+		"exec", `check "chk1" exec working-dir references undefined variable "dir"`,
+	}} {
+		layer, err = plan.ParseLayer(1, "layer1", reindent(test.yaml))
+		c.Assert(err, IsNil)
+		combined, err = plan.CombineLayers(layer)
+		c.Assert(err, IsNil)
+		err = combined.ExpandVars()
+		c.Check(err, ErrorMatches, test.error)
+		formatErr, ok := err.(*plan.FormatError)
+		c.Assert(ok, Equals, true, Commentf("error must be *plan.FormatError, not %T", err))
+		c.Check(formatErr.Check, Equals, "chk1")
+		c.Check(formatErr.Field, Equals, test.field)
+	}
+
+	_, err = plan.ParseLayer(1, "layer1", reindent(`
+		vars:
+			"bad name": x`))
+	c.Check(err, ErrorMatches, `invalid variable name "bad name"`)
+}
+
+func (s *S) TestReadDirInclude(c *C) {
+	pebbleDir := c.MkDir()
+	layersDir := filepath.Join(pebbleDir, "layers")
+	err := os.MkdirAll(filepath.Join(layersDir, "common"), 0755)
+	c.Assert(err, IsNil)
+
+	files := map[string]string{
+		"001-base.yaml": `
+			services:
+				srv1:
+					override: replace
+					command: srv1
+		`,
+		"002-app.yaml": `
+			summary: App layer
+			include:
+				- common/env.yaml
+				- common/db.yaml
+			services:
+				app:
+					override: replace
+					command: app
+					environment:
+						MODE: app
+		`,
+		"common/env.yaml": `
+			services:
+				srv1:
+					override: merge
+					environment:
+						MODE: common
+				app:
+					override: replace
+					command: overridden
+					environment:
+						MODE: common
+						OTHER: other
+		`,
+		"common/db.yaml": `
+			include:
+				- common/vars.yaml
+			services:
+				db:
+					override: replace
+					command: db --port ${port}
+		`,
+		"common/vars.yaml": `
+			vars:
+				port: "5432"
+		`,
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(layersDir, name), reindent(content), 0644)
+		c.Assert(err, IsNil)
+	}
+
+	p, err := plan.ReadDir(pebbleDir)
+	c.Assert(err, IsNil)
+	c.Assert(p.Layers, HasLen, 2)
+	c.Check(p.Layers[1].Order, Equals, 2)
+	c.Check(p.Layers[1].Label, Equals, "app")
+	c.Check(p.Layers[1].Summary, Equals, "App layer")
+	c.Check(p.Services["srv1"].Command, Equals, plan.ServiceCommand("srv1"))
+	c.Check(p.Services["srv1"].Environment, DeepEquals, map[string]string{"MODE": "common"})
+	c.Check(p.Services["app"].Command, Equals, plan.ServiceCommand("app"))
+	c.Check(p.Services["app"].Environment, DeepEquals, map[string]string{"MODE": "app"})
+	c.Check(p.Services["db"].Command, Equals, plan.ServiceCommand("db --port 5432"))
+}
+
+func (s *S) TestReadDirIncludeErrors(c *C) {
+	tests := []struct {
+		include string
+		error   string
+	}{
+		{"/etc/foo.yaml", `layer "base" cannot include "/etc/foo.yaml": path must be inside the layers directory`},
+		{"../foo.yaml", `layer "base" cannot include "../foo.yaml": path must be inside the layers directory`},
+		{"missing.txt", `cannot read included file: .*missing.txt: no such file or directory`},
+		{"cycle.txt", `layer "cycle.txt" cannot include "cycle.txt": include cycle`},
+	}
+	for _, test := range tests {
+		pebbleDir := c.MkDir()
+		layersDir := filepath.Join(pebbleDir, "layers")
+		err := os.Mkdir(layersDir, 0755)
+		c.Assert(err, IsNil)
+		err = ioutil.WriteFile(filepath.Join(layersDir, "001-base.yaml"), []byte("include: ["+test.include+"]"), 0644)
+		c.Assert(err, IsNil)
+		err = ioutil.WriteFile(filepath.Join(layersDir, "cycle.txt"), []byte("include: [cycle.txt]"), 0644)
+		c.Assert(err, IsNil)
+
+		_, err = plan.ReadDir(pebbleDir)
+		c.Check(err, ErrorMatches, test.error)
+	}
+}
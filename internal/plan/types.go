@@ -2,7 +2,9 @@ package plan
 
 import (
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -65,3 +67,83 @@ func (o *OptionalFloat) UnmarshalYAML(value *yaml.Node) error {
 	o.IsSet = true
 	return nil
 }
+
+// ByteSize is a size in bytes, which may be given in YAML as a plain number
+// of bytes or with a binary unit suffix, for example "512K", "10M" or "1GiB".
+// The case of the unit is ignored.
+type ByteSize int64
+
+func (b ByteSize) MarshalYAML() (interface{}, error) {
+	return int64(b), nil
+}
+
+func (b *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("size must be a YAML string or number")
+	}
+	s := strings.ToUpper(value.Value)
+	s = strings.TrimSuffix(s, "B")
+	s = strings.TrimSuffix(s, "I")
+	multiplier := int64(1)
+	if len(s) > 0 {
+		switch s[len(s)-1] {
+		case 'K':
+			multiplier = 1024
+		case 'M':
+			multiplier = 1024 * 1024
+		case 'G':
+			multiplier = 1024 * 1024 * 1024
+		}
+		if multiplier != 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q", value.Value)
+	}
+	if n > math.MaxInt64/multiplier {
+		return fmt.Errorf("size %q is too large", value.Value)
+	}
+	*b = ByteSize(n * multiplier)
+	return nil
+}
+
+// ServiceCommand is the command of a service. It may be given in YAML as a
+// string, which is split into arguments as a shell would (without running
+// one), or as a list of arguments, which is stored as the equivalent string
+// with each argument quoted as necessary.
+type ServiceCommand string
+
+func (c *ServiceCommand) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		*c = ServiceCommand(value.Value)
+		return nil
+	case yaml.SequenceNode:
+		var args []string
+		if err := value.Decode(&args); err != nil {
+			return fmt.Errorf("command must be a YAML string or list of strings")
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("command list must not be empty")
+		}
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = quoteArg(arg)
+		}
+		*c = ServiceCommand(strings.Join(quoted, " "))
+		return nil
+	}
+	return fmt.Errorf("command must be a YAML string or list of strings")
+}
+
+// quoteArg quotes arg, if necessary, so that it's split back into a single
+// argument as-is. Arguments with variable references are quoted too, so that
+// they stay a single argument when the variables are expanded.
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\r\n\"'\\#$") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+}
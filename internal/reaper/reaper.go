@@ -0,0 +1,282 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package reaper reaps child processes that exit, including orphaned
+// processes re-parented to Pebble when it runs as PID 1 (for example, in a
+// container), so that they don't remain as zombies.
+//
+// While the reaper is running, child processes must be started with
+// StartCommand and waited for with WaitCommand (or WaitProcess), or run with
+// CommandOutput or CommandCombinedOutput, rather than with exec.Cmd's Start,
+// Wait, Run or Output methods, as otherwise the reaper may reap the process
+// before Wait does. When the reaper is not running, these functions fall
+// back to the standard library.
+package reaper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internal/logger"
+)
+
+var (
+	mutex      sync.Mutex
+	running    bool
+	pids       = make(map[int]chan syscall.WaitStatus)
+	reaperTomb tomb.Tomb
+)
+
+// Start starts the reaper, which reaps child processes when they exit.
+func Start() error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if running {
+		return fmt.Errorf("reaper already started")
+	}
+	running = true
+	reaperTomb = tomb.Tomb{}
+	reaperTomb.Go(reapChildren)
+	return nil
+}
+
+// Stop stops the reaper.
+func Stop() error {
+	mutex.Lock()
+	if !running {
+		mutex.Unlock()
+		return fmt.Errorf("reaper not started")
+	}
+	reaperTomb.Kill(nil)
+	mutex.Unlock()
+
+	err := reaperTomb.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	running = false
+	return err
+}
+
+// reapChildren reaps exited child processes whenever SIGCHLD is received.
+func reapChildren() error {
+	sigChld := make(chan os.Signal, 1)
+	signal.Notify(sigChld, syscall.SIGCHLD)
+	defer signal.Stop(sigChld)
+
+	// Reap anything that exited before the signal handler was installed.
+	reapOnce()
+	for {
+		select {
+		case <-sigChld:
+			reapOnce()
+		case <-reaperTomb.Dying():
+			return nil
+		}
+	}
+}
+
+// reapOnce reaps all child processes that have exited, sending the exit
+// status of the ones started with StartCommand to their waiters.
+func reapOnce() {
+	for {
+		// Hold the lock while reaping so that a process started by
+		// StartCommand isn't reaped before its PID has been recorded.
+		mutex.Lock()
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			mutex.Unlock()
+			continue
+		}
+		if err != nil || pid <= 0 {
+			// No more exited children (ECHILD), or none have exited yet.
+			mutex.Unlock()
+			return
+		}
+		ch, ok := pids[pid]
+		delete(pids, pid)
+		mutex.Unlock()
+
+		if ok {
+			ch <- status
+		} else {
+			logger.Debugf("Reaped PID %d which exited with code %d", pid, exitCode(status))
+		}
+	}
+}
+
+// StartCommand starts the command, like cmd.Start.
+func StartCommand(cmd *exec.Cmd) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	err := cmd.Start()
+	if err != nil || !running {
+		return err
+	}
+	pids[cmd.Process.Pid] = make(chan syscall.WaitStatus, 1)
+	return nil
+}
+
+// WaitCommand waits for a command started with StartCommand to exit, and
+// returns its exit code, or 128+signal if it was terminated by a signal. An
+// error is only returned if the command could not be waited for.
+//
+// Like cmd.Wait, it waits for any I/O copying to complete and releases the
+// command's resources, including the goroutine started by
+// exec.CommandContext, which won't try to kill the process once it has
+// been waited for.
+func WaitCommand(cmd *exec.Cmd) (int, error) {
+	mutex.Lock()
+	ch, ok := pids[cmd.Process.Pid]
+	mutex.Unlock()
+
+	if !ok {
+		err := cmd.Wait()
+		if _, isExitErr := err.(*exec.ExitError); err != nil && !isExitErr {
+			return -1, err
+		}
+		return processExitCode(cmd.ProcessState), nil
+	}
+	status := <-ch
+
+	// The process has already been reaped, so the wait itself fails, but
+	// cmd.Wait still marks the process as done and finishes the cleanup.
+	cmd.Wait()
+	return exitCode(status), nil
+}
+
+// ExitError is returned by CommandOutput, CommandCombinedOutput and
+// CommandWait when the command exits with a non-zero exit code.
+type ExitError struct {
+	exitCode int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.exitCode)
+}
+
+// ExitCode returns the command's exit code, or 128+signal if it was
+// terminated by a signal.
+func (e *ExitError) ExitCode() int {
+	return e.exitCode
+}
+
+// CommandOutput runs the command and returns its standard output, like
+// cmd.Output.
+func CommandOutput(cmd *exec.Cmd) ([]byte, error) {
+	if cmd.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := runCommand(cmd)
+	return stdout.Bytes(), err
+}
+
+// CommandCombinedOutput runs the command and returns its combined standard
+// output and standard error, like cmd.CombinedOutput.
+func CommandCombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	if cmd.Stdout != nil {
+		return nil, errors.New("exec: Stdout already set")
+	}
+	if cmd.Stderr != nil {
+		return nil, errors.New("exec: Stderr already set")
+	}
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := runCommand(cmd)
+	return output.Bytes(), err
+}
+
+func runCommand(cmd *exec.Cmd) error {
+	err := StartCommand(cmd)
+	if err != nil {
+		return err
+	}
+	return CommandWait(cmd)
+}
+
+// CommandWait waits for a command started with StartCommand, like cmd.Wait,
+// returning an *ExitError if it exits with a non-zero exit code.
+func CommandWait(cmd *exec.Cmd) error {
+	exitCode, err := WaitCommand(cmd)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return &ExitError{exitCode: exitCode}
+	}
+	return nil
+}
+
+// WaitProcess waits for the child process with the given PID to exit, and
+// returns its exit code like WaitCommand. It is used for child processes
+// that were not started by this process, such as services inherited across
+// an exec.
+func WaitProcess(pid int) (int, error) {
+	mutex.Lock()
+	if !running {
+		mutex.Unlock()
+		// FindProcess always succeeds on Unix.
+		process, _ := os.FindProcess(pid)
+		processState, err := process.Wait()
+		if err != nil {
+			return -1, err
+		}
+		return processExitCode(processState), nil
+	}
+	ch := make(chan syscall.WaitStatus, 1)
+	pids[pid] = ch
+	mutex.Unlock()
+
+	// The process may have been reaped before its PID was recorded.
+	if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+		mutex.Lock()
+		_, pending := pids[pid]
+		delete(pids, pid)
+		mutex.Unlock()
+		if pending {
+			return -1, fmt.Errorf("process %d not found", pid)
+		}
+		// Reaped since it was recorded, so the status is in the channel.
+	}
+	return exitCode(<-ch), nil
+}
+
+func processExitCode(processState *os.ProcessState) int {
+	status, ok := processState.Sys().(syscall.WaitStatus)
+	if ok {
+		return exitCode(status)
+	}
+	return processState.ExitCode()
+}
+
+func exitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package reaper_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/reaper"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type reaperSuite struct{}
+
+var _ = Suite(&reaperSuite{})
+
+func (s *reaperSuite) TestWaitCommandNotStarted(c *C) {
+	cmd := exec.Command("/bin/sh", "-c", "exit 3")
+	err := reaper.StartCommand(cmd)
+	c.Assert(err, IsNil)
+	exitCode, err := reaper.WaitCommand(cmd)
+	c.Assert(err, IsNil)
+	c.Check(exitCode, Equals, 3)
+}
+
+func (s *reaperSuite) TestWaitCommand(c *C) {
+	err := reaper.Start()
+	c.Assert(err, IsNil)
+	defer reaper.Stop()
+
+	cmd := exec.Command("/bin/sh", "-c", "exit 3")
+	err = reaper.StartCommand(cmd)
+	c.Assert(err, IsNil)
+	exitCode, err := reaper.WaitCommand(cmd)
+	c.Assert(err, IsNil)
+	c.Check(exitCode, Equals, 3)
+
+	cmd = exec.Command("/bin/sh", "-c", "kill -TERM $$")
+	err = reaper.StartCommand(cmd)
+	c.Assert(err, IsNil)
+	exitCode, err = reaper.WaitCommand(cmd)
+	c.Assert(err, IsNil)
+	c.Check(exitCode, Equals, 128+int(unix.SIGTERM))
+}
+
+func (s *reaperSuite) TestWaitCommandCopiesOutput(c *C) {
+	err := reaper.Start()
+	c.Assert(err, IsNil)
+	defer reaper.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", "echo foo; echo bar >&2")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = reaper.StartCommand(cmd)
+	c.Assert(err, IsNil)
+	exitCode, err := reaper.WaitCommand(cmd)
+	c.Assert(err, IsNil)
+	c.Check(exitCode, Equals, 0)
+	c.Check(stdout.String(), Equals, "foo\n")
+	c.Check(stderr.String(), Equals, "bar\n")
+}
+
+func (s *reaperSuite) TestCommandOutput(c *C) {
+	err := reaper.Start()
+	c.Assert(err, IsNil)
+	defer reaper.Stop()
+
+	output, err := reaper.CommandOutput(exec.Command("/bin/sh", "-c", "echo foo; echo bar >&2"))
+	c.Assert(err, IsNil)
+	c.Check(string(output), Equals, "foo\n")
+
+	output, err = reaper.CommandCombinedOutput(exec.Command("/bin/sh", "-c", "echo foo; echo bar >&2; exit 4"))
+	c.Check(string(output), Equals, "foo\nbar\n")
+	c.Assert(err, ErrorMatches, "exit status 4")
+	exitErr, ok := err.(*reaper.ExitError)
+	c.Assert(ok, Equals, true)
+	c.Check(exitErr.ExitCode(), Equals, 4)
+}
+
+func (s *reaperSuite) TestWaitProcess(c *C) {
+	err := reaper.Start()
+	c.Assert(err, IsNil)
+	defer reaper.Stop()
+
+	// Simulate a process started elsewhere (like one inherited across exec).
+	cmd := exec.Command("/bin/sh", "-c", "sleep 0.1; exit 5")
+	err = cmd.Start()
+	c.Assert(err, IsNil)
+	exitCode, err := reaper.WaitProcess(cmd.Process.Pid)
+	c.Assert(err, IsNil)
+	c.Check(exitCode, Equals, 5)
+}
+
+func (s *reaperSuite) TestReapOrphans(c *C) {
+	// Become a subreaper so that orphaned processes are re-parented to the
+	// test process, as they would be to Pebble running as PID 1.
+	err := unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0)
+	c.Assert(err, IsNil)
+	defer unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 0, 0, 0, 0)
+
+	err = reaper.Start()
+	c.Assert(err, IsNil)
+	defer reaper.Stop()
+
+	cmd := exec.Command("/bin/sh", "-c", "sleep 0.1 & echo $!")
+	pipeReader, pipeWriter, err := os.Pipe()
+	c.Assert(err, IsNil)
+	cmd.Stdout = pipeWriter
+	err = reaper.StartCommand(cmd)
+	pipeWriter.Close()
+	c.Assert(err, IsNil)
+	exitCode, err := reaper.WaitCommand(cmd)
+	c.Assert(err, IsNil)
+	c.Check(exitCode, Equals, 0)
+	data, err := ioutil.ReadAll(pipeReader)
+	pipeReader.Close()
+	c.Assert(err, IsNil)
+	orphan, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	c.Assert(err, IsNil)
+
+	// The orphaned sleep process is reaped once it exits, rather than being
+	// left as a zombie.
+	for i := 0; ; i++ {
+		stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", orphan))
+		if os.IsNotExist(err) {
+			break
+		}
+		c.Assert(err, IsNil)
+		if i >= 100 {
+			c.Fatalf("orphan not reaped: %s", stat)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sandbox
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+var (
+	appArmorEnabledPath = "/sys/module/apparmor/parameters/enabled"
+	appArmorExecPath    = "/proc/thread-self/attr/exec"
+)
+
+// checkAppArmor returns an error if AppArmor isn't enabled, as then the
+// profile can't be applied.
+func checkAppArmor(profile string) error {
+	data, err := ioutil.ReadFile(appArmorEnabledPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot check whether AppArmor is enabled: %w", err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(data), []byte("Y")) {
+		return fmt.Errorf("cannot use AppArmor profile %q: AppArmor is not enabled", profile)
+	}
+	return nil
+}
+
+// changeAppArmorProfileOnExec makes the current thread change to the given
+// AppArmor profile when it next executes a command (like aa_change_onexec).
+// The caller must be locked to its OS thread, and execute the command from
+// that thread.
+func changeAppArmorProfileOnExec(profile string) error {
+	f, err := os.OpenFile(appArmorExecPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte("exec " + profile))
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sandbox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// capabilities maps capability names, as in capabilities(7) but lowercase
+// and without the "CAP_" prefix, to their numbers.
+var capabilities = map[string]uintptr{
+	"chown":              unix.CAP_CHOWN,
+	"dac_override":       unix.CAP_DAC_OVERRIDE,
+	"dac_read_search":    unix.CAP_DAC_READ_SEARCH,
+	"fowner":             unix.CAP_FOWNER,
+	"fsetid":             unix.CAP_FSETID,
+	"kill":               unix.CAP_KILL,
+	"setgid":             unix.CAP_SETGID,
+	"setuid":             unix.CAP_SETUID,
+	"setpcap":            unix.CAP_SETPCAP,
+	"linux_immutable":    unix.CAP_LINUX_IMMUTABLE,
+	"net_bind_service":   unix.CAP_NET_BIND_SERVICE,
+	"net_broadcast":      unix.CAP_NET_BROADCAST,
+	"net_admin":          unix.CAP_NET_ADMIN,
+	"net_raw":            unix.CAP_NET_RAW,
+	"ipc_lock":           unix.CAP_IPC_LOCK,
+	"ipc_owner":          unix.CAP_IPC_OWNER,
+	"sys_module":         unix.CAP_SYS_MODULE,
+	"sys_rawio":          unix.CAP_SYS_RAWIO,
+	"sys_chroot":         unix.CAP_SYS_CHROOT,
+	"sys_ptrace":         unix.CAP_SYS_PTRACE,
+	"sys_pacct":          unix.CAP_SYS_PACCT,
+	"sys_admin":          unix.CAP_SYS_ADMIN,
+	"sys_boot":           unix.CAP_SYS_BOOT,
+	"sys_nice":           unix.CAP_SYS_NICE,
+	"sys_resource":       unix.CAP_SYS_RESOURCE,
+	"sys_time":           unix.CAP_SYS_TIME,
+	"sys_tty_config":     unix.CAP_SYS_TTY_CONFIG,
+	"mknod":              unix.CAP_MKNOD,
+	"lease":              unix.CAP_LEASE,
+	"audit_write":        unix.CAP_AUDIT_WRITE,
+	"audit_control":      unix.CAP_AUDIT_CONTROL,
+	"setfcap":            unix.CAP_SETFCAP,
+	"mac_override":       unix.CAP_MAC_OVERRIDE,
+	"mac_admin":          unix.CAP_MAC_ADMIN,
+	"syslog":             unix.CAP_SYSLOG,
+	"wake_alarm":         unix.CAP_WAKE_ALARM,
+	"block_suspend":      unix.CAP_BLOCK_SUSPEND,
+	"audit_read":         unix.CAP_AUDIT_READ,
+	"perfmon":            unix.CAP_PERFMON,
+	"bpf":                unix.CAP_BPF,
+	"checkpoint_restore": unix.CAP_CHECKPOINT_RESTORE,
+}
+
+// ParseCapability returns the number of the named capability, which may be
+// given in any case and with or without the "cap_" prefix, for example
+// "net_bind_service" or "CAP_NET_BIND_SERVICE".
+func ParseCapability(name string) (uintptr, error) {
+	normalized := strings.TrimPrefix(strings.ToLower(name), "cap_")
+	capability, ok := capabilities[normalized]
+	if !ok {
+		return 0, fmt.Errorf("unknown capability %q", name)
+	}
+	return capability, nil
+}
+
+const linuxCapabilityVersion3 = 0x20080522
+
+var capLastCapPath = "/proc/sys/kernel/cap_last_cap"
+
+// lastCapability returns the highest capability the kernel supports.
+func lastCapability() uintptr {
+	data, err := ioutil.ReadFile(capLastCapPath)
+	if err == nil {
+		if last, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			return uintptr(last)
+		}
+	}
+	return unix.CAP_LAST_CAP
+}
+
+// capabilitySet is a set of capabilities, in the layout of the kernel's
+// capability masks.
+type capabilitySet [2]uint32
+
+func parseCapabilities(names []string) (capabilitySet, error) {
+	var set capabilitySet
+	for _, name := range names {
+		capability, err := ParseCapability(name)
+		if err != nil {
+			return set, err
+		}
+		set[capability/32] |= 1 << (capability % 32)
+	}
+	return set, nil
+}
+
+func (set capabilitySet) contains(capability uintptr) bool {
+	return set[capability/32]&(1<<(capability%32)) != 0
+}
+
+// dropBoundingCapabilities drops all capabilities but the given ones from
+// the bounding set of the current thread, so that they can never be
+// regained, even by executing setuid binaries. This requires CAP_SETPCAP.
+func dropBoundingCapabilities(keep capabilitySet) error {
+	last := lastCapability()
+	for capability := uintptr(0); capability <= last; capability++ {
+		if keep.contains(capability) {
+			continue
+		}
+		err := unix.Prctl(unix.PR_CAPBSET_DROP, capability, 0, 0, 0)
+		if err != nil {
+			return fmt.Errorf("cannot drop capability %d from bounding set: %v", capability, err)
+		}
+	}
+	return nil
+}
+
+// raiseAmbientCapabilities limits the current thread's capabilities to the
+// given ones, and raises those in the ambient set so that they're kept when
+// a command is executed, even as a non-root user.
+func raiseAmbientCapabilities(keep capabilitySet) error {
+	// Capabilities must be inheritable to be raised in the ambient set.
+	header := unix.CapUserHeader{Version: linuxCapabilityVersion3}
+	var data [2]unix.CapUserData
+	if err := unix.Capget(&header, &data[0]); err != nil {
+		return fmt.Errorf("cannot get capabilities: %v", err)
+	}
+	var permitted capabilitySet
+	for i := range data {
+		data[i].Permitted &= keep[i]
+		data[i].Effective = data[i].Permitted
+		data[i].Inheritable = data[i].Permitted
+		permitted[i] = data[i].Permitted
+	}
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return fmt.Errorf("cannot set capabilities: %v", err)
+	}
+	last := lastCapability()
+	for capability := uintptr(0); capability <= last; capability++ {
+		if !permitted.contains(capability) {
+			continue
+		}
+		err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, capability, 0, 0)
+		if err != nil {
+			return fmt.Errorf("cannot raise capability %d in ambient set: %v", capability, err)
+		}
+	}
+	return nil
+}
+
+// switchUser switches the current thread (which must be locked, and about to
+// execute the command) to the given user and groups. If keepCaps is true, it
+// keeps its permitted capabilities.
+//
+// The system calls are made directly, rather than with syscall.Setuid and
+// friends, as those return EOPNOTSUPP on Linux before Go 1.16, and would
+// otherwise change all the threads of the process.
+func switchUser(cred *syscall.Credential, keepCaps bool) error {
+	if keepCaps {
+		err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0)
+		if err != nil {
+			return fmt.Errorf("cannot keep capabilities: %v", err)
+		}
+	}
+	if !cred.NoSetGroups {
+		var groups unsafe.Pointer
+		if len(cred.Groups) > 0 {
+			groups = unsafe.Pointer(&cred.Groups[0])
+		}
+		_, _, errno := unix.RawSyscall(sysSetgroups, uintptr(len(cred.Groups)), uintptr(groups), 0)
+		if errno != 0 {
+			return fmt.Errorf("cannot set groups: %v", errno)
+		}
+	}
+	gid := uintptr(cred.Gid)
+	if _, _, errno := unix.RawSyscall(sysSetresgid, gid, gid, gid); errno != 0 {
+		return fmt.Errorf("cannot set group ID: %v", errno)
+	}
+	uid := uintptr(cred.Uid)
+	if _, _, errno := unix.RawSyscall(sysSetresuid, uid, uid, uid); errno != 0 {
+		return fmt.Errorf("cannot set user ID: %v", errno)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sandbox
+
+var (
+	LoadSeccompProfile = loadSeccompProfile
+	NativeEndian       = nativeEndian
+)
+
+func FakeAppArmorPaths(enabledPath, execPath string) (restore func()) {
+	oldEnabledPath := appArmorEnabledPath
+	oldExecPath := appArmorExecPath
+	appArmorEnabledPath = enabledPath
+	appArmorExecPath = execPath
+	return func() {
+		appArmorEnabledPath = oldEnabledPath
+		appArmorExecPath = oldExecPath
+	}
+}
+
+func FakeNetnsDir(dir string) (restore func()) {
+	old := netnsDir
+	netnsDir = dir
+	return func() {
+		netnsDir = old
+	}
+}
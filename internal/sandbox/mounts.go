@@ -0,0 +1,72 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// Mount is a bind mount of a host path, set up in the command's private
+// mount namespace.
+type Mount struct {
+	// Source is the absolute path of the file or directory mounted.
+	Source string `json:"source"`
+
+	// Target is the absolute path it's mounted on, which must exist.
+	Target string `json:"target"`
+
+	// ReadOnly makes the mount read-only.
+	ReadOnly bool `json:"read-only,omitempty"`
+}
+
+func checkMounts(mounts []Mount) error {
+	for _, mount := range mounts {
+		if !filepath.IsAbs(mount.Source) || !filepath.IsAbs(mount.Target) {
+			return fmt.Errorf("cannot mount %q on %q: paths must be absolute", mount.Source, mount.Target)
+		}
+		if _, err := os.Stat(mount.Source); err != nil {
+			return fmt.Errorf("cannot mount %q: %w", mount.Source, err)
+		}
+	}
+	return nil
+}
+
+// setupMounts sets up the bind mounts, which must be done in a new mount
+// namespace. So that the mounts aren't propagated back to the host's mount
+// namespace, all mounts are made private first.
+func setupMounts(mounts []Mount) error {
+	err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, "")
+	if err != nil {
+		return fmt.Errorf("cannot make mounts private: %v", err)
+	}
+	for _, mount := range mounts {
+		err := unix.Mount(mount.Source, mount.Target, "", unix.MS_BIND|unix.MS_REC, "")
+		if err != nil {
+			return fmt.Errorf("cannot mount %q on %q: %v", mount.Source, mount.Target, err)
+		}
+		if mount.ReadOnly {
+			// Bind mounts can only be made read-only by remounting.
+			err := unix.Mount("", mount.Target, "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY, "")
+			if err != nil {
+				return fmt.Errorf("cannot make mount on %q read-only: %v", mount.Target, err)
+			}
+		}
+	}
+	return nil
+}
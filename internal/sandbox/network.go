@@ -0,0 +1,76 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// NetworkHost runs the command in the host's network namespace.
+	NetworkHost = "host"
+
+	// NetworkNone runs the command in a new network namespace with no
+	// network interfaces configured (not even loopback).
+	NetworkNone = "none"
+
+	// networkNamespacePrefix prefixes the name of an existing network
+	// namespace, as created by "ip netns add", that the command runs in.
+	networkNamespacePrefix = "netns:"
+)
+
+// netnsDir is where named network namespaces are mounted by iproute2.
+var netnsDir = "/run/netns"
+
+// CheckNetwork checks the syntax of a network setting, which is "host",
+// "none", or "netns:<name>" to use the network namespace with that name.
+func CheckNetwork(network string) error {
+	switch network {
+	case "", NetworkHost, NetworkNone:
+		return nil
+	}
+	name := strings.TrimPrefix(network, networkNamespacePrefix)
+	if name == network || name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+		return fmt.Errorf(`network must be "host", "none", or "netns:<name>", not %q`, network)
+	}
+	return nil
+}
+
+// networkNamespace returns the name of the namespace a network setting
+// refers to, or "" if it's not "netns:<name>".
+func networkNamespace(network string) string {
+	if !strings.HasPrefix(network, networkNamespacePrefix) {
+		return ""
+	}
+	return network[len(networkNamespacePrefix):]
+}
+
+// joinNetworkNamespace moves the current thread into the network namespace
+// the file at path refers to. This requires CAP_SYS_ADMIN.
+func joinNetworkNamespace(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open network namespace: %v", err)
+	}
+	defer f.Close()
+	if err := unix.Setns(int(f.Fd()), unix.CLONE_NEWNET); err != nil {
+		return fmt.Errorf("cannot join network namespace %q: %v", path, err)
+	}
+	return nil
+}
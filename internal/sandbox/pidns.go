@@ -0,0 +1,103 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// forwardedSignals are the signals the init process passes on to the
+// command. The init process of a PID namespace is the only process that
+// receives signals sent to the service's process.
+var forwardedSignals = []os.Signal{
+	syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM,
+	syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGCONT, syscall.SIGWINCH,
+}
+
+// runInit runs as the init process (PID 1) of a new PID namespace: it
+// mounts a /proc for the namespace, starts the helper again to confine and
+// execute the command, forwards signals to it, and reaps orphaned
+// processes. When the command exits, runInit exits with its status, and
+// the kernel kills any processes left in the namespace.
+//
+// runInit only returns if the command can't be started.
+func runInit(req *helperRequest, env []string) error {
+	// Make sure the new /proc isn't propagated to the host.
+	err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, "")
+	if err != nil {
+		return fmt.Errorf("cannot make mounts private: %v", err)
+	}
+	err = unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+	if err != nil {
+		return fmt.Errorf("cannot mount /proc: %v", err)
+	}
+
+	childReq := *req
+	childReq.Config.PIDNamespace = false
+	data, err := json.Marshal(&childReq)
+	if err != nil {
+		return err
+	}
+
+	// Forward signals from the time the command is started.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, forwardedSignals...)
+
+	// The command runs in its own process group so that signals sent to
+	// the service's process group only reach it once, through init.
+	pid, err := syscall.ForkExec(selfExe, os.Args, &syscall.ProcAttr{
+		Env:   append(env[:len(env):len(env)], helperEnvVar+"="+string(data)),
+		Files: []uintptr{0, 1, 2},
+		Sys:   &syscall.SysProcAttr{Setpgid: true},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot start command: %v", err)
+	}
+
+	go func() {
+		for sig := range sigs {
+			syscall.Kill(pid, sig.(syscall.Signal))
+		}
+	}()
+
+	for {
+		var status syscall.WaitStatus
+		wpid, err := syscall.Wait4(-1, &status, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("cannot wait for command: %v", err)
+		}
+		if wpid != pid {
+			// An orphan reparented to init.
+			continue
+		}
+		switch {
+		case status.Exited():
+			os.Exit(status.ExitStatus())
+		case status.Signaled():
+			// As init can't be killed by its own signals, exit with
+			// the status a shell would report.
+			os.Exit(128 + int(status.Signal()))
+		}
+	}
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package sandbox confines the processes Pebble starts, for services that
+// need sandboxing when there's no container runtime to do it.
+//
+// Some confinement, such as a seccomp filter, must be set up by the process
+// itself between fork and exec, which Go's os/exec can't do. So Command
+// makes the command run the current executable first, as a helper: when
+// this package is initialized in the helper process, it sets up the
+// confinement and then executes the real command in its place. Any binary
+// that starts sandboxed commands must import this package (which it will,
+// as it needs Command) so that it can act as the helper.
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// Config describes how a command is confined.
+type Config struct {
+	// Seccomp is the name of a built-in seccomp profile, or the absolute
+	// path to a file containing a compiled seccomp BPF program.
+	Seccomp string `json:"seccomp,omitempty"`
+
+	// AppArmorProfile is the name of an AppArmor profile, already loaded
+	// into the kernel, that the command is confined by.
+	AppArmorProfile string `json:"apparmor-profile,omitempty"`
+
+	// Capabilities, if not empty, lists the only capabilities (such as
+	// "net_bind_service") the command may have: all others are dropped
+	// from its bounding set. These are raised in its ambient set, so the
+	// command keeps them even when running as a non-root user.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// Mounts, if not empty, are bind mounts set up in a private mount
+	// namespace the command runs in.
+	Mounts []Mount `json:"mounts,omitempty"`
+
+	// Network is the network namespace the command runs in: "host" (or
+	// empty) for the host's, "none" for a new one with no network, or
+	// "netns:<name>" for an existing named one.
+	Network string `json:"network,omitempty"`
+
+	// PIDNamespace runs the command in a new PID namespace, with the
+	// helper as its init process. The command can't see or signal
+	// processes outside the namespace, and when it exits, all processes
+	// it has started are killed.
+	PIDNamespace bool `json:"pid-namespace,omitempty"`
+
+	// Umask, if not nil, is the file mode creation mask the command runs
+	// with, instead of inheriting the daemon's.
+	Umask *int `json:"umask,omitempty"`
+}
+
+// IsZero reports whether config doesn't confine the command at all.
+func (config *Config) IsZero() bool {
+	return config.Seccomp == "" && config.AppArmorProfile == "" &&
+		len(config.Capabilities) == 0 && len(config.Mounts) == 0 &&
+		(config.Network == "" || config.Network == NetworkHost) &&
+		!config.PIDNamespace && config.Umask == nil
+}
+
+// needsPrivileges reports whether the helper needs to run with the
+// privileges of the daemon (rather than as the command's user) to set up
+// the confinement.
+func (config *Config) needsPrivileges() bool {
+	return len(config.Capabilities) > 0 || len(config.Mounts) > 0 ||
+		networkNamespace(config.Network) != "" || config.PIDNamespace
+}
+
+// helperEnvVar is the environment variable the helper's instructions are
+// passed in (and its presence is what makes a process act as the helper).
+const helperEnvVar = "PEBBLE_SANDBOX_HELPER"
+
+// helperExitCode is the exit code of the helper process if it can't
+// confine or execute the command.
+const helperExitCode = 126
+
+type helperRequest struct {
+	Config     Config              `json:"config"`
+	Path       string              `json:"path"`
+	Credential *syscall.Credential `json:"credential,omitempty"`
+	NetnsPath  string              `json:"netns-path,omitempty"`
+}
+
+// selfExe is the path used to execute the helper.
+var selfExe = "/proc/self/exe"
+
+// Command modifies cmd, which must not have been started yet, so that it
+// runs confined as described by config. The configuration is checked (for
+// example, that a seccomp profile exists) before cmd is modified, so that
+// errors are reported when starting the command rather than by the helper.
+func Command(cmd *exec.Cmd, config *Config) error {
+	if config.IsZero() {
+		return nil
+	}
+	if config.Seccomp != "" {
+		if _, err := loadSeccompProfile(config.Seccomp); err != nil {
+			return err
+		}
+	}
+	if config.AppArmorProfile != "" {
+		if err := checkAppArmor(config.AppArmorProfile); err != nil {
+			return err
+		}
+	}
+	if _, err := parseCapabilities(config.Capabilities); err != nil {
+		return err
+	}
+	if err := checkMounts(config.Mounts); err != nil {
+		return err
+	}
+	if err := CheckNetwork(config.Network); err != nil {
+		return err
+	}
+	var netnsPath string
+	if name := networkNamespace(config.Network); name != "" {
+		netnsPath = filepath.Join(netnsDir, name)
+		if _, err := os.Stat(netnsPath); err != nil {
+			return fmt.Errorf("cannot find network namespace %q: %w", name, err)
+		}
+	}
+	if cmd.Err != nil {
+		// Let Start report the lookup error as it normally would.
+		return nil
+	}
+
+	req := &helperRequest{Config: *config, Path: cmd.Path, NetnsPath: netnsPath}
+	if config.needsPrivileges() && cmd.SysProcAttr != nil && cmd.SysProcAttr.Credential != nil {
+		// The helper must switch to the command's user itself, once it
+		// has done what needs privileges.
+		req.Credential = cmd.SysProcAttr.Credential
+		cmd.SysProcAttr.Credential = nil
+	}
+	if len(config.Mounts) > 0 {
+		setCloneflags(cmd, syscall.CLONE_NEWNS)
+	}
+	if config.Network == NetworkNone {
+		setCloneflags(cmd, syscall.CLONE_NEWNET)
+	}
+	if config.PIDNamespace {
+		// A new mount namespace is needed to mount the namespace's /proc.
+		setCloneflags(cmd, syscall.CLONE_NEWPID|syscall.CLONE_NEWNS)
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env[:len(env):len(env)], helperEnvVar+"="+string(data))
+	cmd.Path = selfExe
+	return nil
+}
+
+func setCloneflags(cmd *exec.Cmd, flags uintptr) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= flags
+}
+
+func init() {
+	data, ok := os.LookupEnv(helperEnvVar)
+	if !ok {
+		return
+	}
+	err := runHelper(data)
+	fmt.Fprintf(os.Stderr, "cannot run sandboxed command: %v\n", err)
+	os.Exit(helperExitCode)
+}
+
+// runHelper confines the current process as requested and then executes
+// the command in its place. It only returns if that fails.
+func runHelper(data string) error {
+	var req helperRequest
+	if err := json.Unmarshal([]byte(data), &req); err != nil {
+		return fmt.Errorf("invalid %s: %v", helperEnvVar, err)
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, helperEnvVar+"=") {
+			env = append(env, kv)
+		}
+	}
+
+	// The mask is inherited by the command (and by the PID namespace's
+	// init process, for it to pass on).
+	if req.Config.Umask != nil {
+		syscall.Umask(*req.Config.Umask)
+	}
+
+	if req.Config.PIDNamespace {
+		return runInit(&req, env)
+	}
+
+	// Some confinement only applies to the thread that executes the
+	// command, so keep to the one thread.
+	runtime.LockOSThread()
+
+	if len(req.Config.Mounts) > 0 {
+		if err := setupMounts(req.Config.Mounts); err != nil {
+			return err
+		}
+	}
+
+	if req.NetnsPath != "" {
+		if err := joinNetworkNamespace(req.NetnsPath); err != nil {
+			return err
+		}
+	}
+
+	if req.Config.AppArmorProfile != "" {
+		err := changeAppArmorProfileOnExec(req.Config.AppArmorProfile)
+		if err != nil {
+			return fmt.Errorf("cannot change to AppArmor profile %q: %v", req.Config.AppArmorProfile, err)
+		}
+	}
+
+	keepCaps, err := parseCapabilities(req.Config.Capabilities)
+	if err != nil {
+		return err
+	}
+	if len(req.Config.Capabilities) > 0 {
+		if err := dropBoundingCapabilities(keepCaps); err != nil {
+			return err
+		}
+	}
+	if req.Credential != nil {
+		if err := switchUser(req.Credential, len(req.Config.Capabilities) > 0); err != nil {
+			return err
+		}
+	}
+	if len(req.Config.Capabilities) > 0 {
+		if err := raiseAmbientCapabilities(keepCaps); err != nil {
+			return err
+		}
+	}
+
+	// Confinement that restricts what the helper itself can do must be
+	// set up last.
+	if req.Config.Seccomp != "" {
+		filter, err := loadSeccompProfile(req.Config.Seccomp)
+		if err != nil {
+			return err
+		}
+		if err := applySeccompFilter(filter); err != nil {
+			return fmt.Errorf("cannot apply seccomp profile %q: %v", req.Config.Seccomp, err)
+		}
+	}
+
+	return syscall.Exec(req.Path, os.Args, env)
+}
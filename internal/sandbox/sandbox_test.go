@@ -0,0 +1,336 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sandbox_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/sandbox"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type sandboxSuite struct{}
+
+var _ = Suite(&sandboxSuite{})
+
+func (s *sandboxSuite) TestCommandNoConfig(c *C) {
+	cmd := exec.Command("true")
+	path := cmd.Path
+	err := sandbox.Command(cmd, &sandbox.Config{})
+	c.Assert(err, IsNil)
+	c.Check(cmd.Path, Equals, path)
+	c.Check(cmd.Env, IsNil)
+}
+
+func (s *sandboxSuite) TestSeccompDefault(c *C) {
+	// The command is run through the test binary, which acts as the helper.
+	cmd := exec.Command("cat", "/proc/self/status")
+	err := sandbox.Command(cmd, &sandbox.Config{Seccomp: "default"})
+	c.Assert(err, IsNil)
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Check(string(output), Matches, `(?s).*\nSeccomp:\s+2\n.*`)
+	c.Check(string(output), Matches, `(?s).*\nNoNewPrivs:\s+1\n.*`)
+
+	// Denied system calls fail with EPERM (rather than ENOENT).
+	cmd = exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), "SANDBOX_TEST_SWAPOFF=1")
+	err = sandbox.Command(cmd, &sandbox.Config{Seccomp: "default"})
+	c.Assert(err, IsNil)
+	output, err = cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Check(string(output), Equals, "operation not permitted\n")
+}
+
+func init() {
+	// When run with this variable set, the test binary tries a system call
+	// the default seccomp profile denies, instead of running the tests.
+	if os.Getenv("SANDBOX_TEST_SWAPOFF") == "" {
+		return
+	}
+	path, _ := unix.BytePtrFromString("/nonexistent")
+	_, _, errno := unix.Syscall(unix.SYS_SWAPOFF, uintptr(unsafe.Pointer(path)), 0, 0)
+	fmt.Println(errno.Error())
+	os.Exit(0)
+}
+
+func (s *sandboxSuite) TestUmask(c *C) {
+	umask := 0027
+	cmd := exec.Command("/bin/sh", "-c", "umask")
+	err := sandbox.Command(cmd, &sandbox.Config{Umask: &umask})
+	c.Assert(err, IsNil)
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Check(string(output), Equals, "0027\n")
+}
+
+func (s *sandboxSuite) TestSeccompFile(c *C) {
+	filter, err := sandbox.LoadSeccompProfile("default")
+	c.Assert(err, IsNil)
+	var buf bytes.Buffer
+	c.Assert(binary.Write(&buf, sandbox.NativeEndian, filter), IsNil)
+	path := filepath.Join(c.MkDir(), "profile.bpf")
+	c.Assert(ioutil.WriteFile(path, buf.Bytes(), 0644), IsNil)
+
+	cmd := exec.Command("cat", "/proc/self/status")
+	err = sandbox.Command(cmd, &sandbox.Config{Seccomp: path})
+	c.Assert(err, IsNil)
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Check(string(output), Matches, `(?s).*\nSeccomp:\s+2\n.*`)
+}
+
+func (s *sandboxSuite) TestSeccompErrors(c *C) {
+	cmd := exec.Command("true")
+	err := sandbox.Command(cmd, &sandbox.Config{Seccomp: "foo"})
+	c.Check(err, ErrorMatches, `unknown seccomp profile "foo"`)
+
+	dir := c.MkDir()
+	err = sandbox.Command(cmd, &sandbox.Config{Seccomp: filepath.Join(dir, "missing")})
+	c.Check(err, ErrorMatches, `cannot read seccomp profile: .* no such file or directory`)
+
+	path := filepath.Join(dir, "bad.bpf")
+	c.Assert(ioutil.WriteFile(path, []byte("abc"), 0644), IsNil)
+	err = sandbox.Command(cmd, &sandbox.Config{Seccomp: path})
+	c.Check(err, ErrorMatches, `invalid seccomp profile ".*": size 3 is not a valid BPF program size`)
+
+	c.Check(cmd.Path, Not(Equals), "/proc/self/exe")
+}
+
+func (s *sandboxSuite) TestAppArmorNotEnabled(c *C) {
+	dir := c.MkDir()
+	restore := sandbox.FakeAppArmorPaths(filepath.Join(dir, "enabled"), filepath.Join(dir, "exec"))
+	defer restore()
+
+	cmd := exec.Command("true")
+	err := sandbox.Command(cmd, &sandbox.Config{AppArmorProfile: "foo"})
+	c.Check(err, ErrorMatches, `cannot use AppArmor profile "foo": AppArmor is not enabled`)
+
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "enabled"), []byte("N\n"), 0644), IsNil)
+	err = sandbox.Command(cmd, &sandbox.Config{AppArmorProfile: "foo"})
+	c.Check(err, ErrorMatches, `cannot use AppArmor profile "foo": AppArmor is not enabled`)
+}
+
+func (s *sandboxSuite) TestAppArmorEnabled(c *C) {
+	dir := c.MkDir()
+	restore := sandbox.FakeAppArmorPaths(filepath.Join(dir, "enabled"), filepath.Join(dir, "exec"))
+	defer restore()
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "enabled"), []byte("Y\n"), 0644), IsNil)
+
+	cmd := exec.Command("true")
+	err := sandbox.Command(cmd, &sandbox.Config{AppArmorProfile: "foo"})
+	c.Assert(err, IsNil)
+	c.Check(cmd.Path, Equals, "/proc/self/exe")
+	c.Check(cmd.Env[len(cmd.Env)-1], Matches, `PEBBLE_SANDBOX_HELPER=.*"apparmor-profile":"foo".*`)
+}
+
+func (s *sandboxSuite) TestCapabilities(c *C) {
+	if os.Getuid() != 0 {
+		c.Skip("requires root to change the bounding set")
+	}
+
+	cmd := exec.Command("cat", "/proc/self/status")
+	err := sandbox.Command(cmd, &sandbox.Config{Capabilities: []string{"net_bind_service", "CAP_KILL"}})
+	c.Assert(err, IsNil)
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Check(string(output), Matches, `(?s).*\nCapEff:\s+0000000000000420\n.*`)
+	c.Check(string(output), Matches, `(?s).*\nCapBnd:\s+0000000000000420\n.*`)
+	c.Check(string(output), Matches, `(?s).*\nCapAmb:\s+0000000000000420\n.*`)
+
+	// A non-root user keeps the capabilities too.
+	cmd = exec.Command("cat", "/proc/self/status")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: 65534, Gid: 65534, Groups: []uint32{100, 65534}}}
+	err = sandbox.Command(cmd, &sandbox.Config{Capabilities: []string{"net_bind_service"}})
+	c.Assert(err, IsNil)
+	c.Check(cmd.SysProcAttr.Credential, IsNil)
+	output, err = cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Check(string(output), Matches, `(?s).*\nUid:\s+65534\s+65534\s+65534\s+65534\n.*`)
+	c.Check(string(output), Matches, `(?s).*\nGid:\s+65534\s+65534\s+65534\s+65534\n.*`)
+	c.Check(string(output), Matches, `(?s).*\nGroups:\s+100 65534\s*\n.*`)
+	c.Check(string(output), Matches, `(?s).*\nCapEff:\s+0000000000000400\n.*`)
+	c.Check(string(output), Matches, `(?s).*\nCapAmb:\s+0000000000000400\n.*`)
+}
+
+func (s *sandboxSuite) TestCapabilitiesErrors(c *C) {
+	cmd := exec.Command("true")
+	err := sandbox.Command(cmd, &sandbox.Config{Capabilities: []string{"net_bind_service", "fly"}})
+	c.Check(err, ErrorMatches, `unknown capability "fly"`)
+}
+
+func (s *sandboxSuite) TestMounts(c *C) {
+	if os.Getuid() != 0 {
+		c.Skip("requires root to create a mount namespace")
+	}
+
+	source := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(source, "file"), []byte("hello"), 0644)
+	c.Assert(err, IsNil)
+	target := c.MkDir()
+
+	cmd := exec.Command("/bin/sh", "-c", "cat "+target+"/file; echo; touch "+target+"/other")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: 0, Gid: 0}}
+	err = sandbox.Command(cmd, &sandbox.Config{Mounts: []sandbox.Mount{{Source: source, Target: target, ReadOnly: true}}})
+	c.Assert(err, IsNil)
+	c.Check(cmd.SysProcAttr.Cloneflags&syscall.CLONE_NEWNS, Not(Equals), uintptr(0))
+	output, err := cmd.CombinedOutput()
+	c.Check(err, NotNil)
+	c.Check(string(output), Matches, `(?s)hello\n.*Read-only file system\n`)
+
+	// The mount is private to the command.
+	_, err = os.Stat(filepath.Join(target, "file"))
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *sandboxSuite) TestMountsErrors(c *C) {
+	cmd := exec.Command("true")
+	err := sandbox.Command(cmd, &sandbox.Config{Mounts: []sandbox.Mount{{Source: "data", Target: "/data"}}})
+	c.Check(err, ErrorMatches, `cannot mount "data" on "/data": paths must be absolute`)
+
+	missing := filepath.Join(c.MkDir(), "missing")
+	err = sandbox.Command(cmd, &sandbox.Config{Mounts: []sandbox.Mount{{Source: missing, Target: "/data"}}})
+	c.Check(err, ErrorMatches, `cannot mount ".*/missing": .* no such file or directory`)
+}
+
+func (s *sandboxSuite) TestNetworkNone(c *C) {
+	if os.Getuid() != 0 {
+		c.Skip("requires root to create a network namespace")
+	}
+
+	cmd := exec.Command("cat", "/proc/net/dev")
+	err := sandbox.Command(cmd, &sandbox.Config{Network: "none"})
+	c.Assert(err, IsNil)
+	c.Check(cmd.SysProcAttr.Cloneflags&syscall.CLONE_NEWNET, Not(Equals), uintptr(0))
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	// Two header lines and the loopback interface.
+	c.Assert(lines, HasLen, 3, Commentf("%s", output))
+	c.Check(lines[2], Matches, `\s*lo:.*`)
+}
+
+func (s *sandboxSuite) TestNetworkNamespace(c *C) {
+	if os.Getuid() != 0 {
+		c.Skip("requires root to create a network namespace")
+	}
+
+	// A process in its own network namespace stands in for one created
+	// with "ip netns add".
+	holder := exec.Command("sleep", "60")
+	holder.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNET}
+	c.Assert(holder.Start(), IsNil)
+	defer func() {
+		holder.Process.Kill()
+		holder.Wait()
+	}()
+	nsPath := fmt.Sprintf("/proc/%d/ns/net", holder.Process.Pid)
+	netns, err := os.Readlink(nsPath)
+	c.Assert(err, IsNil)
+
+	dir := c.MkDir()
+	c.Assert(os.Symlink(nsPath, filepath.Join(dir, "test")), IsNil)
+	restore := sandbox.FakeNetnsDir(dir)
+	defer restore()
+
+	cmd := exec.Command("readlink", "/proc/self/ns/net")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: 65534, Gid: 65534}}
+	err = sandbox.Command(cmd, &sandbox.Config{Network: "netns:test"})
+	c.Assert(err, IsNil)
+	c.Check(cmd.SysProcAttr.Credential, IsNil)
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, IsNil, Commentf("%s", output))
+	c.Check(string(output), Equals, netns+"\n")
+}
+
+func (s *sandboxSuite) TestNetworkErrors(c *C) {
+	restore := sandbox.FakeNetnsDir(c.MkDir())
+	defer restore()
+
+	cmd := exec.Command("true")
+	err := sandbox.Command(cmd, &sandbox.Config{Network: "netns:missing"})
+	c.Check(err, ErrorMatches, `cannot find network namespace "missing": .* no such file or directory`)
+
+	for _, network := range []string{"bridge", "netns:", "netns:a/b", "netns:.."} {
+		err := sandbox.Command(cmd, &sandbox.Config{Network: network})
+		c.Check(err, ErrorMatches, `network must be "host", "none", or "netns:<name>", not ".*"`)
+	}
+	for _, network := range []string{"", "host", "none", "netns:foo"} {
+		c.Check(sandbox.CheckNetwork(network), IsNil)
+	}
+}
+
+func (s *sandboxSuite) TestPIDNamespace(c *C) {
+	if os.Getuid() != 0 {
+		c.Skip("requires root to create a PID namespace")
+	}
+
+	// The command is the only process in the namespace besides init (and
+	// those it starts), and its exit status is passed through.
+	cmd := exec.Command("/bin/sh", "-c", "ls /proc | grep -c '^[0-9]'; exit 3")
+	err := sandbox.Command(cmd, &sandbox.Config{PIDNamespace: true})
+	c.Assert(err, IsNil)
+	c.Check(cmd.SysProcAttr.Cloneflags&syscall.CLONE_NEWPID, Not(Equals), uintptr(0))
+	output, err := cmd.CombinedOutput()
+	c.Assert(err, FitsTypeOf, &exec.ExitError{}, Commentf("%s", output))
+	c.Check(err.(*exec.ExitError).ExitCode(), Equals, 3)
+	// Init, sh, ls, and grep.
+	c.Check(string(output), Equals, "4\n")
+
+	// Signals sent to init are forwarded to the command.
+	cmd = exec.Command("/bin/sh", "-c", "trap 'echo got TERM; exit 0' TERM; echo ready; while true; do sleep 0.1; done")
+	err = sandbox.Command(cmd, &sandbox.Config{PIDNamespace: true})
+	c.Assert(err, IsNil)
+	stdout, err := cmd.StdoutPipe()
+	c.Assert(err, IsNil)
+	c.Assert(cmd.Start(), IsNil)
+	buf := make([]byte, len("ready\n"))
+	_, err = io.ReadFull(stdout, buf)
+	c.Assert(err, IsNil)
+	c.Assert(cmd.Process.Signal(syscall.SIGTERM), IsNil)
+	rest, err := ioutil.ReadAll(stdout)
+	c.Assert(err, IsNil)
+	c.Check(string(rest), Equals, "got TERM\n")
+	c.Check(cmd.Wait(), IsNil)
+}
+
+func (s *sandboxSuite) TestParseCapability(c *C) {
+	for _, name := range []string{"net_bind_service", "NET_BIND_SERVICE", "cap_net_bind_service", "CAP_NET_BIND_SERVICE"} {
+		capability, err := sandbox.ParseCapability(name)
+		c.Check(err, IsNil)
+		c.Check(capability, Equals, uintptr(10))
+	}
+	_, err := sandbox.ParseCapability("cap_")
+	c.Check(err, ErrorMatches, `unknown capability "cap_"`)
+}
+
+func (s *sandboxSuite) TestSeccompProfiles(c *C) {
+	c.Check(sandbox.SeccompProfiles(), DeepEquals, []string{"default"})
+}
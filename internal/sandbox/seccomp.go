@@ -0,0 +1,216 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sandbox
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Constants from linux/seccomp.h and linux/audit.h that aren't in x/sys.
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+
+	seccompRetAllow = 0x7fff0000
+	seccompRetErrno = 0x00050000
+
+	// Offsets into struct seccomp_data.
+	seccompDataNr   = 0
+	seccompDataArch = 4
+
+	// x32 system calls on x86-64 have this bit set in their number.
+	x32SyscallBit = 0x40000000
+)
+
+var auditArches = map[string]uint32{
+	"386":     0x40000003,
+	"amd64":   0xc000003e,
+	"arm":     0x40000028,
+	"arm64":   0xc00000b7,
+	"ppc64le": 0xc0000015,
+	"riscv64": 0xc00000f3,
+	"s390x":   0x80000016,
+}
+
+// seccompProfiles are the built-in seccomp profiles, each listing the system
+// calls it denies (with EPERM); all others are allowed.
+var seccompProfiles = map[string][]uintptr{
+	// The default profile denies system administration calls that no
+	// ordinary service should need, such as loading kernel modules,
+	// mounting filesystems, or setting the clock.
+	"default": {
+		unix.SYS_ACCT,
+		unix.SYS_ADD_KEY,
+		unix.SYS_ADJTIMEX,
+		unix.SYS_BPF,
+		unix.SYS_CLOCK_ADJTIME,
+		unix.SYS_CLOCK_SETTIME,
+		unix.SYS_DELETE_MODULE,
+		unix.SYS_FINIT_MODULE,
+		unix.SYS_FSOPEN,
+		unix.SYS_INIT_MODULE,
+		unix.SYS_KEXEC_LOAD,
+		unix.SYS_KEYCTL,
+		unix.SYS_LOOKUP_DCOOKIE,
+		unix.SYS_MOUNT,
+		unix.SYS_MOVE_MOUNT,
+		unix.SYS_OPEN_BY_HANDLE_AT,
+		unix.SYS_PIVOT_ROOT,
+		unix.SYS_PTRACE,
+		unix.SYS_QUOTACTL,
+		unix.SYS_REBOOT,
+		unix.SYS_REQUEST_KEY,
+		unix.SYS_SETDOMAINNAME,
+		unix.SYS_SETHOSTNAME,
+		unix.SYS_SETTIMEOFDAY,
+		unix.SYS_SWAPOFF,
+		unix.SYS_SWAPON,
+		unix.SYS_SYSLOG,
+		unix.SYS_UMOUNT2,
+		unix.SYS_USERFAULTFD,
+	},
+}
+
+// SeccompProfiles returns the names of the built-in seccomp profiles.
+func SeccompProfiles() []string {
+	names := make([]string, 0, len(seccompProfiles))
+	for name := range seccompProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadSeccompProfile returns the BPF program for the named built-in
+// profile, or read from the file if profile is an absolute path.
+func loadSeccompProfile(profile string) ([]unix.SockFilter, error) {
+	if filepath.IsAbs(profile) {
+		return readSeccompFile(profile)
+	}
+	denied, ok := seccompProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown seccomp profile %q", profile)
+	}
+	return denyListFilter(denied)
+}
+
+// readSeccompFile reads a compiled seccomp BPF program (an array of struct
+// sock_filter in native byte order, as written by libseccomp's
+// seccomp_export_bpf) from the file at path.
+func readSeccompFile(path string) ([]unix.SockFilter, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read seccomp profile: %w", err)
+	}
+	size := int(unsafe.Sizeof(unix.SockFilter{}))
+	if len(data) == 0 || len(data)%size != 0 || len(data)/size > 0xffff {
+		return nil, fmt.Errorf("invalid seccomp profile %q: size %d is not a valid BPF program size", path, len(data))
+	}
+	filter := make([]unix.SockFilter, len(data)/size)
+	err = binary.Read(bytes.NewReader(data), nativeEndian, filter)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seccomp profile %q: %v", path, err)
+	}
+	return filter, nil
+}
+
+var nativeEndian binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// denyListFilter returns a BPF program that makes the given system calls
+// (and any made with a foreign architecture's calling convention) fail with
+// EPERM, and allows all others.
+func denyListFilter(denied []uintptr) ([]unix.SockFilter, error) {
+	arch, ok := auditArches[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("seccomp profiles are not supported on %s", runtime.GOARCH)
+	}
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+
+	var filter []unix.SockFilter
+	// deny is filled in with the jump offsets to the final "deny" return
+	// once the length of the program is known.
+	var deny []int
+	jumpToDeny := func(code uint16, k uint32) {
+		deny = append(deny, len(filter))
+		filter = append(filter, unix.SockFilter{Code: code, K: k})
+	}
+
+	// Load the architecture, and deny calls made with another one.
+	filter = append(filter, stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompDataArch))
+	filter = append(filter, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, K: arch})
+	filter = append(filter, stmt(unix.BPF_RET|unix.BPF_K, seccompRetErrno|uint32(unix.EPERM)))
+
+	// Load the system call number and check it against the list.
+	filter = append(filter, stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompDataNr))
+	if runtime.GOARCH == "amd64" {
+		jumpToDeny(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K, x32SyscallBit)
+	}
+	for _, nr := range denied {
+		jumpToDeny(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr))
+	}
+	filter = append(filter, stmt(unix.BPF_RET|unix.BPF_K, seccompRetAllow))
+	filter = append(filter, stmt(unix.BPF_RET|unix.BPF_K, seccompRetErrno|uint32(unix.EPERM)))
+
+	denyIndex := len(filter) - 1
+	for _, i := range deny {
+		offset := denyIndex - i - 1
+		if offset > 0xff {
+			return nil, fmt.Errorf("internal error: seccomp profile too long")
+		}
+		filter[i].Jt = uint8(offset)
+	}
+	return filter, nil
+}
+
+// applySeccompFilter applies the BPF program to all threads of the current
+// process, and so to the command it executes next. As no_new_privs must be
+// set for an unprivileged process to apply a filter, it's always set.
+func applySeccompFilter(filter []unix.SockFilter) error {
+	err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0)
+	if err != nil {
+		return fmt.Errorf("cannot set no_new_privs: %v", err)
+	}
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	tid, _, errno := unix.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return errno
+	}
+	if tid != 0 {
+		// With TSYNC, the ID of a thread the filter couldn't be applied
+		// to is returned.
+		return fmt.Errorf("cannot apply filter to thread %d", tid)
+	}
+	return nil
+}
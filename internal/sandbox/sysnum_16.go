@@ -0,0 +1,27 @@
+//go:build arm || 386
+// +build arm 386
+
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package sandbox
+
+import "golang.org/x/sys/unix"
+
+// On these architectures, the original system calls only take 16-bit IDs.
+const (
+	sysSetgroups = unix.SYS_SETGROUPS32
+	sysSetresgid = unix.SYS_SETRESGID32
+	sysSetresuid = unix.SYS_SETRESUID32
+)
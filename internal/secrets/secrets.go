@@ -0,0 +1,155 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package secrets resolves references to secrets, such as
+// "secret://db/password", from external sources. Only the references are
+// kept in the plan; the values are looked up when they're needed.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// RefPrefix is the prefix of a value that refers to a secret.
+const RefPrefix = "secret://"
+
+// EnvPrefix is the prefix of the environment variables of the daemon that
+// secrets are read from by the Env provider.
+const EnvPrefix = "PEBBLE_SECRET_"
+
+// ErrNotFound is returned by a Provider that doesn't have the secret.
+var ErrNotFound = errors.New("secret not found")
+
+// Provider is a source of secrets, such as a directory of files or a secret
+// store like Vault.
+type Provider interface {
+	// Lookup returns the value of the named secret, or ErrNotFound if the
+	// provider doesn't have it.
+	Lookup(name string) (string, error)
+}
+
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+(/[A-Za-z0-9_.-]+)*$`)
+
+// ParseRef returns the name of the secret that value refers to, and whether
+// it is a reference at all (starts with "secret://"). It returns an error if
+// the value is a reference but the name isn't valid.
+func ParseRef(value string) (name string, isRef bool, err error) {
+	if !strings.HasPrefix(value, RefPrefix) {
+		return "", false, nil
+	}
+	name = value[len(RefPrefix):]
+	if !nameRegexp.MatchString(name) {
+		return "", true, fmt.Errorf("invalid secret reference %q", value)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "." || part == ".." {
+			return "", true, fmt.Errorf("invalid secret reference %q", value)
+		}
+	}
+	return name, true, nil
+}
+
+// Resolve returns value itself, or if it refers to a secret, the value of
+// that secret from the provider.
+func Resolve(p Provider, value string) (string, error) {
+	name, isRef, err := ParseRef(value)
+	if err != nil || !isRef {
+		return value, err
+	}
+	if p == nil {
+		return "", fmt.Errorf("cannot look up secret %q: no secrets provider", name)
+	}
+	secret, err := p.Lookup(name)
+	if err == ErrNotFound {
+		return "", fmt.Errorf("secret %q not found", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot look up secret %q: %w", name, err)
+	}
+	return secret, nil
+}
+
+// Dir is a Provider that reads each secret from a file in a directory (for
+// example, one mounted by a container orchestrator), with "db/password"
+// read from "<dir>/db/password". A trailing newline is removed.
+type Dir string
+
+func (d Dir) Lookup(name string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(string(d), filepath.FromSlash(name)))
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// Env is a Provider that reads each secret from an environment variable of
+// the current process, named by the prefix followed by the secret's name in
+// upper case, with other characters replaced by underscores. For example,
+// with prefix "PEBBLE_SECRET_", "db/password" is read from
+// PEBBLE_SECRET_DB_PASSWORD.
+type Env string
+
+func (e Env) Lookup(name string) (string, error) {
+	key := string(e) + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Environ returns the environment of the current process, like os.Environ,
+// but without the variables that hold secrets (those starting with
+// EnvPrefix). It's used as the base environment of child processes, which
+// should only see the secrets they refer to explicitly.
+func Environ() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, EnvPrefix) {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// Chain is a Provider that looks up each secret in its providers in turn,
+// returning the first one found.
+type Chain []Provider
+
+func (c Chain) Lookup(name string) (string, error) {
+	for _, p := range c {
+		value, err := p.Lookup(name)
+		if err != ErrNotFound {
+			return value, err
+		}
+	}
+	return "", ErrNotFound
+}
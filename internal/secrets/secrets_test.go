@@ -0,0 +1,143 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package secrets_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/secrets"
+	"github.com/canonical/pebble/internal/testutil"
+)
+
+// Hook up check.v1 into the "go test" runner
+func Test(t *testing.T) { TestingT(t) }
+
+type secretsSuite struct{}
+
+var _ = Suite(&secretsSuite{})
+
+func (s *secretsSuite) TestParseRef(c *C) {
+	for _, test := range []struct {
+		value string
+		name  string
+		isRef bool
+		err   string
+	}{
+		{"plain", "", false, ""},
+		{"secret://db/password", "db/password", true, ""},
+		{"secret://token", "token", true, ""},
+		{"secret://", "", true, `invalid secret reference "secret://"`},
+		{"secret:///abs", "", true, `invalid secret reference "secret:///abs"`},
+		{"secret://a/../b", "", true, `invalid secret reference "secret://a/../b"`},
+		{"secret://a b", "", true, `invalid secret reference "secret://a b"`},
+	} {
+		name, isRef, err := secrets.ParseRef(test.value)
+		comment := Commentf("value %q", test.value)
+		c.Check(name, Equals, test.name, comment)
+		c.Check(isRef, Equals, test.isRef, comment)
+		if test.err != "" {
+			c.Check(err, ErrorMatches, test.err, comment)
+		} else {
+			c.Check(err, IsNil, comment)
+		}
+	}
+}
+
+func (s *secretsSuite) TestDir(c *C) {
+	dir := c.MkDir()
+	c.Assert(os.Mkdir(filepath.Join(dir, "db"), 0700), IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "db", "password"), []byte("s3cret\n"), 0600), IsNil)
+
+	value, err := secrets.Dir(dir).Lookup("db/password")
+	c.Assert(err, IsNil)
+	c.Check(value, Equals, "s3cret")
+
+	_, err = secrets.Dir(dir).Lookup("db/user")
+	c.Check(err, Equals, secrets.ErrNotFound)
+}
+
+func (s *secretsSuite) TestEnv(c *C) {
+	os.Setenv("PEBBLE_TEST_SECRET_DB_PASS_WORD", "from-env")
+	defer os.Unsetenv("PEBBLE_TEST_SECRET_DB_PASS_WORD")
+
+	value, err := secrets.Env("PEBBLE_TEST_SECRET_").Lookup("db/pass-word")
+	c.Assert(err, IsNil)
+	c.Check(value, Equals, "from-env")
+
+	_, err = secrets.Env("PEBBLE_TEST_SECRET_").Lookup("other")
+	c.Check(err, Equals, secrets.ErrNotFound)
+}
+
+func (s *secretsSuite) TestEnviron(c *C) {
+	os.Setenv("PEBBLE_SECRET_TEST_ENVIRON", "s3cret")
+	defer os.Unsetenv("PEBBLE_SECRET_TEST_ENVIRON")
+	os.Setenv("PEBBLE_TEST_ENVIRON", "visible")
+	defer os.Unsetenv("PEBBLE_TEST_ENVIRON")
+
+	env := secrets.Environ()
+	c.Check(env, testutil.Contains, "PEBBLE_TEST_ENVIRON=visible")
+	for _, kv := range env {
+		c.Check(strings.HasPrefix(kv, secrets.EnvPrefix), Equals, false, Commentf("%s", kv))
+	}
+}
+
+type fakeProvider map[string]string
+
+func (p fakeProvider) Lookup(name string) (string, error) {
+	if name == "broken" {
+		return "", errors.New("backend down")
+	}
+	value, ok := p[name]
+	if !ok {
+		return "", secrets.ErrNotFound
+	}
+	return value, nil
+}
+
+func (s *secretsSuite) TestResolve(c *C) {
+	p := secrets.Chain{fakeProvider{"a": "1"}, fakeProvider{"a": "2", "b": "3"}}
+
+	for _, test := range []struct {
+		value  string
+		result string
+		err    string
+	}{
+		{"plain", "plain", ""},
+		{"secret://a", "1", ""},
+		{"secret://b", "3", ""},
+		{"secret://c", "", `secret "c" not found`},
+		{"secret://broken", "", `cannot look up secret "broken": backend down`},
+		{"secret://../x", "", `invalid secret reference "secret://../x"`},
+	} {
+		result, err := secrets.Resolve(p, test.value)
+		comment := Commentf("value %q", test.value)
+		if test.err != "" {
+			c.Check(err, ErrorMatches, test.err, comment)
+		} else {
+			c.Check(err, IsNil, comment)
+			c.Check(result, Equals, test.result, comment)
+		}
+	}
+
+	_, err := secrets.Resolve(nil, "secret://a")
+	c.Check(err, ErrorMatches, `cannot look up secret "a": no secrets provider`)
+}
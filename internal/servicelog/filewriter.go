@@ -0,0 +1,221 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package servicelog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/canonical/pebble/internal/logger"
+)
+
+// FileOptions holds the rotation options for a FileWriter.
+type FileOptions struct {
+	// MaxSize is the size in bytes the file may grow to before it's
+	// rotated. If zero, the file is never rotated.
+	MaxSize int64
+
+	// Backups is the number of rotated files to keep.
+	Backups int
+
+	// Compress specifies whether rotated files are gzip-compressed.
+	Compress bool
+}
+
+// FileWriter is an io.WriteCloser that appends service output to a file on
+// disk, rotating the file when it would grow beyond a maximum size.
+type FileWriter struct {
+	mut         sync.Mutex
+	path        string
+	options     FileOptions
+	file        *os.File
+	size        int64
+	lineStart   bool
+	compressing sync.WaitGroup
+}
+
+// NewFileWriter opens (creating it and its parent directory if necessary)
+// the log file at path for appending.
+//
+// If options.MaxSize is positive, the file is rotated once it would grow
+// beyond that many bytes, keeping up to options.Backups previous files named
+// path.1 (the most recent), path.2, and so on, or path.1.gz and so on if
+// options.Compress is set. Rotation only happens between lines, so a line is
+// never split across files (though this means a file may slightly exceed the
+// maximum size). Rotated files are compressed in the background, so writes
+// aren't held up while that happens.
+func NewFileWriter(path string, options FileOptions) (*FileWriter, error) {
+	w := &FileWriter{
+		path:    path,
+		options: options,
+	}
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = w.open()
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *FileWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	// An existing file may end part-way through a line (for example, if
+	// the daemon was killed), but only rotate it at the next line break.
+	w.lineStart = w.size == 0
+	return nil
+}
+
+// Write appends p to the log file, first rotating the file if p starts a
+// new line and writing it would make the file exceed the maximum size.
+func (w *FileWriter) Write(p []byte) (int, error) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if w.options.MaxSize > 0 && w.lineStart && w.size > 0 && w.size+int64(len(p)) > w.options.MaxSize {
+		err := w.rotate()
+		if err != nil {
+			return 0, fmt.Errorf("cannot rotate log file: %w", err)
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	if n > 0 {
+		w.lineStart = p[n-1] == '\n'
+	}
+	return n, err
+}
+
+// rotate moves the current log file to the first backup (shifting existing
+// backups along and removing the oldest), and opens a new, empty log file.
+func (w *FileWriter) rotate() error {
+	err := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return err
+	}
+	if w.options.Backups <= 0 {
+		err = os.Remove(w.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return w.open()
+	}
+
+	// Finish compressing the previous backup before it's shifted along.
+	w.compressing.Wait()
+	for i := w.options.Backups - 1; i >= 1; i-- {
+		err := os.Rename(w.backupPath(i), w.backupPath(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	rotated := fmt.Sprintf("%s.1", w.path)
+	err = os.Rename(w.path, rotated)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = w.open()
+	if err != nil {
+		return err
+	}
+	if w.options.Compress {
+		w.compressing.Add(1)
+		go func() {
+			defer w.compressing.Done()
+			err := compressFile(rotated, rotated+".gz")
+			if err != nil {
+				logger.Noticef("Cannot compress log file %q: %v", rotated, err)
+			}
+		}()
+	}
+	return nil
+}
+
+func (w *FileWriter) backupPath(n int) string {
+	if w.options.Compress {
+		return fmt.Sprintf("%s.%d.gz", w.path, n)
+	}
+	return fmt.Sprintf("%s.%d", w.path, n)
+}
+
+// compressFile writes a gzip-compressed copy of the file at src to dst, and
+// then removes src.
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// Close closes the log file, waiting for any background compression of
+// rotated files to finish.
+func (w *FileWriter) Close() error {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	w.compressing.Wait()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
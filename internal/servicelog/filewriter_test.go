@@ -0,0 +1,142 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>
+
+package servicelog_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/servicelog"
+)
+
+type fileWriterSuite struct{}
+
+var _ = Suite(&fileWriterSuite{})
+
+func readFile(c *C, path string) string {
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	return string(data)
+}
+
+func (s *fileWriterSuite) TestAppend(c *C) {
+	path := filepath.Join(c.MkDir(), "logs", "svc.log")
+
+	w, err := servicelog.NewFileWriter(path, servicelog.FileOptions{})
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte("first\n"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	// Reopening appends to the existing file.
+	w, err = servicelog.NewFileWriter(path, servicelog.FileOptions{})
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte("second\n"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	c.Check(readFile(c, path), Equals, "first\nsecond\n")
+
+	_, err = w.Write([]byte("closed\n"))
+	c.Check(err, Equals, os.ErrClosed)
+}
+
+func (s *fileWriterSuite) TestRotate(c *C) {
+	path := filepath.Join(c.MkDir(), "svc.log")
+
+	w, err := servicelog.NewFileWriter(path, servicelog.FileOptions{MaxSize: 10, Backups: 2})
+	c.Assert(err, IsNil)
+	defer w.Close()
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		_, err = w.Write([]byte(line))
+		c.Assert(err, IsNil)
+	}
+
+	c.Check(readFile(c, path), Equals, "gggg\n")
+	c.Check(readFile(c, path+".1"), Equals, "eeee\nffff\n")
+	c.Check(readFile(c, path+".2"), Equals, "cccc\ndddd\n")
+	_, err = os.Stat(path + ".3")
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *fileWriterSuite) TestRotateNoBackups(c *C) {
+	path := filepath.Join(c.MkDir(), "svc.log")
+
+	w, err := servicelog.NewFileWriter(path, servicelog.FileOptions{MaxSize: 10})
+	c.Assert(err, IsNil)
+	defer w.Close()
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n"} {
+		_, err = w.Write([]byte(line))
+		c.Assert(err, IsNil)
+	}
+
+	c.Check(readFile(c, path), Equals, "cccc\n")
+	_, err = os.Stat(path + ".1")
+	c.Check(os.IsNotExist(err), Equals, true)
+}
+
+func (s *fileWriterSuite) TestRotateBetweenLines(c *C) {
+	path := filepath.Join(c.MkDir(), "svc.log")
+
+	w, err := servicelog.NewFileWriter(path, servicelog.FileOptions{MaxSize: 10, Backups: 1})
+	c.Assert(err, IsNil)
+	defer w.Close()
+
+	// The formatter writes the timestamp prefix and the line separately; a
+	// line that's in progress is never split across files, even if it's
+	// longer than the maximum size.
+	for _, chunk := range []string{"[a] ", "aaaa\n", "[b] ", "bbbbbbbb\n", "[c] ", "c\n"} {
+		_, err = w.Write([]byte(chunk))
+		c.Assert(err, IsNil)
+	}
+
+	c.Check(readFile(c, path+".1"), Equals, "[b] bbbbbbbb\n")
+	c.Check(readFile(c, path), Equals, "[c] c\n")
+}
+
+func readGzipFile(c *C, path string) string {
+	f, err := os.Open(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	return string(data)
+}
+
+func (s *fileWriterSuite) TestRotateCompress(c *C) {
+	path := filepath.Join(c.MkDir(), "svc.log")
+
+	w, err := servicelog.NewFileWriter(path, servicelog.FileOptions{MaxSize: 10, Backups: 2, Compress: true})
+	c.Assert(err, IsNil)
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n"} {
+		_, err = w.Write([]byte(line))
+		c.Assert(err, IsNil)
+	}
+	// Close waits for compression to finish.
+	c.Assert(w.Close(), IsNil)
+
+	c.Check(readFile(c, path), Equals, "gggg\n")
+	c.Check(readGzipFile(c, path+".1.gz"), Equals, "eeee\nffff\n")
+	c.Check(readGzipFile(c, path+".2.gz"), Equals, "cccc\ndddd\n")
+	matches, err := filepath.Glob(path + ".*")
+	c.Assert(err, IsNil)
+	c.Check(matches, DeepEquals, []string{path + ".1.gz", path + ".2.gz"})
+}
@@ -50,6 +50,14 @@ func FakeJournalStdoutPath(path string) func() {
 	}
 }
 
+func FakeJournalSocketPath(path string) func() {
+	oldPath := journalSocketPath
+	journalSocketPath = path
+	return func() {
+		journalSocketPath = oldPath
+	}
+}
+
 func (e *Error) SetExitCode(i int) {
 	e.exitCode = i
 }
@@ -16,13 +16,24 @@ package systemd
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"log/syslog"
 	"net"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 )
 
-var journalStdoutPath = "/run/systemd/journal/stdout"
+var (
+	journalStdoutPath = "/run/systemd/journal/stdout"
+	journalSocketPath = "/run/systemd/journal/socket"
+)
+
+// maxJournalMessage is the longest message sent in one journal entry;
+// longer lines are split into several entries.
+const maxJournalMessage = 48 * 1024
 
 // NewJournalStreamFile creates log stream file descriptor to the journal. The
 // semantics is identical to that of sd_journal_stream_fd(3) call.
@@ -65,3 +76,103 @@ func NewJournalStreamFile(identifier string, priority syslog.Priority, levelPref
 
 	return conn.File()
 }
+
+// JournalWriter is an io.WriteCloser that sends each line written to it to
+// the journal as a separate entry, using journald's native protocol (see
+// https://systemd.io/JOURNAL_NATIVE_PROTOCOL/).
+type JournalWriter struct {
+	mu         sync.Mutex
+	conn       *net.UnixConn
+	identifier string
+	priority   syslog.Priority
+	partial    []byte
+}
+
+// NewJournalWriter connects to the journal, returning a writer that logs
+// lines with the given SYSLOG_IDENTIFIER and priority.
+func NewJournalWriter(identifier string, priority syslog.Priority) (*JournalWriter, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocketPath, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &JournalWriter{
+		conn:       conn,
+		identifier: identifier,
+		priority:   priority,
+	}, nil
+}
+
+// Write sends each complete line in p to the journal, keeping any
+// incomplete line at the end until the rest of it is written.
+func (w *JournalWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return 0, os.ErrClosed
+	}
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		err := w.send(w.partial[:i])
+		w.partial = w.partial[i+1:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+	for len(w.partial) >= maxJournalMessage {
+		err := w.send(w.partial[:maxJournalMessage])
+		w.partial = w.partial[maxJournalMessage:]
+		if err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Close sends any incomplete line and disconnects from the journal.
+func (w *JournalWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.conn == nil {
+		return os.ErrClosed
+	}
+	var err error
+	if len(w.partial) > 0 {
+		err = w.send(w.partial)
+		w.partial = nil
+	}
+	if closeErr := w.conn.Close(); err == nil {
+		err = closeErr
+	}
+	w.conn = nil
+	return err
+}
+
+func (w *JournalWriter) send(message []byte) error {
+	var entry bytes.Buffer
+	writeJournalField(&entry, "MESSAGE", string(message))
+	writeJournalField(&entry, "PRIORITY", strconv.Itoa(int(w.priority)))
+	writeJournalField(&entry, "SYSLOG_IDENTIFIER", w.identifier)
+	_, err := w.conn.Write(entry.Bytes())
+	return err
+}
+
+// writeJournalField encodes a field of a journal entry: "KEY=value\n", or
+// if the value contains a newline, the key, a newline, the length of the
+// value as a little-endian uint64, the value, and a newline.
+func writeJournalField(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	if strings.ContainsRune(value, '\n') {
+		buf.WriteByte('\n')
+		binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	} else {
+		buf.WriteByte('=')
+	}
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
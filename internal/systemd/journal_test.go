@@ -17,6 +17,7 @@ package systemd_test
 import (
 	"log/syslog"
 	"net"
+	"os"
 	"path"
 
 	. "gopkg.in/check.v1"
@@ -82,3 +83,39 @@ func (j *journalTestSuite) TestStreamFileHeader(c *C) {
 
 	<-doneCh
 }
+
+func (j *journalTestSuite) TestJournalWriter(c *C) {
+	fakePath := path.Join(c.MkDir(), "fake-journal-socket")
+	restore := FakeJournalSocketPath(fakePath)
+	defer restore()
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: fakePath, Net: "unixgram"})
+	c.Assert(err, IsNil)
+	defer conn.Close()
+
+	w, err := NewJournalWriter("svc1", syslog.LOG_INFO)
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte("hello\nwor"))
+	c.Assert(err, IsNil)
+	_, err = w.Write([]byte("ld\npartial"))
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	buf := make([]byte, 4096)
+	for _, message := range []string{"hello", "world", "partial"} {
+		n, err := conn.Read(buf)
+		c.Assert(err, IsNil)
+		c.Check(string(buf[:n]), Equals, "MESSAGE="+message+"\nPRIORITY=6\nSYSLOG_IDENTIFIER=svc1\n")
+	}
+
+	_, err = w.Write([]byte("foo\n"))
+	c.Check(err, Equals, os.ErrClosed)
+}
+
+func (j *journalTestSuite) TestJournalWriterNoJournal(c *C) {
+	restore := FakeJournalSocketPath(path.Join(c.MkDir(), "fake-journal-socket"))
+	defer restore()
+
+	_, err := NewJournalWriter("svc1", syslog.LOG_INFO)
+	c.Assert(err, ErrorMatches, ".*no such file or directory")
+}
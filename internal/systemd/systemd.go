@@ -35,6 +35,7 @@ import (
 
 	"github.com/canonical/pebble/internal/osutil"
 	"github.com/canonical/pebble/internal/osutil/squashfs"
+	"github.com/canonical/pebble/internal/reaper"
 )
 
 var (
@@ -88,7 +89,7 @@ func (m *extMutex) Taken(errMsg string) {
 
 // systemctlCmd calls systemctl with the given args, returning its standard output (and wrapped error)
 var systemctlCmd = func(args ...string) ([]byte, error) {
-	bs, err := exec.Command("systemctl", args...).CombinedOutput()
+	bs, err := reaper.CommandCombinedOutput(exec.Command("systemctl", args...))
 	if err != nil {
 		exitCode, _ := osutil.ExitCode(err)
 		return nil, &Error{cmd: args, exitCode: exitCode, msg: bs}
@@ -726,7 +727,7 @@ func (s *systemd) RemoveMountUnitFile(mountedDir string) error {
 		return err
 	}
 	if isMounted {
-		if output, err := exec.Command("umount", "-d", "-l", mountedDir).CombinedOutput(); err != nil {
+		if output, err := reaper.CommandCombinedOutput(exec.Command("umount", "-d", "-l", mountedDir)); err != nil {
 			return osutil.OutputErr(output, err)
 		}
 
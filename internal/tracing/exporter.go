@@ -0,0 +1,300 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"github.com/canonical/pebble/internal/logger"
+)
+
+var (
+	exportInterval = 5 * time.Second
+	exportTimeout  = 10 * time.Second
+)
+
+const (
+	// maxBatch is the number of spans that triggers an export before the
+	// interval has passed.
+	maxBatch = 512
+
+	// maxQueue is the number of spans kept while the collector can't be
+	// reached. Newer spans are dropped after that.
+	maxQueue = 4096
+)
+
+// Exporter sends spans in batches to an OpenTelemetry collector, using the
+// OTLP/HTTP protocol with JSON encoding.
+type Exporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+	failing bool
+
+	flush chan struct{}
+	tomb  tomb.Tomb
+}
+
+// NewExporter returns an exporter that sends spans to the given OTLP traces
+// endpoint (for example "http://localhost:4318/v1/traces"), with serviceName
+// as the "service.name" resource attribute.
+func NewExporter(endpoint, serviceName string) *Exporter {
+	e := &Exporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: exportTimeout},
+		flush:       make(chan struct{}, 1),
+	}
+	e.tomb.Go(e.loop)
+	return e
+}
+
+// Export queues the span to be sent to the collector.
+func (e *Exporter) Export(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) >= maxQueue {
+		e.dropped++
+		return
+	}
+	e.queue = append(e.queue, span)
+	if len(e.queue) >= maxBatch {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Stop sends any queued spans and stops the exporter.
+func (e *Exporter) Stop() error {
+	e.tomb.Kill(nil)
+	return e.tomb.Wait()
+}
+
+func (e *Exporter) loop() error {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flush:
+		case <-e.tomb.Dying():
+			e.send()
+			return nil
+		}
+		e.send()
+	}
+}
+
+// send exports the queued spans, keeping them for the next attempt if the
+// collector can't be reached.
+func (e *Exporter) send() {
+	e.mu.Lock()
+	spans := e.queue
+	e.queue = nil
+	dropped := e.dropped
+	e.dropped = 0
+	e.mu.Unlock()
+
+	if dropped > 0 {
+		logger.Noticef("Dropped %d trace spans: too many queued", dropped)
+	}
+	if len(spans) == 0 {
+		return
+	}
+	err := e.post(spans)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		if !e.failing {
+			logger.Noticef("Cannot export trace spans: %v", err)
+			e.failing = true
+		}
+		if e.tomb.Alive() {
+			e.queue = append(spans, e.queue...)
+			if len(e.queue) > maxQueue {
+				e.dropped += len(e.queue) - maxQueue
+				e.queue = e.queue[:maxQueue]
+			}
+		}
+		return
+	}
+	if e.failing {
+		logger.Noticef("Exporting trace spans again")
+		e.failing = false
+	}
+}
+
+func (e *Exporter) post(spans []*Span) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	rsp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	io.Copy(ioutil.Discard, rsp.Body)
+	if rsp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded with status %d", rsp.StatusCode)
+	}
+	return nil
+}
+
+// The following types are the JSON encoding of an OTLP
+// ExportTraceServiceRequest.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpStatusOK    = 1
+	otlpStatusError = 2
+)
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string         `json:"stringValue,omitempty"`
+	BoolValue   *bool           `json:"boolValue,omitempty"`
+	IntValue    *string         `json:"intValue,omitempty"`
+	ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpValue `json:"values"`
+}
+
+func (e *Exporter) request(spans []*Span) *otlpRequest {
+	otlpSpans := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		otlpSpans[i] = otlpSpan{
+			TraceID:           span.Context.TraceID.String(),
+			SpanID:            span.Context.SpanID.String(),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+			Status:            otlpStatus{Code: otlpStatusOK},
+		}
+		if span.Parent.IsValid() {
+			otlpSpans[i].ParentSpanID = span.Parent.String()
+		}
+		if span.Err != "" {
+			otlpSpans[i].Status = otlpStatus{Code: otlpStatusError, Message: span.Err}
+		}
+	}
+	resource := []Attribute{{"service.name", e.serviceName}}
+	return &otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: otlpAttributes(resource)},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "pebble"},
+				Spans: otlpSpans,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(attrs []Attribute) []otlpAttribute {
+	if len(attrs) == 0 {
+		return nil
+	}
+	result := make([]otlpAttribute, len(attrs))
+	for i, attr := range attrs {
+		result[i] = otlpAttribute{Key: attr.Key, Value: newOTLPValue(attr.Value)}
+	}
+	return result
+}
+
+func newOTLPValue(v interface{}) otlpValue {
+	switch v := v.(type) {
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return otlpValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpValue{IntValue: &s}
+	case []string:
+		values := make([]otlpValue, len(v))
+		for i, s := range v {
+			values[i] = newOTLPValue(s)
+		}
+		return otlpValue{ArrayValue: &otlpArrayValue{Values: values}}
+	case string:
+		return otlpValue{StringValue: &v}
+	default:
+		s := fmt.Sprint(v)
+		return otlpValue{StringValue: &s}
+	}
+}
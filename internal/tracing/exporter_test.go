@@ -0,0 +1,135 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tracing_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/tracing"
+)
+
+type exporterSuite struct{}
+
+var _ = Suite(&exporterSuite{})
+
+type fakeCollector struct {
+	mu       sync.Mutex
+	fail     bool
+	requests []map[string]interface{}
+}
+
+func (f *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	var req map[string]interface{}
+	json.Unmarshal(body, &req)
+	req["content-type"] = r.Header.Get("Content-Type")
+	req["path"] = r.URL.Path
+	f.requests = append(f.requests, req)
+}
+
+func testSpan() *tracing.Span {
+	parent, _ := tracing.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	return &tracing.Span{
+		Context: tracing.SpanContext{TraceID: parent.TraceID, SpanID: tracing.SpanID{1, 2, 3, 4, 5, 6, 7, 8}},
+		Parent:  parent.SpanID,
+		Name:    "start",
+		Kind:    tracing.SpanKindInternal,
+		Start:   time.Unix(1, 0),
+		End:     time.Unix(2, 500),
+		Attributes: []tracing.Attribute{
+			tracing.Attr("s", "foo"),
+			tracing.Attr("b", true),
+			tracing.Attr("i", 42),
+			tracing.Attr("l", []string{"x", "y"}),
+		},
+		Err: "oops",
+	}
+}
+
+func (s *exporterSuite) TestExport(c *C) {
+	collector := &fakeCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	e := tracing.NewExporter(server.URL+"/v1/traces", "svc")
+	e.Export(testSpan())
+	c.Assert(e.Stop(), IsNil)
+
+	c.Assert(collector.requests, HasLen, 1)
+	var expected map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"content-type": "application/json",
+		"path": "/v1/traces",
+		"resourceSpans": [{
+			"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "svc"}}]},
+			"scopeSpans": [{
+				"scope": {"name": "pebble"},
+				"spans": [{
+					"traceId": "4bf92f3577b34da6a3ce929d0e0e4736",
+					"spanId": "0102030405060708",
+					"parentSpanId": "00f067aa0ba902b7",
+					"name": "start",
+					"kind": 1,
+					"startTimeUnixNano": "1000000000",
+					"endTimeUnixNano": "2000000500",
+					"attributes": [
+						{"key": "s", "value": {"stringValue": "foo"}},
+						{"key": "b", "value": {"boolValue": true}},
+						{"key": "i", "value": {"intValue": "42"}},
+						{"key": "l", "value": {"arrayValue": {"values": [{"stringValue": "x"}, {"stringValue": "y"}]}}}
+					],
+					"status": {"code": 2, "message": "oops"}
+				}]
+			}]
+		}]
+	}`), &expected)
+	c.Assert(err, IsNil)
+	c.Check(collector.requests[0], DeepEquals, expected)
+}
+
+func (s *exporterSuite) TestExportRetries(c *C) {
+	restore := tracing.FakeExportInterval(time.Millisecond)
+	defer restore()
+
+	collector := &fakeCollector{fail: true}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	e := tracing.NewExporter(server.URL, "pebble")
+	e.Export(testSpan())
+	time.Sleep(20 * time.Millisecond)
+	collector.mu.Lock()
+	collector.fail = false
+	collector.mu.Unlock()
+	c.Assert(e.Stop(), IsNil)
+
+	// The span was kept until the collector could be reached.
+	c.Assert(collector.requests, HasLen, 1)
+	spans := collector.requests[0]["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	c.Check(spans, HasLen, 1)
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package tracing records spans for API requests, changes and tasks, and
+// exports them to an OpenTelemetry collector with the OTLP/HTTP protocol.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// TraceID identifies a trace: a tree of spans.
+type TraceID [16]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether the ID is set (not all zeros).
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// IsValid reports whether the ID is set (not all zeros).
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+// NewTraceID returns a random trace ID.
+func NewTraceID() TraceID {
+	var id TraceID
+	rand.Read(id[:])
+	return id
+}
+
+// NewSpanID returns a random span ID.
+func NewSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+	return id
+}
+
+// SpanContext identifies a span, so that child spans can refer to it.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+// NewSpanContext returns the context for a new span that is a child of
+// parent, or the root of a new trace if parent is not valid.
+func NewSpanContext(parent SpanContext) SpanContext {
+	traceID := parent.TraceID
+	if !traceID.IsValid() {
+		traceID = NewTraceID()
+	}
+	return SpanContext{TraceID: traceID, SpanID: NewSpanID()}
+}
+
+// ParseTraceParent parses a W3C "traceparent" header, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", returning
+// false if it is not valid.
+func ParseTraceParent(header string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	if len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	if !sc.TraceID.IsValid() || !sc.SpanID.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// SpanKind is the role of a span in a trace.
+type SpanKind int
+
+// These values match those of the OTLP protocol.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+)
+
+// Attribute is a key-value pair describing a span. The value must be a
+// string, bool, int, int64 or []string.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr returns an attribute with the given key and value.
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is a completed operation, such as an API request or a task.
+type Span struct {
+	Context SpanContext
+	Parent  SpanID
+	Name    string
+	Kind    SpanKind
+	Start   time.Time
+	End     time.Time
+
+	Attributes []Attribute
+
+	// Err, if not empty, is the error the operation failed with.
+	Err string
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2021 Canonical Ltd
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License version 3 as
+// published by the Free Software Foundation.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package tracing_test
+
+import (
+	"testing"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/canonical/pebble/internal/tracing"
+)
+
+// Hook up check.v1 into the "go test" runner
+func Test(t *testing.T) { TestingT(t) }
+
+type spanSuite struct{}
+
+var _ = Suite(&spanSuite{})
+
+func (s *spanSuite) TestParseTraceParent(c *C) {
+	sc, ok := tracing.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	c.Assert(ok, Equals, true)
+	c.Check(sc.TraceID.String(), Equals, "4bf92f3577b34da6a3ce929d0e0e4736")
+	c.Check(sc.SpanID.String(), Equals, "00f067aa0ba902b7")
+
+	for _, header := range []string{
+		"",
+		"foo",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b-01",
+		"00-xbf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+	} {
+		_, ok := tracing.ParseTraceParent(header)
+		c.Check(ok, Equals, false, Commentf("header %q", header))
+	}
+}
+
+func (s *spanSuite) TestNewSpanContext(c *C) {
+	root := tracing.NewSpanContext(tracing.SpanContext{})
+	c.Check(root.TraceID.IsValid(), Equals, true)
+	c.Check(root.SpanID.IsValid(), Equals, true)
+
+	child := tracing.NewSpanContext(root)
+	c.Check(child.TraceID, Equals, root.TraceID)
+	c.Check(child.SpanID, Not(Equals), root.SpanID)
+}